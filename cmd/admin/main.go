@@ -0,0 +1,588 @@
+// Command-line client for the rate limiter's AdminService.
+// Usage: go run ./cmd/admin -addr localhost:50051 <command> [flags]
+//
+// Commands:
+//
+//	anomalies        list the keys anomaly detection throttled
+//	delete-buckets   delete the buckets of every key starting with a prefix
+//	diagnostics      dump a replica's internal state as JSON
+//	import-denylist  load a denylist file or URL, in chunks
+//	inspect-bucket   show a bucket's stored state
+//	key-history      show the last decisions on a traced key
+//	log-level        show or change a replica's log level
+//	maintenance      show, enable or disable maintenance mode
+//	migrate-buckets  rename the buckets of every key starting with a prefix
+//	preview-rules    estimate how a rules file would change recent denials
+//	reload-script    replace one of the limiter's Lua scripts without a restart
+//	trace-key        log every decision on a key or namespace for a while
+//
+// Run a command with -h for its flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/denylist"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// command is a subcommand, run with the arguments after its name.
+type command struct {
+	summary string
+	run     func(ctx context.Context, admin pb.AdminServiceClient, args []string) error
+}
+
+var commands = map[string]command{
+	"anomalies":       {"list the keys anomaly detection throttled", anomalies},
+	"delete-buckets":  {"delete the buckets of every key starting with a prefix", deleteBuckets},
+	"diagnostics":     {"dump a replica's internal state as JSON", diagnostics},
+	"import-denylist": {"load a denylist file or URL, in chunks", importDenylist},
+	"inspect-bucket":  {"show a bucket's stored state", inspectBucket},
+	"key-history":     {"show the last decisions on a traced key", keyHistory},
+	"log-level":       {"show or change a replica's log level", logLevel},
+	"maintenance":     {"show, enable or disable maintenance mode", maintenance},
+	"migrate-buckets": {"rename the buckets of every key starting with a prefix", migrateBuckets},
+	"preview-rules":   {"estimate how a rules file would change recent denials", previewRules},
+	"reload-script":   {"replace one of the limiter's Lua scripts without a restart", reloadScript},
+	"trace-key":       {"log every decision on a key or namespace for a while", traceKey},
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "gRPC server address")
+	hmacClient := flag.String("hmac-client", "", "client ID to sign calls as, one of the server's HMAC_ADMIN_CLIENTS")
+	hmacSecret := flag.String("hmac-secret-file", "", "file holding -hmac-client's shared secret")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: %s [flags] <command> [command flags]\n\ncommands:\n", os.Args[0])
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "  %-16s%s\n", name, commands[name].summary)
+		}
+		fmt.Fprintln(out, "\nflags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if *hmacClient != "" {
+		secret, err := os.ReadFile(*hmacSecret)
+		if err != nil {
+			log.Fatalf("reading -hmac-secret-file: %v", err)
+		}
+		opts = append(opts, client.WithHMAC(*hmacClient, []byte(strings.TrimSpace(string(secret)))))
+	}
+	conn, err := grpc.Dial(*addr, opts...)
+	if err != nil {
+		log.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := cmd.run(ctx, pb.NewAdminServiceClient(conn), flag.Args()[1:]); err != nil {
+		log.Fatalf("%s: %v", flag.Arg(0), err)
+	}
+}
+
+func deleteBuckets(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("delete-buckets", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the keys; without it, only keys outside every namespace match")
+	prefix := fs.String("prefix", "", "key prefix, e.g. user: (empty for the whole namespace)")
+	rate := fs.Int64("rate", 0, "deletion rate cap in keys per second per Redis node (0 = server default)")
+	quotas := fs.Bool("quotas", false, "also delete the keys' quota counters")
+	dryRun := fs.Bool("dry-run", false, "only count the matching keys")
+	fs.Parse(args)
+
+	res, err := admin.DeleteBuckets(ctx, &pb.DeleteBucketsRequest{
+		Namespace:     *namespace,
+		Prefix:        *prefix,
+		KeysPerSecond: *rate,
+		Quotas:        *quotas,
+		DryRun:        *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d keys match\n", res.Keys)
+	} else {
+		fmt.Printf("deleted %d keys\n", res.Keys)
+	}
+	return nil
+}
+
+func migrateBuckets(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("migrate-buckets", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the keys; without it, only keys outside every namespace match")
+	prefix := fs.String("prefix", "", "key prefix, e.g. user_ (empty for the whole namespace)")
+	rate := fs.Int64("rate", 0, "migration rate cap in keys per second per Redis node (0 = server default)")
+	quotas := fs.Bool("quotas", false, "also move the keys' quota counters")
+	dryRun := fs.Bool("dry-run", false, "only count the keys that would move")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: migrate-buckets [flags] <pattern> <replacement>\n\nRenames the bucket of every key of -namespace starting with -prefix, keeping\nits tokens: the first match of pattern (RE2) in the key is replaced by\nreplacement, which may refer to submatches as $1. For example,\n\n  migrate-buckets -prefix user_ '^user_' 'user:'\n\nmoves user_123 to user:123. Run it before callers switch to the new keys.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	res, err := admin.MigrateBuckets(ctx, &pb.MigrateBucketsRequest{
+		Namespace:     *namespace,
+		Prefix:        *prefix,
+		Pattern:       fs.Arg(0),
+		Replacement:   fs.Arg(1),
+		KeysPerSecond: *rate,
+		Quotas:        *quotas,
+		DryRun:        *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d keys would move, %d would be skipped\n", res.Moved, res.Skipped)
+	} else {
+		fmt.Printf("moved %d keys, skipped %d\n", res.Moved, res.Skipped)
+	}
+	return nil
+}
+
+func inspectBucket(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("inspect-bucket", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: inspect-bucket [flags] [key]\n\nWithout a key, shows the namespace's aggregate cap bucket.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	st, err := admin.InspectBucket(ctx, &pb.InspectBucketRequest{Namespace: *namespace, Key: fs.Arg(0)})
+	if err != nil {
+		return err
+	}
+	if !st.Exists {
+		fmt.Println("no stored state: the bucket is full or was never used")
+		return nil
+	}
+	now, last := unixTime(st.RedisTime), unixTime(st.LastRefill)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "algorithm\t%s\n", st.Algorithm)
+	fmt.Fprintf(w, "tokens\t%g\n", st.Tokens)
+	fmt.Fprintf(w, "last refill\t%s (%s ago)\n", last.Format(time.RFC3339Nano), now.Sub(last).Round(time.Millisecond))
+	if st.TtlMs > 0 {
+		fmt.Fprintf(w, "expires in\t%s\n", time.Duration(st.TtlMs)*time.Millisecond)
+	} else {
+		fmt.Fprintf(w, "expires in\tnever\n")
+	}
+	names := make([]string, 0, len(st.Fields))
+	for name := range st.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "field %s\t%s\n", name, st.Fields[name])
+	}
+	return w.Flush()
+}
+
+// unixTime converts fractional Unix seconds to a time.
+func unixTime(sec float64) time.Time {
+	return time.UnixMicro(int64(sec * 1e6))
+}
+
+func maintenance(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	reason := fs.String("reason", "", "why maintenance mode is on, required with on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: maintenance [flags] [on|off]\n\nWithout an argument, shows whether maintenance mode is on. While it is,\nevery Allow is admitted and the limiter's decisions are only recorded.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var (
+		m   *pb.Maintenance
+		err error
+	)
+	switch fs.Arg(0) {
+	case "":
+		m, err = admin.GetMaintenance(ctx, &pb.GetMaintenanceRequest{})
+	case "on":
+		m, err = admin.SetMaintenance(ctx, &pb.SetMaintenanceRequest{Enabled: true, Reason: *reason})
+	case "off":
+		m, err = admin.SetMaintenance(ctx, &pb.SetMaintenanceRequest{})
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		return err
+	}
+	if !m.Enabled {
+		fmt.Println("maintenance mode is off")
+		return nil
+	}
+	since := time.Unix(m.Since, 0)
+	fmt.Printf("maintenance mode is on since %s (%s ago): %s\n", since.Format(time.RFC3339), time.Since(since).Round(time.Second), m.Reason)
+	return nil
+}
+
+func reloadScript(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("reload-script", flag.ExitOnError)
+	name := fs.String("name", "", "script to replace, e.g. token_bucket.lua (default: the file's name)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: reload-script [flags] <file>\n\nReplaces a script on the replica at -addr only, until it restarts: run it\nagainst every replica, and ship the script as an override for restarts.\nThe file must be pinned in the replica's LUA_SCRIPTS_DIR/SHA256SUMS.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = filepath.Base(fs.Arg(0))
+	}
+
+	res, err := admin.ReloadScript(ctx, &pb.ReloadScriptRequest{Name: *name, Source: string(src)})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s reloaded: %s replaces %s\n", *name, res.Sha1, res.PreviousSha1)
+	return nil
+}
+
+func logLevel(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("log-level", flag.ExitOnError)
+	dur := fs.Duration("for", 15*time.Minute, "how long the level lasts before reverting (0 = until changed again)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: log-level [flags] [error|info|debug]\n\nWithout an argument, shows the log level of the replica at -addr. At debug,\nevery request is logged with its response.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var (
+		l   *pb.LogLevel
+		err error
+	)
+	switch fs.NArg() {
+	case 0:
+		l, err = admin.GetLogLevel(ctx, &pb.GetLogLevelRequest{})
+	case 1:
+		l, err = admin.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: fs.Arg(0), DurationSeconds: int64(dur.Seconds())})
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		return err
+	}
+	if l.RevertAt == 0 {
+		fmt.Printf("log level is %s\n", l.Level)
+		return nil
+	}
+	revert := time.Unix(l.RevertAt, 0)
+	fmt.Printf("log level is %s until %s (%s from now)\n", l.Level, revert.Format(time.RFC3339), time.Until(revert).Round(time.Second))
+	return nil
+}
+
+func previewRules(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("preview-rules", flag.ExitOnError)
+	hours := fs.Int64("hours", 24, "past hours of traffic to estimate with")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: preview-rules [flags] <rules.yaml>\n\nLists the namespaces and prefixes whose limits or expected denials the\nrules file would change, estimated from recent traffic. Nothing is applied.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	res, err := admin.PreviewRules(ctx, &pb.PreviewRulesRequest{Rules: string(src), Hours: *hours})
+	if err != nil {
+		return err
+	}
+	if len(res.Changes) == 0 {
+		fmt.Println("no change for recent traffic")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "namespace\tprefix\teffect\tburst\trate\trequests\tdenied")
+	for _, c := range res.Changes {
+		ns := c.Namespace
+		if ns == "" {
+			ns = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d -> %d\t%g -> %g\t%d\t%.2f%% -> %.2f%%\n",
+			ns, c.Prefix, c.Effect, c.BurstBefore, c.BurstAfter, c.RateBefore, c.RateAfter,
+			c.Requests, 100*c.DenialRateBefore, 100*c.DenialRateAfter)
+	}
+	return w.Flush()
+}
+
+func diagnostics(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("diagnostics", flag.ExitOnError)
+	save := fs.Bool("save", false, "also save the snapshot on the server, to DIAG_DIR or its log")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: diagnostics [flags]\n\nPrints a snapshot of the internal state of the replica at -addr, as\nSIGUSR1 dumps it.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	d, err := admin.DumpDiagnostics(ctx, &pb.DumpDiagnosticsRequest{Save: *save})
+	if err != nil {
+		return err
+	}
+	fmt.Println(d.Json)
+	if d.Path != "" {
+		fmt.Fprintf(os.Stderr, "saved to %s on the server\n", d.Path)
+	}
+	return nil
+}
+
+func traceKey(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("trace-key", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the key")
+	dur := fs.Duration("for", time.Hour, "how long to trace for (at most 24h)")
+	reason := fs.String("reason", "", "why, e.g. a ticket, logged with every decision")
+	stop := fs.Bool("stop", false, "stop tracing instead")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: trace-key [flags] [key]\n\nEvery replica logs each decision on the key, or on the whole namespace\nwithout one, in full. Without a key or -namespace, lists active traces.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	key := fs.Arg(0)
+	switch {
+	case key == "" && *namespace == "":
+		res, err := admin.ListKeyTraces(ctx, &pb.ListKeyTracesRequest{})
+		if err != nil {
+			return err
+		}
+		if len(res.Traces) == 0 {
+			fmt.Println("no active traces")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "namespace\tkey\tuntil\treason")
+		for _, t := range res.Traces {
+			ns, k := t.Namespace, t.Key
+			if ns == "" {
+				ns = "-"
+			}
+			if k == "" {
+				k = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", ns, k, time.Unix(t.ExpiresAt, 0).Format(time.RFC3339), t.Reason)
+		}
+		return w.Flush()
+	case *stop:
+		res, err := admin.UntraceKey(ctx, &pb.UntraceKeyRequest{Namespace: *namespace, Key: key})
+		if err != nil {
+			return err
+		}
+		if !res.Untraced {
+			fmt.Println("was not traced")
+			return nil
+		}
+		fmt.Println("stopped tracing")
+		return nil
+	}
+
+	t, err := admin.TraceKey(ctx, &pb.TraceKeyRequest{Namespace: *namespace, Key: key, DurationSeconds: int64(dur.Seconds()), Reason: *reason})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("tracing until %s; look for TRACE lines in the server logs\n", time.Unix(t.ExpiresAt, 0).Format(time.RFC3339))
+	return nil
+}
+
+func keyHistory(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("key-history", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the key")
+	limit := fs.Int("n", 100, "most decisions to show")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: key-history [flags] <key>\n\nShows the decisions made on the key while it was traced (see trace-key),\nnewest first.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	res, err := admin.GetDecisionHistory(ctx, &pb.GetDecisionHistoryRequest{Namespace: *namespace, Key: fs.Arg(0), Limit: int32(*limit)})
+	if err != nil {
+		return err
+	}
+	if len(res.Decisions) == 0 {
+		fmt.Println("no recorded decisions")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "time\ttokens\tdecision\tremaining\tretry after")
+	for _, d := range res.Decisions {
+		decision, retry := "allowed", "-"
+		if !d.Allowed {
+			decision = "denied"
+			retry = time.Duration(d.RetryAfter * float64(time.Second)).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%g\t%s\t%d/%d\t%s\n", time.UnixMilli(d.AtMs).Format(time.RFC3339Nano), d.Tokens, decision, d.Remaining, d.Limit, retry)
+	}
+	return w.Flush()
+}
+
+func anomalies(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("anomalies", flag.ExitOnError)
+	limit := fs.Int("n", 100, "most records to show")
+	fs.Parse(args)
+
+	res, err := admin.ListAnomalies(ctx, &pb.ListAnomaliesRequest{Limit: int32(*limit)})
+	if err != nil {
+		return err
+	}
+	if len(res.Anomalies) == 0 {
+		fmt.Println("no keys throttled")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "detected	key	req/s	baseline	multiplier	until	host")
+	for _, a := range res.Anomalies {
+		fmt.Fprintf(w, "%s	%s	%.1f	%.1f	%g	%s	%s\n", time.Unix(a.DetectedAt, 0).Format(time.RFC3339), a.Key, a.Rate, a.Baseline, a.Multiplier, time.Unix(a.ExpiresAt, 0).Format(time.RFC3339), a.Host)
+	}
+	return w.Flush()
+}
+
+func importDenylist(ctx context.Context, admin pb.AdminServiceClient, args []string) error {
+	fs := flag.NewFlagSet("import-denylist", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "tenant namespace of the keys")
+	ttl := fs.Duration("ttl", 0, "expiry of entries that don't set one (0 = never)")
+	chunk := fs.Int("chunk", 1000, "entries per call (at most 10000)")
+	remove := fs.Bool("remove", false, "remove the listed keys from the denylist instead")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: import-denylist [flags] <file|url|->\n\nEvery request on a listed key is rejected until its entry expires. The\nlist has one key per line, e.g. ip:203.0.113.7, optionally followed by its\nexpiry as an RFC 3339 time or a duration such as 72h; # starts a comment.\nObject-store lists are read from http(s) URLs, e.g. presigned ones.\n\nflags:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 || *chunk <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	src, err := openSource(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	entries, err := denylist.Parse(src, *ttl, time.Now())
+	src.Close()
+	if err != nil {
+		return err
+	}
+
+	var done, changed int64
+	for start := 0; start < len(entries); start += *chunk {
+		batch := entries[start:min(start+*chunk, len(entries))]
+		if *remove {
+			keys := make([]string, len(batch))
+			for i, e := range batch {
+				keys[i] = e.Key
+			}
+			res, err := admin.RemoveDenylistEntries(ctx, &pb.RemoveDenylistEntriesRequest{Namespace: *namespace, Keys: keys})
+			if err != nil {
+				return fmt.Errorf("after %d of %d entries: %w", done, len(entries), err)
+			}
+			changed += res.Removed
+		} else {
+			req := &pb.AddDenylistEntriesRequest{Namespace: *namespace, Entries: make([]*pb.DenylistEntry, len(batch))}
+			for i, e := range batch {
+				req.Entries[i] = &pb.DenylistEntry{Key: e.Key}
+				if !e.ExpiresAt.IsZero() {
+					req.Entries[i].ExpiresAt = e.ExpiresAt.Unix()
+				}
+			}
+			res, err := admin.AddDenylistEntries(ctx, req)
+			if err != nil {
+				return fmt.Errorf("after %d of %d entries: %w", done, len(entries), err)
+			}
+			changed += res.Added
+		}
+		done += int64(len(batch))
+		fmt.Fprintf(os.Stderr, "\r%d/%d entries", done, len(entries))
+	}
+	if done > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	if *remove {
+		fmt.Printf("removed %d of %d listed keys\n", changed, len(entries))
+	} else {
+		fmt.Printf("loaded %d entries, %d new\n", len(entries), changed)
+	}
+	return nil
+}
+
+// openSource opens a local file, standard input for -, or an http(s) URL.
+func openSource(ctx context.Context, name string) (io.ReadCloser, error) {
+	switch {
+	case name == "-":
+		return io.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s: %s", name, resp.Status)
+		}
+		return resp.Body, nil
+	case strings.Contains(name, "://"):
+		return nil, fmt.Errorf("%s: only http(s) URLs are supported; presign object-store URLs", name)
+	default:
+		return os.Open(name)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,131 @@
+// Benchmark harness for the limiter's algorithms.
+// Usage: go run ./cmd/bench -redis localhost:6379 -algos token_bucket,leased -concurrency 1,16,64 -dist zipf
+//
+// With -keyspace, it instead grows the keyspace to that many buckets and
+// reports Redis memory, expiry/eviction and latency at each step:
+//
+//	go run ./cmd/bench -keyspace 5000000 -steps 10 -burst 100 -rate 10
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/bench"
+)
+
+func main() {
+	addr := flag.String("redis", "localhost:6379", "Redis address")
+	db := flag.Int("db", 15, "Redis database (flushed before each run)")
+	algos := flag.String("algos", "all", "comma-separated algorithms, or all")
+	dists := flag.String("dist", "uniform,zipf,hot", "comma-separated key distributions")
+	conc := flag.String("concurrency", "1,16,64", "comma-separated worker counts (keyspace uses the last)")
+	keys := flag.Int("keys", 1000, "number of distinct keys")
+	dur := flag.Duration("duration", 5*time.Second, "duration of each run")
+	pool := flag.Int("pool", 128, "Redis pool size")
+	keyspace := flag.Int("keyspace", 0, "grow the keyspace to this many buckets instead of running algorithms")
+	steps := flag.Int("steps", 10, "keyspace: number of measurement steps")
+	burst := flag.Int64("burst", 100, "keyspace: bucket burst")
+	rate := flag.Float64("rate", 10, "keyspace: bucket refill rate, which sets the idle TTL")
+	flag.Parse()
+
+	var selected []bench.Algorithm
+	if *algos == "all" {
+		selected = bench.Algorithms
+	} else {
+		for _, name := range strings.Split(*algos, ",") {
+			a, ok := bench.Find(name)
+			if !ok {
+				log.Fatalf("unknown algorithm %q", name)
+			}
+			selected = append(selected, a)
+		}
+	}
+	var workers []int
+	for _, c := range strings.Split(*conc, ",") {
+		n, err := strconv.Atoi(c)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid concurrency %q", c)
+		}
+		workers = append(workers, n)
+	}
+
+	rdb := redis.NewClient(&redis.Options{Addr: *addr, DB: *db, PoolSize: *pool})
+	defer rdb.Close()
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Fatalf("failed to connect to Redis at %s: %v", *addr, err)
+	}
+
+	if *keyspace > 0 {
+		runKeyspace(ctx, rdb, bench.KeyspaceConfig{
+			Keys:        *keyspace,
+			Steps:       *steps,
+			Concurrency: workers[len(workers)-1],
+			Burst:       *burst,
+			Rate:        *rate,
+		})
+		return
+	}
+
+	ops := &bench.OpCounter{}
+	rdb.AddHook(ops)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "algorithm\tdist\tworkers\tdecisions\terrors\tns/op\tallocs/op\tredis-ops/op\tredis-rtt/op\t")
+	for _, algo := range selected {
+		for _, dist := range strings.Split(*dists, ",") {
+			for _, n := range workers {
+				if err := rdb.FlushDB(ctx).Err(); err != nil {
+					log.Fatalf("flush: %v", err)
+				}
+				rep, err := bench.Run(ctx, rdb, ops, bench.Config{
+					Algorithm:    algo,
+					Distribution: dist,
+					Keys:         *keys,
+					Concurrency:  n,
+					Duration:     *dur,
+				})
+				if err != nil {
+					log.Fatalf("%s/%s: %v", algo.Name, dist, err)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%.0f\t%.1f\t%.2f\t%.2f\t\n",
+					algo.Name, dist, n, rep.Decisions, rep.Errors, rep.NsPerOp, rep.AllocsPerOp, rep.RedisPerOp, rep.RTTPerOp)
+				w.Flush()
+			}
+		}
+	}
+	rdb.FlushDB(ctx)
+}
+
+func runKeyspace(ctx context.Context, rdb *redis.Client, cfg bench.KeyspaceConfig) {
+	if err := rdb.FlushDB(ctx).Err(); err != nil {
+		log.Fatalf("flush: %v", err)
+	}
+	if policy, err := rdb.ConfigGet(ctx, "maxmemory-policy").Result(); err == nil {
+		log.Printf("maxmemory-policy: %s", policy["maxmemory-policy"])
+	}
+
+	// Rows are flushed as steps finish; the minimum width keeps them aligned.
+	w := tabwriter.NewWriter(os.Stdout, 12, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "keys\tdbsize\tused-memory\tbytes/key\texpired\tevicted\tp50\tp99\terrors\t")
+	err := bench.RunKeyspace(ctx, rdb, cfg, func(p bench.KeyspacePoint) {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%.0f\t%d\t%d\t%v\t%v\t%d\t\n",
+			p.Keys, p.DBSize, p.UsedMemory, p.BytesPerKey, p.Expired, p.Evicted,
+			p.P50.Round(time.Microsecond), p.P99.Round(time.Microsecond), p.Errors)
+		w.Flush()
+	})
+	if err != nil {
+		log.Fatalf("keyspace: %v", err)
+	}
+	rdb.FlushDB(ctx)
+}
\ No newline at end of file
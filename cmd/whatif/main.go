@@ -0,0 +1,76 @@
+// Estimates the denial rates proposed limits would have caused, from
+// hourly usage aggregates, before the limits are rolled out.
+// Usage: go run ./cmd/whatif -rules rules.yaml -tenants tenants.yaml usage.csv
+//
+// The input is CSV of tenant,prefix,hour,keys,requests,tokens. Estimates
+// assume traffic spread evenly over each hour and key, so real denials
+// will be somewhat higher; replay the raw traffic with cmd/replay for an
+// exact answer.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/whatif"
+)
+
+func main() {
+	rulesFile := flag.String("rules", "", "proposed rules file")
+	tenantsFile := flag.String("tenants", "", "proposed tenants file")
+	burst := flag.Int64("burst", 100, "server default burst (DEFAULT_BURST)")
+	rate := flag.Float64("rate", 10, "server default rate (DEFAULT_RATE)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] usage.csv\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	l := whatif.Limits{Tenants: map[string]*tenant.Tenant{}, Burst: *burst, Rate: *rate}
+	if *rulesFile != "" {
+		var err error
+		if l.Rules, err = rules.Load(*rulesFile); err != nil {
+			log.Fatalf("failed to load rules: %v", err)
+		}
+	}
+	if *tenantsFile != "" {
+		tenants, err := tenant.LoadFile(*tenantsFile)
+		if err != nil {
+			log.Fatalf("failed to load tenants: %v", err)
+		}
+		for i := range tenants {
+			l.Tenants[tenants[i].Name] = &tenants[i]
+		}
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	aggs, err := whatif.ReadAggregates(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("read %s: %v", flag.Arg(0), err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "tenant\tprefix\tburst\trate\trequests\tdenied\tdenied%\t")
+	for _, e := range whatif.Evaluate(l, aggs) {
+		name := e.Tenant
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%g\t%d\t%.0f\t%.2f\t\n",
+			name, e.Prefix, e.Burst, e.Rate, e.Requests, e.Denied, 100*e.DenialRate())
+	}
+	w.Flush()
+}
\ No newline at end of file
@@ -0,0 +1,174 @@
+// Package alert posts the alerts of rules to their webhooks, so abuse teams
+// hear about specific customers hitting their limits.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+)
+
+const (
+	// queueSize bounds the webhook calls waiting to be sent. Alerts fired
+	// while it's full are dropped rather than slowing down Allow.
+	queueSize = 256
+
+	// timeout bounds one webhook call.
+	timeout = 5 * time.Second
+)
+
+// Event is the JSON body posted to an alert's webhook.
+type Event struct {
+	Rule        string    `json:"rule"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Key         string    `json:"key"`
+	Reason      string    `json:"reason"` // "denied" | "threshold"
+	Utilization float64   `json:"utilization"`
+	Remaining   int64     `json:"remaining"`
+	Limit       int64     `json:"limit"`
+	Time        time.Time `json:"time"`
+}
+
+type delivery struct {
+	url   string
+	event Event
+}
+
+// firing identifies the alerts of one key, for debouncing.
+type firing struct {
+	alert          *rules.Alert
+	namespace, key string
+}
+
+// Notifier checks decisions against rule alerts and calls the webhooks of
+// those that fire from a background worker. Debouncing is per replica, so
+// a key denied on several replicas may fire once on each.
+type Notifier struct {
+	client *http.Client
+	queue  chan delivery
+	now    func() time.Time
+
+	mu    sync.Mutex
+	quiet map[firing]time.Time // until when an alert stays quiet for a key
+}
+
+// NewNotifier creates a Notifier calling webhooks with client, or
+// http.DefaultClient when nil.
+func NewNotifier(client *http.Client) *Notifier {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Notifier{
+		client: client,
+		queue:  make(chan delivery, queueSize),
+		now:    time.Now,
+		quiet:  map[firing]time.Time{},
+	}
+}
+
+// Observe checks a decision on key, in namespace, against the alerts of
+// rule and queues a webhook call for every alert it fires.
+func (n *Notifier) Observe(rule *rules.Rule, namespace, key string, allowed bool, remaining, limit int64) {
+	if n == nil || rule == nil || len(rule.Alerts) == 0 {
+		return
+	}
+	for _, a := range rule.Alerts {
+		if !a.Watches(key) || !a.Fires(allowed, remaining, limit) {
+			continue
+		}
+		now := n.now()
+		f := firing{alert: a, namespace: namespace, key: key}
+		n.mu.Lock()
+		if now.Before(n.quiet[f]) {
+			n.mu.Unlock()
+			continue
+		}
+		n.quiet[f] = now.Add(a.Debounce)
+		n.mu.Unlock()
+
+		ev := Event{
+			Rule:      rule.Prefix,
+			Namespace: namespace,
+			Key:       key,
+			Reason:    "threshold",
+			Remaining: remaining,
+			Limit:     limit,
+			Time:      now.UTC(),
+		}
+		if limit > 0 {
+			ev.Utilization = 1 - float64(remaining)/float64(limit)
+		}
+		if !allowed {
+			ev.Reason = "denied"
+		}
+		select {
+		case n.queue <- delivery{url: a.URL, event: ev}:
+		default:
+			metrics.AlertsSent.WithLabelValues(rule.Prefix, "dropped").Inc()
+		}
+	}
+}
+
+// Run calls the webhooks of fired alerts until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	prune := time.NewTicker(time.Minute)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-n.queue:
+			result := "sent"
+			if err := n.post(ctx, d); err != nil {
+				log.Printf("alert for %q failed: %v", d.event.Key, err)
+				result = "failed"
+			}
+			metrics.AlertsSent.WithLabelValues(d.event.Rule, result).Inc()
+		case <-prune.C:
+			n.pruneQuiet()
+		}
+	}
+}
+
+func (n *Notifier) post(ctx context.Context, d delivery) error {
+	b, err := json.Marshal(d.event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// pruneQuiet forgets keys whose alerts may fire again.
+func (n *Notifier) pruneQuiet() {
+	now := n.now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for f, until := range n.quiet {
+		if !now.Before(until) {
+			delete(n.quiet, f)
+		}
+	}
+}
\ No newline at end of file
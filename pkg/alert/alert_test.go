@@ -0,0 +1,73 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+)
+
+func TestNotifier(t *testing.T) {
+	events := make(chan Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		events <- ev
+	}))
+	defer hook.Close()
+
+	set, err := rules.Parse([]byte(`
+rules:
+  - prefix: user
+    alerts:
+      - key: user:42
+        threshold: 0.5
+        debounce: 1m
+        url: ` + hook.URL))
+	require.NoError(t, err)
+	rule := set.Match("user:42")
+
+	n := NewNotifier(hook.Client())
+	now := time.Now()
+	n.now = func() time.Time { return now }
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	n.Observe(rule, "acme", "user:42", true, 8, 10) // below the threshold
+	n.Observe(rule, "acme", "user:1", false, 0, 10) // not watched
+	n.Observe(rule, "acme", "user:42", true, 4, 10)
+	ev := <-events
+	assert.Equal(t, "user", ev.Rule)
+	assert.Equal(t, "acme", ev.Namespace)
+	assert.Equal(t, "user:42", ev.Key)
+	assert.Equal(t, "threshold", ev.Reason)
+	assert.InDelta(t, 0.6, ev.Utilization, 1e-9)
+
+	// Debounced, though another namespace's key of the same name isn't
+	n.Observe(rule, "acme", "user:42", false, 0, 10)
+	n.Observe(rule, "other", "user:42", false, 0, 10)
+	ev = <-events
+	assert.Equal(t, "other", ev.Namespace)
+	assert.Equal(t, "denied", ev.Reason)
+
+	now = now.Add(time.Minute)
+	n.Observe(rule, "acme", "user:42", false, 0, 10)
+	ev = <-events
+	assert.Equal(t, "acme", ev.Namespace)
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected alert %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	var none *Notifier
+	none.Observe(rule, "", "user:42", false, 0, 10)
+}
\ No newline at end of file
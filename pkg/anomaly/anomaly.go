@@ -0,0 +1,225 @@
+// Package anomaly throttles keys whose request rate jumps far above their
+// usual rate, as a first line of defense against scraping.
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+const (
+	// auditKey is the list of Records, newest first.
+	auditKey = "ratelimiter:anomalies"
+	// AuditLen is how many Records are kept.
+	AuditLen = 1000
+
+	// maxKeys bounds the keys tracked. Keys first seen beyond it are
+	// ignored until others fade out.
+	maxKeys = 100000
+
+	// minHistory is how many windows a key must have been seen over before
+	// its baseline is trusted.
+	minHistory = 10
+
+	// Reason marks the boosts granted as throttles.
+	Reason = "anomaly"
+)
+
+// Config tunes the Detector.
+type Config struct {
+	// Window is how often rates are measured.
+	Window time.Duration
+	// Baseline is the time constant of the moving average a key's rate is
+	// compared with.
+	Baseline time.Duration
+	// Factor is how many times its baseline a key's rate must reach to be
+	// throttled.
+	Factor float64
+	// MinRate is the rate, in requests per second on this replica, below
+	// which keys are never throttled.
+	MinRate float64
+
+	// Throttled keys get a boost multiplying their limits by Multiplier,
+	// expiring after Duration.
+	Multiplier float64
+	Duration   time.Duration
+}
+
+// Record is the audit record of a throttle.
+type Record struct {
+	Key        string    `json:"key"` // bucket key (limiter.Key)
+	Rate       float64   `json:"rate"`
+	Baseline   float64   `json:"baseline"`
+	Multiplier float64   `json:"multiplier"`
+	DetectedAt time.Time `json:"detected_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Host       string    `json:"host,omitempty"`
+}
+
+type history struct {
+	rate    float64 // moving average, requests per second
+	windows int
+}
+
+// Detector counts requests per bucket key and, every window, compares each
+// key's rate with its baseline. Keys far above it get a temporary boost
+// lowering their limits, and an audit record. Rates are as seen by this
+// replica; with requests spread evenly over replicas, every replica sees
+// the same jumps.
+//
+// Keys with an active boost are never throttled, and their baseline follows
+// their traffic, so granting a boost is how to let a key grow quickly.
+// Otherwise windows above the threshold, and those of throttled keys, don't
+// count towards the baseline.
+type Detector struct {
+	rdb    *redis.Client
+	boosts *boost.Registry
+	cfg    Config
+	host   string
+
+	mu     sync.Mutex
+	counts map[string]int64
+
+	// Only touched by Run
+	baselines map[string]*history
+}
+
+// NewDetector creates a Detector granting throttles in boosts and keeping
+// audit records in rdb.
+func NewDetector(rdb *redis.Client, boosts *boost.Registry, cfg Config) *Detector {
+	host, _ := os.Hostname()
+	return &Detector{
+		rdb:       rdb,
+		boosts:    boosts,
+		cfg:       cfg,
+		host:      host,
+		counts:    map[string]int64{},
+		baselines: map[string]*history{},
+	}
+}
+
+// Observe counts one request for the bucket key.
+func (d *Detector) Observe(key string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if _, ok := d.counts[key]; ok || len(d.counts) < maxKeys {
+		d.counts[key]++
+	}
+	d.mu.Unlock()
+}
+
+// Run analyzes the requests of every window until ctx is cancelled.
+func (d *Detector) Run(ctx context.Context) {
+	t := time.NewTicker(d.cfg.Window)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			d.analyze(ctx, now)
+		}
+	}
+}
+
+// analyze updates the baselines with the window's counts and throttles
+// the keys far above theirs.
+func (d *Detector) analyze(ctx context.Context, now time.Time) {
+	d.mu.Lock()
+	counts := d.counts
+	d.counts = make(map[string]int64, len(counts))
+	d.mu.Unlock()
+
+	secs := d.cfg.Window.Seconds()
+	alpha := secs / d.cfg.Baseline.Seconds()
+	if alpha > 1 {
+		alpha = 1
+	}
+	for key, n := range counts {
+		if _, ok := d.baselines[key]; !ok && len(d.baselines) < maxKeys {
+			d.baselines[key] = &history{rate: float64(n) / secs}
+		}
+	}
+	for key, h := range d.baselines {
+		rate := float64(counts[key]) / secs
+		b := d.boosts.Get(key)
+		if b != nil && b.Reason == Reason {
+			// Throttled: the baseline waits for the key to calm down
+			continue
+		}
+		if b == nil && h.windows >= minHistory && rate >= d.cfg.MinRate && rate >= d.cfg.Factor*h.rate {
+			if err := d.throttle(ctx, key, rate, h.rate, now); err != nil {
+				log.Printf("throttling %q failed: %v", key, err)
+			}
+			continue
+		}
+		h.rate += alpha * (rate - h.rate)
+		h.windows++
+		// Idle keys fade out
+		if h.rate < 1e-3 && counts[key] == 0 {
+			delete(d.baselines, key)
+		}
+	}
+}
+
+func (d *Detector) throttle(ctx context.Context, key string, rate, baseline float64, now time.Time) error {
+	rec := Record{
+		Key:        key,
+		Rate:       rate,
+		Baseline:   baseline,
+		Multiplier: d.cfg.Multiplier,
+		DetectedAt: now,
+		ExpiresAt:  now.Add(d.cfg.Duration),
+		Host:       d.host,
+	}
+	b := &boost.Boost{Target: key, Multiplier: rec.Multiplier, ExpiresAt: rec.ExpiresAt, Reason: Reason}
+	if err := d.boosts.Grant(ctx, b); err != nil {
+		return err
+	}
+	_, k := limiter.SplitKey(key)
+	metrics.AnomalyThrottles.WithLabelValues(metrics.KeyPrefix(k)).Inc()
+	log.Printf("throttling %q until %s: %.1f req/s, baseline %.1f req/s", key, rec.ExpiresAt.Format(time.RFC3339), rate, baseline)
+
+	v, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	pipe := d.rdb.Pipeline()
+	pipe.LPush(ctx, auditKey, v)
+	pipe.LTrim(ctx, auditKey, 0, AuditLen-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("audit record: %w", err)
+	}
+	return nil
+}
+
+// Records returns up to n audit records, newest first.
+func Records(ctx context.Context, rdb *redis.Client, n int64) ([]Record, error) {
+	raw, err := rdb.LRange(ctx, auditKey, 0, n-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis lrange: %w", err)
+	}
+	records := make([]Record, 0, len(raw))
+	for _, v := range raw {
+		var rec Record
+		if err := json.Unmarshal([]byte(v), &rec); err != nil {
+			log.Printf("skipping malformed anomaly record: %v", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
\ No newline at end of file
@@ -0,0 +1,73 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+)
+
+func TestDetector(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	boosts := boost.NewRegistry(rdb)
+	require.NoError(t, boosts.Grant(ctx, &boost.Boost{Target: "user:boosted", Multiplier: 2, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	d := NewDetector(rdb, boosts, Config{
+		Window:     time.Second,
+		Baseline:   10 * time.Second,
+		Factor:     5,
+		MinRate:    20,
+		Multiplier: 0.1,
+		Duration:   time.Minute,
+	})
+	window := func(counts map[string]int) {
+		for key, n := range counts {
+			for i := 0; i < n; i++ {
+				d.Observe(key)
+			}
+		}
+		d.analyze(ctx, time.Now())
+	}
+	for i := 0; i < minHistory; i++ {
+		window(map[string]int{"user:1": 10, "user:quiet": 1, "user:boosted": 10})
+	}
+
+	window(map[string]int{
+		"user:1":       100, // 10x its baseline
+		"user:quiet":   15,  // 15x, but under MinRate
+		"user:boosted": 100,
+		"user:new":     100, // no history yet
+	})
+	b := boosts.Get("user:1")
+	require.NotNil(t, b)
+	assert.Equal(t, 0.1, b.Multiplier)
+	assert.Equal(t, Reason, b.Reason)
+	assert.Nil(t, boosts.Get("user:quiet"))
+	assert.Equal(t, 2.0, boosts.Get("user:boosted").Multiplier)
+	assert.Nil(t, boosts.Get("user:new"))
+
+	records, err := Records(ctx, rdb, 10)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "user:1", records[0].Key)
+	assert.Equal(t, 100.0, records[0].Rate)
+	assert.InDelta(t, 10, records[0].Baseline, 1e-9)
+	assert.WithinDuration(t, records[0].DetectedAt.Add(time.Minute), records[0].ExpiresAt, 0)
+
+	// The throttle doesn't raise the baseline, so the key is throttled
+	// again once it expires if it keeps going.
+	window(map[string]int{"user:1": 100})
+	assert.InDelta(t, 10, d.baselines["user:1"].rate, 1e-9)
+	require.NoError(t, boosts.Grant(ctx, &boost.Boost{Target: "user:1", ExpiresAt: time.Now()}))
+	window(map[string]int{"user:1": 100})
+	require.NotNil(t, boosts.Get("user:1"))
+}
\ No newline at end of file
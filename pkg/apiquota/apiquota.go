@@ -0,0 +1,202 @@
+// Package apiquota limits how many RPCs each authenticated service account
+// may make against the limiter itself, and records their usage for
+// capacity chargeback.
+package apiquota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/auth"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
+)
+
+// Quota bounds the RPCs of one service account. Zero fields are unlimited.
+type Quota struct {
+	// Sustained RPC rate and burst.
+	Burst int64   `yaml:"burst"`
+	Rate  float64 `yaml:"rate"`
+	// Long-period RPC budget, e.g. 10M per 720h.
+	Limit  int64         `yaml:"limit"`
+	Period time.Duration `yaml:"period"`
+}
+
+func (q *Quota) hasRate() bool  { return q.Burst > 0 && q.Rate > 0 }
+func (q *Quota) hasLimit() bool { return q.Limit > 0 && q.Period > 0 }
+
+// Config assigns quotas to service accounts (HMAC client IDs). Clients not
+// listed get Default; a nil Default leaves them unlimited.
+type Config struct {
+	Default *Quota           `yaml:"default"`
+	Clients map[string]Quota `yaml:"clients"`
+}
+
+// Load reads a quota file, e.g.
+//
+//	default:
+//	  burst: 2000
+//	  rate: 1000
+//	clients:
+//	  checkout:
+//	    burst: 10000
+//	    rate: 5000
+//	    limit: 1000000000
+//	    period: 720h
+func Load(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *Config) quota(client string) *Quota {
+	if q, ok := c.Clients[client]; ok {
+		return &q
+	}
+	return c.Default
+}
+
+// Key returns the limiter key holding client's API quota. The empty hash tag
+// can't be produced by limiter.Key, so it never collides with user buckets.
+func Key(client string) string {
+	return "{}:" + client
+}
+
+// Enforcer applies API quotas to authenticated RPCs.
+type Enforcer struct {
+	limiter *limiter.TokenBucket
+	cfg     *Config
+	usage   *usage.Recorder
+	exempt  map[string]bool
+}
+
+// NewEnforcer creates an enforcer. Usage is recorded on rec when non-nil;
+// exempt methods (e.g. health checks) are neither limited nor recorded.
+func NewEnforcer(l *limiter.TokenBucket, cfg *Config, rec *usage.Recorder, exempt ...string) *Enforcer {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	e := &Enforcer{limiter: l, cfg: cfg, usage: rec, exempt: map[string]bool{}}
+	for _, m := range exempt {
+		e.exempt[m] = true
+	}
+	return e
+}
+
+// UnaryServerInterceptor rejects RPCs over the caller's quota with
+// ResourceExhausted. It must run after auth.Verifier so the client ID is
+// known; unauthenticated calls pass through untouched.
+func (e *Enforcer) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := e.admit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams, each
+// counting as one RPC however many messages it carries. Server streams are
+// authenticated as their request arrives, so they are charged then.
+func (e *Enforcer) StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if !info.IsClientStream {
+		return handler(srv, &chargedStream{ServerStream: ss, e: e, method: info.FullMethod})
+	}
+	if err := e.admit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// chargedStream charges its stream once its first message is received.
+type chargedStream struct {
+	grpc.ServerStream
+	e       *Enforcer
+	method  string
+	charged bool
+}
+
+func (s *chargedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil || s.charged {
+		return err
+	}
+	s.charged = true
+	return s.e.admit(s.Context(), s.method)
+}
+
+// admit charges one RPC to the caller's quota, returning ResourceExhausted
+// once it is spent.
+func (e *Enforcer) admit(ctx context.Context, method string) error {
+	client, ok := auth.ClientID(ctx)
+	if !ok || e.exempt[method] {
+		return nil
+	}
+
+	res := e.check(ctx, client)
+	if e.usage != nil {
+		e.usage.Record(client, 1, res == nil || res.Allowed)
+	}
+	if res != nil && !res.Allowed {
+		metrics.APIQuotaDenied.WithLabelValues(client).Inc()
+		return status.Errorf(codes.ResourceExhausted,
+			"API quota exceeded for client %q, retry after %.2fs", client, res.RetryAfter)
+	}
+	return nil
+}
+
+// check consumes one RPC from client's quota. It returns nil when the client
+// is unlimited or Redis fails: the limiter's own quota must not take the
+// service down with it.
+func (e *Enforcer) check(ctx context.Context, client string) *limiter.Result {
+	q := e.cfg.quota(client)
+	if q == nil {
+		return nil
+	}
+
+	var res *limiter.Result
+	if q.hasRate() {
+		r, err := e.limiter.Allow(ctx, Key(client), 1, q.Burst, q.Rate)
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("APIQuota", "redis").Inc()
+			log.Printf("api quota check for %q failed: %v", client, err)
+			return nil
+		}
+		if !r.Allowed {
+			return r
+		}
+		res = r
+	}
+	if q.hasLimit() {
+		r, err := e.limiter.Quota(ctx, Key(client), 1, q.Limit, q.Period)
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("APIQuota", "redis").Inc()
+			log.Printf("api quota check for %q failed: %v", client, err)
+			return nil
+		}
+		res = r
+	}
+	return res
+}
\ No newline at end of file
@@ -0,0 +1,200 @@
+package apiquota
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gopkg.in/yaml.v3"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/auth"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
+)
+
+func TestConfigQuota(t *testing.T) {
+	c := &Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+default:
+  burst: 20
+  rate: 10
+clients:
+  checkout:
+    limit: 1000
+    period: 720h
+`), c))
+
+	q := c.quota("checkout")
+	require.NotNil(t, q)
+	assert.False(t, q.hasRate())
+	assert.True(t, q.hasLimit())
+	assert.Equal(t, int64(1000), q.Limit)
+
+	q = c.quota("search")
+	require.NotNil(t, q)
+	assert.True(t, q.hasRate())
+	assert.False(t, q.hasLimit())
+
+	assert.Nil(t, (&Config{}).quota("search"), "no default means unlimited")
+}
+
+func TestKeyIsReserved(t *testing.T) {
+	ns, key := limiter.SplitKey(Key("checkout"))
+	assert.Equal(t, "", ns)
+	assert.Equal(t, "checkout", key)
+	assert.NotEqual(t, Key("checkout"), limiter.Key("", "checkout"))
+	assert.Error(t, limiter.ValidateKey("", Key("checkout")))
+}
+
+const method = "/ratelimit.v1.RateLimitService/Allow"
+
+// authenticated returns a context carrying client's ID, as auth.Verifier
+// leaves it.
+func authenticated(t *testing.T, client string) context.Context {
+	t.Helper()
+	secret := []byte(client)
+	ts := time.Now().Unix()
+	sig, err := auth.Sign(secret, method, ts, nil)
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		auth.HeaderClientID, client,
+		auth.HeaderTimestamp, strconv.FormatInt(ts, 10),
+		auth.HeaderSignature, sig,
+	))
+	v := auth.NewVerifier(auth.Keys{client: secret}, time.Minute)
+	_, err = v.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(c context.Context, _ interface{}) (interface{}, error) {
+			ctx = c
+			return nil, nil
+		})
+	require.NoError(t, err)
+	return ctx
+}
+
+func testEnforcer(t *testing.T, cfg *Config) (*Enforcer, *usage.Recorder, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	rec := usage.NewClientRecorder(rdb, 24*time.Hour)
+	return NewEnforcer(limiter.New(rdb, 1, 1), cfg, rec, "/health"), rec, mr
+}
+
+func TestEnforcer_Unary(t *testing.T) {
+	e, rec, _ := testEnforcer(t, &Config{Clients: map[string]Quota{"checkout": {Burst: 2, Rate: 0.001}}})
+	ctx := context.Background()
+
+	calls := 0
+	call := func(ctx context.Context, m string) error {
+		_, err := e.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: m},
+			func(context.Context, interface{}) (interface{}, error) {
+				calls++
+				return nil, nil
+			})
+		return err
+	}
+
+	checkout := authenticated(t, "checkout")
+	require.NoError(t, call(checkout, method))
+	require.NoError(t, call(checkout, method))
+	err := call(checkout, method)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 2, calls, "the handler must not run over quota")
+
+	// Exempt methods, clients without a quota and unauthenticated callers
+	// pass through
+	require.NoError(t, call(checkout, "/health"))
+	require.NoError(t, call(authenticated(t, "search"), method))
+	require.NoError(t, call(ctx, method))
+	assert.Equal(t, 5, calls)
+
+	require.NoError(t, rec.Flush(ctx))
+	now := time.Now()
+	recs, err := rec.Query(ctx, "checkout", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, int64(2), recs[0].Allowed)
+	assert.Equal(t, int64(1), recs[0].Denied, "exempt calls are not recorded")
+}
+
+func TestEnforcer_Limit(t *testing.T) {
+	e, _, _ := testEnforcer(t, &Config{Default: &Quota{Limit: 1, Period: time.Hour}})
+	call := func(ctx context.Context) error {
+		_, err := e.UnaryServerInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+
+	checkout := authenticated(t, "checkout")
+	require.NoError(t, call(checkout))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(checkout)))
+	require.NoError(t, call(authenticated(t, "search")), "each client has its own budget")
+}
+
+func TestEnforcer_FailOpen(t *testing.T) {
+	e, _, mr := testEnforcer(t, &Config{Default: &Quota{Burst: 1, Rate: 0.001}})
+	mr.Close()
+
+	checkout := authenticated(t, "checkout")
+	for i := 0; i < 3; i++ {
+		_, err := e.UnaryServerInterceptor(checkout, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		require.NoError(t, err, "call %d", i)
+	}
+}
+
+// fakeStream is a server stream carrying ctx and receiving msg.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	msg proto.Message
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func (s fakeStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func TestEnforcer_Stream(t *testing.T) {
+	e, _, _ := testEnforcer(t, &Config{Clients: map[string]Quota{"checkout": {Burst: 2, Rate: 0.001}}})
+	checkout := authenticated(t, "checkout")
+
+	handled := 0
+	handler := func(_ interface{}, ss grpc.ServerStream) error {
+		if err := ss.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+			return err
+		}
+		handled++
+		return nil
+	}
+	call := func(ctx context.Context, m string, clientStream bool) error {
+		ss := fakeStream{ctx: ctx, msg: wrapperspb.String("user:1")}
+		info := &grpc.StreamServerInfo{FullMethod: m, IsClientStream: clientStream}
+		return e.StreamServerInterceptor(nil, ss, info, handler)
+	}
+
+	// Server streams are charged as their request arrives, client streams
+	// up front, and each once however many messages they carry
+	require.NoError(t, call(checkout, method, false))
+	require.NoError(t, call(checkout, method, true))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(checkout, method, false)))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(checkout, method, true)))
+	assert.Equal(t, 2, handled)
+
+	require.NoError(t, call(checkout, "/health", false))
+	require.NoError(t, call(context.Background(), method, false))
+	require.NoError(t, call(context.Background(), method, true))
+	assert.Equal(t, 5, handled)
+}
\ No newline at end of file
@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Metadata keys carrying the signature.
+const (
+	HeaderClientID  = "x-ratelimit-client"
+	HeaderTimestamp = "x-ratelimit-timestamp"
+	HeaderSignature = "x-ratelimit-signature"
+)
+
+type clientIDKey struct{}
+
+// Keys maps client IDs to their shared secrets.
+type Keys map[string][]byte
+
+// LoadKeys reads a YAML map of client ID to secret, e.g.
+//
+//	checkout: 8c1f0e...
+//	search: 55ab9d...
+func LoadKeys(path string) (Keys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	keys := make(Keys, len(raw))
+	for id, secret := range raw {
+		if secret == "" {
+			return nil, fmt.Errorf("parse %s: empty secret for %q", path, id)
+		}
+		keys[id] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of method, timestamp and the
+// deterministic protobuf encoding of req. Server streams sign their one
+// request like unary RPCs; client streams sign a nil req, as their headers
+// go out before their messages.
+func Sign(secret []byte, method string, ts int64, req interface{}) (string, error) {
+	var body []byte
+	if req != nil {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return "", fmt.Errorf("cannot sign %T", req)
+		}
+		var err error
+		body, err = proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method))
+	mac.Write([]byte{'\n'})
+	mac.Write(strconv.AppendInt(nil, ts, 10))
+	mac.Write([]byte{'\n'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ClientID returns the authenticated client of the request, if any.
+func ClientID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(clientIDKey{}).(string)
+	return id, ok
+}
+
+// Verifier checks HMAC signatures on incoming RPCs.
+type Verifier struct {
+	keys    Keys
+	maxSkew time.Duration
+	exempt  map[string]bool
+	// restricted holds the method prefixes only admins may call.
+	restricted []string
+	admins     map[string]bool
+}
+
+// NewVerifier creates a verifier accepting timestamps within maxSkew of the
+// server clock. Exempt methods (e.g. health checks) skip verification.
+func NewVerifier(keys Keys, maxSkew time.Duration, exempt ...string) *Verifier {
+	v := &Verifier{keys: keys, maxSkew: maxSkew, exempt: map[string]bool{}}
+	for _, m := range exempt {
+		v.exempt[m] = true
+	}
+	return v
+}
+
+// Restrict lets only the admins clients call the methods of services, e.g.
+// "ratelimit.v1.AdminService". Other clients, however well they sign, are
+// rejected with PermissionDenied.
+func (v *Verifier) Restrict(admins []string, services ...string) {
+	if v.admins == nil {
+		v.admins = make(map[string]bool, len(admins))
+	}
+	for _, id := range admins {
+		v.admins[id] = true
+	}
+	for _, svc := range services {
+		v.restricted = append(v.restricted, "/"+svc+"/")
+	}
+}
+
+// UnaryServerInterceptor rejects unsigned or incorrectly signed requests
+// with Unauthenticated, and requests to restricted services from clients
+// other than admins with PermissionDenied, and stores the client ID in the
+// context.
+func (v *Verifier) UnaryServerInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if v.exempt[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	id, err := v.verify(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	return handler(context.WithValue(ctx, clientIDKey{}, id), req)
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams. Server
+// streams are verified as their request is received, so a tampered request
+// fails the handler's first RecvMsg; client streams, whose signatures cover
+// their method and timestamp only, are verified up front.
+func (v *Verifier) StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if v.exempt[info.FullMethod] {
+		return handler(srv, ss)
+	}
+	if !info.IsClientStream {
+		return handler(srv, &verifiedStream{ServerStream: ss, v: v, method: info.FullMethod})
+	}
+	id, err := v.verify(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &identifiedStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), clientIDKey{}, id)})
+}
+
+// identifiedStream carries the authenticated client in its context.
+type identifiedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identifiedStream) Context() context.Context {
+	return s.ctx
+}
+
+// verifiedStream verifies the signature over the first message it receives
+// and only then carries the authenticated client in its context.
+type verifiedStream struct {
+	grpc.ServerStream
+	v      *Verifier
+	method string
+	ctx    context.Context // nil until the request is verified
+}
+
+func (s *verifiedStream) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return s.ServerStream.Context()
+}
+
+func (s *verifiedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil || s.ctx != nil {
+		return err
+	}
+	id, err := s.v.verify(s.ServerStream.Context(), s.method, m)
+	if err != nil {
+		return err
+	}
+	s.ctx = context.WithValue(s.ServerStream.Context(), clientIDKey{}, id)
+	return nil
+}
+
+func (v *Verifier) verify(ctx context.Context, method string, req interface{}) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id, ts, sig := first(md, HeaderClientID), first(md, HeaderTimestamp), first(md, HeaderSignature)
+	if id == "" || ts == "" || sig == "" {
+		return "", reject("missing", "request is not signed")
+	}
+
+	secret, ok := v.keys[id]
+	if !ok {
+		return "", reject("unknown_client", "unknown client")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", reject("bad_timestamp", "invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > v.maxSkew || skew < -v.maxSkew {
+		return "", reject("expired", "timestamp outside allowed skew")
+	}
+
+	want, err := Sign(secret, method, unix, req)
+	if err != nil {
+		return "", reject("bad_request", err.Error())
+	}
+	if !hmac.Equal([]byte(want), []byte(sig)) {
+		return "", reject("bad_signature", "invalid signature")
+	}
+	if !v.admins[id] {
+		for _, prefix := range v.restricted {
+			if strings.HasPrefix(method, prefix) {
+				metrics.AuthFailures.WithLabelValues("not_admin").Inc()
+				return "", status.Errorf(codes.PermissionDenied, "client %q may not call %s", id, method)
+			}
+		}
+	}
+	return id, nil
+}
+
+func reject(reason, msg string) error {
+	metrics.AuthFailures.WithLabelValues(reason).Inc()
+	return status.Error(codes.Unauthenticated, msg)
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// UnaryClientInterceptor signs every outgoing RPC as clientID.
+func UnaryClientInterceptor(clientID string, secret []byte) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx, err := signed(ctx, clientID, secret, method, req)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor signs every outgoing stream as clientID. Server
+// streams are only opened on their first SendMsg, so that their signature
+// covers their request.
+func StreamClientInterceptor(clientID string, secret []byte) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if !desc.ClientStreams {
+			open := func(req interface{}) (grpc.ClientStream, error) {
+				ctx, err := signed(ctx, clientID, secret, method, req)
+				if err != nil {
+					return nil, err
+				}
+				return streamer(ctx, desc, cc, method, opts...)
+			}
+			return &unopenedStream{open: open}, nil
+		}
+		ctx, err := signed(ctx, clientID, secret, method, nil)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// unopenedStream opens its stream on the first SendMsg. Server streams send
+// their request right after opening, so nothing else is called before.
+type unopenedStream struct {
+	grpc.ClientStream // nil until opened
+	open              func(req interface{}) (grpc.ClientStream, error)
+}
+
+func (s *unopenedStream) SendMsg(m interface{}) error {
+	if s.ClientStream == nil {
+		cs, err := s.open(m)
+		if err != nil {
+			return err
+		}
+		s.ClientStream = cs
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+// signed adds clientID's signature over method and req to ctx.
+func signed(ctx context.Context, clientID string, secret []byte, method string, req interface{}) (context.Context, error) {
+	ts := time.Now().Unix()
+	sig, err := Sign(secret, method, ts, req)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx,
+		HeaderClientID, clientID,
+		HeaderTimestamp, strconv.FormatInt(ts, 10),
+		HeaderSignature, sig,
+	), nil
+}
\ No newline at end of file
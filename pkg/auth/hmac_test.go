@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const method = "/ratelimit.v1.RateLimitService/Allow"
+
+func signedCtx(t *testing.T, id string, secret []byte, ts int64, req interface{}) context.Context {
+	t.Helper()
+	return signedCtxFor(t, method, id, secret, ts, req)
+}
+
+func signedCtxFor(t *testing.T, m, id string, secret []byte, ts int64, req interface{}) context.Context {
+	t.Helper()
+	sig, err := Sign(secret, m, ts, req)
+	require.NoError(t, err)
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		HeaderClientID, id,
+		HeaderTimestamp, strconv.FormatInt(ts, 10),
+		HeaderSignature, sig,
+	))
+}
+
+func TestVerifier(t *testing.T) {
+	secret := []byte("s3cret")
+	v := NewVerifier(Keys{"checkout": secret}, time.Minute, "/health")
+	req := wrapperspb.String("user:1")
+	now := time.Now().Unix()
+
+	var gotID string
+	handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		gotID, _ = ClientID(ctx)
+		return "ok", nil
+	}
+	call := func(ctx context.Context, m string, r interface{}) error {
+		_, err := v.UnaryServerInterceptor(ctx, r, &grpc.UnaryServerInfo{FullMethod: m}, handler)
+		return err
+	}
+
+	require.NoError(t, call(signedCtx(t, "checkout", secret, now, req), method, req))
+	assert.Equal(t, "checkout", gotID)
+
+	tests := map[string]context.Context{
+		"unsigned":       context.Background(),
+		"unknown client": signedCtx(t, "search", secret, now, req),
+		"wrong secret":   signedCtx(t, "checkout", []byte("nope"), now, req),
+		"stale":          signedCtx(t, "checkout", secret, now-120, req),
+		"tampered":       signedCtx(t, "checkout", secret, now, wrapperspb.String("user:2")),
+	}
+	for name, ctx := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := call(ctx, method, req)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+
+	// Exempt methods don't need a signature
+	assert.NoError(t, call(context.Background(), "/health", req))
+}
+
+func TestVerifier_Restrict(t *testing.T) {
+	keys := Keys{"checkout": []byte("s3cret"), "ops": []byte("ops")}
+	v := NewVerifier(keys, time.Minute)
+	v.Restrict([]string{"ops"}, "ratelimit.v1.AdminService")
+	req := wrapperspb.String("user:1")
+	now := time.Now().Unix()
+
+	call := func(m, id string) error {
+		ctx := signedCtxFor(t, m, id, keys[id], now, req)
+		_, err := v.UnaryServerInterceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: m},
+			func(context.Context, interface{}) (interface{}, error) { return "ok", nil })
+		return err
+	}
+
+	const admin = "/ratelimit.v1.AdminService/DeleteTenant"
+	assert.NoError(t, call(admin, "ops"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(admin, "checkout")))
+	// Admins may call everything else too
+	assert.NoError(t, call(method, "checkout"))
+	assert.NoError(t, call(method, "ops"))
+}
+
+// fakeStream is a server stream carrying ctx and receiving msg.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+	msg proto.Message
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func (s fakeStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+func TestVerifier_Stream(t *testing.T) {
+	secret := []byte("s3cret")
+	v := NewVerifier(Keys{"checkout": secret}, time.Minute)
+	now := time.Now().Unix()
+	req := wrapperspb.String("user:1")
+
+	var gotID string
+	var gotReq *wrapperspb.StringValue
+	handler := func(_ interface{}, ss grpc.ServerStream) error {
+		gotID, gotReq = "", nil
+		m := &wrapperspb.StringValue{}
+		if err := ss.RecvMsg(m); err != nil {
+			return err
+		}
+		gotID, _ = ClientID(ss.Context())
+		gotReq = m
+		return nil
+	}
+	call := func(ctx context.Context, clientStream bool, msg proto.Message) error {
+		info := &grpc.StreamServerInfo{FullMethod: method, IsClientStream: clientStream}
+		return v.StreamServerInterceptor(nil, fakeStream{ctx: ctx, msg: msg}, info, handler)
+	}
+
+	// Server streams sign their request
+	require.NoError(t, call(signedCtx(t, "checkout", secret, now, req), false, req))
+	assert.Equal(t, "checkout", gotID)
+	assert.Equal(t, "user:1", gotReq.GetValue())
+
+	tests := map[string]context.Context{
+		"unsigned":  context.Background(),
+		"no body":   signedCtx(t, "checkout", secret, now, nil),
+		"tampered":  signedCtx(t, "checkout", secret, now, wrapperspb.String("user:2")),
+		"stale":     signedCtx(t, "checkout", secret, now-120, req),
+		"wrong key": signedCtx(t, "checkout", []byte("nope"), now, req),
+	}
+	for name, ctx := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := call(ctx, false, req)
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+			assert.Nil(t, gotReq, "the handler must not see an unverified request")
+		})
+	}
+
+	// Client streams sign no message, as their headers go out first
+	require.NoError(t, call(signedCtx(t, "checkout", secret, now, nil), true, req))
+	assert.Equal(t, "checkout", gotID)
+	err := call(signedCtx(t, "checkout", secret, now, req), true, req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// fakeClientStream records the messages sent on it.
+type fakeClientStream struct {
+	grpc.ClientStream
+	sent []interface{}
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	secret := []byte("s3cret")
+	req := wrapperspb.String("user:1")
+
+	var md metadata.MD
+	opened := 0
+	cs := &fakeClientStream{}
+	streamer := func(ctx context.Context, _ *grpc.StreamDesc, _ *grpc.ClientConn, _ string, _ ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		opened++
+		return cs, nil
+	}
+	intercept := StreamClientInterceptor("checkout", secret)
+
+	// Server streams are opened with a signature over their request
+	s, err := intercept(context.Background(), &grpc.StreamDesc{ServerStreams: true}, nil, method, streamer)
+	require.NoError(t, err)
+	assert.Zero(t, opened, "opened before the request was sent")
+	require.NoError(t, s.SendMsg(req))
+	require.NoError(t, s.SendMsg(req))
+	assert.Equal(t, 1, opened)
+	assert.Len(t, cs.sent, 2)
+	ts, err := strconv.ParseInt(first(md, HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	sig, err := Sign(secret, method, ts, req)
+	require.NoError(t, err)
+	assert.Equal(t, sig, first(md, HeaderSignature))
+
+	// Client streams are opened at once, signing no message
+	_, err = intercept(context.Background(), &grpc.StreamDesc{ClientStreams: true}, nil, method, streamer)
+	require.NoError(t, err)
+	assert.Equal(t, 2, opened)
+	ts, err = strconv.ParseInt(first(md, HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	sig, err = Sign(secret, method, ts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, sig, first(md, HeaderSignature))
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestClientHeaders_Golden pins the metadata signed clients send and the
+// signature scheme. Changing either breaks every deployed client, so the
+// output is checked against testdata/headers.golden.
+func TestClientHeaders_Golden(t *testing.T) {
+	secret := []byte("s3cret")
+	req := wrapperspb.String("user:1")
+
+	var md metadata.MD
+	invoker := func(ctx context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn, _ ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	before := time.Now().Unix()
+	require.NoError(t, UnaryClientInterceptor("checkout", secret)(context.Background(), method, req, nil, nil, invoker))
+
+	// The timestamp and its signature change with every call
+	ts, err := strconv.ParseInt(first(md, HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, before, ts, 1)
+	sig, err := Sign(secret, method, ts, req)
+	require.NoError(t, err)
+	assert.Equal(t, sig, first(md, HeaderSignature))
+
+	var b strings.Builder
+	for _, k := range []string{HeaderClientID, HeaderTimestamp, HeaderSignature} {
+		require.Len(t, md[k], 1, k)
+	}
+	require.Len(t, md, 3)
+	fmt.Fprintf(&b, "%s: %s\n", HeaderClientID, first(md, HeaderClientID))
+	fmt.Fprintf(&b, "%s: <unix seconds>\n", HeaderTimestamp)
+	fmt.Fprintf(&b, "%s: <hex hmac-sha256>\n", HeaderSignature)
+
+	sig, err = Sign(secret, method, 1700000000, req)
+	require.NoError(t, err)
+	fmt.Fprintf(&b, "\nSign(%q, %q, 1700000000, %q) = %s\n", secret, method, req.GetValue(), sig)
+
+	path := filepath.Join("testdata", "headers.golden")
+	if *update {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(b.String()), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), b.String(), "%s changed; if that's intended, run go test -update", path)
+}
\ No newline at end of file
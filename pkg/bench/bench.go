@@ -0,0 +1,241 @@
+// Package bench measures limiter algorithms against a Redis backend under
+// configurable concurrency and key distributions. It backs both cmd/bench
+// and the package's go test benchmarks.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+// Decide makes one rate limit decision for key.
+type Decide func(ctx context.Context, key string) error
+
+// Algorithm is one way of making decisions, built on a fresh limiter.
+type Algorithm struct {
+	Name  string
+	Build func(tb *limiter.TokenBucket) Decide
+}
+
+// benchBurst keeps buckets from running dry, so every algorithm does its
+// full amount of work.
+const benchBurst = 1 << 40
+
+// Algorithms lists the decision paths the limiter supports.
+var Algorithms = []Algorithm{
+	{"token_bucket", func(tb *limiter.TokenBucket) Decide {
+		return func(ctx context.Context, key string) error {
+			_, err := tb.Allow(ctx, key, 1, benchBurst, benchBurst)
+			return err
+		}
+	}},
+	{"hierarchical", func(tb *limiter.TokenBucket) Decide {
+		return func(ctx context.Context, key string) error {
+			_, _, err := tb.AllowAll(ctx, []limiter.Bucket{
+				{Key: limiter.Key("bench", key), Burst: benchBurst, Rate: benchBurst},
+				{Key: limiter.TenantKey("bench"), Burst: benchBurst, Rate: benchBurst},
+			}, 1)
+			return err
+		}
+	}},
+	{"quota", func(tb *limiter.TokenBucket) Decide {
+		return func(ctx context.Context, key string) error {
+			_, err := tb.Quota(ctx, key, 1, benchBurst, time.Hour)
+			return err
+		}
+	}},
+	{"batch_10", func(tb *limiter.TokenBucket) Decide {
+		// One decision per call; every tenth call flushes a pipeline of ten.
+		var mu sync.Mutex
+		var pending []limiter.Check
+		return func(ctx context.Context, key string) error {
+			mu.Lock()
+			pending = append(pending, limiter.Check{Key: key, Burst: benchBurst, Rate: benchBurst})
+			if len(pending) < 10 {
+				mu.Unlock()
+				return nil
+			}
+			checks := pending
+			pending = nil
+			mu.Unlock()
+			for _, r := range tb.AllowBatch(ctx, checks) {
+				if r.Err != nil {
+					return r.Err
+				}
+			}
+			return nil
+		}
+	}},
+	{"leased", func(tb *limiter.TokenBucket) Decide {
+		l := limiter.NewLeaser(tb, 100, 50, time.Second)
+		return func(ctx context.Context, key string) error {
+			_, err := l.Allow(ctx, key, 1, benchBurst, benchBurst)
+			return err
+		}
+	}},
+}
+
+// Find returns the named algorithm.
+func Find(name string) (Algorithm, bool) {
+	for _, a := range Algorithms {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Algorithm{}, false
+}
+
+// Distributions lists the supported key distributions.
+var Distributions = []string{"uniform", "zipf", "hot"}
+
+// Keys returns a generator of n distinct keys following dist:
+//   - uniform: every key equally likely
+//   - zipf:    a few keys take most of the traffic (s=1.1)
+//   - hot:     a single key
+//
+// Generators are not safe for concurrent use; create one per worker.
+func Keys(dist string, n int, seed int64) (func() string, error) {
+	if n < 1 {
+		n = 1
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = "bench:" + strconv.Itoa(i)
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	switch dist {
+	case "uniform":
+		return func() string { return keys[r.Intn(n)] }, nil
+	case "zipf":
+		z := rand.NewZipf(r, 1.1, 1, uint64(n-1))
+		return func() string { return keys[z.Uint64()] }, nil
+	case "hot":
+		return func() string { return keys[0] }, nil
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", dist)
+	}
+}
+
+// OpCounter is a go-redis hook counting the commands sent to Redis,
+// including those inside pipelines, and the round trips they took.
+type OpCounter struct {
+	n, rt atomic.Int64
+}
+
+// Ops returns the number of commands sent so far.
+func (c *OpCounter) Ops() int64 { return c.n.Load() }
+
+// RoundTrips returns the number of requests sent so far; a pipeline is one.
+func (c *OpCounter) RoundTrips() int64 { return c.rt.Load() }
+
+func (c *OpCounter) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (c *OpCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		c.n.Add(1)
+		c.rt.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (c *OpCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		c.n.Add(int64(len(cmds)))
+		c.rt.Add(1)
+		return next(ctx, cmds)
+	}
+}
+
+// Config is one benchmark run.
+type Config struct {
+	Algorithm    Algorithm
+	Distribution string
+	Keys         int
+	Concurrency  int
+	Duration     time.Duration
+}
+
+// Report is the outcome of a run. NsPerOp is wall time per decision across
+// all workers (the inverse of throughput); the other figures are averages
+// per decision.
+type Report struct {
+	Config
+	Decisions   int64
+	Errors      int64
+	NsPerOp     float64
+	AllocsPerOp float64
+	RedisPerOp  float64
+	RTTPerOp    float64
+}
+
+// Run drives cfg.Algorithm on rdb from cfg.Concurrency workers for
+// cfg.Duration. ops must be hooked into rdb.
+func Run(ctx context.Context, rdb *redis.Client, ops *OpCounter, cfg Config) (*Report, error) {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	decide := cfg.Algorithm.Build(limiter.New(rdb, benchBurst, benchBurst))
+
+	gens := make([]func() string, cfg.Concurrency)
+	for i := range gens {
+		g, err := Keys(cfg.Distribution, cfg.Keys, int64(i))
+		if err != nil {
+			return nil, err
+		}
+		gens[i] = g
+	}
+
+	var decisions, errs atomic.Int64
+	runCtx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	opsBefore, rtBefore := ops.Ops(), ops.RoundTrips()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for _, next := range gens {
+		wg.Add(1)
+		go func(next func() string) {
+			defer wg.Done()
+			for runCtx.Err() == nil {
+				if err := decide(ctx, next()); err != nil {
+					errs.Add(1)
+				}
+				decisions.Add(1)
+			}
+		}(next)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	rep := &Report{Config: cfg, Decisions: decisions.Load(), Errors: errs.Load()}
+	if rep.Decisions > 0 {
+		n := float64(rep.Decisions)
+		rep.NsPerOp = float64(elapsed.Nanoseconds()) / n
+		rep.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / n
+		rep.RedisPerOp = float64(ops.Ops()-opsBefore) / n
+		rep.RTTPerOp = float64(ops.RoundTrips()-rtBefore) / n
+	}
+	return rep, nil
+}
\ No newline at end of file
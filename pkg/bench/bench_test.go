@@ -0,0 +1,116 @@
+package bench
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+// Run: go test -bench=. -benchmem ./pkg/bench/ (needs Redis at REDIS_ADDR,
+// default localhost:6379, database REDIS_DB, default 15)
+
+func benchRedis(b *testing.B) (*redis.Client, *OpCounter) {
+	b.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	db := 15
+	if v, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		db = v
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: db})
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		b.Skipf("Redis not available: %v", err)
+	}
+	// The benchmark's buckets expire on their own, so others' keys in a
+	// shared database are left alone.
+	b.Cleanup(func() { rdb.Close() })
+	ops := &OpCounter{}
+	rdb.AddHook(ops)
+	return rdb, ops
+}
+
+func BenchmarkAlgorithms(b *testing.B) {
+	rdb, ops := benchRedis(b)
+	ctx := context.Background()
+
+	for _, algo := range Algorithms {
+		for _, dist := range Distributions {
+			b.Run(algo.Name+"/"+dist, func(b *testing.B) {
+				decide := algo.Build(limiter.New(rdb, benchBurst, benchBurst))
+				before, rtBefore := ops.Ops(), ops.RoundTrips()
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					next, _ := Keys(dist, 1000, 1)
+					for pb.Next() {
+						decide(ctx, next())
+					}
+				})
+				b.ReportMetric(float64(ops.Ops()-before)/float64(b.N), "redis-ops/op")
+				b.ReportMetric(float64(ops.RoundTrips()-rtBefore)/float64(b.N), "redis-rtt/op")
+			})
+		}
+	}
+}
+
+func BenchmarkKeys(b *testing.B) {
+	for _, dist := range Distributions {
+		b.Run(dist, func(b *testing.B) {
+			next, _ := Keys(dist, 1000, 1)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				next()
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for _, dist := range Distributions {
+		next, err := Keys(dist, 10, 1)
+		require.NoError(t, err)
+		seen := map[string]bool{}
+		for i := 0; i < 1000; i++ {
+			seen[next()] = true
+		}
+		assert.LessOrEqual(t, len(seen), 10, dist)
+		if dist == "hot" {
+			assert.Len(t, seen, 1)
+		}
+	}
+
+	_, err := Keys("pareto", 10, 1)
+	assert.Error(t, err)
+}
+
+func TestRunKeyspace(t *testing.T) {
+	// Points report the size of the whole database, so this needs one of
+	// its own.
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	ctx := context.Background()
+	t.Cleanup(func() { rdb.Close() })
+
+	var points []KeyspacePoint
+	err := RunKeyspace(ctx, rdb, KeyspaceConfig{Keys: 300, Steps: 3, Concurrency: 4, Burst: 10, Rate: 1},
+		func(p KeyspacePoint) { points = append(points, p) })
+	require.NoError(t, err)
+
+	require.Len(t, points, 3)
+	for i, p := range points {
+		assert.Equal(t, 100*(i+1), p.Keys)
+		assert.Equal(t, int64(p.Keys), p.DBSize)
+		assert.Zero(t, p.Errors)
+		assert.LessOrEqual(t, p.P50, p.P99)
+	}
+}
\ No newline at end of file
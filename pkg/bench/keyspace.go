@@ -0,0 +1,155 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+// KeyspaceConfig is a keyspace-scaling run: Keys distinct buckets are
+// created in Steps equal steps, each bucket by one Allow call.
+type KeyspaceConfig struct {
+	Keys        int
+	Steps       int
+	Concurrency int
+
+	// Bucket settings. Idle buckets expire burst/rate+60s after their last
+	// use, so these decide how long the keyspace holds.
+	Burst int64
+	Rate  float64
+}
+
+// KeyspacePoint is the state of Redis after a step. Memory and eviction
+// figures come from INFO and are zero when the server doesn't report them.
+type KeyspacePoint struct {
+	Keys        int   // distinct buckets created so far
+	DBSize      int64 // keys currently in the database
+	UsedMemory  int64 // bytes
+	BytesPerKey float64
+	Expired     int64 // keys expired since the run started
+	Evicted     int64 // keys evicted since the run started
+	P50, P99    time.Duration
+	Errors      int64
+}
+
+// RunKeyspace grows the keyspace of rdb's database step by step, calling
+// report after each step. The database should be empty at the start.
+func RunKeyspace(ctx context.Context, rdb *redis.Client, cfg KeyspaceConfig, report func(KeyspacePoint)) error {
+	if cfg.Steps < 1 {
+		cfg.Steps = 1
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	tb := limiter.New(rdb, cfg.Burst, cfg.Rate)
+
+	base, err := info(ctx, rdb)
+	if err != nil {
+		return err
+	}
+
+	created := 0
+	for step := 1; step <= cfg.Steps; step++ {
+		target := cfg.Keys * step / cfg.Steps
+		latencies, errs := fill(ctx, tb, created, target, cfg.Concurrency)
+		created = target
+
+		now, err := info(ctx, rdb)
+		if err != nil {
+			return err
+		}
+		size, err := rdb.DBSize(ctx).Result()
+		if err != nil {
+			return err
+		}
+
+		p := KeyspacePoint{
+			Keys:       created,
+			DBSize:     size,
+			UsedMemory: now["used_memory"],
+			Expired:    now["expired_keys"] - base["expired_keys"],
+			Evicted:    now["evicted_keys"] - base["evicted_keys"],
+			Errors:     errs,
+		}
+		if size > 0 {
+			p.BytesPerKey = float64(now["used_memory"]-base["used_memory"]) / float64(size)
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		p.P50, p.P99 = percentile(latencies, 0.50), percentile(latencies, 0.99)
+		report(p)
+	}
+	return nil
+}
+
+// fill creates buckets from to to, one Allow call each, and returns the
+// calls' latencies and the number that failed.
+func fill(ctx context.Context, tb *limiter.TokenBucket, from, to, workers int) ([]time.Duration, int64) {
+	var (
+		next atomic.Int64
+		errs atomic.Int64
+		mu   sync.Mutex
+		all  = make([]time.Duration, 0, to-from)
+		wg   sync.WaitGroup
+	)
+	next.Store(int64(from))
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := make([]time.Duration, 0, (to-from)/workers+1)
+			for {
+				i := next.Add(1) - 1
+				if i >= int64(to) {
+					break
+				}
+				start := time.Now()
+				if _, err := tb.Allow(ctx, "bench:ks:"+strconv.FormatInt(i, 10), 1, 0, 0); err != nil {
+					errs.Add(1)
+				}
+				local = append(local, time.Since(start))
+			}
+			mu.Lock()
+			all = append(all, local...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return all, errs.Load()
+}
+
+// percentile returns the p-th percentile of sorted d.
+func percentile(d []time.Duration, p float64) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	return d[int(float64(len(d)-1)*p)]
+}
+
+// info returns the integer fields of INFO's default sections.
+func info(ctx context.Context, rdb *redis.Client) (map[string]int64, error) {
+	raw, err := rdb.Info(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]int64{}
+	sc := bufio.NewScanner(strings.NewReader(raw))
+	for sc.Scan() {
+		name, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			fields[name] = n
+		}
+	}
+	return fields, nil
+}
\ No newline at end of file
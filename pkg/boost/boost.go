@@ -0,0 +1,167 @@
+package boost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKey is the hash holding active boosts (field = boost target).
+const redisKey = "ratelimiter:boosts"
+
+// Boost temporarily raises the limits of a bucket key or of a whole tenant,
+// or lowers them with a multiplier below 1. The multiplier is applied
+// first, then the extra tokens are added.
+type Boost struct {
+	// Target is a bucket key (limiter.Key) or a tenant (limiter.TenantKey).
+	Target     string    `json:"-"`
+	Multiplier float64   `json:"multiplier,omitempty"`
+	ExtraBurst int64     `json:"extra_burst,omitempty"`
+	ExtraRate  float64   `json:"extra_rate,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Reason is set on boosts granted automatically, e.g. throttles.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Active reports whether the boost hasn't expired at now.
+func (b *Boost) Active(now time.Time) bool {
+	return b != nil && now.Before(b.ExpiresAt)
+}
+
+// Apply returns the boosted burst and rate. A nil boost is a no-op.
+func (b *Boost) Apply(burst int64, rate float64) (int64, float64) {
+	if b == nil {
+		return burst, rate
+	}
+	if b.Multiplier > 0 {
+		burst = int64(math.Ceil(float64(burst) * b.Multiplier))
+		rate *= b.Multiplier
+	}
+	return burst + b.ExtraBurst, rate + b.ExtraRate
+}
+
+// Registry stores boosts in Redis and serves lookups from an in-process
+// cache. Expired boosts are ignored immediately and purged on refresh.
+type Registry struct {
+	rdb *redis.Client
+
+	mu     sync.RWMutex
+	boosts map[string]*Boost
+}
+
+// NewRegistry creates an empty registry. Call Refresh to populate it.
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{rdb: rdb, boosts: map[string]*Boost{}}
+}
+
+// Get returns the active boost for target, or nil.
+func (r *Registry) Get(target string) *Boost {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	b := r.boosts[target]
+	r.mu.RUnlock()
+	if !b.Active(time.Now()) {
+		return nil
+	}
+	return b
+}
+
+// List returns all active boosts.
+func (r *Registry) List() []*Boost {
+	now := time.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*Boost, 0, len(r.boosts))
+	for _, b := range r.boosts {
+		if b.Active(now) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Grant creates or replaces the boost for b.Target.
+func (r *Registry) Grant(ctx context.Context, b *Boost) error {
+	v, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err := r.rdb.HSet(ctx, redisKey, b.Target, v).Err(); err != nil {
+		return fmt.Errorf("redis hset: %w", err)
+	}
+	r.mu.Lock()
+	r.boosts[b.Target] = b
+	r.mu.Unlock()
+	return nil
+}
+
+// Revoke removes the boost for target. It reports whether one existed.
+func (r *Registry) Revoke(ctx context.Context, target string) (bool, error) {
+	n, err := r.rdb.HDel(ctx, redisKey, target).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis hdel: %w", err)
+	}
+	r.mu.Lock()
+	delete(r.boosts, target)
+	r.mu.Unlock()
+	return n > 0, nil
+}
+
+// Refresh reloads the cache from Redis and deletes expired boosts.
+func (r *Registry) Refresh(ctx context.Context) error {
+	raw, err := r.rdb.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis hgetall: %w", err)
+	}
+
+	now := time.Now()
+	boosts := make(map[string]*Boost, len(raw))
+	var expired []string
+	for target, v := range raw {
+		b := &Boost{}
+		if err := json.Unmarshal([]byte(v), b); err != nil {
+			log.Printf("boost %q: skipping malformed entry: %v", target, err)
+			continue
+		}
+		b.Target = target
+		if !b.Active(now) {
+			expired = append(expired, target)
+			continue
+		}
+		boosts[target] = b
+	}
+	if len(expired) > 0 {
+		if err := r.rdb.HDel(ctx, redisKey, expired...).Err(); err != nil {
+			log.Printf("failed to purge %d expired boosts: %v", len(expired), err)
+		}
+	}
+
+	r.mu.Lock()
+	r.boosts = boosts
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the cache every interval until ctx is cancelled.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("boost refresh failed: %v", err)
+			}
+		}
+	}
+}
\ No newline at end of file
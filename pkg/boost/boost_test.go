@@ -0,0 +1,32 @@
+package boost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	var none *Boost
+	burst, rate := none.Apply(10, 2)
+	assert.Equal(t, int64(10), burst)
+	assert.Equal(t, 2.0, rate)
+
+	b := &Boost{Multiplier: 1.5, ExtraBurst: 5, ExtraRate: 1}
+	burst, rate = b.Apply(11, 2)
+	assert.Equal(t, int64(22), burst, "multiplied burst rounds up before extras are added")
+	assert.Equal(t, 4.0, rate)
+
+	b = &Boost{ExtraBurst: 100}
+	burst, rate = b.Apply(10, 2)
+	assert.Equal(t, int64(110), burst)
+	assert.Equal(t, 2.0, rate)
+}
+
+func TestActive(t *testing.T) {
+	now := time.Now()
+	assert.True(t, (&Boost{ExpiresAt: now.Add(time.Minute)}).Active(now))
+	assert.False(t, (&Boost{ExpiresAt: now}).Active(now))
+	assert.False(t, (*Boost)(nil).Active(now))
+}
\ No newline at end of file
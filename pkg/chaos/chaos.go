@@ -0,0 +1,215 @@
+// Package chaos injects Redis faults through a go-redis hook, so fallback
+// paths can be exercised in tests and staging without breaking Redis.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// ErrInjected is the error of commands failed by a Hook.
+var ErrInjected = errors.New("chaos: injected redis fault")
+
+// ErrScript is the error of script calls failed by a Hook. Like an error
+// raised by a script, it is a Redis error reply.
+var ErrScript error = scriptError("ERR chaos: injected script error")
+
+type scriptError string
+
+func (e scriptError) Error() string { return string(e) }
+
+// RedisError marks the error as a Redis reply, as redis.Error requires.
+func (scriptError) RedisError() {}
+
+var _ redis.Error = scriptError("")
+
+// Config describes the faults to inject. The zero Config injects none.
+type Config struct {
+	// Down fails every command, pipeline and dial with ErrInjected, as if
+	// Redis were down.
+	Down bool
+
+	// Latency is added to a LatencyRate fraction of commands and pipelines,
+	// or to all of them when LatencyRate is 0.
+	Latency     time.Duration
+	LatencyRate float64
+
+	// ErrorRate is the fraction of commands and pipelines that fail with
+	// ErrInjected.
+	ErrorRate float64
+
+	// ScriptErrorRate is the fraction of script calls that fail with
+	// ErrScript without running.
+	ScriptErrorRate float64
+
+	// Every PartitionEvery, Redis is unreachable for PartitionFor: commands
+	// hang until the partition ends or their context is done, then fail,
+	// and dials fail.
+	PartitionEvery time.Duration
+	PartitionFor   time.Duration
+}
+
+// Enabled reports whether c injects any fault.
+func (c Config) Enabled() bool {
+	return c.Down || c.Latency > 0 || c.ErrorRate > 0 || c.ScriptErrorRate > 0 ||
+		(c.PartitionEvery > 0 && c.PartitionFor > 0)
+}
+
+// Hook is a redis.Hook injecting the faults of its Config. The Config can
+// be changed while the hook is in use.
+type Hook struct {
+	cfg   atomic.Pointer[Config]
+	start time.Time
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// New returns a Hook injecting cfg's faults. Partition windows start when
+// the hook is created.
+func New(cfg Config) *Hook {
+	h := &Hook{start: time.Now(), rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	h.Set(cfg)
+	return h
+}
+
+// Set replaces the faults to inject.
+func (h *Hook) Set(cfg Config) {
+	h.cfg.Store(&cfg)
+}
+
+// Config returns the faults being injected.
+func (h *Hook) Config() Config {
+	return *h.cfg.Load()
+}
+
+// chance reports true with probability p.
+func (h *Hook) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rng.Float64() < p
+}
+
+// partitionLeft returns how long the current partition window lasts, or 0
+// outside of one.
+func (h *Hook) partitionLeft(cfg *Config, now time.Time) time.Duration {
+	if cfg.PartitionEvery <= 0 || cfg.PartitionFor <= 0 {
+		return 0
+	}
+	into := now.Sub(h.start) % cfg.PartitionEvery
+	if into >= cfg.PartitionFor {
+		return 0
+	}
+	return cfg.PartitionFor - into
+}
+
+// inject applies the faults to one command or pipeline.
+func (h *Hook) inject(ctx context.Context) error {
+	cfg := h.cfg.Load()
+	if cfg.Down {
+		metrics.ChaosInjected.WithLabelValues("down").Inc()
+		return ErrInjected
+	}
+	if left := h.partitionLeft(cfg, time.Now()); left > 0 {
+		metrics.ChaosInjected.WithLabelValues("partition").Inc()
+		t := time.NewTimer(left)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return ErrInjected
+		}
+	}
+	if cfg.Latency > 0 && (cfg.LatencyRate <= 0 || h.chance(cfg.LatencyRate)) {
+		metrics.ChaosInjected.WithLabelValues("latency").Inc()
+		t := time.NewTimer(cfg.Latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if h.chance(cfg.ErrorRate) {
+		metrics.ChaosInjected.WithLabelValues("error").Inc()
+		return ErrInjected
+	}
+	return nil
+}
+
+// scriptFails decides whether cmd is a script call to fail.
+func (h *Hook) scriptFails(cmd redis.Cmder) bool {
+	if !strings.HasPrefix(cmd.Name(), "eval") || !h.chance(h.cfg.Load().ScriptErrorRate) {
+		return false
+	}
+	metrics.ChaosInjected.WithLabelValues("script_error").Inc()
+	cmd.SetErr(ErrScript)
+	return true
+}
+
+func (h *Hook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if cfg := h.cfg.Load(); cfg.Down || h.partitionLeft(cfg, time.Now()) > 0 {
+			metrics.ChaosInjected.WithLabelValues("partition").Inc()
+			return nil, ErrInjected
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *Hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.inject(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		if h.scriptFails(cmd) {
+			return ErrScript
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *Hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.inject(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		// Failed script calls are left out of the pipeline
+		var failed bool
+		send := cmds[:0:0]
+		for _, cmd := range cmds {
+			if h.scriptFails(cmd) {
+				failed = true
+			} else {
+				send = append(send, cmd)
+			}
+		}
+		if !failed {
+			return next(ctx, cmds)
+		}
+		if len(send) > 0 {
+			if err := next(ctx, send); err != nil {
+				return err
+			}
+		}
+		return ErrScript
+	}
+}
\ No newline at end of file
@@ -0,0 +1,118 @@
+package chaos
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClient(t *testing.T, h *Hook) *redis.Client {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr(), MaxRetries: -1})
+	rdb.AddHook(h)
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func TestHook_Latency(t *testing.T) {
+	h := New(Config{Latency: 50 * time.Millisecond})
+	rdb := testClient(t, h)
+	ctx := context.Background()
+
+	start := time.Now()
+	require.NoError(t, rdb.Ping(ctx).Err())
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// A deadline shorter than the latency fails the command
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, rdb.Ping(ctx).Err(), context.DeadlineExceeded)
+}
+
+func TestHook_ErrorRate(t *testing.T) {
+	h := New(Config{ErrorRate: 1})
+	rdb := testClient(t, h)
+	ctx := context.Background()
+
+	assert.ErrorIs(t, rdb.Ping(ctx).Err(), ErrInjected)
+	_, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Ping(ctx)
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrInjected)
+
+	h.Set(Config{})
+	assert.NoError(t, rdb.Ping(ctx).Err())
+}
+
+func TestHook_Partition(t *testing.T) {
+	h := New(Config{PartitionEvery: time.Hour, PartitionFor: 100 * time.Millisecond})
+	rdb := testClient(t, h)
+
+	// Commands hang for the rest of the window, then fail
+	start := time.Now()
+	assert.ErrorIs(t, rdb.Ping(context.Background()).Err(), ErrInjected)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	// The window is over
+	assert.NoError(t, rdb.Ping(context.Background()).Err())
+}
+
+func TestHook_Down(t *testing.T) {
+	h := New(Config{Down: true})
+	rdb := testClient(t, h)
+	ctx := context.Background()
+
+	start := time.Now()
+	assert.ErrorIs(t, rdb.Ping(ctx).Err(), ErrInjected)
+	assert.Less(t, time.Since(start), 50*time.Millisecond, "fails fast")
+
+	h.Set(Config{})
+	assert.NoError(t, rdb.Ping(ctx).Err())
+	assert.Equal(t, Config{}, h.Config())
+}
+
+func TestHook_LatencyRate(t *testing.T) {
+	h := New(Config{Latency: time.Hour, LatencyRate: 0.5})
+	rdb := testClient(t, h)
+
+	// About half the commands hang past their deadline
+	var slow int
+	for i := 0; i < 200; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		if rdb.Ping(ctx).Err() != nil {
+			slow++
+		}
+		cancel()
+	}
+	assert.InDelta(t, 100, slow, 40)
+}
+
+func TestHook_ScriptErrorRate(t *testing.T) {
+	h := New(Config{ScriptErrorRate: 1})
+	rdb := testClient(t, h)
+	ctx := context.Background()
+	script := redis.NewScript(`return redis.call("INCR", KEYS[1])`)
+
+	err := script.Run(ctx, rdb, []string{"n"}).Err()
+	assert.ErrorIs(t, err, ErrScript)
+	var redisErr redis.Error
+	assert.ErrorAs(t, err, &redisErr)
+	assert.NoError(t, rdb.Ping(ctx).Err(), "other commands are unaffected")
+
+	// Failed calls in a pipeline don't run; the rest do
+	var incr *redis.IntCmd
+	cmds, err := rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		script.Eval(ctx, p, []string{"n"})
+		incr = p.Incr(ctx, "n")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrScript)
+	assert.ErrorIs(t, cmds[0].Err(), ErrScript)
+	assert.Equal(t, int64(1), incr.Val())
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"slices"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// Capabilities is what a server supports, as GetCapabilities reports it.
+type Capabilities struct {
+	Methods       []string
+	ProtoVersions []string
+	Algorithms    []string
+	MaxBatchSize  int
+	Features      []string
+}
+
+// legacyCapabilities are assumed of servers predating GetCapabilities.
+var legacyCapabilities = Capabilities{
+	Methods:       []string{"Allow", "Peek", "HealthCheck"},
+	ProtoVersions: []string{"ratelimit.v1"},
+	Algorithms:    []string{"token_bucket"},
+}
+
+// HasMethod reports whether the server implements the RateLimitService
+// method name, e.g. "BatchAllow".
+func (c *Capabilities) HasMethod(name string) bool {
+	return slices.Contains(c.Methods, name)
+}
+
+// HasFeature reports whether the server runs with the optional feature
+// name, e.g. "latency_budget".
+func (c *Capabilities) HasFeature(name string) bool {
+	return slices.Contains(c.Features, name)
+}
+
+// Capabilities asks the server what it supports. Servers predating the
+// RPC are reported with only the original methods, so callers can check
+// HasMethod before relying on e.g. BatchAllow in a mixed-version fleet.
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	resp, err := c.rpc.GetCapabilities(ctx, &pb.GetCapabilitiesRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		legacy := legacyCapabilities
+		return &legacy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Capabilities{
+		Methods:       resp.Methods,
+		ProtoVersions: resp.ProtoVersions,
+		Algorithms:    resp.Algorithms,
+		MaxBatchSize:  int(resp.MaxBatchSize),
+		Features:      resp.Features,
+	}, nil
+}
\ No newline at end of file
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+type legacyRPC struct {
+	pb.RateLimitServiceClient
+}
+
+func (legacyRPC) GetCapabilities(context.Context, *pb.GetCapabilitiesRequest, ...grpc.CallOption) (*pb.Capabilities, error) {
+	return nil, status.Error(codes.Unimplemented, "unknown method GetCapabilities")
+}
+
+func TestCapabilities_LegacyServer(t *testing.T) {
+	c := &Client{rpc: legacyRPC{}}
+	caps, err := c.Capabilities(context.Background())
+	require.NoError(t, err)
+	assert.True(t, caps.HasMethod("Allow"))
+	assert.False(t, caps.HasMethod("BatchAllow"))
+	assert.False(t, caps.HasFeature("latency_budget"))
+}
\ No newline at end of file
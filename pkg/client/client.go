@@ -0,0 +1,203 @@
+// Package client is the Go SDK for the rate limiter service.
+package client
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/auth"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Remaining  int64
+	Limit      int64
+	ResetAt    time.Time
+	RetryAfter time.Duration
+	// Why the limits differ from the key's configured ones, e.g.
+	// "window:<name>" (Allow only)
+	Reasons []string
+	// Binding names the rule's chain link that decided the result, or is
+	// "subnet" when the key's network's bucket did (Allow only)
+	Binding string
+	// Warning is set when an admitted request crossed the rule's soft
+	// limit (Allow only)
+	Warning bool
+}
+
+// Limiter is the part of Client that services call, so tests can swap in
+// a fake such as limitertest.Fake.
+type Limiter interface {
+	Allow(ctx context.Context, key string, tokens int64) (*Result, error)
+	Peek(ctx context.Context, key string) (*Result, error)
+}
+
+var _ Limiter = (*Client)(nil)
+
+// Client calls the rate limiter service.
+type Client struct {
+	rpc       pb.RateLimitServiceClient
+	namespace string
+	critical  bool
+	coalescer *coalescer
+	local     *localCache
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithNamespace sets the tenant namespace sent with every request.
+func WithNamespace(ns string) Option {
+	return func(c *Client) { c.namespace = ns }
+}
+
+// WithLatencyCritical marks every Allow call latency-critical: a server
+// with a latency budget answers it in time even when Redis is slow, at
+// some cost in accuracy.
+func WithLatencyCritical() Option {
+	return func(c *Client) { c.critical = true }
+}
+
+// New creates a client on an existing connection.
+func New(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	c := &Client{rpc: pb.NewRateLimitServiceClient(conn)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithHMAC returns a dial option that signs every RPC with the client's
+// shared secret, for servers started with HMAC_KEYS_FILE.
+func WithHMAC(clientID string, secret []byte) grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(auth.UnaryClientInterceptor(clientID, secret))
+}
+
+// WithStreamHMAC is WithHMAC for streaming RPCs such as AllowQueued's.
+func WithStreamHMAC(clientID string, secret []byte) grpc.DialOption {
+	return grpc.WithChainStreamInterceptor(auth.StreamClientInterceptor(clientID, secret))
+}
+
+// Allow consumes tokens (default 1) from key's bucket.
+func (c *Client) Allow(ctx context.Context, key string, tokens int64) (*Result, error) {
+	if c.local != nil {
+		return c.local.allow(ctx, c, key, tokens)
+	}
+	return c.consume(ctx, key, tokens)
+}
+
+// AllowCost consumes a fractional number of tokens, e.g. 0.5 for a cached
+// response, from key's bucket. It always asks the server: coalescing and
+// the local cache only deal in whole tokens.
+func (c *Client) AllowCost(ctx context.Context, key string, cost float64) (*Result, error) {
+	return c.send(ctx, &pb.AllowRequest{Key: key, Cost: cost})
+}
+
+// AllowOnce is Allow charging a request at most once however often it's
+// retried with the same id, e.g. after a timeout left its outcome unknown.
+// The server answers retries with the first attempt's Result, or fails
+// them with codes.Aborted while that attempt still runs. Servers need
+// IDEMPOTENCY_TTL_MS, and it always asks the server.
+func (c *Client) AllowOnce(ctx context.Context, key string, tokens int64, id string) (*Result, error) {
+	return c.send(ctx, &pb.AllowRequest{Key: key, Tokens: tokens, RequestId: id})
+}
+
+// consume asks the server for tokens, through the coalescer when enabled.
+func (c *Client) consume(ctx context.Context, key string, tokens int64) (*Result, error) {
+	if c.coalescer != nil {
+		return c.coalescer.allow(ctx, c, key, tokens)
+	}
+	return c.allow(ctx, key, tokens)
+}
+
+func (c *Client) allow(ctx context.Context, key string, tokens int64) (*Result, error) {
+	return c.send(ctx, &pb.AllowRequest{Key: key, Tokens: tokens})
+}
+
+// fetch consumes tokens for the local cache, leased so that Release can
+// give back those left unused. It returns the lease's ID, empty when the
+// server doesn't take tokens back. Fetches skip the coalescer, whose
+// shared calls can't be leased to any one caller.
+func (c *Client) fetch(ctx context.Context, key string, tokens int64) (*Result, string, error) {
+	resp, err := c.rpc.Allow(ctx, &pb.AllowRequest{
+		Key:             key,
+		Namespace:       c.namespace,
+		Tokens:          tokens,
+		LatencyCritical: c.critical,
+		Lease:           true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return newResult(resp), resp.Lease, nil
+}
+
+// send calls Allow with the client's namespace and latency criticality.
+func (c *Client) send(ctx context.Context, req *pb.AllowRequest) (*Result, error) {
+	req.Namespace = c.namespace
+	req.LatencyCritical = c.critical
+	resp, err := c.rpc.Allow(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(resp), nil
+}
+
+// newResult converts an Allow response.
+func newResult(resp *pb.AllowResponse) *Result {
+	return &Result{
+		Allowed:    resp.Allowed,
+		Remaining:  resp.Remaining,
+		Limit:      resp.Limit,
+		ResetAt:    time.Unix(resp.ResetAt, 0),
+		RetryAfter: time.Duration(resp.RetryAfter * float64(time.Second)),
+		Reasons:    resp.Reasons,
+		Binding:    resp.Binding,
+		Warning:    resp.Warning,
+	}
+}
+
+// Release gives the tokens held by the local cache back to the server, so
+// they aren't lost to other clients when the process shuts down. The
+// Client keeps working; later calls fetch fresh allotments. Servers need
+// ALLOW_TOKEN_RETURNS, and take back tokens only within
+// TOKEN_RETURN_TTL_MS of handing them out.
+func (c *Client) Release(ctx context.Context) error {
+	if c.local == nil {
+		return nil
+	}
+	return c.local.release(ctx, c)
+}
+
+// Peek returns key's bucket state without consuming tokens.
+func (c *Client) Peek(ctx context.Context, key string) (*Result, error) {
+	return c.PeekTokens(ctx, key, 1)
+}
+
+// PeekTokens is Peek reporting whether, or in how long, tokens could be
+// consumed from key's bucket, so schedulers can plan work without
+// consuming anything.
+func (c *Client) PeekTokens(ctx context.Context, key string, tokens int64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	resp, err := c.rpc.Peek(ctx, &pb.PeekRequest{
+		Key:       key,
+		Namespace: c.namespace,
+		Tokens:    tokens,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		Allowed:    resp.Remaining >= tokens,
+		Remaining:  resp.Remaining,
+		Limit:      resp.Limit,
+		ResetAt:    time.Unix(resp.ResetAt, 0),
+		RetryAfter: time.Duration(resp.RetryAfter * float64(time.Second)),
+	}, nil
+}
\ No newline at end of file
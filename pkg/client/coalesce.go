@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithCoalescing merges concurrent Allow calls for the same key made within
+// window into one RPC consuming their combined tokens. Every caller in the
+// batch gets the same result; when the batch is denied but the bucket still
+// holds some tokens, the earliest callers that fit are admitted with a
+// second RPC.
+func WithCoalescing(window time.Duration) Option {
+	return func(c *Client) {
+		c.coalescer = &coalescer{window: window, pending: map[string]*batch{}}
+	}
+}
+
+type coalescer struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*batch
+}
+
+type batch struct {
+	waiters []*waiter
+}
+
+type waiter struct {
+	ctx    context.Context
+	tokens int64
+	done   chan struct{}
+	res    *Result
+	err    error
+}
+
+func (w *waiter) finish(res *Result, err error) {
+	if res != nil {
+		r := *res
+		w.res = &r
+	}
+	w.err = err
+	close(w.done)
+}
+
+// allow queues the call on key's batch, starting one if needed.
+func (co *coalescer) allow(ctx context.Context, c *Client, key string, tokens int64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	w := &waiter{ctx: ctx, tokens: tokens, done: make(chan struct{})}
+
+	co.mu.Lock()
+	b, ok := co.pending[key]
+	if !ok {
+		b = &batch{}
+		co.pending[key] = b
+		time.AfterFunc(co.window, func() { co.flush(c, key) })
+	}
+	b.waiters = append(b.waiters, w)
+	co.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return w.res, w.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends key's batch. Callers that gave up before the flush aren't
+// charged for.
+func (co *coalescer) flush(c *Client, key string) {
+	co.mu.Lock()
+	b := co.pending[key]
+	delete(co.pending, key)
+	co.mu.Unlock()
+
+	waiters := b.waiters[:0]
+	for _, w := range b.waiters {
+		if w.ctx.Err() == nil {
+			waiters = append(waiters, w)
+		}
+	}
+	if len(waiters) == 0 {
+		return
+	}
+
+	ctx, cancel := batchContext(waiters)
+	defer cancel()
+
+	res, err := c.allow(ctx, key, sum(waiters))
+	if err != nil || res.Allowed || len(waiters) == 1 {
+		for _, w := range waiters {
+			w.finish(res, err)
+		}
+		return
+	}
+
+	// Admit the longest prefix of callers that still fits in the bucket.
+	n, fit := 0, int64(0)
+	for n < len(waiters) && fit+waiters[n].tokens <= res.Remaining {
+		fit += waiters[n].tokens
+		n++
+	}
+	if n > 0 {
+		if partial, err := c.allow(ctx, key, fit); err == nil && partial.Allowed {
+			for _, w := range waiters[:n] {
+				w.finish(partial, nil)
+			}
+			waiters = waiters[n:]
+		}
+	}
+	for _, w := range waiters {
+		w.finish(res, nil)
+	}
+}
+
+// batchContext derives the RPC context from the first caller's values. It
+// isn't cancelled with any single caller, but carries the latest deadline
+// when every caller has one.
+func batchContext(waiters []*waiter) (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(waiters[0].ctx)
+	var latest time.Time
+	for _, w := range waiters {
+		d, ok := w.ctx.Deadline()
+		if !ok {
+			return context.WithCancel(ctx)
+		}
+		if d.After(latest) {
+			latest = d
+		}
+	}
+	return context.WithDeadline(ctx, latest)
+}
+
+func sum(waiters []*waiter) int64 {
+	var n int64
+	for _, w := range waiters {
+		n += w.tokens
+	}
+	return n
+}
\ No newline at end of file
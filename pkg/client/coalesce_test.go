@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// fakeRPC is a single in-memory bucket that doesn't refill.
+type fakeRPC struct {
+	pb.RateLimitServiceClient
+
+	mu     sync.Mutex
+	tokens int64
+	calls  []int64
+	// leases holds the tokens that can be given back, by lease
+	leases map[string]int64
+}
+
+func (f *fakeRPC) Allow(_ context.Context, req *pb.AllowRequest, _ ...grpc.CallOption) (*pb.AllowResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, req.Tokens)
+	allowed := req.Tokens <= f.tokens
+	resp := &pb.AllowResponse{Allowed: allowed}
+	if allowed {
+		f.tokens -= req.Tokens
+		if req.Lease {
+			if f.leases == nil {
+				f.leases = map[string]int64{}
+			}
+			resp.Lease = fmt.Sprintf("lease-%d", len(f.calls))
+			f.leases[resp.Lease] = req.Tokens
+		}
+	}
+	resp.Remaining = f.tokens
+	return resp, nil
+}
+
+func (f *fakeRPC) ReturnTokens(_ context.Context, req *pb.ReturnTokensRequest, _ ...grpc.CallOption) (*pb.ReturnTokensResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	left, ok := f.leases[req.Lease]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "lease %q not found", req.Lease)
+	}
+	n := min(req.Tokens, left)
+	f.leases[req.Lease] -= n
+	f.tokens += n
+	return &pb.ReturnTokensResponse{Returned: float64(n)}, nil
+}
+
+func allowConcurrently(c *Client, n int) []*Result {
+	results := make([]*Result, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.Allow(context.Background(), "user:1", 1)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+func TestCoalescing_SingleRPC(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithCoalescing(20 * time.Millisecond)(c)
+
+	for _, res := range allowConcurrently(c, 10) {
+		require.NotNil(t, res)
+		assert.True(t, res.Allowed)
+	}
+	assert.Equal(t, []int64{10}, rpc.calls)
+	assert.Equal(t, int64(90), rpc.tokens)
+}
+
+func TestCoalescing_PartialFill(t *testing.T) {
+	rpc := &fakeRPC{tokens: 4}
+	c := &Client{rpc: rpc}
+	WithCoalescing(20 * time.Millisecond)(c)
+
+	allowed := 0
+	for _, res := range allowConcurrently(c, 10) {
+		require.NotNil(t, res)
+		if res.Allowed {
+			allowed++
+		}
+	}
+	assert.Equal(t, 4, allowed, "callers that fit are admitted after a denied batch")
+	assert.Equal(t, []int64{10, 4}, rpc.calls)
+	assert.Equal(t, int64(0), rpc.tokens)
+}
+
+func TestCoalescing_CancelledCallerNotCharged(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithCoalescing(20 * time.Millisecond)(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.Allow(ctx, "user:1", 5)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	res, err := c.Allow(context.Background(), "user:1", 1)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, []int64{1}, rpc.calls)
+}
\ No newline at end of file
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// refillTimeout bounds background allotment refills.
+const refillTimeout = time.Second
+
+// WithLocalCache answers Allow calls from a per-key allotment of size tokens
+// pre-fetched from the server, so most decisions don't leave the process.
+// The allotment is topped up in the background once half of it is spent.
+// Tokens still held after ttl are dropped: they were consumed server-side,
+// so a larger size or ttl trades accuracy across processes for latency.
+// Release gives held tokens back, e.g. on shutdown, as long as the server
+// still holds their lease. Calls asking for more than size tokens always
+// go to the server.
+func WithLocalCache(size int64, ttl time.Duration) Option {
+	return func(c *Client) {
+		c.local = &localCache{size: size, ttl: ttl, keys: map[string]*allotment{}}
+	}
+}
+
+type localCache struct {
+	size int64
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]*allotment
+	lastSweep time.Time
+}
+
+// allotment is the locally held share of one key's bucket.
+type allotment struct {
+	mu        sync.Mutex
+	tokens    int64
+	expiresAt time.Time
+	refilling bool
+	last      Result    // latest server result, for Limit/Remaining/ResetAt
+	deniedTil time.Time // server denied us; answer locally until then
+	// leases are the unspent tokens of each fetch, oldest first, summing
+	// to tokens. Held tokens are spent from the oldest lease.
+	leases []lease
+}
+
+// lease is the unspent part of one allotment fetch, and the server's ID
+// for giving it back; empty when the server doesn't take tokens back.
+type lease struct {
+	id     string
+	tokens int64
+}
+
+func (lc *localCache) get(key string, now time.Time) *allotment {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if now.Sub(lc.lastSweep) > lc.ttl {
+		for k, a := range lc.keys {
+			a.mu.Lock()
+			idle := now.After(a.expiresAt) && now.After(a.deniedTil) && !a.refilling
+			a.mu.Unlock()
+			if idle {
+				delete(lc.keys, k)
+			}
+		}
+		lc.lastSweep = now
+	}
+	a, ok := lc.keys[key]
+	if !ok {
+		a = &allotment{}
+		lc.keys[key] = a
+	}
+	return a
+}
+
+func (lc *localCache) allow(ctx context.Context, c *Client, key string, tokens int64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	if tokens > lc.size {
+		return c.consume(ctx, key, tokens)
+	}
+
+	now := time.Now()
+	a := lc.get(key, now)
+	a.mu.Lock()
+	if now.After(a.expiresAt) {
+		a.drop()
+	}
+	if a.tokens >= tokens {
+		a.take(tokens)
+		res := a.result(true)
+		if a.tokens < lc.size/2 && !a.refilling {
+			a.refilling = true
+			go lc.refill(c, key, a)
+		}
+		a.mu.Unlock()
+		return res, nil
+	}
+	if now.Before(a.deniedTil) {
+		res := a.result(false)
+		res.RetryAfter = a.deniedTil.Sub(now)
+		a.mu.Unlock()
+		return res, nil
+	}
+	a.mu.Unlock()
+
+	// Nothing held locally: fetch a fresh allotment, or at least this
+	// call's tokens when the bucket can't spare a whole one.
+	res, id, err := c.fetch(ctx, key, lc.size)
+	if err != nil {
+		return nil, err
+	}
+	if res.Allowed {
+		a.mu.Lock()
+		a.add(res, lc.size, lc.ttl, id)
+		a.take(tokens)
+		res = a.result(true)
+		a.mu.Unlock()
+		return res, nil
+	}
+
+	res, err = c.consume(ctx, key, tokens)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	a.last = *res
+	if !res.Allowed {
+		a.deniedTil = time.Now().Add(res.RetryAfter)
+	}
+	a.mu.Unlock()
+	return res, nil
+}
+
+// release gives the tokens held for every key back to the server.
+func (lc *localCache) release(ctx context.Context, c *Client) error {
+	now := time.Now()
+	held := map[string][]lease{}
+	lc.mu.Lock()
+	for key, a := range lc.keys {
+		a.mu.Lock()
+		if now.Before(a.expiresAt) {
+			held[key] = a.leases
+		}
+		a.drop()
+		a.mu.Unlock()
+	}
+	lc.mu.Unlock()
+
+	var errs []error
+	for key, leases := range held {
+		for _, l := range leases {
+			if l.id == "" {
+				continue
+			}
+			_, err := c.rpc.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: key, Namespace: c.namespace, Tokens: l.tokens, Lease: l.id})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("return %d tokens of %q: %w", l.tokens, key, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refill tops up a's allotment in the background.
+func (lc *localCache) refill(c *Client, key string, a *allotment) {
+	ctx, cancel := context.WithTimeout(context.Background(), refillTimeout)
+	defer cancel()
+	res, id, err := c.fetch(ctx, key, lc.size)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refilling = false
+	if err == nil && res.Allowed {
+		a.add(res, lc.size, lc.ttl, id)
+	}
+}
+
+// add credits n freshly consumed tokens, leased under id. Callers hold
+// a.mu.
+func (a *allotment) add(res *Result, n int64, ttl time.Duration, id string) {
+	if time.Now().After(a.expiresAt) {
+		a.drop()
+	}
+	a.tokens += n
+	a.leases = append(a.leases, lease{id: id, tokens: n})
+	a.expiresAt = time.Now().Add(ttl)
+	a.last = *res
+	a.deniedTil = time.Time{}
+}
+
+// take spends n held tokens, from the oldest leases first. Callers hold
+// a.mu.
+func (a *allotment) take(n int64) {
+	a.tokens -= n
+	for n > 0 && len(a.leases) > 0 {
+		spent := min(n, a.leases[0].tokens)
+		a.leases[0].tokens -= spent
+		n -= spent
+		if a.leases[0].tokens == 0 {
+			a.leases = a.leases[1:]
+		}
+	}
+}
+
+// drop forgets every held token. Callers hold a.mu.
+func (a *allotment) drop() {
+	a.tokens = 0
+	a.leases = nil
+}
+
+// result builds a locally answered Result. Remaining counts both the tokens
+// held here and those left on the server. Callers hold a.mu.
+func (a *allotment) result(allowed bool) *Result {
+	return &Result{
+		Allowed:   allowed,
+		Remaining: a.tokens + a.last.Remaining,
+		Limit:     a.last.Limit,
+		ResetAt:   a.last.ResetAt,
+	}
+}
\ No newline at end of file
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalCache_AnswersFromAllotment(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithLocalCache(10, time.Minute)(c)
+
+	for i := 0; i < 5; i++ {
+		res, err := c.Allow(context.Background(), "user:1", 1)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	assert.Equal(t, []int64{10}, rpc.calls, "one fetch serves the first calls")
+
+	// Dropping below half the allotment triggers a background refill.
+	_, err := c.Allow(context.Background(), "user:1", 1)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		rpc.mu.Lock()
+		defer rpc.mu.Unlock()
+		return len(rpc.calls) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(80), rpc.tokens)
+}
+
+func TestLocalCache_FallsBackWhenBucketIsLow(t *testing.T) {
+	rpc := &fakeRPC{tokens: 3}
+	c := &Client{rpc: rpc}
+	WithLocalCache(10, time.Minute)(c)
+
+	res, err := c.Allow(context.Background(), "user:1", 1)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, []int64{10, 1}, rpc.calls)
+	assert.Equal(t, int64(2), rpc.tokens)
+}
+
+func TestLocalCache_LargeRequestsBypass(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithLocalCache(10, time.Minute)(c)
+
+	res, err := c.Allow(context.Background(), "user:1", 50)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, []int64{50}, rpc.calls)
+}
+
+func TestLocalCache_Release(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithLocalCache(10, time.Minute)(c)
+
+	for _, key := range []string{"user:1", "user:1", "user:2"} {
+		_, err := c.Allow(context.Background(), key, 1)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(80), rpc.tokens)
+	require.NoError(t, c.Release(context.Background()))
+	assert.Equal(t, int64(97), rpc.tokens, "held tokens are given back")
+
+	// Released keys fetch a fresh allotment.
+	_, err := c.Allow(context.Background(), "user:1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(87), rpc.tokens)
+	assert.NoError(t, (&Client{rpc: rpc}).Release(context.Background()), "no local cache")
+}
+
+func TestLocalCache_ReleaseAcrossLeases(t *testing.T) {
+	rpc := &fakeRPC{tokens: 100}
+	c := &Client{rpc: rpc}
+	WithLocalCache(10, time.Minute)(c)
+
+	// The sixth call spends from the first fetch and refills.
+	for i := 0; i < 6; i++ {
+		_, err := c.Allow(context.Background(), "user:1", 1)
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		rpc.mu.Lock()
+		defer rpc.mu.Unlock()
+		return len(rpc.calls) == 2
+	}, time.Second, time.Millisecond)
+	require.NoError(t, c.Release(context.Background()))
+	assert.Equal(t, int64(94), rpc.tokens, "each lease gives back what's left of it")
+	assert.Equal(t, map[string]int64{"lease-1": 0, "lease-2": 0}, rpc.leases)
+}
\ No newline at end of file
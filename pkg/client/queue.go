@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// resumeDelay is how long a queued request waits before resuming on its
+// ticket after its stream broke.
+const resumeDelay = 100 * time.Millisecond
+
+// QueueFunc is told a queued request's ticket, and how many requests are
+// ahead of it whenever that changes.
+type QueueFunc func(ticket string, position int64)
+
+// AllowQueued is Allow waiting in line for tokens instead of being denied,
+// for batch work that would rather wait than retry: it returns once the
+// server admitted the request, with the "queued" reason, or fails when ctx
+// ends first. Waits survive dropped connections. queued, when not nil,
+// learns the request's ticket, which Resume takes over from, e.g. in
+// another process. Servers need QUEUE_MAX_LENGTH, and fail requests to
+// full queues with codes.ResourceExhausted.
+func (c *Client) AllowQueued(ctx context.Context, key string, tokens int64, queued QueueFunc) (*Result, error) {
+	events, err := c.rpc.Enqueue(ctx, &pb.AllowRequest{Key: key, Namespace: c.namespace, Tokens: tokens})
+	if err != nil {
+		return nil, err
+	}
+	return c.await(ctx, events, "", queued)
+}
+
+// Resume waits on the ticket of an earlier AllowQueued call until its
+// request is admitted, or returns its Result right away if it was. Tickets
+// are forgotten soon after nobody waits on them, failing with
+// codes.NotFound.
+func (c *Client) Resume(ctx context.Context, ticket string, queued QueueFunc) (*Result, error) {
+	return c.await(ctx, nil, ticket, queued)
+}
+
+// queueEvents is the client side of Enqueue and WatchTicket streams.
+type queueEvents interface {
+	Recv() (*pb.QueueEvent, error)
+}
+
+// await reads events until the request is admitted, resuming on its
+// ticket, or starting to when events is nil, whenever its stream breaks.
+func (c *Client) await(ctx context.Context, events queueEvents, ticket string, queued QueueFunc) (*Result, error) {
+	for {
+		if events == nil {
+			var err error
+			if events, err = c.rpc.WatchTicket(ctx, &pb.WatchTicketRequest{Ticket: ticket}); err != nil {
+				return nil, err
+			}
+		}
+		ev, err := events.Recv()
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF):
+			return nil, io.ErrUnexpectedEOF
+		case ticket != "" && status.Code(err) == codes.Unavailable && ctx.Err() == nil:
+			events = nil
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(resumeDelay):
+			}
+			continue
+		default:
+			return nil, err
+		}
+
+		if ev.Response != nil {
+			return newResult(ev.Response), nil
+		}
+		ticket = ev.Ticket
+		if queued != nil {
+			queued(ev.Ticket, ev.Position)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StreamLimiter rate-limits the messages of a consuming service's gRPC
+// streams, which a per-RPC limit can't see into: one long-lived stream may
+// carry a trickle or a flood. Install it with
+//
+//	grpc.StreamInterceptor(sl.StreamServerInterceptor)
+//
+// Each message received, including a server-streaming RPC's request,
+// costs one token of the stream's key. A denied message fails RecvMsg with
+// ResourceExhausted, which ends the stream once the handler returns it.
+type StreamLimiter struct {
+	// Limiter decides, typically a *Client. Required.
+	Limiter Limiter
+	// Key returns the key a stream's messages are charged to, its full
+	// method name when nil.
+	Key func(ctx context.Context, info *grpc.StreamServerInfo) string
+	// Batch is how many messages each Allow call pays for upfront, saving
+	// calls on busy streams (0 = 1).
+	Batch int64
+	// Sends also charges the messages the server sends.
+	Sends bool
+	// Policy applies to denied messages. Wait holds them back, slowing the
+	// stream down instead of ending it.
+	Policy Policy
+	// MaxWait bounds how long Wait holds one message (0 = as long as the
+	// stream's context allows).
+	MaxWait time.Duration
+	// FailOpen passes messages when the limiter can't be asked, instead
+	// of failing them with Unavailable.
+	FailOpen bool
+}
+
+// StreamServerInterceptor limits the messages of every stream it sees.
+func (l *StreamLimiter) StreamServerInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	key := info.FullMethod
+	if l.Key != nil {
+		key = l.Key(ss.Context(), info)
+	}
+	return handler(srv, &limitedStream{ServerStream: ss, l: l, key: key})
+}
+
+// limitedStream charges its messages to key.
+type limitedStream struct {
+	grpc.ServerStream
+	l   *StreamLimiter
+	key string
+
+	// mu serializes charges, as RecvMsg and SendMsg may run concurrently.
+	mu     sync.Mutex
+	credit int64 // messages paid for but not yet passed
+}
+
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.charge()
+}
+
+func (s *limitedStream) SendMsg(m interface{}) error {
+	if s.l.Sends {
+		if err := s.charge(); err != nil {
+			return err
+		}
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// charge pays for one message, from credit when there is some.
+func (s *limitedStream) charge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credit > 0 {
+		s.credit--
+		return nil
+	}
+	batch := max(s.l.Batch, 1)
+	err := admit(s.Context(), s.l.Limiter, s.key, batch, s.l.Policy, s.l.MaxWait, s.l.FailOpen)
+	var denied *DeniedError
+	switch {
+	case err == nil:
+		s.credit = batch - 1
+		return nil
+	case errors.As(err, &denied):
+		return status.Error(codes.ResourceExhausted, denied.Error())
+	case s.Context().Err() != nil:
+		return status.FromContextError(s.Context().Err()).Err()
+	default:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
\ No newline at end of file
@@ -0,0 +1,90 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limitertest"
+)
+
+// fakeStream delivers msgs messages, then io.EOF.
+type fakeStream struct {
+	grpc.ServerStream
+	msgs int
+	sent int
+}
+
+func (f *fakeStream) Context() context.Context { return context.Background() }
+
+func (f *fakeStream) RecvMsg(any) error {
+	if f.msgs == 0 {
+		return io.EOF
+	}
+	f.msgs--
+	return nil
+}
+
+func (f *fakeStream) SendMsg(any) error {
+	f.sent++
+	return nil
+}
+
+// echo receives and answers messages until the stream ends.
+func echo(_ any, ss grpc.ServerStream) error {
+	for {
+		if err := ss.RecvMsg(nil); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := ss.SendMsg(nil); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStreamLimiter(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/chat.Chat/Connect"}
+	fake := limitertest.DenyAfter(4)
+	sl := &client.StreamLimiter{Limiter: fake, Batch: 2}
+	ss := &fakeStream{msgs: 10}
+	err := sl.StreamServerInterceptor(nil, ss, info, echo)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+	assert.Equal(t, 4, ss.sent)
+	require.Len(t, fake.Calls(), 3, "one call per batch")
+	assert.Equal(t, limitertest.Call{Key: info.FullMethod, Tokens: 2}, fake.Calls()[0])
+
+	ss = &fakeStream{msgs: 3}
+	err = sl.StreamServerInterceptor(nil, ss, info, echo)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "the key stays spent")
+
+	sl = &client.StreamLimiter{Limiter: limitertest.DenyAfter(3), Sends: true}
+	ss = &fakeStream{msgs: 10}
+	err = sl.StreamServerInterceptor(nil, ss, info, echo)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 1, ss.sent, "sends are charged too")
+}
+
+func TestStreamLimiter_Errors(t *testing.T) {
+	info := &grpc.StreamServerInfo{FullMethod: "/chat.Chat/Connect"}
+	fake := limitertest.AlwaysAllow().WithError(errors.New("unreachable"))
+	sl := &client.StreamLimiter{Limiter: fake, Key: func(context.Context, *grpc.StreamServerInfo) string { return "tenant:1" }}
+	err := sl.StreamServerInterceptor(nil, &fakeStream{msgs: 1}, info, echo)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	sl.FailOpen = true
+	ss := &fakeStream{msgs: 5}
+	require.NoError(t, sl.StreamServerInterceptor(nil, ss, info, echo))
+	assert.Equal(t, 5, ss.sent)
+	assert.Equal(t, "tenant:1", fake.Calls()[0].Key)
+}
\ No newline at end of file
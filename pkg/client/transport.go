@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// minRetryWait is how long a waiting Transport sleeps after a denial that
+// carries no RetryAfter.
+const minRetryWait = 50 * time.Millisecond
+
+// Policy is what a Transport or StreamLimiter does with a request or
+// message the limiter denies.
+type Policy int
+
+const (
+	// FailFast fails the request with a *DeniedError.
+	FailFast Policy = iota
+	// Wait sleeps for the denial's RetryAfter and asks again, failing the
+	// request with a *DeniedError only once the wait would outlast
+	// MaxWait or the request's context.
+	Wait
+)
+
+// DeniedError is returned by a Transport for a request the limiter denied.
+type DeniedError struct {
+	Key    string
+	Result *Result
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("rate limited on %q, retry after %v", e.Key, e.Result.RetryAfter)
+}
+
+// Transport is an http.RoundTripper consulting the limiter before every
+// outbound request, for keeping calls to third-party APIs within their
+// limits. Each request costs one token of its key.
+type Transport struct {
+	// Limiter decides, typically a *Client. Required.
+	Limiter Limiter
+	// Key returns the key a request is charged to, its URL's host when
+	// nil.
+	Key func(*http.Request) string
+	// Policy applies to denied requests.
+	Policy Policy
+	// MaxWait bounds how long Wait holds a request in total (0 = as long
+	// as its context allows).
+	MaxWait time.Duration
+	// FailOpen sends requests when the limiter can't be asked, instead of
+	// failing them with its error.
+	FailOpen bool
+	// Base sends admitted requests, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTrip sends req once the limiter admits it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.admit(req); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func (t *Transport) admit(req *http.Request) error {
+	key := req.URL.Host
+	if t.Key != nil {
+		key = t.Key(req)
+	}
+	return admit(req.Context(), t.Limiter, key, 1, t.Policy, t.MaxWait, t.FailOpen)
+}
+
+// admit asks l for tokens of key until it allows them, as policy says.
+// Denials it gives up on fail with a *DeniedError.
+func admit(ctx context.Context, l Limiter, key string, tokens int64, policy Policy, maxWait time.Duration, failOpen bool) error {
+	var deadline time.Time
+	if maxWait > 0 {
+		deadline = time.Now().Add(maxWait)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	for {
+		res, err := l.Allow(ctx, key, tokens)
+		if err != nil {
+			if failOpen && ctx.Err() == nil {
+				return nil
+			}
+			return fmt.Errorf("rate limit check on %q: %w", key, err)
+		}
+		if res.Allowed {
+			return nil
+		}
+		wait := max(res.RetryAfter, minRetryWait)
+		if policy != Wait || (!deadline.IsZero() && time.Now().Add(wait).After(deadline)) {
+			return &DeniedError{Key: key, Result: res}
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d, or returns ctx's error once it's done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
\ No newline at end of file
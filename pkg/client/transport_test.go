@@ -0,0 +1,90 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limitertest"
+)
+
+func TestTransport(t *testing.T) {
+	var sent atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { sent.Add(1) }))
+	defer srv.Close()
+
+	fake := limitertest.DenyAfter(2)
+	hc := &http.Client{Transport: &client.Transport{
+		Limiter: fake,
+		Key:     func(*http.Request) string { return "vendor:payments" },
+	}}
+	for i := 0; i < 2; i++ {
+		resp, err := hc.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	_, err := hc.Get(srv.URL)
+	var denied *client.DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Equal(t, "vendor:payments", denied.Key)
+	assert.Equal(t, time.Second, denied.Result.RetryAfter)
+	assert.Equal(t, int32(2), sent.Load(), "denied requests aren't sent")
+	assert.Len(t, fake.Calls(), 3)
+}
+
+func TestTransport_Wait(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	fake := limitertest.DenyAfter(1).WithRetryAfter(10 * time.Millisecond)
+	tr := &client.Transport{Limiter: fake, Policy: client.Wait, MaxWait: 200 * time.Millisecond}
+	hc := &http.Client{Transport: tr}
+	resp, err := hc.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// The fake never refills: Wait asks again until MaxWait runs out.
+	start := time.Now()
+	_, err = hc.Get(srv.URL)
+	var denied *client.DeniedError
+	require.ErrorAs(t, err, &denied)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Greater(t, len(fake.Calls()), 2, "retried after waiting")
+
+	// Waits longer than the request may take fail right away.
+	fake.Reset()
+	fake.WithRetryAfter(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	tr.MaxWait = 0
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err = hc.Do(req)
+	require.NoError(t, err, "reset allowance")
+	resp.Body.Close()
+	_, err = hc.Do(req)
+	require.ErrorAs(t, err, &denied)
+}
+
+func TestTransport_LimiterDown(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	down := errors.New("unavailable")
+
+	tr := &client.Transport{Limiter: limitertest.AlwaysDeny().WithError(down)}
+	_, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	assert.ErrorIs(t, err, down)
+
+	tr.FailOpen = true
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
\ No newline at end of file
@@ -15,14 +15,206 @@ type Config struct {
 	RedisDB       int
 	RedisPoolSize int
 
+	// Connections opened before serving and kept idle, and the no-op evals
+	// run to warm up the limiter
+	RedisMinIdleConns int
+	WarmupEvals       int
+
+	// Comma-separated Redis Cluster seed addresses. When set, buckets live
+	// in the cluster; tenants, boosts and usage stay on REDIS_ADDR.
+	RedisClusterAddrs string
+
+	// Adaptive pool sizing for the limiter's Redis client (disabled when
+	// REDIS_POOL_MAX is 0). REDIS_POOL_SIZE is the starting size.
+	RedisPoolMin          int
+	RedisPoolMax          int
+	RedisPoolTuneInterval time.Duration
+
 	// Default bucket settings (can be overridden per-request)
 	DefaultBurst int64
 	DefaultRate  float64
 
+	// Namespace applied to requests that don't set one
+	DefaultNamespace string
+
+	// Comma-separated normalizers rewriting keys before they're limited,
+	// in order, e.g. "trim,lower,port,ip" ("" = keys as sent)
+	KeyNormalizers string
+
+	// Per-prefix defaults and override bounds
+	RulesFile string
+
+	// Directory of Lua scripts replacing the embedded ones, each pinned in
+	// the directory's SHA256SUMS ("" = embedded scripts only)
+	LuaScriptsDir string
+	// Lets the HMAC_ADMIN_CLIENTS reload scripts at runtime, to versions
+	// pinned in LUA_SCRIPTS_DIR's SHA256SUMS
+	ScriptReloadAdmin bool
+
+	// Tenants (per-namespace defaults and quotas)
+	TenantsFile           string
+	TenantRefreshInterval time.Duration
+
+	// Temporary limit boosts
+	BoostRefreshInterval time.Duration
+
+	// Keys whose decisions are logged in full (AdminService.TraceKey)
+	TraceRefreshInterval time.Duration
+	// Last decisions kept per traced key (0 = none), for this long after
+	// the last one
+	DecisionHistorySize      int
+	DecisionHistoryRetention time.Duration
+
+	// Keys whose requests are all rejected (AdminService.AddDenylistEntries)
+	DenylistRefreshInterval time.Duration
+
+	// How often replicas pick up maintenance mode changes
+	MaintenanceInterval time.Duration
+
+	// Tenant usage accounting
+	UsageFlushInterval time.Duration
+	UsageRetention     time.Duration
+	// Hourly traffic per namespace and key prefix, kept for previews of
+	// rules changes (not recorded when 0)
+	PrefixUsageRetention time.Duration
+
+	// Latency-oriented runtime settings: GOMAXPROCS from the cgroup CPU
+	// quota, GOGC, and a soft memory limit at a ratio of the cgroup's.
+	RuntimeLowLatency       bool
+	RuntimeGOGC             int
+	RuntimeMemoryLimitRatio float64
+
+	// Buffer latency observations in this many shards and flush them to
+	// Prometheus every interval (0 = observe directly). For many-core hosts
+	// at very high RPS.
+	MetricsBatchShards        int
+	MetricsBatchFlushInterval time.Duration
+
 	// gRPC settings
 	MaxRecvMsgSize int
 	MaxConcurrent  int
 
+	// How long in-flight calls may run after SIGTERM before their
+	// connections are closed
+	ShutdownDrain time.Duration
+
+	// gRPC transport tuning (0 = gRPC's default). Stream workers serve
+	// requests from a fixed goroutine pool instead of one goroutine each.
+	GRPCNumStreamWorkers      int
+	GRPCInitialWindowSize     int
+	GRPCInitialConnWindowSize int
+	GRPCWriteBufferSize       int
+	GRPCReadBufferSize        int
+
+	// Response compression ("gzip", or "" to send responses uncompressed
+	// unless the request was compressed). Rarely pays off for small messages.
+	GRPCCompression string
+
+	// Token leasing for hot keys (disabled when the threshold is 0)
+	LeaseThreshold int64
+	LeaseChunk     int64
+	LeaseTTL       time.Duration
+
+	// Let clients give back tokens they consumed but didn't use, e.g. the
+	// SDK's prefetched ones on shutdown, for TokenReturnTTL after consuming
+	// them. Returns are capped at what the Allow call consumed.
+	AllowTokenReturns bool
+	TokenReturnTTL    time.Duration
+
+	// How long Allow remembers request IDs to answer retries without
+	// charging them again (0 = ignore request IDs)
+	IdempotencyTTL time.Duration
+
+	// Most requests waiting in line per key for Enqueue (0 = refuse
+	// queueing), and how long tickets outlive their last waiter
+	QueueMaxLength int64
+	QueueTicketTTL time.Duration
+
+	// Longest latency-critical Allow calls wait for Redis before being
+	// answered from local state (0 = always wait)
+	LatencyBudget time.Duration
+
+	// Max concurrent Allow calls hitting Redis before they queue fairly
+	// per tenant/prefix (0 = no scheduling). Typically ~REDIS_POOL_SIZE.
+	SchedulerMaxInFlight int
+
+	// HMAC request signing (disabled when no keys file is set)
+	HMACKeysFile string
+	HMACMaxSkew  time.Duration
+	// Comma-separated clients of the keys file that may call the
+	// AdminService. It isn't served without them.
+	HMACAdminClients string
+
+	// Per-service-account quotas on limiter RPCs (requires HMAC signing)
+	APIQuotaFile string
+
+	// Temporary throttling of keys whose request rate reaches ANOMALY_FACTOR
+	// times their moving average over ANOMALY_BASELINE (disabled when the
+	// factor is 0). Throttles multiply the key's limits by AnomalyThrottle.
+	AnomalyFactor      float64
+	AnomalyWindow      time.Duration
+	AnomalyBaseline    time.Duration
+	AnomalyMinRate     float64
+	AnomalyThrottle    float64
+	AnomalyThrottleFor time.Duration
+
+	// Provisional limits for keys seen for the first time: their burst and
+	// rate are multiplied by GreylistMultiplier for GREYLIST_PROBATION
+	// (disabled when 0). Seen keys are kept in a Bloom filter on REDIS_ADDR
+	// sized for GreylistExpectedKeys.
+	GreylistProbation    time.Duration
+	GreylistMultiplier   float64
+	GreylistExpectedKeys int64
+
+	// Global limits across independent clusters, e.g. one per region: the
+	// limits of rules marked global are split between the regions syncing
+	// through GLOBAL_REDIS_ADDR (disabled when unset). REGION names this one.
+	GlobalRedisAddr     string
+	GlobalRedisPassword string
+	Region              string
+	GlobalSyncInterval  time.Duration
+
+	// Redis fault injection for the limiter's client, for testing fallback
+	// paths in staging. Never enable in production. ChaosAdmin lets the
+	// HMAC_ADMIN_CLIENTS change the faults at runtime.
+	ChaosAdmin           bool
+	ChaosRedisDown       bool
+	ChaosLatency         time.Duration
+	ChaosLatencyRate     float64
+	ChaosErrorRate       float64
+	ChaosScriptErrorRate float64
+	ChaosPartitionEvery  time.Duration
+	ChaosPartitionFor    time.Duration
+
+	// Caps on the keys and memory of each Redis node of the limiter (0 = no
+	// cap). Over one, the buckets idle the longest are evicted, checked every
+	// RedisGuardInterval by one replica.
+	RedisMaxKeys       int64
+	RedisMaxMemoryMB   int64
+	RedisGuardInterval time.Duration
+
+	// Background deletion of buckets idle for longer than CleanupIdle
+	// (disabled when 0), one pass every CleanupInterval by one replica,
+	// scanning up to CleanupKeysPerSecond keys per Redis node.
+	CleanupIdle          time.Duration
+	CleanupInterval      time.Duration
+	CleanupKeysPerSecond int
+
+	// Dashboard served under /ui/ on the metrics port, behind basic auth
+	// (disabled while UIPassword is empty). It grants and revokes boosts,
+	// so it needs the AdminService's HMAC_ADMIN_CLIENTS too. Its live
+	// rates and top keys are counted over windows of TopKeysWindow.
+	UIUser        string
+	UIPassword    string
+	TopKeysWindow time.Duration
+
+	// "error", "info" or "debug"; the AdminService may change it for a while
+	LogLevel string
+
+	// Where SIGUSR1 and saved DumpDiagnostics snapshots are written (the
+	// log when empty)
+	DiagDir string
+
 	// Redis timeouts
 	RedisDialTimeout  time.Duration
 	RedisReadTimeout  time.Duration
@@ -31,22 +223,122 @@ type Config struct {
 
 func Load() *Config {
 	return &Config{
-		GRPCPort:          envOrDefault("GRPC_PORT", "50051"),
-		MetricsPort:       envOrDefault("METRICS_PORT", "9090"),
-		RedisAddr:         envOrDefault("REDIS_ADDR", "localhost:6379"),
-		RedisPassword:     envOrDefault("REDIS_PASSWORD", ""),
-		RedisDB:           envOrDefaultInt("REDIS_DB", 0),
-		RedisPoolSize:     envOrDefaultInt("REDIS_POOL_SIZE", 100),
-		DefaultBurst:      int64(envOrDefaultInt("DEFAULT_BURST", 100)),
-		DefaultRate:       envOrDefaultFloat("DEFAULT_RATE", 10.0),
-		MaxRecvMsgSize:    4 * 1024 * 1024, // 4MB
-		MaxConcurrent:     envOrDefaultInt("MAX_CONCURRENT_STREAMS", 1000),
-		RedisDialTimeout:  time.Duration(envOrDefaultInt("REDIS_DIAL_TIMEOUT_MS", 500)) * time.Millisecond,
-		RedisReadTimeout:  time.Duration(envOrDefaultInt("REDIS_READ_TIMEOUT_MS", 200)) * time.Millisecond,
-		RedisWriteTimeout: time.Duration(envOrDefaultInt("REDIS_WRITE_TIMEOUT_MS", 200)) * time.Millisecond,
+		GRPCPort:                  envOrDefault("GRPC_PORT", "50051"),
+		MetricsPort:               envOrDefault("METRICS_PORT", "9090"),
+		RedisAddr:                 envOrDefault("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:             envOrDefault("REDIS_PASSWORD", ""),
+		RedisDB:                   envOrDefaultInt("REDIS_DB", 0),
+		RedisPoolSize:             envOrDefaultInt("REDIS_POOL_SIZE", 100),
+		RedisMinIdleConns:         envOrDefaultInt("REDIS_MIN_IDLE_CONNS", 10),
+		WarmupEvals:               envOrDefaultInt("WARMUP_EVALS", 10),
+		RedisClusterAddrs:         envOrDefault("REDIS_CLUSTER_ADDRS", ""),
+		RedisPoolMin:              envOrDefaultInt("REDIS_POOL_MIN", 10),
+		RedisPoolMax:              envOrDefaultInt("REDIS_POOL_MAX", 0),
+		RedisPoolTuneInterval:     time.Duration(envOrDefaultInt("REDIS_POOL_TUNE_INTERVAL_MS", 1000)) * time.Millisecond,
+		DefaultBurst:              int64(envOrDefaultInt("DEFAULT_BURST", 100)),
+		DefaultRate:               envOrDefaultFloat("DEFAULT_RATE", 10.0),
+		DefaultNamespace:          envOrDefault("DEFAULT_NAMESPACE", ""),
+		KeyNormalizers:            envOrDefault("KEY_NORMALIZERS", ""),
+		RulesFile:                 envOrDefault("RULES_FILE", ""),
+		LuaScriptsDir:             envOrDefault("LUA_SCRIPTS_DIR", ""),
+		ScriptReloadAdmin:         envOrDefaultBool("SCRIPT_RELOAD_ADMIN", false),
+		TenantsFile:               envOrDefault("TENANTS_FILE", ""),
+		TenantRefreshInterval:     time.Duration(envOrDefaultInt("TENANT_REFRESH_INTERVAL_MS", 10000)) * time.Millisecond,
+		BoostRefreshInterval:      time.Duration(envOrDefaultInt("BOOST_REFRESH_INTERVAL_MS", 10000)) * time.Millisecond,
+		TraceRefreshInterval:      time.Duration(envOrDefaultInt("TRACE_REFRESH_INTERVAL_MS", 5000)) * time.Millisecond,
+		DecisionHistorySize:       envOrDefaultInt("DECISION_HISTORY_SIZE", 0),
+		DecisionHistoryRetention:  time.Duration(envOrDefaultInt("DECISION_HISTORY_RETENTION_HOURS", 7*24)) * time.Hour,
+		DenylistRefreshInterval:   time.Duration(envOrDefaultInt("DENYLIST_REFRESH_INTERVAL_MS", 10000)) * time.Millisecond,
+		MaintenanceInterval:       time.Duration(envOrDefaultInt("MAINTENANCE_REFRESH_INTERVAL_MS", 5000)) * time.Millisecond,
+		UsageFlushInterval:        time.Duration(envOrDefaultInt("USAGE_FLUSH_INTERVAL_MS", 10000)) * time.Millisecond,
+		UsageRetention:            time.Duration(envOrDefaultInt("USAGE_RETENTION_HOURS", 35*24)) * time.Hour,
+		PrefixUsageRetention:      time.Duration(envOrDefaultInt("PREFIX_USAGE_RETENTION_HOURS", 7*24)) * time.Hour,
+		RuntimeLowLatency:         envOrDefaultBool("RUNTIME_LOW_LATENCY", false),
+		RuntimeGOGC:               envOrDefaultInt("RUNTIME_GOGC", 400),
+		RuntimeMemoryLimitRatio:   envOrDefaultFloat("RUNTIME_MEMORY_LIMIT_RATIO", 0.9),
+		MetricsBatchShards:        envOrDefaultInt("METRICS_BATCH_SHARDS", 0),
+		MetricsBatchFlushInterval: time.Duration(envOrDefaultInt("METRICS_BATCH_FLUSH_INTERVAL_MS", 100)) * time.Millisecond,
+		MaxRecvMsgSize:            4 * 1024 * 1024, // 4MB
+		MaxConcurrent:             envOrDefaultInt("MAX_CONCURRENT_STREAMS", 1000),
+		ShutdownDrain:             time.Duration(envOrDefaultInt("SHUTDOWN_DRAIN_MS", 10000)) * time.Millisecond,
+		GRPCNumStreamWorkers:      envOrDefaultInt("GRPC_NUM_STREAM_WORKERS", 0),
+		GRPCInitialWindowSize:     envOrDefaultInt("GRPC_INITIAL_WINDOW_SIZE", 0),
+		GRPCInitialConnWindowSize: envOrDefaultInt("GRPC_INITIAL_CONN_WINDOW_SIZE", 0),
+		GRPCWriteBufferSize:       envOrDefaultInt("GRPC_WRITE_BUFFER_SIZE", 0),
+		GRPCReadBufferSize:        envOrDefaultInt("GRPC_READ_BUFFER_SIZE", 0),
+		GRPCCompression:           envOrDefault("GRPC_COMPRESSION", ""),
+		LeaseThreshold:            int64(envOrDefaultInt("LEASE_THRESHOLD_RPS", 0)),
+		LeaseChunk:                int64(envOrDefaultInt("LEASE_CHUNK", 20)),
+		LeaseTTL:                  time.Duration(envOrDefaultInt("LEASE_TTL_MS", 250)) * time.Millisecond,
+		AllowTokenReturns:         envOrDefaultBool("ALLOW_TOKEN_RETURNS", false),
+		TokenReturnTTL:            time.Duration(envOrDefaultInt("TOKEN_RETURN_TTL_MS", 300000)) * time.Millisecond,
+		IdempotencyTTL:            time.Duration(envOrDefaultInt("IDEMPOTENCY_TTL_MS", 60000)) * time.Millisecond,
+		QueueMaxLength:            int64(envOrDefaultInt("QUEUE_MAX_LENGTH", 0)),
+		QueueTicketTTL:            time.Duration(envOrDefaultInt("QUEUE_TICKET_TTL_MS", 10000)) * time.Millisecond,
+		LatencyBudget:             time.Duration(envOrDefaultInt("LATENCY_BUDGET_MS", 0)) * time.Millisecond,
+		SchedulerMaxInFlight:      envOrDefaultInt("SCHEDULER_MAX_INFLIGHT", 0),
+		HMACKeysFile:              envOrDefault("HMAC_KEYS_FILE", ""),
+		HMACMaxSkew:               time.Duration(envOrDefaultInt("HMAC_MAX_SKEW_MS", 300000)) * time.Millisecond,
+		HMACAdminClients:          envOrDefault("HMAC_ADMIN_CLIENTS", ""),
+		APIQuotaFile:              envOrDefault("API_QUOTA_FILE", ""),
+		AnomalyFactor:             envOrDefaultFloat("ANOMALY_FACTOR", 0),
+		AnomalyWindow:             time.Duration(envOrDefaultInt("ANOMALY_WINDOW_MS", 10000)) * time.Millisecond,
+		AnomalyBaseline:           time.Duration(envOrDefaultInt("ANOMALY_BASELINE_MS", 3600000)) * time.Millisecond,
+		AnomalyMinRate:            envOrDefaultFloat("ANOMALY_MIN_RATE", 10),
+		AnomalyThrottle:           envOrDefaultFloat("ANOMALY_THROTTLE", 0.1),
+		AnomalyThrottleFor:        time.Duration(envOrDefaultInt("ANOMALY_THROTTLE_MS", 600000)) * time.Millisecond,
+		GreylistProbation:         time.Duration(envOrDefaultInt("GREYLIST_PROBATION_MS", 0)) * time.Millisecond,
+		GreylistMultiplier:        envOrDefaultFloat("GREYLIST_MULTIPLIER", 0.1),
+		GreylistExpectedKeys:      int64(envOrDefaultInt("GREYLIST_EXPECTED_KEYS", 10000000)),
+		GlobalRedisAddr:           envOrDefault("GLOBAL_REDIS_ADDR", ""),
+		GlobalRedisPassword:       envOrDefault("GLOBAL_REDIS_PASSWORD", ""),
+		Region:                    envOrDefault("REGION", ""),
+		GlobalSyncInterval:        time.Duration(envOrDefaultInt("GLOBAL_SYNC_INTERVAL_MS", 1000)) * time.Millisecond,
+		RedisMaxKeys:              int64(envOrDefaultInt("REDIS_MAX_KEYS", 0)),
+		RedisMaxMemoryMB:          int64(envOrDefaultInt("REDIS_MAX_MEMORY_MB", 0)),
+		RedisGuardInterval:        time.Duration(envOrDefaultInt("REDIS_GUARD_INTERVAL_MS", 10000)) * time.Millisecond,
+		CleanupIdle:               time.Duration(envOrDefaultInt("CLEANUP_IDLE_MS", 0)) * time.Millisecond,
+		CleanupInterval:           time.Duration(envOrDefaultInt("CLEANUP_INTERVAL_MS", 3600000)) * time.Millisecond,
+		CleanupKeysPerSecond:      envOrDefaultInt("CLEANUP_KEYS_PER_SECOND", 1000),
+		UIUser:                    envOrDefault("UI_USER", "admin"),
+		UIPassword:                envOrDefault("UI_PASSWORD", ""),
+		TopKeysWindow:             time.Duration(envOrDefaultInt("TOP_KEYS_WINDOW_MS", 10000)) * time.Millisecond,
+		LogLevel:                  envOrDefault("LOG_LEVEL", "info"),
+		DiagDir:                   envOrDefault("DIAG_DIR", ""),
+		ChaosAdmin:                envOrDefaultBool("CHAOS_ADMIN", false),
+		ChaosRedisDown:            envOrDefaultBool("CHAOS_REDIS_DOWN", false),
+		ChaosLatency:              time.Duration(envOrDefaultInt("CHAOS_LATENCY_MS", 0)) * time.Millisecond,
+		ChaosLatencyRate:          envOrDefaultFloat("CHAOS_LATENCY_RATE", 0),
+		ChaosErrorRate:            envOrDefaultFloat("CHAOS_ERROR_RATE", 0),
+		ChaosScriptErrorRate:      envOrDefaultFloat("CHAOS_SCRIPT_ERROR_RATE", 0),
+		ChaosPartitionEvery:       time.Duration(envOrDefaultInt("CHAOS_PARTITION_EVERY_MS", 0)) * time.Millisecond,
+		ChaosPartitionFor:         time.Duration(envOrDefaultInt("CHAOS_PARTITION_FOR_MS", 0)) * time.Millisecond,
+		RedisDialTimeout:          time.Duration(envOrDefaultInt("REDIS_DIAL_TIMEOUT_MS", 500)) * time.Millisecond,
+		RedisReadTimeout:          time.Duration(envOrDefaultInt("REDIS_READ_TIMEOUT_MS", 200)) * time.Millisecond,
+		RedisWriteTimeout:         time.Duration(envOrDefaultInt("REDIS_WRITE_TIMEOUT_MS", 200)) * time.Millisecond,
 	}
 }
 
+// Dev relaxes c for local development against an embedded Redis: one
+// small pool, no cluster or adaptive sizing, generous timeouts for
+// debuggers, and admin changes that show up within a second.
+func (c *Config) Dev() {
+	c.RedisClusterAddrs = ""
+	c.RedisPoolSize = 10
+	c.RedisMinIdleConns = 1
+	c.RedisPoolMax = 0
+	c.WarmupEvals = 1
+	c.TenantRefreshInterval = time.Second
+	c.BoostRefreshInterval = time.Second
+	c.TraceRefreshInterval = time.Second
+	c.DenylistRefreshInterval = time.Second
+	c.MaintenanceInterval = time.Second
+	c.UsageFlushInterval = time.Second
+	c.RedisDialTimeout = 5 * time.Second
+	c.RedisReadTimeout = 5 * time.Second
+	c.RedisWriteTimeout = 5 * time.Second
+}
+
 func envOrDefault(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -70,4 +362,13 @@ func envOrDefaultFloat(key string, fallback float64) float64 {
 		}
 	}
 	return fallback
+}
+
+func envOrDefaultBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
 }
\ No newline at end of file
@@ -0,0 +1,211 @@
+// Package denylist rejects every request on listed bucket keys, e.g. IPs
+// or identities from threat intelligence feeds, until their entries expire.
+package denylist
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKey is the sorted set of denied bucket keys, scored by the Unix
+// time their entry expires at (0 = never).
+const redisKey = "ratelimiter:denylist"
+
+// Entry denies a bucket key (limiter.Key) until ExpiresAt, or for good
+// when it's zero.
+type Entry struct {
+	Key       string
+	ExpiresAt time.Time
+}
+
+func (e Entry) active(now time.Time) bool {
+	return e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)
+}
+
+func (e Entry) score() float64 {
+	if e.ExpiresAt.IsZero() {
+		return 0
+	}
+	return float64(e.ExpiresAt.Unix())
+}
+
+// Set stores the denylist in Redis, so it holds on every replica, and
+// serves lookups from an in-process cache. A nil Set denies nothing.
+type Set struct {
+	rdb *redis.Client
+
+	// n is the count of cached entries, so an empty denylist costs no
+	// lock on the decision path.
+	n       atomic.Int64
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// New creates an empty Set. Call Refresh to populate it.
+func New(rdb *redis.Client) *Set {
+	return &Set{rdb: rdb, entries: map[string]time.Time{}}
+}
+
+// Denied reports whether key has an active entry.
+func (s *Set) Denied(key string) bool {
+	if s == nil || s.n.Load() == 0 {
+		return false
+	}
+	s.mu.RLock()
+	expires, ok := s.entries[key]
+	s.mu.RUnlock()
+	return ok && (Entry{Key: key, ExpiresAt: expires}).active(time.Now())
+}
+
+// Len returns the number of cached entries.
+func (s *Set) Len() int {
+	return int(s.n.Load())
+}
+
+// Add creates or replaces entries in one round trip. It returns how many
+// keys weren't listed before.
+func (s *Set) Add(ctx context.Context, entries []Entry) (int64, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	members := make([]redis.Z, len(entries))
+	for i, e := range entries {
+		members[i] = redis.Z{Score: e.score(), Member: e.Key}
+	}
+	added, err := s.rdb.ZAdd(ctx, redisKey, members...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis zadd: %w", err)
+	}
+	s.mu.Lock()
+	for _, e := range entries {
+		s.entries[e.Key] = e.ExpiresAt
+	}
+	s.n.Store(int64(len(s.entries)))
+	s.mu.Unlock()
+	return added, nil
+}
+
+// Remove deletes the entries of keys. It returns how many existed.
+func (s *Set) Remove(ctx context.Context, keys []string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	members := make([]any, len(keys))
+	for i, k := range keys {
+		members[i] = k
+	}
+	removed, err := s.rdb.ZRem(ctx, redisKey, members...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis zrem: %w", err)
+	}
+	s.mu.Lock()
+	for _, k := range keys {
+		delete(s.entries, k)
+	}
+	s.n.Store(int64(len(s.entries)))
+	s.mu.Unlock()
+	return removed, nil
+}
+
+// Refresh deletes expired entries and reloads the cache from Redis.
+func (s *Set) Refresh(ctx context.Context) error {
+	now := time.Now()
+	until := strconv.FormatInt(now.Unix(), 10)
+	if err := s.rdb.ZRemRangeByScore(ctx, redisKey, "(0", until).Err(); err != nil {
+		log.Printf("failed to purge expired denylist entries: %v", err)
+	}
+	raw, err := s.rdb.ZRangeWithScores(ctx, redisKey, 0, -1).Result()
+	if err != nil {
+		return fmt.Errorf("redis zrange: %w", err)
+	}
+
+	entries := make(map[string]time.Time, len(raw))
+	for _, z := range raw {
+		var expires time.Time
+		if z.Score > 0 {
+			expires = time.Unix(int64(z.Score), 0)
+		}
+		entries[z.Member.(string)] = expires
+	}
+	s.mu.Lock()
+	s.entries = entries
+	s.n.Store(int64(len(entries)))
+	s.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the cache every interval until ctx is cancelled.
+func (s *Set) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.Printf("denylist refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// Parse reads a denylist file: one key per line, optionally followed by
+// when its entry expires, as an RFC 3339 time or a duration from now such
+// as 72h. Entries without one expire after ttl (0 = never). Blank lines
+// and lines starting with # are skipped, as are entries already expired.
+// Keys are returned as listed, without a namespace.
+func Parse(r io.Reader, ttl time.Duration, now time.Time) ([]Entry, error) {
+	var entries []Entry
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		e := Entry{Key: fields[0]}
+		switch len(fields) {
+		case 1:
+			if ttl > 0 {
+				e.ExpiresAt = now.Add(ttl)
+			}
+		case 2:
+			expires, err := parseExpiry(fields[1], now)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			e.ExpiresAt = expires
+		default:
+			return nil, fmt.Errorf("line %d: want a key and an optional expiry, got %d fields", line, len(fields))
+		}
+		if e.active(now) {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("expiry %q is neither an RFC 3339 time nor a positive duration", s)
+	}
+	return now.Add(d), nil
+}
\ No newline at end of file
@@ -0,0 +1,75 @@
+package denylist
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	s := New(rdb)
+	assert.False(t, s.Denied("ip:10.0.0.1"))
+	added, err := s.Add(ctx, []Entry{
+		{Key: "ip:10.0.0.1"},
+		{Key: "{acme}:user:1", ExpiresAt: time.Now().Add(time.Hour)},
+		{Key: "ip:10.0.0.2", ExpiresAt: time.Now().Add(-time.Second)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), added)
+	assert.True(t, s.Denied("ip:10.0.0.1"))
+	assert.True(t, s.Denied("{acme}:user:1"))
+	assert.False(t, s.Denied("ip:10.0.0.2"), "expired")
+
+	// Other replicas pick the entries up from Redis
+	other := New(rdb)
+	require.NoError(t, other.Refresh(ctx))
+	assert.True(t, other.Denied("ip:10.0.0.1"))
+	assert.Equal(t, 2, other.Len())
+	members, err := mr.ZMembers(redisKey)
+	require.NoError(t, err)
+	assert.NotContains(t, members, "ip:10.0.0.2", "expired entries are purged")
+
+	removed, err := other.Remove(ctx, []string{"ip:10.0.0.1", "ip:10.0.0.3"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed)
+	assert.False(t, other.Denied("ip:10.0.0.1"))
+
+	var nilSet *Set
+	assert.False(t, nilSet.Denied("ip:10.0.0.1"))
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries, err := Parse(strings.NewReader(`
+# feed 2024-05-01
+ip:10.0.0.1
+ip:10.0.0.2  72h
+ip:10.0.0.3 2024-06-01T00:00:00Z
+ip:10.0.0.4 2024-04-01T00:00:00Z
+`), 24*time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{
+		{Key: "ip:10.0.0.1", ExpiresAt: now.Add(24 * time.Hour)},
+		{Key: "ip:10.0.0.2", ExpiresAt: now.Add(72 * time.Hour)},
+		{Key: "ip:10.0.0.3", ExpiresAt: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}, entries, "expired entries are skipped")
+
+	entries, err = Parse(strings.NewReader("ip:10.0.0.1\n"), 0, now)
+	require.NoError(t, err)
+	assert.True(t, entries[0].ExpiresAt.IsZero(), "no ttl: never expires")
+
+	for _, in := range []string{"ip:10.0.0.1 soon", "ip:10.0.0.1 -1h", "ip:10.0.0.1 1h extra"} {
+		_, err := Parse(strings.NewReader(in), 0, now)
+		assert.ErrorContains(t, err, "line 1", in)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,53 @@
+// Package devredis runs an in-memory Redis inside the server for local
+// development, so the whole API works without any dependencies. State is
+// lost on exit.
+package devredis
+
+import (
+	"context"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// Server is an embedded Redis listening on a local port.
+type Server struct {
+	mr *miniredis.Miniredis
+}
+
+// Start starts an empty Server on a free local port.
+func Start() (*Server, error) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		return nil, err
+	}
+	return &Server{mr: mr}, nil
+}
+
+// Addr returns the address clients connect to.
+func (s *Server) Addr() string {
+	return s.mr.Addr()
+}
+
+// Close stops the server and drops its data.
+func (s *Server) Close() {
+	s.mr.Close()
+}
+
+// Run expires keys every interval until ctx is done. The embedded Redis
+// only counts TTLs down when told to, so without it idle buckets and
+// finished quota periods would never go away.
+func (s *Server) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mr.FastForward(now.Sub(last))
+			last = now
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,41 @@
+package devredis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+func TestServer(t *testing.T) {
+	s, err := Start()
+	require.NoError(t, err)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx, 10*time.Millisecond)
+
+	rdb := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer rdb.Close()
+
+	// The limiter's scripts run as they do on Redis
+	tb := limiter.New(rdb, 1, 1)
+	res, err := tb.Allow(ctx, "dev", 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = tb.Allow(ctx, "dev", 1, 0, 0)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// Keys expire in real time
+	require.NoError(t, rdb.Set(ctx, "short", "x", 50*time.Millisecond).Err())
+	assert.Eventually(t, func() bool {
+		return rdb.Exists(ctx, "short").Val() == 0
+	}, time.Second, 10*time.Millisecond)
+}
\ No newline at end of file
@@ -0,0 +1,124 @@
+// Package diag gathers the server's internal state into one JSON snapshot,
+// dumped on SIGUSR1 or through the AdminService, for a quick picture of a
+// replica during an incident.
+package diag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Source returns one section of a snapshot, encoded as JSON.
+type Source func(ctx context.Context) any
+
+// Runtime is the Go runtime section every snapshot has.
+type Runtime struct {
+	Goroutines int    `json:"goroutines"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapObjs   uint64 `json:"heap_objects"`
+	Sys        uint64 `json:"sys_bytes"`
+	NumGC      uint32 `json:"gc_cycles"`
+	PauseTotal int64  `json:"gc_pause_total_ns"`
+}
+
+// Dumper takes snapshots of the sections added to it.
+type Dumper struct {
+	dir   string
+	start time.Time
+
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// New creates a Dumper writing dumps to files in dir, or to the log when
+// dir is empty.
+func New(dir string) *Dumper {
+	return &Dumper{dir: dir, start: time.Now(), sources: map[string]Source{}}
+}
+
+// Add adds the section name to snapshots, replacing any of that name.
+func (d *Dumper) Add(name string, src Source) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sources[name] = src
+}
+
+// Snapshot returns the JSON of every section, with the time, the uptime
+// and the Go runtime's counters. A section that panics is reported as its
+// error instead.
+func (d *Dumper) Snapshot(ctx context.Context) ([]byte, error) {
+	d.mu.Lock()
+	sources := make(map[string]Source, len(d.sources))
+	for name, src := range d.sources {
+		sources[name] = src
+	}
+	d.mu.Unlock()
+
+	now := time.Now()
+	snap := map[string]any{
+		"time":           now.UTC(),
+		"uptime_seconds": int64(now.Sub(d.start).Seconds()),
+		"runtime":        readRuntime(),
+	}
+	for name, src := range sources {
+		snap[name] = section(ctx, src)
+	}
+	return json.MarshalIndent(snap, "", "  ") // map keys come out sorted
+}
+
+// section runs src, recovering a panic into an error section so one
+// broken source doesn't lose the rest of the dump.
+func section(ctx context.Context, src Source) (v any) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = map[string]string{"error": fmt.Sprint(r)}
+		}
+	}()
+	return src(ctx)
+}
+
+func readRuntime() Runtime {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return Runtime{
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		HeapAlloc:  m.HeapAlloc,
+		HeapObjs:   m.HeapObjects,
+		Sys:        m.Sys,
+		NumGC:      m.NumGC,
+		PauseTotal: int64(m.PauseTotalNs),
+	}
+}
+
+// Dump takes a snapshot and saves it.
+func (d *Dumper) Dump(ctx context.Context) (string, error) {
+	b, err := d.Snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	return d.Save(b)
+}
+
+// Save writes the snapshot b to a new file in the Dumper's directory and
+// returns its path, or logs it when there's no directory.
+func (d *Dumper) Save(b []byte) (string, error) {
+	if d.dir == "" {
+		log.Printf("diagnostics: %s", b)
+		return "", nil
+	}
+	path := filepath.Join(d.dir, "ratelimiter-diag-"+time.Now().UTC().Format("20060102T150405.000Z")+".json")
+	if err := os.WriteFile(path, append(b, '\n'), 0o600); err != nil {
+		return "", err
+	}
+	log.Printf("diagnostics written to %s", path)
+	return path, nil
+}
\ No newline at end of file
@@ -0,0 +1,32 @@
+package diag
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	d := New(t.TempDir())
+	d.Add("rules", func(context.Context) any { return map[string]int{"count": 3} })
+	d.Add("broken", func(context.Context) any { panic("nil map") })
+
+	path, err := d.Dump(context.Background())
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var snap struct {
+		Runtime Runtime           `json:"runtime"`
+		Rules   map[string]int    `json:"rules"`
+		Broken  map[string]string `json:"broken"`
+	}
+	require.NoError(t, json.Unmarshal(b, &snap))
+	assert.Positive(t, snap.Runtime.Goroutines)
+	assert.Equal(t, 3, snap.Rules["count"])
+	assert.Equal(t, "nil map", snap.Broken["error"])
+}
\ No newline at end of file
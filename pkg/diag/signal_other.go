@@ -0,0 +1,8 @@
+//go:build !unix
+
+package diag
+
+import "context"
+
+// Notify does nothing on platforms without SIGUSR1; use the AdminService.
+func (d *Dumper) Notify(ctx context.Context) {}
\ No newline at end of file
@@ -0,0 +1,31 @@
+//go:build unix
+
+package diag
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Notify dumps a snapshot on every SIGUSR1 until ctx is cancelled.
+func (d *Dumper) Notify(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			dumpCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			if _, err := d.Dump(dumpCtx); err != nil {
+				log.Printf("diagnostics dump failed: %v", err)
+			}
+			cancel()
+		}
+	}
+}
\ No newline at end of file
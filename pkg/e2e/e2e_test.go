@@ -0,0 +1,1562 @@
+// Package e2e runs the real gRPC services, with the interceptors the server
+// chains, over an in-memory connection to an embedded Redis.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/anomaly"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/apiquota"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/auth"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/chaos"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/denylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/diag"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keynorm"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keytrace"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/loglevel"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/maintenance"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/scheduler"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/server"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// setup configures the server under test. The zero value is a server
+// without rules, request signing or runtime faults.
+type setup struct {
+	rules string
+	keys  auth.Keys
+	// admins of keys may call the AdminService
+	admins []string
+	quotas *apiquota.Config
+	faults bool
+	// normalizers rewrite keys before they're limited
+	normalizers []string
+	// returns is how long leased tokens can be given back, 0 to refuse
+	// returns
+	returns     time.Duration
+	idempotency time.Duration
+	// queue bounds the requests Enqueue queues per key, 0 to refuse them
+	queue int64
+	// scripts pins the sources ReloadScript accepts, "" to refuse reloads
+	scripts string
+	// namespace is the default namespace of both services
+	namespace string
+	// sched schedules Redis calls fairly between tenants when set
+	sched *scheduler.Fair
+	// anomalies serves the anomaly detector's audit records
+	anomalies bool
+}
+
+type env struct {
+	rdb         *redis.Client
+	lis         *bufconn.Listener
+	rl          pb.RateLimitServiceClient
+	admin       pb.AdminServiceClient
+	usage       *usage.Recorder
+	clientUsage *usage.Recorder
+	prefixUsage *usage.PrefixRecorder
+}
+
+// start serves both services on an in-memory listener. Buckets hold 3
+// tokens and practically don't refill unless a request says otherwise.
+func start(t *testing.T, s setup) *env {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	var faults *chaos.Hook
+	if s.faults {
+		faults = chaos.New(chaos.Config{})
+		rdb.AddHook(faults)
+	}
+	var ruleSet *rules.Set
+	if s.rules != "" {
+		var err error
+		ruleSet, err = rules.Parse([]byte(s.rules))
+		require.NoError(t, err)
+	}
+
+	tb := limiter.New(rdb, 3, 0.001)
+	tenants := tenant.NewRegistry(rdb)
+	boosts := boost.NewRegistry(rdb)
+	maint := maintenance.New(rdb)
+	traces := keytrace.NewRegistry(rdb)
+	deny := denylist.New(rdb)
+	history := keytrace.NewHistory(rdb, 10, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go history.Run(ctx)
+	e := &env{rdb: rdb, usage: usage.NewRecorder(rdb, 24*time.Hour), prefixUsage: usage.NewPrefixRecorder(rdb, 24*time.Hour)}
+
+	interceptors := []grpc.UnaryServerInterceptor{grpcprom.UnaryServerInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{grpcprom.StreamServerInterceptor}
+	if s.keys != nil {
+		verifier := auth.NewVerifier(s.keys, time.Minute, pb.RateLimitService_HealthCheck_FullMethodName)
+		verifier.Restrict(s.admins, pb.AdminService_ServiceDesc.ServiceName)
+		e.clientUsage = usage.NewClientRecorder(rdb, 24*time.Hour)
+		enforcer := apiquota.NewEnforcer(tb, s.quotas, e.clientUsage, pb.RateLimitService_HealthCheck_FullMethodName)
+		interceptors = append(interceptors, verifier.UnaryServerInterceptor, enforcer.UnaryServerInterceptor)
+		streamInterceptors = append(streamInterceptors, verifier.StreamServerInterceptor, enforcer.StreamServerInterceptor)
+	}
+	norm, err := keynorm.New(s.normalizers)
+	require.NoError(t, err)
+	opts := []server.Option{
+		server.WithRules(ruleSet),
+		server.WithTenants(tenants),
+		server.WithUsage(e.usage),
+		server.WithPrefixUsage(e.prefixUsage),
+		server.WithBoosts(boosts),
+		server.WithKeyTraces(traces),
+		server.WithDecisionHistory(history),
+		server.WithDenylist(deny),
+		server.WithMaintenance(maint),
+		server.WithKeyNormalizer(norm),
+	}
+	if s.returns > 0 {
+		opts = append(opts, server.WithTokenReturns(s.returns))
+	}
+	if s.idempotency > 0 {
+		opts = append(opts, server.WithIdempotency(s.idempotency))
+	}
+	if s.queue > 0 {
+		opts = append(opts, server.WithQueue(s.queue, time.Second))
+	}
+	if s.namespace != "" {
+		opts = append(opts, server.WithDefaultNamespace(s.namespace))
+	}
+	if s.sched != nil {
+		opts = append(opts, server.WithScheduler(s.sched))
+	}
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		grpc.ForceServerCodec(server.Codec{}),
+	)
+	pb.RegisterRateLimitServiceServer(srv, server.NewRateLimitServer(tb, opts...))
+	dumper := diag.New("")
+	dumper.Add("limiter", func(context.Context) any { return tb.Diagnostics() })
+	adminOpts := []server.AdminOption{server.WithAdminDefaultNamespace(s.namespace)}
+	if s.scripts != "" {
+		adminOpts = append(adminOpts, server.WithScriptReloads(s.scripts))
+	}
+	if s.anomalies {
+		adminOpts = append(adminOpts, server.WithAnomalyAudit(rdb))
+	}
+	pb.RegisterAdminServiceServer(srv, server.NewAdminServer(tb, tenants, e.usage, boosts, e.clientUsage, faults, maint, loglevel.New(loglevel.Info), ruleSet, e.prefixUsage, dumper, traces, history, deny, adminOpts...))
+
+	e.lis = bufconn.Listen(1 << 20)
+	go srv.Serve(e.lis)
+	t.Cleanup(srv.Stop)
+
+	conn := e.dial(t)
+	e.rl = pb.NewRateLimitServiceClient(conn)
+	e.admin = pb.NewAdminServiceClient(conn)
+	return e
+}
+
+// dial opens a new client connection to the server.
+func (e *env) dial(t *testing.T, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return e.lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func requireCode(t *testing.T, want codes.Code, err error) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, want, status.Code(err), "%v", err)
+}
+
+func TestAllow(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: search
+    burst: 2
+    max_burst: 5
+    overrides: reject
+`})
+	ctx := context.Background()
+
+	for i := int64(2); i >= 0; i-- {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, int64(3), res.Limit)
+	}
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, 0.0)
+
+	// Client overrides, prefix rule defaults and their bounds
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:2", Tokens: 4, Burst: 10})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(10), res.Limit)
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "search:1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Limit)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "search:1", Burst: 50})
+	requireCode(t, codes.InvalidArgument, err)
+
+	// Keys can't reach into the reserved key space
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "{other}:1"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "a{b}", Key: "1"})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestWindows(t *testing.T) {
+	now := time.Now().UTC()
+	clock := func(d time.Duration) string { return now.Add(d).Format("15:04") }
+	e := start(t, setup{rules: `
+windows:
+  - name: import
+    prefixes: [import]
+    start: "` + clock(-time.Hour) + `"
+    end: "` + clock(time.Hour) + `"
+    multiplier: 4
+  - name: later
+    prefixes: ["*"]
+    start: "` + clock(2*time.Hour) + `"
+    end: "` + clock(3*time.Hour) + `"
+    multiplier: 4
+`})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "import:1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), res.Limit)
+	assert.Equal(t, []string{"window:import"}, res.Reasons)
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Limit)
+	assert.Empty(t, res.Reasons)
+}
+
+func TestClient(t *testing.T) {
+	e := start(t, setup{})
+	c := client.New(e.dial(t), client.WithNamespace("shop"))
+	ctx := context.Background()
+
+	res, err := c.Allow(ctx, "cart", 3)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = c.Allow(ctx, "cart", 1)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+
+	res, err = c.Peek(ctx, "cart")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), res.Limit)
+	res, err = c.PeekTokens(ctx, "cart", 2)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Second)
+
+	// The namespace keeps the buckets apart
+	res, err = client.New(e.dial(t)).Allow(ctx, "cart", 1)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestNamedBuckets(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    buckets:
+      read: {burst: 5}
+      write: {burst: 1}
+`})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Bucket: "write"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(1), res.Limit)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Bucket: "write"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// The key's other buckets are untouched
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Bucket: "read"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(4), res.Remaining)
+	st, err := e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Key: "api:acme"})
+	require.NoError(t, err)
+	assert.False(t, st.Exists)
+	peek, err := e.rl.Peek(ctx, &pb.PeekRequest{Key: "api:acme", Bucket: "read"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), peek.Limit)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Bucket: "delete"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Bucket: "read"})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestChain(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    burst: 10
+    rate: 10
+    chain:
+      - {name: minute, burst: 3, rate: 0.05}
+  - prefix: job
+    burst: 10
+    rate: 10
+    chain:
+      - {name: day, quota: 2, period: 24h}
+  - prefix: feed
+    chain:
+      - {name: hour, quota: 1, period: 1h, sub_windows: 60}
+`})
+	ctx := context.Background()
+
+	// The strictest link decides, admitted or not
+	for i := 0; i < 3; i++ {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "request %d", i)
+		assert.Equal(t, "minute", res.Binding)
+		assert.Equal(t, int64(3), res.Limit)
+		assert.Equal(t, int64(2-i), res.Remaining)
+	}
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "minute", res.Binding)
+	assert.Greater(t, res.RetryAfter, 10.0)
+
+	for i := 0; i < 2; i++ {
+		res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "job:acme"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "request %d", i)
+		assert.Equal(t, "day", res.Binding)
+		assert.Equal(t, int64(1-i), res.Remaining)
+	}
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "job:acme"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "day", res.Binding)
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "feed:acme"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "feed:acme"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, "hour", res.Binding)
+	assert.Greater(t, res.RetryAfter, 3500.0)
+
+	// Keys of other rules have no chain
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Binding)
+}
+
+func TestSoftLimit(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    burst: 4
+    rate: 0.01
+    soft_limit: 0.5
+`})
+	c := client.New(e.dial(t))
+	ctx := context.Background()
+
+	res, err := c.Allow(ctx, "api:acme", 1)
+	require.NoError(t, err)
+	assert.False(t, res.Warning)
+	assert.Empty(t, res.Reasons)
+	for i := 0; i < 2; i++ {
+		res, err = c.Allow(ctx, "api:acme", 1)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.True(t, res.Warning, "request %d", i)
+		assert.Equal(t, []string{"soft_limit"}, res.Reasons)
+	}
+	res, err = c.Allow(ctx, "api:acme", 2)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.False(t, res.Warning, "denials carry no warning")
+}
+
+func TestCooldown(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    burst: 2
+    rate: 100
+    cooldown: 1h
+`})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "request %d", i)
+	}
+
+	// Refilled by now, but the bucket ran dry
+	time.Sleep(50 * time.Millisecond)
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, []string{"cooldown"}, res.Reasons)
+	assert.Greater(t, res.RetryAfter, 3500.0)
+
+	// Other keys are unaffected
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:other"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Empty(t, res.Reasons)
+}
+
+func TestSpacing(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    burst: 10
+    rate: 100
+    spacing: 1h
+`})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// Plenty of tokens left, but too soon after the last request
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, []string{"spacing"}, res.Reasons)
+	assert.Greater(t, res.RetryAfter, 3500.0)
+
+	// Other keys are unaffected
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:other"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Empty(t, res.Reasons)
+}
+
+func TestMaxTokens(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: api
+    burst: 10
+    max_tokens: 5
+`})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Tokens: 5})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Tokens: 6})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:acme", Cost: 5.5})
+	requireCode(t, codes.InvalidArgument, err)
+
+	batch, err := e.rl.BatchAllow(ctx, &pb.BatchAllowRequest{Requests: []*pb.AllowRequest{
+		{Key: "api:acme", Tokens: 100},
+		{Key: "user:1", Tokens: 100},
+	}})
+	require.NoError(t, err)
+	require.NotNil(t, batch.Results[0].Error)
+	assert.Equal(t, int32(codes.InvalidArgument), batch.Results[0].Error.Code)
+	assert.Nil(t, batch.Results[1].Error, "other prefixes are uncapped")
+}
+
+func TestSubnet(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: ip
+    subnet: {burst: 4, rate: 0.001}
+`})
+	ctx := context.Background()
+
+	for _, key := range []string{"ip:203.0.113.1", "ip:203.0.113.2", "ip:203.0.113.3", "ip:203.0.113.4"} {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: key})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, key)
+	}
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:203.0.113.5"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "the /24 ran dry")
+	assert.Equal(t, "subnet", res.Binding)
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:203.0.114.5"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "other networks have their own bucket")
+	assert.Empty(t, res.Binding)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:proxy"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "keys that aren't addresses aren't aggregated")
+
+	// Outside a namespace, the network's bucket is charged apart from the
+	// key's, and refunded when the key's denies the request
+	for _, ns := range []string{"", "acme"} {
+		res, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: ns, Key: "ip:198.51.100.1", Tokens: 3})
+		require.NoError(t, err)
+		require.True(t, res.Allowed, ns)
+		res, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: ns, Key: "ip:198.51.100.1"})
+		require.NoError(t, err)
+		assert.False(t, res.Allowed, ns)
+		assert.Empty(t, res.Binding, ns)
+		res, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: ns, Key: "ip:198.51.100.2"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "%q: the denial took from the /24", ns)
+		assert.Equal(t, "subnet", res.Binding, ns)
+		res, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: ns, Key: "ip:198.51.100.3"})
+		require.NoError(t, err)
+		assert.False(t, res.Allowed, ns)
+		assert.Equal(t, "subnet", res.Binding, ns)
+	}
+}
+
+func TestKeyNormalization(t *testing.T) {
+	e := start(t, setup{normalizers: []string{"trim", "lower", "port"}})
+	ctx := context.Background()
+
+	for _, key := range []string{"user:42", " User:42", "USER:42\n"} {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: key})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, key)
+	}
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:42"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "all spellings share one bucket")
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:10.0.0.1:52113"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Remaining)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:10.0.0.1:40022"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Remaining, "ports are dropped")
+}
+
+func TestReturnTokens(t *testing.T) {
+	ctx := context.Background()
+	_, err := start(t, setup{}).rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 1, Lease: "x"})
+	requireCode(t, codes.FailedPrecondition, err)
+
+	e := start(t, setup{returns: time.Minute})
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Lease: "x"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 1})
+	requireCode(t, codes.InvalidArgument, err)
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Tokens: 1})
+	require.NoError(t, err)
+	assert.Empty(t, res.Lease, "only given when asked for")
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Tokens: 2, Lease: true})
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+	require.NotEmpty(t, res.Lease)
+	lease := res.Lease
+
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 1, Lease: "unknown"})
+	requireCode(t, codes.NotFound, err)
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:2", Tokens: 1, Lease: lease})
+	requireCode(t, codes.NotFound, err) // leases are per key
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Namespace: "acme", Tokens: 1, Lease: lease})
+	requireCode(t, codes.NotFound, err) // and per namespace
+
+	ret, err := e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 1, Lease: lease})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, ret.Returned)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Tokens: 1})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "returned tokens can be spent again")
+
+	ret, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 10, Lease: lease})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, ret.Returned, "capped at what's left of the lease")
+	res, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Remaining)
+	_, err = e.rl.ReturnTokens(ctx, &pb.ReturnTokensRequest{Key: "user:1", Tokens: 1, Lease: lease})
+	requireCode(t, codes.NotFound, err) // spent leases are forgotten
+}
+
+func TestRequestID(t *testing.T) {
+	e := start(t, setup{idempotency: time.Minute})
+	ctx := context.Background()
+
+	first, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Tokens: 2, RequestId: "req-1"})
+	require.NoError(t, err)
+	require.True(t, first.Allowed)
+	retry, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Tokens: 2, RequestId: "req-1"})
+	require.NoError(t, err)
+	assert.True(t, retry.Allowed)
+	assert.Equal(t, first.Remaining, retry.Remaining)
+	assert.Equal(t, []string{"replayed"}, retry.Reasons)
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "the retry wasn't charged")
+	assert.Equal(t, int64(0), res.Remaining)
+
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", Namespace: "shop", RequestId: "req-1"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Reasons, "IDs are per namespace")
+	// and per key: another key's request with the same ID is charged
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:3", Tokens: 2, RequestId: "req-1"})
+	require.NoError(t, err)
+	assert.Empty(t, res.Reasons)
+	assert.Equal(t, int64(1), res.Remaining)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1", RequestId: "req-1"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"replayed"}, res.Reasons, "user:1 keeps its own response")
+	assert.Equal(t, first.Remaining, res.Remaining)
+
+	c := client.New(e.dial(t))
+	r, err := c.AllowOnce(ctx, "user:2", 3, "req-2")
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+	r, err = c.AllowOnce(ctx, "user:2", 3, "req-2")
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+}
+
+// admitted reads queue events until the one carrying the response.
+func admitted(t *testing.T, events interface {
+	Recv() (*pb.QueueEvent, error)
+}) *pb.AllowResponse {
+	t.Helper()
+	for {
+		ev, err := events.Recv()
+		require.NoError(t, err)
+		if ev.Response != nil {
+			return ev.Response
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	e := start(t, setup{queue: 2, rules: `
+rules:
+  - prefix: batch
+    burst: 1
+    rate: 4
+`})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "batch:1"})
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	first, err := e.rl.Enqueue(ctx, &pb.AllowRequest{Key: "batch:1"})
+	require.NoError(t, err)
+	ev, err := first.Recv()
+	require.NoError(t, err)
+	require.NotEmpty(t, ev.Ticket)
+	assert.Equal(t, int64(0), ev.Position)
+	ticket := ev.Ticket
+
+	second, err := e.rl.Enqueue(ctx, &pb.AllowRequest{Key: "batch:1"})
+	require.NoError(t, err)
+	ev, err = second.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), ev.Position)
+
+	full, err := e.rl.Enqueue(ctx, &pb.AllowRequest{Key: "batch:1"})
+	require.NoError(t, err)
+	_, err = full.Recv()
+	requireCode(t, codes.ResourceExhausted, err)
+
+	// Admitted in order as the bucket refills
+	resp := admitted(t, first)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, []string{"queued"}, resp.Reasons)
+	assert.True(t, admitted(t, second).Allowed)
+
+	// Tickets replay their response, for a while
+	watch, err := e.rl.WatchTicket(ctx, &pb.WatchTicketRequest{Ticket: ticket})
+	require.NoError(t, err)
+	assert.True(t, admitted(t, watch).Allowed)
+	watch, err = e.rl.WatchTicket(ctx, &pb.WatchTicketRequest{Ticket: "nope"})
+	require.NoError(t, err)
+	_, err = watch.Recv()
+	requireCode(t, codes.NotFound, err)
+
+	var tickets []string
+	r, err := client.New(e.dial(t)).AllowQueued(ctx, "batch:2", 1, func(ticket string, _ int64) {
+		tickets = append(tickets, ticket)
+	})
+	require.NoError(t, err)
+	assert.True(t, r.Allowed)
+	assert.Len(t, tickets, 1)
+}
+
+func TestFractionalCost(t *testing.T) {
+	e := start(t, setup{})
+	c := client.New(e.dial(t))
+	ctx := context.Background()
+
+	// 3 tokens cover six half-token requests
+	for i := 0; i < 6; i++ {
+		res, err := c.AllowCost(ctx, "cached", 0.5)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed, "request %d", i)
+	}
+	res, err := c.AllowCost(ctx, "cached", 0.5)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// Cost takes precedence over tokens
+	resp, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "weighted", Tokens: 1, Cost: 2.7})
+	require.NoError(t, err)
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, int64(0), resp.Remaining)
+	resp, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "weighted", Cost: 0.3})
+	require.NoError(t, err)
+	assert.True(t, resp.Allowed)
+	resp, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "weighted", Cost: 0.1})
+	require.NoError(t, err)
+	assert.False(t, resp.Allowed)
+}
+
+func TestPeekTokens(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "job", Tokens: 8, Burst: 10, Rate: 2})
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	peek, err := e.rl.Peek(ctx, &pb.PeekRequest{Key: "job", Burst: 10, Rate: 2, Tokens: 6})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), peek.Limit, "overrides apply")
+	assert.False(t, peek.Allowed)
+	assert.InDelta(t, 2.0, peek.RetryAfter, 0.1, "4 tokens at 2/s")
+
+	_, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "never"})
+	require.NoError(t, err)
+	st, err := e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Key: "never"})
+	require.NoError(t, err)
+	assert.False(t, st.Exists, "peeks don't create buckets")
+
+	peeks, err := e.rl.BatchPeek(ctx, &pb.BatchPeekRequest{Requests: []*pb.PeekRequest{
+		{Key: "job", Burst: 10, Rate: 2},
+		{Key: "idle", Tokens: 4},
+	}})
+	require.NoError(t, err)
+	assert.True(t, peeks.Results[0].Response.Allowed)
+	assert.Zero(t, peeks.Results[0].Response.RetryAfter)
+	assert.False(t, peeks.Results[1].Response.Allowed, "more than the burst")
+
+	// Costs take precedence over tokens, as in Allow
+	peek, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "job", Burst: 10, Rate: 2, Tokens: 1, Cost: 2.5})
+	require.NoError(t, err)
+	assert.False(t, peek.Allowed)
+	assert.Greater(t, peek.RetryAfter, 0.0)
+	peek, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "job", Burst: 10, Rate: 2, Tokens: 3, Cost: 1.5})
+	require.NoError(t, err)
+	assert.True(t, peek.Allowed)
+	peeks, err = e.rl.BatchPeek(ctx, &pb.BatchPeekRequest{Requests: []*pb.PeekRequest{
+		{Key: "job", Burst: 10, Rate: 2, Tokens: 1, Cost: 2.5},
+		{Key: "job", Burst: 10, Rate: 2, Tokens: 3, Cost: 1.5},
+	}})
+	require.NoError(t, err)
+	assert.False(t, peeks.Results[0].Response.Allowed)
+	assert.True(t, peeks.Results[1].Response.Allowed)
+}
+
+func TestBatch(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	resp, err := e.rl.BatchAllow(ctx, &pb.BatchAllowRequest{Requests: []*pb.AllowRequest{
+		{Key: "a", Tokens: 3},
+		{Key: "{bad}"},
+		{Key: "a"},
+		{Key: "b"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 4)
+	assert.True(t, resp.Results[0].Response.Allowed)
+	assert.Equal(t, int32(codes.InvalidArgument), resp.Results[1].Error.Code)
+	assert.False(t, resp.Results[2].Response.Allowed)
+	assert.True(t, resp.Results[3].Response.Allowed)
+
+	peeks, err := e.rl.BatchPeek(ctx, &pb.BatchPeekRequest{Requests: []*pb.PeekRequest{{Key: "a"}, {Key: "b"}}})
+	require.NoError(t, err)
+	require.Len(t, peeks.Results, 2)
+	assert.Equal(t, int64(0), peeks.Results[0].Response.Remaining)
+	assert.Equal(t, int64(3), peeks.Results[1].Response.Limit)
+
+	_, err = e.rl.BatchAllow(ctx, &pb.BatchAllowRequest{Requests: make([]*pb.AllowRequest, 1001)})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestBatch_Scheduled(t *testing.T) {
+	// One slot: each namespace's items take it in turn
+	e := start(t, setup{sched: scheduler.NewFair(1, nil)})
+	ctx := context.Background()
+
+	resp, err := e.rl.BatchAllow(ctx, &pb.BatchAllowRequest{Requests: []*pb.AllowRequest{
+		{Namespace: "acme", Key: "a", Tokens: 3},
+		{Namespace: "shop", Key: "a", Tokens: 2},
+		{Key: "user:1"},
+		{Namespace: "acme", Key: "a"},
+		{Namespace: "shop", Key: "a"},
+		{Namespace: "{bad}", Key: "a"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 6)
+	assert.True(t, resp.Results[0].Response.Allowed)
+	assert.Equal(t, int64(1), resp.Results[1].Response.Remaining)
+	assert.True(t, resp.Results[2].Response.Allowed)
+	assert.False(t, resp.Results[3].Response.Allowed)
+	assert.Equal(t, int64(0), resp.Results[4].Response.Remaining)
+	assert.Equal(t, int32(codes.InvalidArgument), resp.Results[5].Error.Code)
+}
+
+func TestHealthCheck(t *testing.T) {
+	e := start(t, setup{faults: true})
+	ctx := context.Background()
+
+	res, err := e.rl.HealthCheck(ctx, &pb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, pb.HealthCheckResponse_SERVING, res.Status)
+	assert.Equal(t, "ok", res.RedisStatus)
+
+	_, err = e.admin.SetFaults(ctx, &pb.SetFaultsRequest{Faults: &pb.Faults{RedisDown: true}})
+	require.NoError(t, err)
+	res, err = e.rl.HealthCheck(ctx, &pb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, pb.HealthCheckResponse_NOT_SERVING, res.Status)
+}
+
+func TestTenants(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	created, err := e.admin.CreateTenant(ctx, &pb.CreateTenantRequest{Tenant: &pb.Tenant{Name: "acme", Burst: 5, Rate: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), created.Burst)
+	_, err = e.admin.CreateTenant(ctx, &pb.CreateTenantRequest{Tenant: &pb.Tenant{Name: "acme"}})
+	requireCode(t, codes.AlreadyExists, err)
+
+	// Tenant defaults apply to the namespace's keys
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "k"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.Limit)
+
+	_, err = e.admin.UpdateTenant(ctx, &pb.UpdateTenantRequest{Tenant: &pb.Tenant{Name: "acme", Burst: 8, Rate: 1}})
+	require.NoError(t, err)
+	got, err := e.admin.GetTenant(ctx, &pb.GetTenantRequest{Name: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), got.Burst)
+	_, err = e.admin.UpdateTenant(ctx, &pb.UpdateTenantRequest{Tenant: &pb.Tenant{Name: "nobody"}})
+	requireCode(t, codes.NotFound, err)
+
+	list, err := e.admin.ListTenants(ctx, &pb.ListTenantsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Tenants, 1)
+	assert.Equal(t, "acme", list.Tenants[0].Name)
+
+	_, err = e.admin.SuspendTenant(ctx, &pb.SuspendTenantRequest{Name: "acme", Suspended: true})
+	require.NoError(t, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "k"})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = e.admin.SuspendTenant(ctx, &pb.SuspendTenantRequest{Name: "acme"})
+	require.NoError(t, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "k"})
+	require.NoError(t, err)
+
+	// Boosts of the tenant and its keys go with it, others stay
+	for _, req := range []*pb.GrantBoostRequest{
+		{Namespace: "acme"},
+		{Namespace: "acme", Key: "vip"},
+		{Namespace: "acmeco", Key: "vip"},
+		{Key: "acme:vip"},
+	} {
+		req.ExtraBurst, req.DurationSeconds = 1, 60
+		_, err = e.admin.GrantBoost(ctx, req)
+		require.NoError(t, err)
+	}
+
+	del, err := e.admin.DeleteTenant(ctx, &pb.DeleteTenantRequest{Name: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), del.DeletedKeys)
+	boosts, err := e.admin.ListBoosts(ctx, &pb.ListBoostsRequest{})
+	require.NoError(t, err)
+	require.Len(t, boosts.Boosts, 2)
+	assert.Equal(t, "acme:vip", boosts.Boosts[0].Key)
+	assert.Equal(t, "acmeco", boosts.Boosts[1].Namespace)
+	_, err = e.admin.GetTenant(ctx, &pb.GetTenantRequest{Name: "acme"})
+	requireCode(t, codes.NotFound, err)
+	_, err = e.admin.DeleteTenant(ctx, &pb.DeleteTenantRequest{})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestDefaultNamespace_Admin(t *testing.T) {
+	e := start(t, setup{namespace: "acme"})
+	ctx := context.Background()
+
+	// Keys without a namespace are the default namespace's, as on Allow
+	_, err := e.admin.GrantBoost(ctx, &pb.GrantBoostRequest{Key: "vip", ExtraBurst: 7, DurationSeconds: 60})
+	require.NoError(t, err)
+	peek, err := e.rl.Peek(ctx, &pb.PeekRequest{Key: "vip"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), peek.Limit)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+	st, err := e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Key: "k"})
+	require.NoError(t, err)
+	assert.True(t, st.Exists)
+
+	tr, err := e.admin.TraceKey(ctx, &pb.TraceKeyRequest{Key: "k", DurationSeconds: 60})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", tr.Namespace)
+
+	_, err = e.admin.AddDenylistEntries(ctx, &pb.AddDenylistEntriesRequest{Entries: []*pb.DenylistEntry{{Key: "bad"}}})
+	require.NoError(t, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "bad"})
+	requireCode(t, codes.PermissionDenied, err)
+}
+
+func TestBoosts(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	granted, err := e.admin.GrantBoost(ctx, &pb.GrantBoostRequest{Key: "vip", ExtraBurst: 7, DurationSeconds: 60})
+	require.NoError(t, err)
+	assert.Equal(t, "vip", granted.Key)
+
+	peek, err := e.rl.Peek(ctx, &pb.PeekRequest{Key: "vip"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), peek.Limit)
+	require.NotNil(t, peek.Boost)
+	assert.Equal(t, int64(7), peek.Boost.ExtraBurst)
+
+	list, err := e.admin.ListBoosts(ctx, &pb.ListBoostsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.Boosts, 1)
+
+	revoked, err := e.admin.RevokeBoost(ctx, &pb.RevokeBoostRequest{Key: "vip"})
+	require.NoError(t, err)
+	assert.True(t, revoked.Revoked)
+	peek, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "vip"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), peek.Limit)
+	assert.Nil(t, peek.Boost)
+
+	for _, req := range []*pb.GrantBoostRequest{
+		{ExtraBurst: 1, DurationSeconds: 60},
+		{Key: "vip", ExtraBurst: 1},
+		{Key: "vip", DurationSeconds: 60},
+		{Key: "vip", ExtraBurst: -1, DurationSeconds: 60},
+	} {
+		_, err := e.admin.GrantBoost(ctx, req)
+		requireCode(t, codes.InvalidArgument, err)
+	}
+}
+
+func TestListAnomalies(t *testing.T) {
+	ctx := context.Background()
+	_, err := start(t, setup{}).admin.ListAnomalies(ctx, &pb.ListAnomaliesRequest{})
+	requireCode(t, codes.FailedPrecondition, err)
+
+	e := start(t, setup{anomalies: true})
+	list, err := e.admin.ListAnomalies(ctx, &pb.ListAnomaliesRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Anomalies)
+
+	// As the detector records throttles, newest first
+	detected := time.Now().Truncate(time.Second)
+	for _, key := range []string{"user:1", "user:2"} {
+		rec, err := json.Marshal(anomaly.Record{Key: key, Rate: 100, Baseline: 10, Multiplier: 0.1, DetectedAt: detected, ExpiresAt: detected.Add(time.Minute), Host: "replica-1"})
+		require.NoError(t, err)
+		require.NoError(t, e.rdb.LPush(ctx, "ratelimiter:anomalies", rec).Err())
+	}
+	list, err = e.admin.ListAnomalies(ctx, &pb.ListAnomaliesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Anomalies, 2)
+	a := list.Anomalies[0]
+	assert.Equal(t, "user:2", a.Key)
+	assert.Equal(t, 100.0, a.Rate)
+	assert.Equal(t, 10.0, a.Baseline)
+	assert.Equal(t, 0.1, a.Multiplier)
+	assert.Equal(t, detected.Unix(), a.DetectedAt)
+	assert.Equal(t, detected.Add(time.Minute).Unix(), a.ExpiresAt)
+	assert.Equal(t, "replica-1", a.Host)
+	assert.Equal(t, "user:1", list.Anomalies[1].Key)
+
+	list, err = e.admin.ListAnomalies(ctx, &pb.ListAnomaliesRequest{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, list.Anomalies, 1)
+	assert.Equal(t, "user:2", list.Anomalies[0].Key)
+}
+
+func TestKeyTrace(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	traced, err := e.admin.TraceKey(ctx, &pb.TraceKeyRequest{Namespace: "acme", Key: "user:1", DurationSeconds: 60, Reason: "TICKET-42"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", traced.Namespace)
+	assert.Equal(t, "user:1", traced.Key)
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), traced.ExpiresAt, 5)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "user:1"})
+	require.NoError(t, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "user:2"})
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), `TRACE key="user:1" namespace="acme"`)
+	assert.Contains(t, logs.String(), `trace="TICKET-42"`)
+	assert.NotContains(t, logs.String(), `key="user:2"`)
+
+	list, err := e.admin.ListKeyTraces(ctx, &pb.ListKeyTracesRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Traces, 1)
+	assert.Equal(t, "TICKET-42", list.Traces[0].Reason)
+
+	untraced, err := e.admin.UntraceKey(ctx, &pb.UntraceKeyRequest{Namespace: "acme", Key: "user:1"})
+	require.NoError(t, err)
+	assert.True(t, untraced.Untraced)
+	logs.Reset()
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "user:1"})
+	require.NoError(t, err)
+	assert.NotContains(t, logs.String(), "TRACE")
+
+	var history *pb.DecisionHistory
+	require.Eventually(t, func() bool {
+		history, err = e.admin.GetDecisionHistory(ctx, &pb.GetDecisionHistoryRequest{Namespace: "acme", Key: "user:1"})
+		return err == nil && len(history.Decisions) == 1
+	}, time.Second, 10*time.Millisecond, "only the traced decision")
+	assert.True(t, history.Decisions[0].Allowed)
+	assert.Equal(t, int64(2), history.Decisions[0].Remaining)
+	_, err = e.admin.GetDecisionHistory(ctx, &pb.GetDecisionHistoryRequest{Namespace: "acme"})
+	requireCode(t, codes.InvalidArgument, err)
+
+	for _, req := range []*pb.TraceKeyRequest{
+		{DurationSeconds: 60},
+		{Key: "user:1"},
+		{Key: "user:1", DurationSeconds: 2 * 86400},
+	} {
+		_, err := e.admin.TraceKey(ctx, req)
+		requireCode(t, codes.InvalidArgument, err)
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	res, err := e.admin.AddDenylistEntries(ctx, &pb.AddDenylistEntriesRequest{Namespace: "acme", Entries: []*pb.DenylistEntry{
+		{Key: "ip:10.0.0.1"},
+		{Key: "ip:10.0.0.2", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Added)
+	assert.Equal(t, int64(2), res.Total)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "ip:10.0.0.2"})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "ip:10.0.0.2"})
+	require.NoError(t, err, "other namespaces aren't affected")
+
+	removed, err := e.admin.RemoveDenylistEntries(ctx, &pb.RemoveDenylistEntriesRequest{Namespace: "acme", Keys: []string{"ip:10.0.0.2"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), removed.Removed)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "ip:10.0.0.2"})
+	require.NoError(t, err)
+
+	_, err = e.admin.AddDenylistEntries(ctx, &pb.AddDenylistEntriesRequest{Entries: []*pb.DenylistEntry{{Key: "ok"}, {}}})
+	requireCode(t, codes.InvalidArgument, err)
+	big := &pb.AddDenylistEntriesRequest{}
+	for i := 0; i <= 10000; i++ {
+		big.Entries = append(big.Entries, &pb.DenylistEntry{Key: fmt.Sprintf("ip:%d", i)})
+	}
+	_, err = e.admin.AddDenylistEntries(ctx, big)
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestTenantUsage(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		_, err := e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "k"})
+		require.NoError(t, err)
+		_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "cached", Cost: 0.5})
+		require.NoError(t, err)
+	}
+	require.NoError(t, e.usage.Flush(ctx))
+
+	resp, err := e.admin.GetTenantUsage(ctx, &pb.GetTenantUsageRequest{Namespace: "acme"})
+	require.NoError(t, err)
+	require.Len(t, resp.Usage, 1)
+	assert.Equal(t, 5.0, resp.Usage[0].TokensConsumed)
+	assert.Equal(t, int64(7), resp.Usage[0].Allowed)
+	assert.Equal(t, int64(1), resp.Usage[0].Denied)
+
+	_, err = e.admin.GetTenantUsage(ctx, &pb.GetTenantUsageRequest{})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.admin.GetClientUsage(ctx, &pb.GetClientUsageRequest{Client: "svc"})
+	requireCode(t, codes.FailedPrecondition, err)
+}
+
+func TestFaults(t *testing.T) {
+	e := start(t, setup{faults: true})
+	ctx := context.Background()
+
+	set, err := e.admin.SetFaults(ctx, &pb.SetFaultsRequest{Faults: &pb.Faults{RedisDown: true}})
+	require.NoError(t, err)
+	assert.True(t, set.RedisDown)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	requireCode(t, codes.Internal, err)
+	_, err = e.rl.Peek(ctx, &pb.PeekRequest{Key: "k"})
+	requireCode(t, codes.Internal, err)
+
+	got, err := e.admin.GetFaults(ctx, &pb.GetFaultsRequest{})
+	require.NoError(t, err)
+	assert.True(t, got.RedisDown)
+
+	_, err = e.admin.SetFaults(ctx, &pb.SetFaultsRequest{Faults: &pb.Faults{ErrorRate: 2}})
+	requireCode(t, codes.InvalidArgument, err)
+
+	_, err = e.admin.SetFaults(ctx, &pb.SetFaultsRequest{})
+	require.NoError(t, err)
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+
+	// Without CHAOS_ADMIN the faults can't be touched
+	e = start(t, setup{})
+	_, err = e.admin.GetFaults(ctx, &pb.GetFaultsRequest{})
+	requireCode(t, codes.FailedPrecondition, err)
+	_, err = e.admin.SetFaults(ctx, &pb.SetFaultsRequest{Faults: &pb.Faults{RedisDown: true}})
+	requireCode(t, codes.FailedPrecondition, err)
+}
+
+func TestFaults_AdminOnly(t *testing.T) {
+	e := start(t, setup{
+		faults: true,
+		keys:   auth.Keys{"svc": []byte("svc"), "ops": []byte("ops")},
+		admins: []string{"ops"},
+	})
+	ctx := context.Background()
+
+	svc := pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("svc", []byte("svc"))))
+	_, err := svc.SetFaults(ctx, &pb.SetFaultsRequest{Faults: &pb.Faults{RedisDown: true}})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = svc.GetFaults(ctx, &pb.GetFaultsRequest{})
+	requireCode(t, codes.PermissionDenied, err)
+
+	ops := pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("ops", []byte("ops"))))
+	got, err := ops.GetFaults(ctx, &pb.GetFaultsRequest{})
+	require.NoError(t, err)
+	assert.False(t, got.RedisDown, "svc changed nothing")
+}
+
+func TestDeleteBuckets(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	// Drain a few buckets
+	for _, key := range []string{"user:1", "user:2", "api:1"} {
+		_, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: key, Tokens: 3})
+		require.NoError(t, err)
+	}
+
+	dry, err := e.admin.DeleteBuckets(ctx, &pb.DeleteBucketsRequest{Prefix: "user:", DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dry.Keys)
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	del, err := e.admin.DeleteBuckets(ctx, &pb.DeleteBucketsRequest{Prefix: "user:"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), del.Keys)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "api:1"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	for _, req := range []*pb.DeleteBucketsRequest{
+		{},
+		{Namespace: "a{b", Prefix: "user:"},
+		{Prefix: "{x}"},
+		{Prefix: "user:", KeysPerSecond: -1},
+	} {
+		_, err := e.admin.DeleteBuckets(ctx, req)
+		requireCode(t, codes.InvalidArgument, err)
+	}
+}
+
+func TestMigrateBuckets(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	for _, key := range []string{"user_1", "user_2"} {
+		_, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: key, Tokens: 3})
+		require.NoError(t, err)
+	}
+
+	req := &pb.MigrateBucketsRequest{Prefix: "user_", Pattern: `^user_(\d+)$`, Replacement: "user:$1", DryRun: true}
+	dry, err := e.admin.MigrateBuckets(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), dry.Moved)
+	req.DryRun = false
+	res, err := e.admin.MigrateBuckets(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.Moved)
+	assert.Zero(t, res.Skipped)
+
+	// Drained under the old key, drained under the new one
+	allowed, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "user:1"})
+	require.NoError(t, err)
+	assert.False(t, allowed.Allowed)
+	allowed, err = e.rl.Allow(ctx, &pb.AllowRequest{Key: "user_1"})
+	require.NoError(t, err)
+	assert.True(t, allowed.Allowed)
+
+	for _, req := range []*pb.MigrateBucketsRequest{
+		{Pattern: "^user_", Replacement: "user:"},
+		{Prefix: "user_"},
+		{Prefix: "user_", Pattern: "(", Replacement: "user:"},
+		{Prefix: "user_", Pattern: "^user_", Replacement: "user:", KeysPerSecond: -1},
+	} {
+		_, err := e.admin.MigrateBuckets(ctx, req)
+		requireCode(t, codes.InvalidArgument, err)
+	}
+}
+
+func TestInspectBucket(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	st, err := e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Key: "k"})
+	require.NoError(t, err)
+	assert.False(t, st.Exists)
+
+	_, err = e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: "k", Tokens: 2})
+	require.NoError(t, err)
+	st, err = e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Namespace: "acme", Key: "k"})
+	require.NoError(t, err)
+	assert.True(t, st.Exists)
+	assert.Equal(t, "token_bucket", st.Algorithm)
+	assert.Equal(t, 1.0, st.Tokens)
+	assert.InDelta(t, st.RedisTime, st.LastRefill, 5)
+	assert.Positive(t, st.TtlMs)
+	assert.Contains(t, st.Fields, "last_ts")
+	assert.InDelta(t, st.RedisTime, st.Created, 5)
+	assert.InDelta(t, st.Created, st.LastConsumed, 1)
+
+	peek, err := e.rl.Peek(ctx, &pb.PeekRequest{Namespace: "acme", Key: "k"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, peek.Age, peek.Idle)
+	assert.Less(t, peek.Age, 5.0)
+
+	_, err = e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{Key: "{x}"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.admin.InspectBucket(ctx, &pb.InspectBucketRequest{})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestMaintenance(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	_, err := e.admin.SetMaintenance(ctx, &pb.SetMaintenanceRequest{Enabled: true})
+	requireCode(t, codes.InvalidArgument, err)
+	m, err := e.admin.SetMaintenance(ctx, &pb.SetMaintenanceRequest{Enabled: true, Reason: "redis migration"})
+	require.NoError(t, err)
+	assert.True(t, m.Enabled)
+	assert.Positive(t, m.Since)
+	m, err = e.admin.GetMaintenance(ctx, &pb.GetMaintenanceRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "redis migration", m.Reason)
+
+	// Everything is admitted, though buckets still drain
+	for i := 0; i < 5; i++ {
+		res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Zero(t, res.RetryAfter)
+		assert.Equal(t, []string{"maintenance"}, res.Reasons)
+	}
+	batch, err := e.rl.BatchAllow(ctx, &pb.BatchAllowRequest{Requests: []*pb.AllowRequest{{Key: "k"}}})
+	require.NoError(t, err)
+	assert.True(t, batch.Results[0].Response.Allowed)
+
+	m, err = e.admin.SetMaintenance(ctx, &pb.SetMaintenanceRequest{})
+	require.NoError(t, err)
+	assert.False(t, m.Enabled)
+	res, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
+
+func TestReloadScript(t *testing.T) {
+	src, err := os.ReadFile("../../scripts/lua/token_bucket.lua")
+	require.NoError(t, err)
+	fixed := string(src) + "\n-- fixed\n"
+	var sums strings.Builder
+	for name, src := range map[string]string{"token_bucket.lua": fixed, "sliding_window.lua": "return 1"} {
+		sum := sha256.Sum256([]byte(src))
+		sums.WriteString(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, limiter.SumsFile), []byte(sums.String()), 0o644))
+
+	e := start(t, setup{scripts: dir})
+	ctx := context.Background()
+	res, err := e.admin.ReloadScript(ctx, &pb.ReloadScriptRequest{Name: "token_bucket.lua", Source: fixed})
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.PreviousSha1)
+	assert.NotEqual(t, res.PreviousSha1, res.Sha1)
+	allowed, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+	assert.True(t, allowed.Allowed)
+
+	for _, tc := range []struct {
+		req  *pb.ReloadScriptRequest
+		code codes.Code
+	}{
+		{&pb.ReloadScriptRequest{Name: "token_bucket.lua"}, codes.InvalidArgument},
+		// Pinned, but fails the checks
+		{&pb.ReloadScriptRequest{Name: "sliding_window.lua", Source: "return 1"}, codes.InvalidArgument},
+		{&pb.ReloadScriptRequest{Name: "token_bucket.lua", Source: "return {1, 0, 1, 0, 0}"}, codes.PermissionDenied},
+		{&pb.ReloadScriptRequest{Name: "sliding_window.lua", Source: fixed}, codes.PermissionDenied},
+	} {
+		_, err := e.admin.ReloadScript(ctx, tc.req)
+		requireCode(t, tc.code, err)
+	}
+
+	// Without SCRIPT_RELOAD_ADMIN, even pinned sources are refused
+	e = start(t, setup{})
+	_, err = e.admin.ReloadScript(ctx, &pb.ReloadScriptRequest{Name: "token_bucket.lua", Source: fixed})
+	requireCode(t, codes.FailedPrecondition, err)
+}
+
+func TestLogLevel(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	l, err := e.admin.GetLogLevel(ctx, &pb.GetLogLevelRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "info", l.Level)
+	assert.Zero(t, l.RevertAt)
+
+	l, err = e.admin.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: "debug", DurationSeconds: 600})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", l.Level)
+	assert.InDelta(t, time.Now().Add(10*time.Minute).Unix(), l.RevertAt, 5)
+
+	_, err = e.admin.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: "trace"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.admin.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: "debug", DurationSeconds: -1})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestLogLevel_AdminOnly(t *testing.T) {
+	e := start(t, setup{
+		keys:   auth.Keys{"svc": []byte("svc"), "ops": []byte("ops")},
+		admins: []string{"ops"},
+	})
+	ctx := context.Background()
+
+	// Debug logs every request, keys included
+	svc := pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("svc", []byte("svc"))))
+	_, err := svc.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: "debug"})
+	requireCode(t, codes.PermissionDenied, err)
+
+	ops := pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("ops", []byte("ops"))))
+	l, err := ops.GetLogLevel(ctx, &pb.GetLogLevelRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "info", l.Level, "svc changed nothing")
+	l, err = ops.SetLogLevel(ctx, &pb.SetLogLevelRequest{Level: "debug"})
+	require.NoError(t, err)
+	assert.Equal(t, "debug", l.Level)
+}
+
+func TestPreviewRules(t *testing.T) {
+	e := start(t, setup{rules: `
+rules:
+  - prefix: user
+    burst: 100
+    rate: 0.001
+`})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		for _, key := range []string{"user:1", "ip:1"} {
+			_, err := e.rl.Allow(ctx, &pb.AllowRequest{Namespace: "acme", Key: key})
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, e.prefixUsage.Flush(ctx))
+
+	resp, err := e.admin.PreviewRules(ctx, &pb.PreviewRulesRequest{Rules: `
+rules:
+  - prefix: user
+    burst: 5
+    rate: 0.001
+`})
+	require.NoError(t, err)
+	require.Len(t, resp.Changes, 1, "ip keys keep the server default")
+	c := resp.Changes[0]
+	assert.Equal(t, "acme", c.Namespace)
+	assert.Equal(t, "user", c.Prefix)
+	assert.Equal(t, "tighter", c.Effect)
+	assert.Equal(t, int64(100), c.BurstBefore)
+	assert.Equal(t, int64(5), c.BurstAfter)
+	assert.Equal(t, int64(10), c.Requests)
+	assert.Zero(t, c.DenialRateBefore)
+	assert.InDelta(t, 0.14, c.DenialRateAfter, 0.01)
+
+	_, err = e.admin.PreviewRules(ctx, &pb.PreviewRulesRequest{Rules: "rules: [{prefix: user, burst: -1}]"})
+	requireCode(t, codes.InvalidArgument, err)
+	_, err = e.admin.PreviewRules(ctx, &pb.PreviewRulesRequest{Hours: 10000})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+func TestDumpDiagnostics(t *testing.T) {
+	e := start(t, setup{})
+	ctx := context.Background()
+
+	d, err := e.admin.DumpDiagnostics(ctx, &pb.DumpDiagnosticsRequest{})
+	require.NoError(t, err)
+	var snap struct {
+		Runtime struct {
+			Goroutines int `json:"goroutines"`
+		} `json:"runtime"`
+		Limiter limiter.Diagnostics `json:"limiter"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(d.Json), &snap))
+	assert.Positive(t, snap.Runtime.Goroutines)
+	assert.NotEmpty(t, snap.Limiter.Scripts["token_bucket.lua"])
+	assert.Equal(t, int64(3), snap.Limiter.DefaultBurst)
+	assert.Empty(t, d.Path)
+}
+
+func TestCapabilities(t *testing.T) {
+	e := start(t, setup{rules: "rules: [{prefix: user, burst: 5}]"})
+
+	caps, err := client.New(e.dial(t)).Capabilities(context.Background())
+	require.NoError(t, err)
+	assert.True(t, caps.HasMethod("BatchAllow"))
+	assert.True(t, caps.HasMethod("GetCapabilities"))
+	assert.True(t, caps.HasMethod("Enqueue"))
+	assert.Equal(t, []string{"ratelimit.v1"}, caps.ProtoVersions)
+	assert.Equal(t, []string{"token_bucket"}, caps.Algorithms)
+	assert.Equal(t, 1000, caps.MaxBatchSize)
+	assert.True(t, caps.HasFeature("prefix_rules"))
+	assert.True(t, caps.HasFeature("maintenance_mode"))
+	assert.False(t, caps.HasFeature("latency_budget"))
+}
+
+func TestSignedRequests(t *testing.T) {
+	secret := []byte("s3cret")
+	e := start(t, setup{
+		keys:   auth.Keys{"svc": secret, "ops": []byte("ops")},
+		admins: []string{"ops"},
+		quotas: &apiquota.Config{Clients: map[string]apiquota.Quota{"svc": {Burst: 2, Rate: 0.001}}},
+	})
+	ctx := context.Background()
+
+	// Unsigned and wrongly signed calls are rejected, health checks aren't
+	_, err := e.rl.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	requireCode(t, codes.Unauthenticated, err)
+	forged := pb.NewRateLimitServiceClient(e.dial(t, client.WithHMAC("svc", []byte("wrong"))))
+	_, err = forged.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	requireCode(t, codes.Unauthenticated, err)
+
+	// Streams too, which sign their request like unary calls
+	events, err := e.rl.Enqueue(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+	_, err = events.Recv()
+	requireCode(t, codes.Unauthenticated, err)
+	streams := pb.NewRateLimitServiceClient(e.dial(t, client.WithStreamHMAC("ops", []byte("ops"))))
+	events, err = streams.Enqueue(ctx, &pb.AllowRequest{Key: "k"})
+	require.NoError(t, err)
+	_, err = events.Recv()
+	requireCode(t, codes.FailedPrecondition, err)
+	_, err = e.rl.HealthCheck(ctx, &pb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// Signed calls pass until the client's API quota runs out
+	signed := pb.NewRateLimitServiceClient(e.dial(t, client.WithHMAC("svc", secret)))
+	for i := 0; i < 2; i++ {
+		res, err := signed.Allow(ctx, &pb.AllowRequest{Key: "k"})
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	_, err = signed.Allow(ctx, &pb.AllowRequest{Key: "k"})
+	requireCode(t, codes.ResourceExhausted, err)
+	_, err = signed.HealthCheck(ctx, &pb.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	// Only admins may call the AdminService
+	_, err = pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("svc", secret))).DeleteTenant(ctx, &pb.DeleteTenantRequest{Name: "acme"})
+	requireCode(t, codes.PermissionDenied, err)
+
+	// Clients without a quota are unlimited, and can see what svc used
+	require.NoError(t, e.clientUsage.Flush(ctx))
+	admin := pb.NewAdminServiceClient(e.dial(t, client.WithHMAC("ops", []byte("ops"))))
+	resp, err := admin.GetClientUsage(ctx, &pb.GetClientUsageRequest{Client: "svc"})
+	require.NoError(t, err)
+	require.Len(t, resp.Usage, 1)
+	assert.Equal(t, int64(2), resp.Usage[0].Allowed)
+	assert.Equal(t, int64(1), resp.Usage[0].Denied)
+}
\ No newline at end of file
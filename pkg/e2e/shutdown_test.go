@@ -0,0 +1,157 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// call is one Allow made while the server shut down.
+type call struct {
+	start, end time.Time
+	err        error
+}
+
+// TestGracefulShutdown sends SIGTERM to the server binary under sustained
+// load. Every call in flight must complete within the drain window, later
+// calls must be refused cleanly, and the process must exit in time. Redis
+// is slowed down so there are always calls in flight.
+func TestGracefulShutdown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds and runs the server binary")
+	}
+	bin := filepath.Join(t.TempDir(), "ratelimiter")
+	build := exec.Command("go", "build", "-o", bin, "../../cmd/server")
+	out, err := build.CombinedOutput()
+	require.NoError(t, err, "%s", out)
+
+	const latency = 300 * time.Millisecond
+	for _, tc := range []struct {
+		name    string
+		drain   time.Duration
+		drained bool
+	}{
+		{"Drained", 5 * time.Second, true},
+		{"DrainWindowExpired", latency / 3, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			calls, sigAt, exitAt, logs := shutDownUnderLoad(t, bin, latency, tc.drain)
+			assert.Less(t, exitAt.Sub(sigAt), tc.drain+2*time.Second, "exit time")
+			assert.Equal(t, !tc.drained, bytes.Contains(logs, []byte("were cut off")), "%s", logs)
+
+			var inFlight, cutOff int
+			for _, c := range calls {
+				if c.err != nil {
+					// Refused or, past the drain window, cut off. Either way
+					// the client sees a retryable error.
+					assert.Equal(t, codes.Unavailable, status.Code(c.err), "%v", c.err)
+				}
+				// Started well before the signal, so the server had it
+				if c.start.Before(sigAt.Add(-50*time.Millisecond)) && c.end.After(sigAt) {
+					inFlight++
+					if c.err != nil {
+						cutOff++
+					}
+				}
+			}
+			require.NotZero(t, inFlight, "no calls in flight at SIGTERM")
+			if tc.drained {
+				assert.Zero(t, cutOff, "in-flight calls dropped")
+			} else {
+				assert.NotZero(t, cutOff, "in-flight calls outlived the drain window")
+			}
+		})
+	}
+}
+
+// shutDownUnderLoad starts the server in dev mode, sends SIGTERM after a
+// second of load and returns every call made until the process exited.
+func shutDownUnderLoad(t *testing.T, bin string, latency, drain time.Duration) ([]call, time.Time, time.Time, []byte) {
+	port := freePort(t)
+	var logs bytes.Buffer
+	cmd := exec.Command(bin, "-dev")
+	cmd.Env = append(os.Environ(),
+		"GRPC_PORT="+port,
+		"METRICS_PORT="+freePort(t),
+		"CHAOS_LATENCY_MS="+strconv.FormatInt(latency.Milliseconds(), 10),
+		"SHUTDOWN_DRAIN_MS="+strconv.FormatInt(drain.Milliseconds(), 10),
+	)
+	cmd.Stdout, cmd.Stderr = &logs, &logs
+	require.NoError(t, cmd.Start())
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	t.Cleanup(func() { cmd.Process.Kill() })
+
+	conn, err := grpc.NewClient("localhost:"+port, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	rl := pb.NewRateLimitServiceClient(conn)
+	require.Eventually(t, func() bool {
+		res, err := rl.HealthCheck(context.Background(), &pb.HealthCheckRequest{})
+		return err == nil && res.Status == pb.HealthCheckResponse_SERVING
+	}, 10*time.Second, 50*time.Millisecond, "server not serving: %s", &logs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		calls []call
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < 20; w++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				c := call{start: time.Now()}
+				_, c.err = rl.Allow(context.Background(), &pb.AllowRequest{Key: key})
+				c.end = time.Now()
+				mu.Lock()
+				calls = append(calls, c)
+				mu.Unlock()
+				if c.err != nil {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}("shutdown:" + strconv.Itoa(w))
+	}
+
+	time.Sleep(time.Second)
+	sigAt := time.Now()
+	require.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+	select {
+	case err := <-exited:
+		require.NoError(t, err, "%s", &logs)
+	case <-time.After(drain + 10*time.Second):
+		t.Fatalf("server didn't exit after SIGTERM: %s", &logs)
+	}
+	exitAt := time.Now()
+	cancel()
+	wg.Wait()
+	return calls, sigAt, exitAt, logs.Bytes()
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return strconv.Itoa(lis.Addr().(*net.TCPAddr).Port)
+}
\ No newline at end of file
@@ -0,0 +1,202 @@
+// Package global splits the limits of global rules between independent
+// clusters, e.g. one per region, so their sum holds across all of them.
+package global
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+const (
+	// regionsKey is the sorted set of regions, scored by their last sync.
+	regionsKey = "ratelimiter:global:regions"
+	// demandPrefix prefixes the demand of one key in one region:
+	// demandPrefix + key + "|" + region.
+	demandPrefix = "ratelimiter:global:demand:"
+
+	// staleSyncs is how many sync intervals a region's demand and liveness
+	// last without being refreshed.
+	staleSyncs = 3
+
+	// floor is the part of each limit split evenly between regions, so
+	// regions without recent demand can still admit some requests.
+	floor = 0.1
+
+	// maxKeys bounds the keys tracked.
+	maxKeys = 100000
+)
+
+// Coordinator shares the limits of global keys with the other regions
+// through a Redis reachable from all of them. Every sync interval, each
+// region publishes its demand for the keys it served and takes back its
+// share of their limits: an even split of a small floor, plus the rest in
+// proportion to its demand. Keys a region knows nothing about yet get an
+// even share until the next sync.
+type Coordinator struct {
+	rdb      *redis.Client
+	region   string
+	interval time.Duration
+
+	mu      sync.Mutex
+	demand  map[string]float64 // tokens requested per key since the last sync
+	shares  map[string]float64 // this region's share per key
+	regions int                // live regions, this one included
+}
+
+// New creates a Coordinator for region, syncing with the others through
+// rdb every interval.
+func New(rdb *redis.Client, region string, interval time.Duration) *Coordinator {
+	return &Coordinator{
+		rdb:      rdb,
+		region:   region,
+		interval: interval,
+		demand:   map[string]float64{},
+		shares:   map[string]float64{},
+		regions:  1,
+	}
+}
+
+// Observe counts tokens requested for the global bucket key.
+func (c *Coordinator) Observe(key string, tokens float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if _, ok := c.demand[key]; ok || len(c.demand) < maxKeys {
+		c.demand[key] += tokens
+	}
+	c.mu.Unlock()
+}
+
+// Share returns this region's part of the global limits burst and rate of
+// key. Bursts are rounded, keeping at least one token. A nil Coordinator
+// returns them whole.
+func (c *Coordinator) Share(key string, burst int64, rate float64) (int64, float64) {
+	if c == nil {
+		return burst, rate
+	}
+	c.mu.Lock()
+	share, ok := c.shares[key]
+	if !ok {
+		share = 1 / float64(c.regions)
+	}
+	c.mu.Unlock()
+	return max(int64(math.Round(float64(burst)*share)), 1), rate * share
+}
+
+// Run syncs every interval until ctx is cancelled. Shares keep their last
+// value while the global Redis is unreachable.
+func (c *Coordinator) Run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.Sync(ctx); err != nil {
+				metrics.GlobalSyncErrors.Inc()
+				log.Printf("global limit sync failed: %v", err)
+			}
+		}
+	}
+}
+
+// Sync publishes this region's demand since the last sync and recomputes
+// its shares.
+func (c *Coordinator) Sync(ctx context.Context) error {
+	c.mu.Lock()
+	demand := c.demand
+	c.demand = make(map[string]float64, len(demand))
+	keys := make([]string, 0, len(c.shares)+len(demand))
+	for key := range c.shares {
+		keys = append(keys, key)
+	}
+	for key := range demand {
+		if _, ok := c.shares[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.Unlock()
+
+	now := time.Now()
+	ttl := staleSyncs * c.interval
+	secs := c.interval.Seconds()
+	pipe := c.rdb.Pipeline()
+	for key, tokens := range demand {
+		pipe.Set(ctx, demandKey(key, c.region), tokens/secs, ttl)
+	}
+	pipe.ZAdd(ctx, regionsKey, redis.Z{Score: float64(now.Unix()), Member: c.region})
+	pipe.ZRemRangeByScore(ctx, regionsKey, "-inf", strconv.FormatInt(now.Add(-ttl).Unix(), 10))
+	live := pipe.ZRange(ctx, regionsKey, 0, -1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("publish demand: %w", err)
+	}
+	regions := live.Val()
+
+	// Every region's demand for the keys this one serves
+	pipe = c.rdb.Pipeline()
+	rates := make([]*redis.SliceCmd, len(keys))
+	for i, key := range keys {
+		ids := make([]string, len(regions))
+		for j, region := range regions {
+			ids[j] = demandKey(key, region)
+		}
+		rates[i] = pipe.MGet(ctx, ids...)
+	}
+	if len(keys) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("read demand: %w", err)
+		}
+	}
+
+	shares := make(map[string]float64, len(keys))
+	for i, key := range keys {
+		var own, total float64
+		known := false
+		for j, v := range rates[i].Val() {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			rate, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				continue
+			}
+			known = true
+			total += rate
+			if regions[j] == c.region {
+				own = rate
+			}
+		}
+		if !known {
+			continue // even share again
+		}
+		n := float64(len(regions))
+		if total == 0 {
+			shares[key] = 1 / n
+			continue
+		}
+		shares[key] = floor/n + (1-floor)*own/total
+	}
+
+	c.mu.Lock()
+	c.shares = shares
+	c.regions = max(len(regions), 1)
+	c.mu.Unlock()
+	metrics.GlobalRegions.Set(float64(len(regions)))
+	return nil
+}
+
+func demandKey(key, region string) string {
+	return demandPrefix + key + "|" + region
+}
\ No newline at end of file
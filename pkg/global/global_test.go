@@ -0,0 +1,54 @@
+package global
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinator(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	var none *Coordinator
+	burst, rate := none.Share("k", 100, 10)
+	assert.Equal(t, int64(100), burst)
+	assert.Equal(t, 10.0, rate)
+
+	us := New(rdb, "us", time.Second)
+	eu := New(rdb, "eu", time.Second)
+	burst, _ = us.Share("k", 100, 10)
+	assert.Equal(t, int64(100), burst, "alone until the first sync")
+
+	us.Observe("k", 90)
+	eu.Observe("k", 10)
+	require.NoError(t, us.Sync(ctx))
+	require.NoError(t, eu.Sync(ctx))
+	require.NoError(t, us.Sync(ctx))
+
+	burst, rate = us.Share("k", 100, 10)
+	assert.Equal(t, int64(86), burst)
+	assert.InDelta(t, 8.6, rate, 1e-9)
+	burst, rate = eu.Share("k", 100, 10)
+	assert.Equal(t, int64(14), burst)
+	assert.InDelta(t, 1.4, rate, 1e-9)
+
+	// Keys without demand anywhere are split evenly
+	burst, _ = us.Share("other", 100, 10)
+	assert.Equal(t, int64(50), burst)
+	burst, _ = us.Share("other", 1, 10)
+	assert.Equal(t, int64(1), burst)
+
+	// Once the demand is stale, shares are even again
+	mr.FastForward(staleSyncs * time.Second)
+	require.NoError(t, us.Sync(ctx))
+	burst, _ = us.Share("k", 100, 10)
+	assert.Equal(t, int64(50), burst)
+}
\ No newline at end of file
@@ -0,0 +1,238 @@
+// Package gqlcost charges GraphQL operations by what they ask for rather
+// than per request: one query may select a single field or a thousand
+// nested list items, so its cost in tokens is computed from its fields,
+// list sizes and depth and consumed from the limiter in one Allow call.
+package gqlcost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+)
+
+var (
+	// ErrTooDeep is returned for operations nesting fields deeper than
+	// Weights.MaxDepth.
+	ErrTooDeep = errors.New("gqlcost: query too deep")
+	// ErrTooCostly is returned for operations costing more than
+	// Weights.MaxCost. They aren't charged.
+	ErrTooCostly = errors.New("gqlcost: query too costly")
+)
+
+// Weights sets what the parts of an operation cost. The zero value charges
+// one token per selected field, with list fields multiplying the cost of
+// their selections by their first, last or limit argument.
+type Weights struct {
+	// Field is the cost of one selected field, 1 when 0.
+	Field int64
+	// Fields overrides Field for some fields, keyed "Type.field" (e.g.
+	// "Query.search") or just "field". Type names are only known for
+	// documents validated against a schema, as gqlgen's are.
+	Fields map[string]int64
+	// ListArgs name the arguments sizing a list field: first, last and
+	// limit when nil.
+	ListArgs []string
+	// DefaultListSize multiplies list fields without a size argument.
+	// Like type names, it needs a validated document (0 = 1).
+	DefaultListSize int64
+	// MaxDepth rejects operations nesting fields deeper, top-level fields
+	// being at depth 1 (0 = no limit).
+	MaxDepth int
+	// MaxCost rejects operations costing more (0 = no limit).
+	MaxCost int64
+}
+
+var defaultListArgs = []string{"first", "last", "limit"}
+
+// Cost is what one operation costs.
+type Cost struct {
+	// Tokens to charge, at least 1. Fragments on the different types of a
+	// union or interface all count, so it's an upper bound.
+	Tokens int64
+	// Depth is the deepest field's nesting level.
+	Depth int
+}
+
+// Cost computes the cost of op, one of doc's operations, with vars giving
+// its variables.
+func (w Weights) Cost(doc *ast.QueryDocument, op *ast.OperationDefinition, vars map[string]any) (Cost, error) {
+	c := &coster{w: w, doc: doc, vars: vars, visiting: map[string]bool{}}
+	tokens, err := c.selections(op.SelectionSet, 1)
+	if err != nil {
+		return Cost{}, err
+	}
+	cost := Cost{Tokens: max(tokens, 1), Depth: c.depth}
+	if w.MaxCost > 0 && cost.Tokens > w.MaxCost {
+		return cost, fmt.Errorf("%w: costs %d, at most %d allowed", ErrTooCostly, cost.Tokens, w.MaxCost)
+	}
+	return cost, nil
+}
+
+// QueryCost parses query and computes the cost of its operation named
+// operation, which may be empty when it has only one.
+func (w Weights) QueryCost(query, operation string, vars map[string]any) (Cost, error) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: query})
+	if err != nil {
+		return Cost{}, fmt.Errorf("gqlcost: parse query: %w", err)
+	}
+	op := doc.Operations.ForName(operation)
+	if op == nil {
+		return Cost{}, fmt.Errorf("gqlcost: no operation %q in query", operation)
+	}
+	return w.Cost(doc, op, vars)
+}
+
+// Charge consumes the cost of query's operation from key's bucket, for
+// servers not built on gqlgen (see Extension for those that are).
+func Charge(ctx context.Context, l client.Limiter, key string, w Weights, query, operation string, vars map[string]any) (*client.Result, Cost, error) {
+	cost, err := w.QueryCost(query, operation, vars)
+	if err != nil {
+		return nil, cost, err
+	}
+	res, err := l.Allow(ctx, key, cost.Tokens)
+	if err != nil {
+		return nil, cost, err
+	}
+	return res, cost, nil
+}
+
+type coster struct {
+	w        Weights
+	doc      *ast.QueryDocument
+	vars     map[string]any
+	visiting map[string]bool // fragments being expanded, to catch cycles
+	depth    int
+}
+
+func (c *coster) selections(set ast.SelectionSet, depth int) (int64, error) {
+	var total int64
+	for _, sel := range set {
+		var cost int64
+		switch sel := sel.(type) {
+		case *ast.Field:
+			if sel.Name == "__typename" {
+				continue
+			}
+			if c.w.MaxDepth > 0 && depth > c.w.MaxDepth {
+				return 0, fmt.Errorf("%w: %q is at depth %d, at most %d allowed", ErrTooDeep, sel.Name, depth, c.w.MaxDepth)
+			}
+			c.depth = max(c.depth, depth)
+			children, err := c.selections(sel.SelectionSet, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			size, err := c.listSize(sel)
+			if err != nil {
+				return 0, err
+			}
+			cost = add(c.weight(sel), mul(size, children))
+		case *ast.InlineFragment:
+			n, err := c.selections(sel.SelectionSet, depth)
+			if err != nil {
+				return 0, err
+			}
+			cost = n
+		case *ast.FragmentSpread:
+			def := sel.Definition
+			if def == nil {
+				def = c.doc.Fragments.ForName(sel.Name)
+			}
+			if def == nil {
+				return 0, fmt.Errorf("gqlcost: unknown fragment %q", sel.Name)
+			}
+			if c.visiting[def.Name] {
+				return 0, fmt.Errorf("gqlcost: fragment %q spreads itself", def.Name)
+			}
+			c.visiting[def.Name] = true
+			n, err := c.selections(def.SelectionSet, depth)
+			delete(c.visiting, def.Name)
+			if err != nil {
+				return 0, err
+			}
+			cost = n
+		}
+		total = add(total, cost)
+	}
+	return total, nil
+}
+
+// weight is the cost of selecting f itself.
+func (c *coster) weight(f *ast.Field) int64 {
+	if f.ObjectDefinition != nil {
+		if n, ok := c.w.Fields[f.ObjectDefinition.Name+"."+f.Name]; ok {
+			return n
+		}
+	}
+	if n, ok := c.w.Fields[f.Name]; ok {
+		return n
+	}
+	if c.w.Field > 0 {
+		return c.w.Field
+	}
+	return 1
+}
+
+// listSize is how many items f asks for, multiplying its selections' cost.
+func (c *coster) listSize(f *ast.Field) (int64, error) {
+	args := c.w.ListArgs
+	if args == nil {
+		args = defaultListArgs
+	}
+	for _, name := range args {
+		arg := f.Arguments.ForName(name)
+		if arg == nil {
+			continue
+		}
+		v, err := arg.Value.Value(c.vars)
+		if err != nil {
+			return 0, fmt.Errorf("gqlcost: %s argument of %q: %w", name, f.Name, err)
+		}
+		if n, ok := toInt(v); ok && n > 0 {
+			return n, nil
+		}
+	}
+	if f.Definition != nil && f.Definition.Type.Elem != nil && c.w.DefaultListSize > 0 {
+		return c.w.DefaultListSize, nil
+	}
+	return 1, nil
+}
+
+func toInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(math.Min(v, math.MaxInt64)), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// add and mul saturate at math.MaxInt64, so huge list sizes can't wrap a
+// cost around to something cheap.
+func add(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func mul(a, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
\ No newline at end of file
@@ -0,0 +1,105 @@
+package gqlcost
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limitertest"
+)
+
+const usersQuery = `query Users($n: Int) {
+	users(first: $n) {
+		name
+		friends(first: 5) { name }
+	}
+}`
+
+func TestQueryCost(t *testing.T) {
+	for name, tc := range map[string]struct {
+		weights Weights
+		query   string
+		vars    map[string]any
+		want    Cost
+	}{
+		"Fields":     {query: `{ me { name } }`, want: Cost{Tokens: 2, Depth: 2}},
+		"Lists":      {query: usersQuery, vars: map[string]any{"n": 10}, want: Cost{Tokens: 71, Depth: 3}},
+		"JSONNumber": {query: usersQuery, vars: map[string]any{"n": json.Number("10")}, want: Cost{Tokens: 71, Depth: 3}},
+		"NoSize":     {query: usersQuery, want: Cost{Tokens: 8, Depth: 3}},
+		"Fragments": {
+			query: `{ me { ...F ... on User { id } } } fragment F on User { name email }`,
+			want:  Cost{Tokens: 4, Depth: 2},
+		},
+		"Weights": {
+			weights: Weights{Field: 2, Fields: map[string]int64{"search": 10}},
+			query:   `{ search(limit: 3) { id } }`,
+			want:    Cost{Tokens: 16, Depth: 2},
+		},
+		"Typename": {query: `{ __typename }`, want: Cost{Tokens: 1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cost, err := tc.weights.QueryCost(tc.query, "", tc.vars)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, cost)
+		})
+	}
+}
+
+func TestQueryCost_Limits(t *testing.T) {
+	vars := map[string]any{"n": 10}
+	_, err := Weights{MaxDepth: 2}.QueryCost(usersQuery, "Users", vars)
+	assert.ErrorIs(t, err, ErrTooDeep)
+	_, err = Weights{MaxCost: 50}.QueryCost(usersQuery, "Users", vars)
+	assert.ErrorIs(t, err, ErrTooCostly)
+	_, err = Weights{}.QueryCost(usersQuery, "Users", map[string]any{"n": 1 << 62})
+	assert.NoError(t, err, "huge lists saturate rather than overflow")
+
+	_, err = Weights{}.QueryCost(`{ me { ...A } } fragment A on User { friends { ...A } }`, "", nil)
+	assert.ErrorContains(t, err, "spreads itself")
+	_, err = Weights{}.QueryCost(usersQuery, "Other", nil)
+	assert.ErrorContains(t, err, "no operation")
+}
+
+func TestCharge(t *testing.T) {
+	ctx := context.Background()
+	fake := limitertest.DenyAfter(5)
+	for i := 0; i < 2; i++ {
+		res, cost, err := Charge(ctx, fake, "user:1", Weights{}, `{ me { name } }`, "", nil)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, int64(2), cost.Tokens)
+	}
+	res, _, err := Charge(ctx, fake, "user:1", Weights{}, `{ me { name } }`, "", nil)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
+
+func TestExtension(t *testing.T) {
+	doc, err := parser.ParseQuery(&ast.Source{Input: usersQuery})
+	require.NoError(t, err)
+	oc := &graphql.OperationContext{Doc: doc, Operation: doc.Operations[0], Variables: map[string]any{"n": 2}}
+	fake := limitertest.DenyAfter(20).WithRetryAfter(3 * time.Second)
+	ext := &Extension{Limiter: fake, Key: func(context.Context) string { return "user:1" }}
+	require.NoError(t, ext.Validate(nil))
+
+	ctx := context.Background()
+	assert.Nil(t, ext.MutateOperationContext(ctx, oc))
+	assert.Equal(t, int64(15), fake.Calls()[0].Tokens)
+	gerr := ext.MutateOperationContext(ctx, oc)
+	require.NotNil(t, gerr)
+	assert.Equal(t, "RATE_LIMITED", gerr.Extensions["code"])
+	assert.Equal(t, 3.0, gerr.Extensions["retryAfter"])
+
+	ext.Weights.MaxDepth = 1
+	gerr = ext.MutateOperationContext(ctx, oc)
+	require.NotNil(t, gerr)
+	assert.Equal(t, "QUERY_TOO_COMPLEX", gerr.Extensions["code"])
+	assert.Len(t, fake.Calls(), 2, "rejected operations aren't charged")
+}
\ No newline at end of file
@@ -0,0 +1,76 @@
+package gqlcost
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+)
+
+// Extension is a gqlgen handler extension charging every operation its
+// cost before it runs:
+//
+//	srv := handler.NewDefaultServer(schema)
+//	srv.Use(&gqlcost.Extension{Limiter: c, Key: userKey})
+//
+// Denied operations fail with a RATE_LIMITED error carrying their cost and
+// retryAfter (in seconds) as extensions.
+type Extension struct {
+	// Limiter decides, typically a *client.Client. Required.
+	Limiter client.Limiter
+	// Key returns the key an operation is charged to, e.g. its caller's.
+	// Required.
+	Key func(ctx context.Context) string
+	// Weights price operations.
+	Weights Weights
+	// FailOpen runs operations when the limiter can't be asked, instead
+	// of failing them.
+	FailOpen bool
+}
+
+var (
+	_ graphql.HandlerExtension        = (*Extension)(nil)
+	_ graphql.OperationContextMutator = (*Extension)(nil)
+)
+
+// ExtensionName implements graphql.HandlerExtension.
+func (e *Extension) ExtensionName() string { return "RateLimitCost" }
+
+// Validate implements graphql.HandlerExtension.
+func (e *Extension) Validate(graphql.ExecutableSchema) error {
+	if e.Limiter == nil || e.Key == nil {
+		return errors.New("gqlcost: Extension needs a Limiter and a Key")
+	}
+	return nil
+}
+
+// MutateOperationContext charges oc's operation, failing it when it's too
+// deep, too costly or denied.
+func (e *Extension) MutateOperationContext(ctx context.Context, oc *graphql.OperationContext) *gqlerror.Error {
+	cost, err := e.Weights.Cost(oc.Doc, oc.Operation, oc.Variables)
+	if err != nil {
+		gerr := gqlerror.Errorf("%v", err)
+		gerr.Extensions = map[string]any{"code": "QUERY_TOO_COMPLEX"}
+		return gerr
+	}
+	res, err := e.Limiter.Allow(ctx, e.Key(ctx), cost.Tokens)
+	if err != nil {
+		if e.FailOpen && ctx.Err() == nil {
+			return nil
+		}
+		return gqlerror.Errorf("rate limit check: %v", err)
+	}
+	if res.Allowed {
+		return nil
+	}
+	gerr := gqlerror.Errorf("rate limited: operation costs %d tokens, retry after %v", cost.Tokens, res.RetryAfter)
+	gerr.Extensions = map[string]any{
+		"code":       "RATE_LIMITED",
+		"cost":       cost.Tokens,
+		"retryAfter": res.RetryAfter.Seconds(),
+	}
+	return gerr
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+// Package greylist gives keys seen for the first time a stricter
+// provisional limit for a probation period, against bursts from freshly
+// generated identities.
+package greylist
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+const (
+	// seenKey is the Redis bitmap of the Bloom filter of keys ever seen.
+	seenKey = "ratelimiter:seen"
+	// probationPrefix prefixes the markers of keys on probation, which
+	// expire with the probation.
+	probationPrefix = "ratelimiter:probation:"
+
+	// falsePositiveRate sizes the Bloom filter. A false positive lets a
+	// new key skip probation.
+	falsePositiveRate = 0.01
+
+	// maxCached bounds the keys whose status is cached in process.
+	maxCached = 100000
+)
+
+// Config tunes a Greylist.
+type Config struct {
+	// Probation is how long keys keep the provisional limit after they are
+	// first seen.
+	Probation time.Duration
+	// Multiplier scales the burst and rate of keys on probation.
+	Multiplier float64
+	// ExpectedKeys is how many distinct keys the Bloom filter is sized for.
+	// Beyond it, more new keys skip probation.
+	ExpectedKeys int64
+}
+
+// Greylist tracks the keys ever seen in a Bloom filter in Redis, shared by
+// every replica, and keys on probation in expiring markers. Each replica
+// caches what it learns, so Redis is only asked the first time a replica
+// sees a key.
+type Greylist struct {
+	rdb    *redis.Client
+	cfg    Config
+	bits   uint64 // Bloom filter size
+	hashes int
+
+	mu sync.Mutex
+	// until when keys are on probation; a past time once they're through
+	cache map[string]time.Time
+}
+
+// New creates a Greylist with a Bloom filter in rdb sized for cfg.
+func New(rdb *redis.Client, cfg Config) *Greylist {
+	n := float64(max(cfg.ExpectedKeys, 1))
+	// Redis bitmaps hold at most 2^32 bits
+	bits := math.Min(math.Ceil(-n*math.Log(falsePositiveRate)/(math.Ln2*math.Ln2)), 1<<32)
+	return &Greylist{
+		rdb:    rdb,
+		cfg:    cfg,
+		bits:   uint64(bits),
+		hashes: max(int(math.Round(bits/n*math.Ln2)), 1),
+		cache:  map[string]time.Time{},
+	}
+}
+
+// Apply returns the limits of the bucket key: burst and rate, scaled down
+// while the key is on probation. Keys are seen by calling it. When Redis
+// can't tell, the key gets its normal limits. A nil Greylist is a no-op.
+func (g *Greylist) Apply(ctx context.Context, key string, burst int64, rate float64) (int64, float64) {
+	if g == nil {
+		return burst, rate
+	}
+	now := time.Now()
+	g.mu.Lock()
+	until, ok := g.cache[key]
+	g.mu.Unlock()
+	if !ok {
+		var err error
+		if until, err = g.see(ctx, key, now); err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "greylist").Inc()
+			log.Printf("greylist lookup for %q failed: %v", key, err)
+			return burst, rate
+		}
+		g.mu.Lock()
+		if len(g.cache) >= maxCached {
+			clear(g.cache)
+		}
+		g.cache[key] = until
+		g.mu.Unlock()
+	}
+	if !now.Before(until) {
+		return burst, rate
+	}
+	return max(int64(math.Ceil(float64(burst)*g.cfg.Multiplier)), 1), rate * g.cfg.Multiplier
+}
+
+// see records key as seen and returns until when it's on probation.
+func (g *Greylist) see(ctx context.Context, key string, now time.Time) (time.Time, error) {
+	offsets := g.offsets(key)
+	marker := probationPrefix + key
+
+	pipe := g.rdb.Pipeline()
+	ttl := pipe.PTTL(ctx, marker)
+	bits := make([]*redis.IntCmd, len(offsets))
+	for i, off := range offsets {
+		bits[i] = pipe.GetBit(ctx, seenKey, off)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, err
+	}
+	if d := ttl.Val(); d > 0 {
+		return now.Add(d), nil
+	}
+	seen := true
+	for _, b := range bits {
+		seen = seen && b.Val() == 1
+	}
+	if seen {
+		return time.Time{}, nil
+	}
+
+	pipe = g.rdb.Pipeline()
+	for _, off := range offsets {
+		pipe.SetBit(ctx, seenKey, off, 1)
+	}
+	pipe.SetNX(ctx, marker, now.Unix(), g.cfg.Probation)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, err
+	}
+	metrics.GreylistedKeys.Inc()
+	return now.Add(g.cfg.Probation), nil
+}
+
+// offsets returns the Bloom filter bits of key, derived from two FNV
+// hashes.
+func (g *Greylist) offsets(key string) []int64 {
+	h1, h2 := fnv.New64a(), fnv.New64()
+	h1.Write([]byte(key))
+	h2.Write([]byte(key))
+	a, b := h1.Sum64(), h2.Sum64()|1
+	offsets := make([]int64, g.hashes)
+	for i := range offsets {
+		offsets[i] = int64((a + uint64(i)*b) % g.bits)
+	}
+	return offsets
+}
\ No newline at end of file
@@ -0,0 +1,73 @@
+package greylist
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	cfg := Config{Probation: 50 * time.Millisecond, Multiplier: 0.1, ExpectedKeys: 1000}
+
+	var none *Greylist
+	burst, rate := none.Apply(ctx, "user:1", 10, 2)
+	assert.Equal(t, int64(10), burst)
+	assert.Equal(t, 2.0, rate)
+
+	g := New(rdb, cfg)
+	burst, rate = g.Apply(ctx, "user:1", 10, 2)
+	assert.Equal(t, int64(1), burst)
+	assert.InDelta(t, 0.2, rate, 1e-9)
+	burst, _ = g.Apply(ctx, "user:1", 3, 2)
+	assert.Equal(t, int64(1), burst, "provisional bursts keep a token")
+
+	// Another replica sees the probation
+	burst, _ = New(rdb, cfg).Apply(ctx, "user:1", 10, 2)
+	assert.Equal(t, int64(1), burst)
+
+	time.Sleep(cfg.Probation)
+	mr.FastForward(cfg.Probation)
+	burst, _ = g.Apply(ctx, "user:1", 10, 2)
+	assert.Equal(t, int64(10), burst)
+	burst, _ = New(rdb, cfg).Apply(ctx, "user:1", 10, 2)
+	assert.Equal(t, int64(10), burst, "known keys don't go back on probation")
+
+	// Without Redis, keys keep their normal limits
+	mr.Close()
+	burst, _ = New(rdb, cfg).Apply(ctx, "user:2", 10, 2)
+	assert.Equal(t, int64(10), burst)
+}
+
+func TestBloomFilter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	g := New(rdb, Config{Probation: time.Hour, Multiplier: 0.5, ExpectedKeys: 1000})
+	assert.Equal(t, 7, g.hashes)
+
+	for i := 0; i < 1000; i++ {
+		g.Apply(ctx, "seen:"+strconv.Itoa(i), 10, 1)
+	}
+	// With the filter at capacity, about 1% of new keys look seen
+	var falsePositives int
+	for i := 0; i < 1000; i++ {
+		seen := true
+		for _, off := range g.offsets("new:" + strconv.Itoa(i)) {
+			seen = seen && rdb.GetBit(ctx, seenKey, off).Val() == 1
+		}
+		if seen {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 30)
+}
\ No newline at end of file
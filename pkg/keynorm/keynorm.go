@@ -0,0 +1,132 @@
+// Package keynorm rewrites keys into a canonical form before they're
+// limited, so one entity formatted differently by different clients
+// ("User:42 ", "user:42") shares one bucket instead of splitting across
+// several.
+package keynorm
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Func normalizes a key.
+type Func func(key string) string
+
+var (
+	mu sync.RWMutex
+	// builtin normalizers, plus those added with Register
+	registry = map[string]Func{
+		"trim":  strings.TrimSpace,
+		"lower": strings.ToLower,
+		"ip":    canonicalIP,
+		"port":  stripPort,
+	}
+)
+
+// Register makes f available to New under name, e.g. from the init
+// function of a package linked into a custom build. It panics when name is
+// taken.
+func Register(name string, f Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("keynorm: normalizer %q registered twice", name))
+	}
+	registry[name] = f
+}
+
+// Names lists the registered normalizers, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sortedNames()
+}
+
+// Chain runs normalizers in order. A nil Chain leaves keys as they are.
+type Chain struct {
+	names []string
+	funcs []Func
+}
+
+// New returns the Chain running the named normalizers in order, or nil
+// when names is empty.
+func New(names []string) (*Chain, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	c := &Chain{names: names}
+	for _, name := range names {
+		f, ok := registry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown key normalizer %q (have %s)", name, strings.Join(sortedNames(), ", "))
+		}
+		c.funcs = append(c.funcs, f)
+	}
+	return c, nil
+}
+
+func sortedNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply returns the normalized key.
+func (c *Chain) Apply(key string) string {
+	if c == nil {
+		return key
+	}
+	for _, f := range c.funcs {
+		key = f(key)
+	}
+	return key
+}
+
+// Names returns the normalizers the chain runs, in order.
+func (c *Chain) Names() []string {
+	if c == nil {
+		return nil
+	}
+	return c.names
+}
+
+// canonicalIP rewrites an IP address, as the whole key or following its
+// prefix ("ip:2001:DB8:0::1"), in its canonical form ("ip:2001:db8::1").
+// IPv4-mapped IPv6 addresses become IPv4 ones.
+func canonicalIP(key string) string {
+	return rewriteAddr(key, func(s string) (string, bool) {
+		ip, err := netip.ParseAddr(s)
+		return ip.Unmap().String(), err == nil
+	})
+}
+
+// stripPort drops the port of an address with one, as the whole key or
+// following its prefix ("ip:10.0.0.1:52113" becomes "ip:10.0.0.1").
+func stripPort(key string) string {
+	return rewriteAddr(key, func(s string) (string, bool) {
+		ap, err := netip.ParseAddrPort(s)
+		return ap.Addr().String(), err == nil
+	})
+}
+
+// rewriteAddr applies f to key, or else to the part of key following its
+// prefix, whichever f can rewrite.
+func rewriteAddr(key string, f func(string) (string, bool)) string {
+	if s, ok := f(key); ok {
+		return s
+	}
+	if i := strings.IndexByte(key, ':'); i >= 0 {
+		if s, ok := f(key[i+1:]); ok {
+			return key[:i+1] + s
+		}
+	}
+	return key
+}
\ No newline at end of file
@@ -0,0 +1,40 @@
+package keynorm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	c, err := New([]string{"trim", "lower", "port", "ip"})
+	require.NoError(t, err)
+	for in, want := range map[string]string{
+		" User:42 ":                  "user:42",
+		"ip:10.0.0.1:52113":          "ip:10.0.0.1",
+		"ip:[2001:DB8:0::1]:443":     "ip:2001:db8::1",
+		"ip:2001:0db8:0000::0001":    "ip:2001:db8::1",
+		"ip:::ffff:10.0.0.1":         "ip:10.0.0.1",
+		"2001:DB8::1":                "2001:db8::1",
+		"10.0.0.1:80":                "10.0.0.1",
+		"session:abc:def":            "session:abc:def",
+		"api:v1:payments:2001:db8::": "api:v1:payments:2001:db8::",
+	} {
+		assert.Equal(t, want, c.Apply(in), in)
+	}
+
+	assert.Equal(t, "As Sent", (*Chain)(nil).Apply("As Sent"), "nil chain")
+	_, err = New([]string{"trim", "soundex"})
+	assert.ErrorContains(t, err, "soundex")
+}
+
+func TestRegister(t *testing.T) {
+	Register("test-upper", strings.ToUpper)
+	c, err := New([]string{"test-upper"})
+	require.NoError(t, err)
+	assert.Equal(t, "USER:42", c.Apply("user:42"))
+	assert.Contains(t, Names(), "test-upper")
+	assert.Panics(t, func() { Register("lower", strings.ToLower) })
+}
\ No newline at end of file
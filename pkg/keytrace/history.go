@@ -0,0 +1,122 @@
+package keytrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+const (
+	// historyPrefix prefixes the list holding a bucket key's last decisions.
+	historyPrefix = "ratelimiter:history:"
+	// historyQueue bounds the decisions waiting to be written. Decisions
+	// recorded while it's full are dropped rather than slowing down Allow.
+	historyQueue = 1024
+)
+
+// Decision is one decision on a traced key, as kept in its history.
+type Decision struct {
+	Time       time.Time `json:"time"`
+	Tokens     float64   `json:"tokens"`
+	Allowed    bool      `json:"allowed"`
+	Remaining  int64     `json:"remaining"`
+	Limit      int64     `json:"limit"`
+	RetryAfter float64   `json:"retry_after,omitempty"`
+}
+
+type entry struct {
+	key string
+	d   Decision
+}
+
+// History keeps the last decisions on traced keys in a bounded Redis list
+// per bucket key, newest first, so support can tell exactly when a
+// customer was throttled. Lists outlive their trace by the retention. A
+// nil History keeps nothing.
+type History struct {
+	rdb       *redis.Client
+	size      int64
+	retention time.Duration
+	queue     chan entry
+}
+
+// NewHistory creates a History keeping the last size decisions per key for
+// retention after the last one.
+func NewHistory(rdb *redis.Client, size int, retention time.Duration) *History {
+	return &History{rdb: rdb, size: int64(size), retention: retention, queue: make(chan entry, historyQueue)}
+}
+
+// Record queues d, a decision on bucket key, to be written by Run.
+func (h *History) Record(key string, d Decision) {
+	if h == nil {
+		return
+	}
+	select {
+	case h.queue <- entry{key: key, d: d}:
+	default:
+		metrics.HistoryWrites.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run writes recorded decisions until ctx is cancelled.
+func (h *History) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-h.queue:
+			result := "written"
+			if err := h.write(ctx, e); err != nil {
+				log.Printf("decision history of %q: %v", e.key, err)
+				result = "failed"
+			}
+			metrics.HistoryWrites.WithLabelValues(result).Inc()
+		}
+	}
+}
+
+func (h *History) write(ctx context.Context, e entry) error {
+	v, err := json.Marshal(e.d)
+	if err != nil {
+		return err
+	}
+	k := historyPrefix + e.key
+	pipe := h.rdb.TxPipeline()
+	pipe.LPush(ctx, k, v)
+	pipe.LTrim(ctx, k, 0, h.size-1)
+	pipe.Expire(ctx, k, h.retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("redis lpush: %w", err)
+	}
+	return nil
+}
+
+// Query returns up to limit of the last decisions on bucket key, newest
+// first.
+func (h *History) Query(ctx context.Context, key string, limit int) ([]Decision, error) {
+	raw, err := h.rdb.LRange(ctx, historyPrefix+key, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis lrange: %w", err)
+	}
+	out := make([]Decision, 0, len(raw))
+	for _, v := range raw {
+		var d Decision
+		if err := json.Unmarshal([]byte(v), &d); err != nil {
+			log.Printf("decision history of %q: skipping malformed entry: %v", key, err)
+			continue
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// Size is the number of decisions kept per key.
+func (h *History) Size() int {
+	return int(h.size)
+}
\ No newline at end of file
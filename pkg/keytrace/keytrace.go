@@ -0,0 +1,162 @@
+// Package keytrace flags bucket keys, or whole tenants, whose decisions are
+// logged in full for a while, to debug one customer's complaints without
+// turning up logging for everyone.
+package keytrace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKey is the hash holding active traces (field = trace target).
+const redisKey = "ratelimiter:traces"
+
+// Trace flags a bucket key (limiter.Key) or a tenant (limiter.TenantKey)
+// until it expires.
+type Trace struct {
+	Target    string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Reason notes why, e.g. a ticket, for whoever reads the logs
+	Reason string `json:"reason,omitempty"`
+}
+
+// Active reports whether the trace hasn't expired at now.
+func (t *Trace) Active(now time.Time) bool {
+	return t != nil && now.Before(t.ExpiresAt)
+}
+
+// Registry stores traces in Redis, so they hold on every replica, and
+// serves lookups from an in-process cache. A nil Registry traces nothing.
+type Registry struct {
+	rdb *redis.Client
+
+	// n is the count of cached traces, so the common case of none costs
+	// no lock on the decision path.
+	n      atomic.Int64
+	mu     sync.RWMutex
+	traces map[string]*Trace
+}
+
+// NewRegistry creates an empty registry. Call Refresh to populate it.
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{rdb: rdb, traces: map[string]*Trace{}}
+}
+
+// Get returns the active trace of the first of targets that has one, or
+// nil.
+func (r *Registry) Get(targets ...string) *Trace {
+	if r == nil || r.n.Load() == 0 {
+		return nil
+	}
+	now := time.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, target := range targets {
+		if t := r.traces[target]; t.Active(now) {
+			return t
+		}
+	}
+	return nil
+}
+
+// List returns all active traces.
+func (r *Registry) List() []*Trace {
+	now := time.Now()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*Trace, 0, len(r.traces))
+	for _, t := range r.traces {
+		if t.Active(now) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Start creates or replaces the trace of t.Target.
+func (r *Registry) Start(ctx context.Context, t *Trace) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := r.rdb.HSet(ctx, redisKey, t.Target, v).Err(); err != nil {
+		return fmt.Errorf("redis hset: %w", err)
+	}
+	r.mu.Lock()
+	r.traces[t.Target] = t
+	r.n.Store(int64(len(r.traces)))
+	r.mu.Unlock()
+	return nil
+}
+
+// Stop removes the trace of target. It reports whether one existed.
+func (r *Registry) Stop(ctx context.Context, target string) (bool, error) {
+	n, err := r.rdb.HDel(ctx, redisKey, target).Result()
+	if err != nil {
+		return false, fmt.Errorf("redis hdel: %w", err)
+	}
+	r.mu.Lock()
+	delete(r.traces, target)
+	r.n.Store(int64(len(r.traces)))
+	r.mu.Unlock()
+	return n > 0, nil
+}
+
+// Refresh reloads the cache from Redis and deletes expired traces.
+func (r *Registry) Refresh(ctx context.Context) error {
+	raw, err := r.rdb.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis hgetall: %w", err)
+	}
+
+	now := time.Now()
+	traces := make(map[string]*Trace, len(raw))
+	var expired []string
+	for target, v := range raw {
+		t := &Trace{}
+		if err := json.Unmarshal([]byte(v), t); err != nil {
+			log.Printf("trace %q: skipping malformed entry: %v", target, err)
+			continue
+		}
+		t.Target = target
+		if !t.Active(now) {
+			expired = append(expired, target)
+			continue
+		}
+		traces[target] = t
+	}
+	if len(expired) > 0 {
+		if err := r.rdb.HDel(ctx, redisKey, expired...).Err(); err != nil {
+			log.Printf("failed to purge %d expired traces: %v", len(expired), err)
+		}
+	}
+
+	r.mu.Lock()
+	r.traces = traces
+	r.n.Store(int64(len(traces)))
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the cache every interval until ctx is cancelled.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("trace refresh failed: %v", err)
+			}
+		}
+	}
+}
\ No newline at end of file
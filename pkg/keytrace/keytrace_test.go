@@ -0,0 +1,74 @@
+package keytrace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+
+	r := NewRegistry(rdb)
+	assert.Nil(t, r.Get("{acme}:user:1"))
+	require.NoError(t, r.Start(ctx, &Trace{Target: "{acme}", ExpiresAt: time.Now().Add(time.Minute), Reason: "TICKET-1"}))
+	require.NoError(t, r.Start(ctx, &Trace{Target: "{acme}:old", ExpiresAt: time.Now().Add(-time.Second)}))
+
+	// Other replicas pick the traces up from Redis
+	other := NewRegistry(rdb)
+	require.NoError(t, other.Refresh(ctx))
+	tr := other.Get("{acme}:user:1", "{acme}")
+	require.NotNil(t, tr)
+	assert.Equal(t, "TICKET-1", tr.Reason)
+	assert.Nil(t, other.Get("{acme}:old"), "expired")
+	assert.Len(t, other.List(), 1)
+	fields, err := mr.HKeys(redisKey)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"{acme}"}, fields, "expired traces are purged")
+
+	ok, err := other.Stop(ctx, "{acme}")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, other.Get("{acme}"))
+
+	var nilRegistry *Registry
+	assert.Nil(t, nilRegistry.Get("{acme}"))
+}
+
+func TestHistory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := NewHistory(rdb, 3, time.Hour)
+	go h.Run(ctx)
+	start := time.Now().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		h.Record("{acme}:user:1", Decision{Time: start.Add(time.Duration(i) * time.Second), Tokens: 1, Allowed: i < 4, Remaining: int64(4 - i)})
+	}
+
+	var got []Decision
+	require.Eventually(t, func() bool {
+		var err error
+		got, err = h.Query(ctx, "{acme}:user:1", 10)
+		return err == nil && len(got) == 3 && !got[0].Allowed
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, start.Add(4*time.Second).Equal(got[0].Time), "newest first")
+	assert.Equal(t, int64(2), got[2].Remaining, "only the last 3 are kept")
+	assert.Greater(t, mr.TTL(historyPrefix+"{acme}:user:1"), 59*time.Minute)
+
+	got, err := h.Query(ctx, "{acme}:user:1", 1)
+	require.NoError(t, err)
+	assert.Len(t, got, 1)
+
+	var nilHistory *History
+	nilHistory.Record("{acme}:user:1", Decision{})
+}
\ No newline at end of file
@@ -0,0 +1,315 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+var evalBatchLatency = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_token_bucket_batch"))
+
+// Check is one item of a batch: the arguments of a single Allow call.
+type Check struct {
+	Key    string
+	Tokens float64
+	Burst  int64
+	Rate   float64
+}
+
+// BatchResult is the outcome of one Check. Exactly one of Result and Err
+// is set.
+type BatchResult struct {
+	*Result
+	Err error
+}
+
+// batchChunkSize bounds the checks evaluated by one script call, so a large
+// batch doesn't block Redis for the whole of it.
+const batchChunkSize = 100
+
+// AllowBatch runs many independent Allow checks with token_bucket_batch.lua,
+// up to batchChunkSize per EVAL and every chunk in a single pipeline, so a
+// batch costs one round trip and a handful of script calls. Items fail
+// individually.
+func (tb *TokenBucket) AllowBatch(ctx context.Context, checks []Check) []BatchResult {
+	args := make([]*evalArgs, len(checks))
+	for i, c := range checks {
+		args[i] = tb.evalArgs(c.Key, c.Tokens, c.Burst, c.Rate)
+	}
+	defer func() {
+		for _, a := range args {
+			a.release()
+		}
+	}()
+	return tb.runBatch(ctx, args)
+}
+
+// PeekBatch returns the state of many buckets, and whether each check's
+// tokens could be consumed, with one token_bucket_peek.lua call per check
+// in a single pipeline. Like PeekTokens, it writes nothing.
+func (tb *TokenBucket) PeekBatch(ctx context.Context, checks []Check) []BatchResult {
+	args := make([]*evalArgs, len(checks))
+	for i, c := range checks {
+		args[i] = tb.evalArgs(c.Key, c.Tokens, c.Burst, c.Rate)
+	}
+	defer func() {
+		for _, a := range args {
+			a.release()
+		}
+	}()
+	return tb.runEach(ctx, tb.client(), tb.scripts().peek, args)
+}
+
+func (tb *TokenBucket) runBatch(ctx context.Context, args []*evalArgs) []BatchResult {
+	rdb := tb.client()
+	if cc, ok := rdb.(*redis.ClusterClient); ok {
+		return tb.fanOut(ctx, cc, args)
+	}
+	return tb.runChunks(ctx, rdb, splitChunks(args))
+}
+
+// fanOut groups the checks by hash slot, so that every script call stays
+// within one slot, and runs each node's share of the batch concurrently.
+// The batch then takes as long as its slowest node instead of their sum.
+func (tb *TokenBucket) fanOut(ctx context.Context, cc *redis.ClusterClient, args []*evalArgs) []BatchResult {
+	out := make([]BatchResult, len(args))
+
+	var slots []int
+	bySlot := map[int][]int{}
+	for i, a := range args {
+		slot := Slot(a.keys[0])
+		if _, ok := bySlot[slot]; !ok {
+			slots = append(slots, slot)
+		}
+		bySlot[slot] = append(bySlot[slot], i)
+	}
+
+	type share struct {
+		chunks [][]*evalArgs
+		at     []int // position in out of each item of chunks
+	}
+	shares := map[*redis.Client]*share{}
+	for _, slot := range slots {
+		items := bySlot[slot]
+		node, err := cc.MasterForKey(ctx, args[items[0]].keys[0])
+		if err != nil {
+			for _, i := range items {
+				out[i].Err = fmt.Errorf("redis cluster: %w", err)
+			}
+			continue
+		}
+		sh, ok := shares[node]
+		if !ok {
+			sh = &share{}
+			shares[node] = sh
+		}
+		group := make([]*evalArgs, len(items))
+		for j, i := range items {
+			group[j] = args[i]
+		}
+		sh.chunks = append(sh.chunks, splitChunks(group)...)
+		sh.at = append(sh.at, items...)
+	}
+
+	var wg sync.WaitGroup
+	for node, sh := range shares {
+		wg.Add(1)
+		go func(node *redis.Client, sh *share) {
+			defer wg.Done()
+			for j, r := range tb.runChunks(ctx, node, sh.chunks) {
+				out[sh.at[j]] = r
+			}
+		}(node, sh)
+	}
+	wg.Wait()
+	return out
+}
+
+// splitChunks splits args into script calls of at most batchChunkSize checks.
+func splitChunks(args []*evalArgs) [][]*evalArgs {
+	var chunks [][]*evalArgs
+	for len(args) > batchChunkSize {
+		chunks = append(chunks, args[:batchChunkSize])
+		args = args[batchChunkSize:]
+	}
+	if len(args) > 0 {
+		chunks = append(chunks, args)
+	}
+	return chunks
+}
+
+// runChunks runs one token_bucket_batch.lua call per chunk on rdb, in a
+// single pipeline, and returns the results of the chunks' items in order.
+func (tb *TokenBucket) runChunks(ctx context.Context, rdb redis.UniversalClient, chunks [][]*evalArgs) []BatchResult {
+	bases := make([]int, len(chunks))
+	n := 0
+	for i, c := range chunks {
+		bases[i] = n
+		n += len(c)
+	}
+	out := make([]BatchResult, n)
+	if n == 0 {
+		return out
+	}
+
+	start := time.Now()
+	cmds := tb.pipelineBatch(ctx, rdb, chunks)
+
+	// Unknown scripts are loaded and the chunks resent, as in runEach.
+	var retry []int
+	for i, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			retry = append(retry, i)
+		}
+	}
+	if len(retry) > 0 {
+		if err := tb.scripts().batch.Load(ctx, rdb).Err(); err == nil {
+			again := make([][]*evalArgs, len(retry))
+			for j, i := range retry {
+				again[j] = chunks[i]
+			}
+			for j, cmd := range tb.pipelineBatch(ctx, rdb, again) {
+				cmds[retry[j]] = cmd
+			}
+		}
+	}
+	evalBatchLatency.Observe(time.Since(start).Seconds())
+
+	var (
+		split   []*evalArgs
+		splitAt []int
+		failed  bool
+	)
+	for c, cmd := range cmds {
+		base := bases[c]
+		chunk := chunks[c]
+
+		raw, err := cmd.Result()
+		if redis.HasErrorPrefix(err, "CROSSSLOT") {
+			// Rejected before running, e.g. by a cluster proxy that
+			// shards keys itself: they're safe to send one call each.
+			for j, a := range chunk {
+				split = append(split, a)
+				splitAt = append(splitAt, base+j)
+			}
+			continue
+		}
+		if err != nil {
+			failed = true
+			for j := range chunk {
+				out[base+j].Err = fmt.Errorf("redis eval: %w", err)
+			}
+			continue
+		}
+		vals, err := decodeResponse(raw, 5*len(chunk))
+		if err != nil {
+			for j := range chunk {
+				out[base+j].Err = err
+			}
+			continue
+		}
+		for j := range chunk {
+			out[base+j].Result = parseResult(vals[5*j:])
+		}
+	}
+	if failed {
+		metrics.RedisErrors.Inc()
+	}
+
+	for j, r := range tb.runEach(ctx, rdb, tb.scripts().script, split) {
+		out[splitAt[j]] = r
+	}
+	return out
+}
+
+// pipelineBatch sends one token_bucket_batch.lua call per chunk in a single
+// pipeline.
+func (tb *TokenBucket) pipelineBatch(ctx context.Context, rdb redis.UniversalClient, chunks [][]*evalArgs) []*redis.Cmd {
+	batch := tb.scripts().batch
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.Cmd, len(chunks))
+	for i, chunk := range chunks {
+		keys := make([]string, len(chunk))
+		argv := make([]interface{}, 0, 3*len(chunk)+1)
+		for j, a := range chunk {
+			keys[j] = a.keys[0]
+			argv = append(argv, a.argv[:3]...)
+		}
+		if now := tb.nowArg(); now != nil {
+			argv = append(argv, now)
+		}
+		cmds[i] = batch.EvalSha(ctx, pipe, keys, argv...)
+	}
+	pipe.Exec(ctx) // errors are reported per command
+	return cmds
+}
+
+// runEach runs checks with one call of script, token_bucket.lua or a
+// script taking the same arguments, each in a single pipeline, for keys
+// that can't share a script call.
+func (tb *TokenBucket) runEach(ctx context.Context, rdb redis.UniversalClient, script *redis.Script, args []*evalArgs) []BatchResult {
+	out := make([]BatchResult, len(args))
+	if len(args) == 0 {
+		return out
+	}
+
+	start := time.Now()
+	cmds := pipelineEval(ctx, rdb, script, args)
+
+	// EVALSHA fails without side effects when Redis doesn't know the
+	// script (e.g. after a restart), so those items are safe to resend.
+	var retry []int
+	for i, cmd := range cmds {
+		if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+			retry = append(retry, i)
+		}
+	}
+	if len(retry) > 0 {
+		if err := script.Load(ctx, rdb).Err(); err == nil {
+			again := make([]*evalArgs, len(retry))
+			for j, i := range retry {
+				again[j] = args[i]
+			}
+			for j, cmd := range pipelineEval(ctx, rdb, script, again) {
+				cmds[retry[j]] = cmd
+			}
+		}
+	}
+	evalBatchLatency.Observe(time.Since(start).Seconds())
+
+	failed := false
+	for i, cmd := range cmds {
+		raw, err := cmd.Result()
+		if err != nil {
+			failed = true
+			out[i].Err = fmt.Errorf("redis eval: %w", err)
+			continue
+		}
+		vals, err := decodeResponse(raw, 5)
+		if err != nil {
+			out[i].Err = err
+			continue
+		}
+		out[i].Result = parseResult(vals)
+		parseAges(out[i].Result, vals[5:])
+	}
+	if failed {
+		metrics.RedisErrors.Inc()
+	}
+	return out
+}
+
+func pipelineEval(ctx context.Context, rdb redis.UniversalClient, script *redis.Script, args []*evalArgs) []*redis.Cmd {
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.Cmd, len(args))
+	for i, a := range args {
+		cmds[i] = script.EvalSha(ctx, pipe, a.keys, a.argv...)
+	}
+	pipe.Exec(ctx) // errors are reported per command
+	return cmds
+}
\ No newline at end of file
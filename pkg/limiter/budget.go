@@ -0,0 +1,191 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Budgeter bounds how long latency-critical checks wait for Redis. When a
+// check takes longer than the budget, it is answered from the last state
+// Redis reported for the key, refilled for the time since. The Redis call
+// carries on in the background and reconciles: tokens it consumed for a
+// request answered with a denial are returned, and the local state is
+// replaced by what Redis reports. A request admitted locally that Redis
+// then denies can't be undone, so the budget trades a little accuracy for
+// bounded latency.
+type Budgeter struct {
+	tb     *TokenBucket
+	budget time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*localBucket
+}
+
+// localBucket is the estimated state of a bucket, as of at.
+type localBucket struct {
+	tokens float64
+	limit  int64
+	rate   float64
+	at     time.Time
+}
+
+// NewBudgeter creates a Budgeter that waits at most budget for Redis.
+func NewBudgeter(tb *TokenBucket, budget time.Duration) *Budgeter {
+	return &Budgeter{tb: tb, budget: budget, keys: map[string]*localBucket{}}
+}
+
+type outcome struct {
+	res *Result
+	err error
+}
+
+// Allow has the semantics of TokenBucket.Allow, except that it answers from
+// local state once Redis takes longer than the budget. Keys with no local
+// state yet wait for Redis. It returns ctx.Err() as is when ctx ends first.
+func (b *Budgeter) Allow(ctx context.Context, key string, tokens float64, burst int64, rate float64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	if burst <= 0 {
+		burst = b.tb.defaultBurst
+	}
+	if rate <= 0 {
+		rate = b.tb.defaultRate
+	}
+
+	// The call must finish even when the caller stops waiting for it.
+	done := make(chan outcome, 1)
+	go func() {
+		res, err := b.tb.Allow(context.WithoutCancel(ctx), key, tokens, burst, rate)
+		done <- outcome{res, err}
+	}()
+
+	timer := time.NewTimer(b.budget)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		if o.err == nil {
+			b.observe(key, o.res, rate)
+		}
+		return o.res, o.err
+	case <-ctx.Done():
+		go b.reconcile(key, tokens, burst, rate, false, done)
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	res, ok := b.local(key, tokens, time.Now())
+	if !ok {
+		o := <-done
+		if o.err == nil {
+			b.observe(key, o.res, rate)
+		}
+		return o.res, o.err
+	}
+	if res.Allowed {
+		metrics.BudgetFallbacks.WithLabelValues("allowed").Inc()
+	} else {
+		metrics.BudgetFallbacks.WithLabelValues("denied").Inc()
+	}
+	go b.reconcile(key, tokens, burst, rate, res.Allowed, done)
+	return res, nil
+}
+
+// local decides a request from the key's estimated state.
+func (b *Budgeter) local(key string, tokens float64, now time.Time) (*Result, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.keys[key]
+	if !ok {
+		return nil, false
+	}
+
+	est := math.Min(float64(st.limit), st.tokens+now.Sub(st.at).Seconds()*st.rate)
+	res := &Result{Limit: st.limit}
+	if est >= tokens {
+		est -= tokens
+		res.Allowed = true
+	} else if st.rate > 0 {
+		res.RetryAfter = (tokens - est) / st.rate
+	}
+	st.tokens, st.at = est, now
+
+	res.Remaining = int64(est)
+	res.ResetAt = now.Unix()
+	if st.rate > 0 {
+		res.ResetAt = now.Add(time.Duration((float64(st.limit) - est) / st.rate * float64(time.Second))).Unix()
+	}
+	return res, true
+}
+
+// observe replaces the key's local state with what Redis reported.
+func (b *Budgeter) observe(key string, res *Result, rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.keys[key] = &localBucket{
+		tokens: float64(res.Remaining),
+		limit:  res.Limit,
+		rate:   rate,
+		at:     time.Now(),
+	}
+}
+
+// reconcile waits for a Redis call whose request was answered without it,
+// and gives back tokens consumed for a request that was denied.
+func (b *Budgeter) reconcile(key string, tokens float64, burst int64, rate float64, allowed bool, done <-chan outcome) {
+	o := <-done
+	if o.err != nil {
+		return
+	}
+	b.observe(key, o.res, rate)
+
+	switch {
+	case o.res.Allowed && !allowed:
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := b.tb.Return(ctx, key, tokens, burst); err != nil {
+			log.Printf("failed to return %g tokens for %q: %v", tokens, key, err)
+			return
+		}
+		b.mu.Lock()
+		if st, ok := b.keys[key]; ok {
+			st.tokens = math.Min(float64(st.limit), st.tokens+tokens)
+		}
+		b.mu.Unlock()
+		metrics.BudgetReconciled.WithLabelValues("refunded").Inc()
+	case !o.res.Allowed && allowed:
+		metrics.BudgetReconciled.WithLabelValues("overadmitted").Inc()
+	}
+}
+
+// Forget drops the local state of keys not seen for longer than idle.
+func (b *Budgeter) Forget(idle time.Duration) {
+	cutoff := time.Now().Add(-idle)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, st := range b.keys {
+		if st.at.Before(cutoff) {
+			delete(b.keys, key)
+		}
+	}
+}
+
+// Run forgets keys idle for longer than interval, every interval, until
+// ctx is cancelled.
+func (b *Budgeter) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			b.Forget(interval)
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,95 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// cleanupLock is held by the replica running a cleanup pass.
+const cleanupLock = "ratelimiter:cleanup"
+
+// Cleaner deletes the buckets nobody used for a while. Idle buckets expire
+// on their own once they'd have refilled, but those of slow or never
+// refilling limits can linger for days; an untouched bucket that is full
+// again carries no information. Deleting one that isn't full refills it,
+// so the idle period should be longer than the slowest refill that
+// matters.
+type Cleaner struct {
+	tb            *TokenBucket
+	idle          time.Duration
+	keysPerSecond int
+}
+
+// NewCleaner creates a Cleaner deleting tb's buckets idle for longer than
+// idle, scanning at up to keysPerSecond keys per Redis node (0 = uncapped).
+func NewCleaner(tb *TokenBucket, idle time.Duration, keysPerSecond int) *Cleaner {
+	return &Cleaner{tb: tb, idle: idle, keysPerSecond: keysPerSecond}
+}
+
+// Run starts a pass every interval until ctx is cancelled. Only one replica
+// runs a pass per interval.
+func (c *Cleaner) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			ok, err := c.tb.client().SetNX(ctx, cleanupLock, 1, interval).Result()
+			if err != nil {
+				log.Printf("bucket cleanup lock failed: %v", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			start := time.Now()
+			n, err := c.Clean(ctx)
+			if err != nil {
+				log.Printf("bucket cleanup stopped after %d buckets: %v", n, err)
+				continue
+			}
+			metrics.CleanupLastPass.SetToCurrentTime()
+			log.Printf("bucket cleanup deleted %d idle buckets in %v", n, time.Since(start).Round(time.Second))
+		}
+	}
+}
+
+// Clean scans every node once and deletes the buckets idle for longer than
+// the Cleaner's period. It returns the number of buckets deleted.
+func (c *Cleaner) Clean(ctx context.Context) (int64, error) {
+	var total atomic.Int64
+	err := c.tb.eachNode(ctx, "", func(ctx context.Context, rdb redis.UniversalClient) error {
+		return scan(ctx, rdb, "rl:*", c.keysPerSecond, func(keys []string) error {
+			metrics.CleanupScanned.Add(float64(len(keys)))
+			var n int
+			pipe := rdb.Pipeline()
+			for i, idle := range idleTimes(ctx, rdb, keys) {
+				if idle.Err() == nil && idle.Val() > c.idle {
+					// One key per command: a cluster node's keys span
+					// many slots
+					pipe.Unlink(ctx, keys[i])
+					n++
+				}
+			}
+			if n == 0 {
+				return nil
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return fmt.Errorf("redis unlink: %w", err)
+			}
+			total.Add(int64(n))
+			metrics.CleanupDeleted.Add(float64(n))
+			return nil
+		})
+	})
+	return total.Load(), err
+}
\ No newline at end of file
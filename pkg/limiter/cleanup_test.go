@@ -0,0 +1,41 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleaner(t *testing.T) {
+	// miniredis, for its clock: idle times are by it
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	tb := New(rdb, 5, 0.001)
+	ctx := context.Background()
+
+	start := time.Now()
+	mr.SetTime(start)
+	for _, key := range []string{"user:1", "user:2", "user:3"} {
+		_, err := tb.Allow(ctx, key, 1, 0, 0)
+		require.NoError(t, err)
+	}
+	_, err := tb.Quota(ctx, "user:1", 1, 5, 24*time.Hour)
+	require.NoError(t, err)
+	mr.SetTime(start.Add(2 * time.Hour))
+	_, err = tb.Allow(ctx, "user:3", 1, 0, 0)
+	require.NoError(t, err)
+
+	n, err := NewCleaner(tb, time.Hour, 100).Clean(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	keys := mr.Keys()
+	assert.Contains(t, keys, "rl:user:3")
+	assert.NotContains(t, keys, "rl:user:1")
+	assert.Len(t, keys, 2, "quota counters are left alone")
+}
\ No newline at end of file
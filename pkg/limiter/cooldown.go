@@ -0,0 +1,33 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// cooldownPrefix prefixes the markers of buckets cooling down after they
+// ran dry. Markers expire with the cooldown.
+const cooldownPrefix = "rlc:"
+
+// Cooldown returns how long key's bucket keeps cooling down, or 0 when it
+// isn't.
+func (tb *TokenBucket) Cooldown(ctx context.Context, key string) (time.Duration, error) {
+	d, err := tb.client().PTTL(ctx, cooldownPrefix+key).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return 0, fmt.Errorf("redis pttl: %w", err)
+	}
+	return max(d, 0), nil
+}
+
+// StartCooldown makes key's bucket cool down for d, unless it already is.
+func (tb *TokenBucket) StartCooldown(ctx context.Context, key string, d time.Duration) error {
+	if err := tb.client().SetNX(ctx, cooldownPrefix+key, 1, d).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,30 @@
+package limiter
+
+import "github.com/redis/go-redis/v9"
+
+// Diagnostics is the limiter's state, for diagnostic dumps.
+type Diagnostics struct {
+	// SHA-1 of the scripts in use by file name, as ReloadScript reports
+	Scripts      map[string]string `json:"scripts"`
+	Overridden   []string          `json:"overridden_scripts,omitempty"`
+	Pool         *redis.PoolStats  `json:"pool"`
+	DefaultBurst int64             `json:"default_burst"`
+	DefaultRate  float64           `json:"default_rate"`
+}
+
+// Diagnostics returns the limiter's current scripts, Redis pool counters
+// and defaults.
+func (tb *TokenBucket) Diagnostics() Diagnostics {
+	scripts := tb.scripts()
+	d := Diagnostics{
+		Scripts:      make(map[string]string, len(embeddedScripts)),
+		Overridden:   tb.sources.Overridden(),
+		Pool:         tb.client().PoolStats(),
+		DefaultBurst: tb.defaultBurst,
+		DefaultRate:  tb.defaultRate,
+	}
+	for name := range embeddedScripts {
+		d.Scripts[name] = (*scripts.named(name)).Hash()
+	}
+	return d
+}
\ No newline at end of file
@@ -0,0 +1,216 @@
+package limiter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+const (
+	// guardLock is held by the replica checking the caps, so the replicas
+	// don't all evict for the same excess.
+	guardLock = "ratelimiter:guard"
+
+	// guardLowWater is the fraction of a cap the guard evicts down to, so
+	// a node just over it isn't evicted from on every check.
+	guardLowWater = 0.9
+
+	// guardMinIdle is how long a bucket must have been idle to be evicted.
+	guardMinIdle = time.Minute
+)
+
+// errEvictedEnough stops the scan of evictIdle.
+var errEvictedEnough = errors.New("evicted enough")
+
+// GuardConfig caps every Redis node of the limiter, e.g. every master of a
+// cluster.
+type GuardConfig struct {
+	// MaxKeys caps the keys of each node (0 = no cap).
+	MaxKeys int64
+	// MaxMemory caps the memory used by each node, in bytes (0 = no cap).
+	MaxMemory int64
+}
+
+// Guard keeps the limiter's Redis under caps on its keys and memory, so an
+// explosion of key cardinality can't run it out of memory. When a node is
+// over a cap, the guard evicts the buckets that have been idle the longest,
+// which only refills them, until it's back under 90% of the cap. Buckets
+// used within the last minute, quota counters and other state are never
+// evicted.
+type Guard struct {
+	tb  *TokenBucket
+	cfg GuardConfig
+}
+
+// NewGuard creates a Guard keeping tb's Redis under the caps of cfg.
+func NewGuard(tb *TokenBucket, cfg GuardConfig) *Guard {
+	return &Guard{tb: tb, cfg: cfg}
+}
+
+// Run checks the caps every interval until ctx is cancelled. Only one
+// replica checks them per interval.
+func (g *Guard) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			ok, err := g.tb.client().SetNX(ctx, guardLock, 1, interval).Result()
+			if err != nil {
+				log.Printf("redis guard lock failed: %v", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if _, err := g.Check(ctx); err != nil {
+				log.Printf("redis guard check failed: %v", err)
+			}
+		}
+	}
+}
+
+// Check checks every node against the caps, evicts buckets from those over
+// one, and returns the number of buckets evicted.
+func (g *Guard) Check(ctx context.Context) (int64, error) {
+	var total atomic.Int64
+	err := g.tb.eachNode(ctx, "", func(ctx context.Context, rdb redis.UniversalClient) error {
+		n, err := g.checkNode(ctx, rdb)
+		total.Add(n)
+		return err
+	})
+	return total.Load(), err
+}
+
+func (g *Guard) checkNode(ctx context.Context, rdb redis.UniversalClient) (int64, error) {
+	node := nodeAddr(rdb)
+	keys, err := rdb.DBSize(ctx).Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis dbsize: %w", err)
+	}
+	metrics.RedisKeys.WithLabelValues(node).Set(float64(keys))
+
+	var (
+		excess int64
+		over   string
+	)
+	if g.cfg.MaxKeys > 0 && keys > g.cfg.MaxKeys {
+		excess = keys - int64(float64(g.cfg.MaxKeys)*guardLowWater)
+		over = "keys"
+	}
+	if g.cfg.MaxMemory > 0 {
+		used, err := usedMemory(ctx, rdb)
+		if err != nil {
+			return 0, err
+		}
+		metrics.RedisMemory.WithLabelValues(node).Set(float64(used))
+		if used > g.cfg.MaxMemory {
+			// Taking every key to use the same memory
+			n := int64(math.Ceil(float64(keys) * (1 - float64(g.cfg.MaxMemory)*guardLowWater/float64(used))))
+			if n > excess {
+				excess, over = n, "memory"
+			}
+		}
+	}
+	if excess <= 0 {
+		return 0, nil
+	}
+
+	n, err := evictIdle(ctx, rdb, keys, excess)
+	metrics.GuardEvictions.WithLabelValues(over).Add(float64(n))
+	log.Printf("WARNING: Redis node %s over its %s cap with %d keys: evicted %d idle buckets", node, over, keys, n)
+	return n, err
+}
+
+// evictIdle evicts up to want of the buckets of rdb, out of its keys keys,
+// in a single SCAN: from each batch, it evicts the batch's share of want,
+// idlest first.
+func evictIdle(ctx context.Context, rdb redis.UniversalClient, keys, want int64) (int64, error) {
+	var evicted int64
+	share := float64(want) / float64(keys)
+	err := scan(ctx, rdb, "rl:*", 0, func(batch []string) error {
+		idle := idleTimes(ctx, rdb, batch)
+
+		order := make([]int, len(batch))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return idle[order[a]].Val() > idle[order[b]].Val() })
+
+		n := min(int64(math.Ceil(share*float64(len(batch)))), want-evicted)
+		var queued int64
+		pipe := rdb.Pipeline()
+		for _, i := range order {
+			if queued == n || idle[i].Err() != nil || idle[i].Val() < guardMinIdle {
+				break
+			}
+			// One key per command: a cluster node's keys span many slots
+			pipe.Unlink(ctx, batch[i])
+			queued++
+		}
+		if queued == 0 {
+			return nil
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("redis unlink: %w", err)
+		}
+		evicted += queued
+		if evicted >= want {
+			return errEvictedEnough
+		}
+		return nil
+	})
+	if errors.Is(err, errEvictedEnough) {
+		err = nil
+	}
+	return evicted, err
+}
+
+// idleTimes returns the OBJECT IDLETIME of keys, in a single pipeline. Keys
+// that expired since they were listed have an error.
+func idleTimes(ctx context.Context, rdb redis.UniversalClient, keys []string) []*redis.DurationCmd {
+	idle := make([]*redis.DurationCmd, len(keys))
+	pipe := rdb.Pipeline()
+	for i, key := range keys {
+		idle[i] = pipe.ObjectIdleTime(ctx, key)
+	}
+	pipe.Exec(ctx) // errors are reported per command
+	return idle
+}
+
+// usedMemory returns the used_memory of rdb, from INFO.
+func usedMemory(ctx context.Context, rdb redis.UniversalClient) (int64, error) {
+	raw, err := rdb.Info(ctx, "memory").Result()
+	if err != nil {
+		return 0, fmt.Errorf("redis info: %w", err)
+	}
+	sc := bufio.NewScanner(strings.NewReader(raw))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "used_memory:"); ok {
+			return strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return 0, errors.New("redis info: no used_memory")
+}
+
+// nodeAddr returns the address of a node client, for metric labels.
+func nodeAddr(rdb redis.UniversalClient) string {
+	if c, ok := rdb.(*redis.Client); ok {
+		return c.Options().Addr
+	}
+	return ""
+}
\ No newline at end of file
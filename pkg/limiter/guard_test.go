@@ -0,0 +1,51 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuard(t *testing.T) {
+	// miniredis, for its clock: idle times are by it
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	tb := New(rdb, 5, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	mr.SetTime(start)
+	for i := 0; i < 10; i++ {
+		_, err := tb.Allow(ctx, fmt.Sprintf("user:%d", i), 1, 0, 0)
+		require.NoError(t, err)
+	}
+	mr.SetTime(start.Add(time.Hour))
+	for _, key := range []string{"user:0", "user:1"} {
+		_, err := tb.Allow(ctx, key, 1, 0, 0)
+		require.NoError(t, err)
+	}
+
+	// Under the cap, nothing moves
+	n, err := NewGuard(tb, GuardConfig{MaxKeys: 10}).Check(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// Over it, idle buckets go until 90% of it is left
+	n, err = NewGuard(tb, GuardConfig{MaxKeys: 5}).Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Len(t, mr.Keys(), 4)
+
+	// Buckets in use stay, however far over the cap
+	n, err = NewGuard(tb, GuardConfig{MaxKeys: 1}).Check(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.ElementsMatch(t, []string{"rl:user:0", "rl:user:1"}, mr.Keys())
+}
\ No newline at end of file
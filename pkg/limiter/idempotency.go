@@ -0,0 +1,63 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// requestPrefix prefixes the records of requests carrying an idempotency
+// key. A record holds requestPending while its request runs, then the
+// response, after a 'r'.
+const requestPrefix = "rlr:"
+
+const requestPending = "p"
+
+// ClaimRequest marks request id as running for ttl, unless an earlier
+// attempt did. It returns whether this call claimed it and, when not, the
+// response recorded by the earlier attempt, which is nil while that
+// attempt is still running.
+func (tb *TokenBucket) ClaimRequest(ctx context.Context, id string, ttl time.Duration) (bool, []byte, error) {
+	claimed, err := tb.client().SetNX(ctx, requestPrefix+id, requestPending, ttl).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return false, nil, fmt.Errorf("redis set: %w", err)
+	}
+	if claimed {
+		return true, nil, nil
+	}
+	rec, err := tb.client().Get(ctx, requestPrefix+id).Result()
+	if errors.Is(err, redis.Nil) || rec == requestPending {
+		return false, nil, nil
+	}
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return false, nil, fmt.Errorf("redis get: %w", err)
+	}
+	return false, []byte(rec[1:]), nil
+}
+
+// RecordRequest stores resp as the response to request id, which this
+// process claimed, for ttl.
+func (tb *TokenBucket) RecordRequest(ctx context.Context, id string, resp []byte, ttl time.Duration) error {
+	if err := tb.client().Set(ctx, requestPrefix+id, append([]byte{'r'}, resp...), ttl).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
+
+// ForgetRequest drops request id's record, so that retries of a request
+// that failed are charged.
+func (tb *TokenBucket) ForgetRequest(ctx context.Context, id string) error {
+	if err := tb.client().Del(ctx, requestPrefix+id).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis del: %w", err)
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,210 @@
+//go:build integration
+
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/redis/go-redis/v9"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/network"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The integration harness runs the whole suite against a real Redis
+// topology in containers: REDIS_TOPOLOGY=standalone (the default),
+// sentinel or cluster. Needs Docker. make test-integration runs all three.
+
+const redisImage = "redis:7.2"
+
+func TestMain(m *testing.M) {
+	ctx := context.Background()
+	topology := os.Getenv("REDIS_TOPOLOGY")
+	if topology == "" {
+		topology = "standalone"
+	}
+	start, ok := topologies[topology]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown REDIS_TOPOLOGY %q\n", topology)
+		os.Exit(2)
+	}
+	newClient, stop, err := start(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start %s redis: %v\n", topology, err)
+		os.Exit(1)
+	}
+	testTopology = func(testing.TB) redis.UniversalClient { return newClient() }
+
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// A topology starts its containers and returns a constructor for clients
+// of it and a func that removes the containers.
+var topologies = map[string]func(ctx context.Context) (func() redis.UniversalClient, func(), error){
+	"standalone": startStandalone,
+	"sentinel":   startSentinel,
+	"cluster":    startCluster,
+}
+
+func startStandalone(ctx context.Context) (func() redis.UniversalClient, func(), error) {
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        redisImage,
+			ExposedPorts: []string{"6379/tcp"},
+			WaitingFor:   wait.ForLog("Ready to accept connections"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := func() { c.Terminate(ctx) }
+	addr, err := c.PortEndpoint(ctx, "6379/tcp", "")
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return func() redis.UniversalClient {
+		return redis.NewClient(&redis.Options{Addr: addr, DB: testDB()})
+	}, stop, nil
+}
+
+// startSentinel runs a master and one sentinel monitoring it on a private
+// network. The sentinel reports the master's address on that network, so
+// clients dial it through remapDialer.
+func startSentinel(ctx context.Context) (func() redis.UniversalClient, func(), error) {
+	nw, err := network.New(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var containers []testcontainers.Container
+	stop := func() {
+		for _, c := range containers {
+			c.Terminate(ctx)
+		}
+		nw.Remove(ctx)
+	}
+
+	master, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:          redisImage,
+			ExposedPorts:   []string{"6379/tcp"},
+			Networks:       []string{nw.Name},
+			NetworkAliases: map[string][]string{nw.Name: {"redis-master"}},
+			WaitingFor:     wait.ForLog("Ready to accept connections"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	containers = append(containers, master)
+
+	sentinel, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        redisImage,
+			ExposedPorts: []string{"26379/tcp"},
+			Networks:     []string{nw.Name},
+			Cmd: []string{"sh", "-c", "printf 'port 26379\\nprotected-mode no\\n" +
+				"sentinel resolve-hostnames yes\\n" +
+				"sentinel monitor mymaster redis-master 6379 1\\n' > /tmp/sentinel.conf" +
+				" && exec redis-sentinel /tmp/sentinel.conf"},
+			WaitingFor: wait.ForLog("+monitor master"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	containers = append(containers, sentinel)
+
+	masterAddr, err := master.PortEndpoint(ctx, "6379/tcp", "")
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	sentinelAddr, err := sentinel.PortEndpoint(ctx, "26379/tcp", "")
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	return func() redis.UniversalClient {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    "mymaster",
+			SentinelAddrs: []string{sentinelAddr},
+			DB:            testDB(),
+			Dialer:        remapDialer(map[string]string{"6379": masterAddr}),
+		})
+	}, stop, nil
+}
+
+// clusterPorts are the ports of the cluster's masters inside its container.
+var clusterPorts = []string{"7000", "7001", "7002"}
+
+// startCluster runs a three-master cluster in one container. The nodes
+// announce their ports inside the container, so clients dial them through
+// remapDialer.
+func startCluster(ctx context.Context) (func() redis.UniversalClient, func(), error) {
+	script := ""
+	nodes := ""
+	exposed := make([]string, len(clusterPorts))
+	for i, p := range clusterPorts {
+		script += "redis-server --port " + p + " --protected-mode no --cluster-enabled yes --cluster-config-file nodes-" + p + ".conf --daemonize yes && "
+		nodes += " 127.0.0.1:" + p
+		exposed[i] = p + "/tcp"
+	}
+	script += "sleep 1 && redis-cli --cluster create" + nodes + " --cluster-yes && tail -f /dev/null"
+
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        redisImage,
+			ExposedPorts: exposed,
+			Cmd:          []string{"sh", "-c", script},
+			WaitingFor:   wait.ForLog("All 16384 slots covered"),
+		},
+		Started: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := func() { c.Terminate(ctx) }
+
+	ports := make(map[string]string, len(clusterPorts))
+	for _, p := range clusterPorts {
+		addr, err := c.PortEndpoint(ctx, nat.Port(p+"/tcp"), "")
+		if err != nil {
+			stop()
+			return nil, nil, err
+		}
+		ports[p] = addr
+	}
+	return func() redis.UniversalClient {
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:  []string{ports[clusterPorts[0]]},
+			Dialer: remapDialer(ports),
+		})
+	}, stop, nil
+}
+
+// remapDialer dials the host endpoint in ports for addresses with a
+// container-internal port, and other addresses as they are.
+func remapDialer(ports map[string]string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			if to, ok := ports[port]; ok {
+				addr = to
+			}
+		}
+		return d.DialContext(ctx, network, addr)
+	}
+}
@@ -0,0 +1,78 @@
+package limiter
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidNamespace is returned for namespaces containing hash-tag braces.
+	ErrInvalidNamespace = errors.New("namespace must not contain '{' or '}'")
+	// ErrReservedKey is returned for keys that could collide with a namespaced key.
+	ErrReservedKey = errors.New("key must not start with '{'")
+)
+
+// Key returns the bucket identifier for key within namespace.
+// Namespaced keys are wrapped in a Redis hash tag ("{acme}:user:1"), which
+// keeps them disjoint from un-namespaced keys and places all of a tenant's
+// buckets in the same cluster slot.
+func Key(namespace, key string) string {
+	if namespace == "" {
+		return key
+	}
+	return "{" + namespace + "}:" + key
+}
+
+// TenantKey returns the identifier of a namespace's aggregate bucket. It
+// shares the namespace's hash slot but can't collide with any key bucket.
+func TenantKey(namespace string) string {
+	return "{" + namespace + "}"
+}
+
+// BucketKey returns the identifier of the bucket named bucket of the key
+// whose identifier is id (see rules.Rule.Buckets); id itself when bucket
+// is empty. It shares the key's hash slot, so Redis Cluster can update
+// both in one script: ids without a hash tag, those of keys outside every
+// namespace, become one ("{user:1}#minute"). Un-namespaced keys containing
+// '}' but no hash tag can't be tagged, and so land in another slot. Keys
+// ending in '#' and a bucket name would share that bucket, so keys with
+// named buckets should avoid '#'.
+func BucketKey(id, bucket string) string {
+	if bucket == "" {
+		return id
+	}
+	if _, ok := hashTag(id); !ok && !strings.Contains(id, "}") {
+		id = "{" + id + "}"
+	}
+	return id + "#" + bucket
+}
+
+// SplitKey is the inverse of Key and TenantKey: it returns the namespace and
+// key a bucket identifier was built from (key is empty for tenant buckets).
+// The named buckets of un-namespaced keys split into no namespace and
+// their key, as "user:1#minute".
+func SplitKey(id string) (namespace, key string) {
+	if !strings.HasPrefix(id, "{") {
+		return "", id
+	}
+	end := strings.IndexByte(id, '}')
+	if end < 0 {
+		return "", id
+	}
+	if strings.HasPrefix(id[end+1:], "#") {
+		return "", id[1:end] + id[end+1:]
+	}
+	return id[1:end], strings.TrimPrefix(id[end+1:], ":")
+}
+
+// ValidateKey checks that namespace and key can be combined by Key without
+// colliding with another namespace's buckets.
+func ValidateKey(namespace, key string) error {
+	if strings.ContainsAny(namespace, "{}") {
+		return ErrInvalidNamespace
+	}
+	if strings.HasPrefix(key, "{") {
+		return ErrReservedKey
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,209 @@
+package limiter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Leaser serves very hot keys from memory. Once a key sees more than
+// threshold requests per second on this replica, it leases chunk tokens
+// from Redis at a time and answers from the lease until it runs out or
+// expires; expired leftovers are returned to the bucket. Redis load for a
+// hot key then grows with traffic/chunk instead of traffic.
+//
+// Leased tokens are unavailable to other replicas until returned, so chunk
+// should stay small relative to the bucket's burst.
+type Leaser struct {
+	tb        *TokenBucket
+	threshold int64
+	chunk     int64
+	ttl       time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*lease
+}
+
+type lease struct {
+	mu sync.Mutex
+
+	// Request rate detection, in fixed one-second windows.
+	windowStart time.Time
+	count       int64
+	hot         bool
+
+	leasing   bool // a chunk is being fetched
+	tokens    float64
+	burst     int64
+	expiresAt time.Time
+	last      Result
+}
+
+// NewLeaser creates a leaser for keys above threshold requests per second.
+func NewLeaser(tb *TokenBucket, threshold, chunk int64, ttl time.Duration) *Leaser {
+	return &Leaser{tb: tb, threshold: threshold, chunk: chunk, ttl: ttl, keys: map[string]*lease{}}
+}
+
+func (l *Leaser) get(key string) *lease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ls, ok := l.keys[key]
+	if !ok {
+		ls = &lease{windowStart: time.Now()}
+		l.keys[key] = ls
+	}
+	return ls
+}
+
+// Allow has the semantics of TokenBucket.Allow, answering from a lease
+// when key is hot.
+func (l *Leaser) Allow(ctx context.Context, key string, tokens float64, burst int64, rate float64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	if burst <= 0 {
+		burst = l.tb.defaultBurst
+	}
+	if tokens > float64(l.chunk) {
+		return l.tb.Allow(ctx, key, tokens, burst, rate)
+	}
+
+	now := time.Now()
+	ls := l.get(key)
+	ls.mu.Lock()
+	ls.observe(now, l.threshold)
+	leftover := ls.expire(now)
+	if ls.tokens >= tokens {
+		ls.tokens -= tokens
+		res := ls.result()
+		ls.mu.Unlock()
+		metrics.LeasedDecisions.Inc()
+		return res, nil
+	}
+	fetch := ls.hot && !ls.leasing
+	if fetch {
+		ls.leasing = true
+	}
+	ls.mu.Unlock()
+	l.giveBack(ctx, key, leftover, burst)
+
+	if !fetch {
+		return l.tb.Allow(ctx, key, tokens, burst, rate)
+	}
+
+	res, err := l.tb.Allow(ctx, key, float64(l.chunk), burst, rate)
+	ls.mu.Lock()
+	ls.leasing = false
+	if err == nil && res.Allowed {
+		leftover = ls.expire(time.Time{}) // a still-valid remnant is too small to matter
+		ls.tokens = float64(l.chunk) - tokens
+		ls.burst = burst
+		ls.expiresAt = time.Now().Add(l.ttl)
+		ls.last = *res
+		res = ls.result()
+		ls.mu.Unlock()
+		l.giveBack(ctx, key, leftover, burst)
+		return res, nil
+	}
+	ls.mu.Unlock()
+
+	// Not enough left for a whole chunk: decide this request alone.
+	return l.tb.Allow(ctx, key, tokens, burst, rate)
+}
+
+// observe counts a request and updates whether the key is hot. Callers
+// hold ls.mu.
+func (ls *lease) observe(now time.Time, threshold int64) {
+	if now.Sub(ls.windowStart) >= time.Second {
+		ls.hot = ls.count >= threshold
+		ls.windowStart, ls.count = now, 0
+	}
+	ls.count++
+	if ls.count >= threshold {
+		ls.hot = true
+	}
+}
+
+// expire drops a lease that has expired at now and returns its unused
+// tokens. A zero now drops the lease unconditionally. Callers hold ls.mu.
+func (ls *lease) expire(now time.Time) float64 {
+	if ls.tokens == 0 || (!now.IsZero() && now.Before(ls.expiresAt)) {
+		return 0
+	}
+	n := ls.tokens
+	ls.tokens = 0
+	return n
+}
+
+// result builds a decision served from the lease. Remaining counts the
+// leased tokens plus what Redis had left. Callers hold ls.mu.
+func (ls *lease) result() *Result {
+	res := ls.last
+	res.Allowed = true
+	res.Remaining += int64(ls.tokens)
+	res.RetryAfter = 0
+	return &res
+}
+
+func (l *Leaser) giveBack(ctx context.Context, key string, n float64, burst int64) {
+	if n == 0 {
+		return
+	}
+	if err := l.tb.Return(ctx, key, n, burst); err != nil {
+		log.Printf("failed to return %g leased tokens for %q: %v", n, key, err)
+	}
+}
+
+// Release returns expired leases to Redis and forgets idle keys. When all
+// is true, every outstanding lease is returned.
+func (l *Leaser) Release(ctx context.Context, all bool) {
+	now := time.Now()
+	l.mu.Lock()
+	type ret struct {
+		key   string
+		n     float64
+		burst int64
+	}
+	var rets []ret
+	for key, ls := range l.keys {
+		ls.mu.Lock()
+		at := now
+		if all {
+			at = time.Time{}
+		}
+		if n := ls.expire(at); n > 0 {
+			rets = append(rets, ret{key, n, ls.burst})
+		}
+		idle := ls.tokens == 0 && !ls.leasing && now.Sub(ls.windowStart) > 2*time.Second
+		ls.mu.Unlock()
+		if idle {
+			delete(l.keys, key)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, r := range rets {
+		l.giveBack(ctx, r.key, r.n, r.burst)
+	}
+}
+
+// Run releases expired leases every interval until ctx is cancelled, then
+// returns all outstanding leases.
+func (l *Leaser) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			l.Release(releaseCtx, true)
+			cancel()
+			return
+		case <-t.C:
+			l.Release(ctx, false)
+		}
+	}
+}
\ No newline at end of file
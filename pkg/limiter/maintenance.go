@@ -0,0 +1,305 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanBatch is the COUNT hint for SCAN and the max keys per UNLINK.
+const scanBatch = 500
+
+// DeleteNamespace removes every bucket and quota or window counter of
+// namespace, including its aggregate cap bucket, and returns the number of
+// keys deleted.
+func (tb *TokenBucket) DeleteNamespace(ctx context.Context, namespace string) (int64, error) {
+	// The namespace's keys all share its hash tag, so in a cluster they
+	// live on the node serving that slot.
+	var rdb redis.UniversalClient = tb.client()
+	if cc, ok := rdb.(*redis.ClusterClient); ok {
+		node, err := cc.MasterForKey(ctx, "{"+namespace+"}")
+		if err != nil {
+			return 0, fmt.Errorf("redis cluster: %w", err)
+		}
+		rdb = node
+	}
+
+	ns := escapeGlob(namespace)
+	var total int64
+	for _, pattern := range []string{"rl:{" + ns + "}*", "rlq:{" + ns + "}*", "rlw:{" + ns + "}*"} {
+		n, err := deleteMatching(ctx, rdb, pattern)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ErrNoPrefix is returned by DeletePrefix for an empty prefix outside any
+// namespace, which would match every bucket.
+var ErrNoPrefix = errors.New("namespace or prefix is required")
+
+// BulkDelete configures DeletePrefix.
+type BulkDelete struct {
+	// KeysPerSecond caps how fast keys are deleted from each Redis node, so
+	// a large sweep doesn't slow down live traffic. 0 leaves it uncapped.
+	KeysPerSecond int
+	// Quotas also deletes the quota and sliding window counters of the
+	// matching keys.
+	Quotas bool
+	// DryRun only counts the matching keys. SCAN may return a key more
+	// than once, so the count is an upper bound.
+	DryRun bool
+}
+
+// DeletePrefix removes the bucket of every key of namespace starting with
+// prefix, which refills them, and returns the number of keys deleted (or,
+// with DryRun, matched). Without a namespace, only keys outside every
+// namespace match; a namespace's aggregate cap bucket never does.
+func (tb *TokenBucket) DeletePrefix(ctx context.Context, namespace, prefix string, opts BulkDelete) (int64, error) {
+	if namespace == "" && prefix == "" {
+		return 0, ErrNoPrefix
+	}
+	if err := ValidateKey(namespace, prefix); err != nil {
+		return 0, err
+	}
+	var patterns []string
+	for _, match := range keyPatterns(namespace, prefix) {
+		patterns = append(patterns, "rl:"+match)
+		if opts.Quotas {
+			patterns = append(patterns, "rlq:"+match, "rlw:"+match)
+		}
+	}
+
+	var total atomic.Int64
+	sweepNode := func(ctx context.Context, rdb redis.UniversalClient) error {
+		for _, pattern := range patterns {
+			n, err := sweep(ctx, rdb, pattern, opts)
+			total.Add(n)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := tb.eachNode(ctx, namespace, sweepNode)
+	return total.Load(), err
+}
+
+// eachNode runs fn on every Redis node that may hold keys of namespace: the
+// only node, the one serving the namespace's hash tag, or, for keys outside
+// every namespace, each master of the cluster concurrently.
+func (tb *TokenBucket) eachNode(ctx context.Context, namespace string, fn func(ctx context.Context, rdb redis.UniversalClient) error) error {
+	rdb := tb.client()
+	cc, ok := rdb.(*redis.ClusterClient)
+	switch {
+	case !ok:
+		return fn(ctx, rdb)
+	case namespace != "":
+		// A namespace's keys share its hash tag, and so its node
+		node, err := cc.MasterForKey(ctx, "{"+namespace+"}")
+		if err != nil {
+			return fmt.Errorf("redis cluster: %w", err)
+		}
+		return fn(ctx, node)
+	default:
+		return cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	}
+}
+
+// Algorithm is the bucket algorithm the limiter runs.
+const Algorithm = "token_bucket"
+
+// BucketState is a bucket as stored in Redis.
+type BucketState struct {
+	// Exists is false for a bucket that is full, or was never used.
+	Exists    bool
+	Algorithm string
+	// Tokens is the count left as of LastRefill.
+	Tokens     float64
+	LastRefill time.Time
+	// TTL is the time left until the idle bucket expires, 0 if it never
+	// does.
+	TTL time.Duration
+	// Created and LastConsumed are when the bucket was created and tokens
+	// were last consumed from it, zero when unknown (e.g. for buckets
+	// created before they were tracked, or never consumed from).
+	Created      time.Time
+	LastConsumed time.Time
+	// RedisTime is Redis' clock, which the times above are by, as of the
+	// read.
+	RedisTime time.Time
+	// Fields holds every field of the stored hash, unparsed.
+	Fields map[string]string
+}
+
+// Inspect returns the stored state of key's bucket, without refilling it.
+func (tb *TokenBucket) Inspect(ctx context.Context, key string) (*BucketState, error) {
+	var (
+		fields *redis.MapStringStringCmd
+		ttl    *redis.DurationCmd
+		now    *redis.TimeCmd
+	)
+	_, err := tb.client().Pipelined(ctx, func(p redis.Pipeliner) error {
+		fields = p.HGetAll(ctx, "rl:"+key)
+		ttl = p.PTTL(ctx, "rl:"+key)
+		now = p.Time(ctx)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	s := &BucketState{Fields: fields.Val(), RedisTime: now.Val()}
+	if len(s.Fields) == 0 {
+		return s, nil
+	}
+	s.Exists = true
+	s.Algorithm = Algorithm
+	if s.Tokens, err = strconv.ParseFloat(s.Fields["tokens"], 64); err != nil {
+		return s, fmt.Errorf("%w: tokens %q", ErrBadResponse, s.Fields["tokens"])
+	}
+	last, err := strconv.ParseFloat(s.Fields["last_ts"], 64)
+	if err != nil {
+		return s, fmt.Errorf("%w: last_ts %q", ErrBadResponse, s.Fields["last_ts"])
+	}
+	s.LastRefill = unixTime(last)
+	if v, ok := s.Fields["created_ts"]; ok {
+		ts, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return s, fmt.Errorf("%w: created_ts %q", ErrBadResponse, v)
+		}
+		s.Created = unixTime(ts)
+	}
+	if v, ok := s.Fields["consumed_ts"]; ok {
+		ts, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return s, fmt.Errorf("%w: consumed_ts %q", ErrBadResponse, v)
+		}
+		s.LastConsumed = unixTime(ts)
+	}
+	// PTTL is negative for a key without an expiry
+	s.TTL = max(ttl.Val(), 0)
+	return s, nil
+}
+
+// unixTime converts a script's timestamp, in float seconds, to a Time.
+// Scripts store microseconds at most.
+func unixTime(ts float64) time.Time {
+	return time.UnixMicro(int64(math.Round(ts * 1e6)))
+}
+
+// deleteMatching SCANs for keys matching pattern and UNLINKs them in batches.
+func deleteMatching(ctx context.Context, rdb redis.UniversalClient, pattern string) (int64, error) {
+	return sweep(ctx, rdb, pattern, BulkDelete{})
+}
+
+// sweep SCANs for keys matching pattern and UNLINKs them in batches, or
+// only counts them, at up to opts.KeysPerSecond.
+func sweep(ctx context.Context, rdb redis.UniversalClient, pattern string, opts BulkDelete) (int64, error) {
+	var total int64
+	err := scan(ctx, rdb, pattern, opts.KeysPerSecond, func(keys []string) error {
+		if opts.DryRun {
+			total += int64(len(keys))
+			return nil
+		}
+		n, err := rdb.Unlink(ctx, keys...).Result()
+		if err != nil {
+			return fmt.Errorf("redis unlink: %w", err)
+		}
+		total += n
+		return nil
+	})
+	return total, err
+}
+
+// scan SCANs for keys matching pattern and passes them to fn in batches,
+// at up to keysPerSecond (0 leaves it uncapped).
+func scan(ctx context.Context, rdb redis.UniversalClient, pattern string, keysPerSecond int, fn func(keys []string) error) error {
+	var (
+		cursor uint64
+		seen   int64
+		count  = int64(scanBatch)
+		start  = time.Now()
+	)
+	if keysPerSecond > 0 {
+		count = min(count, int64(keysPerSecond))
+	}
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, pattern, count).Result()
+		if err != nil {
+			return fmt.Errorf("redis scan: %w", err)
+		}
+		if len(keys) > 0 {
+			if keysPerSecond > 0 {
+				// Hold each batch until the keys before it are within the cap
+				due := start.Add(time.Duration(seen) * time.Second / time.Duration(keysPerSecond))
+				if err := sleepUntil(ctx, due); err != nil {
+					return err
+				}
+			}
+			seen += int64(len(keys))
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// sleepUntil waits until t or until ctx is done.
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// keyPatterns returns the globs matching the identifiers of namespace's
+// keys starting with prefix, named buckets included.
+func keyPatterns(namespace, prefix string) []string {
+	patterns := []string{escapeGlob(Key(namespace, prefix)) + "*"}
+	if namespace == "" {
+		// Named buckets of un-namespaced keys are tagged with the key
+		patterns = append(patterns, "{"+escapeGlob(prefix)+"*}#*")
+	}
+	return patterns
+}
+
+// escapeGlob escapes Redis glob metacharacters so s matches literally.
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[]\`) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
\ No newline at end of file
@@ -0,0 +1,247 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Migration configures MigratePrefix.
+type Migration struct {
+	// Rename returns the new key of key, both without their namespace, or
+	// false to leave key where it is.
+	Rename func(key string) (string, bool)
+	// KeysPerSecond caps how fast keys are moved on each Redis node, as in
+	// BulkDelete. 0 leaves it uncapped.
+	KeysPerSecond int
+	// Quotas also moves the quota counters of the matching keys.
+	Quotas bool
+	// DryRun only counts the keys that would move.
+	DryRun bool
+}
+
+// MigrationResult counts the keys MigratePrefix renamed or left alone.
+type MigrationResult struct {
+	// Moved counts the keys moved to their new name (or, with DryRun, that
+	// would be).
+	Moved int64
+	// Skipped counts the keys left in place because their new name already
+	// holds a bucket, or isn't a valid key.
+	Skipped int64
+}
+
+// MigratePrefix moves the bucket of every key of namespace starting with
+// prefix to the key Rename maps it to, with its tokens and expiry, so a
+// change of key schema doesn't refill every bucket. A new key that already
+// has a bucket keeps it. Run it before callers switch to the new keys:
+// requests on an old key while it moves may not count. Without a
+// namespace, only keys outside every namespace match, as in DeletePrefix.
+func (tb *TokenBucket) MigratePrefix(ctx context.Context, namespace, prefix string, m Migration) (MigrationResult, error) {
+	if namespace == "" && prefix == "" {
+		return MigrationResult{}, ErrNoPrefix
+	}
+	if err := ValidateKey(namespace, prefix); err != nil {
+		return MigrationResult{}, err
+	}
+	var patterns []string
+	for _, match := range keyPatterns(namespace, prefix) {
+		patterns = append(patterns, "rl:"+match)
+		if m.Quotas {
+			patterns = append(patterns, "rlq:"+match)
+		}
+	}
+
+	var moved, skipped atomic.Int64
+	err := tb.eachNode(ctx, namespace, func(ctx context.Context, node redis.UniversalClient) error {
+		for _, pattern := range patterns {
+			err := scan(ctx, node, pattern, m.KeysPerSecond, func(keys []string) error {
+				n, s, err := tb.moveKeys(ctx, namespace, keys, m)
+				moved.Add(n)
+				skipped.Add(s)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return MigrationResult{Moved: moved.Load(), Skipped: skipped.Load()}, err
+}
+
+// move renames a Redis key.
+type move struct{ from, to string }
+
+// moveKeys moves bucket and quota keys of namespace to their new names.
+// Keys can live on any node, so it goes through the limiter's client.
+func (tb *TokenBucket) moveKeys(ctx context.Context, namespace string, keys []string, m Migration) (moved, skipped int64, err error) {
+	var moves []move
+	for _, from := range keys {
+		to, err := renameKey(namespace, from, m.Rename)
+		if err != nil {
+			log.Printf("not migrating %q: %v", from, err)
+			skipped++
+			continue
+		}
+		if to != "" {
+			moves = append(moves, move{from, to})
+		}
+	}
+	if len(moves) == 0 {
+		return moved, skipped, nil
+	}
+	rdb := tb.client()
+
+	if m.DryRun {
+		taken := make([]*redis.IntCmd, len(moves))
+		pipe := rdb.Pipeline()
+		for i, mv := range moves {
+			taken[i] = pipe.Exists(ctx, mv.to)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return moved, skipped, fmt.Errorf("redis exists: %w", err)
+		}
+		for _, cmd := range taken {
+			if cmd.Val() > 0 {
+				skipped++
+			} else {
+				moved++
+			}
+		}
+		return moved, skipped, nil
+	}
+
+	// RENAMENX moves a key atomically, with its expiry, unless the new
+	// one exists.
+	renames := make([]*redis.BoolCmd, len(moves))
+	pipe := rdb.Pipeline()
+	for i, mv := range moves {
+		renames[i] = pipe.RenameNX(ctx, mv.from, mv.to)
+	}
+	pipe.Exec(ctx) // errors are reported per command
+
+	var crossSlot []move
+	for i, cmd := range renames {
+		ok, err := cmd.Result()
+		switch {
+		case redis.HasErrorPrefix(err, "CROSSSLOT"):
+			crossSlot = append(crossSlot, moves[i])
+		case redis.HasErrorPrefix(err, "ERR no such key"):
+			// expired since the scan
+		case err != nil:
+			return moved, skipped, fmt.Errorf("redis renamenx: %w", err)
+		case ok:
+			moved++
+		default:
+			skipped++
+		}
+	}
+	if len(crossSlot) > 0 {
+		n, s, err := restoreKeys(ctx, rdb, crossSlot)
+		moved += n
+		skipped += s
+		if err != nil {
+			return moved, skipped, err
+		}
+	}
+	return moved, skipped, nil
+}
+
+// restoreKeys moves keys between hash slots of a cluster, which RENAMENX
+// can't, by copying them with DUMP and RESTORE.
+func restoreKeys(ctx context.Context, rdb redis.UniversalClient, moves []move) (moved, skipped int64, err error) {
+	dumps := make([]*redis.StringCmd, len(moves))
+	ttls := make([]*redis.DurationCmd, len(moves))
+	pipe := rdb.Pipeline()
+	for i, mv := range moves {
+		dumps[i] = pipe.Dump(ctx, mv.from)
+		ttls[i] = pipe.PTTL(ctx, mv.from)
+	}
+	pipe.Exec(ctx) // errors are reported per command
+
+	restores := make([]*redis.StatusCmd, len(moves))
+	pipe = rdb.Pipeline()
+	for i, mv := range moves {
+		dump, err := dumps[i].Result()
+		if errors.Is(err, redis.Nil) {
+			continue // expired since the scan
+		}
+		if err != nil {
+			return moved, skipped, fmt.Errorf("redis dump: %w", err)
+		}
+		// PTTL is negative for a key without an expiry, which RESTORE
+		// takes as 0
+		restores[i] = pipe.Restore(ctx, mv.to, max(ttls[i].Val(), 0), dump)
+	}
+	pipe.Exec(ctx)
+
+	pipe = rdb.Pipeline()
+	for i, cmd := range restores {
+		if cmd == nil {
+			continue
+		}
+		err := cmd.Err()
+		if redis.HasErrorPrefix(err, "BUSYKEY") {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return moved, skipped, fmt.Errorf("redis restore: %w", err)
+		}
+		// One key per command: in a cluster, the keys of a batch may be
+		// on different slots.
+		pipe.Unlink(ctx, moves[i].from)
+		moved++
+	}
+	if moved > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return moved, skipped, fmt.Errorf("redis unlink: %w", err)
+		}
+	}
+	return moved, skipped, nil
+}
+
+// renameKey returns the Redis key a bucket ("rl:" + Key(namespace, key))
+// or quota counter ("rlq:" + Key(namespace, key) + ":" + window) of
+// namespace moves to, or "" if rename leaves it in place.
+func renameKey(namespace, redisKey string, rename func(string) (string, bool)) (string, error) {
+	kind, id, _ := strings.Cut(redisKey, ":")
+	var window string
+	if kind == "rlq" {
+		i := strings.LastIndexByte(id, ':')
+		if i < 0 {
+			return "", errors.New("malformed quota counter")
+		}
+		id, window = id[:i], id[i:]
+	}
+	ns, key := SplitKey(id)
+	if ns != namespace || key == "" {
+		return "", nil
+	}
+
+	to, ok := rename(key)
+	if !ok || to == key {
+		return "", nil
+	}
+	if to == "" {
+		return "", errors.New("new key is empty")
+	}
+	if err := ValidateKey(namespace, to); err != nil {
+		return "", fmt.Errorf("new key %q: %w", to, err)
+	}
+	if namespace == "" && strings.HasPrefix(id, "{") {
+		// A named bucket, tagged with its key: so must the new one be
+		bucket := id[strings.IndexByte(id, '}')+2:]
+		base, ok := strings.CutSuffix(to, "#"+bucket)
+		if !ok {
+			return "", fmt.Errorf("new key %q drops bucket %q", to, bucket)
+		}
+		return kind + ":" + BucketKey(base, bucket) + window, nil
+	}
+	return kind + ":" + Key(namespace, to) + window, nil
+}
\ No newline at end of file
@@ -0,0 +1,93 @@
+package limiter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigratePrefix(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 3, 0.001)
+	ctx := context.Background()
+	ns := testNamespace(t)
+
+	// user_<id> becomes user:<id>
+	rename := func(key string) (string, bool) {
+		id, ok := strings.CutPrefix(key, "user_")
+		return "user:" + id, ok
+	}
+	for _, key := range []string{"user_1", "user_2", "user_3", "api_1"} {
+		_, err := tb.Allow(ctx, Key(ns, key), 2, 0, 0)
+		require.NoError(t, err)
+	}
+	_, err := tb.Quota(ctx, Key(ns, "user_1"), 4, 5, time.Hour)
+	require.NoError(t, err)
+	// user:3 already moved on its own
+	_, err = tb.Allow(ctx, Key(ns, "user:3"), 1, 0, 0)
+	require.NoError(t, err)
+
+	res, err := tb.MigratePrefix(ctx, ns, "user_", Migration{Rename: rename, Quotas: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{Moved: 3, Skipped: 1}, res)
+	st, err := tb.Inspect(ctx, Key(ns, "user:1"))
+	require.NoError(t, err)
+	assert.False(t, st.Exists, "a dry run moved keys")
+
+	res, err = tb.MigratePrefix(ctx, ns, "user_", Migration{Rename: rename, Quotas: true, KeysPerSecond: 100})
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{Moved: 3, Skipped: 1}, res)
+
+	// Buckets keep their tokens and expiry under their new key
+	for _, id := range []string{"1", "2"} {
+		st, err := tb.Inspect(ctx, Key(ns, "user:"+id))
+		require.NoError(t, err)
+		assert.True(t, st.Exists)
+		assert.InDelta(t, 1, st.Tokens, 0.01)
+		assert.Positive(t, st.TTL)
+		st, err = tb.Inspect(ctx, Key(ns, "user_"+id))
+		require.NoError(t, err)
+		assert.False(t, st.Exists, "old bucket left behind")
+	}
+	q, err := tb.Quota(ctx, Key(ns, "user:1"), 1, 5, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), q.Remaining, "quota counter didn't move")
+
+	// A taken key keeps its bucket, and the old one stays
+	st, err = tb.Inspect(ctx, Key(ns, "user:3"))
+	require.NoError(t, err)
+	assert.InDelta(t, 2, st.Tokens, 0.01)
+	st, err = tb.Inspect(ctx, Key(ns, "user_3"))
+	require.NoError(t, err)
+	assert.True(t, st.Exists)
+	// Other prefixes are untouched
+	st, err = tb.Inspect(ctx, Key(ns, "api_1"))
+	require.NoError(t, err)
+	assert.True(t, st.Exists)
+
+	_, err = tb.MigratePrefix(ctx, "", "", Migration{Rename: rename})
+	assert.ErrorIs(t, err, ErrNoPrefix)
+
+	// Named buckets of un-namespaced keys stay tagged with their key
+	from := BucketKey(testKey(t, "user_1"), "minute")
+	_, err = tb.Allow(ctx, from, 2, 0, 0)
+	require.NoError(t, err)
+	res, err = tb.MigratePrefix(ctx, "", testKey(t, "user_"), Migration{Rename: func(key string) (string, bool) {
+		return strings.Replace(key, "user_", "user:", 1), true
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{Moved: 1}, res)
+	st, err = tb.Inspect(ctx, BucketKey(testKey(t, "user:1"), "minute"))
+	require.NoError(t, err)
+	assert.InDelta(t, 1, st.Tokens, 0.01)
+
+	// Keys that would collide with another namespace's are skipped
+	res, err = tb.MigratePrefix(ctx, ns, "api_", Migration{Rename: func(string) (string, bool) { return "{other}:x", true }})
+	require.NoError(t, err)
+	assert.Equal(t, MigrationResult{Skipped: 1}, res)
+}
\ No newline at end of file
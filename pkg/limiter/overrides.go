@@ -0,0 +1,186 @@
+package limiter
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SumsFile is the file in a script override directory pinning the SHA-256
+// of every override, as written by `sha256sum *.lua > SHA256SUMS`.
+const SumsFile = "SHA256SUMS"
+
+// embeddedScripts are the scripts built into the binary, by file name.
+var embeddedScripts = map[string]string{
+	"token_bucket.lua":        tokenBucketScript,
+	"token_bucket_multi.lua":  tokenBucketMultiScript,
+	"token_bucket_batch.lua":  tokenBucketBatchScript,
+	"token_bucket_peek.lua":   tokenBucketPeekScript,
+	"quota.lua":               quotaScript,
+	"token_bucket_return.lua": tokenBucketReturnScript,
+	"sliding_window.lua":      slidingWindowScript,
+}
+
+// Scripts is the Lua source the limiter runs: the embedded scripts, some
+// of them possibly replaced by files loaded with LoadScripts.
+type Scripts struct {
+	src        map[string]string
+	overridden []string
+}
+
+// LoadScripts reads script overrides from dir. Each .lua file replaces the
+// embedded script of the same name; scripts without a file stay embedded.
+// Every file must be pinned in dir's SumsFile, and every pin must match its
+// file, so a stray or half-edited script can't change how buckets behave.
+func LoadScripts(dir string) (*Scripts, error) {
+	pins, err := readSums(filepath.Join(dir, SumsFile))
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scripts{src: make(map[string]string, len(embeddedScripts))}
+	for name, src := range embeddedScripts {
+		s.src[name] = src
+	}
+	for _, path := range files {
+		name := filepath.Base(path)
+		if _, ok := embeddedScripts[name]; !ok {
+			return nil, fmt.Errorf("%s: not one of the limiter's scripts", path)
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pin, ok := pins[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: not pinned in %s", path, SumsFile)
+		}
+		if sum := sha256.Sum256(b); hex.EncodeToString(sum[:]) != pin {
+			return nil, fmt.Errorf("%s: SHA-256 doesn't match its pin in %s", path, SumsFile)
+		}
+		delete(pins, name)
+		s.src[name] = string(b)
+		s.overridden = append(s.overridden, name)
+	}
+	if len(pins) > 0 {
+		missing := make([]string, 0, len(pins))
+		for name := range pins {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%s pins %s, missing from %s", SumsFile, strings.Join(missing, ", "), dir)
+	}
+	sort.Strings(s.overridden)
+	return s, nil
+}
+
+// ErrNotPinned is returned by CheckPinned for a source that isn't the
+// version pinned.
+var ErrNotPinned = errors.New("not pinned")
+
+// CheckPinned checks that src is the version of the script named name
+// pinned in dir's SumsFile. The file is read on every call, so pins added
+// since LoadScripts count.
+func CheckPinned(dir, name, src string) error {
+	pins, err := readSums(filepath.Join(dir, SumsFile))
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256([]byte(src)); pins[name] != hex.EncodeToString(sum[:]) {
+		return fmt.Errorf("%s: %w in %s", name, ErrNotPinned, SumsFile)
+	}
+	return nil
+}
+
+// readSums parses a sha256sum listing into lowercase hex sums by file name.
+func readSums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pins := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, ok := strings.Cut(line, " ")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		if b, err := hex.DecodeString(sum); !ok || err != nil || len(b) != sha256.Size || name == "" {
+			return nil, fmt.Errorf("%s:%d: want \"<sha256>  <file>\"", path, n)
+		}
+		pins[name] = strings.ToLower(sum)
+	}
+	return pins, sc.Err()
+}
+
+// Overridden returns the names of the scripts loaded from files.
+func (s *Scripts) Overridden() []string {
+	if s == nil {
+		return nil
+	}
+	return s.overridden
+}
+
+// source returns the script named name, embedded unless overridden.
+func (s *Scripts) source(name string) string {
+	if s == nil {
+		return embeddedScripts[name]
+	}
+	return s.src[name]
+}
+
+// WithScripts makes the limiter run s instead of the embedded scripts.
+func WithScripts(s *Scripts) Option {
+	return func(tb *TokenBucket) { tb.sources = s }
+}
+
+// ValidateScripts has Redis compile every script, then runs the token
+// bucket script on the warm-up bucket to check its response is shaped as
+// Allow expects. Run it before serving with overridden scripts.
+func (tb *TokenBucket) ValidateScripts(ctx context.Context) error {
+	rdb := tb.client()
+	scripts := tb.scripts()
+	for _, s := range []struct {
+		name   string
+		script *redis.Script
+	}{
+		{"token_bucket.lua", scripts.script},
+		{"token_bucket_multi.lua", scripts.multi},
+		{"token_bucket_batch.lua", scripts.batch},
+		{"token_bucket_peek.lua", scripts.peek},
+		{"quota.lua", scripts.quota},
+		{"token_bucket_return.lua", scripts.ret},
+		{"sliding_window.lua", scripts.sliding},
+	} {
+		if err := s.script.Load(ctx, rdb).Err(); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+
+	// Requesting no tokens leaves the bucket as it is.
+	raw, err := scripts.script.Run(ctx, rdb, []string{"rl:" + warmupKey}, 1, 1, 0).Result()
+	if err != nil {
+		return fmt.Errorf("token_bucket.lua: %w", err)
+	}
+	if _, err := decodeResponse(raw, 5); err != nil {
+		return fmt.Errorf("token_bucket.lua: %w", err)
+	}
+	return nil
+}
\ No newline at end of file
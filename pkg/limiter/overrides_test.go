@@ -0,0 +1,156 @@
+package limiter
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeOverrides writes scripts into a new directory, pinning those in
+// pinned with their real sums.
+func writeOverrides(t *testing.T, scripts map[string]string, pinned ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	var sums strings.Builder
+	for name, src := range scripts {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644))
+	}
+	for _, name := range pinned {
+		sum := sha256.Sum256([]byte(scripts[name]))
+		sums.WriteString(hex.EncodeToString(sum[:]) + "  " + name + "\n")
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, SumsFile), []byte(sums.String()), 0o644))
+	return dir
+}
+
+func TestEmbeddedScripts(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(scriptsDir, "*.lua"))
+	require.NoError(t, err)
+	require.Len(t, embeddedScripts, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		require.NoError(t, err)
+		assert.Equal(t, string(b), embeddedScripts[filepath.Base(f)], "%s can't be overridden", f)
+	}
+}
+
+func TestLoadScripts(t *testing.T) {
+	t.Parallel()
+	// Every bucket holds a single token, whatever its burst
+	patched := strings.Replace(tokenBucketScript, "local capacity  = tonumber(ARGV[1])", "local capacity  = 1", 1)
+	require.NotEqual(t, tokenBucketScript, patched)
+
+	dir := writeOverrides(t, map[string]string{"token_bucket.lua": patched}, "token_bucket.lua")
+	scripts, err := LoadScripts(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token_bucket.lua"}, scripts.Overridden())
+	assert.Equal(t, quotaScript, scripts.source("quota.lua"))
+
+	rdb := testRedis(t)
+	ctx := context.Background()
+	tb := New(rdb, 5, 0.001, WithScripts(scripts))
+	require.NoError(t, tb.ValidateScripts(ctx))
+	key := testKey(t, "patched")
+	res, err := tb.Allow(ctx, key, 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = tb.Allow(ctx, key, 1, 0, 0)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+
+	// No overrides at all
+	scripts, err = LoadScripts(writeOverrides(t, nil))
+	require.NoError(t, err)
+	assert.Empty(t, scripts.Overridden())
+}
+
+func TestLoadScripts_Pins(t *testing.T) {
+	src := map[string]string{"quota.lua": quotaScript + "\n-- patched\n"}
+	for name, tc := range map[string]struct {
+		dir  func(t *testing.T) string
+		want string
+	}{
+		"NoSums": {
+			dir:  func(t *testing.T) string { return t.TempDir() },
+			want: SumsFile,
+		},
+		"Unpinned": {
+			dir:  func(t *testing.T) string { return writeOverrides(t, src) },
+			want: "not pinned",
+		},
+		"Mismatch": {
+			dir: func(t *testing.T) string {
+				dir := writeOverrides(t, src, "quota.lua")
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "quota.lua"), []byte(quotaScript), 0o644))
+				return dir
+			},
+			want: "doesn't match",
+		},
+		"PinnedButMissing": {
+			dir: func(t *testing.T) string {
+				dir := writeOverrides(t, src, "quota.lua")
+				require.NoError(t, os.Remove(filepath.Join(dir, "quota.lua")))
+				return dir
+			},
+			want: "missing",
+		},
+		"UnknownScript": {
+			dir: func(t *testing.T) string {
+				return writeOverrides(t, map[string]string{"leaky_bucket.lua": "return 1"}, "leaky_bucket.lua")
+			},
+			want: "not one of the limiter's scripts",
+		},
+		"MalformedSums": {
+			dir: func(t *testing.T) string {
+				dir := writeOverrides(t, nil)
+				require.NoError(t, os.WriteFile(filepath.Join(dir, SumsFile), []byte("abc quota.lua\n"), 0o644))
+				return dir
+			},
+			want: "want",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadScripts(tc.dir(t))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+}
+
+func TestCheckPinned(t *testing.T) {
+	t.Parallel()
+	fixed := tokenBucketScript + "\n-- fixed\n"
+	dir := writeOverrides(t, map[string]string{"token_bucket.lua": fixed}, "token_bucket.lua")
+
+	require.NoError(t, CheckPinned(dir, "token_bucket.lua", fixed))
+	assert.ErrorIs(t, CheckPinned(dir, "token_bucket.lua", tokenBucketScript), ErrNotPinned)
+	assert.ErrorIs(t, CheckPinned(dir, "quota.lua", fixed), ErrNotPinned)
+	assert.Error(t, CheckPinned(t.TempDir(), "token_bucket.lua", fixed))
+}
+
+func TestValidateScripts(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	ctx := context.Background()
+	require.NoError(t, New(rdb, 5, 1).ValidateScripts(ctx))
+
+	for name, src := range map[string]string{
+		"SyntaxError": "return {",
+		"WrongShape":  "return 'ok'",
+	} {
+		t.Run(name, func(t *testing.T) {
+			scripts, err := LoadScripts(writeOverrides(t, map[string]string{"token_bucket.lua": src}, "token_bucket.lua"))
+			require.NoError(t, err)
+			err = New(rdb, 5, 1, WithScripts(scripts)).ValidateScripts(ctx)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "token_bucket.lua")
+		})
+	}
+}
\ No newline at end of file
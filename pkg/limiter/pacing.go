@@ -0,0 +1,44 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// pacePrefix prefixes the markers of paced keys, each holding the key back
+// until its next request may pass. Markers expire when it may.
+const pacePrefix = "rlp:"
+
+// Pace admits tokens of key when its last admission is at least its spacing
+// behind, holding the next one back for tokens intervals (tokens <= 0 counts
+// as 1). Denials return the exact wait.
+func (tb *TokenBucket) Pace(ctx context.Context, key string, tokens float64, interval time.Duration) (bool, time.Duration, error) {
+	hold := time.Duration(max(tokens, 1) * float64(interval))
+	ok, err := tb.client().SetNX(ctx, pacePrefix+key, 1, hold).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return false, 0, fmt.Errorf("redis set: %w", err)
+	}
+	if ok {
+		return true, 0, nil
+	}
+	wait, err := tb.client().PTTL(ctx, pacePrefix+key).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return false, 0, fmt.Errorf("redis pttl: %w", err)
+	}
+	return false, max(wait, 0), nil
+}
+
+// Unpace releases the hold of key's last admission, e.g. when its buckets
+// denied it after all.
+func (tb *TokenBucket) Unpace(ctx context.Context, key string) error {
+	if err := tb.client().Del(ctx, pacePrefix+key).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis del: %w", err)
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,194 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Admission queues hold the tickets of requests waiting for a key's
+// tokens, in a sorted set scored by when they were enqueued. Each ticket
+// has a hash holding its key, score and request and, once admitted, its
+// response, plus a claim marker while a waiter tries admitting it. Ticket
+// hashes expire unless their waiters keep touching them, and tickets whose
+// hash expired are dropped from the queue when they reach its head, so
+// abandoned requests don't hold the queue up.
+const (
+	admissionPrefix = "rla:"
+	ticketPrefix    = "rlt:"
+)
+
+var (
+	// ErrQueueFull is returned by Enqueue when the key's queue is full.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrNoTicket is returned for tickets that expired or never existed.
+	ErrNoTicket = errors.New("no such ticket")
+	// ErrNotQueued is returned by QueuePosition for tickets that left the
+	// queue, admitted or dropped.
+	ErrNotQueued = errors.New("ticket is not queued")
+)
+
+// Ticket is a request's place in its key's admission queue.
+type Ticket struct {
+	ID string
+	// Key is the bucket key the request waits for.
+	Key string
+	// Since is when the request was enqueued, in Unix milliseconds. It
+	// orders the queue.
+	Since int64
+	// Request is the encoded request, for whichever process admits it.
+	Request []byte
+	// Response is the encoded response once the request was admitted.
+	Response []byte
+}
+
+// Enqueue appends t to its key's queue, unless max tickets are already
+// waiting, and returns how many are ahead of it. The ticket expires after
+// ttl unless touched by QueuePosition.
+func (tb *TokenBucket) Enqueue(ctx context.Context, t *Ticket, max int64, ttl time.Duration) (int64, error) {
+	rdb := tb.client()
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, ticketPrefix+t.ID, "key", t.Key, "since", t.Since, "req", t.Request)
+	pipe.PExpire(ctx, ticketPrefix+t.ID, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		metrics.RedisErrors.Inc()
+		return 0, fmt.Errorf("redis hset: %w", err)
+	}
+
+	// Adding then ranking in one transaction keeps concurrent enqueues
+	// from overfilling the queue.
+	pipe = rdb.TxPipeline()
+	pipe.ZAdd(ctx, admissionPrefix+t.Key, redis.Z{Score: float64(t.Since), Member: t.ID})
+	rank := pipe.ZRank(ctx, admissionPrefix+t.Key, t.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		metrics.RedisErrors.Inc()
+		return 0, fmt.Errorf("redis zadd: %w", err)
+	}
+	if rank.Val() < max {
+		return rank.Val(), nil
+	}
+	if err := tb.dropTicket(ctx, t); err != nil {
+		return 0, err
+	}
+	return 0, ErrQueueFull
+}
+
+// LoadTicket returns ticket id.
+func (tb *TokenBucket) LoadTicket(ctx context.Context, id string) (*Ticket, error) {
+	fields, err := tb.client().HGetAll(ctx, ticketPrefix+id).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return nil, fmt.Errorf("redis hgetall: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrNoTicket
+	}
+	t := &Ticket{ID: id, Key: fields["key"], Request: []byte(fields["req"])}
+	if t.Since, err = strconv.ParseInt(fields["since"], 10, 64); err != nil {
+		return nil, fmt.Errorf("%w: since %q", ErrBadResponse, fields["since"])
+	}
+	if resp, ok := fields["resp"]; ok {
+		t.Response = []byte(resp)
+	}
+	return t, nil
+}
+
+// QueuePosition returns how many tickets are ahead of t, keeping it from
+// expiring for another ttl. A ticket found abandoned at the head of the
+// queue is dropped on the way.
+func (tb *TokenBucket) QueuePosition(ctx context.Context, t *Ticket, ttl time.Duration) (int64, error) {
+	rdb := tb.client()
+	pipe := rdb.Pipeline()
+	pipe.PExpire(ctx, ticketPrefix+t.ID, ttl)
+	rank := pipe.ZRank(ctx, admissionPrefix+t.Key, t.ID)
+	head := pipe.ZRange(ctx, admissionPrefix+t.Key, 0, 0)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		metrics.RedisErrors.Inc()
+		return 0, fmt.Errorf("redis zrank: %w", err)
+	}
+	if errors.Is(rank.Err(), redis.Nil) {
+		return 0, ErrNotQueued
+	}
+	pos := rank.Val()
+	if pos == 0 || len(head.Val()) == 0 {
+		return pos, nil
+	}
+
+	first := head.Val()[0]
+	n, err := rdb.Exists(ctx, ticketPrefix+first).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return 0, fmt.Errorf("redis exists: %w", err)
+	}
+	if n == 0 {
+		// Whoever removes it moves everyone up
+		if err := rdb.ZRem(ctx, admissionPrefix+t.Key, first).Err(); err != nil {
+			metrics.RedisErrors.Inc()
+			return 0, fmt.Errorf("redis zrem: %w", err)
+		}
+		pos--
+	}
+	return pos, nil
+}
+
+// ClaimTicket reserves t for this waiter to try admitting it, for up to
+// ttl, keeping other waiters on t from charging it too. It reports false
+// when another waiter holds t.
+func (tb *TokenBucket) ClaimTicket(ctx context.Context, t *Ticket, ttl time.Duration) (bool, error) {
+	ok, err := tb.client().SetNX(ctx, ticketPrefix+t.ID+":claim", 1, ttl).Result()
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return false, fmt.Errorf("redis set: %w", err)
+	}
+	return ok, nil
+}
+
+// ReleaseTicket releases t's claim after its key's limits denied it.
+func (tb *TokenBucket) ReleaseTicket(ctx context.Context, t *Ticket) error {
+	if err := tb.client().Del(ctx, ticketPrefix+t.ID+":claim").Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis del: %w", err)
+	}
+	return nil
+}
+
+// AdmitTicket records resp as the response to claimed ticket t, keeping it
+// for ttl for waiters resuming on t, and takes t out of its queue.
+func (tb *TokenBucket) AdmitTicket(ctx context.Context, t *Ticket, resp []byte, ttl time.Duration) error {
+	// Recorded first, so that tickets gone from their queue have one
+	pipe := tb.client().TxPipeline()
+	pipe.HSet(ctx, ticketPrefix+t.ID, "resp", resp)
+	pipe.PExpire(ctx, ticketPrefix+t.ID, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis hset: %w", err)
+	}
+	t.Response = resp
+
+	pipe = tb.client().Pipeline()
+	pipe.ZRem(ctx, admissionPrefix+t.Key, t.ID)
+	pipe.Del(ctx, ticketPrefix+t.ID+":claim")
+	if _, err := pipe.Exec(ctx); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis zrem: %w", err)
+	}
+	return nil
+}
+
+// dropTicket removes t from its queue and forgets it.
+func (tb *TokenBucket) dropTicket(ctx context.Context, t *Ticket) error {
+	pipe := tb.client().Pipeline()
+	pipe.ZRem(ctx, admissionPrefix+t.Key, t.ID)
+	pipe.Del(ctx, ticketPrefix+t.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis zrem: %w", err)
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,155 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queueRedis returns a miniredis, whose clock expires tickets on demand, and
+// a client for it.
+func queueRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return mr, rdb
+}
+
+func TestEnqueue_Full(t *testing.T) {
+	mr, rdb := queueRedis(t)
+	tb := New(rdb, 5, 1)
+	ctx := context.Background()
+
+	for i, id := range []string{"a", "b"} {
+		pos, err := tb.Enqueue(ctx, &Ticket{ID: id, Key: "user:1", Since: int64(i)}, 2, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i), pos)
+	}
+
+	// The ticket over the limit is dropped, leaving the queue as it was
+	_, err := tb.Enqueue(ctx, &Ticket{ID: "c", Key: "user:1", Since: 2}, 2, time.Minute)
+	assert.ErrorIs(t, err, ErrQueueFull)
+	assert.False(t, mr.Exists(ticketPrefix+"c"))
+	members, err := mr.ZMembers(admissionPrefix + "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, members)
+	_, err = tb.LoadTicket(ctx, "c")
+	assert.ErrorIs(t, err, ErrNoTicket)
+
+	// Other keys have queues of their own
+	pos, err := tb.Enqueue(ctx, &Ticket{ID: "d", Key: "user:2", Since: 3}, 2, time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, pos)
+}
+
+func TestQueuePosition_ExpiredHead(t *testing.T) {
+	mr, rdb := queueRedis(t)
+	tb := New(rdb, 5, 1)
+	ctx := context.Background()
+
+	abandoned := &Ticket{ID: "a", Key: "user:1", Since: 1}
+	waiting := &Ticket{ID: "b", Key: "user:1", Since: 2}
+	_, err := tb.Enqueue(ctx, abandoned, 10, time.Second)
+	require.NoError(t, err)
+	_, err = tb.Enqueue(ctx, waiting, 10, time.Minute)
+	require.NoError(t, err)
+
+	pos, err := tb.QueuePosition(ctx, waiting, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pos, "the head is still alive")
+
+	// Its waiter stopped touching it, so it is skipped and dropped
+	mr.FastForward(2 * time.Second)
+	pos, err = tb.QueuePosition(ctx, waiting, time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, pos)
+	members, err := mr.ZMembers(admissionPrefix + "user:1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, members)
+	_, err = tb.QueuePosition(ctx, abandoned, time.Minute)
+	assert.ErrorIs(t, err, ErrNotQueued)
+}
+
+func TestClaimTicket(t *testing.T) {
+	mr, rdb := queueRedis(t)
+	tb := New(rdb, 5, 1)
+	ctx := context.Background()
+	ticket := &Ticket{ID: "a", Key: "user:1", Since: 1}
+	_, err := tb.Enqueue(ctx, ticket, 10, time.Minute)
+	require.NoError(t, err)
+
+	ok, err := tb.ClaimTicket(ctx, ticket, time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = tb.ClaimTicket(ctx, ticket, time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok, "a second waiter may not claim it")
+
+	// Released or lapsed claims can be taken again
+	require.NoError(t, tb.ReleaseTicket(ctx, ticket))
+	ok, err = tb.ClaimTicket(ctx, ticket, time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	mr.FastForward(2 * time.Second)
+	ok, err = tb.ClaimTicket(ctx, ticket, time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// failHook fails every pipeline carrying cmd.
+type failHook struct{ cmd string }
+
+func (h failHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h failHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (h failHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			if cmd.Name() == h.cmd {
+				return errors.New("connection reset")
+			}
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestAdmitTicket(t *testing.T) {
+	mr, rdb := queueRedis(t)
+	tb := New(rdb, 5, 1)
+	ctx := context.Background()
+	ticket := &Ticket{ID: "a", Key: "user:1", Since: 1, Request: []byte("req")}
+	_, err := tb.Enqueue(ctx, ticket, 10, time.Minute)
+	require.NoError(t, err)
+	ok, err := tb.ClaimTicket(ctx, ticket, time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// The response is recorded before the ticket leaves its queue, so a
+	// failure in between leaves it queued with its response
+	failing := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer failing.Close()
+	failing.AddHook(failHook{cmd: "zrem"})
+	require.Error(t, New(failing, 5, 1).AdmitTicket(ctx, ticket, []byte("resp"), time.Hour))
+	loaded, err := tb.LoadTicket(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("resp"), loaded.Response)
+	_, err = tb.QueuePosition(ctx, ticket, time.Minute)
+	require.NoError(t, err, "still queued")
+
+	require.NoError(t, tb.AdmitTicket(ctx, ticket, []byte("resp"), time.Hour))
+	_, err = tb.QueuePosition(ctx, ticket, time.Hour)
+	assert.ErrorIs(t, err, ErrNotQueued)
+	assert.False(t, mr.Exists(ticketPrefix+"a:claim"))
+	loaded, err = tb.LoadTicket(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("req"), loaded.Request)
+	assert.Equal(t, []byte("resp"), loaded.Response)
+	assert.Equal(t, time.Hour, mr.TTL(ticketPrefix+"a"), "kept for resuming waiters")
+}
\ No newline at end of file
@@ -0,0 +1,187 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrUnknownScript is returned by ReloadScript for a name that isn't
+	// one of the limiter's scripts.
+	ErrUnknownScript = errors.New("not one of the limiter's scripts")
+	// ErrScriptRejected is returned by ReloadScript for a script that
+	// doesn't compile or fails its checks.
+	ErrScriptRejected = errors.New("script rejected")
+)
+
+// reloadKey prefixes the scratch buckets new script versions are checked
+// against. Keys can't start with '{', so they can't collide with a caller's.
+const reloadKey = "{}:reload:"
+
+// scriptSet is the scripts the limiter runs. ReloadScript swaps it whole.
+type scriptSet struct {
+	script, multi, batch, peek, quota, ret, sliding *redis.Script
+}
+
+// named returns the field holding the script named name, or nil.
+func (s *scriptSet) named(name string) **redis.Script {
+	switch name {
+	case "token_bucket.lua":
+		return &s.script
+	case "token_bucket_multi.lua":
+		return &s.multi
+	case "token_bucket_batch.lua":
+		return &s.batch
+	case "token_bucket_peek.lua":
+		return &s.peek
+	case "quota.lua":
+		return &s.quota
+	case "token_bucket_return.lua":
+		return &s.ret
+	case "sliding_window.lua":
+		return &s.sliding
+	}
+	return nil
+}
+
+// all returns every script in the set.
+func (s *scriptSet) all() []*redis.Script {
+	return []*redis.Script{s.script, s.multi, s.batch, s.peek, s.quota, s.ret, s.sliding}
+}
+
+// ReloadScript replaces the script named name, e.g. "token_bucket.lua", with
+// src while the limiter serves, so a fix to the algorithm ships without a
+// restart. Redis compiles src and runs it against a scratch bucket first:
+// only if it behaves as the limiter expects do calls switch to it. Calls
+// already running finish on the previous version. It returns the SHA-1 of
+// the new version and of the one it replaced.
+//
+// The new version lasts until the process exits; restarts run the embedded
+// script, or its override, again.
+func (tb *TokenBucket) ReloadScript(ctx context.Context, name, src string) (sha, prev string, err error) {
+	old := tb.scripts()
+	if old.named(name) == nil {
+		return "", "", fmt.Errorf("%s: %w", name, ErrUnknownScript)
+	}
+	next := *old
+	script := redis.NewScript(src)
+	*next.named(name) = script
+
+	if err := script.Load(ctx, tb.client()).Err(); err != nil {
+		return "", "", reloadError(name, err)
+	}
+	if err := tb.checkScript(ctx, name, &next); err != nil {
+		return "", "", reloadError(name, err)
+	}
+
+	if !tb.lua.CompareAndSwap(old, &next) {
+		return "", "", fmt.Errorf("%s: another script was reloaded concurrently", name)
+	}
+	return script.Hash(), (*old.named(name)).Hash(), nil
+}
+
+// reloadError wraps the errors of a script itself, as answered by Redis or
+// found in its responses, in ErrScriptRejected. Others, e.g. Redis being
+// unreachable, don't say anything about the script.
+func reloadError(name string, err error) error {
+	var rerr redis.Error
+	if !errors.Is(err, ErrScriptRejected) && (errors.As(err, &rerr) || errors.Is(err, ErrBadResponse)) {
+		return fmt.Errorf("%s: %w: %v", name, ErrScriptRejected, err)
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// checkScript runs the script named name from set against a scratch bucket
+// of two tokens that never refills, and checks that it admits and denies
+// the way the limiter expects.
+func (tb *TokenBucket) checkScript(ctx context.Context, name string, set *scriptSet) error {
+	probe := &TokenBucket{
+		defaultBurst: tb.defaultBurst,
+		defaultRate:  tb.defaultRate,
+		burstArg:     tb.burstArg,
+		rateArg:      tb.rateArg,
+		clock:        tb.clock,
+	}
+	probe.rdb.Store(tb.rdb.Load())
+	probe.lua.Store(set)
+
+	key := reloadKey + name + ":" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	// Quota windows expire on their own.
+	defer tb.client().Del(context.WithoutCancel(ctx), "rl:"+key, "rlw:"+key)
+
+	// allow consumes tokens with the script being checked.
+	var allow func(tokens float64) (*Result, error)
+	switch name {
+	case "token_bucket.lua":
+		allow = func(tokens float64) (*Result, error) {
+			return probe.Allow(ctx, key, tokens, 2, 0)
+		}
+	case "token_bucket_multi.lua":
+		allow = func(tokens float64) (*Result, error) {
+			res, _, err := probe.AllowAll(ctx, []Bucket{{Key: key, Burst: 2, Rate: 0}}, tokens)
+			return res, err
+		}
+	case "token_bucket_batch.lua":
+		allow = func(tokens float64) (*Result, error) {
+			r := probe.AllowBatch(ctx, []Check{{Key: key, Tokens: tokens, Burst: 2, Rate: 0}})[0]
+			return r.Result, r.Err
+		}
+	case "quota.lua":
+		allow = func(tokens float64) (*Result, error) {
+			return probe.Quota(ctx, key, tokens, 2, time.Hour)
+		}
+	case "sliding_window.lua":
+		allow = func(tokens float64) (*Result, error) {
+			return probe.SlidingWindow(ctx, key, tokens, 2, time.Hour, 60)
+		}
+	case "token_bucket_peek.lua":
+		// Peeks see what Allow leaves without consuming anything.
+		if err := decision(probe.PeekTokens(ctx, key, 2, 2, 0))(true, 2); err != nil {
+			return err
+		}
+		if err := decision(probe.Allow(ctx, key, 1, 2, 0))(true, 1); err != nil {
+			return err
+		}
+		if err := decision(probe.PeekTokens(ctx, key, 2, 2, 0))(false, 1); err != nil {
+			return err
+		}
+		return decision(probe.PeekTokens(ctx, key, 1, 2, 0))(true, 1)
+	case "token_bucket_return.lua":
+		// Empty the bucket, give one token back, and expect to get it.
+		if err := decision(probe.Allow(ctx, key, 2, 2, 0))(true, 0); err != nil {
+			return err
+		}
+		if err := probe.Return(ctx, key, 1, 2); err != nil {
+			return err
+		}
+		return decision(probe.Allow(ctx, key, 1, 2, 0))(true, 0)
+	}
+
+	if err := decision(allow(1))(true, 1); err != nil {
+		return err
+	}
+	if err := decision(allow(2))(false, 1); err != nil {
+		return err
+	}
+	return decision(allow(1))(true, 0)
+}
+
+// decision returns a function checking that res, returned with err, has the
+// given decision and remaining tokens.
+func decision(res *Result, err error) func(allowed bool, remaining int64) error {
+	return func(allowed bool, remaining int64) error {
+		if err != nil {
+			return err
+		}
+		if res.Allowed != allowed || res.Remaining != remaining {
+			return fmt.Errorf("%w: scratch bucket got allowed=%t remaining=%d, want allowed=%t remaining=%d",
+				ErrScriptRejected, res.Allowed, res.Remaining, allowed, remaining)
+		}
+		return nil
+	}
+}
\ No newline at end of file
@@ -0,0 +1,56 @@
+package limiter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadScript(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	ctx := context.Background()
+	tb := New(rdb, 5, 0.001)
+
+	// Every embedded script passes its own checks
+	for name, src := range embeddedScripts {
+		sha, prev, err := tb.ReloadScript(ctx, name, src)
+		require.NoError(t, err, name)
+		assert.Equal(t, prev, sha, name)
+	}
+	keys, err := rdb.Keys(ctx, "rl:"+reloadKey+"*").Result()
+	require.NoError(t, err)
+	assert.Empty(t, keys, "scratch buckets are deleted")
+
+	fixed := tokenBucketScript + "\n-- fixed\n"
+	before := tb.scripts().script.Hash()
+	sha, prev, err := tb.ReloadScript(ctx, "token_bucket.lua", fixed)
+	require.NoError(t, err)
+	assert.Equal(t, before, prev)
+	assert.NotEqual(t, prev, sha)
+	assert.Equal(t, sha, tb.scripts().script.Hash())
+	res, err := tb.Allow(ctx, testKey(t, "fixed"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	for name, tc := range map[string]struct {
+		script, src string
+		want        error
+	}{
+		"SyntaxError": {"token_bucket.lua", "return {", ErrScriptRejected},
+		"WrongShape":  {"quota.lua", "return 'ok'", ErrScriptRejected},
+		// Every bucket holds a single token, whatever its burst
+		"WrongBehavior": {"token_bucket.lua", strings.Replace(tokenBucketScript, "local capacity  = tonumber(ARGV[1])", "local capacity  = 1", 1), ErrScriptRejected},
+		"NoReturn":      {"token_bucket_return.lua", "return 0", ErrScriptRejected},
+		"Unknown":       {"leaky_bucket.lua", "return 1", ErrUnknownScript},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := tb.ReloadScript(ctx, tc.script, tc.src)
+			require.ErrorIs(t, err, tc.want)
+			assert.Equal(t, sha, tb.scripts().script.Hash(), "the previous version stays in use")
+		})
+	}
+}
\ No newline at end of file
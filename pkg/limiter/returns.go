@@ -0,0 +1,77 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// returnLeasePrefix prefixes the records of tokens leased to clients that
+// may give back those they don't use. A record holds how many are left to
+// give back.
+const returnLeasePrefix = "rll:"
+
+// ErrNoLease is returned by SpendLease for leases that expired, were spent
+// or never existed.
+var ErrNoLease = errors.New("no such lease")
+
+// LeaseReturns records that tokens were consumed under lease id, so that up
+// to that many can be given back within ttl.
+func (tb *TokenBucket) LeaseReturns(ctx context.Context, id string, tokens float64, ttl time.Duration) error {
+	if err := tb.client().Set(ctx, returnLeasePrefix+id, tokens, ttl).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis set: %w", err)
+	}
+	return nil
+}
+
+// SpendLease takes up to n tokens off lease id and returns how many it
+// took: n, or what was left of the lease if less. The lease is forgotten
+// once spent.
+func (tb *TokenBucket) SpendLease(ctx context.Context, id string, n float64) (float64, error) {
+	key := returnLeasePrefix + id
+	var spent float64
+	// Concurrent spends retry, so together they never take more than
+	// the lease.
+	spend := func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return ErrNoLease
+		}
+		if err != nil {
+			return err
+		}
+		left, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%w: lease %q", ErrBadResponse, raw)
+		}
+		spent = min(n, left)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if left-spent <= 0 {
+				pipe.Del(ctx, key)
+			} else {
+				pipe.SetArgs(ctx, key, left-spent, redis.SetArgs{KeepTTL: true})
+			}
+			return nil
+		})
+		return err
+	}
+	for i := 0; i < 10; i++ {
+		err := tb.client().Watch(ctx, spend, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrNoLease) && !errors.Is(err, ErrBadResponse) {
+			metrics.RedisErrors.Inc()
+			return 0, fmt.Errorf("redis watch: %w", err)
+		}
+		return spent, err
+	}
+	return 0, fmt.Errorf("lease %q: too many concurrent spends", id)
+}
\ No newline at end of file
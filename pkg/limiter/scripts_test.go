@@ -0,0 +1,254 @@
+package limiter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptsDir holds the Lua scripts, relative to this package.
+const scriptsDir = "../../scripts/lua"
+
+// scriptCase runs a script against the state left by setup and checks its
+// response and, with after, the state it leaves. Scripts that take the
+// time are passed a fixed one (1000) so responses are exact.
+type scriptCase struct {
+	name   string
+	script string
+	setup  [][]interface{}
+	keys   []string
+	argv   []interface{}
+	want   interface{}
+	after  []expect
+}
+
+// expect is a command and its expected reply.
+type expect struct {
+	cmd  []interface{}
+	want interface{}
+}
+
+var scriptCases = []scriptCase{
+	{
+		name:   "new bucket starts full",
+		script: "token_bucket.lua",
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{10, 1, 1, 1000},
+		want:   []interface{}{int64(1), int64(9), int64(10), int64(1001), int64(0), int64(0), int64(0)},
+	},
+	{
+		name:   "refills for elapsed time",
+		script: "token_bucket.lua",
+		setup:  [][]interface{}{{"HSET", "rl:a", "tokens", 2, "last_ts", 995}},
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{10, 1, 1, 1000},
+		want:   []interface{}{int64(1), int64(6), int64(10), int64(1004), int64(0), int64(0), int64(0)},
+		after:  []expect{{[]interface{}{"HGET", "rl:a", "tokens"}, "6"}},
+	},
+	{
+		name:   "denial reports retry after",
+		script: "token_bucket.lua",
+		setup:  [][]interface{}{{"HSET", "rl:a", "tokens", 0, "last_ts", 1000}},
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{10, 2, 3, 1000},
+		want:   []interface{}{int64(0), int64(0), int64(10), int64(1005), int64(1500), int64(0), int64(0)},
+	},
+	{
+		name:   "denial reports age and idle time",
+		script: "token_bucket.lua",
+		setup:  [][]interface{}{{"HSET", "rl:a", "tokens", 0, "last_ts", 990, "created_ts", 900, "consumed_ts", 990}},
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{10, 0, 1, 1000},
+		want:   []interface{}{int64(0), int64(0), int64(10), int64(1000), int64(0), int64(100000), int64(10000)},
+		after:  []expect{{[]interface{}{"HGET", "rl:a", "consumed_ts"}, "990"}},
+	},
+	{
+		name:   "requesting no tokens consumes nothing",
+		script: "token_bucket.lua",
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{5, 1, 0, 1000},
+		want:   []interface{}{int64(1), int64(5), int64(5), int64(1000), int64(0), int64(0), int64(0)},
+	},
+	{
+		name:   "bucket without refill never expires",
+		script: "token_bucket.lua",
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{5, 0, 1, 1000},
+		want:   []interface{}{int64(1), int64(4), int64(5), int64(1000), int64(0), int64(0), int64(0)},
+		after:  []expect{{[]interface{}{"TTL", "rl:a"}, int64(-1)}},
+	},
+	{
+		name:   "read-only peek leaves a missing bucket missing",
+		script: "token_bucket_peek.lua",
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{5, 1, 1, 1000},
+		want:   []interface{}{int64(1), int64(5), int64(5), int64(1000), int64(0), int64(0), int64(0)},
+		after:  []expect{{[]interface{}{"EXISTS", "rl:a"}, int64(0)}},
+	},
+	{
+		name:   "read-only peek reports when tokens could be consumed",
+		script: "token_bucket_peek.lua",
+		setup:  [][]interface{}{{"HSET", "rl:a", "tokens", 2, "last_ts", 998, "created_ts", 900, "consumed_ts", 998}},
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{10, 1, 6, 1000},
+		want:   []interface{}{int64(0), int64(4), int64(10), int64(1006), int64(2000), int64(100000), int64(2000)},
+		after:  []expect{{[]interface{}{"HGET", "rl:a", "tokens"}, "2"}},
+	},
+	{
+		name:   "hierarchical allow reports the tightest bucket",
+		script: "token_bucket_multi.lua",
+		keys:   []string{"rl:{t}:a", "rl:{t}"},
+		argv:   []interface{}{1, 3, 1, 2, 1, 1000},
+		want:   []interface{}{int64(1), int64(1), int64(2), int64(1001), int64(0), int64(1)},
+	},
+	{
+		name:   "hierarchical denial consumes from no bucket",
+		script: "token_bucket_multi.lua",
+		setup:  [][]interface{}{{"HSET", "rl:{t}", "tokens", 0, "last_ts", 1000}},
+		keys:   []string{"rl:{t}:a", "rl:{t}"},
+		argv:   []interface{}{1, 3, 1, 2, 1, 1000},
+		want:   []interface{}{int64(0), int64(0), int64(2), int64(1002), int64(1000), int64(1)},
+		after:  []expect{{[]interface{}{"HGET", "rl:{t}:a", "tokens"}, "3"}},
+	},
+	{
+		name:   "batch checks each key",
+		script: "token_bucket_batch.lua",
+		keys:   []string{"rl:{b}:a", "rl:{b}:b"},
+		argv:   []interface{}{2, 1, 1, 5, 0, 6, 1000},
+		want: []interface{}{
+			int64(1), int64(1), int64(2), int64(1001), int64(0),
+			int64(0), int64(5), int64(5), int64(1000), int64(0),
+		},
+	},
+	{
+		name:   "quota counts allowed tokens",
+		script: "quota.lua",
+		keys:   []string{"rlq:a:1"},
+		argv:   []interface{}{3, 4102444800, 2},
+		want:   []interface{}{int64(1), int64(1), int64(3), int64(4102444800)},
+		after:  []expect{{[]interface{}{"GET", "rlq:a:1"}, "2"}},
+	},
+	{
+		name:   "quota denial leaves the counter",
+		script: "quota.lua",
+		setup:  [][]interface{}{{"SET", "rlq:a:1", 2}},
+		keys:   []string{"rlq:a:1"},
+		argv:   []interface{}{3, 4102444800, 2},
+		want:   []interface{}{int64(0), int64(1), int64(3), int64(4102444800)},
+		after:  []expect{{[]interface{}{"GET", "rlq:a:1"}, "2"}},
+	},
+	{
+		name:   "quota rolls over capped unused quota",
+		script: "quota.lua",
+		setup:  [][]interface{}{{"SET", "rlq:a:0", 2}},
+		keys:   []string{"rlq:a:1", "rlq:a:0"},
+		argv:   []interface{}{10, 4102444800, 12, 0.3, 3600},
+		want:   []interface{}{int64(1), int64(1), int64(13), int64(4102444800)},
+		after:  []expect{{[]interface{}{"GET", "rlq:a:1"}, "12"}},
+	},
+	{
+		name:   "sliding window drops sub-windows that slid out",
+		script: "sliding_window.lua",
+		setup:  [][]interface{}{{"HSET", "rlw:a", "29343479", 5, "29343539", 1}},
+		keys:   []string{"rlw:a"},
+		argv:   []interface{}{2, 3600000, 60, 1, 1760612340},
+		want:   []interface{}{int64(1), int64(0), int64(2), int64(1760615940), int64(0)},
+		after: []expect{
+			{[]interface{}{"HEXISTS", "rlw:a", "29343479"}, int64(0)},
+			{[]interface{}{"HGET", "rlw:a", "29343539"}, "2"},
+		},
+	},
+	{
+		name:   "sliding window denial waits for the window to slide",
+		script: "sliding_window.lua",
+		setup:  [][]interface{}{{"HSET", "rlw:a", "29343480", 1, "29343539", 1}},
+		keys:   []string{"rlw:a"},
+		argv:   []interface{}{2, 3600000, 60, 1, 1760612340},
+		want:   []interface{}{int64(0), int64(0), int64(2), int64(1760615940), int64(60000)},
+		after:  []expect{{[]interface{}{"HGET", "rlw:a", "29343539"}, "1"}},
+	},
+	{
+		name:   "return caps at capacity",
+		script: "token_bucket_return.lua",
+		setup:  [][]interface{}{{"HSET", "rl:a", "tokens", 3, "last_ts", 1000}},
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{5, 6},
+		want:   int64(1),
+		after:  []expect{{[]interface{}{"HGET", "rl:a", "tokens"}, "6"}},
+	},
+	{
+		name:   "return to an expired bucket is a no-op",
+		script: "token_bucket_return.lua",
+		keys:   []string{"rl:a"},
+		argv:   []interface{}{5, 6},
+		want:   int64(0),
+		after:  []expect{{[]interface{}{"EXISTS", "rl:a"}, int64(0)}},
+	},
+}
+
+func TestScripts(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	ctx := context.Background()
+
+	for _, c := range scriptCases {
+		t.Run(strings.TrimSuffix(c.script, ".lua")+"/"+c.name, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join(scriptsDir, c.script))
+			require.NoError(t, err)
+
+			// The case's keys, moved into the test's own key space; prefixing
+			// keeps their hash tags.
+			keys := make([]string, len(c.keys))
+			renamed := map[interface{}]interface{}{}
+			for i, key := range c.keys {
+				keys[i] = testKey(t, key)
+				renamed[key] = keys[i]
+			}
+			rename := func(cmd []interface{}) []interface{} {
+				out := make([]interface{}, len(cmd))
+				for i, arg := range cmd {
+					if key, ok := renamed[arg]; ok {
+						arg = key
+					}
+					out[i] = arg
+				}
+				return out
+			}
+
+			for _, cmd := range c.setup {
+				require.NoError(t, rdb.Do(ctx, rename(cmd)...).Err())
+			}
+
+			got, err := redis.NewScript(string(src)).Run(ctx, rdb, keys, c.argv...).Result()
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+
+			for _, e := range c.after {
+				got, err := rdb.Do(ctx, rename(e.cmd)...).Result()
+				require.NoError(t, err)
+				assert.Equal(t, e.want, got, "%v", e.cmd)
+			}
+		})
+	}
+}
+
+// TestScripts_Covered fails for scripts without a case in scriptCases.
+func TestScripts_Covered(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(scriptsDir, "*.lua"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	covered := map[string]bool{}
+	for _, c := range scriptCases {
+		covered[c.script] = true
+	}
+	for _, f := range files {
+		assert.True(t, covered[filepath.Base(f)], "no test cases for %s", filepath.Base(f))
+	}
+}
\ No newline at end of file
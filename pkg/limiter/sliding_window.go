@@ -0,0 +1,44 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// MaxSubWindows bounds the sub-windows of a sliding window, and so the
+// hash fields each key's counter may hold.
+const MaxSubWindows = 1000
+
+// SlidingWindow consumes tokens from a window of limit tokens sliding over
+// the last period, tracked in subWindows steps: the more, the closer it
+// follows the window, for a hash field more per step. Denied requests
+// don't count against the window.
+func (tb *TokenBucket) SlidingWindow(ctx context.Context, key string, tokens float64, limit int64, period time.Duration, subWindows int) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	subWindows = min(max(subWindows, 1), MaxSubWindows)
+
+	args := []interface{}{limit, period.Milliseconds(), subWindows, tokens}
+	if now := tb.nowArg(); now != nil {
+		args = append(args, now)
+	}
+
+	start := time.Now()
+	raw, err := tb.scripts().sliding.Run(ctx, tb.client(), []string{"rlw:" + key}, args...).Result()
+	evalSlidingLatency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return nil, fmt.Errorf("redis eval: %w", err)
+	}
+
+	vals, err := decodeResponse(raw, 5)
+	if err != nil {
+		return nil, err
+	}
+	return parseResult(vals), nil
+}
\ No newline at end of file
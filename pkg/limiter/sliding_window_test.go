@@ -0,0 +1,48 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	clock := &manualClock{now: time.Now().Truncate(time.Minute)}
+	tb := New(rdb, 100, 10.0, WithClock(clock))
+	ctx := context.Background()
+	key := testKey(t, "sliding")
+
+	// 6 tokens per minute in 6 steps of 10s: 4 now, 2 at 30s
+	res, err := tb.SlidingWindow(ctx, key, 4, 6, time.Minute, 6)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(2), res.Remaining)
+	clock.Advance(30 * time.Second)
+	res, err = tb.SlidingWindow(ctx, key, 2, 6, time.Minute, 6)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// Full until the first 4 slide out, 30s on, whatever the minute
+	res, err = tb.SlidingWindow(ctx, key, 1, 6, time.Minute, 6)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 30, res.RetryAfter, 0.01)
+
+	clock.Advance(30 * time.Second)
+	res, err = tb.SlidingWindow(ctx, key, 4, 6, time.Minute, 6)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// More than the window ever holds never fits
+	res, err = tb.SlidingWindow(ctx, key, 7, 6, time.Minute, 6)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Zero(t, res.RetryAfter)
+}
\ No newline at end of file
@@ -0,0 +1,46 @@
+package limiter
+
+import "strings"
+
+// slotCount is the number of Redis Cluster hash slots.
+const slotCount = 16384
+
+var crc16Table [256]uint16
+
+func init() {
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+// Slot returns the Redis Cluster hash slot of key: CRC16 (XMODEM) of its
+// hash tag, the part between the first '{' and the next '}' if non-empty,
+// or of the whole key otherwise.
+func Slot(key string) int {
+	if tag, ok := hashTag(key); ok {
+		key = tag
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^key[i]]
+	}
+	return int(crc) % slotCount
+}
+
+// hashTag returns the hash tag of key, if it has one.
+func hashTag(key string) (string, bool) {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			return key[i+1 : i+1+j], true
+		}
+	}
+	return "", false
+}
\ No newline at end of file
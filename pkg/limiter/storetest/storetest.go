@@ -0,0 +1,195 @@
+// Package storetest is a conformance suite for limiter.Store backends: a
+// new backend must pass Run to be used in place of Redis.
+package storetest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/sim"
+)
+
+// Backend is a store under test.
+type Backend struct {
+	Store limiter.Store
+
+	// Expire, if set, lets d pass for the store's key expiry when that
+	// doesn't follow the limiter clock (Redis expires keys by its own).
+	Expire func(d time.Duration)
+
+	// Exists reports whether the store holds state for key. The expiry
+	// checks are skipped when it is nil.
+	Exists func(key string) bool
+}
+
+// NewBackend returns a fresh, empty backend whose buckets take the time
+// from clock.
+type NewBackend func(t *testing.T, clock limiter.Clock) Backend
+
+// Run runs the conformance suite against backends made by newBackend.
+func Run(t *testing.T, newBackend NewBackend) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, s *suite)
+	}{
+		{"Burst", testBurst},
+		{"MultipleTokens", testMultipleTokens},
+		{"FractionalTokens", testFractionalTokens},
+		{"IsolatedKeys", testIsolatedKeys},
+		{"Atomicity", testAtomicity},
+		{"RefillPrecision", testRefillPrecision},
+		{"FractionalRefill", testFractionalRefill},
+		{"Expiry", testExpiry},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := sim.NewClock(time.Unix(1700000000, 0))
+			tc.test(t, &suite{Backend: newBackend(t, clock), clock: clock})
+		})
+	}
+}
+
+type suite struct {
+	Backend
+	clock *sim.Clock
+}
+
+func (s *suite) advance(d time.Duration) {
+	s.clock.Set(s.clock.Now().Add(d))
+	if s.Expire != nil {
+		s.Expire(d)
+	}
+}
+
+func (s *suite) allow(t *testing.T, key string, tokens float64, burst int64, rate float64) *limiter.Result {
+	t.Helper()
+	res, err := s.Store.Allow(context.Background(), key, tokens, burst, rate)
+	require.NoError(t, err)
+	return res
+}
+
+// A fresh bucket holds burst tokens, then denies.
+func testBurst(t *testing.T, s *suite) {
+	for i := int64(1); i <= 5; i++ {
+		res := s.allow(t, "burst", 1, 5, 1)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 5-i, res.Remaining)
+		assert.Equal(t, int64(5), res.Limit)
+	}
+	res := s.allow(t, "burst", 1, 5, 1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+	assert.InDelta(t, 1.0, res.RetryAfter, 0.001)
+	assert.Equal(t, s.clock.Now().Unix()+5, res.ResetAt)
+}
+
+// A request larger than what's left is denied without consuming any.
+func testMultipleTokens(t *testing.T, s *suite) {
+	assert.True(t, s.allow(t, "multi", 8, 10, 1).Allowed)
+	res := s.allow(t, "multi", 3, 10, 1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(2), res.Remaining)
+	assert.InDelta(t, 1.0, res.RetryAfter, 0.001)
+	assert.True(t, s.allow(t, "multi", 2, 10, 1).Allowed)
+}
+
+// Fractional requests consume exactly what they ask for; Remaining rounds
+// down.
+func testFractionalTokens(t *testing.T, s *suite) {
+	for _, want := range []int64{1, 1, 0, 0} {
+		res := s.allow(t, "frac", 0.5, 2, 1)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, want, res.Remaining)
+	}
+	res := s.allow(t, "frac", 0.5, 2, 1)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 0.5, res.RetryAfter, 0.001)
+
+	s.advance(250 * time.Millisecond)
+	assert.True(t, s.allow(t, "frac", 0.25, 2, 1).Allowed)
+	assert.False(t, s.allow(t, "frac", 0.25, 2, 1).Allowed)
+}
+
+func testIsolatedKeys(t *testing.T, s *suite) {
+	assert.True(t, s.allow(t, "iso:a", 1, 1, 1).Allowed)
+	assert.False(t, s.allow(t, "iso:a", 1, 1, 1).Allowed)
+	assert.True(t, s.allow(t, "iso:b", 1, 1, 1).Allowed)
+}
+
+// Concurrent calls never admit more than the bucket holds.
+func testAtomicity(t *testing.T, s *suite) {
+	const burst, workers, calls = 100, 20, 10
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				res, err := s.Store.Allow(context.Background(), "atomic", 1, burst, 0.001)
+				if assert.NoError(t, err) && res.Allowed {
+					allowed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(burst), allowed.Load())
+}
+
+// Tokens come back at exactly rate per second, up to burst.
+func testRefillPrecision(t *testing.T, s *suite) {
+	const key = "refill"
+	for i := 0; i < 10; i++ {
+		require.True(t, s.allow(t, key, 1, 10, 4).Allowed)
+	}
+	res := s.allow(t, key, 1, 10, 4)
+	require.False(t, res.Allowed)
+	assert.InDelta(t, 0.25, res.RetryAfter, 0.001)
+
+	s.advance(125 * time.Millisecond)
+	assert.False(t, s.allow(t, key, 1, 10, 4).Allowed, "half a token")
+	s.advance(125 * time.Millisecond)
+	assert.True(t, s.allow(t, key, 1, 10, 4).Allowed, "one token")
+	assert.False(t, s.allow(t, key, 1, 10, 4).Allowed)
+
+	// Refill stops at burst
+	s.advance(time.Minute)
+	for i := 0; i < 10; i++ {
+		assert.True(t, s.allow(t, key, 1, 10, 4).Allowed, "token %d", i)
+	}
+	assert.False(t, s.allow(t, key, 1, 10, 4).Allowed)
+}
+
+// Slow refills accumulate fractions of a token across calls.
+func testFractionalRefill(t *testing.T, s *suite) {
+	const key = "fraction"
+	require.True(t, s.allow(t, key, 1, 1, 0.5).Allowed)
+	for i := 0; i < 3; i++ {
+		s.advance(500 * time.Millisecond)
+		assert.False(t, s.allow(t, key, 1, 1, 0.5).Allowed, "after %v", time.Duration(i+1)*500*time.Millisecond)
+	}
+	s.advance(500 * time.Millisecond)
+	assert.True(t, s.allow(t, key, 1, 1, 0.5).Allowed)
+}
+
+// Idle buckets are dropped once they'd have refilled, plus a minute.
+func testExpiry(t *testing.T, s *suite) {
+	if s.Exists == nil {
+		t.Skip("backend doesn't report key existence")
+	}
+	const key = "expiry"
+	s.allow(t, key, 5, 10, 1)
+	require.True(t, s.Exists(key))
+
+	s.advance(69 * time.Second)
+	assert.True(t, s.Exists(key), "kept until refilled plus a minute")
+	s.advance(2 * time.Second)
+	assert.False(t, s.Exists(key), "dropped after 71s idle")
+}
\ No newline at end of file
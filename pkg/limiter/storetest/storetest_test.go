@@ -0,0 +1,26 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+func TestRedis(t *testing.T) {
+	Run(t, func(t *testing.T, clock limiter.Clock) Backend {
+		mr := miniredis.RunT(t)
+		rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { rdb.Close() })
+		return Backend{
+			Store:  limiter.New(rdb, 100, 10, limiter.WithClock(clock)),
+			Expire: mr.FastForward,
+			Exists: func(key string) bool {
+				return rdb.Exists(context.Background(), "rl:"+key).Val() == 1
+			},
+		}
+	})
+}
\ No newline at end of file
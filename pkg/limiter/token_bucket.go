@@ -3,17 +3,73 @@ package limiter
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
-	"strconv"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/redis/go-redis/v9"
 )
 
 //go:embed ../../scripts/lua/token_bucket.lua
 var tokenBucketScript string
 
+//go:embed ../../scripts/lua/token_bucket_multi.lua
+var tokenBucketMultiScript string
+
+//go:embed ../../scripts/lua/token_bucket_batch.lua
+var tokenBucketBatchScript string
+
+//go:embed ../../scripts/lua/token_bucket_peek.lua
+var tokenBucketPeekScript string
+
+//go:embed ../../scripts/lua/quota.lua
+var quotaScript string
+
+//go:embed ../../scripts/lua/token_bucket_return.lua
+var tokenBucketReturnScript string
+
+//go:embed ../../scripts/lua/sliding_window.lua
+var slidingWindowScript string
+
+// Observers for the hot path, resolved once instead of per call.
+var (
+	evalLatency        = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_token_bucket"))
+	evalMultiLatency   = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_token_bucket_multi"))
+	evalPeekLatency    = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_token_bucket_peek"))
+	evalQuotaLatency   = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_quota"))
+	evalSlidingLatency = metrics.Batched(metrics.RedisLatency.WithLabelValues("eval_sliding_window"))
+)
+
+// oneToken is the boxed default token count, so the common case doesn't
+// allocate when passed to the script.
+var oneToken interface{} = int64(1)
+
+// evalArgs are the KEYS and ARGV of one token_bucket.lua call, pooled so
+// Allow doesn't allocate fresh slices for every request.
+type evalArgs struct {
+	keys []string
+	argv []interface{}
+}
+
+var evalArgsPool = sync.Pool{
+	New: func() interface{} {
+		return &evalArgs{keys: make([]string, 1), argv: make([]interface{}, 3, 4)}
+	},
+}
+
+func (a *evalArgs) release() {
+	a.keys[0] = ""
+	a.argv = a.argv[:cap(a.argv)]
+	for i := range a.argv {
+		a.argv[i] = nil
+	}
+	evalArgsPool.Put(a)
+}
+
 // Result represents the outcome of a rate limit check.
 type Result struct {
 	Allowed    bool
@@ -21,100 +77,391 @@ type Result struct {
 	Limit      int64
 	ResetAt    int64
 	RetryAfter float64
+	// Age and Idle are the seconds since the bucket was created and since
+	// tokens were last consumed from it. Only Allow and the peeks report
+	// them.
+	Age  float64
+	Idle float64
+}
+
+// Store keeps token buckets. TokenBucket is the Redis one; other backends
+// must pass the storetest conformance suite to behave the same. A zero
+// burst or rate means the store's default. Tokens may be fractional.
+type Store interface {
+	Allow(ctx context.Context, key string, tokens float64, burst int64, rate float64) (*Result, error)
 }
 
-// TokenBucket implements a distributed token bucket backed by Redis.
+var _ Store = (*TokenBucket)(nil)
+
+// client boxes the limiter's Redis client for atomic swaps.
+type client struct {
+	redis.UniversalClient
+}
+
+// TokenBucket implements a distributed token bucket backed by Redis, a
+// single node or a Redis Cluster.
 type TokenBucket struct {
-	rdb    *redis.Client
-	script *redis.Script
+	rdb atomic.Pointer[client]
+	lua atomic.Pointer[scriptSet]
 
 	defaultBurst int64
 	defaultRate  float64
+
+	// Defaults boxed once for the script's ARGV.
+	burstArg interface{}
+	rateArg  interface{}
+
+	clock Clock
+
+	// Lua source, embedded unless overridden
+	sources *Scripts
 }
 
-// New creates a new TokenBucket limiter.
-func New(rdb *redis.Client, defaultBurst int64, defaultRate float64) *TokenBucket {
-	return &TokenBucket{
-		rdb:          rdb,
-		script:       redis.NewScript(tokenBucketScript),
+// Clock tells the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// Option configures a TokenBucket.
+type Option func(*TokenBucket)
+
+// WithClock makes the scripts use c's time instead of Redis' clock, e.g. so
+// tests can advance time without sleeping. Every replica sharing the
+// buckets must then use clocks that agree.
+func WithClock(c Clock) Option {
+	return func(tb *TokenBucket) { tb.clock = c }
+}
+
+// New creates a new TokenBucket limiter on rdb, a *redis.Client or a
+// *redis.ClusterClient.
+func New(rdb redis.UniversalClient, defaultBurst int64, defaultRate float64, opts ...Option) *TokenBucket {
+	tb := &TokenBucket{
 		defaultBurst: defaultBurst,
 		defaultRate:  defaultRate,
+		burstArg:     defaultBurst,
+		rateArg:      defaultRate,
+	}
+	for _, opt := range opts {
+		opt(tb)
 	}
+	tb.lua.Store(&scriptSet{
+		script:  redis.NewScript(tb.sources.source("token_bucket.lua")),
+		multi:   redis.NewScript(tb.sources.source("token_bucket_multi.lua")),
+		batch:   redis.NewScript(tb.sources.source("token_bucket_batch.lua")),
+		peek:    redis.NewScript(tb.sources.source("token_bucket_peek.lua")),
+		quota:   redis.NewScript(tb.sources.source("quota.lua")),
+		ret:     redis.NewScript(tb.sources.source("token_bucket_return.lua")),
+		sliding: redis.NewScript(tb.sources.source("sliding_window.lua")),
+	})
+	tb.rdb.Store(&client{rdb})
+	return tb
 }
 
-// Allow checks whether a request identified by key should be permitted.
-// burst and rate are optional overrides (pass 0 to use defaults).
-func (tb *TokenBucket) Allow(ctx context.Context, key string, tokens int64, burst int64, rate float64) (*Result, error) {
-	if tokens <= 0 {
-		tokens = 1
+// now returns the limiter's clock's time, or the local time when the
+// scripts use Redis' clock.
+func (tb *TokenBucket) now() time.Time {
+	if tb.clock != nil {
+		return tb.clock.Now()
 	}
-	if burst <= 0 {
-		burst = tb.defaultBurst
-	}
-	if rate <= 0 {
-		rate = tb.defaultRate
+	return time.Now()
+}
+
+// nowArg returns the time to pass to the scripts, or nil to have them use
+// Redis' clock.
+func (tb *TokenBucket) nowArg() interface{} {
+	if tb.clock == nil {
+		return nil
 	}
+	return float64(tb.clock.Now().UnixMicro()) / 1e6
+}
 
-	redisKey := fmt.Sprintf("rl:%s", key)
-	now := float64(time.Now().UnixNano()) / 1e9 // high-precision timestamp
+// SetClient switches a single-node limiter to rdb, e.g. one with a resized
+// pool, and returns the previous client. Calls already running finish on
+// the old one.
+func (tb *TokenBucket) SetClient(rdb *redis.Client) *redis.Client {
+	old, _ := tb.rdb.Swap(&client{rdb}).UniversalClient.(*redis.Client)
+	return old
+}
 
-	start := time.Now()
-	raw, err := tb.script.Run(ctx, tb.rdb, []string{redisKey},
-		burst,
-		rate,
-		now,
-		tokens,
-	).Result()
-	elapsed := time.Since(start).Seconds()
+// scripts returns the scripts in use.
+func (tb *TokenBucket) scripts() *scriptSet {
+	return tb.lua.Load()
+}
+
+// client returns the Redis client in use.
+func (tb *TokenBucket) client() redis.UniversalClient {
+	return tb.rdb.Load().UniversalClient
+}
+
+// Defaults returns the burst and rate used when a call doesn't override them.
+func (tb *TokenBucket) Defaults() (int64, float64) {
+	return tb.defaultBurst, tb.defaultRate
+}
 
-	metrics.RedisLatency.WithLabelValues("eval_token_bucket").Observe(elapsed)
+// Allow checks whether a request identified by key should be permitted.
+// burst and rate are optional overrides (pass 0 to use defaults). tokens may
+// be fractional, e.g. 0.5 for a cached response.
+func (tb *TokenBucket) Allow(ctx context.Context, key string, tokens float64, burst int64, rate float64) (*Result, error) {
+	args := tb.evalArgs(key, tokens, burst, rate)
+	defer args.release()
+
+	start := time.Now()
+	raw, err := tb.scripts().script.Run(ctx, tb.client(), args.keys, args.argv...).Result()
+	evalLatency.Observe(time.Since(start).Seconds())
 
 	if err != nil {
 		metrics.RedisErrors.Inc()
 		return nil, fmt.Errorf("redis eval: %w", err)
 	}
 
-	vals, ok := raw.([]interface{})
-	if !ok || len(vals) < 5 {
-		return nil, fmt.Errorf("unexpected lua response: %v", raw)
+	vals, err := decodeResponse(raw, 5)
+	if err != nil {
+		return nil, err
+	}
+	res := parseResult(vals)
+	parseAges(res, vals[5:])
+	return res, nil
+}
+
+// evalArgs fills pooled script arguments for Allow, reusing the boxed
+// defaults when the call doesn't override them.
+func (tb *TokenBucket) evalArgs(key string, tokens float64, burst int64, rate float64) *evalArgs {
+	a := evalArgsPool.Get().(*evalArgs)
+	a.keys[0] = "rl:" + key
+	a.argv = a.argv[:3]
+
+	a.argv[0] = tb.burstArg
+	if burst > 0 && burst != tb.defaultBurst {
+		a.argv[0] = burst
 	}
+	a.argv[1] = tb.rateArg
+	if rate > 0 && rate != tb.defaultRate {
+		a.argv[1] = rate
+	}
+	switch {
+	case tokens <= 0 || tokens == 1:
+		a.argv[2] = oneToken
+	case tokens == math.Trunc(tokens):
+		a.argv[2] = int64(tokens)
+	default:
+		a.argv[2] = tokens
+	}
+	if now := tb.nowArg(); now != nil {
+		a.argv = append(a.argv, now)
+	}
+	return a
+}
 
-	allowed, _ := vals[0].(int64)
-	remaining, _ := vals[1].(int64)
-	limit, _ := vals[2].(int64)
-	resetAt, _ := vals[3].(int64)
+// parseResult decodes the {allowed, remaining, limit, reset_at,
+// retry_after_ms} prefix shared by the token bucket scripts.
+// ErrBadResponse is returned when a script's response isn't shaped as
+// expected, e.g. because Redis runs a different version of it.
+var ErrBadResponse = errors.New("unexpected lua response")
 
-	var retryAfter float64
-	switch v := vals[4].(type) {
-	case string:
-		retryAfter, _ = strconv.ParseFloat(v, 64)
-	case int64:
-		retryAfter = float64(v)
+// decodeResponse checks that raw, a script's response, is an array whose
+// first n values are integers.
+func decodeResponse(raw interface{}, n int) ([]interface{}, error) {
+	vals, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: got %T, want array", ErrBadResponse, raw)
+	}
+	if len(vals) < n {
+		return nil, fmt.Errorf("%w: got %d values, want %d", ErrBadResponse, len(vals), n)
 	}
+	for i, v := range vals[:n] {
+		if _, ok := v.(int64); !ok {
+			return nil, fmt.Errorf("%w: value %d is %T %q, want integer", ErrBadResponse, i, v, fmt.Sprint(v))
+		}
+	}
+	return vals, nil
+}
+
+// parseResult reads a result from the first 5 values of a response checked
+// by decodeResponse.
+func parseResult(vals []interface{}) *Result {
+	allowed := vals[0].(int64)
+	remaining := vals[1].(int64)
+	limit := vals[2].(int64)
+	resetAt := vals[3].(int64)
+	retryAfterMs := vals[4].(int64)
 
 	return &Result{
 		Allowed:    allowed == 1,
 		Remaining:  remaining,
 		Limit:      limit,
 		ResetAt:    resetAt,
-		RetryAfter: retryAfter,
-	}, nil
+		RetryAfter: float64(retryAfterMs) / 1000,
+	}
+}
+
+// parseAges reads the age and idle time token_bucket.lua appends to its
+// result. Replacement scripts that leave them out report 0.
+func parseAges(res *Result, vals []interface{}) {
+	if len(vals) < 2 {
+		return
+	}
+	age, ok := vals[0].(int64)
+	idle, ok2 := vals[1].(int64)
+	if ok && ok2 {
+		res.Age = float64(age) / 1000
+		res.Idle = float64(idle) / 1000
+	}
+}
+
+// Bucket is one level of a hierarchical check.
+type Bucket struct {
+	Key   string
+	Burst int64
+	Rate  float64
+}
+
+// AllowAll consumes tokens from every bucket or from none, atomically. It
+// returns the result of the most restrictive bucket and its index. Keys
+// must hash to the same Redis cluster slot.
+func (tb *TokenBucket) AllowAll(ctx context.Context, buckets []Bucket, tokens float64) (*Result, int, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+
+	keys := make([]string, len(buckets))
+	args := make([]interface{}, 0, 2+2*len(buckets))
+	args = append(args, tokens)
+	for i, b := range buckets {
+		if b.Burst <= 0 {
+			b.Burst = tb.defaultBurst
+		}
+		if b.Rate <= 0 {
+			b.Rate = tb.defaultRate
+		}
+		keys[i] = "rl:" + b.Key
+		args = append(args, b.Burst, b.Rate)
+	}
+	if now := tb.nowArg(); now != nil {
+		args = append(args, now)
+	}
+
+	start := time.Now()
+	raw, err := tb.scripts().multi.Run(ctx, tb.client(), keys, args...).Result()
+	evalMultiLatency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return nil, 0, fmt.Errorf("redis eval: %w", err)
+	}
+
+	vals, err := decodeResponse(raw, 6)
+	if err != nil {
+		return nil, 0, err
+	}
+	binding := vals[5].(int64)
+	return parseResult(vals), int(binding), nil
 }
 
 // Peek returns the current bucket state without consuming tokens.
 func (tb *TokenBucket) Peek(ctx context.Context, key string, burst int64, rate float64) (*Result, error) {
+	return tb.PeekTokens(ctx, key, 1, burst, rate)
+}
+
+// PeekTokens returns the current bucket state with token_bucket_peek.lua,
+// and whether, or in how long, tokens could be consumed from it. It writes
+// nothing: a missing bucket reads as full without being created, and an
+// idle one keeps its expiry.
+func (tb *TokenBucket) PeekTokens(ctx context.Context, key string, tokens float64, burst int64, rate float64) (*Result, error) {
+	args := tb.evalArgs(key, tokens, burst, rate)
+	defer args.release()
+
+	start := time.Now()
+	raw, err := tb.scripts().peek.Run(ctx, tb.client(), args.keys, args.argv...).Result()
+	evalPeekLatency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return nil, fmt.Errorf("redis eval: %w", err)
+	}
+
+	vals, err := decodeResponse(raw, 5)
+	if err != nil {
+		return nil, err
+	}
+	res := parseResult(vals)
+	parseAges(res, vals[5:])
+	return res, nil
+}
+
+// Quota consumes tokens from a fixed-window quota of limit tokens per period
+// (windows are aligned to the Unix epoch, so a 24h period resets at 00:00 UTC).
+// Denied requests don't count against the quota.
+func (tb *TokenBucket) Quota(ctx context.Context, key string, tokens float64, limit int64, period time.Duration) (*Result, error) {
+	return tb.QuotaRollover(ctx, key, tokens, limit, period, 0)
+}
+
+// QuotaRollover is Quota with up to rollover (a share of limit, e.g. 0.2)
+// of the previous window's unused quota added to the current window's. In
+// a Redis Cluster, key must carry a hash tag, as namespaced keys do, since
+// both windows' counters are read at once.
+func (tb *TokenBucket) QuotaRollover(ctx context.Context, key string, tokens float64, limit int64, period time.Duration, rollover float64) (*Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+
+	now := tb.now()
+	window := now.Truncate(period)
+	resetAt := window.Add(period).Unix()
+	keys := []string{fmt.Sprintf("rlq:%s:%d", key, window.Unix())}
+	if rollover > 0 {
+		keys = append(keys, fmt.Sprintf("rlq:%s:%d", key, window.Add(-period).Unix()))
+	}
+
+	start := time.Now()
+	raw, err := tb.scripts().quota.Run(ctx, tb.client(), keys,
+		limit,
+		resetAt,
+		tokens,
+		rollover,
+		int64(period/time.Second),
+	).Result()
+	evalQuotaLatency.Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metrics.RedisErrors.Inc()
+		return nil, fmt.Errorf("redis eval: %w", err)
+	}
+
+	vals, err := decodeResponse(raw, 4)
+	if err != nil {
+		return nil, err
+	}
+	allowed := vals[0].(int64)
+	remaining := vals[1].(int64)
+
+	res := &Result{
+		Allowed:   allowed == 1,
+		Remaining: remaining,
+		Limit:     vals[2].(int64),
+		ResetAt:   resetAt,
+	}
+	if !res.Allowed {
+		res.RetryAfter = float64(resetAt) - float64(now.UnixNano())/1e9
+	}
+	return res, nil
+}
+
+// Return gives n unused tokens back to key's bucket, up to its capacity.
+func (tb *TokenBucket) Return(ctx context.Context, key string, n float64, burst int64) error {
+	if n <= 0 {
+		return nil
+	}
 	if burst <= 0 {
 		burst = tb.defaultBurst
 	}
-	if rate <= 0 {
-		rate = tb.defaultRate
+	if err := tb.scripts().ret.Run(ctx, tb.client(), []string{"rl:" + key}, n, burst).Err(); err != nil {
+		metrics.RedisErrors.Inc()
+		return fmt.Errorf("redis eval: %w", err)
 	}
-
-	// Use Allow with 0 tokens to peek without consuming
-	return tb.Allow(ctx, key, 0, burst, rate)
+	return nil
 }
 
 // Ping checks Redis connectivity.
 func (tb *TokenBucket) Ping(ctx context.Context) error {
-	return tb.rdb.Ping(ctx).Err()
+	return tb.client().Ping(ctx).Err()
 }
\ No newline at end of file
@@ -3,43 +3,106 @@ package limiter
 import (
 	"context"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// These are integration tests that require a running Redis instance.
-// Run: REDIS_ADDR=localhost:6379 go test -v ./pkg/limiter/...
+// These tests run against the Redis at REDIS_ADDR (default localhost:6379)
+// and database REDIS_DB (default 15) or, when none answers, an in-process
+// miniredis. Each test only touches keys from testKey and testNamespace and
+// deletes them when it ends, so a shared Redis is safe to test against,
+// from parallel tests or concurrent runs.
+// Run: REDIS_ADDR=localhost:6379 REDIS_DB=15 go test -v ./pkg/limiter/...
 
-func testRedis(t *testing.T) *redis.Client {
+// testAddr returns the address of the Redis to test against.
+func testAddr(t testing.TB) string {
 	t.Helper()
-	rdb := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   15, // use a test DB
-	})
-	ctx := context.Background()
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		t.Skipf("Redis not available: %v", err)
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		return miniredis.RunT(t).Addr()
 	}
+	return addr
+}
+
+// testDB returns the database to test in.
+func testDB() int {
+	if db, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		return db
+	}
+	return 15
+}
+
+// runID tells apart concurrent runs of the suite against the same Redis.
+var runID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// testNamespace returns a namespace of t's own.
+func testNamespace(t testing.TB) string {
+	return "test:" + runID + ":" + t.Name()
+}
+
+// testKey returns key in t's own key space.
+func testKey(t testing.TB, key string) string {
+	return testNamespace(t) + ":" + key
+}
+
+// testTopology, when set by the integration harness, provides the Redis to
+// test against instead.
+var testTopology func(t testing.TB) redis.UniversalClient
+
+// testRedis returns a client for the Redis to test against. When t ends,
+// the keys of t and its subtests are deleted, whether from testKey or under
+// testNamespace, and nothing else.
+func testRedis(t testing.TB) redis.UniversalClient {
+	t.Helper()
+	var rdb redis.UniversalClient
+	if testTopology != nil {
+		rdb = testTopology(t)
+	} else {
+		rdb = redis.NewClient(&redis.Options{
+			Addr: testAddr(t),
+			DB:   testDB(),
+		})
+	}
+	ctx := context.Background()
 	t.Cleanup(func() {
-		rdb.FlushDB(ctx)
+		pattern := "*" + escapeGlob(testNamespace(t)) + "[:/}]*"
+		if cc, ok := rdb.(*redis.ClusterClient); ok {
+			cc.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+				_, err := deleteMatching(ctx, node, pattern)
+				return err
+			})
+		} else {
+			deleteMatching(ctx, rdb, pattern)
+		}
 		rdb.Close()
 	})
 	return rdb
 }
 
 func TestAllow_BasicFlow(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 5, 1.0) // burst=5, rate=1/s
 	ctx := context.Background()
 
 	// First 5 requests should be allowed
 	for i := 0; i < 5; i++ {
-		res, err := tb.Allow(ctx, "test:basic", 1, 0, 0)
+		res, err := tb.Allow(ctx, testKey(t, "basic"), 1, 0, 0)
 		require.NoError(t, err)
 		assert.True(t, res.Allowed, "request %d should be allowed", i)
 		assert.Equal(t, int64(4-i), res.Remaining)
@@ -47,73 +110,101 @@ func TestAllow_BasicFlow(t *testing.T) {
 	}
 
 	// 6th request should be denied
-	res, err := tb.Allow(ctx, "test:basic", 1, 0, 0)
+	res, err := tb.Allow(ctx, testKey(t, "basic"), 1, 0, 0)
 	require.NoError(t, err)
 	assert.False(t, res.Allowed)
 	assert.True(t, res.RetryAfter > 0)
 }
 
+// manualClock is a Clock that only moves when told to.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
 func TestAllow_Refill(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
-	tb := New(rdb, 2, 10.0) // burst=2, rate=10/s (fast refill for test)
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	tb := New(rdb, 2, 4.0, WithClock(clock)) // burst=2, rate=4/s
 	ctx := context.Background()
 
 	// Consume all tokens
 	for i := 0; i < 2; i++ {
-		res, err := tb.Allow(ctx, "test:refill", 1, 0, 0)
+		res, err := tb.Allow(ctx, testKey(t, "refill"), 1, 0, 0)
 		require.NoError(t, err)
 		assert.True(t, res.Allowed)
 	}
 
-	// Should be denied now
-	res, err := tb.Allow(ctx, "test:refill", 1, 0, 0)
+	// Should be denied now, with 1 token due in 250ms
+	res, err := tb.Allow(ctx, testKey(t, "refill"), 1, 0, 0)
 	require.NoError(t, err)
 	assert.False(t, res.Allowed)
+	assert.InDelta(t, 0.25, res.RetryAfter, 0.001)
 
-	// Wait for refill (need 1 token, rate=10/s → 100ms)
-	time.Sleep(150 * time.Millisecond)
+	// Half the refill time isn't enough
+	clock.Advance(125 * time.Millisecond)
+	res, err = tb.Allow(ctx, testKey(t, "refill"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
 
 	// Should be allowed again
-	res, err = tb.Allow(ctx, "test:refill", 1, 0, 0)
+	clock.Advance(125 * time.Millisecond)
+	res, err = tb.Allow(ctx, testKey(t, "refill"), 1, 0, 0)
 	require.NoError(t, err)
 	assert.True(t, res.Allowed)
 }
 
 func TestAllow_MultipleTokens(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 10, 1.0)
 	ctx := context.Background()
 
 	// Request 7 tokens at once
-	res, err := tb.Allow(ctx, "test:multi", 7, 0, 0)
+	res, err := tb.Allow(ctx, testKey(t, "multi"), 7, 0, 0)
 	require.NoError(t, err)
 	assert.True(t, res.Allowed)
 	assert.Equal(t, int64(3), res.Remaining)
 
 	// Request 5 more - should be denied (only 3 remaining)
-	res, err = tb.Allow(ctx, "test:multi", 5, 0, 0)
+	res, err = tb.Allow(ctx, testKey(t, "multi"), 5, 0, 0)
 	require.NoError(t, err)
 	assert.False(t, res.Allowed)
 }
 
 func TestAllow_PerRequestOverride(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 100, 10.0) // defaults
 	ctx := context.Background()
 
 	// Override to burst=2
 	for i := 0; i < 2; i++ {
-		res, err := tb.Allow(ctx, "test:override", 1, 2, 1.0)
+		res, err := tb.Allow(ctx, testKey(t, "override"), 1, 2, 1.0)
 		require.NoError(t, err)
 		assert.True(t, res.Allowed)
 	}
 
-	res, err := tb.Allow(ctx, "test:override", 1, 2, 1.0)
+	res, err := tb.Allow(ctx, testKey(t, "override"), 1, 2, 1.0)
 	require.NoError(t, err)
 	assert.False(t, res.Allowed)
 }
 
 func TestAllow_Concurrent(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 100, 0) // burst=100, rate=0 (no refill)
 	ctx := context.Background()
@@ -130,7 +221,7 @@ func TestAllow_Concurrent(t *testing.T) {
 		wg.Add(1)
 		go func(n int) {
 			defer wg.Done()
-			res, err := tb.Allow(ctx, "test:concurrent", 1, 100, 0)
+			res, err := tb.Allow(ctx, testKey(t, "concurrent"), 1, 100, 0)
 			if err != nil {
 				t.Errorf("request %d error: %v", n, err)
 				return
@@ -153,60 +244,639 @@ func TestAllow_Concurrent(t *testing.T) {
 }
 
 func TestAllow_IsolatedKeys(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 5, 1.0)
 	ctx := context.Background()
 
 	// Exhaust key A
 	for i := 0; i < 5; i++ {
-		tb.Allow(ctx, "test:keyA", 1, 0, 0)
+		tb.Allow(ctx, testKey(t, "keyA"), 1, 0, 0)
 	}
 
 	// Key B should still have full quota
-	res, err := tb.Allow(ctx, "test:keyB", 1, 0, 0)
+	res, err := tb.Allow(ctx, testKey(t, "keyB"), 1, 0, 0)
 	require.NoError(t, err)
 	assert.True(t, res.Allowed)
 	assert.Equal(t, int64(4), res.Remaining)
 }
 
 func TestPeek(t *testing.T) {
+	t.Parallel()
 	rdb := testRedis(t)
 	tb := New(rdb, 10, 1.0)
 	ctx := context.Background()
 
 	// Consume 3 tokens
 	for i := 0; i < 3; i++ {
-		tb.Allow(ctx, "test:peek", 1, 0, 0)
+		tb.Allow(ctx, testKey(t, "peek"), 1, 0, 0)
 	}
 
 	// Peek should show 7 remaining without consuming
-	res, err := tb.Peek(ctx, "test:peek", 0, 0)
+	res, err := tb.Peek(ctx, testKey(t, "peek"), 0, 0)
 	require.NoError(t, err)
 	assert.Equal(t, int64(7), res.Remaining)
 
 	// Peek again - still 7
-	res, err = tb.Peek(ctx, "test:peek", 0, 0)
+	res, err = tb.Peek(ctx, testKey(t, "peek"), 0, 0)
 	require.NoError(t, err)
 	assert.Equal(t, int64(7), res.Remaining)
+
+	// Peeking a bucket that doesn't exist leaves it missing
+	res, err = tb.PeekTokens(ctx, testKey(t, "unused"), 12, 0, 0)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(10), res.Remaining)
+	assert.Equal(t, 2.0, res.RetryAfter)
+	n, err := rdb.Exists(ctx, "rl:"+testKey(t, "unused")).Result()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 100, 10.0)
+	ctx := context.Background()
+
+	// 5 tokens per hour
+	res, err := tb.Quota(ctx, testKey(t, "quota"), 3, 5, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(2), res.Remaining)
+
+	// Doesn't fit - denied until the window resets, nothing consumed
+	res, err = tb.Quota(ctx, testKey(t, "quota"), 3, 5, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, int64(2), res.Remaining)
+	assert.True(t, res.RetryAfter > 0 && res.RetryAfter <= 3600)
+
+	res, err = tb.Quota(ctx, testKey(t, "quota"), 2, 5, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(0), res.Remaining)
+}
+
+func TestQuotaRollover(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	clock := &manualClock{now: time.Now().Truncate(time.Hour)}
+	tb := New(rdb, 100, 10.0, WithClock(clock))
+	ctx := context.Background()
+	key := testKey(t, "rollover")
+
+	// 10 tokens per hour, up to 30% carried over; 2 used in the first hour
+	_, err := tb.QuotaRollover(ctx, key, 2, 10, time.Hour, 0.3)
+	require.NoError(t, err)
+
+	// 8 unused, capped at 3
+	clock.Advance(time.Hour)
+	res, err := tb.QuotaRollover(ctx, key, 13, 10, time.Hour, 0.3)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(13), res.Limit)
+	assert.Equal(t, int64(0), res.Remaining)
+
+	// Carried quota doesn't carry again, and an overdrawn window leaves
+	// nothing to carry
+	clock.Advance(time.Hour)
+	res, err = tb.QuotaRollover(ctx, key, 1, 10, time.Hour, 0.3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Limit)
+
+	// Without rollover the limit stays put
+	clock.Advance(time.Hour)
+	res, err = tb.Quota(ctx, key, 1, 10, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), res.Limit)
+}
+
+func TestDeletePrefix(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 3, 0.001)
+	ctx := context.Background()
+	ns := testNamespace(t)
+
+	// Drain a bucket of each key, with a quota on one of them
+	keys := []string{Key(ns, "user:1"), Key(ns, "user:2"), Key(ns, "api:1"), TenantKey(ns), testKey(t, "user:1")}
+	for _, key := range keys {
+		_, err := tb.Allow(ctx, key, 3, 0, 0)
+		require.NoError(t, err)
+	}
+	_, err := tb.Quota(ctx, Key(ns, "user:1"), 1, 5, time.Hour)
+	require.NoError(t, err)
+	exists := func(key string) bool {
+		n, err := rdb.Exists(ctx, "rl:"+key).Result()
+		require.NoError(t, err)
+		return n == 1
+	}
+
+	n, err := tb.DeletePrefix(ctx, ns, "user:", BulkDelete{Quotas: true, DryRun: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.True(t, exists(Key(ns, "user:1")), "a dry run deleted keys")
+
+	n, err = tb.DeletePrefix(ctx, ns, "user:", BulkDelete{KeysPerSecond: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	res, err := tb.Allow(ctx, Key(ns, "user:1"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed, "bucket wasn't refilled")
+	res, err = tb.Quota(ctx, Key(ns, "user:1"), 5, 5, time.Hour)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "quota was reset without Quotas")
+	// Other prefixes, the namespace's cap and keys outside it are untouched
+	for _, key := range keys[2:] {
+		assert.True(t, exists(key), key)
+	}
+
+	// Without a namespace, only keys outside every namespace match, with
+	// their named buckets
+	_, err = tb.Allow(ctx, BucketKey(testKey(t, "user:1"), "minute"), 1, 0, 0)
+	require.NoError(t, err)
+	n, err = tb.DeletePrefix(ctx, "", testKey(t, ""), BulkDelete{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.False(t, exists(testKey(t, "user:1")))
+	assert.False(t, exists(BucketKey(testKey(t, "user:1"), "minute")))
+	assert.True(t, exists(Key(ns, "api:1")))
+
+	// The whole namespace, with its quotas, but not its cap
+	n, err = tb.DeletePrefix(ctx, ns, "", BulkDelete{Quotas: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	assert.True(t, exists(TenantKey(ns)))
+
+	_, err = tb.DeletePrefix(ctx, "", "", BulkDelete{})
+	assert.ErrorIs(t, err, ErrNoPrefix)
+	_, err = tb.DeletePrefix(ctx, "a}", "b", BulkDelete{})
+	assert.ErrorIs(t, err, ErrInvalidNamespace)
+}
+
+func TestInspect(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	clock := &manualClock{now: time.Unix(1700000000, 250_000_000)}
+	tb := New(rdb, 5, 1.0, WithClock(clock))
+	ctx := context.Background()
+	key := testKey(t, "inspect")
+
+	st, err := tb.Inspect(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, st.Exists)
+	assert.False(t, st.RedisTime.IsZero())
+
+	_, err = tb.Allow(ctx, key, 2, 0, 0)
+	require.NoError(t, err)
+	clock.Advance(time.Second) // inspecting doesn't refill
+	st, err = tb.Inspect(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, st.Exists)
+	assert.Equal(t, "token_bucket", st.Algorithm)
+	assert.Equal(t, 3.0, st.Tokens)
+	assert.True(t, st.LastRefill.Equal(time.Unix(1700000000, 250_000_000)), st.LastRefill)
+	// Idle buckets expire once refilled, plus a minute
+	assert.InDelta(t, 65*time.Second, st.TTL, float64(time.Second))
+	assert.Equal(t, "3", st.Fields["tokens"])
+
+	// Buckets that never refill never expire
+	static := New(rdb, 5, 0)
+	_, err = static.Allow(ctx, testKey(t, "static"), 1, 0, 0)
+	require.NoError(t, err)
+	st, err = static.Inspect(ctx, testKey(t, "static"))
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, st.Tokens)
+	assert.Zero(t, st.TTL)
+}
+
+func TestAllowAll_Hierarchical(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 100, 0)
+	ctx := context.Background()
+
+	// Two users with 3 tokens each under a shared cap of 4
+	capBucket := Bucket{Key: TenantKey(testNamespace(t)), Burst: 4, Rate: 0.001}
+	for i := 0; i < 3; i++ {
+		res, _, err := tb.AllowAll(ctx, []Bucket{{Key: Key(testNamespace(t), "a"), Burst: 3, Rate: 0.001}, capBucket}, 1)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+
+	// User b has its own tokens but the cap only has one left
+	res, _, err := tb.AllowAll(ctx, []Bucket{{Key: Key(testNamespace(t), "b"), Burst: 3, Rate: 0.001}, capBucket}, 1)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, binding, err := tb.AllowAll(ctx, []Bucket{{Key: Key(testNamespace(t), "b"), Burst: 3, Rate: 0.001}, capBucket}, 1)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 1, binding, "tenant cap should be the binding bucket")
+	assert.Equal(t, int64(4), res.Limit)
+
+	// The denied call must not have consumed from user b's bucket
+	res, binding, err = tb.AllowAll(ctx, []Bucket{{Key: Key(testNamespace(t), "b"), Burst: 3, Rate: 0.001}, {Key: Key(testNamespace(t), "other"), Burst: 10, Rate: 0.001}}, 2)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, binding)
+	assert.Equal(t, int64(0), res.Remaining)
+}
+
+func TestAllowBatch(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 2, 0.001)
+	ctx := context.Background()
+
+	// A fresh Redis doesn't know the script yet
+	require.NoError(t, rdb.ScriptFlush(ctx).Err())
+
+	checks := []Check{
+		{Key: testKey(t, "batchA")},
+		{Key: testKey(t, "batchA")},
+		{Key: testKey(t, "batchA")},
+		{Key: testKey(t, "batchB"), Tokens: 5, Burst: 10},
+	}
+	results := tb.AllowBatch(ctx, checks)
+	require.Len(t, results, 4)
+	for _, r := range results {
+		require.NoError(t, r.Err)
+	}
+	assert.True(t, results[0].Allowed)
+	assert.True(t, results[1].Allowed)
+	assert.False(t, results[2].Allowed, "items run in order against the same bucket")
+	assert.True(t, results[3].Allowed)
+	assert.Equal(t, int64(5), results[3].Remaining)
+
+	peeks := tb.PeekBatch(ctx, []Check{{Key: testKey(t, "batchB"), Burst: 10}})
+	require.NoError(t, peeks[0].Err)
+	assert.Equal(t, int64(10), peeks[0].Limit)
+}
+
+func TestAllowBatch_Chunks(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, batchChunkSize+1, 0.001)
+	ctx := context.Background()
+
+	// Spans three script calls; the bucket runs dry in the second one
+	checks := make([]Check, 2*batchChunkSize+5)
+	for i := range checks {
+		checks[i] = Check{Key: testKey(t, "batchChunks")}
+	}
+	results := tb.AllowBatch(ctx, checks)
+	require.Len(t, results, len(checks))
+	for i, r := range results {
+		require.NoError(t, r.Err)
+		assert.Equal(t, i <= batchChunkSize, r.Allowed, "item %d", i)
+	}
+	assert.Equal(t, int64(0), results[batchChunkSize].Remaining)
+}
+
+func TestAllowBatch_Clock(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	clock := &manualClock{now: time.Unix(1700000000, 0)}
+	tb := New(rdb, 1, 1.0, WithClock(clock))
+	ctx := context.Background()
+
+	checks := []Check{{Key: testKey(t, "clockA")}, {Key: testKey(t, "clockB")}}
+	for _, want := range []bool{true, false} {
+		for _, r := range tb.AllowBatch(ctx, checks) {
+			require.NoError(t, r.Err)
+			assert.Equal(t, want, r.Allowed)
+		}
+	}
+
+	clock.Advance(time.Second)
+	for _, r := range tb.AllowBatch(ctx, checks) {
+		require.NoError(t, r.Err)
+		assert.True(t, r.Allowed)
+	}
+}
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, 0x31C3%slotCount, Slot("123456789"))
+	assert.Equal(t, 12182, Slot("foo"))
+
+	// A namespace's buckets share its slot
+	assert.Equal(t, Slot("{acme}"), Slot("rl:{acme}:user:1"))
+	assert.Equal(t, Slot("{acme}"), Slot("rl:{acme}"))
+
+	// Empty or unterminated tags hash the whole key
+	assert.Equal(t, 482, Slot("{}:svc"))
+	assert.Equal(t, 10756, Slot("rl:{acme"))
+}
+
+func TestBucketKey(t *testing.T) {
+	assert.Equal(t, "user:1", BucketKey("user:1", ""))
+	assert.Equal(t, "{acme}:user:1#minute", BucketKey(Key("acme", "user:1"), "minute"))
+	// Keys outside every namespace are tagged with themselves
+	assert.Equal(t, "{user:1}#minute", BucketKey("user:1", "minute"))
+	assert.Equal(t, Slot("user:1"), Slot(BucketKey("user:1", "minute")))
+	// unless they have a tag already
+	assert.Equal(t, "a{b}c#minute", BucketKey("a{b}c", "minute"))
+	assert.Equal(t, Slot("a{b}c"), Slot(BucketKey("a{b}c", "minute")))
+}
+
+// TestAllowAll_NamedBuckets checks that a key's chain of named buckets is
+// allowed in one script call, which on Redis Cluster (REDIS_TOPOLOGY=cluster)
+// needs them all in the key's slot, namespaced or not.
+func TestAllowAll_NamedBuckets(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 100, 0)
+	ctx := context.Background()
+
+	for _, id := range []string{testKey(t, "user:1"), Key(testNamespace(t), "user:1")} {
+		buckets := []Bucket{
+			{Key: id, Burst: 10, Rate: 0.001},
+			{Key: BucketKey(id, "minute"), Burst: 2, Rate: 0.001},
+			{Key: BucketKey(id, "day"), Burst: 5, Rate: 0.001},
+		}
+		for i := 0; i < 2; i++ {
+			res, _, err := tb.AllowAll(ctx, buckets, 1)
+			require.NoError(t, err, id)
+			assert.True(t, res.Allowed, id)
+		}
+		res, binding, err := tb.AllowAll(ctx, buckets, 1)
+		require.NoError(t, err, id)
+		assert.False(t, res.Allowed, id)
+		assert.Equal(t, 1, binding, id)
+	}
+}
+
+func TestAllowBatch_Cluster(t *testing.T) {
+	ctx := context.Background()
+	cc := redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{testAddr(t)}})
+	t.Cleanup(func() { cc.Close() })
+	if err := cc.ClusterSlots(ctx).Err(); err != nil {
+		t.Skipf("Redis Cluster not available: %v", err)
+	}
+	tb := New(cc, 2, 0.001)
+
+	// Keys across many slots, with repeats that must stay in order
+	var checks []Check
+	for i := 0; i < 50; i++ {
+		key := testKey(t, fmt.Sprint(i))
+		checks = append(checks, Check{Key: key}, Check{Key: key}, Check{Key: key})
+	}
+	t.Cleanup(func() {
+		for _, c := range checks {
+			cc.Del(ctx, "rl:"+c.Key)
+		}
+	})
+
+	results := tb.AllowBatch(ctx, checks)
+	require.Len(t, results, len(checks))
+	for i, r := range results {
+		require.NoError(t, r.Err)
+		assert.Equal(t, i%3 < 2, r.Allowed, "item %d", i)
+	}
+}
+
+func TestLeaser(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	tb := New(rdb, 100, 0.001)
+	l := NewLeaser(tb, 5, 10, time.Minute)
+	ctx := context.Background()
+
+	tokens := func() float64 {
+		v, _ := rdb.HGet(ctx, "rl:"+testKey(t, "hot"), "tokens").Float64()
+		return v
+	}
+
+	// Below the threshold every call goes to Redis
+	for i := 0; i < 4; i++ {
+		res, err := l.Allow(ctx, testKey(t, "hot"), 1, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	assert.InDelta(t, 96, tokens(), 0.01)
+
+	// The 5th call makes the key hot and leases a chunk of 10
+	res, err := l.Allow(ctx, testKey(t, "hot"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, int64(95), res.Remaining)
+	assert.InDelta(t, 86, tokens(), 0.01)
+
+	// Further calls are answered from the lease
+	for i := 0; i < 3; i++ {
+		res, err = l.Allow(ctx, testKey(t, "hot"), 1, 0, 0)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+	assert.Equal(t, int64(92), res.Remaining)
+	assert.InDelta(t, 86, tokens(), 0.01)
+
+	// Releasing gives the 6 unused tokens back
+	l.Release(ctx, true)
+	assert.InDelta(t, 92, tokens(), 0.01)
+}
+
+// slowHook delays every command while delay is set.
+type slowHook struct{ delay atomic.Int64 }
+
+func (h *slowHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *slowHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		time.Sleep(time.Duration(h.delay.Load()))
+		return next(ctx, cmd)
+	}
+}
+
+func (h *slowHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestBudgeter(t *testing.T) {
+	t.Parallel()
+	rdb := testRedis(t)
+	hook := &slowHook{}
+	rdb.AddHook(hook)
+	tb := New(rdb, 2, 0.001)
+	b := NewBudgeter(tb, 20*time.Millisecond)
+	ctx := context.Background()
+
+	// Fast Redis: answered by Redis, which seeds the local state
+	res, err := b.Allow(ctx, testKey(t, "budget"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// Slow Redis: answered locally within the budget
+	hook.delay.Store(int64(100 * time.Millisecond))
+	start := time.Now()
+	res, err = b.Allow(ctx, testKey(t, "budget"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	res, err = b.Allow(ctx, testKey(t, "budget"), 1, 0, 0)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed, "local state has run dry")
+	assert.Less(t, time.Since(start), 80*time.Millisecond)
+
+	// Redis saw both; the second was denied there too, so nothing changes
+	hook.delay.Store(0)
+	time.Sleep(250 * time.Millisecond)
+	tokens, err := rdb.HGet(ctx, "rl:"+testKey(t, "budget"), "tokens").Float64()
+	require.NoError(t, err)
+	assert.InDelta(t, 0, tokens, 0.01)
+}
+
+func TestWarmer(t *testing.T) {
+	rdb := testRedis(t)
+	tb := New(rdb, 2, 0.001)
+	ctx := context.Background()
+	require.NoError(t, rdb.ScriptFlush(ctx).Err())
+
+	w := NewWarmer(tb, 4, 3)
+	assert.False(t, w.Ready())
+	require.NoError(t, w.Warm(ctx))
+	assert.True(t, w.Ready())
+
+	for _, s := range tb.scripts().all() {
+		exists, err := s.Exists(ctx, rdb).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true}, exists)
+	}
+	tokens, err := rdb.HGet(ctx, "rl:"+warmupKey, "tokens").Float64()
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, tokens, "warm-up evals consume nothing")
+}
+
+func TestDecodeResponse(t *testing.T) {
+	vals, err := decodeResponse([]interface{}{int64(1), int64(4), int64(5), int64(1700000000), int64(0)}, 5)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: true, Remaining: 4, Limit: 5, ResetAt: 1700000000}, parseResult(vals))
+
+	for _, raw := range []interface{}{
+		nil,
+		"OK",
+		[]interface{}{int64(1), int64(2)},
+		[]interface{}{int64(1), "4", int64(5), int64(0), int64(0)},
+	} {
+		_, err := decodeResponse(raw, 5)
+		assert.ErrorIs(t, err, ErrBadResponse, "%#v", raw)
+	}
+}
+
+// FuzzDecodeResponse feeds decodeResponse arrays built from arbitrary bytes:
+// it must reject anything parseResult can't read instead of panicking.
+func FuzzDecodeResponse(f *testing.F) {
+	f.Add([]byte{0, 1, 0, 4, 0, 5, 0, 9, 0, 0})
+	f.Add([]byte{1, 'x', 2, 0})
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Each value is a type byte then a payload byte.
+		var vals []interface{}
+		for i := 0; i+1 < len(data); i += 2 {
+			switch data[i] % 4 {
+			case 0:
+				vals = append(vals, int64(data[i+1]))
+			case 1:
+				vals = append(vals, string(data[i+1:i+2]))
+			case 2:
+				vals = append(vals, nil)
+			case 3:
+				vals = append(vals, []interface{}{int64(data[i+1])})
+			}
+		}
+		got, err := decodeResponse(vals, 5)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrBadResponse)
+			return
+		}
+		parseResult(got)
+	})
+}
+
+// FuzzKey checks that every namespace and key ValidateKey accepts survive a
+// round trip through Key and SplitKey, and that namespaced buckets share
+// their tenant bucket's slot.
+func FuzzKey(f *testing.F) {
+	f.Add("", "user:1")
+	f.Add("acme", "user:1")
+	f.Add("acme", "")
+	f.Add("acme", ":::")
+	f.Add("ünï", "κλειδί:🔑")
+	f.Add("a b", "{x}")
+	f.Add("", strings.Repeat("k", 1<<16))
+	f.Fuzz(func(t *testing.T, namespace, key string) {
+		if ValidateKey(namespace, key) != nil {
+			return
+		}
+		id := Key(namespace, key)
+		ns, k := SplitKey(id)
+		assert.Equal(t, namespace, ns)
+		assert.Equal(t, key, k)
+
+		slot := Slot(id)
+		assert.True(t, slot >= 0 && slot < slotCount)
+		if namespace != "" {
+			assert.Equal(t, Slot(TenantKey(namespace)), slot)
+		}
+
+		// Named buckets share their key's slot, unless it can't be tagged
+		bucket := BucketKey(id, "minute")
+		if _, tagged := hashTag(id); key != "" && (tagged || !strings.Contains(id, "}")) {
+			assert.Equal(t, slot, Slot(bucket))
+			ns, k = SplitKey(bucket)
+			assert.Equal(t, namespace, ns)
+			assert.Equal(t, key+"#minute", k)
+		}
+	})
+}
+
+func TestEvalArgs_Allocs(t *testing.T) {
+	tb := New(nil, 100, 10)
+
+	// The key is the only per-call allocation.
+	allocs := testing.AllocsPerRun(1000, func() {
+		tb.evalArgs("user:1", 1, 0, 0).release()
+	})
+	assert.LessOrEqual(t, allocs, 1.0)
+
+	a := tb.evalArgs("user:1", 3, 50, 2.5)
+	assert.Equal(t, []string{"rl:user:1"}, a.keys)
+	assert.Equal(t, int64(50), a.argv[0])
+	assert.Equal(t, 2.5, a.argv[1])
+	assert.Equal(t, int64(3), a.argv[2])
+	a.release()
+
+	a = tb.evalArgs("user:1", 0.5, 0, 0)
+	assert.Equal(t, 0.5, a.argv[2])
+	a.release()
 }
 
 func BenchmarkAllow(b *testing.B) {
-	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 15})
+	rdb := testRedis(b)
 	ctx := context.Background()
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		b.Skipf("Redis not available: %v", err)
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = testKey(b, fmt.Sprint(i))
 	}
-	defer rdb.FlushDB(ctx)
-	defer rdb.Close()
 
 	tb := New(rdb, 1000000, 1000000) // large bucket so we don't get denied
+	b.ReportAllocs()
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		i := 0
 		for pb.Next() {
-			key := fmt.Sprintf("bench:%d", i%1000)
-			tb.Allow(ctx, key, 1, 0, 0)
+			tb.Allow(ctx, keys[i%len(keys)], 1, 0, 0)
 			i++
 		}
 	})
+}
+
+func BenchmarkEvalArgs(b *testing.B) {
+	tb := New(nil, 100, 10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tb.evalArgs("user:1", 1, 0, 0).release()
+	}
 }
\ No newline at end of file
@@ -0,0 +1,109 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmupKey is the bucket the warm-up evals run against. Keys can't start
+// with '{', so it can't collide with a caller's bucket.
+const warmupKey = "{}:warmup"
+
+// Warmer prepares the limiter's Redis connections before it serves: it
+// opens connections, loads the scripts, and runs a few no-op evals, so the
+// first requests after a deploy or failover don't pay for dials, NOSCRIPT
+// retries and cold script caches. It warms again when Redis comes back
+// after being unreachable.
+type Warmer struct {
+	tb    *TokenBucket
+	conns int
+	evals int
+
+	ready atomic.Bool
+}
+
+// NewWarmer creates a Warmer that opens conns connections and runs evals
+// no-op evals.
+func NewWarmer(tb *TokenBucket, conns, evals int) *Warmer {
+	return &Warmer{tb: tb, conns: conns, evals: evals}
+}
+
+// Ready reports whether the last warm-up succeeded and Redis hasn't been
+// unreachable since.
+func (w *Warmer) Ready() bool {
+	return w.ready.Load()
+}
+
+// Warm warms the limiter's client and marks it ready.
+func (w *Warmer) Warm(ctx context.Context) error {
+	rdb := w.tb.client()
+
+	// Concurrent commands each need a connection of their own.
+	errs := make(chan error, w.conns)
+	var wg sync.WaitGroup
+	for i := 0; i < w.conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- rdb.Ping(ctx).Err()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return fmt.Errorf("redis ping: %w", err)
+		}
+	}
+
+	for _, s := range w.tb.scripts().all() {
+		if err := s.Load(ctx, rdb).Err(); err != nil {
+			return fmt.Errorf("redis script load: %w", err)
+		}
+	}
+
+	// Requesting no tokens leaves the bucket as it is.
+	for i := 0; i < w.evals; i++ {
+		if err := w.tb.scripts().script.Run(ctx, rdb, []string{"rl:" + warmupKey}, 1, 1, 0).Err(); err != nil {
+			return fmt.Errorf("redis eval: %w", err)
+		}
+	}
+
+	w.ready.Store(true)
+	return nil
+}
+
+// Run pings Redis every interval until ctx is cancelled. When Redis stops
+// answering, the limiter is marked not ready until it answers again and a
+// new warm-up has succeeded.
+func (w *Warmer) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		err := w.tb.Ping(pingCtx)
+		cancel()
+		switch {
+		case err != nil && w.ready.Swap(false):
+			log.Printf("redis unreachable, limiter not ready: %v", err)
+		case err == nil && !w.ready.Load():
+			warmCtx, cancel := context.WithTimeout(ctx, 5*interval)
+			if err := w.Warm(warmCtx); err != nil {
+				log.Printf("limiter warm-up failed: %v", err)
+			} else {
+				log.Printf("limiter warmed up, ready")
+			}
+			cancel()
+		}
+	}
+}
\ No newline at end of file
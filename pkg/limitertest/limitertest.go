@@ -0,0 +1,126 @@
+// Package limitertest provides a fake client.Limiter for testing code that
+// uses the client SDK, e.g. how it handles denials.
+package limitertest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+)
+
+// Fake is an in-memory client.Limiter with scripted answers. Each key may
+// consume a fixed number of tokens; once they're used up, calls for it are
+// denied with a fixed RetryAfter. Tokens never refill. It is safe for
+// concurrent use.
+type Fake struct {
+	mu         sync.Mutex
+	allowance  int64 // per key; negative means unlimited
+	retryAfter time.Duration
+	err        error
+	used       map[string]int64
+	calls      []Call
+}
+
+// Call is one Allow or Peek call recorded by a Fake.
+type Call struct {
+	Key    string
+	Tokens int64 // 0 for Peek
+	Peek   bool
+}
+
+var _ client.Limiter = (*Fake)(nil)
+
+// AlwaysAllow returns a Fake that allows every call.
+func AlwaysAllow() *Fake {
+	return DenyAfter(-1)
+}
+
+// AlwaysDeny returns a Fake that denies every call.
+func AlwaysDeny() *Fake {
+	return DenyAfter(0)
+}
+
+// DenyAfter returns a Fake that allows each key n tokens and then denies
+// it. A negative n never denies.
+func DenyAfter(n int64) *Fake {
+	return &Fake{allowance: n, retryAfter: time.Second, used: map[string]int64{}}
+}
+
+// WithRetryAfter sets the RetryAfter of denials, one second by default.
+func (f *Fake) WithRetryAfter(d time.Duration) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.retryAfter = d
+	return f
+}
+
+// WithError makes every call fail with err, as when the service is
+// unreachable. A nil err restores normal answers.
+func (f *Fake) WithError(err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+	return f
+}
+
+// Allow consumes tokens (default 1) from key's allowance.
+func (f *Fake) Allow(_ context.Context, key string, tokens int64) (*client.Result, error) {
+	if tokens <= 0 {
+		tokens = 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Key: key, Tokens: tokens})
+	if f.err != nil {
+		return nil, f.err
+	}
+	allowed := f.allowance < 0 || f.used[key]+tokens <= f.allowance
+	if allowed {
+		f.used[key] += tokens
+	}
+	return f.result(key, allowed), nil
+}
+
+// Peek returns key's state without consuming tokens.
+func (f *Fake) Peek(_ context.Context, key string) (*client.Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, Call{Key: key, Peek: true})
+	if f.err != nil {
+		return nil, f.err
+	}
+	res := f.result(key, true)
+	res.Allowed = f.allowance < 0 || res.Remaining > 0
+	return res, nil
+}
+
+// result builds an answer for key. f.mu must be held.
+func (f *Fake) result(key string, allowed bool) *client.Result {
+	res := &client.Result{Allowed: allowed, ResetAt: time.Now()}
+	if f.allowance >= 0 {
+		res.Limit = f.allowance
+		res.Remaining = f.allowance - f.used[key]
+	}
+	if !allowed {
+		res.RetryAfter = f.retryAfter
+		res.ResetAt = res.ResetAt.Add(f.retryAfter)
+	}
+	return res
+}
+
+// Calls returns the calls made so far, in order.
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Reset forgets the tokens consumed and the calls made.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.used = map[string]int64{}
+	f.calls = nil
+}
@@ -0,0 +1,60 @@
+package limitertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyAfter(t *testing.T) {
+	ctx := context.Background()
+	f := DenyAfter(2).WithRetryAfter(5 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		res, err := f.Allow(ctx, "a", 1)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, int64(1-i), res.Remaining)
+	}
+	res, err := f.Allow(ctx, "a", 1)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 5*time.Second, res.RetryAfter)
+
+	// Keys have separate allowances
+	res, err = f.Allow(ctx, "b", 2)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	peek, err := f.Peek(ctx, "b")
+	require.NoError(t, err)
+	assert.False(t, peek.Allowed)
+	assert.Len(t, f.Calls(), 5)
+
+	f.Reset()
+	res, err = f.Allow(ctx, "a", 1)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+}
+
+func TestAlwaysAllow(t *testing.T) {
+	f := AlwaysAllow()
+	for i := 0; i < 100; i++ {
+		res, err := f.Allow(context.Background(), "a", 10)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+	}
+}
+
+func TestWithError(t *testing.T) {
+	boom := errors.New("unavailable")
+	f := AlwaysAllow().WithError(boom)
+	_, err := f.Allow(context.Background(), "a", 1)
+	assert.ErrorIs(t, err, boom)
+	_, err = f.Peek(context.Background(), "a")
+	assert.ErrorIs(t, err, boom)
+}
@@ -0,0 +1,132 @@
+package loadtest
+
+import (
+	"slices"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// LatencySummary holds latency percentiles in milliseconds.
+type LatencySummary struct {
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	P999  float64 `json:"p99_9"`
+	P9999 float64 `json:"p99_99"`
+	Max   float64 `json:"max"`
+}
+
+// Summarize returns the percentiles of h, which holds microseconds.
+func Summarize(h *hdrhistogram.Histogram) *LatencySummary {
+	ms := func(p float64) float64 { return float64(h.ValueAtQuantile(p)) / 1000 }
+	return &LatencySummary{
+		P50:   ms(50),
+		P90:   ms(90),
+		P95:   ms(95),
+		P99:   ms(99),
+		P999:  ms(99.9),
+		P9999: ms(99.99),
+		Max:   float64(h.Max()) / 1000,
+	}
+}
+
+// Run is what Compare checks of a run's report.
+type Run struct {
+	RPS              float64
+	Requests, Errors int64
+	// Latency and CorrectedLatency are nil for runs without calls
+	Latency, CorrectedLatency *LatencySummary
+	RPCs                      []RPCLatency
+}
+
+// RPCLatency is the latency of one RPC of a run's mix.
+type RPCLatency struct {
+	RPC     string
+	Latency *LatencySummary // nil for RPCs never called
+}
+
+// Thresholds are how far a run may fall behind its baseline.
+type Thresholds struct {
+	LatencyPct float64 // rise of any latency percentile, in %
+	RPSPct     float64 // drop in throughput, in %
+	ErrorPts   float64 // rise in error rate, in percentage points
+}
+
+// Comparison is a run's results against a baseline's.
+type Comparison struct {
+	Baseline    string       `json:"baseline"`
+	Metrics     []MetricDiff `json:"metrics"`
+	Regressions int          `json:"regressions"`
+}
+
+// MetricDiff compares a metric between the baseline and the run. Change
+// is in percent, or in percentage points for rates.
+type MetricDiff struct {
+	Metric    string  `json:"metric"`
+	Baseline  float64 `json:"baseline"`
+	Current   float64 `json:"current"`
+	Change    float64 `json:"change"`
+	Limit     float64 `json:"limit"`
+	Regressed bool    `json:"regressed"`
+}
+
+// Compare checks cur against base. Latencies missing from either run are
+// skipped, as are those of RPCs the baseline didn't call; RPCs are only
+// compared when either run mixed several.
+func Compare(base, cur Run, limits Thresholds) *Comparison {
+	c := &Comparison{}
+	// Higher is worse unless lowerWorse
+	add := func(metric string, b, v, limit float64, points, lowerWorse bool) {
+		d := MetricDiff{Metric: metric, Baseline: b, Current: v, Limit: limit}
+		switch {
+		case points:
+			d.Change = v - b
+		case b != 0:
+			d.Change = (v - b) / b * 100
+		}
+		if lowerWorse {
+			d.Regressed = -d.Change > limit
+		} else {
+			d.Regressed = d.Change > limit
+		}
+		if d.Regressed {
+			c.Regressions++
+		}
+		c.Metrics = append(c.Metrics, d)
+	}
+	latencies := func(prefix string, b, v *LatencySummary) {
+		if b == nil || v == nil {
+			return
+		}
+		for _, p := range []struct {
+			name string
+			b, v float64
+		}{
+			{"p50", b.P50, v.P50},
+			{"p99", b.P99, v.P99},
+			{"p99.9", b.P999, v.P999},
+		} {
+			add(prefix+p.name+" ms", p.b, p.v, limits.LatencyPct, false, false)
+		}
+	}
+
+	add("rps", base.RPS, cur.RPS, limits.RPSPct, false, true)
+	add("error rate %", pct(base.Errors, base.Requests), pct(cur.Errors, cur.Requests), limits.ErrorPts, true, false)
+	latencies("", base.Latency, cur.Latency)
+	latencies("corrected ", base.CorrectedLatency, cur.CorrectedLatency)
+	for _, s := range cur.RPCs {
+		i := slices.IndexFunc(base.RPCs, func(b RPCLatency) bool { return b.RPC == s.RPC })
+		if i >= 0 && (len(cur.RPCs) > 1 || len(base.RPCs) > 1) {
+			latencies(s.RPC+" ", base.RPCs[i].Latency, s.Latency)
+		}
+	}
+	return c
+}
+
+func pct(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total) * 100
+}
\ No newline at end of file
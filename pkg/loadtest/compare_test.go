@@ -0,0 +1,166 @@
+package loadtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var limits = Thresholds{LatencyPct: 10, RPSPct: 5, ErrorPts: 0.1}
+
+func latency(p50, p99, p999 float64) *LatencySummary {
+	return &LatencySummary{P50: p50, P99: p99, P999: p999}
+}
+
+func baseRun() Run {
+	return Run{
+		RPS:              1000,
+		Requests:         10000,
+		Errors:           10,
+		Latency:          latency(1, 2, 4),
+		CorrectedLatency: latency(1, 3, 5),
+		RPCs: []RPCLatency{
+			{RPC: "allow", Latency: latency(1, 2, 4)},
+			{RPC: "peek", Latency: latency(0.5, 1, 2)},
+		},
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		// change edits a copy of the baseline into the run
+		change      func(r *Run)
+		regressions []string
+		metrics     int
+	}{
+		{
+			name:    "same run",
+			change:  func(r *Run) {},
+			metrics: 14,
+		},
+		{
+			name: "within limits",
+			change: func(r *Run) {
+				r.RPS = 960
+				r.Errors = 19
+				r.Latency = latency(1.05, 2.1, 4.2)
+			},
+			metrics: 14,
+		},
+		{
+			name: "faster and fewer errors",
+			change: func(r *Run) {
+				r.RPS = 2000
+				r.Errors = 0
+				r.Latency = latency(0.5, 1, 2)
+			},
+			metrics: 14,
+		},
+		{
+			name:        "latency regressed",
+			change:      func(r *Run) { r.Latency = latency(1, 2.5, 4) },
+			regressions: []string{"p99 ms"},
+			metrics:     14,
+		},
+		{
+			name:        "rps regressed",
+			change:      func(r *Run) { r.RPS = 900 },
+			regressions: []string{"rps"},
+			metrics:     14,
+		},
+		{
+			name:        "error rate regressed",
+			change:      func(r *Run) { r.Errors = 30 },
+			regressions: []string{"error rate %"},
+			metrics:     14,
+		},
+		{
+			name: "rpc latency regressed",
+			change: func(r *Run) {
+				r.RPCs = []RPCLatency{
+					{RPC: "allow", Latency: latency(1, 2, 4)},
+					{RPC: "peek", Latency: latency(0.5, 1, 3)},
+				}
+			},
+			regressions: []string{"peek p99.9 ms"},
+			metrics:     14,
+		},
+		{
+			name: "no latencies",
+			change: func(r *Run) {
+				r.Latency, r.CorrectedLatency = nil, nil
+			},
+			metrics: 8,
+		},
+		{
+			name: "rpc never called",
+			change: func(r *Run) {
+				r.RPCs = []RPCLatency{{RPC: "allow", Latency: latency(1, 2, 4)}, {RPC: "peek"}}
+			},
+			metrics: 11,
+		},
+		{
+			name: "rpc missing from baseline",
+			change: func(r *Run) {
+				r.RPCs = append(r.RPCs, RPCLatency{RPC: "batch", Latency: latency(9, 9, 9)})
+			},
+			metrics: 14,
+		},
+		{
+			name: "single rpc",
+			change: func(r *Run) {
+				r.RPCs = r.RPCs[:1]
+			},
+			// Compared while the baseline mixed several
+			metrics: 11,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur := baseRun()
+			cur.RPCs = append([]RPCLatency(nil), cur.RPCs...)
+			tt.change(&cur)
+			c := Compare(baseRun(), cur, limits)
+
+			var regressed []string
+			for _, d := range c.Metrics {
+				if d.Regressed {
+					regressed = append(regressed, d.Metric)
+				}
+			}
+			assert.Equal(t, tt.regressions, regressed)
+			assert.Equal(t, len(tt.regressions), c.Regressions)
+			assert.Len(t, c.Metrics, tt.metrics)
+		})
+	}
+}
+
+func TestCompare_SingleRPC(t *testing.T) {
+	base, cur := baseRun(), baseRun()
+	base.RPCs, cur.RPCs = base.RPCs[:1], cur.RPCs[:1]
+	cur.RPCs[0].Latency = latency(9, 9, 9)
+
+	// The RPC's latencies are the run's
+	c := Compare(base, cur, limits)
+	assert.Len(t, c.Metrics, 8)
+	assert.Zero(t, c.Regressions)
+}
+
+func TestCompare_Change(t *testing.T) {
+	base, cur := baseRun(), baseRun()
+	cur.RPS = 900
+	cur.Errors = 30
+
+	c := Compare(base, cur, limits)
+	assert.Equal(t, MetricDiff{Metric: "rps", Baseline: 1000, Current: 900, Change: -10, Limit: 5, Regressed: true}, c.Metrics[0])
+	// Rates change by points
+	assert.Equal(t, "error rate %", c.Metrics[1].Metric)
+	assert.InDelta(t, 0.2, c.Metrics[1].Change, 1e-9)
+
+	// Nothing to compare against
+	base.RPS = 0
+	c = Compare(base, cur, limits)
+	assert.Zero(t, c.Metrics[0].Change)
+	assert.False(t, c.Metrics[0].Regressed)
+}
\ No newline at end of file
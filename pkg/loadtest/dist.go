@@ -0,0 +1,67 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// KeyDist draws key indexes in [0, n). With the skewed distributions,
+// lower indexes are hotter.
+type KeyDist struct {
+	name string
+	n    int
+	skew float64
+}
+
+// NewKeyDist returns the uniform, zipf or pareto distribution over n keys.
+// Skew is zipf's exponent, above 1, or pareto's shape, above 0.
+func NewKeyDist(name string, n int, skew float64) (KeyDist, error) {
+	d := KeyDist{name: name, n: n, skew: skew}
+	if n < 1 {
+		return d, fmt.Errorf("-keys must be at least 1")
+	}
+	switch name {
+	case "uniform":
+	case "zipf":
+		if skew <= 1 {
+			return d, fmt.Errorf("-skew must be above 1 for zipf, got %g", skew)
+		}
+	case "pareto":
+		if skew <= 0 {
+			return d, fmt.Errorf("-skew must be positive for pareto, got %g", skew)
+		}
+	default:
+		return d, fmt.Errorf("unknown -dist %q, want uniform, zipf or pareto", name)
+	}
+	return d, nil
+}
+
+func (d KeyDist) String() string {
+	if d.name == "uniform" {
+		return d.name
+	}
+	return fmt.Sprintf("%s, skew %g", d.name, d.skew)
+}
+
+// Sampler returns a function drawing keys with r, which it must own.
+func (d KeyDist) Sampler(r *rand.Rand) func() int {
+	switch d.name {
+	case "zipf":
+		z := rand.NewZipf(r, d.skew, 1, uint64(d.n-1))
+		return func() int { return int(z.Uint64()) }
+	case "pareto":
+		// Rank k is drawn with probability ~ k^-(skew+1), resampling the
+		// tail past the last key rather than piling it onto it.
+		return func() int {
+			for {
+				x := math.Pow(1-r.Float64(), -1/d.skew) // Pareto with x_m = 1
+				if k := int(x) - 1; k < d.n {
+					return k
+				}
+			}
+		}
+	default:
+		return func() int { return r.Intn(d.n) }
+	}
+}
\ No newline at end of file
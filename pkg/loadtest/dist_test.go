@@ -0,0 +1,66 @@
+package loadtest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyDist(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		dist string
+		n    int
+		skew float64
+		// hottest is the least share of draws the hottest key gets
+		hottest float64
+	}{
+		{"uniform", "uniform", 100, 0, 0},
+		{"one key", "uniform", 1, 0, 1},
+		{"zipf", "zipf", 1000, 1.1, 0.15},
+		{"steep zipf", "zipf", 1000, 2, 0.5},
+		{"zipf one key", "zipf", 1, 1.1, 1},
+		{"pareto", "pareto", 1000, 1, 0.4},
+		{"flat pareto", "pareto", 10, 0.1, 0.05},
+		{"pareto one key", "pareto", 1, 1, 1},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := NewKeyDist(c.dist, c.n, c.skew)
+			require.NoError(t, err)
+			next := d.Sampler(rand.New(rand.NewSource(1)))
+
+			const draws = 20000
+			hits := make([]int, c.n)
+			for i := 0; i < draws; i++ {
+				k := next()
+				require.GreaterOrEqual(t, k, 0)
+				require.Less(t, k, c.n)
+				hits[k]++
+			}
+			assert.GreaterOrEqual(t, float64(hits[0])/draws, c.hottest)
+			if c.dist == "uniform" && c.n > 1 {
+				for k, n := range hits {
+					assert.InDelta(t, draws/c.n, n, float64(draws/c.n/2), "key %d", k)
+				}
+			}
+		})
+	}
+}
+
+func TestNewKeyDist_Invalid(t *testing.T) {
+	for _, c := range []struct {
+		dist string
+		n    int
+		skew float64
+	}{
+		{"uniform", 0, 0},
+		{"zipf", 10, 1},
+		{"pareto", 10, 0},
+		{"normal", 10, 1},
+	} {
+		_, err := NewKeyDist(c.dist, c.n, c.skew)
+		assert.Error(t, err, "%s over %d keys, skew %g", c.dist, c.n, c.skew)
+	}
+}
\ No newline at end of file
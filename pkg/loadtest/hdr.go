@@ -0,0 +1,27 @@
+package loadtest
+
+import (
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// MaxLatency is the highest latency recorded; slower calls are recorded as
+// taking this long.
+const MaxLatency = time.Minute
+
+// NewHistogram returns a histogram of latencies in microseconds, from 1µs
+// to MaxLatency, with precision significant digits.
+func NewHistogram(precision int) *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, MaxLatency.Microseconds(), precision)
+}
+
+// Record records latency d in h, clamped to the histogram's range.
+func Record(h *hdrhistogram.Histogram, d time.Duration) {
+	h.RecordValue(min(max(d.Microseconds(), 1), MaxLatency.Microseconds()))
+}
+
+// Percentile returns the latency at percentile p of h.
+func Percentile(h *hdrhistogram.Histogram, p float64) time.Duration {
+	return time.Duration(h.ValueAtQuantile(p)) * time.Microsecond
+}
\ No newline at end of file
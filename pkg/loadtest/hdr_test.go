@@ -0,0 +1,56 @@
+package loadtest
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecord(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		lat  time.Duration
+		want time.Duration
+	}{
+		{"zero", 0, time.Microsecond},
+		{"under a microsecond", 400 * time.Nanosecond, time.Microsecond},
+		{"microseconds", 750 * time.Microsecond, 750 * time.Microsecond},
+		{"milliseconds", 12 * time.Millisecond, 12 * time.Millisecond},
+		{"at the limit", MaxLatency, MaxLatency},
+		{"past the limit", time.Hour, MaxLatency},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewHistogram(3)
+			Record(h, c.lat)
+			assert.InEpsilon(t, c.want.Seconds(), Percentile(h, 100).Seconds(), 1e-3)
+		})
+	}
+}
+
+func TestNewHistogram_Precision(t *testing.T) {
+	lats := []time.Duration{
+		time.Microsecond + 1,
+		1234 * time.Microsecond,
+		98765 * time.Microsecond,
+		54321 * time.Millisecond,
+	}
+	for precision := 1; precision <= 5; precision++ {
+		for _, lat := range lats {
+			h := NewHistogram(precision)
+			Record(h, lat)
+			want := time.Duration(lat.Microseconds()) * time.Microsecond
+			assert.InEpsilon(t, want.Seconds(), Percentile(h, 50).Seconds(), math.Pow10(-precision),
+				"%s to %d digits", lat, precision)
+		}
+	}
+
+	// The tail is as precise as the median
+	h := NewHistogram(3)
+	for i := 1; i <= 10000; i++ {
+		Record(h, time.Duration(i)*time.Millisecond)
+	}
+	assert.InEpsilon(t, 5.0, Percentile(h, 50).Seconds(), 1e-3)
+	assert.InEpsilon(t, 9.999, Percentile(h, 99.99).Seconds(), 1e-3)
+}
\ No newline at end of file
@@ -0,0 +1,112 @@
+package loadtest
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RPC is an RPC a mix can call.
+type RPC struct {
+	Name string
+	// Batch RPCs take many keys, 10 by default
+	Batch bool
+}
+
+// Mix picks the RPC of each call, by weight.
+type Mix struct {
+	Entries []MixEntry
+	total   float64
+}
+
+// MixEntry is an RPC of a mix.
+type MixEntry struct {
+	RPC    RPC
+	Index  int // of RPC in the RPCs the mix was parsed from
+	Size   int // keys per call
+	Weight float64
+}
+
+// ParseMix parses "RPC[:SIZE]=WEIGHT,..." such as
+// "allow=90,peek=8,batch_allow:10=2", naming RPCs of rpcs.
+func ParseMix(spec string, rpcs []RPC) (*Mix, error) {
+	m := &Mix{}
+	for _, part := range strings.Split(spec, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		w, err := strconv.ParseFloat(weight, 64)
+		if !ok || err != nil || w <= 0 {
+			return nil, fmt.Errorf("bad -mix entry %q, want RPC[:SIZE]=WEIGHT", part)
+		}
+		name, size, sized := strings.Cut(name, ":")
+		i := slices.IndexFunc(rpcs, func(r RPC) bool { return r.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("bad -mix entry %q: unknown RPC %q, want %s", part, name, oneOf(rpcs))
+		}
+		if slices.ContainsFunc(m.Entries, func(e MixEntry) bool { return e.RPC.Name == name }) {
+			return nil, fmt.Errorf("bad -mix entry %q: %s listed twice", part, name)
+		}
+		e := MixEntry{RPC: rpcs[i], Index: i, Size: 1, Weight: w}
+		if rpcs[i].Batch {
+			e.Size = 10
+		}
+		if sized {
+			n, err := strconv.Atoi(size)
+			if !rpcs[i].Batch || err != nil || n < 1 {
+				return nil, fmt.Errorf("bad -mix entry %q: only batch RPCs take a size, at least 1", part)
+			}
+			e.Size = n
+		}
+		m.Entries = append(m.Entries, e)
+		m.total += w
+	}
+	return m, nil
+}
+
+// oneOf lists the names of rpcs as "a, b or c".
+func oneOf(rpcs []RPC) string {
+	names := make([]string, len(rpcs))
+	for i, r := range rpcs {
+		names[i] = r.Name
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func (m *Mix) String() string {
+	parts := make([]string, len(m.Entries))
+	for i, e := range m.Entries {
+		parts[i] = e.RPC.Name
+		if e.RPC.Batch {
+			parts[i] += ":" + strconv.Itoa(e.Size)
+		}
+		parts[i] += "=" + strconv.FormatFloat(e.Weight, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Pick returns the index of the entry to call next.
+func (m *Mix) Pick(r *rand.Rand) int {
+	return PickWeighted(r, len(m.Entries), m.total, func(i int) float64 { return m.Entries[i].Weight })
+}
+
+// Share returns entry i's share of the mix's weight, in %.
+func (m *Mix) Share(i int) float64 {
+	return m.Entries[i].Weight / m.total * 100
+}
+
+// PickWeighted picks one of n choices in proportion to its weight, total
+// being the sum of their weights.
+func PickWeighted(r *rand.Rand, n int, total float64, weight func(i int) float64) int {
+	x := r.Float64() * total
+	for i := 0; i < n; i++ {
+		if x < weight(i) {
+			return i
+		}
+		x -= weight(i)
+	}
+	return n - 1
+}
\ No newline at end of file
@@ -0,0 +1,79 @@
+package loadtest
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var mixRPCs = []RPC{{Name: "allow"}, {Name: "peek"}, {Name: "batch_allow", Batch: true}}
+
+func TestParseMix(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		want []MixEntry
+		str  string
+	}{
+		{"allow=100", []MixEntry{{RPC: mixRPCs[0], Index: 0, Size: 1, Weight: 100}}, "allow=100"},
+		{"peek=1, allow=3", []MixEntry{
+			{RPC: mixRPCs[1], Index: 1, Size: 1, Weight: 1},
+			{RPC: mixRPCs[0], Index: 0, Size: 1, Weight: 3},
+		}, "peek=1,allow=3"},
+		{"batch_allow=2", []MixEntry{{RPC: mixRPCs[2], Index: 2, Size: 10, Weight: 2}}, "batch_allow:10=2"},
+		{"allow=0.5,batch_allow:25=0.5", []MixEntry{
+			{RPC: mixRPCs[0], Index: 0, Size: 1, Weight: 0.5},
+			{RPC: mixRPCs[2], Index: 2, Size: 25, Weight: 0.5},
+		}, "allow=0.5,batch_allow:25=0.5"},
+	} {
+		m, err := ParseMix(c.spec, mixRPCs)
+		require.NoError(t, err, c.spec)
+		assert.Equal(t, c.want, m.Entries, c.spec)
+		assert.Equal(t, c.str, m.String())
+	}
+
+	for spec, msg := range map[string]string{
+		"allow":               "want RPC[:SIZE]=WEIGHT",
+		"allow=0":             "want RPC[:SIZE]=WEIGHT",
+		"allow=-1":            "want RPC[:SIZE]=WEIGHT",
+		"quota=1":             `unknown RPC "quota", want allow, peek or batch_allow`,
+		"allow=1,allow=2":     "allow listed twice",
+		"allow:5=1":           "only batch RPCs take a size",
+		"batch_allow:0=1":     "only batch RPCs take a size",
+		"batch_allow:many=1":  "only batch RPCs take a size",
+		"allow=1,,peek=1":     "want RPC[:SIZE]=WEIGHT",
+		"allow=90,peek=eight": "want RPC[:SIZE]=WEIGHT",
+	} {
+		_, err := ParseMix(spec, mixRPCs)
+		assert.ErrorContains(t, err, msg, spec)
+	}
+}
+
+func TestMix_Pick(t *testing.T) {
+	for _, c := range []struct {
+		spec  string
+		share []float64 // by entry, in %
+	}{
+		{"allow=100", []float64{100}},
+		{"allow=90,peek=8,batch_allow=2", []float64{90, 8, 2}},
+		{"allow=1,peek=1,batch_allow=2", []float64{25, 25, 50}},
+		{"allow=0.001,peek=1000", []float64{0, 100}},
+	} {
+		t.Run(c.spec, func(t *testing.T) {
+			m, err := ParseMix(c.spec, mixRPCs)
+			require.NoError(t, err)
+			r := rand.New(rand.NewSource(1))
+
+			const picks = 100000
+			counts := make([]int, len(m.Entries))
+			for i := 0; i < picks; i++ {
+				counts[m.Pick(r)]++
+			}
+			for i, want := range c.share {
+				assert.InDelta(t, want, m.Share(i), 0.01, "entry %d's share", i)
+				assert.InDelta(t, want, float64(counts[i])/picks*100, 0.5, "entry %d's picks", i)
+			}
+		})
+	}
+}
\ No newline at end of file
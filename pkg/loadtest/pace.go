@@ -0,0 +1,110 @@
+package loadtest
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Pacer schedules one pacer's share of an open-loop run's calls at their
+// intended start times, whether or not the workers keep up, stepping
+// through the profile a call or at most a millisecond at a time.
+type Pacer struct {
+	prof       Profile
+	start, end time.Time
+	pacers     float64
+	at         time.Time // calls are scheduled up to here
+	due        float64   // calls owed, carried between steps
+	now        func() time.Time
+}
+
+// NewPacer returns pacer n of pacers sharing a run of prof from start to
+// end. The pacers start a call apart so they interleave.
+func NewPacer(prof Profile, start, end time.Time, n, pacers int) *Pacer {
+	return &Pacer{
+		prof:   prof,
+		start:  start,
+		end:    end,
+		pacers: float64(pacers),
+		at:     start,
+		due:    float64(n) / float64(pacers),
+		now:    time.Now,
+	}
+}
+
+// Schedule sends every call due by now to calls, with the time it should
+// start, catching up after a late wakeup. A call is dropped when the
+// workers' backlog is full; both are counted. It returns how long until
+// the next call is due, or false once the whole run is scheduled.
+func (p *Pacer) Schedule(calls chan<- time.Time, intended, dropped *atomic.Int64) (time.Duration, bool) {
+	now := p.now()
+	for p.at.Before(p.end) {
+		r := p.prof.Rate(p.at.Sub(p.start)) / p.pacers
+		step := time.Millisecond
+		if r > 0 {
+			step = min(step, time.Duration(float64(time.Second)/r))
+		}
+		if p.at.Add(step).After(now) {
+			return p.at.Add(step).Sub(now), true
+		}
+		p.at = p.at.Add(step)
+		for p.due += r * step.Seconds(); p.due >= 1; p.due-- {
+			intended.Add(1)
+			select {
+			case calls <- p.at:
+			default:
+				dropped.Add(1)
+			}
+		}
+	}
+	return 0, false
+}
+
+// Run schedules the calls as they come due until the run is over or ctx
+// is done.
+func (p *Pacer) Run(ctx context.Context, calls chan<- time.Time, intended, dropped *atomic.Int64) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		wait, more := p.Schedule(calls, intended, dropped)
+		if !more {
+			return
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Latencies are the latencies of calls, recorded twice: from each call's
+// actual start, and corrected for coordinated omission, from its intended
+// start, which is what a client sending at the intended rate would see
+// once the target falls behind.
+type Latencies struct {
+	Actual, Corrected *hdrhistogram.Histogram
+}
+
+// NewLatencies returns empty latencies with precision significant digits.
+func NewLatencies(precision int) *Latencies {
+	return &Latencies{Actual: NewHistogram(precision), Corrected: NewHistogram(precision)}
+}
+
+// Record records a call due to start at due that ran from start to end,
+// and returns its actual latency.
+func (l *Latencies) Record(due, start, end time.Time) time.Duration {
+	lat := end.Sub(start)
+	Record(l.Actual, lat)
+	Record(l.Corrected, end.Sub(due))
+	return lat
+}
+
+// Merge adds o's latencies to l's.
+func (l *Latencies) Merge(o *Latencies) {
+	l.Actual.Merge(o.Actual)
+	l.Corrected.Merge(o.Corrected)
+}
\ No newline at end of file
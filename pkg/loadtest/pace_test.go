@@ -0,0 +1,144 @@
+package loadtest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock tests move by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// schedule runs pacers pacers sharing prof over dur on a fake clock,
+// waking them every tick, and returns the calls they sent to a backlog of
+// size calls, which nothing drains, with how many were intended and
+// dropped.
+func schedule(t *testing.T, prof Profile, dur time.Duration, pacers int, tick time.Duration, size int) (calls []time.Time, intended, dropped int64) {
+	t.Helper()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	start := clock.Now()
+	ch := make(chan time.Time, size)
+	var in, dr atomic.Int64
+	ps := make([]*Pacer, pacers)
+	for n := range ps {
+		ps[n] = NewPacer(prof, start, start.Add(dur), n, pacers)
+		ps[n].now = clock.Now
+	}
+	for busy := true; busy; {
+		clock.Advance(tick)
+		busy = false
+		for _, p := range ps {
+			wait, more := p.Schedule(ch, &in, &dr)
+			if more {
+				require.Positive(t, wait)
+				require.LessOrEqual(t, wait, time.Millisecond)
+				busy = true
+			}
+		}
+	}
+	close(ch)
+	for at := range ch {
+		require.False(t, at.Before(start), "scheduled before the run")
+		require.False(t, at.After(start.Add(dur)), "scheduled after the run")
+		calls = append(calls, at)
+	}
+	return calls, in.Load(), dr.Load()
+}
+
+func TestPacer(t *testing.T) {
+	constant, err := ParseProfile("", 1000)
+	require.NoError(t, err)
+	ramp, err := ParseProfile("ramp:0-1000rps/10s", 0)
+	require.NoError(t, err)
+	step, err := ParseProfile("step:100-300rps/3x2s", 0)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name   string
+		prof   Profile
+		dur    time.Duration
+		pacers int
+		tick   time.Duration
+		want   int64
+	}{
+		{"constant", constant, 10 * time.Second, 1, time.Millisecond, 10000},
+		{"late wakeups", constant, 10 * time.Second, 1, time.Second, 10000},
+		{"pacers share", constant, 10 * time.Second, 4, 5 * time.Millisecond, 10000},
+		{"ramp", ramp, 10 * time.Second, 2, 10 * time.Millisecond, 5000},
+		{"step", step, 6 * time.Second, 3, time.Millisecond, 1200},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			calls, intended, dropped := schedule(t, c.prof, c.dur, c.pacers, c.tick, 20000)
+			assert.InDelta(t, c.want, intended, float64(c.pacers))
+			assert.Zero(t, dropped)
+			assert.Len(t, calls, int(intended), "every intended call went out")
+
+			// Late wakeups catch up at the calls' intended times, not all at once
+			perSecond := map[int64]int{}
+			for _, at := range calls {
+				perSecond[at.Unix()]++
+			}
+			start := time.Unix(1700000000, 0)
+			for s := time.Duration(0); s < c.dur; s += time.Second {
+				want := c.prof.Rate(s + 500*time.Millisecond)
+				assert.InDelta(t, want, perSecond[start.Add(s).Unix()], want/20+float64(c.pacers), "second %s", s)
+			}
+		})
+	}
+}
+
+func TestPacer_Dropped(t *testing.T) {
+	prof, err := ParseProfile("", 1000)
+	require.NoError(t, err)
+
+	// Workers stuck: once the backlog is full, the rest are dropped but
+	// still intended, so the achieved rate falls behind the intended one
+	calls, intended, dropped := schedule(t, prof, time.Second, 2, time.Millisecond, 100)
+	assert.Equal(t, int64(1000), intended)
+	assert.Equal(t, int64(900), dropped)
+	assert.Len(t, calls, 100)
+}
+
+func TestLatencies_CorrectsOmission(t *testing.T) {
+	prof, err := ParseProfile("", 100)
+	require.NoError(t, err)
+	due, _, _ := schedule(t, prof, 10*time.Second, 1, time.Second, 2000)
+	require.InDelta(t, 1000, len(due), 1)
+
+	// One worker, calls taking 1ms but for one that stalls for a second:
+	// the calls due meanwhile wait, which only the corrected latencies see
+	lats := NewLatencies(3)
+	var free time.Time
+	for i, at := range due {
+		start := at
+		if free.After(start) {
+			start = free
+		}
+		took := time.Millisecond
+		if i == 100 {
+			took = time.Second
+		}
+		free = start.Add(took)
+		assert.Equal(t, took, lats.Record(at, start, free))
+	}
+
+	ms := func(h *hdrhistogram.Histogram, p float64) float64 { return Percentile(h, p).Seconds() * 1000 }
+	assert.InDelta(t, 1, ms(lats.Actual, 99), 0.01, "the stall is one call")
+	assert.InDelta(t, 1000, ms(lats.Actual, 100), 1)
+	assert.Greater(t, ms(lats.Corrected, 95), 450.0, "a tenth of the calls queued behind it")
+	assert.InDelta(t, 1000, ms(lats.Corrected, 100), 1)
+
+	// Merging keeps both
+	merged := NewLatencies(3)
+	merged.Merge(lats)
+	merged.Merge(lats)
+	assert.Equal(t, 2*lats.Actual.TotalCount(), merged.Actual.TotalCount())
+	assert.Equal(t, 2*lats.Corrected.TotalCount(), merged.Corrected.TotalCount())
+}
\ No newline at end of file
@@ -0,0 +1,121 @@
+package loadtest
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile is a load shape: the target request rate over the run.
+type Profile struct {
+	spec   string
+	rate   func(elapsed time.Duration) float64
+	peak   float64
+	varies bool
+}
+
+func (p Profile) String() string {
+	return p.spec
+}
+
+// Rate returns the target rate, in calls per second, elapsed into the run.
+func (p Profile) Rate(elapsed time.Duration) float64 {
+	return p.rate(elapsed)
+}
+
+// Peak returns the highest target rate of the run.
+func (p Profile) Peak() float64 {
+	return p.peak
+}
+
+// Varies reports whether the rate changes over the run.
+func (p Profile) Varies() bool {
+	return p.varies
+}
+
+// Scaled returns the profile at share of its rate.
+func (p Profile) Scaled(share float64) Profile {
+	rate := p.rate
+	p.rate = func(elapsed time.Duration) float64 { return rate(elapsed) * share }
+	p.peak *= share
+	return p
+}
+
+// ParseProfile parses a -profile spec, or returns a constant rps when it's
+// empty.
+func ParseProfile(spec string, rps float64) (Profile, error) {
+	if spec == "" {
+		return Profile{
+			spec: fmt.Sprintf("%.0f", rps),
+			rate: func(time.Duration) float64 { return rps },
+			peak: rps,
+		}, nil
+	}
+	bad := func(format string) (Profile, error) {
+		return Profile{}, fmt.Errorf("invalid -profile %q, want %s", spec, format)
+	}
+
+	kind, rest, _ := strings.Cut(spec, ":")
+	rates, rest, _ := strings.Cut(rest, "/")
+	lo, hi, ok := parseRates(rates)
+	args := strings.Split(rest, "/")
+	p := Profile{spec: spec, peak: math.Max(lo, hi), varies: true}
+	switch kind {
+	case "ramp":
+		d, err := time.ParseDuration(rest)
+		if !ok || err != nil || d <= 0 {
+			return bad("ramp:FROM-TOrps/DURATION")
+		}
+		p.rate = func(t time.Duration) float64 {
+			return lo + (hi-lo)*math.Min(t.Seconds()/d.Seconds(), 1)
+		}
+	case "step":
+		n, each, _ := strings.Cut(rest, "x")
+		steps, err1 := strconv.Atoi(n)
+		d, err2 := time.ParseDuration(each)
+		if !ok || err1 != nil || err2 != nil || steps < 2 || d <= 0 {
+			return bad("step:FROM-TOrps/STEPSxDURATION with at least 2 steps")
+		}
+		p.rate = func(t time.Duration) float64 {
+			i := math.Min(float64(t/d), float64(steps-1))
+			return lo + (hi-lo)*i/float64(steps-1)
+		}
+	case "spike":
+		if len(args) != 2 {
+			return bad("spike:BASE-PEAKrps/EVERY/FOR")
+		}
+		every, err1 := time.ParseDuration(args[0])
+		length, err2 := time.ParseDuration(args[1])
+		if !ok || err1 != nil || err2 != nil || every <= 0 || length <= 0 || length >= every {
+			return bad("spike:BASE-PEAKrps/EVERY/FOR with FOR shorter than EVERY")
+		}
+		// Spikes come at the end of each period, after a stretch of base load.
+		p.rate = func(t time.Duration) float64 {
+			if t%every >= every-length {
+				return hi
+			}
+			return lo
+		}
+	case "sine":
+		period, err := time.ParseDuration(rest)
+		if !ok || err != nil || period <= 0 {
+			return bad("sine:MIN-MAXrps/PERIOD")
+		}
+		p.rate = func(t time.Duration) float64 {
+			return lo + (hi-lo)*(1-math.Cos(2*math.Pi*t.Seconds()/period.Seconds()))/2
+		}
+	default:
+		return bad("ramp, step, spike or sine")
+	}
+	return p, nil
+}
+
+// parseRates parses "FROM-TOrps".
+func parseRates(s string) (from, to float64, ok bool) {
+	a, b, found := strings.Cut(strings.TrimSuffix(s, "rps"), "-")
+	from, err1 := strconv.ParseFloat(a, 64)
+	to, err2 := strconv.ParseFloat(b, 64)
+	return from, to, found && err1 == nil && err2 == nil && from >= 0 && to >= 0 && (from > 0 || to > 0)
+}
\ No newline at end of file
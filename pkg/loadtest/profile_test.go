@@ -0,0 +1,84 @@
+package loadtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile_Rate(t *testing.T) {
+	for _, c := range []struct {
+		spec string
+		at   time.Duration
+		want float64
+	}{
+		{"", 0, 500},
+		{"", time.Hour, 500},
+		{"ramp:0-1000rps/10s", 0, 0},
+		{"ramp:0-1000rps/10s", 5 * time.Second, 500},
+		{"ramp:0-1000rps/10s", 10 * time.Second, 1000},
+		{"ramp:0-1000rps/10s", time.Minute, 1000},
+		{"ramp:1000-0rps/10s", 2 * time.Second, 800},
+		{"step:1000-4000rps/4x10s", 0, 1000},
+		{"step:1000-4000rps/4x10s", 9 * time.Second, 1000},
+		{"step:1000-4000rps/4x10s", 10 * time.Second, 2000},
+		{"step:1000-4000rps/4x10s", 35 * time.Second, 4000},
+		{"step:1000-4000rps/4x10s", time.Minute, 4000},
+		{"spike:100-900rps/1m/5s", 0, 100},
+		{"spike:100-900rps/1m/5s", 54 * time.Second, 100},
+		{"spike:100-900rps/1m/5s", 55 * time.Second, 900},
+		{"spike:100-900rps/1m/5s", 61 * time.Second, 100},
+		{"spike:100-900rps/1m/5s", 119 * time.Second, 900},
+		{"sine:1000-5000rps/1m", 0, 1000},
+		{"sine:1000-5000rps/1m", 15 * time.Second, 3000},
+		{"sine:1000-5000rps/1m", 30 * time.Second, 5000},
+		{"sine:1000-5000rps/1m", time.Minute, 1000},
+	} {
+		p, err := ParseProfile(c.spec, 500)
+		require.NoError(t, err, c.spec)
+		assert.InDelta(t, c.want, p.Rate(c.at), 1e-6, "%q at %s", c.spec, c.at)
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	for _, c := range []struct {
+		spec   string
+		peak   float64
+		varies bool
+	}{
+		{"", 500, false},
+		{"ramp:0-1000rps/10s", 1000, true},
+		{"ramp:1000-0rps/10s", 1000, true},
+		{"step:1000-4000rps/4x10s", 4000, true},
+		{"spike:100-900rps/1m/5s", 900, true},
+		{"sine:1000-5000rps/1m", 5000, true},
+	} {
+		p, err := ParseProfile(c.spec, 500)
+		require.NoError(t, err, c.spec)
+		assert.Equal(t, c.peak, p.Peak(), c.spec)
+		assert.Equal(t, c.varies, p.Varies(), c.spec)
+
+		// Agents run a share of the profile
+		half := p.Scaled(0.5)
+		assert.Equal(t, c.peak/2, half.Peak(), c.spec)
+		assert.InDelta(t, p.Rate(7*time.Second)/2, half.Rate(7*time.Second), 1e-6, c.spec)
+	}
+
+	for _, spec := range []string{
+		"ramp",
+		"ramp:0-0rps/10s",
+		"ramp:-5-10rps/10s",
+		"ramp:0-1000rps/0s",
+		"step:1000-4000rps/1x10s",
+		"step:1000-4000rps/10s",
+		"spike:100-900rps/1m",
+		"spike:100-900rps/5s/1m",
+		"sine:1000-5000rps",
+		"square:1000-5000rps/1m",
+	} {
+		_, err := ParseProfile(spec, 500)
+		assert.Error(t, err, spec)
+	}
+}
\ No newline at end of file
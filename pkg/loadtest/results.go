@@ -0,0 +1,145 @@
+// Package loadtest holds the parts of the load tester (scripts/loadtest.go)
+// that work without a target: drawing keys, shaping and pacing the load,
+// mixing RPCs, recording latencies, splitting a run between agents, merging
+// their results, and checking a run against a baseline.
+package loadtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// ErrOtherRun is returned by Merge for results of a run with other
+// settings.
+var ErrOtherRun = errors.New("results of a different run")
+
+// Results are a run's raw counts and latencies, which its report is built
+// from. Agents send theirs to the coordinator, which merges them.
+type Results struct {
+	Started                                              time.Time
+	Requests, Intended, Dropped, Allowed, Denied, Errors int64
+	ErrorCodes                                           []int64 // by gRPC code
+	Latencies, Corrected                                 Histogram
+	RPCs                                                 []RPCResults // by -mix entry
+	Prefixes                                             []Histogram  // latencies, by -prefixes entry
+	KeyOffset                                            int
+	KeyHits                                              []int64       // by key number, from KeyOffset
+	Keys                                                 [][]KeyCounts // by prefix, then key number from KeyOffset
+	Curve                                                []CurveResults
+}
+
+// Merge adds an agent's results to r, whose keys must include a's.
+func (r *Results) Merge(a *Results) error {
+	off := a.KeyOffset - r.KeyOffset
+	switch {
+	case len(a.RPCs) != len(r.RPCs) || len(a.Prefixes) != len(r.Prefixes) || len(a.Keys) != len(r.Keys) || len(a.Curve) != len(r.Curve):
+		return ErrOtherRun
+	case off < 0 || off+len(a.KeyHits) > len(r.KeyHits):
+		return fmt.Errorf("keys %d to %d out of range", a.KeyOffset, a.KeyOffset+len(a.KeyHits)-1)
+	}
+	for i := range a.Keys {
+		if len(a.Keys[i]) != len(a.KeyHits) {
+			return ErrOtherRun
+		}
+	}
+
+	if r.Started.IsZero() || a.Started.Before(r.Started) {
+		r.Started = a.Started
+	}
+	r.Requests += a.Requests
+	r.Intended += a.Intended
+	r.Dropped += a.Dropped
+	r.Allowed += a.Allowed
+	r.Denied += a.Denied
+	r.Errors += a.Errors
+	for c := range a.ErrorCodes[:min(len(a.ErrorCodes), len(r.ErrorCodes))] {
+		r.ErrorCodes[c] += a.ErrorCodes[c]
+	}
+	r.Latencies.Merge(a.Latencies.Histogram)
+	r.Corrected.Merge(a.Corrected.Histogram)
+	for i := range a.RPCs {
+		r.RPCs[i].Add(a.RPCs[i])
+	}
+	for i := range a.Prefixes {
+		r.Prefixes[i].Merge(a.Prefixes[i].Histogram)
+	}
+	for k, n := range a.KeyHits {
+		r.KeyHits[off+k] += n
+	}
+	for i := range a.Keys {
+		for k, c := range a.Keys[i] {
+			r.Keys[i][off+k].Add(c)
+		}
+	}
+	for i := range a.Curve {
+		r.Curve[i].Latencies.Merge(a.Curve[i].Latencies.Histogram)
+		r.Curve[i].Errors += a.Curve[i].Errors
+	}
+	return nil
+}
+
+// Histogram is an HDR histogram that travels as JSON in its compressed
+// encoding.
+type Histogram struct {
+	*hdrhistogram.Histogram
+}
+
+func (h Histogram) MarshalJSON() ([]byte, error) {
+	b, err := h.Encode(hdrhistogram.V2CompressedEncodingCookieBase)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(b))
+}
+
+func (h *Histogram) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	var err error
+	h.Histogram, err = hdrhistogram.Decode([]byte(s))
+	return err
+}
+
+// RPCResults are the results of one RPC of the mix.
+type RPCResults struct {
+	Calls, Errors, Allowed, Denied, ItemErrors int64
+	Latencies                                  Histogram
+}
+
+func (r *RPCResults) Add(o RPCResults) {
+	r.Calls += o.Calls
+	r.Errors += o.Errors
+	r.Allowed += o.Allowed
+	r.Denied += o.Denied
+	r.ItemErrors += o.ItemErrors
+	r.Latencies.Merge(o.Latencies.Histogram)
+}
+
+// KeyCounts are the results of one key. Short names keep an agent's
+// results small; most keys have none.
+type KeyCounts struct {
+	Requests int64 `json:"n,omitempty"`
+	Allowed  int64 `json:"a,omitempty"`
+	Denied   int64 `json:"d,omitempty"`
+	Errors   int64 `json:"e,omitempty"`
+}
+
+func (c *KeyCounts) Add(o KeyCounts) {
+	c.Requests += o.Requests
+	c.Allowed += o.Allowed
+	c.Denied += o.Denied
+	c.Errors += o.Errors
+}
+
+// CurveResults are the latencies and errors of one interval of a run with
+// a varying rate.
+type CurveResults struct {
+	Latencies Histogram
+	Errors    int64
+}
\ No newline at end of file
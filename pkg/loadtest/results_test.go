@@ -0,0 +1,110 @@
+package loadtest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func histogramOf(values ...int64) Histogram {
+	h := hdrhistogram.New(1, time.Minute.Microseconds(), 3)
+	for _, v := range values {
+		h.RecordValue(v)
+	}
+	return Histogram{Histogram: h}
+}
+
+// agentResults returns the results of an agent holding keys keys from
+// offset, each hit once and taking lat.
+func agentResults(started time.Time, offset, keys int, lat int64) *Results {
+	r := &Results{
+		Started:    started,
+		Requests:   int64(keys),
+		Allowed:    int64(keys),
+		ErrorCodes: make([]int64, 3),
+		Latencies:  histogramOf(),
+		Corrected:  histogramOf(),
+		RPCs:       []RPCResults{{Calls: int64(keys), Latencies: histogramOf()}},
+		Prefixes:   []Histogram{histogramOf()},
+		KeyOffset:  offset,
+		KeyHits:    make([]int64, keys),
+		Keys:       [][]KeyCounts{make([]KeyCounts, keys)},
+	}
+	for k := 0; k < keys; k++ {
+		r.Latencies.RecordValue(lat)
+		r.Corrected.RecordValue(lat)
+		r.RPCs[0].Latencies.RecordValue(lat)
+		r.Prefixes[0].RecordValue(lat)
+		r.KeyHits[k] = 1
+		r.Keys[0][k] = KeyCounts{Requests: 1, Allowed: 1}
+	}
+	return r
+}
+
+func TestMerge(t *testing.T) {
+	start := time.Now()
+	merged := &Results{
+		ErrorCodes: make([]int64, 3),
+		Latencies:  histogramOf(),
+		Corrected:  histogramOf(),
+		RPCs:       []RPCResults{{Latencies: histogramOf()}},
+		Prefixes:   []Histogram{histogramOf()},
+		KeyHits:    make([]int64, 5),
+		Keys:       [][]KeyCounts{make([]KeyCounts, 5)},
+	}
+
+	a := agentResults(start.Add(time.Second), 0, 2, 100)
+	a.Errors, a.ErrorCodes[2] = 1, 1
+	b := agentResults(start, 2, 3, 1000)
+	require.NoError(t, merged.Merge(a))
+	require.NoError(t, merged.Merge(b))
+
+	assert.Equal(t, start, merged.Started, "the earliest start")
+	assert.Equal(t, int64(5), merged.Requests)
+	assert.Equal(t, int64(1), merged.Errors)
+	assert.Equal(t, []int64{0, 0, 1}, merged.ErrorCodes)
+	assert.Equal(t, []int64{1, 1, 1, 1, 1}, merged.KeyHits)
+	assert.Equal(t, KeyCounts{Requests: 1, Allowed: 1}, merged.Keys[0][4])
+	assert.Equal(t, int64(5), merged.RPCs[0].Calls)
+
+	// Histograms add up the agents' samples
+	for _, h := range []Histogram{merged.Latencies, merged.Corrected, merged.RPCs[0].Latencies, merged.Prefixes[0]} {
+		assert.Equal(t, int64(5), h.TotalCount())
+		assert.Equal(t, int64(100), h.Min())
+		assert.InDelta(t, 1000, h.Max(), 1)
+		assert.InDelta(t, 1000, h.ValueAtQuantile(50), 1)
+	}
+}
+
+func TestMerge_Mismatch(t *testing.T) {
+	merged := agentResults(time.Now(), 10, 5, 100)
+
+	err := merged.Merge(agentResults(time.Now(), 13, 3, 100))
+	assert.ErrorContains(t, err, "keys 13 to 15 out of range")
+	err = merged.Merge(agentResults(time.Now(), 9, 2, 100))
+	assert.ErrorContains(t, err, "out of range")
+
+	other := agentResults(time.Now(), 10, 2, 100)
+	other.RPCs = append(other.RPCs, RPCResults{Latencies: histogramOf()})
+	assert.ErrorIs(t, merged.Merge(other), ErrOtherRun)
+	other = agentResults(time.Now(), 10, 2, 100)
+	other.Keys[0] = other.Keys[0][:1]
+	assert.ErrorIs(t, merged.Merge(other), ErrOtherRun)
+
+	assert.Equal(t, int64(5), merged.Requests, "failed merges change nothing")
+}
+
+func TestHistogram_JSON(t *testing.T) {
+	h := histogramOf(100, 200, 5000)
+	b, err := json.Marshal(CurveResults{Latencies: h, Errors: 2})
+	require.NoError(t, err)
+
+	var got CurveResults
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, int64(2), got.Errors)
+	assert.True(t, h.Equals(got.Latencies.Histogram))
+}
\ No newline at end of file
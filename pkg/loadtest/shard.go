@@ -0,0 +1,9 @@
+package loadtest
+
+// Shard returns agent i of n's slice of a keyspace of keys keys: the
+// number of its first key and how many it has. Slices are contiguous,
+// cover every key once, and differ by at most one key.
+func Shard(keys, i, n int) (offset, count int) {
+	offset = keys * i / n
+	return offset, keys*(i+1)/n - offset
+}
\ No newline at end of file
@@ -0,0 +1,34 @@
+package loadtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShard(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		keys, n int
+		want    [][2]int // offset and count, by agent
+	}{
+		{"single agent", 10, 1, [][2]int{{0, 10}}},
+		{"even split", 10, 2, [][2]int{{0, 5}, {5, 5}}},
+		{"remainder spread", 10, 3, [][2]int{{0, 3}, {3, 3}, {6, 4}}},
+		{"remainders", 11, 4, [][2]int{{0, 2}, {2, 3}, {5, 3}, {8, 3}}},
+		{"one key each", 3, 3, [][2]int{{0, 1}, {1, 1}, {2, 1}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var got [][2]int
+			next := 0
+			for i := 0; i < c.n; i++ {
+				off, count := Shard(c.keys, i, c.n)
+				got = append(got, [2]int{off, count})
+				assert.Equal(t, next, off, "shards are contiguous")
+				next = off + count
+			}
+			assert.Equal(t, c.want, got)
+			assert.Equal(t, c.keys, next, "every key is covered")
+		})
+	}
+}
\ No newline at end of file
@@ -0,0 +1,115 @@
+// Package loglevel holds the server's log level, which can be raised at
+// runtime for debugging in production and reverts on its own.
+package loglevel
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Level is how much the server logs, each level including the ones
+// before it.
+type Level int32
+
+const (
+	// Error logs failures only.
+	Error Level = iota
+	// Info adds slow requests and background work.
+	Info
+	// Debug adds every request with its response.
+	Debug
+)
+
+var names = [...]string{Error: "error", Info: "info", Debug: "debug"}
+
+func (l Level) String() string {
+	if l < Error || l > Debug {
+		return fmt.Sprintf("Level(%d)", int32(l))
+	}
+	return names[l]
+}
+
+// Parse returns the Level named s, case-insensitively.
+func Parse(s string) (Level, error) {
+	for l, name := range names {
+		if strings.EqualFold(s, name) {
+			return Level(l), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q (want error, info or debug)", s)
+}
+
+// Control is the log level of this process. A nil Control is at Info.
+type Control struct {
+	base  Level
+	level atomic.Int32
+
+	mu       sync.Mutex
+	revert   *time.Timer
+	revertAt time.Time
+}
+
+// New creates a Control at base, the level changes revert to.
+func New(base Level) *Control {
+	c := &Control{base: base}
+	c.level.Store(int32(base))
+	return c
+}
+
+// Level returns the current level.
+func (c *Control) Level() Level {
+	if c == nil {
+		return Info
+	}
+	return Level(c.level.Load())
+}
+
+// Enabled reports whether messages at l are logged.
+func (c *Control) Enabled(l Level) bool {
+	return l <= c.Level()
+}
+
+// Set changes the level to l, reverting to the base level after d (never
+// when d is 0). It replaces any pending revert, and returns when the
+// level reverts (zero when it doesn't).
+func (c *Control) Set(l Level, d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revert != nil {
+		c.revert.Stop()
+		c.revert = nil
+	}
+	c.revertAt = time.Time{}
+	c.level.Store(int32(l))
+	if d > 0 && l != c.base {
+		c.revertAt = time.Now().Add(d)
+		var t *time.Timer
+		t = time.AfterFunc(d, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.revert != t {
+				return // replaced by a later Set
+			}
+			c.level.Store(int32(c.base))
+			c.revert, c.revertAt = nil, time.Time{}
+			log.Printf("log level reverted to %s", c.base)
+		})
+		c.revert = t
+	}
+	return c.revertAt
+}
+
+// State returns the current level and when it reverts to the base level
+// (zero when it doesn't).
+func (c *Control) State() (Level, time.Time) {
+	if c == nil {
+		return Info, time.Time{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Level(), c.revertAt
+}
\ No newline at end of file
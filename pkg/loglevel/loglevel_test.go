@@ -0,0 +1,41 @@
+package loglevel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	l, err := Parse("DEBUG")
+	require.NoError(t, err)
+	assert.Equal(t, Debug, l)
+	_, err = Parse("trace")
+	assert.Error(t, err)
+	assert.Equal(t, "info", Info.String())
+}
+
+func TestSetReverts(t *testing.T) {
+	c := New(Info)
+	assert.True(t, c.Enabled(Info))
+	assert.False(t, c.Enabled(Debug))
+
+	at := c.Set(Debug, 20*time.Millisecond)
+	assert.False(t, at.IsZero())
+	assert.True(t, c.Enabled(Debug))
+	assert.Eventually(t, func() bool { return c.Level() == Info }, time.Second, 5*time.Millisecond)
+	_, at = c.State()
+	assert.True(t, at.IsZero())
+
+	// A later Set cancels the pending revert
+	c.Set(Debug, 20*time.Millisecond)
+	assert.True(t, c.Set(Error, 0).IsZero())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, Error, c.Level())
+
+	var nilControl *Control
+	assert.True(t, nilControl.Enabled(Info))
+	assert.False(t, nilControl.Enabled(Debug))
+}
\ No newline at end of file
@@ -0,0 +1,126 @@
+// Package maintenance holds the server's maintenance mode, in which every
+// Allow is admitted while the limiter's decisions are only recorded, e.g.
+// while the Redis backend is migrated.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// redisKey holds the State while maintenance mode is on.
+const redisKey = "ratelimiter:maintenance"
+
+// State describes maintenance mode while it's on.
+type State struct {
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// Mode stores maintenance mode in Redis, so it holds across restarts and
+// replicas, and serves it from an in-process copy. A nil Mode is off.
+type Mode struct {
+	rdb   *redis.Client
+	state atomic.Pointer[State] // nil when off
+}
+
+// New creates a Mode that is off. Call Refresh to load the stored state.
+func New(rdb *redis.Client) *Mode {
+	return &Mode{rdb: rdb}
+}
+
+// On reports whether maintenance mode is on.
+func (m *Mode) On() bool {
+	return m != nil && m.state.Load() != nil
+}
+
+// State returns the state of maintenance mode, nil when it's off.
+func (m *Mode) State() *State {
+	if m == nil {
+		return nil
+	}
+	return m.state.Load()
+}
+
+// Enable turns maintenance mode on, or updates its reason.
+func (m *Mode) Enable(ctx context.Context, reason string) (*State, error) {
+	st := &State{Reason: reason, Since: time.Now()}
+	if cur := m.state.Load(); cur != nil {
+		st.Since = cur.Since
+	}
+	v, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.rdb.Set(ctx, redisKey, v, 0).Err(); err != nil {
+		return nil, fmt.Errorf("redis set: %w", err)
+	}
+	m.set(st)
+	return st, nil
+}
+
+// Disable turns maintenance mode off.
+func (m *Mode) Disable(ctx context.Context) error {
+	if err := m.rdb.Del(ctx, redisKey).Err(); err != nil {
+		return fmt.Errorf("redis del: %w", err)
+	}
+	m.set(nil)
+	return nil
+}
+
+// Refresh reloads the state from Redis.
+func (m *Mode) Refresh(ctx context.Context) error {
+	v, err := m.rdb.Get(ctx, redisKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		m.set(nil)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("redis get: %w", err)
+	}
+	st := &State{}
+	if err := json.Unmarshal(v, st); err != nil {
+		return fmt.Errorf("malformed maintenance state: %w", err)
+	}
+	m.set(st)
+	return nil
+}
+
+func (m *Mode) set(st *State) {
+	old := m.state.Swap(st)
+	switch {
+	case st != nil && old == nil:
+		log.Printf("WARNING: maintenance mode on (%s): rate limits are not enforced", st.Reason)
+		metrics.MaintenanceMode.Set(1)
+	case st == nil && old != nil:
+		log.Printf("maintenance mode off: rate limits are enforced again")
+		metrics.MaintenanceMode.Set(0)
+	}
+}
+
+// Run refreshes the state every interval until ctx is cancelled. The last
+// known state holds while Redis is unreachable, as it may be during a
+// migration.
+func (m *Mode) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := m.Refresh(ctx); err != nil {
+				log.Printf("maintenance mode refresh failed: %v", err)
+			}
+		}
+	}
+}
\ No newline at end of file
@@ -0,0 +1,52 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMode(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	var none *Mode
+	assert.False(t, none.On())
+	assert.Nil(t, none.State())
+
+	m := New(rdb)
+	require.NoError(t, m.Refresh(ctx))
+	assert.False(t, m.On())
+
+	st, err := m.Enable(ctx, "redis migration")
+	require.NoError(t, err)
+	assert.True(t, m.On())
+	updated, err := m.Enable(ctx, "redis migration, step 2")
+	require.NoError(t, err)
+	assert.Equal(t, "redis migration, step 2", updated.Reason)
+	assert.Equal(t, st.Since, updated.Since, "updating the reason keeps the start time")
+
+	// Another replica, or this one after a restart
+	other := New(rdb)
+	require.NoError(t, other.Refresh(ctx))
+	require.True(t, other.On())
+	assert.Equal(t, "redis migration, step 2", other.State().Reason)
+	assert.True(t, st.Since.Equal(other.State().Since))
+
+	// Redis unreachable: the refresh fails, the caller keeps the last state
+	mr.Close()
+	require.Error(t, other.Refresh(ctx))
+	assert.True(t, other.On())
+	mr.Restart()
+
+	require.NoError(t, m.Disable(ctx))
+	assert.False(t, m.On())
+	require.NoError(t, other.Refresh(ctx))
+	assert.False(t, other.On())
+}
\ No newline at end of file
@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPending bounds the observations a shard buffers between flushes; a
+// full shard is flushed by the caller that filled it.
+const maxPending = 4096
+
+type observation struct {
+	to prometheus.Observer
+	v  float64
+}
+
+// batchShard is padded to its own cache lines so shards don't contend. Its
+// two buffers are swapped on flush, so steady state doesn't allocate.
+type batchShard struct {
+	mu      sync.Mutex
+	pending []observation
+	spare   []observation
+	_       [64]byte
+}
+
+// Batcher buffers histogram observations in shards and replays them into
+// Prometheus periodically, so hot paths on many cores don't all write to
+// the same histogram counters. It costs more CPU in total, so it only pays
+// off when those writes contend; compare with BenchmarkObserve.
+type Batcher struct {
+	shards []batchShard
+}
+
+// batcher is the Batcher used by Batched observers, nil when batching is off.
+var batcher atomic.Pointer[Batcher]
+
+// EnableBatching makes observers returned by Batched buffer observations
+// in the given number of shards until the returned Batcher is flushed.
+func EnableBatching(shards int) *Batcher {
+	b := &Batcher{shards: make([]batchShard, shards)}
+	for i := range b.shards {
+		b.shards[i].pending = make([]observation, 0, maxPending)
+		b.shards[i].spare = make([]observation, 0, maxPending)
+	}
+	batcher.Store(b)
+	return b
+}
+
+type batchedObserver struct {
+	to prometheus.Observer
+}
+
+// Batched wraps o to go through the Batcher once batching is enabled, and
+// straight to o otherwise.
+func Batched(o prometheus.Observer) prometheus.Observer {
+	return batchedObserver{to: o}
+}
+
+func (o batchedObserver) Observe(v float64) {
+	if b := batcher.Load(); b != nil {
+		b.add(o.to, v)
+		return
+	}
+	o.to.Observe(v)
+}
+
+func (b *Batcher) add(to prometheus.Observer, v float64) {
+	s := &b.shards[rand.N(len(b.shards))]
+	s.mu.Lock()
+	s.pending = append(s.pending, observation{to: to, v: v})
+	full := len(s.pending) >= maxPending
+	s.mu.Unlock()
+	if full {
+		s.flush()
+	}
+}
+
+// Flush replays every buffered observation.
+func (b *Batcher) Flush() {
+	for i := range b.shards {
+		b.shards[i].flush()
+	}
+}
+
+func (s *batchShard) flush() {
+	s.mu.Lock()
+	pending := s.pending
+	if len(pending) == 0 || s.spare == nil {
+		// Empty, or another flush of this shard is replaying.
+		s.mu.Unlock()
+		return
+	}
+	s.pending, s.spare = s.spare, nil
+	s.mu.Unlock()
+
+	for i, o := range pending {
+		o.to.Observe(o.v)
+		pending[i] = observation{}
+	}
+
+	s.mu.Lock()
+	s.spare = pending[:0]
+	s.mu.Unlock()
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more.
+func (b *Batcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			b.Flush()
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
\ No newline at end of file
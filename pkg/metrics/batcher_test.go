@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingObserver struct{ n atomic.Int64 }
+
+func (o *countingObserver) Observe(float64) { o.n.Add(1) }
+
+func TestBatcher(t *testing.T) {
+	c := &countingObserver{}
+	o := Batched(c)
+
+	o.Observe(1)
+	assert.Equal(t, int64(1), c.n.Load(), "observes directly until batching is enabled")
+
+	b := EnableBatching(4)
+	defer batcher.Store(nil)
+	for i := 0; i < 10; i++ {
+		o.Observe(0.5)
+	}
+	assert.Equal(t, int64(1), c.n.Load())
+	b.Flush()
+	assert.Equal(t, int64(11), c.n.Load())
+
+	// A full shard flushes itself.
+	for i := 0; i < 4*maxPending; i++ {
+		o.Observe(0.5)
+	}
+	assert.Greater(t, c.n.Load(), int64(11))
+}
+
+// BenchmarkObserve compares observing a shared histogram directly with
+// going through the Batcher, across concurrent callers.
+func BenchmarkObserve(b *testing.B) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "batcher_bench_seconds"})
+	o := Batched(h)
+
+	b.Run("direct", func(b *testing.B) {
+		b.RunParallel(func(p *testing.PB) {
+			for p.Next() {
+				h.Observe(0.001)
+			}
+		})
+	})
+	b.Run("batched", func(b *testing.B) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		defer batcher.Store(nil)
+		go EnableBatching(64).Run(ctx, 10*time.Millisecond)
+
+		b.RunParallel(func(p *testing.PB) {
+			for p.Next() {
+				o.Observe(0.001)
+			}
+		})
+	})
+}
\ No newline at end of file
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// decisionSeries caches one key prefix's children of RequestsTotal and
+// TokensRemaining. The remaining tokens are held here and copied to the
+// gauge by FlushGauges.
+type decisionSeries struct {
+	allowed   prometheus.Counter
+	denied    prometheus.Counter
+	gauge     prometheus.Gauge
+	remaining atomic.Int64
+	dirty     atomic.Bool
+}
+
+// decisions maps key prefixes to their series. The map is copied on write,
+// so the hot path reads it without a lock and without hashing label values.
+var (
+	decisions   atomic.Pointer[map[string]*decisionSeries]
+	decisionsMu sync.Mutex
+)
+
+// RecordDecision counts an Allow decision for prefix (see KeyPrefix) and
+// samples the remaining tokens for the next FlushGauges.
+func RecordDecision(prefix string, allowed bool, remaining int64) {
+	s := decisionSeriesFor(prefix)
+	if allowed {
+		s.allowed.Inc()
+	} else {
+		s.denied.Inc()
+	}
+	s.remaining.Store(remaining)
+	if !s.dirty.Load() {
+		s.dirty.Store(true)
+	}
+}
+
+func decisionSeriesFor(prefix string) *decisionSeries {
+	if m := decisions.Load(); m != nil {
+		if s, ok := (*m)[prefix]; ok {
+			return s
+		}
+	}
+
+	decisionsMu.Lock()
+	defer decisionsMu.Unlock()
+	old := decisions.Load()
+	if old != nil {
+		if s, ok := (*old)[prefix]; ok {
+			return s
+		}
+	}
+	m := make(map[string]*decisionSeries, 1)
+	if old != nil {
+		for k, v := range *old {
+			m[k] = v
+		}
+	}
+	// prefix usually points into a request's key; don't keep that alive.
+	prefix = string([]byte(prefix))
+	s := &decisionSeries{
+		allowed: RequestsTotal.WithLabelValues(prefix, "allowed"),
+		denied:  RequestsTotal.WithLabelValues(prefix, "denied"),
+		gauge:   TokensRemaining.WithLabelValues(prefix),
+	}
+	m[prefix] = s
+	decisions.Store(&m)
+	return s
+}
+
+// FlushGauges copies the remaining tokens last recorded per prefix to
+// TokensRemaining.
+func FlushGauges() {
+	m := decisions.Load()
+	if m == nil {
+		return
+	}
+	for _, s := range *m {
+		if s.dirty.Swap(false) {
+			s.gauge.Set(float64(s.remaining.Load()))
+		}
+	}
+}
+
+// RunGaugeFlusher calls FlushGauges every interval until ctx is cancelled.
+func RunGaugeFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			FlushGauges()
+			return
+		case <-ticker.C:
+			FlushGauges()
+		}
+	}
+}
\ No newline at end of file
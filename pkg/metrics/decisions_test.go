@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordDecision(t *testing.T) {
+	RecordDecision(KeyPrefix("dectest:1"), true, 9)
+	RecordDecision(KeyPrefix("dectest:2"), true, 8)
+	RecordDecision(KeyPrefix("dectest:1"), false, 3)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(RequestsTotal.WithLabelValues("dectest", "allowed")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(RequestsTotal.WithLabelValues("dectest", "denied")))
+
+	// The gauge is only written on flush, with the last sample.
+	assert.Equal(t, 0.0, testutil.ToFloat64(TokensRemaining.WithLabelValues("dectest")))
+	FlushGauges()
+	assert.Equal(t, 3.0, testutil.ToFloat64(TokensRemaining.WithLabelValues("dectest")))
+}
+
+// BenchmarkRecordDecision compares looking up label children per call, as
+// Allow used to, with the cached series, across concurrent callers.
+func BenchmarkRecordDecision(b *testing.B) {
+	keys := []string{"user:1", "ip:10.0.0.1", "api:search", "user:2"}
+
+	b.Run("labels", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(p *testing.PB) {
+			i := 0
+			for p.Next() {
+				prefix := KeyPrefix(keys[i%len(keys)])
+				RequestsTotal.WithLabelValues(prefix, "allowed").Inc()
+				TokensRemaining.WithLabelValues(prefix).Set(float64(i))
+				i++
+			}
+		})
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(p *testing.PB) {
+			i := 0
+			for p.Next() {
+				RecordDecision(KeyPrefix(keys[i%len(keys)]), true, int64(i))
+				i++
+			}
+		})
+	})
+}
\ No newline at end of file
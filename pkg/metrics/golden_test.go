@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// exported lists every metric the server exposes. Renaming one, or
+// changing its labels or buckets, breaks dashboards and alerts, so the
+// exposition is checked against testdata/metrics.golden.
+var exported = map[string]prometheus.Collector{
+	"RequestsTotal":     RequestsTotal,
+	"RequestDuration":   RequestDuration,
+	"RedisLatency":      RedisLatency,
+	"RedisErrors":       RedisErrors,
+	"RedisPoolSize":     RedisPoolSize,
+	"TokensRemaining":   TokensRemaining,
+	"ActiveConnections": ActiveConnections,
+	"InternalErrors":    InternalErrors,
+	"OverridesAdjusted": OverridesAdjusted,
+	"AuthFailures":      AuthFailures,
+	"APIQuotaDenied":    APIQuotaDenied,
+	"PeeksDeduplicated": PeeksDeduplicated,
+	"LeasedDecisions":   LeasedDecisions,
+	"BudgetFallbacks":   BudgetFallbacks,
+	"BudgetReconciled":  BudgetReconciled,
+	"RuntimeSetting":    RuntimeSetting,
+	"SchedulerQueued":   SchedulerQueued,
+	"SchedulerWait":     SchedulerWait,
+	"ChaosInjected":     ChaosInjected,
+	"MaintenanceMode":   MaintenanceMode,
+	"ShadowDecisions":   ShadowDecisions,
+	"AlertsSent":        AlertsSent,
+	"HistoryWrites":     HistoryWrites,
+	"SoftLimitWarnings": SoftLimitWarnings,
+	"AnomalyThrottles":  AnomalyThrottles,
+	"GreylistedKeys":    GreylistedKeys,
+	"GlobalRegions":     GlobalRegions,
+	"GlobalSyncErrors":  GlobalSyncErrors,
+	"RedisKeys":         RedisKeys,
+	"RedisMemory":       RedisMemory,
+	"GuardEvictions":    GuardEvictions,
+	"CleanupScanned":    CleanupScanned,
+	"CleanupDeleted":    CleanupDeleted,
+	"CleanupLastPass":   CleanupLastPass,
+}
+
+// TestExported checks that exported covers every metric registered in
+// prometheus.go.
+func TestExported(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "prometheus.go", nil, 0)
+	require.NoError(t, err)
+
+	var registered []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok || len(spec.Values) != 1 {
+			return true
+		}
+		if call, ok := spec.Values[0].(*ast.CallExpr); ok {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+				if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "promauto" {
+					registered = append(registered, spec.Names[0].Name)
+				}
+			}
+		}
+		return true
+	})
+
+	var listed []string
+	for name := range exported {
+		listed = append(listed, name)
+	}
+	sort.Strings(registered)
+	sort.Strings(listed)
+	assert.Equal(t, registered, listed, "add new metrics to exported and run go test -update")
+}
+
+var variableLabels = regexp.MustCompile(`variableLabels: \{([^}]*)\}`)
+
+// TestExposition_Golden checks the name, type, label names and buckets of
+// every metric family.
+func TestExposition_Golden(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	for _, c := range exported {
+		require.NoError(t, reg.Register(c))
+		// Vectors only show up once they have a series.
+		if labels := labelCount(t, c); labels > 0 {
+			values := make([]string, labels)
+			for i := range values {
+				values[i] = "golden"
+			}
+			switch v := c.(type) {
+			case *prometheus.CounterVec:
+				v.WithLabelValues(values...)
+				defer v.DeleteLabelValues(values...)
+			case *prometheus.GaugeVec:
+				v.WithLabelValues(values...)
+				defer v.DeleteLabelValues(values...)
+			case *prometheus.HistogramVec:
+				v.WithLabelValues(values...)
+				defer v.DeleteLabelValues(values...)
+			default:
+				t.Fatalf("unexpected vector %T", c)
+			}
+		}
+	}
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var b strings.Builder
+	for _, mf := range families {
+		m := mf.GetMetric()[0]
+		var labels []string
+		for _, l := range m.GetLabel() {
+			labels = append(labels, l.GetName())
+		}
+		fmt.Fprintf(&b, "%s %s{%s}", strings.ToLower(mf.GetType().String()), mf.GetName(), strings.Join(labels, ","))
+		if mf.GetType() == dto.MetricType_HISTOGRAM {
+			var le []string
+			for _, bucket := range m.GetHistogram().GetBucket() {
+				le = append(le, fmt.Sprint(bucket.GetUpperBound()))
+			}
+			fmt.Fprintf(&b, " le=%s", strings.Join(le, ","))
+		}
+		b.WriteString("\n")
+	}
+	golden(t, "metrics.golden", b.String())
+}
+
+// labelCount returns the number of variable labels of c's metric.
+func labelCount(t *testing.T, c prometheus.Collector) int {
+	descs := make(chan *prometheus.Desc, 1)
+	c.Describe(descs)
+	m := variableLabels.FindStringSubmatch((<-descs).String())
+	require.NotNil(t, m)
+	if m[1] == "" {
+		return 0
+	}
+	return len(strings.Split(m[1], ","))
+}
+
+// golden compares got with testdata/name, or rewrites the file with -update.
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), got, "%s changed; if that's intended, run go test -update and update dashboards", path)
+}
\ No newline at end of file
@@ -39,6 +39,14 @@ var (
 		Help:      "Total Redis errors.",
 	})
 
+	// RedisPoolSize tracks the limiter's Redis pool size, which changes when
+	// adaptive sizing is enabled.
+	RedisPoolSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "redis_pool_size",
+		Help:      "Connection pool size of the limiter's Redis client.",
+	})
+
 	// TokensRemaining provides a gauge snapshot per key prefix.
 	TokensRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "ratelimiter",
@@ -59,6 +67,196 @@ var (
 		Name:      "internal_errors_total",
 		Help:      "Internal (non-rate-limit) errors.",
 	}, []string{"method", "error_type"})
+
+	// OverridesAdjusted counts client burst/rate overrides clamped or
+	// rejected by prefix rules.
+	OverridesAdjusted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "overrides_adjusted_total",
+		Help:      "Client overrides outside the allowed range, by rule prefix and action.",
+	}, []string{"key_prefix", "action"}) // action: "clamped" | "rejected"
+
+	// AuthFailures counts rejected request signatures by reason.
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "auth_failures_total",
+		Help:      "Requests rejected by HMAC signature verification.",
+	}, []string{"reason"})
+
+	// APIQuotaDenied counts RPCs rejected by per-service-account API quotas.
+	APIQuotaDenied = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "api_quota_denied_total",
+		Help:      "RPCs rejected because the calling service account exceeded its API quota.",
+	}, []string{"client"})
+
+	// PeeksDeduplicated counts Peek calls answered from another in-flight
+	// identical Peek.
+	PeeksDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "peeks_deduplicated_total",
+		Help:      "Peek calls that shared a concurrent identical Redis read.",
+	})
+
+	// LeasedDecisions counts Allow calls answered from a hot key's token
+	// lease without a Redis round trip.
+	LeasedDecisions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "leased_decisions_total",
+		Help:      "Allow calls served from an in-memory token lease.",
+	})
+
+	// BudgetFallbacks counts latency-critical Allow calls answered from
+	// local state because Redis exceeded the latency budget.
+	BudgetFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "latency_budget_fallbacks_total",
+		Help:      "Allow calls answered locally after Redis exceeded the latency budget, by decision.",
+	}, []string{"decision"})
+
+	// BudgetReconciled counts local decisions that Redis disagreed with.
+	BudgetReconciled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "latency_budget_reconciled_total",
+		Help:      "Local decisions that differed from Redis, by outcome.",
+	}, []string{"outcome"}) // outcome: "refunded" | "overadmitted"
+
+	// RuntimeSetting exports the effective Go runtime settings.
+	RuntimeSetting = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "runtime_setting",
+		Help:      "Effective Go runtime settings (gomaxprocs, gogc, memory_limit_bytes).",
+	}, []string{"setting"})
+
+	// SchedulerQueued tracks calls waiting for a Redis slot in the fair scheduler.
+	SchedulerQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "scheduler_queued",
+		Help:      "Calls waiting in the fair scheduler.",
+	})
+
+	// SchedulerWait records how long queued calls waited for a slot.
+	SchedulerWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "ratelimiter",
+		Name:      "scheduler_wait_seconds",
+		Help:      "Histogram of fair scheduler queue wait times.",
+		Buckets:   []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+	})
+
+	// ChaosInjected counts Redis faults injected by the chaos hook.
+	ChaosInjected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "chaos_injected_total",
+		Help:      "Redis faults injected for testing, by kind.",
+	}, []string{"fault"}) // fault: "down" | "latency" | "error" | "script_error" | "partition"
+
+	// MaintenanceMode is 1 while maintenance mode is on.
+	MaintenanceMode = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "maintenance_mode",
+		Help:      "1 while maintenance mode admits every request.",
+	})
+
+	// ShadowDecisions counts the limiter's decisions on requests admitted
+	// regardless in maintenance mode.
+	ShadowDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "shadow_decisions_total",
+		Help:      "Decisions the limiter would have made in maintenance mode, by key_prefix and decision.",
+	}, []string{"key_prefix", "decision"}) // decision: "allowed" | "denied" | "error"
+
+	// AlertsSent counts rule alert webhook calls.
+	AlertsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "alerts_total",
+		Help:      "Rule alert webhook calls, by rule and result.",
+	}, []string{"rule", "result"}) // result: "sent" | "failed" | "dropped"
+
+	// HistoryWrites counts the decisions of traced keys written to their
+	// decision history.
+	HistoryWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "decision_history_writes_total",
+		Help:      "Decisions of traced keys written to their history, by result.",
+	}, []string{"result"}) // result: "written" | "failed" | "dropped"
+
+	// SoftLimitWarnings counts admitted requests past their rule's soft
+	// limit.
+	SoftLimitWarnings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "soft_limit_warnings_total",
+		Help:      "Admitted requests that crossed their rule's soft limit, by key_prefix.",
+	}, []string{"key_prefix"})
+
+	// AnomalyThrottles counts keys throttled for a jump in their request rate.
+	AnomalyThrottles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "anomaly_throttles_total",
+		Help:      "Keys throttled for a request rate far above their baseline, by key_prefix.",
+	}, []string{"key_prefix"})
+
+	// GreylistedKeys counts keys put on probation when first seen.
+	GreylistedKeys = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "greylisted_keys_total",
+		Help:      "Keys seen for the first time and given the provisional limit.",
+	})
+
+	// GlobalRegions tracks the regions sharing global limits.
+	GlobalRegions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "global_regions",
+		Help:      "Live regions sharing global limits, this one included.",
+	})
+
+	// GlobalSyncErrors counts failed syncs with the other regions.
+	GlobalSyncErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "global_sync_errors_total",
+		Help:      "Failed syncs of global limit shares with the other regions.",
+	})
+
+	// RedisKeys tracks the keys of each Redis node, as seen by the guard.
+	RedisKeys = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "redis_keys",
+		Help:      "Keys in the limiter's Redis database, by node.",
+	}, []string{"node"})
+
+	// RedisMemory tracks the memory used by each Redis node.
+	RedisMemory = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "redis_used_memory_bytes",
+		Help:      "Memory used by the limiter's Redis, by node.",
+	}, []string{"node"})
+
+	// GuardEvictions counts buckets evicted to keep Redis under its caps.
+	GuardEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "guard_evictions_total",
+		Help:      "Idle buckets evicted to bring Redis back under its cap, by cap (keys or memory).",
+	}, []string{"cap"})
+
+	// CleanupScanned counts the keys the bucket cleanup went through.
+	CleanupScanned = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "cleanup_scanned_keys_total",
+		Help:      "Bucket keys scanned by the idle bucket cleanup.",
+	})
+
+	// CleanupDeleted counts the idle buckets the cleanup deleted.
+	CleanupDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "ratelimiter",
+		Name:      "cleanup_deleted_keys_total",
+		Help:      "Idle buckets deleted by the cleanup.",
+	})
+
+	// CleanupLastPass records when the last cleanup pass completed.
+	CleanupLastPass = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "ratelimiter",
+		Name:      "cleanup_last_pass_timestamp_seconds",
+		Help:      "Unix time the last complete pass of the idle bucket cleanup ended.",
+	})
 )
 
 // Handler returns an HTTP handler for the /metrics endpoint.
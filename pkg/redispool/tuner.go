@@ -0,0 +1,130 @@
+// Package redispool sizes the limiter's Redis connection pool from observed
+// load, within operator-set bounds.
+package redispool
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// samplesPerDecision is how many pool samples are aggregated before the
+// tuner considers resizing.
+const samplesPerDecision = 10
+
+// Swapper installs a new client and returns the one it replaces.
+type Swapper func(*redis.Client) *redis.Client
+
+// Tuner resizes a Redis pool. go-redis can't resize a live pool, so the
+// tuner builds a client with the new size, swaps it in, and closes the old
+// one once its in-flight commands have had time to finish.
+//
+// The pool grows by half when callers waited for a connection (pool
+// timeouts, or samples with every connection busy) and shrinks by a
+// quarter when peak use stayed under a third of it. MinIdleConns follows
+// half the observed peak so bursts find warm connections.
+type Tuner struct {
+	opts     redis.Options
+	min, max int
+	swap     Swapper
+
+	current *redis.Client
+	last    *redis.PoolStats
+	samples int
+	peak    int
+	waited  bool
+	// warm is half the peak of the last decision, for MinIdleConns
+	warm int
+}
+
+// NewTuner manages current, which was created from opts. The pool size is
+// kept within [min, max] from the first decision on.
+func NewTuner(opts *redis.Options, current *redis.Client, min, max int, swap Swapper) *Tuner {
+	metrics.RedisPoolSize.Set(float64(opts.PoolSize))
+	return &Tuner{opts: *opts, min: min, max: max, swap: swap, current: current}
+}
+
+// Close closes the client currently in use. Call it after Run has returned.
+func (t *Tuner) Close() error {
+	return t.current.Close()
+}
+
+// Run samples the pool every interval until ctx is cancelled.
+func (t *Tuner) Run(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if size, ok := t.sample(t.current.PoolStats()); ok {
+				t.resize(ctx, size)
+			}
+		}
+	}
+}
+
+// sample records one observation and, every samplesPerDecision samples,
+// returns the pool size to switch to, if it should change.
+func (t *Tuner) sample(st *redis.PoolStats) (int, bool) {
+	inUse := int(st.TotalConns) - int(st.IdleConns)
+	if inUse > t.peak {
+		t.peak = inUse
+	}
+	if inUse >= t.opts.PoolSize || (t.last != nil && st.Timeouts > t.last.Timeouts) {
+		t.waited = true
+	}
+	t.last = st
+
+	t.samples++
+	if t.samples < samplesPerDecision {
+		return 0, false
+	}
+	size := t.opts.PoolSize
+	switch {
+	case t.waited:
+		size += (size + 1) / 2
+	case t.peak < size/3:
+		size -= size / 4
+	}
+	size = clamp(size, t.min, t.max)
+	t.warm = min(t.peak/2, size)
+	t.samples, t.peak, t.waited = 0, 0, false
+
+	return size, size != t.opts.PoolSize
+}
+
+func (t *Tuner) resize(ctx context.Context, size int) {
+	opts := t.opts
+	opts.PoolSize = size
+	opts.MinIdleConns = min(t.warm, size)
+	next := redis.NewClient(&opts)
+	if err := next.Ping(ctx).Err(); err != nil {
+		log.Printf("redis pool resize to %d failed: %v", size, err)
+		next.Close()
+		return
+	}
+
+	log.Printf("resizing redis pool %d -> %d", t.opts.PoolSize, size)
+	old := t.swap(next)
+	t.opts, t.current, t.last = opts, next, nil
+	metrics.RedisPoolSize.Set(float64(size))
+
+	grace := opts.ReadTimeout + opts.WriteTimeout + time.Second
+	time.AfterFunc(grace, func() { old.Close() })
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
\ No newline at end of file
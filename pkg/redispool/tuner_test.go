@@ -0,0 +1,58 @@
+package redispool
+
+import (
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func decide(t *Tuner, st redis.PoolStats) (int, bool) {
+	var (
+		size int
+		ok   bool
+	)
+	for i := 0; i < samplesPerDecision; i++ {
+		s := st
+		size, ok = t.sample(&s)
+	}
+	return size, ok
+}
+
+func TestSample(t *testing.T) {
+	tu := NewTuner(&redis.Options{PoolSize: 20}, nil, 10, 40, nil)
+
+	// Every connection busy: grow by half
+	size, ok := decide(tu, redis.PoolStats{TotalConns: 20, IdleConns: 0})
+	assert.True(t, ok)
+	assert.Equal(t, 30, size)
+	assert.Equal(t, 10, tu.warm, "half the peak stays warm")
+
+	// Moderate use: keep the size
+	size, ok = decide(tu, redis.PoolStats{TotalConns: 12, IdleConns: 2})
+	assert.False(t, ok)
+	assert.Equal(t, 20, size)
+
+	// Mostly idle: shrink by a quarter, but not below min
+	size, ok = decide(tu, redis.PoolStats{TotalConns: 3, IdleConns: 2})
+	assert.True(t, ok)
+	assert.Equal(t, 15, size)
+	assert.Equal(t, 0, tu.warm)
+
+	tu.opts.PoolSize = 12
+	size, ok = decide(tu, redis.PoolStats{TotalConns: 1, IdleConns: 1})
+	assert.True(t, ok)
+	assert.Equal(t, 10, size)
+}
+
+func TestSample_Timeouts(t *testing.T) {
+	tu := NewTuner(&redis.Options{PoolSize: 30}, nil, 10, 40, nil)
+
+	tu.sample(&redis.PoolStats{TotalConns: 15, Timeouts: 1})
+	for i := 1; i < samplesPerDecision-1; i++ {
+		tu.sample(&redis.PoolStats{TotalConns: 15, Timeouts: 1})
+	}
+	size, ok := tu.sample(&redis.PoolStats{TotalConns: 15, Timeouts: 4})
+	assert.True(t, ok)
+	assert.Equal(t, 40, size, "growth is capped at max")
+}
\ No newline at end of file
@@ -0,0 +1,229 @@
+// Package replay replays recorded traffic against a limiter, to check how
+// proposed limits would have treated it. It backs cmd/replay.
+package replay
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Record is one recorded request.
+type Record struct {
+	Key    string
+	Time   time.Time
+	Tokens int64
+}
+
+// Read parses CSV records of key,timestamp[,tokens]. Timestamps are unix
+// seconds (fractions allowed) or RFC 3339; tokens default to 1. A first
+// line that doesn't parse as a record is taken as a header. Records are
+// returned sorted by time.
+func Read(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var out []Record
+	for line := 1; ; line++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec, err := parse(fields)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, rec)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+func parse(fields []string) (Record, error) {
+	if len(fields) < 2 || len(fields) > 3 {
+		return Record{}, fmt.Errorf("want key,timestamp[,tokens], got %d fields", len(fields))
+	}
+	rec := Record{Key: fields[0], Tokens: 1}
+	if rec.Key == "" {
+		return Record{}, errors.New("empty key")
+	}
+	if t, ok := parseUnix(fields[1]); ok {
+		rec.Time = t
+	} else if t, err := time.Parse(time.RFC3339Nano, fields[1]); err == nil {
+		rec.Time = t
+	} else {
+		return Record{}, fmt.Errorf("invalid timestamp %q", fields[1])
+	}
+	if len(fields) == 3 && fields[2] != "" {
+		n, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || n < 1 {
+			return Record{}, fmt.Errorf("invalid tokens %q", fields[2])
+		}
+		rec.Tokens = n
+	}
+	return rec, nil
+}
+
+// parseUnix parses unix seconds with up to nanosecond fractions, without
+// the rounding of going through a float.
+func parseUnix(s string) (time.Time, bool) {
+	whole, frac, _ := strings.Cut(s, ".")
+	secs, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || len(frac) > 9 {
+		return time.Time{}, false
+	}
+	var nanos int64
+	if frac != "" {
+		if nanos, err = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return time.Unix(secs, nanos), true
+}
+
+// Config is a replay run.
+type Config struct {
+	// Speed scales the recorded pace: 1 replays in real time, 10 ten times
+	// faster. 0 replays as fast as the workers go.
+	Speed float64
+
+	// Concurrency is the number of requests in flight at most.
+	Concurrency int
+}
+
+// Stats counts the outcomes of the requests for one key prefix.
+type Stats struct {
+	Requests int64
+	Allowed  int64
+	Denied   int64
+	Errors   int64
+}
+
+// DenialRate returns the fraction of answered requests that were denied.
+func (s Stats) DenialRate() float64 {
+	if answered := s.Allowed + s.Denied; answered > 0 {
+		return float64(s.Denied) / float64(answered)
+	}
+	return 0
+}
+
+// Summary is the outcome of a replay, per key prefix ("user" for
+// "user:123") and in total.
+type Summary struct {
+	Prefixes map[string]*Stats
+	Total    Stats
+
+	// MaxLag is how far the replay fell behind the scaled schedule, e.g.
+	// because the server or the workers couldn't keep up.
+	MaxLag time.Duration
+}
+
+// Run sends records to lim at their recorded pace, scaled by cfg.Speed.
+// It stops early, returning ctx's error, when ctx is done.
+func Run(ctx context.Context, lim client.Limiter, records []Record, cfg Config) (*Summary, error) {
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	sum := &Summary{Prefixes: map[string]*Stats{}}
+	var mu sync.Mutex
+
+	work := make(chan Record)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range work {
+				res, err := lim.Allow(ctx, rec.Key, rec.Tokens)
+
+				mu.Lock()
+				prefix := metrics.KeyPrefix(rec.Key)
+				st := sum.Prefixes[prefix]
+				if st == nil {
+					st = &Stats{}
+					sum.Prefixes[prefix] = st
+				}
+				for _, s := range []*Stats{st, &sum.Total} {
+					s.Requests++
+					switch {
+					case err != nil:
+						s.Errors++
+					case res.Allowed:
+						s.Allowed++
+					default:
+						s.Denied++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := dispatch(ctx, records, cfg.Speed, work, &sum.MaxLag)
+	close(work)
+	wg.Wait()
+	return sum, err
+}
+
+// dispatch hands records to work at their scaled times.
+func dispatch(ctx context.Context, records []Record, speed float64, work chan<- Record, maxLag *time.Duration) error {
+	if len(records) == 0 {
+		return nil
+	}
+	start, first := time.Now(), records[0].Time
+	for _, rec := range records {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(rec.Time.Sub(first)) / speed))
+			if wait := time.Until(due); wait > 0 {
+				t := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				case <-t.C:
+				}
+			} else if -wait > *maxLag {
+				*maxLag = -wait
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case work <- rec:
+		}
+	}
+	return nil
+}
+
+// SortedPrefixes returns the summary's prefixes by descending request count.
+func (s *Summary) SortedPrefixes() []string {
+	out := make([]string, 0, len(s.Prefixes))
+	for p := range s.Prefixes {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := s.Prefixes[out[i]], s.Prefixes[out[j]]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
\ No newline at end of file
@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limitertest"
+)
+
+func TestRead(t *testing.T) {
+	recs, err := Read(strings.NewReader(`key,timestamp,tokens
+user:2,1700000001.5
+user:1,2023-11-14T22:13:20Z,3
+ip:10.0.0.1, 1700000000.25, 2
+`))
+	require.NoError(t, err)
+	require.Len(t, recs, 3)
+	assert.Equal(t, Record{Key: "user:1", Time: time.Unix(1700000000, 0).UTC(), Tokens: 3}, recs[0])
+	assert.Equal(t, "ip:10.0.0.1", recs[1].Key)
+	assert.Equal(t, int64(2), recs[1].Tokens)
+	assert.Equal(t, time.Unix(1700000001, 5e8), recs[2].Time)
+	assert.Equal(t, int64(1), recs[2].Tokens)
+
+	_, err = Read(strings.NewReader("user:1,1700000000\nuser:1,yesterday\n"))
+	assert.ErrorContains(t, err, "line 2: invalid timestamp")
+}
+
+func TestRun(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	var recs []Record
+	for i := 0; i < 5; i++ {
+		at := base.Add(time.Duration(i) * 10 * time.Millisecond)
+		recs = append(recs, Record{Key: "user:1", Time: at, Tokens: 1}, Record{Key: "ip:1", Time: at, Tokens: 1})
+	}
+
+	// 40ms of traffic at double speed
+	start := time.Now()
+	sum, err := Run(context.Background(), limitertest.DenyAfter(3), recs, Config{Speed: 2, Concurrency: 4})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	assert.Equal(t, Stats{Requests: 10, Allowed: 6, Denied: 4}, sum.Total)
+	assert.Equal(t, Stats{Requests: 5, Allowed: 3, Denied: 2}, *sum.Prefixes["user"])
+	assert.InDelta(t, 0.4, sum.Prefixes["ip"].DenialRate(), 1e-9)
+	assert.Equal(t, []string{"ip", "user"}, sum.SortedPrefixes())
+}
\ No newline at end of file
@@ -0,0 +1,631 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Wildcard is the prefix of the rule applied to keys no other rule matches.
+const Wildcard = "*"
+
+// How out-of-range client overrides are handled.
+const (
+	OverridesClamp  = "clamp"
+	OverridesReject = "reject"
+)
+
+// ErrOverrideOutOfRange is returned when a rule rejects a client override.
+var ErrOverrideOutOfRange = errors.New("override outside allowed range")
+
+// ErrUnknownBucket is returned for a named bucket the rule doesn't define.
+var ErrUnknownBucket = errors.New("unknown bucket")
+
+// ErrTooManyTokens is returned for an Allow call requesting more tokens
+// than the rule's MaxTokens.
+var ErrTooManyTokens = errors.New("tokens requested exceed the per-call maximum")
+
+// SubnetBucket names the aggregate bucket of a rule's IP keys' network,
+// so no named bucket or chain link of the rule may take it.
+const SubnetBucket = "subnet"
+
+// bucketName is the syntax of named buckets.
+var bucketName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Rule configures the bucket for all keys sharing a prefix (the part before
+// the first ':', see metrics.KeyPrefix).
+type Rule struct {
+	Prefix string `yaml:"prefix"`
+
+	// Defaults when the request carries no override (0 = server default).
+	// Tenant defaults take precedence over these.
+	Burst int64   `yaml:"burst"`
+	Rate  float64 `yaml:"rate"`
+
+	// Allowed range for client-supplied overrides (0 = unbounded).
+	MinBurst int64   `yaml:"min_burst"`
+	MaxBurst int64   `yaml:"max_burst"`
+	MinRate  float64 `yaml:"min_rate"`
+	MaxRate  float64 `yaml:"max_rate"`
+
+	// Overrides is "clamp" (default) or "reject".
+	Overrides string `yaml:"overrides"`
+
+	// MaxTokens caps the tokens one Allow call may request; larger
+	// requests are rejected (0 = uncapped).
+	MaxTokens float64 `yaml:"max_tokens"`
+
+	// Global makes the keys' limits hold across every region syncing
+	// through GLOBAL_REDIS_ADDR; each region gets a share.
+	Global bool `yaml:"global"`
+
+	// SoftLimit is the bucket utilization, in (0, 1), from which admitted
+	// requests carry a warning that the key is nearing its limit (0 =
+	// never).
+	SoftLimit float64 `yaml:"soft_limit"`
+
+	// Cooldown keeps denying a key for that long once its bucket runs dry,
+	// even as it refills, so clients polling at exactly the refill rate
+	// have to back off (0 = no cooldown). It costs an extra Redis call
+	// per Allow.
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// Spacing paces each key to one admitted token per interval, on top
+	// of its buckets, for APIs that care about how requests are spread
+	// rather than how many arrive: a request for n tokens holds the next
+	// one back for n intervals, and denials carry the exact wait (0 = no
+	// pacing). It costs an extra Redis call per Allow.
+	Spacing time.Duration `yaml:"spacing"`
+
+	// Webhooks notified when keys of the rule are denied or run low.
+	Alerts []*Alert `yaml:"alerts"`
+
+	// Named buckets every key of the rule carries besides its own, e.g.
+	// separate read and write pools. Requests name the one they use.
+	Buckets map[string]*Bucket `yaml:"buckets"`
+
+	// Further limits every Allow call on the rule's keys is charged for,
+	// e.g. per-minute and daily ones on top of the per-second bucket.
+	// The strictest decides the result.
+	Chain []*Link `yaml:"chain"`
+
+	// Subnet also charges every Allow call on an IP key, e.g.
+	// "ip:203.0.113.7", to an aggregate bucket of the address's network,
+	// so a flood spread over one subnet is denied even while each address
+	// stays under its own limit. Keys that aren't IP addresses are only
+	// charged to their own buckets.
+	Subnet *Subnet `yaml:"subnet"`
+
+	chainBuckets, chainQuotas []*Link
+}
+
+// Bucket is a named bucket of a rule's keys. Its limits take precedence
+// over tenant and rule defaults; unset ones fall back to them.
+type Bucket struct {
+	Burst int64   `yaml:"burst"`
+	Rate  float64 `yaml:"rate"`
+}
+
+// Subnet is the aggregate bucket shared by the IP keys of one network.
+// Like chain links, it applies as configured.
+type Subnet struct {
+	// Prefix lengths of the networks addresses are aggregated by, /24 and
+	// /64 when unset.
+	IPv4 int `yaml:"ipv4"`
+	IPv6 int `yaml:"ipv6"`
+
+	Burst int64   `yaml:"burst"`
+	Rate  float64 `yaml:"rate"`
+}
+
+// Network returns key with its IP address, as the whole key or following
+// its prefix, replaced by the address's network, e.g. "ip:203.0.113.0/24"
+// for "ip:203.0.113.7", or "" when key holds no address.
+func (s *Subnet) Network(key string) string {
+	if s == nil {
+		return ""
+	}
+	var prefix string
+	ip, err := netip.ParseAddr(key)
+	if err != nil {
+		i := strings.IndexByte(key, ':')
+		if i < 0 {
+			return ""
+		}
+		if ip, err = netip.ParseAddr(key[i+1:]); err != nil {
+			return ""
+		}
+		prefix = key[:i+1]
+	}
+	ip = ip.Unmap().WithZone("")
+	bits := s.IPv6
+	if ip.Is4() {
+		bits = s.IPv4
+	}
+	network, err := ip.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix + network.String()
+}
+
+func (s *Subnet) validate() error {
+	if s.IPv4 == 0 {
+		s.IPv4 = 24
+	}
+	if s.IPv6 == 0 {
+		s.IPv6 = 64
+	}
+	if s.IPv4 < 1 || s.IPv4 > 32 || s.IPv6 < 1 || s.IPv6 > 128 {
+		return errors.New("prefix lengths must be 1-32 for ipv4 and 1-128 for ipv6")
+	}
+	if s.Burst <= 0 || s.Rate <= 0 {
+		return errors.New("burst and rate must be positive")
+	}
+	return nil
+}
+
+// Link is one limit of a rule's chain: a token bucket when it sets Burst
+// and Rate, or a window of Quota tokens per Period. Links apply as
+// configured; overrides, tenant defaults, windows and boosts don't change
+// them.
+type Link struct {
+	Name   string        `yaml:"name"`
+	Burst  int64         `yaml:"burst"`
+	Rate   float64       `yaml:"rate"`
+	Quota  int64         `yaml:"quota"`
+	Period time.Duration `yaml:"period"`
+
+	// SubWindows makes the quota's window slide in that many steps
+	// instead of resetting every Period (0 = fixed window). More steps
+	// follow the window more closely, for more Redis memory per key.
+	SubWindows int `yaml:"sub_windows"`
+}
+
+// Step is how far a sliding window link's window moves at a time, the
+// precision it's enforced with.
+func (l *Link) Step() time.Duration {
+	if l.SubWindows == 0 {
+		return l.Period
+	}
+	return l.Period / time.Duration(l.SubWindows)
+}
+
+// DefaultDebounce is how long an alert stays quiet for a key after firing,
+// unless it sets its own debounce.
+const DefaultDebounce = 5 * time.Minute
+
+// Alert posts to a webhook when a key the rule covers is first denied or,
+// with a threshold, first has that share of its bucket in use.
+type Alert struct {
+	// The keys watched: one key, or those starting with KeyPrefix (e.g.
+	// "user:42:"). With neither, every key of the rule.
+	Key       string `yaml:"key"`
+	KeyPrefix string `yaml:"key_prefix"`
+
+	// Threshold is the bucket utilization, in (0, 1], at which the alert
+	// fires (0 = on denial only). A denial always fires it.
+	Threshold float64 `yaml:"threshold"`
+
+	URL string `yaml:"url"`
+
+	// Debounce is how long the alert stays quiet for a key after firing
+	// (0 = DefaultDebounce).
+	Debounce time.Duration `yaml:"debounce"`
+}
+
+// Set is an immutable collection of rules indexed by prefix, and of
+// scheduled windows.
+type Set struct {
+	byPrefix map[string]*Rule
+	windows  []*Window
+	version  string
+}
+
+type file struct {
+	Rules   []*Rule   `yaml:"rules"`
+	Windows []*Window `yaml:"windows"`
+}
+
+// Load reads a rules file, e.g.
+//
+//	rules:
+//	  - prefix: user
+//	    burst: 20
+//	    rate: 5
+//	    max_burst: 100
+//	    max_rate: 50
+//	    max_tokens: 10
+//	    soft_limit: 0.8
+//	    cooldown: 30s
+//	    spacing: 50ms
+//	    buckets:
+//	      write: {burst: 5, rate: 1}
+//	    chain:
+//	      - {name: minute, burst: 300, rate: 5}
+//	      - {name: hour, quota: 1000, period: 1h, sub_windows: 12}
+//	      - {name: day, quota: 10000, period: 24h}
+//	    alerts:
+//	      - key: user:42
+//	        threshold: 0.9
+//	        url: https://abuse.example.com/hooks/ratelimit
+//	        debounce: 15m
+//	  - prefix: "*"
+//	    max_burst: 1000
+//	    overrides: reject
+//	windows:
+//	  - name: sunday-import
+//	    prefixes: [import]
+//	    days: [sun]
+//	    start: "02:00"
+//	    end: "04:00"
+//	    multiplier: 5
+func Load(path string) (*Set, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse builds a Set from YAML.
+func Parse(b []byte) (*Set, error) {
+	var f file
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+	s := &Set{byPrefix: make(map[string]*Rule, len(f.Rules))}
+	for i, r := range f.Rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d (%q): %w", i, r.Prefix, err)
+		}
+		if _, dup := s.byPrefix[r.Prefix]; dup {
+			return nil, fmt.Errorf("rule %d: duplicate prefix %q", i, r.Prefix)
+		}
+		s.byPrefix[r.Prefix] = r
+	}
+	names := make(map[string]bool, len(f.Windows))
+	for i, w := range f.Windows {
+		if w == nil {
+			return nil, fmt.Errorf("window %d: empty", i)
+		}
+		if err := w.validate(); err != nil {
+			return nil, fmt.Errorf("window %d (%q): %w", i, w.Name, err)
+		}
+		if names[w.Name] {
+			return nil, fmt.Errorf("window %d: duplicate name %q", i, w.Name)
+		}
+		names[w.Name] = true
+	}
+	s.windows = f.Windows
+	sum := sha256.Sum256(b)
+	s.version = hex.EncodeToString(sum[:6])
+	return s, nil
+}
+
+// Version identifies the rules file the Set was parsed from: a prefix of
+// its SHA-256, empty for a nil Set.
+func (s *Set) Version() string {
+	if s == nil {
+		return ""
+	}
+	return s.version
+}
+
+func (r *Rule) validate() error {
+	if r.Prefix == "" {
+		return errors.New("prefix is required")
+	}
+	if r.Burst < 0 || r.Rate < 0 || r.MinBurst < 0 || r.MaxBurst < 0 || r.MinRate < 0 || r.MaxRate < 0 || r.MaxTokens < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if r.MaxBurst > 0 && r.MinBurst > r.MaxBurst {
+		return errors.New("min_burst exceeds max_burst")
+	}
+	if r.MaxRate > 0 && r.MinRate > r.MaxRate {
+		return errors.New("min_rate exceeds max_rate")
+	}
+	if r.SoftLimit < 0 || r.SoftLimit >= 1 {
+		return errors.New("soft_limit must be at least 0 and below 1")
+	}
+	if r.Cooldown < 0 {
+		return errors.New("cooldown must not be negative")
+	}
+	if r.Spacing < 0 {
+		return errors.New("spacing must not be negative")
+	}
+	switch r.Overrides {
+	case "":
+		r.Overrides = OverridesClamp
+	case OverridesClamp, OverridesReject:
+	default:
+		return fmt.Errorf("overrides must be %q or %q", OverridesClamp, OverridesReject)
+	}
+	for i, a := range r.Alerts {
+		if err := a.validate(); err != nil {
+			return fmt.Errorf("alert %d: %w", i, err)
+		}
+	}
+	for name, b := range r.Buckets {
+		if !bucketName.MatchString(name) {
+			return fmt.Errorf("bucket name %q must be 1-32 letters, digits, '_' or '-'", name)
+		}
+		if b == nil {
+			return fmt.Errorf("bucket %q: empty bucket", name)
+		}
+		if b.Burst < 0 || b.Rate < 0 {
+			return fmt.Errorf("bucket %q: limits must not be negative", name)
+		}
+	}
+	names := make(map[string]bool, len(r.Chain))
+	for i, l := range r.Chain {
+		if err := l.validate(); err != nil {
+			return fmt.Errorf("chain link %d: %w", i, err)
+		}
+		if _, ok := r.Buckets[l.Name]; ok || names[l.Name] {
+			return fmt.Errorf("chain link %d: name %q is taken", i, l.Name)
+		}
+		names[l.Name] = true
+		if l.Quota > 0 {
+			r.chainQuotas = append(r.chainQuotas, l)
+		} else {
+			r.chainBuckets = append(r.chainBuckets, l)
+		}
+	}
+	if r.Subnet != nil {
+		if err := r.Subnet.validate(); err != nil {
+			return fmt.Errorf("subnet: %w", err)
+		}
+		if _, ok := r.Buckets[SubnetBucket]; ok || names[SubnetBucket] {
+			return fmt.Errorf("name %q is reserved for the subnet bucket", SubnetBucket)
+		}
+	}
+	return nil
+}
+
+func (l *Link) validate() error {
+	if l == nil {
+		return errors.New("empty link")
+	}
+	if !bucketName.MatchString(l.Name) {
+		return fmt.Errorf("name %q must be 1-32 letters, digits, '_' or '-'", l.Name)
+	}
+	switch {
+	case l.Quota > 0 && l.Burst == 0 && l.Rate == 0:
+		if l.Period < time.Second {
+			return fmt.Errorf("link %q: quota period must be at least 1s", l.Name)
+		}
+		if l.SubWindows < 0 || l.SubWindows > limiter.MaxSubWindows {
+			return fmt.Errorf("link %q: sub_windows must be between 0 and %d", l.Name, limiter.MaxSubWindows)
+		}
+	case l.Burst > 0 && l.Rate > 0 && l.Quota == 0 && l.Period == 0 && l.SubWindows == 0:
+	default:
+		return fmt.Errorf("link %q: set either a positive burst and rate or a positive quota and period", l.Name)
+	}
+	return nil
+}
+
+func (a *Alert) validate() error {
+	if a == nil {
+		return errors.New("empty alert")
+	}
+	if a.Key != "" && a.KeyPrefix != "" {
+		return errors.New("key and key_prefix are exclusive")
+	}
+	if a.Threshold < 0 || a.Threshold > 1 {
+		return errors.New("threshold must be between 0 and 1")
+	}
+	if a.Debounce < 0 {
+		return errors.New("debounce must not be negative")
+	}
+	if a.Debounce == 0 {
+		a.Debounce = DefaultDebounce
+	}
+	u, err := url.Parse(a.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q is not an http(s) URL", a.URL)
+	}
+	return nil
+}
+
+// Watches reports whether the alert covers key, as sent by the client.
+func (a *Alert) Watches(key string) bool {
+	if a.Key != "" {
+		return key == a.Key
+	}
+	return strings.HasPrefix(key, a.KeyPrefix)
+}
+
+// Fires reports whether a decision trips the alert.
+func (a *Alert) Fires(allowed bool, remaining, limit int64) bool {
+	if !allowed {
+		return true
+	}
+	if a.Threshold == 0 || limit <= 0 {
+		return false
+	}
+	return 1-float64(remaining)/float64(limit) >= a.Threshold
+}
+
+// Warns reports whether an admitted request leaving remaining of limit
+// tokens crossed the rule's soft limit.
+func (r *Rule) Warns(remaining, limit int64) bool {
+	if r == nil || r.SoftLimit == 0 || limit <= 0 {
+		return false
+	}
+	return 1-float64(remaining)/float64(limit) >= r.SoftLimit
+}
+
+// Match returns the rule for key, falling back to the wildcard rule. It
+// returns nil when nothing matches; a nil *Rule applies no policy.
+func (s *Set) Match(key string) *Rule {
+	if s == nil {
+		return nil
+	}
+	if r, ok := s.byPrefix[metrics.KeyPrefix(key)]; ok {
+		return r
+	}
+	return s.byPrefix[Wildcard]
+}
+
+// HasAlerts reports whether any rule has alerts.
+func (s *Set) HasAlerts() bool {
+	if s == nil {
+		return false
+	}
+	for _, r := range s.byPrefix {
+		if len(r.Alerts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// SlidingWindow is the effective precision of a sliding window link.
+type SlidingWindow struct {
+	Prefix     string        `json:"prefix"`
+	Link       string        `json:"link"`
+	Period     time.Duration `json:"period"`
+	SubWindows int           `json:"sub_windows"`
+	Step       time.Duration `json:"step"`
+}
+
+// SlidingWindows lists the sliding window links of every rule, by prefix
+// and position in the chain.
+func (s *Set) SlidingWindows() []SlidingWindow {
+	if s == nil {
+		return nil
+	}
+	var out []SlidingWindow
+	for _, r := range s.byPrefix {
+		for _, l := range r.chainQuotas {
+			if l.SubWindows > 0 {
+				out = append(out, SlidingWindow{Prefix: r.Prefix, Link: l.Name, Period: l.Period, SubWindows: l.SubWindows, Step: l.Step()})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Prefix < out[j].Prefix })
+	return out
+}
+
+// Len returns the number of rules.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.byPrefix)
+}
+
+// ApplyOverrides enforces the allowed range on client-supplied burst and
+// rate. Zero means "no override" and passes through unchanged.
+func (r *Rule) ApplyOverrides(burst int64, rate float64) (int64, float64, error) {
+	if r == nil {
+		return burst, rate, nil
+	}
+
+	clampedBurst := burst
+	if burst > 0 {
+		if r.MinBurst > 0 && burst < r.MinBurst {
+			clampedBurst = r.MinBurst
+		}
+		if r.MaxBurst > 0 && burst > r.MaxBurst {
+			clampedBurst = r.MaxBurst
+		}
+	}
+	clampedRate := rate
+	if rate > 0 {
+		if r.MinRate > 0 && rate < r.MinRate {
+			clampedRate = r.MinRate
+		}
+		if r.MaxRate > 0 && rate > r.MaxRate {
+			clampedRate = r.MaxRate
+		}
+	}
+
+	if clampedBurst == burst && clampedRate == rate {
+		return burst, rate, nil
+	}
+	if r.Overrides == OverridesReject {
+		metrics.OverridesAdjusted.WithLabelValues(r.Prefix, "rejected").Inc()
+		return 0, 0, ErrOverrideOutOfRange
+	}
+	metrics.OverridesAdjusted.WithLabelValues(r.Prefix, "clamped").Inc()
+	return clampedBurst, clampedRate, nil
+}
+
+// CheckTokens rejects requests for more tokens than the rule allows per
+// call.
+func (r *Rule) CheckTokens(tokens float64) error {
+	if r == nil || r.MaxTokens == 0 || tokens <= r.MaxTokens {
+		return nil
+	}
+	return fmt.Errorf("%w of %g", ErrTooManyTokens, r.MaxTokens)
+}
+
+// Bucket returns the named bucket of the rule's keys.
+func (r *Rule) Bucket(name string) (*Bucket, error) {
+	if r != nil {
+		if b, ok := r.Buckets[name]; ok {
+			return b, nil
+		}
+	}
+	return nil, ErrUnknownBucket
+}
+
+// ChainBuckets returns the token bucket links of the rule's chain, in order.
+func (r *Rule) ChainBuckets() []*Link {
+	if r == nil {
+		return nil
+	}
+	return r.chainBuckets
+}
+
+// ChainQuotas returns the quota links of the rule's chain, fixed and
+// sliding, in order.
+func (r *Rule) ChainQuotas() []*Link {
+	if r == nil {
+		return nil
+	}
+	return r.chainQuotas
+}
+
+// Defaults fills unset burst/rate from the bucket.
+func (b *Bucket) Defaults(burst int64, rate float64) (int64, float64) {
+	if b == nil {
+		return burst, rate
+	}
+	if burst <= 0 {
+		burst = b.Burst
+	}
+	if rate <= 0 {
+		rate = b.Rate
+	}
+	return burst, rate
+}
+
+// Defaults fills unset burst/rate from the rule.
+func (r *Rule) Defaults(burst int64, rate float64) (int64, float64) {
+	if r == nil {
+		return burst, rate
+	}
+	if burst <= 0 {
+		burst = r.Burst
+	}
+	if rate <= 0 {
+		rate = r.Rate
+	}
+	return burst, rate
+}
\ No newline at end of file
@@ -0,0 +1,305 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRules = `
+rules:
+  - prefix: user
+    burst: 20
+    rate: 5
+    min_burst: 5
+    max_burst: 100
+    max_rate: 50
+  - prefix: api
+    max_burst: 10
+    overrides: reject
+  - prefix: "*"
+    max_rate: 1000
+`
+
+func TestMatch(t *testing.T) {
+	s, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+
+	assert.Equal(t, "user", s.Match("user:123").Prefix)
+	assert.Equal(t, "api", s.Match("api:payments").Prefix)
+	assert.Equal(t, Wildcard, s.Match("ip:10.0.0.1").Prefix)
+
+	var empty *Set
+	assert.Nil(t, empty.Match("user:1"))
+}
+
+func TestApplyOverrides(t *testing.T) {
+	s, err := Parse([]byte(testRules))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		key       string
+		burst     int64
+		rate      float64
+		wantBurst int64
+		wantRate  float64
+		wantErr   bool
+	}{
+		{"no override", "user:1", 0, 0, 0, 0, false},
+		{"in range", "user:1", 50, 10, 50, 10, false},
+		{"clamp high", "user:1", 1000000, 1e9, 100, 50, false},
+		{"clamp low", "user:1", 1, 10, 5, 10, false},
+		{"reject", "api:x", 11, 0, 0, 0, true},
+		{"reject ok", "api:x", 10, 99, 10, 99, false},
+		{"wildcard", "ip:1", 1000000, 2000, 1000000, 1000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			burst, rate, err := s.Match(tt.key).ApplyOverrides(tt.burst, tt.rate)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrOverrideOutOfRange)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBurst, burst)
+			assert.Equal(t, tt.wantRate, rate)
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, in := range []string{
+		"rules:\n  - burst: 1\n",
+		"rules:\n  - prefix: a\n    min_burst: 10\n    max_burst: 5\n",
+		"rules:\n  - prefix: a\n    overrides: ignore\n",
+		"rules:\n  - prefix: a\n    soft_limit: 1\n",
+		"rules:\n  - prefix: a\n    cooldown: -1s\n",
+		"rules:\n  - prefix: a\n    spacing: -1ms\n",
+		"rules:\n  - prefix: a\n    max_tokens: -1\n",
+		"rules:\n  - prefix: a\n  - prefix: a\n",
+		"rules:\n  - prefix: a\n    alerts:\n      - url: ftp://example.com\n",
+		"rules:\n  - prefix: a\n    alerts:\n      - url: http://x\n        threshold: 1.5\n",
+		"rules:\n  - prefix: a\n    alerts:\n      - url: http://x\n        key: a:1\n        key_prefix: a:\n",
+		"rules:\n  - prefix: a\n    buckets:\n      read/write: {burst: 1}\n",
+		"rules:\n  - prefix: a\n    buckets:\n      read: {rate: -1}\n",
+		"rules:\n  - prefix: a\n    buckets:\n      read:\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: minute, burst: 10}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: day, quota: 10, period: 24h, rate: 1}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: day, quota: 10}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: day, quota: 10, period: 24h, sub_windows: 1001}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: m, burst: 1, rate: 1, sub_windows: 6}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {burst: 1, rate: 1}\n",
+		"rules:\n  - prefix: a\n    chain:\n      - {name: m, burst: 1, rate: 1}\n      - {name: m, quota: 1, period: 1h}\n",
+		"rules:\n  - prefix: a\n    buckets:\n      m: {burst: 1}\n    chain:\n      - {name: m, burst: 1, rate: 1}\n",
+		"rules:\n  - prefix: ip\n    subnet: {burst: 10}\n",
+		"rules:\n  - prefix: ip\n    subnet: {ipv4: 33, burst: 10, rate: 1}\n",
+		"rules:\n  - prefix: ip\n    subnet: {burst: 10, rate: 1}\n    buckets:\n      subnet: {burst: 1}\n",
+	} {
+		_, err := Parse([]byte(in))
+		assert.Error(t, err, in)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	s, err := Parse([]byte(`
+rules:
+  - prefix: api
+    burst: 100
+    buckets:
+      read: {burst: 50, rate: 20}
+      write: {rate: 1}
+`))
+	require.NoError(t, err)
+	r := s.Match("api:payments")
+
+	read, err := r.Bucket("read")
+	require.NoError(t, err)
+	burst, rate := read.Defaults(0, 0)
+	assert.Equal(t, int64(50), burst)
+	assert.Equal(t, 20.0, rate)
+
+	write, err := r.Bucket("write")
+	require.NoError(t, err)
+	burst, rate = r.Defaults(write.Defaults(0, 0))
+	assert.Equal(t, int64(100), burst, "unset limits fall back to the rule's")
+	assert.Equal(t, 1.0, rate)
+
+	_, err = r.Bucket("delete")
+	assert.ErrorIs(t, err, ErrUnknownBucket)
+	_, err = s.Match("user:1").Bucket("read")
+	assert.ErrorIs(t, err, ErrUnknownBucket, "nil rule")
+}
+
+func TestChain(t *testing.T) {
+	s, err := Parse([]byte(`
+rules:
+  - prefix: api
+    chain:
+      - {name: minute, burst: 300, rate: 5}
+      - {name: day, quota: 10000, period: 24h}
+      - {name: hour, burst: 1000, rate: 0.5}
+      - {name: week, quota: 50000, period: 168h, sub_windows: 7}
+`))
+	require.NoError(t, err)
+	r := s.Match("api:payments")
+
+	var names []string
+	for _, l := range r.ChainBuckets() {
+		names = append(names, l.Name)
+	}
+	assert.Equal(t, []string{"minute", "hour"}, names)
+	require.Len(t, r.ChainQuotas(), 2)
+	assert.Equal(t, 24*time.Hour, r.ChainQuotas()[0].Period)
+	assert.Empty(t, s.Match("user:1").ChainBuckets(), "nil rule")
+
+	assert.Equal(t, []SlidingWindow{{Prefix: "api", Link: "week", Period: 168 * time.Hour, SubWindows: 7, Step: 24 * time.Hour}}, s.SlidingWindows())
+}
+
+func TestSubnet(t *testing.T) {
+	s, err := Parse([]byte(`
+rules:
+  - prefix: ip
+    subnet: {burst: 100, rate: 10}
+  - prefix: net
+    subnet: {ipv4: 16, ipv6: 48, burst: 100, rate: 10}
+`))
+	require.NoError(t, err)
+	ip, net := s.Match("ip:1").Subnet, s.Match("net:1").Subnet
+	assert.Equal(t, 24, ip.IPv4, "defaults")
+	assert.Equal(t, 64, ip.IPv6, "defaults")
+
+	for key, want := range map[string]string{
+		"ip:203.0.113.7":            "ip:203.0.113.0/24",
+		"ip:2001:db8:1:2:3:4:5:6":   "ip:2001:db8:1:2::/64",
+		"ip:::ffff:203.0.113.7":     "ip:203.0.113.0/24",
+		"203.0.113.7":               "203.0.113.0/24",
+		"ip:acme":                   "",
+		"ip:203.0.113.7:443":        "",
+		"session:2001:db8::1:extra": "",
+	} {
+		assert.Equal(t, want, ip.Network(key), key)
+	}
+	assert.Equal(t, "net:203.0.0.0/16", net.Network("net:203.0.113.7"))
+	assert.Equal(t, "net:2001:db8:1::/48", net.Network("net:2001:db8:1:2::1"))
+	assert.Empty(t, (*Subnet)(nil).Network("ip:203.0.113.7"))
+}
+
+func TestCheckTokens(t *testing.T) {
+	s, err := Parse([]byte("rules:\n  - prefix: api\n    max_tokens: 10\n"))
+	require.NoError(t, err)
+	r := s.Match("api:1")
+	assert.NoError(t, r.CheckTokens(10))
+	assert.ErrorIs(t, r.CheckTokens(10.5), ErrTooManyTokens)
+	assert.NoError(t, s.Match("user:1").CheckTokens(1e9), "nil rule")
+}
+
+func TestWarns(t *testing.T) {
+	s, err := Parse([]byte("rules:\n  - prefix: api\n    soft_limit: 0.8\n  - prefix: user\n"))
+	require.NoError(t, err)
+	r := s.Match("api:1")
+	assert.False(t, r.Warns(3, 10))
+	assert.True(t, r.Warns(2, 10))
+	assert.True(t, r.Warns(0, 10))
+	assert.False(t, s.Match("user:1").Warns(0, 10), "no soft limit")
+	assert.False(t, s.Match("ip:1").Warns(0, 10), "nil rule")
+}
+
+func TestAlerts(t *testing.T) {
+	s, err := Parse([]byte(`
+rules:
+  - prefix: user
+    alerts:
+      - key: user:42
+        threshold: 0.8
+        url: https://hooks.example.com/a
+        debounce: 1m
+      - key_prefix: "user:9"
+        url: https://hooks.example.com/b
+  - prefix: api
+`))
+	require.NoError(t, err)
+	assert.True(t, s.HasAlerts())
+
+	alerts := s.Match("user:1").Alerts
+	require.Len(t, alerts, 2)
+	exact, prefix := alerts[0], alerts[1]
+	assert.Equal(t, time.Minute, exact.Debounce)
+	assert.Equal(t, DefaultDebounce, prefix.Debounce)
+
+	assert.True(t, exact.Watches("user:42"))
+	assert.False(t, exact.Watches("user:420"))
+	assert.True(t, prefix.Watches("user:90"))
+	assert.False(t, prefix.Watches("user:1"))
+
+	assert.True(t, exact.Fires(false, 5, 10), "denials always fire")
+	assert.True(t, exact.Fires(true, 2, 10))
+	assert.False(t, exact.Fires(true, 3, 10))
+	assert.False(t, prefix.Fires(true, 0, 10), "no threshold")
+	assert.True(t, prefix.Fires(false, 0, 10))
+
+	s, err = Parse([]byte("rules:\n  - prefix: api\n"))
+	require.NoError(t, err)
+	assert.False(t, s.HasAlerts())
+}
+
+func TestWindows(t *testing.T) {
+	s, err := Parse([]byte(`
+windows:
+  - name: sunday-import
+    prefixes: [import, batch]
+    days: [sun]
+    start: "02:00"
+    end: "04:00"
+    multiplier: 5
+  - name: nightly
+    prefixes: ["*"]
+    days: [Friday]
+    start: "23:00"
+    end: "01:00"
+    timezone: America/New_York
+    multiplier: 2
+`))
+	require.NoError(t, err)
+
+	sunday := time.Date(2024, 6, 2, 2, 30, 0, 0, time.UTC)
+	require.Equal(t, time.Sunday, sunday.Weekday())
+	w := s.Window("import:1", sunday)
+	require.NotNil(t, w)
+	assert.Equal(t, "sunday-import", w.Name)
+	burst, rate := w.Apply(3, 1.5)
+	assert.Equal(t, int64(15), burst)
+	assert.Equal(t, 7.5, rate)
+	assert.NotNil(t, s.Window("batch:1", sunday))
+	assert.Nil(t, s.Window("user:1", sunday))
+	assert.Nil(t, s.Window("import:1", sunday.Add(2*time.Hour)), "end is exclusive")
+	assert.Nil(t, s.Window("import:1", sunday.AddDate(0, 0, 1)))
+
+	// Crosses midnight in New York, where Saturday 00:30 is 04:30 UTC
+	ny := time.Date(2024, 6, 1, 4, 30, 0, 0, time.UTC)
+	w = s.Window("user:1", ny)
+	require.NotNil(t, w)
+	assert.Equal(t, "nightly", w.Name)
+	assert.NotNil(t, s.Window("user:1", ny.Add(-90*time.Minute)), "Friday 23:00")
+	assert.Nil(t, s.Window("user:1", ny.Add(time.Hour)))
+	assert.Nil(t, s.Window("user:1", ny.AddDate(0, 0, 1)))
+
+	var none *Set
+	assert.Nil(t, none.Window("import:1", sunday))
+
+	for _, in := range []string{
+		"windows:\n  - prefixes: [a]\n    start: \"01:00\"\n    end: \"02:00\"\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    start: \"01:00\"\n    end: \"02:00\"\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    start: \"01:00\"\n    end: \"02:00\"\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    start: \"1am\"\n    end: \"02:00\"\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    start: \"01:00\"\n    end: \"01:00\"\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    days: [someday]\n    start: \"01:00\"\n    end: \"02:00\"\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    start: \"01:00\"\n    end: \"02:00\"\n    timezone: Mars/Olympus\n    multiplier: 2\n",
+		"windows:\n  - name: w\n    prefixes: [a]\n    start: \"01:00\"\n    end: \"02:00\"\n    multiplier: 2\n  - name: w\n    prefixes: [b]\n    start: \"01:00\"\n    end: \"02:00\"\n    multiplier: 2\n",
+	} {
+		_, err := Parse([]byte(in))
+		assert.Error(t, err, in)
+	}
+}
\ No newline at end of file
@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// Window multiplies the limits of some key prefixes on a weekly schedule,
+// e.g. during bulk imports every Sunday 02:00-04:00.
+type Window struct {
+	Name string `yaml:"name"`
+
+	// Key prefixes relaxed during the window ("*" for every key).
+	Prefixes []string `yaml:"prefixes"`
+
+	// Days the window opens ("mon", "tuesday", ...; empty for every day),
+	// from Start to End ("15:04") in Timezone (default UTC). A window
+	// ending before it starts closes the next day.
+	Days     []string `yaml:"days"`
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Timezone string   `yaml:"timezone"`
+
+	// Multiplier scales burst and rate while the window is open.
+	Multiplier float64 `yaml:"multiplier"`
+
+	days       [7]bool
+	start, end int // minutes since midnight
+	loc        *time.Location
+	prefixes   map[string]bool
+}
+
+func (w *Window) validate() error {
+	if w.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(w.Prefixes) == 0 {
+		return errors.New("prefixes are required")
+	}
+	if w.Multiplier <= 0 {
+		return errors.New("multiplier must be positive")
+	}
+	w.prefixes = make(map[string]bool, len(w.Prefixes))
+	for _, p := range w.Prefixes {
+		w.prefixes[p] = true
+	}
+
+	if len(w.Days) == 0 {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+	for _, d := range w.Days {
+		day, ok := weekday(d)
+		if !ok {
+			return fmt.Errorf("unknown day %q", d)
+		}
+		w.days[day] = true
+	}
+
+	var err error
+	if w.start, err = minutes(w.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if w.end, err = minutes(w.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if w.start == w.end {
+		return errors.New("start and end must differ")
+	}
+	if w.loc, err = time.LoadLocation(w.Timezone); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	return nil
+}
+
+// Active reports whether the window is open at now.
+func (w *Window) Active(now time.Time) bool {
+	t := now.In(w.loc)
+	m := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	if w.start < w.end {
+		return w.days[today] && m >= w.start && m < w.end
+	}
+	// Closes the day after it opens
+	yesterday := (today + 6) % 7
+	return (w.days[today] && m >= w.start) || (w.days[yesterday] && m < w.end)
+}
+
+// Apply returns burst and rate multiplied by the window's multiplier.
+func (w *Window) Apply(burst int64, rate float64) (int64, float64) {
+	if w == nil {
+		return burst, rate
+	}
+	return int64(math.Ceil(float64(burst) * w.Multiplier)), rate * w.Multiplier
+}
+
+// Window returns the first window covering key that is open at now, or nil.
+func (s *Set) Window(key string, now time.Time) *Window {
+	if s == nil || len(s.windows) == 0 {
+		return nil
+	}
+	prefix := metrics.KeyPrefix(key)
+	for _, w := range s.windows {
+		if (w.prefixes[prefix] || w.prefixes[Wildcard]) && w.Active(now) {
+			return w
+		}
+	}
+	return nil
+}
+
+func weekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		full := strings.ToLower(d.String())
+		if name == full || name == full[:3] {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// minutes parses "15:04" into minutes since midnight.
+func minutes(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
\ No newline at end of file
@@ -0,0 +1,117 @@
+// Package runtimetune applies latency-oriented Go runtime settings sized to
+// the container the server runs in.
+package runtimetune
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Settings are the runtime settings in effect.
+type Settings struct {
+	GOMAXPROCS  int
+	GOGC        int
+	MemoryLimit int64 // bytes, math.MaxInt64 when unlimited
+}
+
+// Apply sets GOMAXPROCS to the cgroup CPU quota, GOGC to gogc, and the soft
+// memory limit to memRatio of the cgroup memory limit. A higher GOGC means
+// fewer collections and steadier tails; the memory limit makes the
+// collector work harder only when the container nears its limit. Settings
+// given explicitly through GOMAXPROCS, GOGC or GOMEMLIMIT are left alone.
+func Apply(gogc int, memRatio float64) Settings {
+	return apply("/sys/fs/cgroup", gogc, memRatio)
+}
+
+func apply(root string, gogc int, memRatio float64) Settings {
+	if os.Getenv("GOMAXPROCS") == "" {
+		if n, ok := cpuQuota(root); ok {
+			runtime.GOMAXPROCS(n)
+		}
+	}
+	if os.Getenv("GOGC") == "" && gogc > 0 {
+		debug.SetGCPercent(gogc)
+	}
+	if os.Getenv("GOMEMLIMIT") == "" && memRatio > 0 {
+		if limit, ok := memoryLimit(root); ok {
+			debug.SetMemoryLimit(int64(float64(limit) * memRatio))
+		}
+	}
+	return Current()
+}
+
+// Current returns the runtime settings in effect.
+func Current() Settings {
+	gogc := debug.SetGCPercent(-1)
+	debug.SetGCPercent(gogc)
+	return Settings{
+		GOMAXPROCS:  runtime.GOMAXPROCS(0),
+		GOGC:        gogc,
+		MemoryLimit: debug.SetMemoryLimit(-1),
+	}
+}
+
+// cpuQuota returns the cgroup CPU quota rounded up to whole CPUs, reading
+// cgroup v2's cpu.max or v1's cfs files.
+func cpuQuota(root string) (int, bool) {
+	var quota, period float64
+	if b, err := os.ReadFile(filepath.Join(root, "cpu.max")); err == nil {
+		f := strings.Fields(string(b))
+		if len(f) != 2 || f[0] == "max" {
+			return 0, false
+		}
+		quota, _ = strconv.ParseFloat(f[0], 64)
+		period, _ = strconv.ParseFloat(f[1], 64)
+	} else {
+		q, ok := readInt(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+		if !ok || q <= 0 {
+			return 0, false
+		}
+		p, ok := readInt(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+		if !ok {
+			return 0, false
+		}
+		quota, period = float64(q), float64(p)
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, false
+	}
+	n := int(math.Ceil(quota / period))
+	if n > runtime.NumCPU() {
+		n = runtime.NumCPU()
+	}
+	return n, true
+}
+
+// memoryLimit returns the cgroup memory limit, reading cgroup v2's
+// memory.max or v1's memory.limit_in_bytes.
+func memoryLimit(root string) (int64, bool) {
+	if b, err := os.ReadFile(filepath.Join(root, "memory.max")); err == nil {
+		s := strings.TrimSpace(string(b))
+		if s == "max" {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, err == nil && n > 0
+	}
+	n, ok := readInt(filepath.Join(root, "memory", "memory.limit_in_bytes"))
+	// v1 reports "unlimited" as a huge page-aligned number.
+	if !ok || n <= 0 || n >= math.MaxInt64/2 {
+		return 0, false
+	}
+	return n, true
+}
+
+func readInt(path string) (int64, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return n, err == nil
+}
\ No newline at end of file
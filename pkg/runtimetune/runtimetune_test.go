@@ -0,0 +1,89 @@
+package runtimetune
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestCPUQuota(t *testing.T) {
+	v2 := t.TempDir()
+	writeFile(t, filepath.Join(v2, "cpu.max"), "150000 100000\n")
+	n, ok := cpuQuota(v2)
+	require.True(t, ok)
+	assert.Equal(t, min(2, runtime.NumCPU()), n, "rounds up to whole CPUs")
+
+	unlimited := t.TempDir()
+	writeFile(t, filepath.Join(unlimited, "cpu.max"), "max 100000\n")
+	_, ok = cpuQuota(unlimited)
+	assert.False(t, ok)
+
+	v1 := t.TempDir()
+	writeFile(t, filepath.Join(v1, "cpu", "cpu.cfs_quota_us"), "100000\n")
+	writeFile(t, filepath.Join(v1, "cpu", "cpu.cfs_period_us"), "100000\n")
+	n, ok = cpuQuota(v1)
+	require.True(t, ok)
+	assert.Equal(t, 1, n)
+
+	writeFile(t, filepath.Join(v1, "cpu", "cpu.cfs_quota_us"), "-1\n")
+	_, ok = cpuQuota(v1)
+	assert.False(t, ok)
+
+	_, ok = cpuQuota(t.TempDir())
+	assert.False(t, ok)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	v2 := t.TempDir()
+	writeFile(t, filepath.Join(v2, "memory.max"), "536870912\n")
+	n, ok := memoryLimit(v2)
+	require.True(t, ok)
+	assert.Equal(t, int64(512<<20), n)
+
+	writeFile(t, filepath.Join(v2, "memory.max"), "max\n")
+	_, ok = memoryLimit(v2)
+	assert.False(t, ok)
+
+	v1 := t.TempDir()
+	writeFile(t, filepath.Join(v1, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	_, ok = memoryLimit(v1)
+	assert.False(t, ok, "v1 reports no limit as a huge value")
+}
+
+func TestApply(t *testing.T) {
+	t.Setenv("GOMAXPROCS", "")
+	t.Setenv("GOGC", "")
+	t.Setenv("GOMEMLIMIT", "")
+	before := Current()
+	defer func() {
+		runtime.GOMAXPROCS(before.GOMAXPROCS)
+		debug.SetGCPercent(before.GOGC)
+		debug.SetMemoryLimit(before.MemoryLimit)
+	}()
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cpu.max"), "100000 100000\n")
+	writeFile(t, filepath.Join(root, "memory.max"), "1000000000\n")
+
+	s := apply(root, 400, 0.9)
+	assert.Equal(t, 1, s.GOMAXPROCS)
+	assert.Equal(t, 400, s.GOGC)
+	assert.Equal(t, int64(900000000), s.MemoryLimit)
+
+	// Explicit settings win.
+	t.Setenv("GOGC", "100")
+	debug.SetGCPercent(100)
+	s = apply(root, 400, 0.9)
+	assert.Equal(t, 100, s.GOGC)
+}
\ No newline at end of file
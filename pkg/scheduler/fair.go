@@ -0,0 +1,129 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+)
+
+// WeightFunc returns the scheduling weight of a tenant (grants per round).
+type WeightFunc func(tenant string) int
+
+type waiter struct {
+	ready     chan struct{}
+	granted   bool
+	cancelled bool
+}
+
+// Fair bounds the number of in-flight Redis calls. Below the bound callers
+// proceed immediately; once saturated they queue per tenant and freed slots
+// are handed out weighted round robin, so one tenant's spike can't starve
+// the others' limiter checks.
+type Fair struct {
+	max    int
+	weight WeightFunc
+
+	mu       sync.Mutex
+	inflight int
+	queues   map[string][]*waiter
+	active   []string // tenants with queued waiters, in round-robin order
+	pos      int      // index into active of the tenant being served
+	credit   int      // grants left for active[pos] in this round
+}
+
+// NewFair creates a scheduler allowing maxInFlight concurrent calls.
+// weight may be nil, in which case every tenant has weight 1.
+func NewFair(maxInFlight int, weight WeightFunc) *Fair {
+	if weight == nil {
+		weight = func(string) int { return 1 }
+	}
+	return &Fair{
+		max:    maxInFlight,
+		weight: weight,
+		queues: map[string][]*waiter{},
+		pos:    -1,
+	}
+}
+
+// Acquire waits for a slot on behalf of tenant. The returned func must be
+// called exactly once when the Redis work is done.
+func (f *Fair) Acquire(ctx context.Context, tenant string) (func(), error) {
+	f.mu.Lock()
+	if f.inflight < f.max && len(f.active) == 0 {
+		f.inflight++
+		f.mu.Unlock()
+		return f.release, nil
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	q, ok := f.queues[tenant]
+	if !ok {
+		f.active = append(f.active, tenant)
+	}
+	f.queues[tenant] = append(q, w)
+	f.mu.Unlock()
+	metrics.SchedulerQueued.Inc()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		metrics.SchedulerWait.Observe(time.Since(start).Seconds())
+		return f.release, nil
+	case <-ctx.Done():
+		f.mu.Lock()
+		granted := w.granted
+		w.cancelled = true
+		f.mu.Unlock()
+		if granted {
+			f.release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (f *Fair) release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inflight--
+	if w := f.next(); w != nil {
+		f.inflight++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// next pops the next live waiter in weighted round-robin order.
+func (f *Fair) next() *waiter {
+	for len(f.active) > 0 {
+		if f.credit <= 0 {
+			f.pos = (f.pos + 1) % len(f.active)
+			f.credit = f.weight(f.active[f.pos])
+			if f.credit < 1 {
+				f.credit = 1
+			}
+		}
+
+		tenant := f.active[f.pos]
+		q := f.queues[tenant]
+		w := q[0]
+		f.credit--
+		metrics.SchedulerQueued.Dec()
+
+		if len(q) == 1 {
+			delete(f.queues, tenant)
+			f.active = append(f.active[:f.pos], f.active[f.pos+1:]...)
+			f.pos-- // the next advance lands on the tenant that moved into pos
+			f.credit = 0
+		} else {
+			q[0] = nil
+			f.queues[tenant] = q[1:]
+		}
+
+		if !w.cancelled {
+			return w
+		}
+	}
+	return nil
+}
\ No newline at end of file
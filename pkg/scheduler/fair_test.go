@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// enqueue starts n goroutines for tenant that record the order in which
+// they are granted a slot, and waits until all of them are queued.
+func enqueue(t *testing.T, f *Fair, tenant string, n int, order *[]string, mu *sync.Mutex, wg *sync.WaitGroup) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := f.Acquire(context.Background(), tenant)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			*order = append(*order, tenant)
+			mu.Unlock()
+			release()
+		}()
+	}
+	require.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return len(f.queues[tenant]) == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestFair_RoundRobin(t *testing.T) {
+	f := NewFair(1, nil)
+
+	// Occupy the only slot so everything else queues
+	hold, err := f.Acquire(context.Background(), "noisy")
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		order []string
+	)
+	enqueue(t, f, "noisy", 6, &order, &mu, &wg)
+	enqueue(t, f, "quiet", 2, &order, &mu, &wg)
+
+	hold()
+	wg.Wait()
+
+	// quiet is served every other grant despite queuing behind noisy
+	assert.Equal(t, []string{"noisy", "quiet", "noisy", "quiet", "noisy", "noisy", "noisy", "noisy"}, order)
+}
+
+func TestFair_Weighted(t *testing.T) {
+	f := NewFair(1, func(tenant string) int {
+		if tenant == "gold" {
+			return 3
+		}
+		return 1
+	})
+
+	hold, err := f.Acquire(context.Background(), "x")
+	require.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		order []string
+	)
+	enqueue(t, f, "free", 3, &order, &mu, &wg)
+	enqueue(t, f, "gold", 4, &order, &mu, &wg)
+
+	hold()
+	wg.Wait()
+
+	assert.Equal(t, []string{"free", "gold", "gold", "gold", "free", "gold", "free"}, order)
+}
+
+func TestFair_Cancelled(t *testing.T) {
+	f := NewFair(1, nil)
+	hold, err := f.Acquire(context.Background(), "a")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.Acquire(ctx, "b")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The cancelled waiter is skipped and the slot becomes free again
+	hold()
+	release, err := f.Acquire(context.Background(), "c")
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, 0, f.inflight)
+}
\ No newline at end of file
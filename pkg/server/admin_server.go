@@ -0,0 +1,912 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/anomaly"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/chaos"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/denylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/diag"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keytrace"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/loglevel"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/maintenance"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/whatif"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// AdminServer implements the gRPC AdminService.
+type AdminServer struct {
+	pb.UnimplementedAdminServiceServer
+	limiter *limiter.TokenBucket
+	tenants *tenant.Registry
+	usage   *usage.Recorder
+	boosts  *boost.Registry
+
+	clientUsage *usage.Recorder
+	faults      *chaos.Hook
+	maint       *maintenance.Mode
+	logs        *loglevel.Control
+	rules       *rules.Set
+	prefixUsage *usage.PrefixRecorder
+	diag        *diag.Dumper
+	traces      *keytrace.Registry
+	history     *keytrace.History
+	deny        *denylist.Set
+
+	// Directory whose SHA256SUMS pins the sources ReloadScript accepts
+	// ("" = reloads disabled)
+	scriptsDir string
+	// Namespace of keys given without one, as on the RateLimitService
+	defaultNamespace string
+	// Holds the anomaly detector's audit records (nil = detection disabled)
+	anomalies *redis.Client
+}
+
+// AdminOption configures an AdminServer.
+type AdminOption func(*AdminServer)
+
+// WithScriptReloads enables ReloadScript, for sources pinned in dir's
+// SHA256SUMS, as LUA_SCRIPTS_DIR overrides are.
+func WithScriptReloads(dir string) AdminOption {
+	return func(s *AdminServer) { s.scriptsDir = dir }
+}
+
+// WithAdminDefaultNamespace sets the namespace of keys given without one,
+// so that boosts, traces, the denylist and bucket lookups address the
+// buckets the RateLimitService charges.
+func WithAdminDefaultNamespace(ns string) AdminOption {
+	return func(s *AdminServer) { s.defaultNamespace = ns }
+}
+
+// WithAnomalyAudit enables ListAnomalies, for the audit records the
+// anomaly detector keeps in rdb.
+func WithAnomalyAudit(rdb *redis.Client) AdminOption {
+	return func(s *AdminServer) { s.anomalies = rdb }
+}
+
+// NewAdminServer creates a new admin server. clientUsage may be nil when
+// API quotas are disabled, faults unless fault injection may be changed
+// at runtime, and logs unless the log level may be. ruleSet and
+// prefixUsage are the current rules and traffic that PreviewRules
+// compares candidate rules against, dumper takes DumpDiagnostics'
+// snapshots, traces holds the keys whose decisions are logged, history
+// (nil when disabled) keeps their last decisions, and deny is the
+// denylist.
+func NewAdminServer(l *limiter.TokenBucket, tenants *tenant.Registry, u *usage.Recorder, boosts *boost.Registry, clientUsage *usage.Recorder, faults *chaos.Hook, maint *maintenance.Mode, logs *loglevel.Control, ruleSet *rules.Set, prefixUsage *usage.PrefixRecorder, dumper *diag.Dumper, traces *keytrace.Registry, history *keytrace.History, deny *denylist.Set, opts ...AdminOption) *AdminServer {
+	s := &AdminServer{limiter: l, tenants: tenants, usage: u, boosts: boosts, clientUsage: clientUsage, faults: faults, maint: maint, logs: logs, rules: ruleSet, prefixUsage: prefixUsage, diag: dumper, traces: traces, history: history, deny: deny}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *AdminServer) GetTenantUsage(ctx context.Context, req *pb.GetTenantUsageRequest) (*pb.GetTenantUsageResponse, error) {
+	if req.Namespace == "" {
+		return nil, status.Error(codes.InvalidArgument, "namespace is required")
+	}
+
+	records, err := queryUsage(ctx, s.usage, req.Namespace, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetTenantUsageResponse{Namespace: req.Namespace, Usage: records}, nil
+}
+
+func (s *AdminServer) GetClientUsage(ctx context.Context, req *pb.GetClientUsageRequest) (*pb.GetClientUsageResponse, error) {
+	if req.Client == "" {
+		return nil, status.Error(codes.InvalidArgument, "client is required")
+	}
+	if s.clientUsage == nil {
+		return nil, status.Error(codes.FailedPrecondition, "API usage is only recorded when request signing is enabled")
+	}
+
+	records, err := queryUsage(ctx, s.clientUsage, req.Client, req.Start, req.End)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetClientUsageResponse{Client: req.Client, Usage: records}, nil
+}
+
+// queryUsage returns the hourly usage of name between the unix timestamps
+// start and end, defaulting to the last 24 hours.
+func queryUsage(ctx context.Context, r *usage.Recorder, name string, start, end int64) ([]*pb.TenantUsage, error) {
+	to := time.Now()
+	if end > 0 {
+		to = time.Unix(end, 0)
+	}
+	from := to.Add(-24 * time.Hour)
+	if start > 0 {
+		from = time.Unix(start, 0)
+	}
+
+	records, err := r.Query(ctx, name, from, to)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "usage query failed: %v", err)
+	}
+
+	var out []*pb.TenantUsage
+	for _, rec := range records {
+		out = append(out, &pb.TenantUsage{
+			Hour:           rec.Hour.Unix(),
+			TokensConsumed: rec.Tokens,
+			Allowed:        rec.Allowed,
+			Denied:         rec.Denied,
+		})
+	}
+	return out, nil
+}
+
+func (s *AdminServer) CreateTenant(ctx context.Context, req *pb.CreateTenantRequest) (*pb.Tenant, error) {
+	t, err := tenantFromPB(req.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tenants.Create(ctx, t); err != nil {
+		return nil, tenantError(err)
+	}
+	return tenantToPB(t), nil
+}
+
+func (s *AdminServer) GetTenant(ctx context.Context, req *pb.GetTenantRequest) (*pb.Tenant, error) {
+	t, err := s.tenants.Load(ctx, req.Name)
+	if err != nil {
+		return nil, tenantError(err)
+	}
+	return tenantToPB(t), nil
+}
+
+func (s *AdminServer) ListTenants(ctx context.Context, _ *pb.ListTenantsRequest) (*pb.ListTenantsResponse, error) {
+	if err := s.tenants.Refresh(ctx); err != nil {
+		return nil, tenantError(err)
+	}
+	list := s.tenants.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	resp := &pb.ListTenantsResponse{}
+	for _, t := range list {
+		resp.Tenants = append(resp.Tenants, tenantToPB(t))
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) UpdateTenant(ctx context.Context, req *pb.UpdateTenantRequest) (*pb.Tenant, error) {
+	t, err := tenantFromPB(req.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tenants.Update(ctx, t); err != nil {
+		return nil, tenantError(err)
+	}
+	return tenantToPB(t), nil
+}
+
+func (s *AdminServer) SuspendTenant(ctx context.Context, req *pb.SuspendTenantRequest) (*pb.Tenant, error) {
+	t, err := s.tenants.Load(ctx, req.Name)
+	if err != nil {
+		return nil, tenantError(err)
+	}
+	t.Suspended = req.Suspended
+	if err := s.tenants.Put(ctx, t); err != nil {
+		return nil, tenantError(err)
+	}
+	return tenantToPB(t), nil
+}
+
+func (s *AdminServer) DeleteTenant(ctx context.Context, req *pb.DeleteTenantRequest) (*pb.DeleteTenantResponse, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := s.tenants.Delete(ctx, req.Name); err != nil {
+		return nil, tenantError(err)
+	}
+
+	if err := s.revokeNamespaceBoosts(ctx, req.Name); err != nil {
+		return nil, status.Errorf(codes.Internal, "tenant deleted but boost cleanup failed: %v", err)
+	}
+	n, err := s.limiter.DeleteNamespace(ctx, req.Name)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "tenant deleted but bucket cleanup failed after %d keys: %v", n, err)
+	}
+	return &pb.DeleteTenantResponse{DeletedKeys: n}, nil
+}
+
+// revokeNamespaceBoosts revokes the boosts of namespace and of its keys,
+// so that a tenant created again under the name doesn't inherit them.
+func (s *AdminServer) revokeNamespaceBoosts(ctx context.Context, namespace string) error {
+	if err := s.boosts.Refresh(ctx); err != nil {
+		return err
+	}
+	tenant := limiter.TenantKey(namespace)
+	for _, b := range s.boosts.List() {
+		if b.Target != tenant && !strings.HasPrefix(b.Target, tenant+":") {
+			continue
+		}
+		if _, err := s.boosts.Revoke(ctx, b.Target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AdminServer) GrantBoost(ctx context.Context, req *pb.GrantBoostRequest) (*pb.Boost, error) {
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	if req.DurationSeconds <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration_seconds must be positive")
+	}
+	if req.Multiplier < 0 || req.ExtraBurst < 0 || req.ExtraRate < 0 {
+		return nil, status.Error(codes.InvalidArgument, "boost must not be negative")
+	}
+	if req.Multiplier == 0 && req.ExtraBurst == 0 && req.ExtraRate == 0 {
+		return nil, status.Error(codes.InvalidArgument, "boost needs a multiplier or extra burst/rate")
+	}
+
+	b := &boost.Boost{
+		Target:     target,
+		Multiplier: req.Multiplier,
+		ExtraBurst: req.ExtraBurst,
+		ExtraRate:  req.ExtraRate,
+		ExpiresAt:  time.Now().Add(time.Duration(req.DurationSeconds) * time.Second),
+	}
+	if err := s.boosts.Grant(ctx, b); err != nil {
+		return nil, status.Errorf(codes.Internal, "boost store: %v", err)
+	}
+	return boostToPB(b), nil
+}
+
+func (s *AdminServer) RevokeBoost(ctx context.Context, req *pb.RevokeBoostRequest) (*pb.RevokeBoostResponse, error) {
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.boosts.Revoke(ctx, target)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "boost store: %v", err)
+	}
+	return &pb.RevokeBoostResponse{Revoked: ok}, nil
+}
+
+func (s *AdminServer) ListBoosts(ctx context.Context, _ *pb.ListBoostsRequest) (*pb.ListBoostsResponse, error) {
+	if err := s.boosts.Refresh(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "boost store: %v", err)
+	}
+	list := s.boosts.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+
+	resp := &pb.ListBoostsResponse{}
+	for _, b := range list {
+		resp.Boosts = append(resp.Boosts, boostToPB(b))
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) ListAnomalies(ctx context.Context, req *pb.ListAnomaliesRequest) (*pb.ListAnomaliesResponse, error) {
+	if s.anomalies == nil {
+		return nil, status.Error(codes.FailedPrecondition, "anomaly detection is disabled on this server")
+	}
+	limit := int64(req.Limit)
+	if limit <= 0 {
+		limit = 100
+	}
+	limit = min(limit, anomaly.AuditLen)
+
+	records, err := anomaly.Records(ctx, s.anomalies, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "anomaly store: %v", err)
+	}
+	resp := &pb.ListAnomaliesResponse{}
+	for _, r := range records {
+		resp.Anomalies = append(resp.Anomalies, &pb.Anomaly{
+			Key:        r.Key,
+			Rate:       r.Rate,
+			Baseline:   r.Baseline,
+			Multiplier: r.Multiplier,
+			DetectedAt: r.DetectedAt.Unix(),
+			ExpiresAt:  r.ExpiresAt.Unix(),
+			Host:       r.Host,
+		})
+	}
+	return resp, nil
+}
+
+// maxTrace bounds how long a key is traced, so a forgotten trace doesn't
+// flood the logs for good.
+const maxTrace = 24 * time.Hour
+
+var errNoTraces = status.Error(codes.FailedPrecondition, "key tracing is disabled on this server")
+
+func (s *AdminServer) TraceKey(ctx context.Context, req *pb.TraceKeyRequest) (*pb.KeyTrace, error) {
+	if s.traces == nil {
+		return nil, errNoTraces
+	}
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	d := time.Duration(req.DurationSeconds) * time.Second
+	if d <= 0 || d > maxTrace {
+		return nil, status.Errorf(codes.InvalidArgument, "duration_seconds must be between 1 and %d", int64(maxTrace/time.Second))
+	}
+
+	t := &keytrace.Trace{Target: target, ExpiresAt: time.Now().Add(d), Reason: req.Reason}
+	if err := s.traces.Start(ctx, t); err != nil {
+		return nil, status.Errorf(codes.Internal, "trace store: %v", err)
+	}
+	log.Printf("Tracing decisions on %s until %s: %s", target, t.ExpiresAt.Format(time.RFC3339), t.Reason)
+	return traceToPB(t), nil
+}
+
+func (s *AdminServer) UntraceKey(ctx context.Context, req *pb.UntraceKeyRequest) (*pb.UntraceKeyResponse, error) {
+	if s.traces == nil {
+		return nil, errNoTraces
+	}
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.traces.Stop(ctx, target)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "trace store: %v", err)
+	}
+	return &pb.UntraceKeyResponse{Untraced: ok}, nil
+}
+
+func (s *AdminServer) ListKeyTraces(ctx context.Context, _ *pb.ListKeyTracesRequest) (*pb.ListKeyTracesResponse, error) {
+	if s.traces == nil {
+		return nil, errNoTraces
+	}
+	if err := s.traces.Refresh(ctx); err != nil {
+		return nil, status.Errorf(codes.Internal, "trace store: %v", err)
+	}
+	list := s.traces.List()
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+
+	resp := &pb.ListKeyTracesResponse{}
+	for _, t := range list {
+		resp.Traces = append(resp.Traces, traceToPB(t))
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) GetDecisionHistory(ctx context.Context, req *pb.GetDecisionHistoryRequest) (*pb.DecisionHistory, error) {
+	if s.history == nil {
+		return nil, status.Error(codes.FailedPrecondition, "decision history is disabled on this server")
+	}
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 100
+	}
+	limit = min(limit, s.history.Size())
+
+	decisions, err := s.history.Query(ctx, target, limit)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "history store: %v", err)
+	}
+	resp := &pb.DecisionHistory{}
+	for _, d := range decisions {
+		resp.Decisions = append(resp.Decisions, &pb.Decision{
+			AtMs:       d.Time.UnixMilli(),
+			Tokens:     d.Tokens,
+			Allowed:    d.Allowed,
+			Remaining:  d.Remaining,
+			Limit:      d.Limit,
+			RetryAfter: d.RetryAfter,
+		})
+	}
+	return resp, nil
+}
+
+// maxDenylistChunk bounds the entries of one AddDenylistEntries or
+// RemoveDenylistEntries call, so large lists go to Redis in chunks.
+const maxDenylistChunk = 10000
+
+func (s *AdminServer) AddDenylistEntries(ctx context.Context, req *pb.AddDenylistEntriesRequest) (*pb.AddDenylistEntriesResponse, error) {
+	if s.deny == nil {
+		return nil, errNoDenylist
+	}
+	if len(req.Entries) > maxDenylistChunk {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d entries per call", maxDenylistChunk)
+	}
+	entries := make([]denylist.Entry, len(req.Entries))
+	for i, e := range req.Entries {
+		key, err := s.denylistKey(req.Namespace, e.Key)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "entry %d: %v", i, err)
+		}
+		entries[i].Key = key
+		if e.ExpiresAt > 0 {
+			entries[i].ExpiresAt = time.Unix(e.ExpiresAt, 0)
+		}
+	}
+
+	added, err := s.deny.Add(ctx, entries)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "denylist store: %v", err)
+	}
+	return &pb.AddDenylistEntriesResponse{Added: added, Total: int64(s.deny.Len())}, nil
+}
+
+func (s *AdminServer) RemoveDenylistEntries(ctx context.Context, req *pb.RemoveDenylistEntriesRequest) (*pb.RemoveDenylistEntriesResponse, error) {
+	if s.deny == nil {
+		return nil, errNoDenylist
+	}
+	if len(req.Keys) > maxDenylistChunk {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d keys per call", maxDenylistChunk)
+	}
+	keys := make([]string, len(req.Keys))
+	for i, k := range req.Keys {
+		key, err := s.denylistKey(req.Namespace, k)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "key %d: %v", i, err)
+		}
+		keys[i] = key
+	}
+
+	removed, err := s.deny.Remove(ctx, keys)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "denylist store: %v", err)
+	}
+	return &pb.RemoveDenylistEntriesResponse{Removed: removed}, nil
+}
+
+var errNoDenylist = status.Error(codes.FailedPrecondition, "the denylist is disabled on this server")
+
+// denylistKey returns the bucket key a denylist entry applies to.
+func (s *AdminServer) denylistKey(namespace, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key is required")
+	}
+	if namespace == "" {
+		namespace = s.defaultNamespace
+	}
+	if err := limiter.ValidateKey(namespace, key); err != nil {
+		return "", err
+	}
+	return limiter.Key(namespace, key), nil
+}
+
+func traceToPB(t *keytrace.Trace) *pb.KeyTrace {
+	ns, key := limiter.SplitKey(t.Target)
+	return &pb.KeyTrace{Namespace: ns, Key: key, ExpiresAt: t.ExpiresAt.Unix(), Reason: t.Reason}
+}
+
+func (s *AdminServer) GetFaults(context.Context, *pb.GetFaultsRequest) (*pb.Faults, error) {
+	if s.faults == nil {
+		return nil, errFaultsDisabled
+	}
+	return faultsToPB(s.faults.Config()), nil
+}
+
+func (s *AdminServer) SetFaults(_ context.Context, req *pb.SetFaultsRequest) (*pb.Faults, error) {
+	if s.faults == nil {
+		return nil, errFaultsDisabled
+	}
+	cfg, err := faultsFromPB(req.Faults)
+	if err != nil {
+		return nil, err
+	}
+	s.faults.Set(cfg)
+	if cfg.Enabled() {
+		log.Printf("WARNING: Redis faults changed through the AdminService: %+v", cfg)
+	} else {
+		log.Printf("Redis faults cleared through the AdminService")
+	}
+	return faultsToPB(cfg), nil
+}
+
+var errFaultsDisabled = status.Error(codes.FailedPrecondition, "fault injection is only available with CHAOS_ADMIN=true")
+
+func faultsFromPB(p *pb.Faults) (chaos.Config, error) {
+	if p == nil {
+		return chaos.Config{}, nil
+	}
+	if p.LatencyMs < 0 || p.PartitionEveryMs < 0 || p.PartitionForMs < 0 {
+		return chaos.Config{}, status.Error(codes.InvalidArgument, "fault durations must not be negative")
+	}
+	for _, rate := range []float64{p.LatencyRate, p.ErrorRate, p.ScriptErrorRate} {
+		if rate < 0 || rate > 1 {
+			return chaos.Config{}, status.Error(codes.InvalidArgument, "fault rates must be between 0 and 1")
+		}
+	}
+	return chaos.Config{
+		Down:            p.RedisDown,
+		Latency:         time.Duration(p.LatencyMs) * time.Millisecond,
+		LatencyRate:     p.LatencyRate,
+		ErrorRate:       p.ErrorRate,
+		ScriptErrorRate: p.ScriptErrorRate,
+		PartitionEvery:  time.Duration(p.PartitionEveryMs) * time.Millisecond,
+		PartitionFor:    time.Duration(p.PartitionForMs) * time.Millisecond,
+	}, nil
+}
+
+func faultsToPB(c chaos.Config) *pb.Faults {
+	return &pb.Faults{
+		RedisDown:        c.Down,
+		LatencyMs:        c.Latency.Milliseconds(),
+		LatencyRate:      c.LatencyRate,
+		ErrorRate:        c.ErrorRate,
+		ScriptErrorRate:  c.ScriptErrorRate,
+		PartitionEveryMs: c.PartitionEvery.Milliseconds(),
+		PartitionForMs:   c.PartitionFor.Milliseconds(),
+	}
+}
+
+// defaultDeleteRate is the deletion rate cap of DeleteBuckets, in keys per
+// second per Redis node, when the request doesn't set one.
+const defaultDeleteRate = 5000
+
+func (s *AdminServer) DeleteBuckets(ctx context.Context, req *pb.DeleteBucketsRequest) (*pb.DeleteBucketsResponse, error) {
+	if req.KeysPerSecond < 0 {
+		return nil, status.Error(codes.InvalidArgument, "keys_per_second must not be negative")
+	}
+	opts := limiter.BulkDelete{
+		KeysPerSecond: int(req.KeysPerSecond),
+		Quotas:        req.Quotas,
+		DryRun:        req.DryRun,
+	}
+	if opts.KeysPerSecond == 0 {
+		opts.KeysPerSecond = defaultDeleteRate
+	}
+
+	n, err := s.limiter.DeletePrefix(ctx, req.Namespace, req.Prefix, opts)
+	switch {
+	case errors.Is(err, limiter.ErrNoPrefix), errors.Is(err, limiter.ErrInvalidNamespace), errors.Is(err, limiter.ErrReservedKey):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "bucket deletion stopped after %d keys: %v", n, err)
+	}
+	if !req.DryRun {
+		log.Printf("Deleted %d bucket keys of namespace %q with prefix %q through the AdminService", n, req.Namespace, req.Prefix)
+	}
+	return &pb.DeleteBucketsResponse{Keys: n}, nil
+}
+
+func (s *AdminServer) MigrateBuckets(ctx context.Context, req *pb.MigrateBucketsRequest) (*pb.MigrateBucketsResponse, error) {
+	if req.KeysPerSecond < 0 {
+		return nil, status.Error(codes.InvalidArgument, "keys_per_second must not be negative")
+	}
+	if req.Pattern == "" {
+		return nil, status.Error(codes.InvalidArgument, "pattern is required")
+	}
+	re, err := regexp.Compile(req.Pattern)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "pattern: %v", err)
+	}
+	m := limiter.Migration{
+		Rename:        regexpRename(re, req.Replacement),
+		KeysPerSecond: int(req.KeysPerSecond),
+		Quotas:        req.Quotas,
+		DryRun:        req.DryRun,
+	}
+	if m.KeysPerSecond == 0 {
+		m.KeysPerSecond = defaultDeleteRate
+	}
+
+	res, err := s.limiter.MigratePrefix(ctx, req.Namespace, req.Prefix, m)
+	switch {
+	case errors.Is(err, limiter.ErrNoPrefix), errors.Is(err, limiter.ErrInvalidNamespace), errors.Is(err, limiter.ErrReservedKey):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "bucket migration stopped after %d keys: %v", res.Moved, err)
+	}
+	if !req.DryRun {
+		log.Printf("Migrated %d bucket keys of namespace %q with prefix %q through the AdminService (%d skipped)", res.Moved, req.Namespace, req.Prefix, res.Skipped)
+	}
+	return &pb.MigrateBucketsResponse{Moved: res.Moved, Skipped: res.Skipped}, nil
+}
+
+// regexpRename renames keys by replacing the first match of re with
+// replacement, expanded as by regexp.Regexp.Expand.
+func regexpRename(re *regexp.Regexp, replacement string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		m := re.FindStringSubmatchIndex(key)
+		if m == nil {
+			return "", false
+		}
+		to := re.ExpandString([]byte(key[:m[0]]), replacement, key, m)
+		return string(to) + key[m[1]:], true
+	}
+}
+
+func (s *AdminServer) InspectBucket(ctx context.Context, req *pb.InspectBucketRequest) (*pb.BucketState, error) {
+	target, err := s.bucketTarget(req.Namespace, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.limiter.Inspect(ctx, target)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "bucket %s: %v", target, err)
+	}
+	resp := &pb.BucketState{
+		Exists:    st.Exists,
+		Algorithm: st.Algorithm,
+		Tokens:    st.Tokens,
+		TtlMs:     st.TTL.Milliseconds(),
+		RedisTime: unixSeconds(st.RedisTime),
+		Fields:    st.Fields,
+	}
+	if st.Exists {
+		resp.LastRefill = unixSeconds(st.LastRefill)
+	}
+	if !st.Created.IsZero() {
+		resp.Created = unixSeconds(st.Created)
+	}
+	if !st.LastConsumed.IsZero() {
+		resp.LastConsumed = unixSeconds(st.LastConsumed)
+	}
+	return resp, nil
+}
+
+// unixSeconds returns t as fractional Unix seconds.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+func (s *AdminServer) GetMaintenance(context.Context, *pb.GetMaintenanceRequest) (*pb.Maintenance, error) {
+	return maintenanceToPB(s.maint.State()), nil
+}
+
+func (s *AdminServer) SetMaintenance(ctx context.Context, req *pb.SetMaintenanceRequest) (*pb.Maintenance, error) {
+	if !req.Enabled {
+		if err := s.maint.Disable(ctx); err != nil {
+			return nil, status.Errorf(codes.Internal, "maintenance store: %v", err)
+		}
+		return maintenanceToPB(nil), nil
+	}
+	if req.Reason == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+	st, err := s.maint.Enable(ctx, req.Reason)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "maintenance store: %v", err)
+	}
+	return maintenanceToPB(st), nil
+}
+
+func maintenanceToPB(st *maintenance.State) *pb.Maintenance {
+	if st == nil {
+		return &pb.Maintenance{}
+	}
+	return &pb.Maintenance{Enabled: true, Reason: st.Reason, Since: st.Since.Unix()}
+}
+
+// bucketTarget returns the identifier of key's bucket in namespace, the
+// default namespace when empty, or of the namespace's aggregate bucket when
+// key is empty. Boosts are registered under it too.
+func (s *AdminServer) bucketTarget(namespace, key string) (string, error) {
+	if namespace == "" {
+		namespace = s.defaultNamespace
+	}
+	if key == "" {
+		if namespace == "" {
+			return "", status.Error(codes.InvalidArgument, "namespace or key is required")
+		}
+		if err := limiter.ValidateKey(namespace, ""); err != nil {
+			return "", status.Error(codes.InvalidArgument, err.Error())
+		}
+		return limiter.TenantKey(namespace), nil
+	}
+	if err := limiter.ValidateKey(namespace, key); err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return limiter.Key(namespace, key), nil
+}
+
+func boostToPB(b *boost.Boost) *pb.Boost {
+	if b == nil {
+		return nil
+	}
+	ns, key := limiter.SplitKey(b.Target)
+	return &pb.Boost{
+		Namespace:  ns,
+		Key:        key,
+		Multiplier: b.Multiplier,
+		ExtraBurst: b.ExtraBurst,
+		ExtraRate:  b.ExtraRate,
+		ExpiresAt:  b.ExpiresAt.Unix(),
+		Reason:     b.Reason,
+	}
+}
+
+func tenantFromPB(p *pb.Tenant) (*tenant.Tenant, error) {
+	if p == nil || p.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "tenant name is required")
+	}
+	if err := limiter.ValidateKey(p.Name, ""); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if p.Burst < 0 || p.Rate < 0 || p.QuotaLimit < 0 || p.QuotaPeriodSeconds < 0 || p.CapBurst < 0 || p.CapRate < 0 || p.Weight < 0 {
+		return nil, status.Error(codes.InvalidArgument, "tenant limits must not be negative")
+	}
+	if p.QuotaRollover < 0 || p.QuotaRollover > 1 {
+		return nil, status.Error(codes.InvalidArgument, "quota rollover must be between 0 and 1")
+	}
+	return &tenant.Tenant{
+		Name:          p.Name,
+		Burst:         p.Burst,
+		Rate:          p.Rate,
+		QuotaLimit:    p.QuotaLimit,
+		QuotaPeriod:   time.Duration(p.QuotaPeriodSeconds) * time.Second,
+		QuotaRollover: p.QuotaRollover,
+		CapBurst:      p.CapBurst,
+		CapRate:       p.CapRate,
+		Suspended:     p.Suspended,
+		Weight:        int(p.Weight),
+	}, nil
+}
+
+func tenantToPB(t *tenant.Tenant) *pb.Tenant {
+	return &pb.Tenant{
+		Name:               t.Name,
+		Burst:              t.Burst,
+		Rate:               t.Rate,
+		QuotaLimit:         t.QuotaLimit,
+		QuotaPeriodSeconds: int64(t.QuotaPeriod / time.Second),
+		QuotaRollover:      t.QuotaRollover,
+		CapBurst:           t.CapBurst,
+		CapRate:            t.CapRate,
+		Suspended:          t.Suspended,
+		Weight:             int32(t.Weight),
+	}
+}
+
+func tenantError(err error) error {
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, tenant.ErrExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return status.Errorf(codes.Internal, "tenant store: %v", err)
+	}
+}
+func (s *AdminServer) ReloadScript(ctx context.Context, req *pb.ReloadScriptRequest) (*pb.ReloadScriptResponse, error) {
+	if s.scriptsDir == "" {
+		return nil, status.Error(codes.FailedPrecondition, "script reloads are only available with SCRIPT_RELOAD_ADMIN=true")
+	}
+	if req.Name == "" || req.Source == "" {
+		return nil, status.Error(codes.InvalidArgument, "name and source are required")
+	}
+	// Only versions reviewed into the pins run, whoever holds admin keys
+	err := limiter.CheckPinned(s.scriptsDir, req.Name, req.Source)
+	switch {
+	case errors.Is(err, limiter.ErrNotPinned):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "script pins: %v", err)
+	}
+	sha, prev, err := s.limiter.ReloadScript(ctx, req.Name, req.Source)
+	switch {
+	case errors.Is(err, limiter.ErrUnknownScript), errors.Is(err, limiter.ErrScriptRejected):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "script reload: %v", err)
+	}
+	log.Printf("Reloaded %s through the AdminService: %s replaces %s", req.Name, sha, prev)
+	return &pb.ReloadScriptResponse{Sha1: sha, PreviousSha1: prev}, nil
+}
+
+func (s *AdminServer) GetLogLevel(context.Context, *pb.GetLogLevelRequest) (*pb.LogLevel, error) {
+	return logLevelToPB(s.logs.State()), nil
+}
+
+func (s *AdminServer) SetLogLevel(_ context.Context, req *pb.SetLogLevelRequest) (*pb.LogLevel, error) {
+	if s.logs == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the log level is fixed on this server")
+	}
+	l, err := loglevel.Parse(req.Level)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.DurationSeconds < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration_seconds must not be negative")
+	}
+	revertAt := s.logs.Set(l, time.Duration(req.DurationSeconds)*time.Second)
+	if revertAt.IsZero() {
+		log.Printf("Log level set to %s through the AdminService", l)
+	} else {
+		log.Printf("Log level set to %s through the AdminService until %s", l, revertAt.Format(time.RFC3339))
+	}
+	return logLevelToPB(l, revertAt), nil
+}
+
+func logLevelToPB(l loglevel.Level, revertAt time.Time) *pb.LogLevel {
+	p := &pb.LogLevel{Level: l.String()}
+	if !revertAt.IsZero() {
+		p.RevertAt = revertAt.Unix()
+	}
+	return p
+}
+
+func (s *AdminServer) PreviewRules(ctx context.Context, req *pb.PreviewRulesRequest) (*pb.PreviewRulesResponse, error) {
+	if s.prefixUsage == nil {
+		return nil, status.Error(codes.FailedPrecondition, "per-prefix usage isn't recorded on this server")
+	}
+	candidate, err := rules.Parse([]byte(req.Rules))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "candidate rules: %v", err)
+	}
+	hours := req.Hours
+	if hours == 0 {
+		hours = 24
+	}
+	if hours < 0 || hours > 31*24 {
+		return nil, status.Error(codes.InvalidArgument, "hours must be between 0 and 744")
+	}
+
+	now := time.Now()
+	records, err := s.prefixUsage.Query(ctx, now.Add(-time.Duration(hours)*time.Hour), now)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "usage query failed: %v", err)
+	}
+	aggs := make([]whatif.Aggregate, len(records))
+	for i, r := range records {
+		aggs[i] = whatif.Aggregate{Tenant: r.Tenant, Prefix: r.Prefix, Hour: r.Hour, Keys: r.Keys, Requests: r.Requests, Tokens: r.Tokens}
+	}
+
+	current := whatif.Limits{Rules: s.rules, Tenants: map[string]*tenant.Tenant{}}
+	current.Burst, current.Rate = s.limiter.Defaults()
+	for _, t := range s.tenants.List() {
+		current.Tenants[t.Name] = t
+	}
+	proposed := current
+	proposed.Rules = candidate
+
+	resp := &pb.PreviewRulesResponse{}
+	for _, c := range whatif.Compare(current, proposed, aggs) {
+		resp.Changes = append(resp.Changes, &pb.RulesChange{
+			Namespace:        c.Before.Tenant,
+			Prefix:           c.Before.Prefix,
+			Effect:           string(c.Effect()),
+			BurstBefore:      c.Before.Burst,
+			RateBefore:       c.Before.Rate,
+			BurstAfter:       c.After.Burst,
+			RateAfter:        c.After.Rate,
+			Requests:         c.Before.Requests,
+			DenialRateBefore: c.Before.DenialRate(),
+			DenialRateAfter:  c.After.DenialRate(),
+		})
+	}
+	return resp, nil
+}
+
+func (s *AdminServer) DumpDiagnostics(ctx context.Context, req *pb.DumpDiagnosticsRequest) (*pb.Diagnostics, error) {
+	if s.diag == nil {
+		return nil, status.Error(codes.FailedPrecondition, "diagnostics aren't collected on this server")
+	}
+	b, err := s.diag.Snapshot(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "diagnostics: %v", err)
+	}
+	resp := &pb.Diagnostics{Json: string(b)}
+	if req.Save {
+		if resp.Path, err = s.diag.Save(b); err != nil {
+			return nil, status.Errorf(codes.Internal, "saving diagnostics: %v", err)
+		}
+	}
+	return resp, nil
+}
\ No newline at end of file
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// maxBatchSize bounds the items of one BatchAllow or BatchPeek call.
+const maxBatchSize = 1000
+
+func (s *RateLimitServer) BatchAllow(ctx context.Context, req *pb.BatchAllowRequest) (*pb.BatchAllowResponse, error) {
+	start := time.Now()
+	defer func() {
+		batchAllowDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if len(req.Requests) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "batch exceeds %d requests", maxBatchSize)
+	}
+	resp := &pb.BatchAllowResponse{Results: make([]*pb.BatchAllowResult, len(req.Requests))}
+	if len(req.Requests) == 0 {
+		return resp, nil
+	}
+
+	// Items are scheduled per namespace, or key prefix, as Allow calls are.
+	// Each group runs under a slot of its own, one after the other, so a
+	// batch never holds a slot while waiting for another
+	var (
+		lims   = make([]*limits, len(req.Requests))
+		groups [][]int
+		index  = map[string]int{}
+	)
+	for i, item := range req.Requests {
+		l, err := s.admit(ctx, item)
+		if err != nil {
+			resp.Results[i] = &pb.BatchAllowResult{Error: itemError(err)}
+			continue
+		}
+		lims[i] = l
+		var group string
+		if s.sched != nil {
+			group = schedulingKey(l.namespace, item.Key)
+		}
+		g, ok := index[group]
+		if !ok {
+			g = len(groups)
+			index[group] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	for _, group := range groups {
+		if err := s.allowGroup(ctx, req.Requests, lims, group, resp.Results); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// allowGroup answers the admitted items of a batch at the indexes in
+// group, which share a scheduling key, into results.
+func (s *RateLimitServer) allowGroup(ctx context.Context, items []*pb.AllowRequest, lims []*limits, group []int, results []*pb.BatchAllowResult) error {
+	if s.sched != nil {
+		first := group[0]
+		release, err := s.sched.Acquire(ctx, schedulingKey(lims[first].namespace, items[first].Key))
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+		defer release()
+	}
+
+	// Items touching a single bucket share one pipeline. Tenant caps,
+	// quotas, chains, cooldowns and spacing need extra calls, so those
+	// items run one by one.
+	var (
+		checks  []limiter.Check
+		pending []int
+	)
+	for _, i := range group {
+		l, item := lims[i], items[i]
+		if len(l.buckets()) == 1 && !l.subnetApart() && len(l.quotas()) == 0 && l.cooldown() == 0 && l.spacing() == 0 {
+			checks = append(checks, limiter.Check{Key: l.key, Tokens: cost(item), Burst: l.burst, Rate: l.rate})
+			pending = append(pending, i)
+			continue
+		}
+		res, err := s.consume(ctx, l, cost(item), item.LatencyCritical)
+		if s.maint.On() {
+			results[i] = &pb.BatchAllowResult{Response: s.shadow(l, item, res, err)}
+			continue
+		}
+		if err != nil {
+			results[i] = &pb.BatchAllowResult{Error: itemError(err)}
+			continue
+		}
+		results[i] = &pb.BatchAllowResult{Response: s.respond(l, item, res)}
+	}
+
+	maint := s.maint.On()
+	for j, r := range s.limiter.AllowBatch(ctx, checks) {
+		i := pending[j]
+		if r.Err != nil {
+			metrics.InternalErrors.WithLabelValues("BatchAllow", "redis").Inc()
+		}
+		if maint {
+			results[i] = &pb.BatchAllowResult{Response: s.shadow(lims[i], items[i], r.Result, r.Err)}
+			continue
+		}
+		if r.Err != nil {
+			results[i] = &pb.BatchAllowResult{Error: &pb.ItemError{
+				Code:    int32(codes.Internal),
+				Message: "rate limit check failed: " + r.Err.Error(),
+			}}
+			continue
+		}
+		results[i] = &pb.BatchAllowResult{Response: s.respond(lims[i], items[i], r.Result)}
+	}
+	return nil
+}
+
+func (s *RateLimitServer) BatchPeek(ctx context.Context, req *pb.BatchPeekRequest) (*pb.BatchPeekResponse, error) {
+	start := time.Now()
+	defer func() {
+		batchPeekDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	if len(req.Requests) > maxBatchSize {
+		return nil, status.Errorf(codes.InvalidArgument, "batch exceeds %d requests", maxBatchSize)
+	}
+	resp := &pb.BatchPeekResponse{Results: make([]*pb.BatchPeekResult, len(req.Requests))}
+
+	var (
+		checks  []limiter.Check
+		pending []int
+		lims    = make([]*limits, len(req.Requests))
+	)
+	for i, item := range req.Requests {
+		item.Key = s.norm.Apply(item.Key)
+		l, err := s.resolve(item.Namespace, item.Key, item.Bucket, item.Burst, item.Rate)
+		if err != nil {
+			resp.Results[i] = &pb.BatchPeekResult{Error: itemError(err)}
+			continue
+		}
+		lims[i] = l
+		checks = append(checks, limiter.Check{Key: l.key, Tokens: peekCost(item), Burst: l.burst, Rate: l.rate})
+		pending = append(pending, i)
+	}
+
+	for j, r := range s.limiter.PeekBatch(ctx, checks) {
+		i := pending[j]
+		if r.Err != nil {
+			metrics.InternalErrors.WithLabelValues("BatchPeek", "redis").Inc()
+			resp.Results[i] = &pb.BatchPeekResult{Error: &pb.ItemError{
+				Code:    int32(codes.Internal),
+				Message: "peek failed: " + r.Err.Error(),
+			}}
+			continue
+		}
+		resp.Results[i] = &pb.BatchPeekResult{Response: peekResponse(lims[i], r.Result)}
+	}
+	return resp, nil
+}
+
+func itemError(err error) *pb.ItemError {
+	st := status.Convert(err)
+	return &pb.ItemError{Code: int32(st.Code()), Message: st.Message()}
+}
\ No newline at end of file
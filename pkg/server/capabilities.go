@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// GetCapabilities reports the methods, limits and optional features of
+// this server, so clients can adapt to it.
+func (s *RateLimitServer) GetCapabilities(context.Context, *pb.GetCapabilitiesRequest) (*pb.Capabilities, error) {
+	desc := pb.RateLimitService_ServiceDesc
+	c := &pb.Capabilities{
+		ProtoVersions: []string{desc.ServiceName[:strings.LastIndexByte(desc.ServiceName, '.')]},
+		Algorithms:    []string{limiter.Algorithm},
+		MaxBatchSize:  maxBatchSize,
+		Features:      s.features(),
+	}
+	for _, m := range desc.Methods {
+		c.Methods = append(c.Methods, m.MethodName)
+	}
+	for _, m := range desc.Streams {
+		c.Methods = append(c.Methods, m.StreamName)
+	}
+	return c, nil
+}
+
+// features lists the optional features this server was started with.
+func (s *RateLimitServer) features() []string {
+	var f []string
+	for name, on := range map[string]bool{
+		"anomaly_throttling": s.anomaly != nil,
+		"boosts":             s.boosts != nil,
+		"fair_scheduling":    s.sched != nil,
+		"global_limits":      s.global != nil,
+		"greylist":           s.grey != nil,
+		"idempotency":        s.idempotency > 0,
+		"key_normalization":  s.norm != nil,
+		"latency_budget":     s.budget != nil,
+		"maintenance_mode":   s.maint != nil,
+		"prefix_rules":       s.rules.Len() > 0,
+		"queueing":           s.queueMax > 0,
+		"tenants":            s.tenants != nil,
+		"token_leasing":      s.leaser != nil,
+		"token_returns":      s.returns > 0,
+	} {
+		if on {
+			f = append(f, name)
+		}
+	}
+	sort.Strings(f)
+	return f
+}
\ No newline at end of file
@@ -2,89 +2,686 @@ package server
 
 import (
 	"context"
+	"errors"
+	"log"
+	"strconv"
 	"time"
 
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/SrushtiPatil01/rate-limiter/pkg/alert"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/anomaly"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/denylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/global"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/greylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keynorm"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keytrace"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/maintenance"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/scheduler"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/topkeys"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
 	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
 )
 
+// Observers for the RPC latencies, resolved once instead of per call.
+var (
+	allowDuration      = metrics.Batched(metrics.RequestDuration.WithLabelValues("Allow"))
+	peekDuration       = metrics.Batched(metrics.RequestDuration.WithLabelValues("Peek"))
+	batchAllowDuration = metrics.Batched(metrics.RequestDuration.WithLabelValues("BatchAllow"))
+	batchPeekDuration  = metrics.Batched(metrics.RequestDuration.WithLabelValues("BatchPeek"))
+)
+
 // RateLimitServer implements the gRPC RateLimitService.
 type RateLimitServer struct {
 	pb.UnimplementedRateLimitServiceServer
 	limiter *limiter.TokenBucket
+
+	rules   *rules.Set
+	tenants *tenant.Registry
+	usage   *usage.Recorder
+	prefix  *usage.PrefixRecorder
+	sched   *scheduler.Fair
+	boosts  *boost.Registry
+	leaser  *limiter.Leaser
+	budget  *limiter.Budgeter
+	warmer  *limiter.Warmer
+	maint   *maintenance.Mode
+	alerts  *alert.Notifier
+	anomaly *anomaly.Detector
+	grey    *greylist.Greylist
+	global  *global.Coordinator
+	top     *topkeys.Tracker
+	traces  *keytrace.Registry
+	history *keytrace.History
+	deny    *denylist.Set
+	norm    *keynorm.Chain
+	// returns is how long the tokens consumed by Allow requests asking for
+	// a lease can be given back, 0 to refuse returns
+	returns time.Duration
+	// idempotency is how long Allow remembers request IDs, 0 to ignore them
+	idempotency time.Duration
+	// queueMax bounds the requests queued per key, 0 to refuse queueing;
+	// queued requests are forgotten queueTTL after their last waiter left.
+	queueMax int64
+	queueTTL time.Duration
+
+	// peeks collapses concurrent identical Peek calls into one Redis read.
+	peeks singleflight.Group
+
+	defaultNamespace string
+}
+
+// Option configures a RateLimitServer.
+type Option func(*RateLimitServer)
+
+// WithDefaultNamespace sets the namespace applied to requests that omit one.
+func WithDefaultNamespace(ns string) Option {
+	return func(s *RateLimitServer) { s.defaultNamespace = ns }
+}
+
+// WithKeyNormalizer rewrites request keys with c before they're limited.
+func WithKeyNormalizer(c *keynorm.Chain) Option {
+	return func(s *RateLimitServer) { s.norm = c }
+}
+
+// WithRules applies per-prefix defaults and override bounds.
+func WithRules(r *rules.Set) Option {
+	return func(s *RateLimitServer) { s.rules = r }
+}
+
+// WithTenants enables per-tenant defaults and quotas, looked up by namespace.
+func WithTenants(r *tenant.Registry) Option {
+	return func(s *RateLimitServer) { s.tenants = r }
+}
+
+// WithUsage records per-tenant consumption for billing exports.
+func WithUsage(u *usage.Recorder) Option {
+	return func(s *RateLimitServer) { s.usage = u }
+}
+
+// WithPrefixUsage records the hourly traffic per namespace and key
+// prefix, which PreviewRules estimates candidate rules with.
+func WithPrefixUsage(p *usage.PrefixRecorder) Option {
+	return func(s *RateLimitServer) { s.prefix = p }
+}
+
+// WithScheduler queues Allow calls fairly across tenants once the
+// scheduler's in-flight bound is reached.
+func WithScheduler(f *scheduler.Fair) Option {
+	return func(s *RateLimitServer) { s.sched = f }
+}
+
+// WithBoosts applies temporary limit boosts.
+func WithBoosts(r *boost.Registry) Option {
+	return func(s *RateLimitServer) { s.boosts = r }
+}
+
+// WithLeaser serves hot single-bucket keys from in-memory token leases.
+func WithLeaser(l *limiter.Leaser) Option {
+	return func(s *RateLimitServer) { s.leaser = l }
+}
+
+// WithTokenReturns lets clients give back tokens they didn't use, within
+// ttl of consuming them, against the lease their Allow call was issued.
+func WithTokenReturns(ttl time.Duration) Option {
+	return func(s *RateLimitServer) { s.returns = ttl }
+}
+
+// WithIdempotency remembers the responses to Allow requests carrying a
+// request ID for ttl, so retries of a request are charged once.
+func WithIdempotency(ttl time.Duration) Option {
+	return func(s *RateLimitServer) { s.idempotency = ttl }
+}
+
+// WithQueue lets requests wait in line for their key's tokens, up to max
+// per key. Tickets are forgotten ttl after their last waiter left.
+func WithQueue(max int64, ttl time.Duration) Option {
+	return func(s *RateLimitServer) { s.queueMax, s.queueTTL = max, ttl }
+}
+
+// WithLatencyBudget answers latency-critical requests within the
+// Budgeter's budget.
+func WithLatencyBudget(b *limiter.Budgeter) Option {
+	return func(s *RateLimitServer) { s.budget = b }
+}
+
+// WithWarmer reports NOT_SERVING from HealthCheck until the limiter has
+// warmed up.
+func WithWarmer(w *limiter.Warmer) Option {
+	return func(s *RateLimitServer) { s.warmer = w }
+}
+
+// WithMaintenance admits every Allow while m is on, recording the limiter's
+// decisions in ShadowDecisions instead, and keeps HealthCheck SERVING
+// through Redis outages.
+func WithMaintenance(m *maintenance.Mode) Option {
+	return func(s *RateLimitServer) { s.maint = m }
+}
+
+// WithAlerts calls the webhooks of rule alerts fired by decisions.
+func WithAlerts(n *alert.Notifier) Option {
+	return func(s *RateLimitServer) { s.alerts = n }
+}
+
+// WithAnomalyDetector counts Allow calls per bucket key for d.
+func WithAnomalyDetector(d *anomaly.Detector) Option {
+	return func(s *RateLimitServer) { s.anomaly = d }
+}
+
+// WithGreylist gives keys seen for the first time provisional limits.
+func WithGreylist(g *greylist.Greylist) Option {
+	return func(s *RateLimitServer) { s.grey = g }
+}
+
+// WithGlobal splits the limits of global rules with the other regions
+// syncing through c.
+func WithGlobal(c *global.Coordinator) Option {
+	return func(s *RateLimitServer) { s.global = c }
+}
+
+// WithTopKeys counts the decisions per bucket key for the dashboard.
+func WithTopKeys(t *topkeys.Tracker) Option {
+	return func(s *RateLimitServer) { s.top = t }
+}
+
+// WithKeyTraces logs every decision on the keys and tenants flagged in r.
+func WithKeyTraces(r *keytrace.Registry) Option {
+	return func(s *RateLimitServer) { s.traces = r }
+}
+
+// WithDecisionHistory keeps the last decisions on traced keys in h.
+func WithDecisionHistory(h *keytrace.History) Option {
+	return func(s *RateLimitServer) { s.history = h }
+}
+
+// WithDenylist rejects Allow calls on the keys listed in d.
+func WithDenylist(d *denylist.Set) Option {
+	return func(s *RateLimitServer) { s.deny = d }
 }
 
 // NewRateLimitServer creates a new server backed by the given limiter.
-func NewRateLimitServer(l *limiter.TokenBucket) *RateLimitServer {
-	return &RateLimitServer{limiter: l}
+func NewRateLimitServer(l *limiter.TokenBucket, opts ...Option) *RateLimitServer {
+	s := &RateLimitServer{limiter: l}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *RateLimitServer) Allow(ctx context.Context, req *pb.AllowRequest) (*pb.AllowResponse, error) {
 	start := time.Now()
 	defer func() {
-		metrics.RequestDuration.WithLabelValues("Allow").Observe(time.Since(start).Seconds())
+		allowDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	if req.Key == "" {
-		return nil, status.Error(codes.InvalidArgument, "key is required")
+	l, err := s.admit(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.RequestId != "" && s.idempotency > 0 {
+		return s.allowOnce(ctx, l, req)
+	}
+	return s.allow(ctx, l, req)
+}
+
+// allow answers an admitted Allow request.
+func (s *RateLimitServer) allow(ctx context.Context, l *limits, req *pb.AllowRequest) (*pb.AllowResponse, error) {
+	if s.sched != nil {
+		release, err := s.sched.Acquire(ctx, schedulingKey(l.namespace, req.Key))
+		if err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		defer release()
+	}
+
+	res, err := s.consume(ctx, l, cost(req), req.LatencyCritical)
+	if s.maint.On() {
+		return s.shadow(l, req, res, err), nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	resp := s.respond(l, req, res)
+	if req.Lease && res.Allowed && s.returns > 0 {
+		resp.Lease = s.lease(ctx, l, cost(req))
+	}
+	return resp, nil
+}
 
-	res, err := s.limiter.Allow(ctx, req.Key, req.Tokens, req.Burst, req.Rate)
+// lease records that tokens of l's bucket were consumed, for ReturnTokens
+// to give back up to that many, and returns the lease's ID. Leases are
+// scoped to the bucket, and their IDs are unguessable, so clients can only
+// give back tokens they consumed. It returns "" when the lease can't be
+// recorded: the tokens stay consumed.
+func (s *RateLimitServer) lease(ctx context.Context, l *limits, tokens float64) string {
+	id := newTicketID()
+	if err := s.limiter.LeaseReturns(context.WithoutCancel(ctx), returnLeaseKey(l.key, id), tokens, s.returns); err != nil {
+		metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+		log.Printf("record lease of %g tokens of %q: %v", tokens, l.key, err)
+		return ""
+	}
+	return id
+}
+
+// allowOnce answers a request carrying a request ID at most once: retries
+// get the first attempt's response, and fail with Aborted while it's still
+// running. Attempts that fail are forgotten, so their retries are charged.
+// IDs are scoped to the bucket, so the same ID on another key, or another
+// tenant's, is another request.
+func (s *RateLimitServer) allowOnce(ctx context.Context, l *limits, req *pb.AllowRequest) (*pb.AllowResponse, error) {
+	id := limiter.BucketKey(l.key, "req:"+req.RequestId)
+	claimed, prev, err := s.limiter.ClaimRequest(ctx, id, s.idempotency)
 	if err != nil {
 		metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
-		return nil, status.Errorf(codes.Internal, "rate limit check failed: %v", err)
+		return nil, status.Errorf(codes.Internal, "request ID check failed: %v", err)
+	}
+	if !claimed {
+		if prev == nil {
+			return nil, status.Errorf(codes.Aborted, "request %q is still running", req.RequestId)
+		}
+		resp := &pb.AllowResponse{}
+		if err := resp.UnmarshalVT(prev); err != nil {
+			return nil, status.Errorf(codes.Internal, "decode response to request %q: %v", req.RequestId, err)
+		}
+		resp.Reasons = append(resp.Reasons, "replayed")
+		return resp, nil
 	}
 
-	prefix := metrics.KeyPrefix(req.Key)
-	if res.Allowed {
-		metrics.RequestsTotal.WithLabelValues(prefix, "allowed").Inc()
+	resp, err := s.allow(ctx, l, req)
+	if err != nil {
+		if err := s.limiter.ForgetRequest(context.WithoutCancel(ctx), id); err != nil {
+			log.Printf("forget request %q: %v", req.RequestId, err)
+		}
+		return nil, err
+	}
+	raw, err := resp.MarshalVT()
+	if err == nil {
+		err = s.limiter.RecordRequest(context.WithoutCancel(ctx), id, raw, s.idempotency)
+	}
+	if err != nil {
+		// Retries fail with Aborted until the claim expires, rather than
+		// being charged twice.
+		metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+		log.Printf("record response to request %q: %v", req.RequestId, err)
+	}
+	return resp, nil
+}
+
+// admit resolves the limits of an Allow request, provisional for keys on
+// probation, and rejects requests from suspended tenants, for more tokens
+// than the rule allows per call, and on denylisted keys.
+func (s *RateLimitServer) admit(ctx context.Context, req *pb.AllowRequest) (*limits, error) {
+	req.Key = s.norm.Apply(req.Key)
+	l, err := s.resolve(req.Namespace, req.Key, req.Bucket, req.Burst, req.Rate)
+	if err != nil {
+		return nil, err
+	}
+	if l.tenant != nil && l.tenant.Suspended {
+		return nil, status.Errorf(codes.PermissionDenied, "tenant %q is suspended", l.namespace)
+	}
+	if err := l.rule.CheckTokens(cost(req)); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v for %q keys", err, metrics.KeyPrefix(req.Key))
+	}
+	if s.deny.Denied(l.key) {
+		return nil, status.Errorf(codes.PermissionDenied, "key %q is denylisted", req.Key)
+	}
+	l.burst, l.rate = s.grey.Apply(ctx, l.key, l.burst, l.rate)
+	return l, nil
+}
+
+// consume takes tokens from the request's buckets, then from its quotas,
+// unless the key is cooling down or paced. Latency-critical single-bucket
+// checks go through the Budgeter.
+func (s *RateLimitServer) consume(ctx context.Context, l *limits, tokens float64, critical bool) (*limiter.Result, error) {
+	cooldown := l.cooldown()
+	if cooldown > 0 {
+		left, err := s.limiter.Cooldown(ctx, l.key)
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+			return nil, status.Errorf(codes.Internal, "cooldown check failed: %v", err)
+		}
+		if left > 0 {
+			l.reasons = append(l.reasons, "cooldown")
+			return &limiter.Result{
+				Limit:      l.burst,
+				ResetAt:    time.Now().Add(left).Unix(),
+				RetryAfter: left.Seconds(),
+			}, nil
+		}
+	}
+
+	spacing := l.spacing()
+	if spacing > 0 {
+		ok, wait, err := s.limiter.Pace(ctx, l.key, tokens, spacing)
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+			return nil, status.Errorf(codes.Internal, "pacing check failed: %v", err)
+		}
+		if !ok {
+			l.reasons = append(l.reasons, "spacing")
+			return &limiter.Result{
+				Limit:      l.burst,
+				ResetAt:    time.Now().Add(wait).Unix(),
+				RetryAfter: wait.Seconds(),
+			}, nil
+		}
+	}
+
+	res, err := s.charge(ctx, l, tokens, critical)
+	if spacing > 0 && (err != nil || !res.Allowed) {
+		// Denied requests don't hold the next one back
+		if err := s.limiter.Unpace(ctx, l.key); err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cooldown > 0 && (!res.Allowed || res.Remaining == 0) {
+		if err := s.limiter.StartCooldown(ctx, l.key, cooldown); err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+			return nil, status.Errorf(codes.Internal, "cooldown failed: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// charge takes tokens from the request's buckets, then from its quotas.
+func (s *RateLimitServer) charge(ctx context.Context, l *limits, tokens float64, critical bool) (*limiter.Result, error) {
+	var sub *limiter.Result
+	if l.subnetApart() {
+		// The network's bucket is charged on its own first, and refunded
+		// if the key's buckets then deny the request
+		var err error
+		if sub, err = s.limiter.Allow(ctx, l.subnet, tokens, l.rule.Subnet.Burst, l.rule.Subnet.Rate); err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+			return nil, status.Errorf(codes.Internal, "rate limit check failed: %v", err)
+		}
+		if !sub.Allowed {
+			l.binding = rules.SubnetBucket
+			return sub, nil
+		}
+	}
+	res, err := s.chargeBuckets(ctx, l, tokens, critical)
+	if sub != nil {
+		switch {
+		case err != nil || !res.Allowed:
+			if err := s.limiter.Return(context.WithoutCancel(ctx), l.subnet, tokens, l.rule.Subnet.Burst); err != nil {
+				metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+				log.Printf("refund of %s failed: %v", l.subnet, err)
+			}
+		case sub.Remaining < res.Remaining:
+			res, l.binding = sub, rules.SubnetBucket
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Quotas are only charged once the buckets admit the request, in
+	// order until one denies it. A quota denial holds until the window
+	// resets, so the tokens spent on it don't matter. Of the chain's
+	// quotas, the one with the least left decides an admitted request.
+	for _, q := range l.quotas() {
+		if !res.Allowed {
+			break
+		}
+		var qr *limiter.Result
+		if q.subWindows > 0 {
+			qr, err = s.limiter.SlidingWindow(ctx, q.key, tokens, q.limit, q.period, q.subWindows)
+		} else {
+			qr, err = s.limiter.QuotaRollover(ctx, q.key, tokens, q.limit, q.period, q.rollover)
+		}
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+			return nil, status.Errorf(codes.Internal, "quota check failed: %v", err)
+		}
+		if !qr.Allowed || (q.link != "" && qr.Remaining < res.Remaining) {
+			res, l.binding = qr, q.link
+		}
+	}
+	return res, nil
+}
+
+// chargeBuckets takes tokens from the request's buckets, all at once.
+func (s *RateLimitServer) chargeBuckets(ctx context.Context, l *limits, tokens float64, critical bool) (*limiter.Result, error) {
+	var (
+		res *limiter.Result
+		err error
+	)
+	if buckets := l.buckets(); len(buckets) > 1 {
+		var binding int
+		if res, binding, err = s.limiter.AllowAll(ctx, buckets, tokens); err == nil {
+			l.binding = l.link(binding, len(buckets))
+		}
+	} else if critical && s.budget != nil {
+		res, err = s.budget.Allow(ctx, l.key, tokens, l.burst, l.rate)
+	} else if s.leaser != nil {
+		res, err = s.leaser.Allow(ctx, l.key, tokens, l.burst, l.rate)
 	} else {
-		metrics.RequestsTotal.WithLabelValues(prefix, "denied").Inc()
+		res, err = s.limiter.Allow(ctx, l.key, tokens, l.burst, l.rate)
+	}
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// The caller stopped waiting, e.g. on a budgeted call it cancelled
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	if err != nil {
+		metrics.InternalErrors.WithLabelValues("Allow", "redis").Inc()
+		return nil, status.Errorf(codes.Internal, "rate limit check failed: %v", err)
+	}
+	return res, nil
+}
+
+// respond records the decision for usage and metrics and builds the response.
+func (s *RateLimitServer) respond(l *limits, req *pb.AllowRequest, res *limiter.Result) *pb.AllowResponse {
+	tokens := cost(req)
+	if s.usage != nil && l.namespace != "" {
+		s.usage.Record(l.namespace, tokens, res.Allowed)
+	}
+	s.prefix.Record(l.namespace, metrics.KeyPrefix(req.Key), l.key, tokens)
+	if l.global() {
+		s.global.Observe(l.key, tokens)
+	}
+
+	metrics.RecordDecision(metrics.KeyPrefix(req.Key), res.Allowed, res.Remaining)
+	s.alerts.Observe(l.rule, l.namespace, req.Key, res.Allowed, res.Remaining, res.Limit)
+	s.anomaly.Observe(l.key)
+	s.top.Observe(l.key, res.Allowed)
+	if t := s.traces.Get(l.key, limiter.TenantKey(l.namespace)); t != nil {
+		s.trace(t, l, req, tokens, res)
+	}
+
+	resp := newAllowResponse()
+	resp.Allowed = res.Allowed
+	resp.Remaining = res.Remaining
+	resp.Limit = res.Limit
+	resp.ResetAt = res.ResetAt
+	resp.RetryAfter = res.RetryAfter
+	resp.Reasons = l.reasons
+	resp.Binding = l.binding
+	if res.Allowed && l.rule.Warns(res.Remaining, res.Limit) {
+		metrics.SoftLimitWarnings.WithLabelValues(metrics.KeyPrefix(req.Key)).Inc()
+		resp.Warning = true
+		resp.Reasons = append(resp.Reasons, "soft_limit")
 	}
-	metrics.TokensRemaining.WithLabelValues(prefix).Set(float64(res.Remaining))
+	return resp
+}
+
+// cost returns the tokens req consumes: its fractional cost when set, else
+// its whole tokens (default 1).
+func cost(req *pb.AllowRequest) float64 {
+	switch {
+	case req.Cost > 0:
+		return req.Cost
+	case req.Tokens > 0:
+		return float64(req.Tokens)
+	}
+	return 1
+}
+
+// peekCost returns the tokens a Peek request asks about, with the
+// precedence of cost.
+func peekCost(req *pb.PeekRequest) float64 {
+	switch {
+	case req.Cost > 0:
+		return req.Cost
+	case req.Tokens > 0:
+		return float64(req.Tokens)
+	}
+	return 1
+}
 
-	return &pb.AllowResponse{
+// trace logs everything that went into a decision on a traced key and
+// adds it to the key's history.
+func (s *RateLimitServer) trace(t *keytrace.Trace, l *limits, req *pb.AllowRequest, tokens float64, res *limiter.Result) {
+	rule := ""
+	if l.rule != nil {
+		rule = l.rule.Prefix
+	}
+	s.history.Record(l.key, keytrace.Decision{
+		Time:       time.Now(),
+		Tokens:     tokens,
 		Allowed:    res.Allowed,
 		Remaining:  res.Remaining,
 		Limit:      res.Limit,
-		ResetAt:    res.ResetAt,
 		RetryAfter: res.RetryAfter,
-	}, nil
+	})
+	log.Printf("TRACE key=%q namespace=%q tenant_config=%t rule=%q tokens=%g override_burst=%d override_rate=%g burst=%d rate=%g key_boost=%t tenant_boost=%t reasons=%v allowed=%t remaining=%d limit=%d reset_at=%d retry_after=%g trace=%q",
+		req.Key, l.namespace, l.tenant != nil, rule, tokens, req.Burst, req.Rate, l.burst, l.rate,
+		l.keyBoost != nil, l.tenantBoost != nil, l.reasons,
+		res.Allowed, res.Remaining, res.Limit, res.ResetAt, res.RetryAfter, t.Reason)
+}
+
+// shadow admits a request in maintenance mode, recording the limiter's
+// decision, or its failure to make one, instead of enforcing it.
+func (s *RateLimitServer) shadow(l *limits, req *pb.AllowRequest, res *limiter.Result, err error) *pb.AllowResponse {
+	prefix := metrics.KeyPrefix(req.Key)
+	switch {
+	case err != nil:
+		metrics.ShadowDecisions.WithLabelValues(prefix, "error").Inc()
+		res = &limiter.Result{Remaining: l.burst, Limit: l.burst}
+	case res.Allowed:
+		metrics.ShadowDecisions.WithLabelValues(prefix, "allowed").Inc()
+	default:
+		metrics.ShadowDecisions.WithLabelValues(prefix, "denied").Inc()
+	}
+	admitted := *res
+	admitted.Allowed = true
+	admitted.RetryAfter = 0
+	resp := s.respond(l, req, &admitted)
+	resp.Reasons = append(resp.Reasons, "maintenance")
+	return resp
 }
 
 func (s *RateLimitServer) Peek(ctx context.Context, req *pb.PeekRequest) (*pb.PeekResponse, error) {
 	start := time.Now()
 	defer func() {
-		metrics.RequestDuration.WithLabelValues("Peek").Observe(time.Since(start).Seconds())
+		peekDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	if req.Key == "" {
-		return nil, status.Error(codes.InvalidArgument, "key is required")
+	req.Key = s.norm.Apply(req.Key)
+	l, err := s.resolve(req.Namespace, req.Key, req.Bucket, req.Burst, req.Rate)
+	if err != nil {
+		return nil, err
 	}
 
-	res, err := s.limiter.Peek(ctx, req.Key, 0, 0)
+	// Dashboards tend to poll the same keys at once. The shared read must
+	// not fail every waiter when the caller that started it goes away.
+	tokens := peekCost(req)
+	flightKey := l.key + "|" + strconv.FormatInt(l.burst, 10) + "|" + strconv.FormatFloat(l.rate, 'g', -1, 64) + "|" + strconv.FormatFloat(tokens, 'g', -1, 64)
+	leader := false
+	v, err, shared := s.peeks.Do(flightKey, func() (interface{}, error) {
+		leader = true
+		return s.limiter.PeekTokens(context.WithoutCancel(ctx), l.key, tokens, l.burst, l.rate)
+	})
+	// Shared holds for the caller that made the read too, which saved none
+	if shared && !leader {
+		metrics.PeeksDeduplicated.Inc()
+	}
 	if err != nil {
 		metrics.InternalErrors.WithLabelValues("Peek", "redis").Inc()
 		return nil, status.Errorf(codes.Internal, "peek failed: %v", err)
 	}
+	return peekResponse(l, v.(*limiter.Result)), nil
+}
 
+// peekResponse reports res, the state of l's bucket.
+func peekResponse(l *limits, res *limiter.Result) *pb.PeekResponse {
 	return &pb.PeekResponse{
-		Remaining: res.Remaining,
-		Limit:     res.Limit,
-		ResetAt:   res.ResetAt,
-	}, nil
+		Remaining:  res.Remaining,
+		Limit:      res.Limit,
+		ResetAt:    res.ResetAt,
+		Boost:      boostToPB(l.boost()),
+		Allowed:    res.Allowed,
+		RetryAfter: res.RetryAfter,
+		Age:        res.Age,
+		Idle:       res.Idle,
+	}
+}
+
+// ReturnTokens gives tokens back to the key's own bucket, up to what's
+// left of the lease they were consumed under. Chain links, subnet buckets,
+// tenant caps and quotas keep what they were charged.
+func (s *RateLimitServer) ReturnTokens(ctx context.Context, req *pb.ReturnTokensRequest) (*pb.ReturnTokensResponse, error) {
+	if s.returns == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "token returns are disabled")
+	}
+	if req.Tokens <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "tokens must be positive")
+	}
+	if req.Lease == "" {
+		return nil, status.Error(codes.InvalidArgument, "lease is required")
+	}
+	req.Key = s.norm.Apply(req.Key)
+	l, err := s.resolve(req.Namespace, req.Key, req.Bucket, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.limiter.SpendLease(ctx, returnLeaseKey(l.key, req.Lease), float64(req.Tokens))
+	if errors.Is(err, limiter.ErrNoLease) {
+		return nil, status.Errorf(codes.NotFound, "lease %q of %q not found or expired", req.Lease, req.Key)
+	}
+	if err != nil {
+		metrics.InternalErrors.WithLabelValues("ReturnTokens", "redis").Inc()
+		return nil, status.Errorf(codes.Internal, "lease lookup failed: %v", err)
+	}
+	// The lease is spent even if the tokens don't make it back: retries
+	// must not return them twice.
+	if err := s.limiter.Return(ctx, l.key, n, l.burst); err != nil {
+		metrics.InternalErrors.WithLabelValues("ReturnTokens", "redis").Inc()
+		return nil, status.Errorf(codes.Internal, "return failed: %v", err)
+	}
+	return &pb.ReturnTokensResponse{Returned: n}, nil
+}
+
+// returnLeaseKey returns the identifier of lease id on the bucket key.
+func returnLeaseKey(key, id string) string {
+	return limiter.BucketKey(key, "lease:"+id)
 }
 
 func (s *RateLimitServer) HealthCheck(ctx context.Context, _ *pb.HealthCheckRequest) (*pb.HealthCheckResponse, error) {
 	resp := &pb.HealthCheckResponse{Status: pb.HealthCheckResponse_SERVING}
 
 	if err := s.limiter.Ping(ctx); err != nil {
-		resp.Status = pb.HealthCheckResponse_NOT_SERVING
 		resp.RedisStatus = err.Error()
+		// Requests are admitted without Redis anyway
+		if s.maint.On() {
+			resp.RedisStatus = "maintenance: " + resp.RedisStatus
+			return resp, nil
+		}
+		resp.Status = pb.HealthCheckResponse_NOT_SERVING
+		return resp, nil
+	}
+	if s.warmer != nil && !s.warmer.Ready() {
+		resp.Status = pb.HealthCheckResponse_NOT_SERVING
+		resp.RedisStatus = "warming up"
 		return resp, nil
 	}
 
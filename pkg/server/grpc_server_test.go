@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// blockingHook counts script calls and holds them until released.
+type blockingHook struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (h *blockingHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *blockingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "evalsha" {
+			h.calls.Add(1)
+			<-h.release
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *blockingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// peekAll runs reqs concurrently against a server whose Redis reads block
+// until reads of them are in flight, and returns their responses.
+func peekAll(t *testing.T, reads int32, reqs ...*pb.PeekRequest) ([]*pb.PeekResponse, *blockingHook) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	hook := &blockingHook{release: make(chan struct{})}
+	rdb.AddHook(hook)
+	s := NewRateLimitServer(limiter.New(rdb, 10, 1))
+
+	resps := make([]*pb.PeekResponse, len(reqs))
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func(i int, req *pb.PeekRequest) {
+			defer wg.Done()
+			resp, err := s.Peek(context.Background(), req)
+			assert.NoError(t, err)
+			resps[i] = resp
+		}(i, req)
+	}
+	require.Eventually(t, func() bool { return hook.calls.Load() >= reads }, time.Second, time.Millisecond)
+	// Give the other callers time to join the reads in flight
+	time.Sleep(50 * time.Millisecond)
+	close(hook.release)
+	wg.Wait()
+	return resps, hook
+}
+
+func TestPeek_Deduplicated(t *testing.T) {
+	before := testutil.ToFloat64(metrics.PeeksDeduplicated)
+	reqs := make([]*pb.PeekRequest, 5)
+	for i := range reqs {
+		reqs[i] = &pb.PeekRequest{Key: "user:1"}
+	}
+
+	resps, hook := peekAll(t, 1, reqs...)
+	assert.Equal(t, int32(1), hook.calls.Load(), "one read for identical peeks")
+	assert.Equal(t, 4.0, testutil.ToFloat64(metrics.PeeksDeduplicated)-before, "the leader's read saved nothing")
+	for _, resp := range resps {
+		assert.Equal(t, int64(10), resp.Remaining)
+	}
+}
+
+func TestPeek_DistinctNotDeduplicated(t *testing.T) {
+	before := testutil.ToFloat64(metrics.PeeksDeduplicated)
+	reqs := []*pb.PeekRequest{
+		{Key: "user:1"},
+		{Key: "user:1", Burst: 20},
+		{Key: "user:1", Rate: 2},
+		{Key: "user:1", Tokens: 3},
+		{Key: "user:1", Cost: 0.5},
+	}
+
+	resps, hook := peekAll(t, int32(len(reqs)), reqs...)
+	assert.Equal(t, int32(len(reqs)), hook.calls.Load(), "one read per burst, rate and cost")
+	assert.Zero(t, testutil.ToFloat64(metrics.PeeksDeduplicated)-before)
+	assert.Equal(t, int64(10), resps[0].Limit)
+	assert.Equal(t, int64(20), resps[1].Limit)
+}
\ No newline at end of file
@@ -2,41 +2,96 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	grpcprom "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/SrushtiPatil01/rate-limiter/pkg/alert"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/anomaly"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/apiquota"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/auth"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/chaos"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/config"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/denylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/devredis"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/diag"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/global"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/greylist"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keynorm"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/keytrace"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/loglevel"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/maintenance"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/redispool"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/runtimetune"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/scheduler"
 	"github.com/SrushtiPatil01/rate-limiter/pkg/server"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/topkeys"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/usage"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/webui"
 	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
 )
 
 func main() {
+	dev := flag.Bool("dev", false, "run against an embedded in-memory Redis with relaxed defaults")
+	flag.Parse()
 	cfg := config.Load()
+	level, err := loglevel.Parse(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("LOG_LEVEL: %v", err)
+	}
+	logs := loglevel.New(level)
+
+	// ── Runtime ──────────────────────────────────────────────
+	rt := runtimetune.Current()
+	if cfg.RuntimeLowLatency {
+		rt = runtimetune.Apply(cfg.RuntimeGOGC, cfg.RuntimeMemoryLimitRatio)
+		log.Printf("low-latency runtime: GOMAXPROCS=%d GOGC=%d GOMEMLIMIT=%d", rt.GOMAXPROCS, rt.GOGC, rt.MemoryLimit)
+	}
+	metrics.RuntimeSetting.WithLabelValues("gomaxprocs").Set(float64(rt.GOMAXPROCS))
+	metrics.RuntimeSetting.WithLabelValues("gogc").Set(float64(rt.GOGC))
+	metrics.RuntimeSetting.WithLabelValues("memory_limit_bytes").Set(float64(rt.MemoryLimit))
 
 	// ── Redis ────────────────────────────────────────────────
-	rdb := redis.NewClient(&redis.Options{
+	var devRedis *devredis.Server
+	if *dev {
+		var err error
+		if devRedis, err = devredis.Start(); err != nil {
+			log.Fatalf("failed to start embedded Redis: %v", err)
+		}
+		cfg.Dev()
+		cfg.RedisAddr = devRedis.Addr()
+		log.Printf("WARNING: dev mode, all state is in memory and lost on exit")
+	}
+	redisOpts := &redis.Options{
 		Addr:         cfg.RedisAddr,
 		Password:     cfg.RedisPassword,
 		DB:           cfg.RedisDB,
 		PoolSize:     cfg.RedisPoolSize,
+		MinIdleConns: cfg.RedisMinIdleConns,
 		DialTimeout:  cfg.RedisDialTimeout,
 		ReadTimeout:  cfg.RedisReadTimeout,
 		WriteTimeout: cfg.RedisWriteTimeout,
-	})
+	}
+	rdb := redis.NewClient(redisOpts)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -46,13 +101,205 @@ func main() {
 	log.Printf("connected to Redis at %s", cfg.RedisAddr)
 
 	// ── Limiter ──────────────────────────────────────────────
-	tb := limiter.New(rdb, cfg.DefaultBurst, cfg.DefaultRate)
+	// Buckets live in a Redis Cluster when one is configured. Otherwise the
+	// limiter gets its own pool when it's adaptively sized or faults may be
+	// injected, which only the limiter's client sees.
+	chaosCfg := chaos.Config{
+		Down:            cfg.ChaosRedisDown,
+		Latency:         cfg.ChaosLatency,
+		LatencyRate:     cfg.ChaosLatencyRate,
+		ErrorRate:       cfg.ChaosErrorRate,
+		ScriptErrorRate: cfg.ChaosScriptErrorRate,
+		PartitionEvery:  cfg.ChaosPartitionEvery,
+		PartitionFor:    cfg.ChaosPartitionFor,
+	}
+	chaosOn := chaosCfg.Enabled() || cfg.ChaosAdmin
+	var (
+		tb      *limiter.TokenBucket
+		cluster *redis.ClusterClient
+		tbOpts  []limiter.Option
+	)
+	if cfg.LuaScriptsDir != "" {
+		scripts, err := limiter.LoadScripts(cfg.LuaScriptsDir)
+		if err != nil {
+			log.Fatalf("failed to load Lua scripts: %v", err)
+		}
+		tbOpts = append(tbOpts, limiter.WithScripts(scripts))
+		for _, name := range scripts.Overridden() {
+			log.Printf("WARNING: running %s from %s instead of the embedded script", name, cfg.LuaScriptsDir)
+		}
+	}
+	limiterRDB := rdb
+	if cfg.RedisClusterAddrs != "" {
+		cluster = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        strings.Split(cfg.RedisClusterAddrs, ","),
+			Password:     cfg.RedisPassword,
+			PoolSize:     cfg.RedisPoolSize,
+			MinIdleConns: cfg.RedisMinIdleConns,
+			DialTimeout:  cfg.RedisDialTimeout,
+			ReadTimeout:  cfg.RedisReadTimeout,
+			WriteTimeout: cfg.RedisWriteTimeout,
+		})
+		if err := cluster.Ping(ctx).Err(); err != nil {
+			log.Fatalf("failed to connect to Redis Cluster at %s: %v", cfg.RedisClusterAddrs, err)
+		}
+		log.Printf("limiter buckets in Redis Cluster at %s", cfg.RedisClusterAddrs)
+		tb = limiter.New(cluster, cfg.DefaultBurst, cfg.DefaultRate, tbOpts...)
+	} else {
+		if cfg.RedisPoolMax > 0 || chaosOn {
+			limiterRDB = redis.NewClient(redisOpts)
+		}
+		tb = limiter.New(limiterRDB, cfg.DefaultBurst, cfg.DefaultRate, tbOpts...)
+	}
+	if cfg.LuaScriptsDir != "" {
+		if err := tb.ValidateScripts(ctx); err != nil {
+			log.Fatalf("invalid Lua scripts in %s: %v", cfg.LuaScriptsDir, err)
+		}
+	}
+
+	setClient := tb.SetClient
+	var faults *chaos.Hook // for the AdminService, if it may change them
+	if chaosOn {
+		hook := chaos.New(chaosCfg)
+		if cluster != nil {
+			cluster.AddHook(hook)
+		} else {
+			limiterRDB.AddHook(hook)
+			setClient = func(c *redis.Client) *redis.Client {
+				c.AddHook(hook)
+				return tb.SetClient(c)
+			}
+		}
+		log.Printf("WARNING: injecting Redis faults into the limiter: %+v", chaosCfg)
+		if cfg.ChaosAdmin {
+			faults = hook
+			log.Printf("WARNING: Redis faults can be changed through the AdminService")
+		}
+	}
+
+	// Background loops run until shutdown
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	defer bgCancel()
+	if devRedis != nil {
+		go devRedis.Run(bgCtx, time.Second)
+	}
+
+	var tuner *redispool.Tuner
+	tunerDone := make(chan struct{})
+	if cfg.RedisPoolMax > 0 && cluster == nil {
+		tuner = redispool.NewTuner(redisOpts, limiterRDB, cfg.RedisPoolMin, cfg.RedisPoolMax, setClient)
+		go func() {
+			tuner.Run(bgCtx, cfg.RedisPoolTuneInterval)
+			close(tunerDone)
+		}()
+		log.Printf("adaptive redis pool sizing enabled (%d-%d connections)", cfg.RedisPoolMin, cfg.RedisPoolMax)
+	} else {
+		close(tunerDone)
+	}
+
+	// ── Rules ────────────────────────────────────────────────
+	var ruleSet *rules.Set
+	if cfg.RulesFile != "" {
+		var err error
+		if ruleSet, err = rules.Load(cfg.RulesFile); err != nil {
+			log.Fatalf("failed to load rules: %v", err)
+		}
+		log.Printf("loaded %d rules from %s", ruleSet.Len(), cfg.RulesFile)
+	}
+
+	// ── Tenants ──────────────────────────────────────────────
+	tenants := tenant.NewRegistry(rdb)
+	if cfg.TenantsFile != "" {
+		seed, err := tenant.LoadFile(cfg.TenantsFile)
+		if err != nil {
+			log.Fatalf("failed to load tenants: %v", err)
+		}
+		if err := tenants.Seed(ctx, seed); err != nil {
+			log.Fatalf("failed to seed tenants: %v", err)
+		}
+	}
+	if err := tenants.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load tenants: %v", err)
+	}
+	go tenants.Run(bgCtx, cfg.TenantRefreshInterval)
+
+	// ── Boosts ───────────────────────────────────────────────
+	boosts := boost.NewRegistry(rdb)
+	if err := boosts.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load boosts: %v", err)
+	}
+	go boosts.Run(bgCtx, cfg.BoostRefreshInterval)
+
+	// ── Key traces ───────────────────────────────────────────
+	traces := keytrace.NewRegistry(rdb)
+	if err := traces.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load key traces: %v", err)
+	}
+	go traces.Run(bgCtx, cfg.TraceRefreshInterval)
+	var history *keytrace.History
+	if cfg.DecisionHistorySize > 0 {
+		history = keytrace.NewHistory(rdb, cfg.DecisionHistorySize, cfg.DecisionHistoryRetention)
+		go history.Run(bgCtx)
+	}
+
+	// ── Denylist ─────────────────────────────────────────────
+	deny := denylist.New(rdb)
+	if err := deny.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load denylist: %v", err)
+	}
+	go deny.Run(bgCtx, cfg.DenylistRefreshInterval)
+
+	// ── Maintenance mode ─────────────────────────────────────
+	maint := maintenance.New(rdb)
+	if err := maint.Refresh(ctx); err != nil {
+		log.Fatalf("failed to load maintenance mode: %v", err)
+	}
+	go maint.Run(bgCtx, cfg.MaintenanceInterval)
+
+	// ── Global limits ────────────────────────────────────────
+	var coord *global.Coordinator
+	if cfg.GlobalRedisAddr != "" {
+		if cfg.Region == "" {
+			log.Fatalf("GLOBAL_REDIS_ADDR requires REGION")
+		}
+		globalRDB := redis.NewClient(&redis.Options{
+			Addr:     cfg.GlobalRedisAddr,
+			Password: cfg.GlobalRedisPassword,
+		})
+		defer globalRDB.Close()
+		coord = global.New(globalRDB, cfg.Region, cfg.GlobalSyncInterval)
+		if err := coord.Sync(ctx); err != nil {
+			log.Printf("global limit sync failed, starting with even shares: %v", err)
+		}
+		go coord.Run(bgCtx)
+		log.Printf("sharing global limits as region %q through %s", cfg.Region, cfg.GlobalRedisAddr)
+	}
+
+	// ── Usage accounting ─────────────────────────────────────
+	usageRec := usage.NewRecorder(rdb, cfg.UsageRetention)
+	usageDone := make(chan struct{})
+	clientUsageDone := make(chan struct{})
+	go func() {
+		usageRec.Run(bgCtx, cfg.UsageFlushInterval)
+		close(usageDone)
+	}()
+	var prefixUsage *usage.PrefixRecorder
+	prefixUsageDone := make(chan struct{})
+	if cfg.PrefixUsageRetention > 0 {
+		prefixUsage = usage.NewPrefixRecorder(rdb, cfg.PrefixUsageRetention)
+		go func() {
+			prefixUsage.Run(bgCtx, cfg.UsageFlushInterval)
+			close(prefixUsageDone)
+		}()
+	} else {
+		close(prefixUsageDone)
+	}
 
 	// ── Prometheus metrics server ────────────────────────────
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", metrics.Handler())
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		if err := rdb.Ping(r.Context()).Err(); err != nil {
+		if err := rdb.Ping(r.Context()).Err(); err != nil && !maint.On() {
 			w.WriteHeader(http.StatusServiceUnavailable)
 			fmt.Fprintf(w, "redis: %v", err)
 			return
@@ -72,8 +319,85 @@ func main() {
 		}
 	}()
 
+	go metrics.RunGaugeFlusher(bgCtx, time.Second)
+	if cfg.MetricsBatchShards > 0 {
+		go metrics.EnableBatching(cfg.MetricsBatchShards).Run(bgCtx, cfg.MetricsBatchFlushInterval)
+		log.Printf("batching latency observations in %d shards", cfg.MetricsBatchShards)
+	}
+
 	// ── gRPC server ──────────────────────────────────────────
-	grpcServer := grpc.NewServer(
+	interceptors := []grpc.UnaryServerInterceptor{grpcprom.UnaryServerInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{grpcprom.StreamServerInterceptor}
+	switch cfg.GRPCCompression {
+	case "":
+	case gzip.Name:
+		interceptors = append(interceptors, compressInterceptor(gzip.Name))
+	default:
+		log.Fatalf("unsupported GRPC_COMPRESSION %q", cfg.GRPCCompression)
+	}
+	var clientUsage *usage.Recorder
+	adminAuth := false // whether AdminService calls are limited to admins
+	if cfg.HMACKeysFile != "" {
+		keys, err := auth.LoadKeys(cfg.HMACKeysFile)
+		if err != nil {
+			log.Fatalf("failed to load HMAC keys: %v", err)
+		}
+		verifier := auth.NewVerifier(keys, cfg.HMACMaxSkew, pb.RateLimitService_HealthCheck_FullMethodName)
+		interceptors = append(interceptors, verifier.UnaryServerInterceptor)
+		streamInterceptors = append(streamInterceptors, verifier.StreamServerInterceptor)
+		log.Printf("HMAC request signing enabled for %d clients", len(keys))
+		if cfg.HMACAdminClients != "" {
+			admins := strings.Split(cfg.HMACAdminClients, ",")
+			for _, id := range admins {
+				if _, ok := keys[id]; !ok {
+					log.Fatalf("HMAC_ADMIN_CLIENTS: %q has no key in %s", id, cfg.HMACKeysFile)
+				}
+			}
+			verifier.Restrict(admins, pb.AdminService_ServiceDesc.ServiceName)
+			adminAuth = true
+			log.Printf("AdminService restricted to %s", cfg.HMACAdminClients)
+		}
+
+		// Per-service-account API quotas and chargeback usage
+		var quotas *apiquota.Config
+		if cfg.APIQuotaFile != "" {
+			if quotas, err = apiquota.Load(cfg.APIQuotaFile); err != nil {
+				log.Fatalf("failed to load API quotas: %v", err)
+			}
+			log.Printf("API quotas enabled for %d clients", len(quotas.Clients))
+		}
+		clientUsage = usage.NewClientRecorder(rdb, cfg.UsageRetention)
+		go func() {
+			clientUsage.Run(bgCtx, cfg.UsageFlushInterval)
+			close(clientUsageDone)
+		}()
+		enforcer := apiquota.NewEnforcer(tb, quotas, clientUsage, pb.RateLimitService_HealthCheck_FullMethodName)
+		interceptors = append(interceptors, enforcer.UnaryServerInterceptor)
+		streamInterceptors = append(streamInterceptors, enforcer.StreamServerInterceptor)
+	} else {
+		if cfg.APIQuotaFile != "" {
+			log.Fatalf("API_QUOTA_FILE requires HMAC_KEYS_FILE to identify clients")
+		}
+		if cfg.HMACAdminClients != "" {
+			log.Fatalf("HMAC_ADMIN_CLIENTS requires HMAC_KEYS_FILE to identify clients")
+		}
+		close(clientUsageDone)
+	}
+	if cfg.ChaosAdmin && !adminAuth {
+		log.Fatalf("CHAOS_ADMIN requires HMAC_ADMIN_CLIENTS, so that only admins change faults")
+	}
+	if cfg.ScriptReloadAdmin && !adminAuth {
+		log.Fatalf("SCRIPT_RELOAD_ADMIN requires HMAC_ADMIN_CLIENTS, so that only admins reload scripts")
+	}
+	if cfg.UIPassword != "" && !adminAuth {
+		log.Fatalf("UI_PASSWORD requires HMAC_ADMIN_CLIENTS, as the dashboard changes boosts like the AdminService")
+	}
+	if cfg.ScriptReloadAdmin && cfg.LuaScriptsDir == "" {
+		log.Fatalf("SCRIPT_RELOAD_ADMIN requires LUA_SCRIPTS_DIR, whose SHA256SUMS pins the scripts it accepts")
+	}
+	interceptors = append(interceptors, logInterceptor(logs))
+
+	grpcServer := grpc.NewServer(append(transportOptions(cfg),
 		grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize),
 		grpc.MaxConcurrentStreams(uint32(cfg.MaxConcurrent)),
 		grpc.KeepaliveParams(keepalive.ServerParameters{
@@ -85,17 +409,185 @@ func main() {
 			MinTime:             10 * time.Second,
 			PermitWithoutStream: true,
 		}),
-		grpc.ChainUnaryInterceptor(
-			grpcprom.UnaryServerInterceptor,
-			unaryLogInterceptor,
-		),
-	)
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+		grpc.ForceServerCodec(server.Codec{}), // recycles AllowResponses
+	)...)
 
 	// Register gRPC Prometheus metrics
 	grpcprom.Register(grpcServer)
 
-	rlServer := server.NewRateLimitServer(tb)
+	var normalizers []string
+	if cfg.KeyNormalizers != "" {
+		normalizers = strings.Split(cfg.KeyNormalizers, ",")
+	}
+	norm, err := keynorm.New(normalizers)
+	if err != nil {
+		log.Fatalf("KEY_NORMALIZERS: %v", err)
+	}
+	if norm != nil {
+		log.Printf("normalizing keys with %s", strings.Join(norm.Names(), ","))
+	}
+
+	opts := []server.Option{
+		server.WithDefaultNamespace(cfg.DefaultNamespace),
+		server.WithKeyNormalizer(norm),
+		server.WithRules(ruleSet),
+		server.WithTenants(tenants),
+		server.WithUsage(usageRec),
+		server.WithPrefixUsage(prefixUsage),
+		server.WithBoosts(boosts),
+		server.WithKeyTraces(traces),
+		server.WithDecisionHistory(history),
+		server.WithDenylist(deny),
+		server.WithMaintenance(maint),
+		server.WithGlobal(coord),
+	}
+	if ruleSet.HasAlerts() {
+		alerts := alert.NewNotifier(nil)
+		go alerts.Run(bgCtx)
+		opts = append(opts, server.WithAlerts(alerts))
+	}
+	if cfg.AnomalyFactor > 0 {
+		if cfg.AnomalyThrottle <= 0 || cfg.AnomalyThrottle >= 1 {
+			log.Fatalf("ANOMALY_THROTTLE must be between 0 and 1, got %g", cfg.AnomalyThrottle)
+		}
+		detector := anomaly.NewDetector(rdb, boosts, anomaly.Config{
+			Window:     cfg.AnomalyWindow,
+			Baseline:   cfg.AnomalyBaseline,
+			Factor:     cfg.AnomalyFactor,
+			MinRate:    cfg.AnomalyMinRate,
+			Multiplier: cfg.AnomalyThrottle,
+			Duration:   cfg.AnomalyThrottleFor,
+		})
+		go detector.Run(bgCtx)
+		opts = append(opts, server.WithAnomalyDetector(detector))
+		log.Printf("throttling keys above %gx their baseline rate", cfg.AnomalyFactor)
+	}
+	if cfg.GreylistProbation > 0 {
+		if cfg.GreylistMultiplier <= 0 || cfg.GreylistMultiplier >= 1 {
+			log.Fatalf("GREYLIST_MULTIPLIER must be between 0 and 1, got %g", cfg.GreylistMultiplier)
+		}
+		opts = append(opts, server.WithGreylist(greylist.New(rdb, greylist.Config{
+			Probation:    cfg.GreylistProbation,
+			Multiplier:   cfg.GreylistMultiplier,
+			ExpectedKeys: cfg.GreylistExpectedKeys,
+		})))
+		log.Printf("new keys get %gx their limits for %v", cfg.GreylistMultiplier, cfg.GreylistProbation)
+	}
+	if cfg.SchedulerMaxInFlight > 0 {
+		opts = append(opts, server.WithScheduler(scheduler.NewFair(cfg.SchedulerMaxInFlight, func(name string) int {
+			if t, ok := tenants.Get(name); ok && t.Weight > 0 {
+				return t.Weight
+			}
+			return 1
+		})))
+	}
+	if cfg.AllowTokenReturns {
+		opts = append(opts, server.WithTokenReturns(cfg.TokenReturnTTL))
+	}
+	if cfg.IdempotencyTTL > 0 {
+		opts = append(opts, server.WithIdempotency(cfg.IdempotencyTTL))
+	}
+	if cfg.QueueMaxLength > 0 {
+		opts = append(opts, server.WithQueue(cfg.QueueMaxLength, cfg.QueueTicketTTL))
+	}
+	leaseDone := make(chan struct{})
+	if cfg.LeaseThreshold > 0 {
+		leaser := limiter.NewLeaser(tb, cfg.LeaseThreshold, cfg.LeaseChunk, cfg.LeaseTTL)
+		go func() {
+			leaser.Run(bgCtx, cfg.LeaseTTL)
+			close(leaseDone)
+		}()
+		opts = append(opts, server.WithLeaser(leaser))
+		log.Printf("token leasing enabled above %d req/s per key", cfg.LeaseThreshold)
+	} else {
+		close(leaseDone)
+	}
+	if cfg.LatencyBudget > 0 {
+		budget := limiter.NewBudgeter(tb, cfg.LatencyBudget)
+		go budget.Run(bgCtx, time.Minute)
+		opts = append(opts, server.WithLatencyBudget(budget))
+		log.Printf("latency-critical requests answered within %v", cfg.LatencyBudget)
+	}
+
+	// Warm up before serving; HealthCheck reports NOT_SERVING until then
+	warmer := limiter.NewWarmer(tb, max(cfg.RedisMinIdleConns, 1), cfg.WarmupEvals)
+	warmCtx, warmCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := warmer.Warm(warmCtx); err != nil {
+		log.Printf("limiter warm-up failed, retrying in the background: %v", err)
+	} else {
+		log.Printf("limiter warmed up (%d connections, %d evals)", max(cfg.RedisMinIdleConns, 1), cfg.WarmupEvals)
+	}
+	warmCancel()
+	go warmer.Run(bgCtx, time.Second)
+	opts = append(opts, server.WithWarmer(warmer))
+
+	if cfg.RedisMaxKeys > 0 || cfg.RedisMaxMemoryMB > 0 {
+		guard := limiter.NewGuard(tb, limiter.GuardConfig{
+			MaxKeys:   cfg.RedisMaxKeys,
+			MaxMemory: cfg.RedisMaxMemoryMB << 20,
+		})
+		go guard.Run(bgCtx, cfg.RedisGuardInterval)
+		log.Printf("evicting idle buckets past %d keys or %d MB per Redis node", cfg.RedisMaxKeys, cfg.RedisMaxMemoryMB)
+	}
+	if cfg.CleanupIdle > 0 {
+		go limiter.NewCleaner(tb, cfg.CleanupIdle, cfg.CleanupKeysPerSecond).Run(bgCtx, cfg.CleanupInterval)
+		log.Printf("deleting buckets idle for %v every %v", cfg.CleanupIdle, cfg.CleanupInterval)
+	}
+
+	var top *topkeys.Tracker
+	if cfg.UIPassword != "" {
+		top = topkeys.New(cfg.TopKeysWindow)
+		go top.Run(bgCtx)
+		opts = append(opts, server.WithTopKeys(top))
+	}
+
+	// ── Diagnostics ──────────────────────────────────────────
+	dumper := diag.New(cfg.DiagDir)
+	dumper.Add("limiter", func(context.Context) any { return tb.Diagnostics() })
+	dumper.Add("redis_pool", func(context.Context) any { return rdb.PoolStats() })
+	dumper.Add("rules", func(context.Context) any {
+		return map[string]any{"file": cfg.RulesFile, "version": ruleSet.Version(), "count": ruleSet.Len(), "sliding_windows": ruleSet.SlidingWindows()}
+	})
+	dumper.Add("tenants", func(context.Context) any { return map[string]int{"count": len(tenants.List())} })
+	dumper.Add("boosts", func(context.Context) any { return boosts.List() })
+	dumper.Add("denylist", func(context.Context) any { return map[string]int{"count": deny.Len()} })
+	dumper.Add("maintenance", func(context.Context) any { return maint.State() })
+	dumper.Add("log_level", func(context.Context) any {
+		l, revertAt := logs.State()
+		return map[string]any{"level": l.String(), "revert_at": revertAt}
+	})
+	dumper.Add("warmed_up", func(context.Context) any { return warmer.Ready() })
+	if faults != nil {
+		dumper.Add("faults", func(context.Context) any { return faults.Config() })
+	}
+	if top != nil {
+		dumper.Add("top_keys", func(context.Context) any { return top.Last(20) })
+	}
+	go dumper.Notify(bgCtx)
+
+	rlServer := server.NewRateLimitServer(tb, opts...)
+	adminOpts := []server.AdminOption{server.WithAdminDefaultNamespace(cfg.DefaultNamespace)}
+	if cfg.AnomalyFactor > 0 {
+		adminOpts = append(adminOpts, server.WithAnomalyAudit(rdb))
+	}
+	if cfg.ScriptReloadAdmin {
+		adminOpts = append(adminOpts, server.WithScriptReloads(cfg.LuaScriptsDir))
+	}
+	adminServer := server.NewAdminServer(tb, tenants, usageRec, boosts, clientUsage, faults, maint, logs, ruleSet, prefixUsage, dumper, traces, history, deny, adminOpts...)
 	pb.RegisterRateLimitServiceServer(grpcServer, rlServer)
+	// Anyone reaching the port could otherwise delete tenants and buckets
+	// or, through the dashboard, boost keys
+	if adminAuth {
+		pb.RegisterAdminServiceServer(grpcServer, adminServer)
+		if top != nil {
+			mux.Handle("/ui/", http.StripPrefix("/ui", webui.Handler(adminServer, top, cfg.UIUser, cfg.UIPassword)))
+			log.Printf("dashboard served on :%s/ui/", cfg.MetricsPort)
+		}
+	} else {
+		log.Printf("AdminService not served: it needs HMAC_KEYS_FILE and HMAC_ADMIN_CLIENTS")
+	}
 	reflection.Register(grpcServer) // for grpcurl/debugging
 
 	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
@@ -116,27 +608,89 @@ func main() {
 	sig := <-quit
 	log.Printf("received signal %v, shutting down...", sig)
 
-	grpcServer.GracefulStop()
+	if !server.GracefulStop(grpcServer, cfg.ShutdownDrain) {
+		log.Printf("calls still running after %v were cut off", cfg.ShutdownDrain)
+	}
+	bgCancel()
+	<-usageDone // final usage flushes need Redis
+	<-clientUsageDone
+	<-prefixUsageDone
+	<-leaseDone // unused leased tokens go back to their buckets
+	<-tunerDone
+	if tuner != nil {
+		tuner.Close()
+	} else if limiterRDB != rdb {
+		limiterRDB.Close()
+	}
+	if cluster != nil {
+		cluster.Close()
+	}
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 	metricsSrv.Shutdown(shutdownCtx)
 	rdb.Close()
+	if devRedis != nil {
+		devRedis.Close()
+	}
 
 	log.Println("server stopped")
 }
 
-// unaryLogInterceptor logs slow requests (>50ms).
-func unaryLogInterceptor(
-	ctx context.Context,
-	req interface{},
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler,
-) (interface{}, error) {
-	start := time.Now()
-	resp, err := handler(ctx, req)
-	dur := time.Since(start)
-	if dur > 50*time.Millisecond {
-		log.Printf("SLOW %s took %v", info.FullMethod, dur)
-	}
-	return resp, err
+// logInterceptor logs slow requests (>50ms) at Info, and every request
+// with its response at Debug.
+func logInterceptor(logs *loglevel.Control) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		dur := time.Since(start)
+		switch {
+		case logs.Enabled(loglevel.Debug):
+			if err != nil {
+				log.Printf("%s {%v} took %v: %v", info.FullMethod, req, dur, err)
+			} else {
+				log.Printf("%s {%v} took %v: {%v}", info.FullMethod, req, dur, resp)
+			}
+		case dur > 50*time.Millisecond && logs.Enabled(loglevel.Info):
+			log.Printf("SLOW %s took %v", info.FullMethod, dur)
+		}
+		return resp, err
+	}
+}
+
+// transportOptions returns the gRPC transport settings that override
+// gRPC's defaults.
+func transportOptions(cfg *config.Config) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if cfg.GRPCNumStreamWorkers > 0 {
+		opts = append(opts, grpc.NumStreamWorkers(uint32(cfg.GRPCNumStreamWorkers)))
+	}
+	if cfg.GRPCInitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(int32(cfg.GRPCInitialWindowSize)))
+	}
+	if cfg.GRPCInitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(int32(cfg.GRPCInitialConnWindowSize)))
+	}
+	if cfg.GRPCWriteBufferSize > 0 {
+		opts = append(opts, grpc.WriteBufferSize(cfg.GRPCWriteBufferSize))
+	}
+	if cfg.GRPCReadBufferSize > 0 {
+		opts = append(opts, grpc.ReadBufferSize(cfg.GRPCReadBufferSize))
+	}
+	return opts
+}
+
+// compressInterceptor compresses responses with the named compressor for
+// clients that accept it.
+func compressInterceptor(name string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if accepted, err := grpc.ClientSupportedCompressors(ctx); err == nil {
+			for _, c := range accepted {
+				if c == name {
+					grpc.SetSendCompressor(ctx, name)
+					break
+				}
+			}
+		}
+		return handler(ctx, req)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+var allowResponsePool = sync.Pool{
+	New: func() interface{} { return new(pb.AllowResponse) },
+}
+
+// newAllowResponse returns a zeroed response from the pool. Responses go
+// back to the pool once Codec has marshaled them.
+func newAllowResponse() *pb.AllowResponse {
+	return allowResponsePool.Get().(*pb.AllowResponse)
+}
+
+// vtMessage is implemented by messages with vtprotobuf's generated
+// marshaling code (see `make proto`), which skips proto reflection.
+type vtMessage interface {
+	MarshalVT() ([]byte, error)
+	UnmarshalVT([]byte) error
+}
+
+// Codec is the standard proto codec, except that it uses vtprotobuf's
+// generated code when present and recycles AllowResponse messages as soon
+// as they're on the wire, taking the hottest allocation off the serving
+// path. Install it with grpc.ForceServerCodec. It is unsafe with stats
+// handlers or binary logging that inspect outgoing messages.
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	var (
+		b   []byte
+		err error
+	)
+	switch m := v.(type) {
+	case vtMessage:
+		b, err = m.MarshalVT()
+	case proto.Message:
+		b, err = proto.Marshal(m)
+	default:
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	if r, ok := v.(*pb.AllowResponse); ok {
+		r.Reset()
+		allowResponsePool.Put(r)
+	}
+	return b, err
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case vtMessage:
+		return m.UnmarshalVT(data)
+	case proto.Message:
+		return proto.Unmarshal(data, m)
+	default:
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+}
+
+// Name keeps the standard content type, so clients need no changes.
+func (Codec) Name() string {
+	return "proto"
+}
\ No newline at end of file
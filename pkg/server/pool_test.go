@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+func TestCodec_RecyclesAllowResponse(t *testing.T) {
+	resp := newAllowResponse()
+	resp.Allowed = true
+	resp.Remaining = 7
+
+	b, err := Codec{}.Marshal(resp)
+	require.NoError(t, err)
+
+	got := &pb.AllowResponse{}
+	require.NoError(t, Codec{}.Unmarshal(b, got))
+	assert.True(t, got.Allowed)
+	assert.Equal(t, int64(7), got.Remaining)
+
+	// Recycled responses come back zeroed.
+	assert.False(t, newAllowResponse().Allowed)
+}
+
+// vtAllowResponse stands in for a message with generated vtprotobuf code.
+type vtAllowResponse struct {
+	*pb.AllowResponse
+	unmarshaled []byte
+}
+
+func (m *vtAllowResponse) MarshalVT() ([]byte, error) { return []byte("vt"), nil }
+
+func (m *vtAllowResponse) UnmarshalVT(b []byte) error {
+	m.unmarshaled = b
+	return nil
+}
+
+func TestCodec_PrefersVTProto(t *testing.T) {
+	m := &vtAllowResponse{AllowResponse: &pb.AllowResponse{Allowed: true}}
+
+	b, err := Codec{}.Marshal(m)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("vt"), b)
+
+	require.NoError(t, Codec{}.Unmarshal([]byte("in"), m))
+	assert.Equal(t, []byte("in"), m.unmarshaled)
+
+	_, err = Codec{}.Marshal("not a message")
+	assert.Error(t, err)
+}
+
+func BenchmarkAllowResponse(b *testing.B) {
+	b.Run("new", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(p *testing.PB) {
+			for p.Next() {
+				resp := &pb.AllowResponse{Allowed: true, Remaining: 99, Limit: 100, ResetAt: 1700000000}
+				proto.Marshal(resp)
+			}
+		})
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(p *testing.PB) {
+			for p.Next() {
+				resp := newAllowResponse()
+				resp.Allowed, resp.Remaining, resp.Limit, resp.ResetAt = true, 99, 100, 1700000000
+				Codec{}.Marshal(resp)
+			}
+		})
+	})
+}
\ No newline at end of file
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+// queuePoll is how often queued requests check their position.
+const queuePoll = 50 * time.Millisecond
+
+// queueStream is the server side of Enqueue and WatchTicket streams.
+type queueStream interface {
+	Context() context.Context
+	Send(*pb.QueueEvent) error
+}
+
+// Enqueue queues a request until its key's limits admit it. The first
+// event carries the request's ticket, which WatchTicket resumes on.
+func (s *RateLimitServer) Enqueue(req *pb.AllowRequest, stream pb.RateLimitService_EnqueueServer) error {
+	if s.queueMax == 0 {
+		return status.Error(codes.FailedPrecondition, "queueing is disabled")
+	}
+	ctx := stream.Context()
+	// Encoded before admit normalizes the key, as WatchTicket admits the
+	// request again
+	raw, err := req.MarshalVT()
+	if err != nil {
+		return status.Errorf(codes.Internal, "encode request: %v", err)
+	}
+	l, err := s.admit(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	t := &limiter.Ticket{ID: newTicketID(), Key: l.key, Since: time.Now().UnixMilli(), Request: raw}
+	pos, err := s.limiter.Enqueue(ctx, t, s.queueMax, s.queueTTL)
+	if errors.Is(err, limiter.ErrQueueFull) {
+		return status.Errorf(codes.ResourceExhausted, "queue of %q is full", req.Key)
+	}
+	if err != nil {
+		metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+		return status.Errorf(codes.Internal, "enqueue failed: %v", err)
+	}
+	if err := stream.Send(&pb.QueueEvent{Ticket: t.ID, Position: pos}); err != nil {
+		return err
+	}
+	return s.await(stream, l, req, t, pos)
+}
+
+// WatchTicket resumes waiting on a ticket from Enqueue, on this server or
+// another.
+func (s *RateLimitServer) WatchTicket(req *pb.WatchTicketRequest, stream pb.RateLimitService_WatchTicketServer) error {
+	if s.queueMax == 0 {
+		return status.Error(codes.FailedPrecondition, "queueing is disabled")
+	}
+	ctx := stream.Context()
+	t, err := s.loadTicket(ctx, req.Ticket)
+	if err != nil {
+		return err
+	}
+	if t.Response != nil {
+		return sendAdmitted(stream, t)
+	}
+
+	areq := &pb.AllowRequest{}
+	if err := areq.UnmarshalVT(t.Request); err != nil {
+		return status.Errorf(codes.Internal, "decode ticket %q: %v", t.ID, err)
+	}
+	// Tenants may have been suspended, or keys denylisted, since
+	l, err := s.admit(ctx, areq)
+	if err != nil {
+		return err
+	}
+	return s.await(stream, l, areq, t, -1)
+}
+
+// await holds t's request in its queue until its key's limits admit it,
+// reporting its position whenever it differs from last. Only the waiter at
+// the head of a queue asks the limits, and it waits out their retry delay
+// before asking again, so queues drain in order at their key's rate.
+func (s *RateLimitServer) await(stream queueStream, l *limits, req *pb.AllowRequest, t *limiter.Ticket, last int64) error {
+	ctx := stream.Context()
+	var (
+		wait time.Duration
+		// Denials add reasons of their own
+		reasons = len(l.reasons)
+	)
+	for {
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-time.After(wait):
+			}
+		}
+		wait = queuePoll
+
+		pos, err := s.limiter.QueuePosition(ctx, t, s.queueTTL)
+		if errors.Is(err, limiter.ErrNotQueued) {
+			// Another waiter on t admitted it
+			if t, err = s.loadTicket(ctx, t.ID); err != nil {
+				return err
+			}
+			if t.Response != nil {
+				return sendAdmitted(stream, t)
+			}
+			return status.Errorf(codes.Aborted, "ticket %q left its queue", t.ID)
+		}
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+			return status.Errorf(codes.Internal, "queue check failed: %v", err)
+		}
+		if pos != last {
+			if err := stream.Send(&pb.QueueEvent{Ticket: t.ID, Position: pos}); err != nil {
+				return err
+			}
+			last = pos
+		}
+		if pos > 0 {
+			continue
+		}
+
+		ok, err := s.limiter.ClaimTicket(ctx, t, s.queueTTL)
+		if err != nil {
+			metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+			return status.Errorf(codes.Internal, "ticket claim failed: %v", err)
+		}
+		if !ok {
+			continue
+		}
+		res, err := s.consume(ctx, l, cost(req), false)
+		if err != nil || !res.Allowed {
+			if err := s.limiter.ReleaseTicket(context.WithoutCancel(ctx), t); err != nil {
+				metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+				return status.Errorf(codes.Internal, "ticket release failed: %v", err)
+			}
+			if err != nil {
+				return err
+			}
+			// Waits are capped to keep touching the ticket in time
+			retry := time.Duration(res.RetryAfter * float64(time.Second))
+			wait = max(queuePoll, min(retry, s.queueTTL/2))
+			l.reasons = l.reasons[:reasons]
+			continue
+		}
+
+		l.reasons = append(l.reasons, "queued")
+		resp := s.respond(l, req, res)
+		raw, err := resp.MarshalVT()
+		if err == nil {
+			err = s.limiter.AdmitTicket(context.WithoutCancel(ctx), t, raw, s.queueTTL)
+		}
+		if err != nil {
+			// Waiters resuming on t wait for its claim to expire, then
+			// charge it again
+			metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+			log.Printf("record admission of ticket %q: %v", t.ID, err)
+		}
+		return stream.Send(&pb.QueueEvent{Ticket: t.ID, Response: resp})
+	}
+}
+
+// loadTicket returns ticket id, failing with NotFound once it expired.
+func (s *RateLimitServer) loadTicket(ctx context.Context, id string) (*limiter.Ticket, error) {
+	t, err := s.limiter.LoadTicket(ctx, id)
+	if errors.Is(err, limiter.ErrNoTicket) {
+		return nil, status.Errorf(codes.NotFound, "ticket %q not found", id)
+	}
+	if err != nil {
+		metrics.InternalErrors.WithLabelValues("Enqueue", "redis").Inc()
+		return nil, status.Errorf(codes.Internal, "ticket lookup failed: %v", err)
+	}
+	return t, nil
+}
+
+// sendAdmitted replays the response recorded when t was admitted.
+func sendAdmitted(stream queueStream, t *limiter.Ticket) error {
+	resp := &pb.AllowResponse{}
+	if err := resp.UnmarshalVT(t.Response); err != nil {
+		return status.Errorf(codes.Internal, "decode response to ticket %q: %v", t.ID, err)
+	}
+	return stream.Send(&pb.QueueEvent{Ticket: t.ID, Response: resp})
+}
+
+// newTicketID returns an unguessable ticket ID, as tickets are all it
+// takes to wait on a request.
+func newTicketID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
\ No newline at end of file
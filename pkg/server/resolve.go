@@ -0,0 +1,242 @@
+package server
+
+import (
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/boost"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/metrics"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+)
+
+// limits is the effective configuration of one Allow or Peek call.
+type limits struct {
+	namespace string
+	key       string // limiter key, namespace and named bucket applied
+	base      string // limiter key without the named bucket
+	subnet    string // limiter key of the address's network, if aggregated
+	tenant    *tenant.Tenant
+	rule      *rules.Rule
+
+	keyBoost    *boost.Boost
+	tenantBoost *boost.Boost
+
+	burst int64
+	rate  float64
+
+	// reasons are reported in the AllowResponse
+	reasons []string
+	// binding is the chain link that decided an Allow call, if any
+	binding string
+}
+
+// resolve computes the effective limits of a request on key's bucket, or
+// on its named bucket when bucket is set. Burst and rate come from the
+// first source that sets them: client override (bounded by the prefix
+// rule), named bucket, tenant default, prefix rule default, server
+// default. An open scheduled window multiplies them, active tenant and key
+// boosts are applied on top, then global limits are cut down to this
+// region's share.
+func (s *RateLimitServer) resolve(namespace, key, bucket string, burst int64, rate float64) (*limits, error) {
+	ns, bk, err := s.bucketKey(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	l := &limits{
+		namespace: ns,
+		key:       bk,
+		base:      bk,
+		tenant:    s.tenant(ns),
+		rule:      s.rules.Match(key),
+	}
+	var named *rules.Bucket
+	if bucket != "" {
+		if named, err = l.rule.Bucket(bucket); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v %q for %q keys", err, bucket, metrics.KeyPrefix(key))
+		}
+		l.key = limiter.BucketKey(bk, bucket)
+	}
+	if l.rule != nil {
+		if network := l.rule.Subnet.Network(key); network != "" {
+			l.subnet = limiter.BucketKey(limiter.Key(ns, network), rules.SubnetBucket)
+		}
+	}
+
+	burst, rate, err = l.rule.ApplyOverrides(burst, rate)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v for %q keys", err, metrics.KeyPrefix(key))
+	}
+	burst, rate = named.Defaults(burst, rate)
+	burst, rate = tenantDefaults(l.tenant, burst, rate)
+	burst, rate = l.rule.Defaults(burst, rate)
+	defBurst, defRate := s.limiter.Defaults()
+	if burst <= 0 {
+		burst = defBurst
+	}
+	if rate <= 0 {
+		rate = defRate
+	}
+	if w := s.rules.Window(key, time.Now()); w != nil {
+		burst, rate = w.Apply(burst, rate)
+		l.reasons = append(l.reasons, "window:"+w.Name)
+	}
+
+	if ns != "" {
+		l.tenantBoost = s.boosts.Get(limiter.TenantKey(ns))
+	}
+	l.keyBoost = s.boosts.Get(bk)
+	burst, rate = l.tenantBoost.Apply(burst, rate)
+	l.burst, l.rate = l.keyBoost.Apply(burst, rate)
+	if l.boost() != nil {
+		l.reasons = append(l.reasons, "boost")
+	}
+	if l.global() {
+		l.burst, l.rate = s.global.Share(l.key, l.burst, l.rate)
+	}
+	return l, nil
+}
+
+// cooldown returns how long the key's buckets cool down once they run dry.
+func (l *limits) cooldown() time.Duration {
+	if l.rule == nil {
+		return 0
+	}
+	return l.rule.Cooldown
+}
+
+// spacing returns the minimum interval between the key's admitted tokens.
+func (l *limits) spacing() time.Duration {
+	if l.rule == nil {
+		return 0
+	}
+	return l.rule.Spacing
+}
+
+// global reports whether the key's limits are shared between regions.
+func (l *limits) global() bool {
+	return l.rule != nil && l.rule.Global
+}
+
+// subnetApart reports whether the bucket of the key's network is in
+// another Redis Cluster slot than the key's, as for keys outside every
+// namespace, and so can't be charged in the same script call.
+func (l *limits) subnetApart() bool {
+	return l.subnet != "" && l.namespace == ""
+}
+
+// buckets returns the buckets an Allow call consumes from: the key's own
+// bucket, the tenant's aggregate cap when configured, the bucket of the
+// key's network when aggregated and in the key's slot, then the token
+// bucket links of the rule's chain.
+func (l *limits) buckets() []limiter.Bucket {
+	b := []limiter.Bucket{{Key: l.key, Burst: l.burst, Rate: l.rate}}
+	if l.tenant != nil && l.tenant.HasCap() {
+		capBurst, capRate := l.tenantBoost.Apply(l.tenant.CapBurst, l.tenant.CapRate)
+		b = append(b, limiter.Bucket{Key: limiter.TenantKey(l.namespace), Burst: capBurst, Rate: capRate})
+	}
+	if l.subnet != "" && !l.subnetApart() {
+		b = append(b, limiter.Bucket{Key: l.subnet, Burst: l.rule.Subnet.Burst, Rate: l.rule.Subnet.Rate})
+	}
+	for _, link := range l.rule.ChainBuckets() {
+		b = append(b, limiter.Bucket{Key: limiter.BucketKey(l.base, link.Name), Burst: link.Burst, Rate: link.Rate})
+	}
+	return b
+}
+
+// link returns the name of the chain link behind the i-th of n buckets
+// returned by buckets, rules.SubnetBucket for the network's bucket, or ""
+// for the key's own bucket and the tenant cap.
+func (l *limits) link(i, n int) string {
+	links := l.rule.ChainBuckets()
+	j := i - (n - len(links))
+	switch {
+	case j >= 0:
+		return links[j].Name
+	case j == -1 && l.subnet != "" && !l.subnetApart():
+		return rules.SubnetBucket
+	}
+	return ""
+}
+
+// quota is a window quota an Allow call is charged for once its buckets
+// admit it: fixed, or sliding with subWindows.
+type quota struct {
+	link       string // chain link name, "" for the tenant's quota
+	key        string
+	limit      int64
+	period     time.Duration
+	rollover   float64
+	subWindows int
+}
+
+// quotas returns the quotas an Allow call is charged for: the tenant's
+// when configured, then the quota links of the rule's chain.
+func (l *limits) quotas() []quota {
+	var q []quota
+	if t := l.tenant; t != nil && t.HasQuota() {
+		q = append(q, quota{key: l.key, limit: t.QuotaLimit, period: t.QuotaPeriod, rollover: t.QuotaRollover})
+	}
+	for _, link := range l.rule.ChainQuotas() {
+		q = append(q, quota{link: link.Name, key: limiter.BucketKey(l.base, link.Name), limit: link.Quota, period: link.Period, subWindows: link.SubWindows})
+	}
+	return q
+}
+
+// boost returns the most specific active boost.
+func (l *limits) boost() *boost.Boost {
+	if l.keyBoost != nil {
+		return l.keyBoost
+	}
+	return l.tenantBoost
+}
+
+// bucketKey validates the request's namespace and key and combines them
+// into the limiter key. It also returns the effective namespace.
+func (s *RateLimitServer) bucketKey(namespace, key string) (string, string, error) {
+	if key == "" {
+		return "", "", status.Error(codes.InvalidArgument, "key is required")
+	}
+	if namespace == "" {
+		namespace = s.defaultNamespace
+	}
+	if err := limiter.ValidateKey(namespace, key); err != nil {
+		return "", "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return namespace, limiter.Key(namespace, key), nil
+}
+
+// tenant returns the registered tenant for namespace, or nil.
+func (s *RateLimitServer) tenant(namespace string) *tenant.Tenant {
+	if s.tenants == nil || namespace == "" {
+		return nil
+	}
+	t, _ := s.tenants.Get(namespace)
+	return t
+}
+
+// schedulingKey groups requests for fair scheduling: by namespace when set,
+// otherwise by key prefix.
+func schedulingKey(namespace, key string) string {
+	if namespace != "" {
+		return namespace
+	}
+	return metrics.KeyPrefix(key)
+}
+
+// tenantDefaults fills unset burst/rate overrides from the tenant.
+func tenantDefaults(t *tenant.Tenant, burst int64, rate float64) (int64, float64) {
+	if t == nil {
+		return burst, rate
+	}
+	if burst <= 0 {
+		burst = t.Burst
+	}
+	if rate <= 0 {
+		rate = t.Rate
+	}
+	return burst, rate
+}
\ No newline at end of file
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// GracefulStop stops s from accepting new calls and waits up to drain for
+// the ones in flight to finish, then closes the connections still open. It
+// reports whether every call finished in time.
+func GracefulStop(s *grpc.Server, drain time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		s.Stop()
+		<-done
+		return false
+	}
+}
\ No newline at end of file
@@ -0,0 +1,101 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"pgregory.net/rapid"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+// traffic draws a run of requests over a couple of keys, some asking for
+// more than the bucket can ever hold.
+func traffic(t *rapid.T, burst int64) []Event {
+	var at time.Duration
+	events := make([]Event, rapid.IntRange(1, 50).Draw(t, "requests"))
+	for i := range events {
+		at += time.Duration(rapid.IntRange(0, 1500).Draw(t, "gap_ms")) * time.Millisecond
+		events[i] = Event{
+			At:     at,
+			Key:    rapid.SampledFrom([]string{"a", "b"}).Draw(t, "key"),
+			Tokens: rapid.Int64Range(1, burst+2).Draw(t, "tokens"),
+		}
+	}
+	return events
+}
+
+func TestProperties(t *testing.T) {
+	for _, alg := range Algorithms {
+		t.Run(alg.Name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+
+			rapid.Check(t, func(t *rapid.T) {
+				burst := rapid.Int64Range(1, 20).Draw(t, "burst")
+				rate := rapid.Float64Range(0.1, 50).Draw(t, "rate")
+				events := traffic(t, burst)
+
+				mr.FlushAll()
+				clock := NewClock(time.Unix(1700000000, 0))
+				tb := limiter.New(rdb, 1, 1, limiter.WithClock(clock))
+				decisions, err := Run(context.Background(), clock, alg.Build(tb, burst, rate), events)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Every decision, limit, remaining count and wait matches an
+				// exact token bucket.
+				inv := Invariants{Burst: burst, Rate: rate, Epsilon: 0.01}
+				if err := inv.Check(decisions); err != nil {
+					t.Fatal(err)
+				}
+
+				for i, d := range decisions {
+					// No window lets through more than burst plus its refill.
+					var allowed int64
+					for _, e := range decisions[i:] {
+						if e.Key != d.Key || !e.Allowed {
+							continue
+						}
+						allowed += e.Tokens
+						if window := (e.At - d.At).Seconds(); float64(allowed) > float64(burst)+rate*window+0.01 {
+							t.Fatalf("%s: %d tokens allowed in %vs", d.Key, allowed, window)
+						}
+					}
+
+					// Remaining never rises without time passing, and drops by
+					// exactly what's allowed.
+					for _, next := range decisions[i+1:] {
+						if next.Key != d.Key {
+							continue
+						}
+						if next.At == d.At {
+							want := d.Result.Remaining
+							if next.Allowed {
+								want -= next.Tokens
+							}
+							if next.Result.Remaining != want {
+								t.Fatalf("%s at %v: %d remaining after %d, want %d", d.Key, d.At, next.Result.Remaining, d.Result.Remaining, want)
+							}
+						}
+						break
+					}
+
+					// A denial's wait is never zero, and requests larger than the
+					// bucket are never allowed.
+					if !d.Allowed && d.Result.RetryAfter <= 0 {
+						t.Fatalf("%s at %v: denied without a wait", d.Key, d.At)
+					}
+					if d.Tokens > burst && d.Allowed {
+						t.Fatalf("%s at %v: allowed %d tokens from a bucket of %d", d.Key, d.At, d.Tokens, burst)
+					}
+				}
+			})
+		})
+	}
+}
\ No newline at end of file
@@ -0,0 +1,198 @@
+// Package sim drives limiter algorithms with a synthetic clock and scripted
+// traffic, and checks their decisions against an exact token bucket. Runs
+// are deterministic, so they work as plain unit tests.
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+// Clock is a limiter.Clock that only moves when the simulation moves it.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the clock's time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to t.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Decide makes one rate limit decision for tokens of key.
+type Decide func(ctx context.Context, key string, tokens int64) (*limiter.Result, error)
+
+// Algorithm is one way of making decisions that should behave as a token
+// bucket of the given burst and rate, built on a limiter whose scripts use
+// the simulation's clock.
+type Algorithm struct {
+	Name  string
+	Build func(tb *limiter.TokenBucket, burst int64, rate float64) Decide
+}
+
+// Algorithms lists the decision paths with token bucket semantics.
+var Algorithms = []Algorithm{
+	{"token_bucket", func(tb *limiter.TokenBucket, burst int64, rate float64) Decide {
+		return func(ctx context.Context, key string, tokens int64) (*limiter.Result, error) {
+			return tb.Allow(ctx, key, float64(tokens), burst, rate)
+		}
+	}},
+	{"hierarchical", func(tb *limiter.TokenBucket, burst int64, rate float64) Decide {
+		// A tenant cap that never binds must not change the key's decisions.
+		return func(ctx context.Context, key string, tokens int64) (*limiter.Result, error) {
+			res, _, err := tb.AllowAll(ctx, []limiter.Bucket{
+				{Key: limiter.Key("sim", key), Burst: burst, Rate: rate},
+				{Key: limiter.TenantKey("sim"), Burst: 1 << 40, Rate: 1 << 40},
+			}, float64(tokens))
+			return res, err
+		}
+	}},
+	{"batch", func(tb *limiter.TokenBucket, burst int64, rate float64) Decide {
+		return func(ctx context.Context, key string, tokens int64) (*limiter.Result, error) {
+			r := tb.AllowBatch(ctx, []limiter.Check{{Key: key, Tokens: float64(tokens), Burst: burst, Rate: rate}})[0]
+			return r.Result, r.Err
+		}
+	}},
+}
+
+// Event is one request of a traffic pattern, At after the run starts.
+type Event struct {
+	At     time.Duration
+	Key    string
+	Tokens int64
+}
+
+// Decision is the outcome of an Event. Result is the limiter's full
+// answer, when there is one.
+type Decision struct {
+	Event
+	Allowed bool
+	Result  *limiter.Result
+}
+
+// Run plays events in order of At, moving clock to each event's time
+// before deciding it. Events at the same time keep their order.
+func Run(ctx context.Context, clock *Clock, decide Decide, events []Event) ([]Decision, error) {
+	events = append([]Event(nil), events...)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	start := clock.Now()
+	out := make([]Decision, 0, len(events))
+	for _, e := range events {
+		clock.Set(start.Add(e.At))
+		res, err := decide(ctx, e.Key, e.Tokens)
+		if err != nil {
+			return out, fmt.Errorf("event at %v: %w", e.At, err)
+		}
+		out = append(out, Decision{Event: e, Allowed: res.Allowed, Result: res})
+	}
+	return out, nil
+}
+
+// Invariants describe the token bucket every key's decisions must match.
+type Invariants struct {
+	Burst int64
+	Rate  float64
+
+	// Epsilon is the slack, in tokens, allowed for rounding: a decision
+	// only counts as wrong when the exact bucket holds at least Epsilon
+	// more (for a denial) or less (for an allow) than was requested.
+	Epsilon float64
+}
+
+// Check replays decisions against an exact token bucket per key and
+// reports every decision that disagrees: allows that would exceed the
+// bucket, so more than burst plus refill got through, and denials of
+// requests the refill should already have covered. Decisions with a
+// Result must also report the bucket's limit, what it has left and, for
+// denials, how long until the refill covers the request.
+func (inv Invariants) Check(decisions []Decision) error {
+	type bucket struct {
+		tokens float64
+		last   time.Duration
+	}
+	buckets := map[string]*bucket{}
+	var errs []error
+	for _, d := range decisions {
+		b, ok := buckets[d.Key]
+		if !ok {
+			b = &bucket{tokens: float64(inv.Burst), last: d.At}
+			buckets[d.Key] = b
+		}
+		b.tokens = min(float64(inv.Burst), b.tokens+(d.At-b.last).Seconds()*inv.Rate)
+		b.last = d.At
+
+		want := float64(d.Tokens)
+		switch {
+		case d.Allowed && b.tokens < want-inv.Epsilon:
+			errs = append(errs, fmt.Errorf("%s at %v: allowed %d tokens with %.3f available", d.Key, d.At, d.Tokens, b.tokens))
+		case !d.Allowed && b.tokens >= want+inv.Epsilon:
+			errs = append(errs, fmt.Errorf("%s at %v: denied %d tokens with %.3f available", d.Key, d.At, d.Tokens, b.tokens))
+		}
+		if d.Allowed {
+			b.tokens = max(0, b.tokens-want)
+		}
+		if d.Result != nil {
+			if err := inv.checkResult(d, b.tokens); err != nil {
+				errs = append(errs, fmt.Errorf("%s at %v: %w", d.Key, d.At, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkResult checks d's Result against the exact bucket, holding tokens
+// after the decision.
+func (inv Invariants) checkResult(d Decision, tokens float64) error {
+	res := d.Result
+	if res.Limit != inv.Burst {
+		return fmt.Errorf("limit %d, want %d", res.Limit, inv.Burst)
+	}
+	if rem := float64(res.Remaining); rem > tokens+inv.Epsilon || rem < tokens-1-inv.Epsilon {
+		return fmt.Errorf("%d remaining with %.3f available", res.Remaining, tokens)
+	}
+	if d.Allowed || inv.Rate <= 0 {
+		if res.RetryAfter != 0 {
+			return fmt.Errorf("retry after %vs without a denial to wait out", res.RetryAfter)
+		}
+		return nil
+	}
+	// Waits are rounded up to the millisecond.
+	wait := (float64(d.Tokens) - tokens) / inv.Rate
+	slack := inv.Epsilon / inv.Rate
+	if res.RetryAfter < wait-slack || res.RetryAfter > wait+0.001+slack {
+		return fmt.Errorf("retry after %vs, want %.3fs", res.RetryAfter, wait)
+	}
+	return nil
+}
+
+// Allowed returns the tokens allowed for key.
+func Allowed(decisions []Decision, key string) int64 {
+	var n int64
+	for _, d := range decisions {
+		if d.Allowed && d.Key == key {
+			n += d.Tokens
+		}
+	}
+	return n
+}
\ No newline at end of file
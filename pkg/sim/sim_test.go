@@ -0,0 +1,87 @@
+package sim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/limiter"
+)
+
+func newLimiter(t *testing.T) (*limiter.TokenBucket, *Clock) {
+	t.Helper()
+	rdb := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	clock := NewClock(time.Unix(1700000000, 0))
+	return limiter.New(rdb, 10, 1, limiter.WithClock(clock)), clock
+}
+
+func TestAlgorithms(t *testing.T) {
+	const (
+		burst = 10
+		rate  = 4.0
+	)
+	traffic := Merge(
+		Burst("bursty", 0, 15, 1),
+		Steady("bursty", 20, 5*time.Second, 1),
+		Burst("bursty", 8*time.Second, 15, 1),
+		Poisson("random", 10, 10*time.Second, 3, 1),
+		Steady("idle", 0.5, 10*time.Second, 2),
+	)
+	inv := Invariants{Burst: burst, Rate: rate, Epsilon: 0.01}
+
+	for _, alg := range Algorithms {
+		t.Run(alg.Name, func(t *testing.T) {
+			tb, clock := newLimiter(t)
+			decisions, err := Run(context.Background(), clock, alg.Build(tb, burst, rate), traffic)
+			require.NoError(t, err)
+			require.NoError(t, inv.Check(decisions))
+
+			// The first burst drains the bucket, the steady traffic gets the
+			// 19 refills due before 5s, and the bucket is full again by the
+			// second burst.
+			assert.Equal(t, int64(burst+19+burst), Allowed(decisions, "bursty"))
+			assert.Equal(t, int64(10), Allowed(decisions, "idle"))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	inv := Invariants{Burst: 2, Rate: 1, Epsilon: 0.01}
+	require.NoError(t, inv.Check([]Decision{
+		{Event: Event{0, "k", 1}, Allowed: true},
+		{Event: Event{0, "k", 1}, Allowed: true},
+		{Event: Event{0, "k", 1}, Allowed: false},
+		{Event: Event{time.Second, "k", 1}, Allowed: true},
+	}))
+
+	err := inv.Check([]Decision{
+		{Event: Event{0, "k", 2}, Allowed: true},
+		{Event: Event{0, "k", 1}, Allowed: true},
+		{Event: Event{2 * time.Second, "k", 1}, Allowed: false},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "allowed 1 tokens with 0.000 available")
+	assert.Contains(t, err.Error(), "denied 1 tokens with 2.000 available")
+
+	err = inv.Check([]Decision{
+		{Event: Event{0, "k", 2}, Allowed: true, Result: &limiter.Result{Allowed: true, Limit: 2}},
+		{Event: Event{250 * time.Millisecond, "k", 1}, Result: &limiter.Result{Limit: 2, RetryAfter: 0.75}},
+		{Event: Event{time.Second, "k", 1}, Allowed: true, Result: &limiter.Result{Allowed: true, Remaining: 1, Limit: 2}},
+		{Event: Event{time.Second, "k", 1}, Result: &limiter.Result{Limit: 3, RetryAfter: 1}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "1 remaining with 0.000 available")
+	assert.Contains(t, err.Error(), "limit 3, want 2")
+	assert.NotContains(t, err.Error(), "retry after 0.75s")
+}
+
+func TestPoisson_Deterministic(t *testing.T) {
+	assert.Equal(t, Poisson("k", 5, time.Minute, 4, 7), Poisson("k", 5, time.Minute, 4, 7))
+	assert.NotEqual(t, Poisson("k", 5, time.Minute, 4, 7), Poisson("k", 5, time.Minute, 4, 8))
+}
\ No newline at end of file
@@ -0,0 +1,49 @@
+package sim
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Steady sends a request of tokens for key every 1/perSecond seconds for d.
+func Steady(key string, perSecond float64, d time.Duration, tokens int64) []Event {
+	step := time.Duration(float64(time.Second) / perSecond)
+	var out []Event
+	for at := time.Duration(0); at < d; at += step {
+		out = append(out, Event{At: at, Key: key, Tokens: tokens})
+	}
+	return out
+}
+
+// Burst sends n requests of tokens for key at once.
+func Burst(key string, at time.Duration, n int, tokens int64) []Event {
+	out := make([]Event, n)
+	for i := range out {
+		out[i] = Event{At: at, Key: key, Tokens: tokens}
+	}
+	return out
+}
+
+// Poisson sends requests for key at random times averaging perSecond over
+// d, each for 1 to maxTokens tokens. The same seed gives the same traffic.
+func Poisson(key string, perSecond float64, d time.Duration, maxTokens int64, seed int64) []Event {
+	rng := rand.New(rand.NewSource(seed))
+	var out []Event
+	at := time.Duration(0)
+	for {
+		at += time.Duration(rng.ExpFloat64() / perSecond * float64(time.Second))
+		if at >= d {
+			return out
+		}
+		out = append(out, Event{At: at, Key: key, Tokens: 1 + rng.Int63n(maxTokens)})
+	}
+}
+
+// Merge concatenates patterns; Run orders the events by time.
+func Merge(patterns ...[]Event) []Event {
+	var out []Event
+	for _, p := range patterns {
+		out = append(out, p...)
+	}
+	return out
+}
\ No newline at end of file
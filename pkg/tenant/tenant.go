@@ -0,0 +1,256 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// redisKey is the hash holding all registered tenants (field = tenant name).
+const redisKey = "ratelimiter:tenants"
+
+var (
+	ErrNotFound = errors.New("tenant not found")
+	ErrExists   = errors.New("tenant already exists")
+)
+
+// Tenant holds the limiter defaults for one namespace. Per-request overrides
+// still take precedence; tenant values replace the server-wide defaults.
+type Tenant struct {
+	Name  string  `json:"name" yaml:"name"`
+	Burst int64   `json:"burst,omitempty" yaml:"burst"`
+	Rate  float64 `json:"rate,omitempty" yaml:"rate"`
+
+	// Long-period quota applied per key on top of the token bucket
+	// (e.g. 10000 tokens per 24h). Zero disables the quota.
+	QuotaLimit  int64         `json:"quota_limit,omitempty" yaml:"quota_limit"`
+	QuotaPeriod time.Duration `json:"quota_period,omitempty" yaml:"quota_period"`
+	// Share of QuotaLimit that may carry over from a window's unused
+	// quota into the next one, e.g. 0.2 for up to 20%. Zero disables it.
+	QuotaRollover float64 `json:"quota_rollover,omitempty" yaml:"quota_rollover"`
+
+	// Umbrella bucket shared by all of the tenant's keys, consumed
+	// atomically alongside each key's own bucket. Zero disables it.
+	CapBurst int64   `json:"cap_burst,omitempty" yaml:"cap_burst"`
+	CapRate  float64 `json:"cap_rate,omitempty" yaml:"cap_rate"`
+
+	// Suspended tenants have every Allow call rejected.
+	Suspended bool `json:"suspended,omitempty" yaml:"suspended"`
+
+	// Share of Redis capacity when the server is saturated, relative to
+	// other tenants (default 1).
+	Weight int `json:"weight,omitempty" yaml:"weight"`
+}
+
+// HasQuota reports whether the tenant has a long-period quota configured.
+func (t *Tenant) HasQuota() bool {
+	return t.QuotaLimit > 0 && t.QuotaPeriod > 0
+}
+
+// HasCap reports whether the tenant has an aggregate cap configured.
+func (t *Tenant) HasCap() bool {
+	return t.CapBurst > 0 && t.CapRate > 0
+}
+
+// Registry stores tenants in Redis and serves lookups from an in-process
+// cache, so the Allow hot path never pays an extra round trip.
+type Registry struct {
+	rdb *redis.Client
+
+	mu      sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// NewRegistry creates an empty registry. Call Refresh to populate it.
+func NewRegistry(rdb *redis.Client) *Registry {
+	return &Registry{rdb: rdb, tenants: map[string]*Tenant{}}
+}
+
+// Get returns the cached tenant registered under name.
+func (r *Registry) Get(name string) (*Tenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tenants[name]
+	return t, ok
+}
+
+// List returns all cached tenants.
+func (r *Registry) List() []*Tenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]*Tenant, 0, len(r.tenants))
+	for _, t := range r.tenants {
+		out = append(out, t)
+	}
+	return out
+}
+
+// Load reads a tenant straight from Redis, bypassing the cache.
+func (r *Registry) Load(ctx context.Context, name string) (*Tenant, error) {
+	v, err := r.rdb.HGet(ctx, redisKey, name).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis hget: %w", err)
+	}
+	t := &Tenant{}
+	if err := json.Unmarshal([]byte(v), t); err != nil {
+		return nil, err
+	}
+	t.Name = name
+	return t, nil
+}
+
+// Put creates or replaces a tenant.
+func (r *Registry) Put(ctx context.Context, t *Tenant) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := r.rdb.HSet(ctx, redisKey, t.Name, b).Err(); err != nil {
+		return fmt.Errorf("redis hset: %w", err)
+	}
+	r.cache(t)
+	return nil
+}
+
+// Create registers a new tenant, failing with ErrExists if the name is taken.
+func (r *Registry) Create(ctx context.Context, t *Tenant) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	ok, err := r.rdb.HSetNX(ctx, redisKey, t.Name, b).Result()
+	if err != nil {
+		return fmt.Errorf("redis hsetnx: %w", err)
+	}
+	if !ok {
+		return ErrExists
+	}
+	r.cache(t)
+	return nil
+}
+
+// Update replaces an existing tenant, failing with ErrNotFound otherwise.
+func (r *Registry) Update(ctx context.Context, t *Tenant) error {
+	ok, err := r.rdb.HExists(ctx, redisKey, t.Name).Result()
+	if err != nil {
+		return fmt.Errorf("redis hexists: %w", err)
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return r.Put(ctx, t)
+}
+
+// Delete removes a tenant, failing with ErrNotFound if it doesn't exist.
+func (r *Registry) Delete(ctx context.Context, name string) error {
+	n, err := r.rdb.HDel(ctx, redisKey, name).Result()
+	if err != nil {
+		return fmt.Errorf("redis hdel: %w", err)
+	}
+	r.mu.Lock()
+	delete(r.tenants, name)
+	r.mu.Unlock()
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *Registry) cache(t *Tenant) {
+	r.mu.Lock()
+	r.tenants[t.Name] = t
+	r.mu.Unlock()
+}
+
+// Seed registers tenants that don't exist yet. Existing entries are left
+// untouched so changes made at runtime survive restarts.
+func (r *Registry) Seed(ctx context.Context, tenants []Tenant) error {
+	for _, t := range tenants {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		if err := r.rdb.HSetNX(ctx, redisKey, t.Name, b).Err(); err != nil {
+			return fmt.Errorf("redis hsetnx: %w", err)
+		}
+	}
+	return nil
+}
+
+// Refresh reloads the cache from Redis.
+func (r *Registry) Refresh(ctx context.Context) error {
+	raw, err := r.rdb.HGetAll(ctx, redisKey).Result()
+	if err != nil {
+		return fmt.Errorf("redis hgetall: %w", err)
+	}
+	tenants := make(map[string]*Tenant, len(raw))
+	for name, v := range raw {
+		t := &Tenant{}
+		if err := json.Unmarshal([]byte(v), t); err != nil {
+			log.Printf("tenant %q: skipping malformed entry: %v", name, err)
+			continue
+		}
+		t.Name = name
+		tenants[name] = t
+	}
+	r.mu.Lock()
+	r.tenants = tenants
+	r.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the cache every interval until ctx is cancelled, picking up
+// changes made by other replicas.
+func (r *Registry) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.Refresh(ctx); err != nil {
+				log.Printf("tenant refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// LoadFile reads a YAML list of tenants, e.g.
+//
+//   - name: free
+//     burst: 10
+//     rate: 1
+//     quota_limit: 1000
+//     quota_period: 24h
+//     quota_rollover: 0.2
+func LoadFile(path string) ([]Tenant, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants []Tenant
+	if err := yaml.Unmarshal(b, &tenants); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, t := range tenants {
+		if t.Name == "" {
+			return nil, fmt.Errorf("parse %s: tenant %d has no name", path, i)
+		}
+		if t.QuotaRollover < 0 || t.QuotaRollover > 1 {
+			return nil, fmt.Errorf("parse %s: tenant %q: quota_rollover must be between 0 and 1", path, t.Name)
+		}
+	}
+	return tenants, nil
+}
\ No newline at end of file
@@ -0,0 +1,131 @@
+// Package topkeys counts the requests of every bucket key over short
+// windows, to show the busiest keys and the live request rate without a
+// metrics stack.
+package topkeys
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxKeys bounds the keys counted per window. Keys first seen beyond it
+// only count towards the totals.
+const maxKeys = 100000
+
+// Key is the count of one key over a window.
+type Key struct {
+	Key      string `json:"key"` // bucket key (limiter.Key)
+	Requests int64  `json:"requests"`
+	Denied   int64  `json:"denied"`
+}
+
+// Window is the counts of the last complete window.
+type Window struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	Allowed  int64         `json:"allowed"`
+	Denied   int64         `json:"denied"`
+	// The busiest keys, most requests first
+	Top []Key `json:"top"`
+}
+
+// Tracker counts the requests of this replica per key and window. A nil
+// Tracker counts nothing.
+type Tracker struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	start time.Time
+	keys  map[string]*Key
+	total Key
+	last  Window
+	all   []Key // last window's keys, most requests first
+}
+
+// New creates a Tracker counting over windows of window.
+func New(window time.Duration) *Tracker {
+	return &Tracker{window: window, start: time.Now(), keys: map[string]*Key{}}
+}
+
+// Observe counts one decision on the bucket key.
+func (t *Tracker) Observe(key string, allowed bool) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k, ok := t.keys[key]
+	if !ok && len(t.keys) < maxKeys {
+		k = &Key{Key: key}
+		t.keys[key] = k
+	}
+	t.total.Requests++
+	if k != nil {
+		k.Requests++
+	}
+	if !allowed {
+		t.total.Denied++
+		if k != nil {
+			k.Denied++
+		}
+	}
+}
+
+// Run closes a window every window duration until ctx is cancelled.
+func (t *Tracker) Run(ctx context.Context) {
+	tick := time.NewTicker(t.window)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			t.rotate(now)
+		}
+	}
+}
+
+// rotate closes the current window at now and starts the next one.
+func (t *Tracker) rotate(now time.Time) {
+	t.mu.Lock()
+	keys, total, start := t.keys, t.total, t.start
+	t.keys = make(map[string]*Key, len(keys))
+	t.total = Key{}
+	t.start = now
+	t.mu.Unlock()
+
+	all := make([]Key, 0, len(keys))
+	for _, k := range keys {
+		all = append(all, *k)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Requests != all[j].Requests {
+			return all[i].Requests > all[j].Requests
+		}
+		return all[i].Key < all[j].Key
+	})
+
+	t.mu.Lock()
+	t.last = Window{
+		Start:    start,
+		Duration: now.Sub(start),
+		Allowed:  total.Requests - total.Denied,
+		Denied:   total.Denied,
+	}
+	t.all = all
+	t.mu.Unlock()
+}
+
+// Last returns the last complete window with its n busiest keys.
+func (t *Tracker) Last(n int) Window {
+	if t == nil {
+		return Window{Top: []Key{}}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := t.last
+	w.Top = append([]Key{}, t.all[:min(n, len(t.all))]...)
+	return w
+}
\ No newline at end of file
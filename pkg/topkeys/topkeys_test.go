@@ -0,0 +1,36 @@
+package topkeys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker(t *testing.T) {
+	tr := New(time.Minute)
+	for i := 0; i < 3; i++ {
+		tr.Observe("user:1", true)
+	}
+	tr.Observe("user:2", true)
+	tr.Observe("user:2", false)
+	assert.Empty(t, tr.Last(10).Top, "the window is still open")
+
+	start := tr.start
+	tr.rotate(start.Add(time.Minute))
+	w := tr.Last(1)
+	assert.Equal(t, start, w.Start)
+	assert.Equal(t, time.Minute, w.Duration)
+	assert.Equal(t, int64(4), w.Allowed)
+	assert.Equal(t, int64(1), w.Denied)
+	assert.Equal(t, []Key{{Key: "user:1", Requests: 3}}, w.Top)
+	assert.Equal(t, Key{Key: "user:2", Requests: 2, Denied: 1}, tr.Last(10).Top[1])
+
+	// Quiet windows are empty
+	tr.rotate(start.Add(2 * time.Minute))
+	assert.Empty(t, tr.Last(10).Top)
+	assert.Zero(t, tr.Last(10).Allowed)
+
+	var nilTracker *Tracker
+	nilTracker.Observe("user:1", true)
+}
\ No newline at end of file
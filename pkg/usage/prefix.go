@@ -0,0 +1,217 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxPendingKeys bounds the distinct keys held per tenant, prefix and
+// hour between flushes. Keys past it still count as requests, but not as
+// distinct keys.
+const maxPendingKeys = 10000
+
+// PrefixRecord is the traffic of one tenant's keys sharing a prefix during
+// one hour, the input of whatif estimates.
+type PrefixRecord struct {
+	Tenant   string // "" for un-namespaced keys
+	Prefix   string
+	Hour     time.Time
+	Keys     int64 // distinct keys seen, approximately
+	Requests int64
+	Tokens   float64 // requested, allowed or not
+}
+
+type prefixBucket struct {
+	tenant, prefix string
+	hour           int64
+}
+
+type prefixCounts struct {
+	requests int64
+	tokens   float64
+	keys     map[string]struct{}
+}
+
+// PrefixRecorder accumulates traffic per tenant and key prefix in memory
+// and periodically flushes it to Redis: counts to one hash per hour, and
+// distinct keys to a HyperLogLog per tenant, prefix and hour. A nil
+// PrefixRecorder records nothing.
+type PrefixRecorder struct {
+	rdb       *redis.Client
+	retention time.Duration
+
+	mu      sync.Mutex
+	pending map[prefixBucket]*prefixCounts
+}
+
+// NewPrefixRecorder creates a recorder keeping hourly traffic for retention.
+func NewPrefixRecorder(rdb *redis.Client, retention time.Duration) *PrefixRecorder {
+	return &PrefixRecorder{rdb: rdb, retention: retention, pending: map[prefixBucket]*prefixCounts{}}
+}
+
+func prefixHashKey(hour int64) string {
+	return "ratelimiter:prefixusage:" + strconv.FormatInt(hour, 10)
+}
+
+// prefixGroup is the hash field prefix of a tenant and key prefix. Record
+// skips the ones holding NUL, so it splits back unambiguously.
+func prefixGroup(tenant, prefix string) string {
+	return tenant + "\x00" + prefix
+}
+
+func prefixKeysKey(hour int64, group string) string {
+	return "ratelimiter:prefixkeys:" + strconv.FormatInt(hour, 10) + ":" + group
+}
+
+// Record counts one request of tokens on key, whose prefix is prefix, in
+// tenant's namespace.
+func (r *PrefixRecorder) Record(tenant, prefix, key string, tokens float64) {
+	if r == nil || strings.ContainsRune(tenant, 0) || strings.ContainsRune(prefix, 0) {
+		return
+	}
+	b := prefixBucket{tenant: tenant, prefix: prefix, hour: time.Now().Truncate(time.Hour).Unix()}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.pending[b]
+	if !ok {
+		c = &prefixCounts{keys: map[string]struct{}{}}
+		r.pending[b] = c
+	}
+	c.requests++
+	c.tokens += tokens
+	if len(c.keys) < maxPendingKeys {
+		c.keys[key] = struct{}{}
+	}
+}
+
+// Flush writes pending counts to Redis in a single transaction. Counts that
+// fail to flush stay pending for the next one.
+func (r *PrefixRecorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[prefixBucket]*prefixCounts{}
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	pipe := r.rdb.TxPipeline()
+	for b, c := range pending {
+		expireAt := time.Unix(b.hour, 0).Add(r.retention)
+		key := prefixHashKey(b.hour)
+		group := prefixGroup(b.tenant, b.prefix)
+		pipe.HIncrBy(ctx, key, group+"\x00requests", c.requests)
+		pipe.HIncrByFloat(ctx, key, group+"\x00tokens", c.tokens)
+		pipe.ExpireAt(ctx, key, expireAt)
+
+		keys := make([]interface{}, 0, len(c.keys))
+		for k := range c.keys {
+			keys = append(keys, k)
+		}
+		hll := prefixKeysKey(b.hour, group)
+		pipe.PFAdd(ctx, hll, keys...)
+		pipe.ExpireAt(ctx, hll, expireAt)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.restore(pending)
+		return fmt.Errorf("redis pipeline: %w", err)
+	}
+	return nil
+}
+
+// restore puts counts that failed to flush back with those recorded since.
+func (r *PrefixRecorder) restore(pending map[prefixBucket]*prefixCounts) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for b, c := range pending {
+		p, ok := r.pending[b]
+		if !ok {
+			r.pending[b] = c
+			continue
+		}
+		p.requests += c.requests
+		p.tokens += c.tokens
+		for k := range c.keys {
+			if len(p.keys) >= maxPendingKeys {
+				break
+			}
+			p.keys[k] = struct{}{}
+		}
+	}
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more.
+func (r *PrefixRecorder) Run(ctx context.Context, interval time.Duration) {
+	run(ctx, interval, "prefix usage", r.Flush)
+}
+
+// Query returns the hourly traffic of every tenant and prefix in
+// [from, to).
+func (r *PrefixRecorder) Query(ctx context.Context, from, to time.Time) ([]PrefixRecord, error) {
+	from = from.Truncate(time.Hour)
+	if to.Sub(from) > maxQueryHours*time.Hour {
+		return nil, fmt.Errorf("range exceeds %d hours", maxQueryHours)
+	}
+
+	var hours []time.Time
+	for h := from; h.Before(to); h = h.Add(time.Hour) {
+		hours = append(hours, h)
+	}
+
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(hours))
+	for i, h := range hours {
+		cmds[i] = pipe.HGetAll(ctx, prefixHashKey(h.Unix()))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis pipeline: %w", err)
+	}
+
+	var out []PrefixRecord
+	index := map[prefixBucket]int{}
+	for i, cmd := range cmds {
+		for field, v := range cmd.Val() {
+			parts := strings.Split(field, "\x00")
+			if len(parts) != 3 {
+				continue
+			}
+			b := prefixBucket{tenant: parts[0], prefix: parts[1], hour: hours[i].Unix()}
+			j, ok := index[b]
+			if !ok {
+				j = len(out)
+				index[b] = j
+				out = append(out, PrefixRecord{Tenant: b.tenant, Prefix: b.prefix, Hour: hours[i].UTC()})
+			}
+			switch parts[2] {
+			case "requests":
+				out[j].Requests, _ = strconv.ParseInt(v, 10, 64)
+			case "tokens":
+				out[j].Tokens, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	pipe = r.rdb.Pipeline()
+	counts := make([]*redis.IntCmd, len(out))
+	for i, rec := range out {
+		counts[i] = pipe.PFCount(ctx, prefixKeysKey(rec.Hour.Unix(), prefixGroup(rec.Tenant, rec.Prefix)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("redis pipeline: %w", err)
+	}
+	for i, cmd := range counts {
+		out[i].Keys = cmd.Val()
+	}
+	return out, nil
+}
\ No newline at end of file
@@ -0,0 +1,200 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxQueryHours bounds a single query (~ one month of hourly buckets).
+const maxQueryHours = 31 * 24
+
+// Record is the consumption of one tenant during one hour.
+type Record struct {
+	Tenant  string    `json:"tenant"`
+	Hour    time.Time `json:"hour"`
+	Tokens  float64   `json:"tokens_consumed"`
+	Allowed int64     `json:"allowed"`
+	Denied  int64     `json:"denied"`
+}
+
+type bucket struct {
+	tenant string
+	hour   int64
+}
+
+type counts struct {
+	tokens          float64
+	allowed, denied int64
+}
+
+// Recorder accumulates per-tenant usage in memory and periodically flushes
+// it to hourly Redis hashes with HINCRBY, and HINCRBYFLOAT for fractional
+// tokens, so every replica contributes to the same totals without adding a round trip to each Allow call.
+type Recorder struct {
+	rdb       *redis.Client
+	prefix    string
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[bucket]*counts
+}
+
+// NewRecorder creates a recorder keeping hourly usage for retention.
+func NewRecorder(rdb *redis.Client, retention time.Duration) *Recorder {
+	return newRecorder(rdb, "ratelimiter:usage:", retention)
+}
+
+// NewClientRecorder creates a recorder for per-service-account API usage.
+// Its records are stored apart from tenant usage, so names may overlap.
+func NewClientRecorder(rdb *redis.Client, retention time.Duration) *Recorder {
+	return newRecorder(rdb, "ratelimiter:apiusage:", retention)
+}
+
+func newRecorder(rdb *redis.Client, prefix string, retention time.Duration) *Recorder {
+	return &Recorder{
+		rdb:       rdb,
+		prefix:    prefix,
+		retention: retention,
+		now:       time.Now,
+		pending:   map[bucket]*counts{},
+	}
+}
+
+func (r *Recorder) redisKey(tenant string, hour int64) string {
+	return r.prefix + tenant + ":" + strconv.FormatInt(hour, 10)
+}
+
+// Record counts one decision for tenant. Tokens are only counted as
+// consumed when the request was allowed.
+func (r *Recorder) Record(tenant string, tokens float64, allowed bool) {
+	b := bucket{tenant: tenant, hour: r.now().Truncate(time.Hour).Unix()}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.pending[b]
+	if !ok {
+		c = &counts{}
+		r.pending[b] = c
+	}
+	if allowed {
+		c.allowed++
+		c.tokens += tokens
+	} else {
+		c.denied++
+	}
+}
+
+// Flush writes pending counts to Redis in a single transaction. Counts that
+// fail to flush stay pending for the next one. That makes flushes at least
+// once: when a transaction went through but its reply was lost, e.g. to a
+// timeout, its counts are flushed again and billed twice.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[bucket]*counts{}
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// All or nothing, so that a failed flush can be retried whole
+	pipe := r.rdb.TxPipeline()
+	for b, c := range pending {
+		key := r.redisKey(b.tenant, b.hour)
+		pipe.HIncrByFloat(ctx, key, "tokens", c.tokens)
+		pipe.HIncrBy(ctx, key, "allowed", c.allowed)
+		pipe.HIncrBy(ctx, key, "denied", c.denied)
+		pipe.ExpireAt(ctx, key, time.Unix(b.hour, 0).Add(r.retention))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.restore(pending)
+		return fmt.Errorf("redis pipeline: %w", err)
+	}
+	return nil
+}
+
+// restore puts counts that failed to flush back with those recorded since.
+func (r *Recorder) restore(pending map[bucket]*counts) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for b, c := range pending {
+		if p, ok := r.pending[b]; ok {
+			p.tokens += c.tokens
+			p.allowed += c.allowed
+			p.denied += c.denied
+		} else {
+			r.pending[b] = c
+		}
+	}
+}
+
+// Run flushes every interval until ctx is cancelled, then flushes once more.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	run(ctx, interval, "usage", r.Flush)
+}
+
+// run calls flush every interval until ctx is cancelled, then once more.
+func run(ctx context.Context, interval time.Duration, name string, flush func(context.Context) error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := flush(flushCtx); err != nil {
+				log.Printf("%s flush failed: %v", name, err)
+			}
+			cancel()
+			return
+		case <-t.C:
+			if err := flush(ctx); err != nil {
+				log.Printf("%s flush failed: %v", name, err)
+			}
+		}
+	}
+}
+
+// Query returns the hourly usage of tenant in [from, to). Hours without any
+// traffic are omitted.
+func (r *Recorder) Query(ctx context.Context, tenant string, from, to time.Time) ([]Record, error) {
+	from = from.Truncate(time.Hour)
+	if to.Sub(from) > maxQueryHours*time.Hour {
+		return nil, fmt.Errorf("range exceeds %d hours", maxQueryHours)
+	}
+
+	var hours []time.Time
+	for h := from; h.Before(to); h = h.Add(time.Hour) {
+		hours = append(hours, h)
+	}
+
+	pipe := r.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(hours))
+	for i, h := range hours {
+		cmds[i] = pipe.HGetAll(ctx, r.redisKey(tenant, h.Unix()))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("redis pipeline: %w", err)
+	}
+
+	var out []Record
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		if len(vals) == 0 {
+			continue
+		}
+		rec := Record{Tenant: tenant, Hour: hours[i].UTC()}
+		rec.Tokens, _ = strconv.ParseFloat(vals["tokens"], 64)
+		rec.Allowed, _ = strconv.ParseInt(vals["allowed"], 10, 64)
+		rec.Denied, _ = strconv.ParseInt(vals["denied"], 10, 64)
+		out = append(out, rec)
+	}
+	return out, nil
+}
\ No newline at end of file
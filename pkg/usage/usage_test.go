@@ -0,0 +1,140 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb, mr
+}
+
+func TestRecorder_Hourly(t *testing.T) {
+	rdb, _ := testRedis(t)
+	r := NewRecorder(rdb, 24*time.Hour)
+	ctx := context.Background()
+	hour := time.Now().Truncate(time.Hour).Add(-2 * time.Hour)
+	now := hour.Add(59 * time.Minute)
+	r.now = func() time.Time { return now }
+
+	r.Record("acme", 3, true)
+	r.Record("acme", 5, false)
+	r.Record("other", 1, true)
+	now = hour.Add(time.Hour)
+	r.Record("acme", 2, true)
+	require.NoError(t, r.Flush(ctx))
+
+	recs, err := r.Query(ctx, "acme", hour, hour.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Record{
+		{Tenant: "acme", Hour: hour.UTC(), Tokens: 3, Allowed: 1, Denied: 1},
+		{Tenant: "acme", Hour: hour.Add(time.Hour).UTC(), Tokens: 2, Allowed: 1},
+	}, recs, "denied tokens aren't consumed")
+
+	// Flushes add up, from every replica
+	other := NewRecorder(rdb, 24*time.Hour)
+	other.now = r.now
+	other.Record("acme", 4, true)
+	require.NoError(t, other.Flush(ctx))
+	recs, err = r.Query(ctx, "acme", now, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, 6.0, recs[0].Tokens)
+
+	_, err = r.Query(ctx, "acme", hour, hour.Add((maxQueryHours+1)*time.Hour))
+	assert.Error(t, err)
+}
+
+func TestRecorder_FailedFlush(t *testing.T) {
+	rdb, mr := testRedis(t)
+	r := NewRecorder(rdb, 24*time.Hour)
+	ctx := context.Background()
+	hour := time.Now().Truncate(time.Hour)
+	r.now = func() time.Time { return hour }
+
+	r.Record("acme", 3, true)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	require.Error(t, r.Flush(ctx))
+	mr.SetError("")
+
+	// Counts of the failed flush go out with the next one, once
+	r.Record("acme", 2, true)
+	r.Record("acme", 1, false)
+	require.NoError(t, r.Flush(ctx))
+	require.NoError(t, r.Flush(ctx))
+	recs, err := r.Query(ctx, "acme", hour, hour.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Record{{Tenant: "acme", Hour: hour.UTC(), Tokens: 5, Allowed: 2, Denied: 1}}, recs)
+}
+
+func TestRecorder_FractionalTokens(t *testing.T) {
+	rdb, _ := testRedis(t)
+	r := NewRecorder(rdb, 24*time.Hour)
+	ctx := context.Background()
+	hour := time.Now().Truncate(time.Hour)
+	r.now = func() time.Time { return hour }
+
+	// A thousand half-token calls consume 500 tokens, over several flushes
+	for i := 0; i < 1000; i++ {
+		r.Record("acme", 0.5, true)
+		if i == 499 {
+			require.NoError(t, r.Flush(ctx))
+		}
+	}
+	r.Record("acme", 0.5, false)
+	require.NoError(t, r.Flush(ctx))
+	recs, err := r.Query(ctx, "acme", hour, hour.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Record{{Tenant: "acme", Hour: hour.UTC(), Tokens: 500, Allowed: 1000, Denied: 1}}, recs)
+}
+
+func TestPrefixRecorder_FractionalTokens(t *testing.T) {
+	rdb, _ := testRedis(t)
+	r := NewPrefixRecorder(rdb, 24*time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 1000; i++ {
+		r.Record("acme", "user", "user:1", 0.5)
+		if i == 499 {
+			require.NoError(t, r.Flush(ctx))
+		}
+	}
+	require.NoError(t, r.Flush(ctx))
+	now := time.Now()
+	recs, err := r.Query(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, int64(1000), recs[0].Requests)
+	assert.Equal(t, 500.0, recs[0].Tokens)
+}
+
+func TestPrefixRecorder_FailedFlush(t *testing.T) {
+	rdb, mr := testRedis(t)
+	r := NewPrefixRecorder(rdb, 24*time.Hour)
+	ctx := context.Background()
+
+	r.Record("acme", "user", "user:1", 3)
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	require.Error(t, r.Flush(ctx))
+	mr.SetError("")
+
+	r.Record("acme", "user", "user:2", 1)
+	require.NoError(t, r.Flush(ctx))
+	now := time.Now()
+	recs, err := r.Query(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, int64(2), recs[0].Requests)
+	assert.Equal(t, 4.0, recs[0].Tokens)
+	assert.Equal(t, int64(2), recs[0].Keys)
+}
\ No newline at end of file
@@ -0,0 +1,139 @@
+// Package webui serves a small dashboard for teams without a Grafana
+// setup: live request and denial rates, the busiest keys, bucket lookup
+// and boost management, backed by the AdminService.
+package webui
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/topkeys"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// maxBody bounds the JSON bodies accepted.
+const maxBody = 1 << 16
+
+// Handler serves the dashboard and its JSON API, behind HTTP basic auth
+// with user and password:
+//
+//	GET    /                            the dashboard
+//	GET    /api/stats?top=20            the last window (topkeys.Window)
+//	GET    /api/bucket?namespace=&key=  InspectBucket
+//	GET    /api/boosts                  ListBoosts
+//	POST   /api/boosts                  GrantBoost, with a GrantBoostRequest
+//	DELETE /api/boosts?namespace=&key=  RevokeBoost
+//
+// Its password grants those admin calls, so serve it only where the
+// AdminService itself is restricted to admins. Mount it under a prefix
+// with http.StripPrefix.
+func Handler(admin pb.AdminServiceServer, top *topkeys.Tracker, user, password string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+	mux.HandleFunc("GET /api/stats", func(w http.ResponseWriter, r *http.Request) {
+		n := 20
+		if v := r.URL.Query().Get("top"); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n < 0 || n > 1000 {
+				http.Error(w, "top must be between 0 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(top.Last(n))
+	})
+	mux.HandleFunc("GET /api/bucket", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		writeProto(w, func() (proto.Message, error) {
+			return admin.InspectBucket(r.Context(), &pb.InspectBucketRequest{Namespace: q.Get("namespace"), Key: q.Get("key")})
+		})
+	})
+	mux.HandleFunc("GET /api/boosts", func(w http.ResponseWriter, r *http.Request) {
+		writeProto(w, func() (proto.Message, error) {
+			return admin.ListBoosts(r.Context(), &pb.ListBoostsRequest{})
+		})
+	})
+	mux.HandleFunc("POST /api/boosts", func(w http.ResponseWriter, r *http.Request) {
+		req := &pb.GrantBoostRequest{}
+		b, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err == nil {
+			err = protojson.Unmarshal(b, req)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeProto(w, func() (proto.Message, error) {
+			return admin.GrantBoost(r.Context(), req)
+		})
+	})
+	mux.HandleFunc("DELETE /api/boosts", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		writeProto(w, func() (proto.Message, error) {
+			return admin.RevokeBoost(r.Context(), &pb.RevokeBoostRequest{Namespace: q.Get("namespace"), Key: q.Get("key")})
+		})
+	})
+	return basicAuth(mux, user, password)
+}
+
+// writeProto writes the response of an admin call as JSON, or its error
+// with the matching HTTP status.
+func writeProto(w http.ResponseWriter, call func() (proto.Message, error)) {
+	m, err := call()
+	if err != nil {
+		st := status.Convert(err)
+		http.Error(w, st.Message(), httpStatus(st.Code()))
+		return
+	}
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func httpStatus(c codes.Code) int {
+	switch c {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func basicAuth(next http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="rate limiter"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
\ No newline at end of file
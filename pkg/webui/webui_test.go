@@ -0,0 +1,76 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/topkeys"
+	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
+)
+
+type fakeAdmin struct {
+	pb.UnimplementedAdminServiceServer
+	granted *pb.GrantBoostRequest
+}
+
+func (f *fakeAdmin) InspectBucket(_ context.Context, req *pb.InspectBucketRequest) (*pb.BucketState, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	return &pb.BucketState{Exists: true, Tokens: 3}, nil
+}
+
+func (f *fakeAdmin) GrantBoost(_ context.Context, req *pb.GrantBoostRequest) (*pb.Boost, error) {
+	f.granted = req
+	return &pb.Boost{Namespace: req.Namespace, Key: req.Key, Multiplier: req.Multiplier}, nil
+}
+
+func TestHandler(t *testing.T) {
+	admin := &fakeAdmin{}
+	top := topkeys.New(time.Minute)
+	h := Handler(admin, top, "admin", "secret")
+
+	do := func(method, target, body string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if auth {
+			req.SetBasicAuth("admin", "secret")
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/", "", false).Code)
+	rec := do("GET", "/", "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<title>Rate limiter</title>")
+
+	var w topkeys.Window
+	rec = do("GET", "/api/stats?top=5", "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &w))
+	assert.NotNil(t, w.Top)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/api/stats?top=x", "", true).Code)
+
+	rec = do("GET", "/api/bucket?key=user:1", "", true)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"tokens":3`)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/api/bucket", "", true).Code)
+
+	rec = do("POST", "/api/boosts", `{"namespace":"acme","multiplier":2,"durationSeconds":"60"}`, true)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, int64(60), admin.granted.DurationSeconds)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/api/boosts", `{"nope":1}`, true).Code)
+
+	assert.Equal(t, http.StatusInternalServerError, do("GET", "/api/boosts", "", true).Code, "unimplemented")
+}
\ No newline at end of file
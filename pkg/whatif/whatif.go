@@ -0,0 +1,247 @@
+// Package whatif estimates how proposed limits would treat past traffic,
+// from hourly usage aggregates. It backs cmd/whatif.
+//
+// The estimate treats each hour's traffic as spread evenly over its hour
+// and its keys, so it is a lower bound: bursts within the hour and skew
+// across keys get more requests denied.
+package whatif
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+)
+
+// Aggregate is the traffic of one tenant's keys sharing a prefix during
+// one hour.
+type Aggregate struct {
+	Tenant   string // "" for un-namespaced keys
+	Prefix   string
+	Hour     time.Time
+	Keys     int64 // distinct keys seen
+	Requests int64
+	Tokens   float64
+}
+
+// ReadAggregates parses CSV aggregates of
+// tenant,prefix,hour,keys,requests,tokens with hour in RFC 3339 or unix
+// seconds. A first line that doesn't parse is taken as a header.
+func ReadAggregates(r io.Reader) ([]Aggregate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 6
+	cr.TrimLeadingSpace = true
+
+	var out []Aggregate
+	for line := 1; ; line++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		a, err := parse(fields)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		out = append(out, a)
+	}
+}
+
+func parse(f []string) (Aggregate, error) {
+	a := Aggregate{Tenant: f[0], Prefix: f[1]}
+	if a.Prefix == "" {
+		return a, errors.New("empty prefix")
+	}
+	if secs, err := strconv.ParseInt(f[2], 10, 64); err == nil {
+		a.Hour = time.Unix(secs, 0).UTC()
+	} else if a.Hour, err = time.Parse(time.RFC3339, f[2]); err != nil {
+		return a, fmt.Errorf("invalid hour %q", f[2])
+	}
+	a.Hour = a.Hour.Truncate(time.Hour)
+	for i, n := range []*int64{&a.Keys, &a.Requests} {
+		v, err := strconv.ParseInt(f[3+i], 10, 64)
+		if err != nil || v < 0 {
+			return a, fmt.Errorf("invalid count %q", f[3+i])
+		}
+		*n = v
+	}
+	// Fractional costs make fractional tokens
+	tokens, err := strconv.ParseFloat(f[5], 64)
+	if err != nil || tokens < 0 || math.IsNaN(tokens) || math.IsInf(tokens, 0) {
+		return a, fmt.Errorf("invalid count %q", f[5])
+	}
+	a.Tokens = tokens
+	if a.Keys == 0 && a.Tokens > 0 {
+		return a, errors.New("tokens without keys")
+	}
+	return a, nil
+}
+
+// Limits are the proposed limits, resolved like the server does: tenant
+// defaults, then prefix rule defaults, then server defaults.
+type Limits struct {
+	Rules   *rules.Set
+	Tenants map[string]*tenant.Tenant
+	Burst   int64
+	Rate    float64
+}
+
+// bucket returns the bucket limits of the tenant's keys with prefix.
+func (l Limits) bucket(t *tenant.Tenant, prefix string) (int64, float64) {
+	var burst int64
+	var rate float64
+	if t != nil {
+		burst, rate = t.Burst, t.Rate
+	}
+	burst, rate = l.Rules.Match(prefix).Defaults(burst, rate)
+	if burst <= 0 {
+		burst = l.Burst
+	}
+	if rate <= 0 {
+		rate = l.Rate
+	}
+	return burst, rate
+}
+
+// Estimate is the expected outcome for one tenant's keys sharing a prefix.
+type Estimate struct {
+	Tenant string
+	Prefix string
+	Burst  int64
+	Rate   float64
+
+	Requests int64
+	Denied   float64 // expected denied requests
+}
+
+// DenialRate returns the expected fraction of requests denied.
+func (e Estimate) DenialRate() float64 {
+	if e.Requests == 0 {
+		return 0
+	}
+	return e.Denied / float64(e.Requests)
+}
+
+// Evaluate estimates the denials aggs would have seen under l, per tenant
+// and prefix, sorted by tenant then prefix.
+func Evaluate(l Limits, aggs []Aggregate) []Estimate {
+	type group struct{ tenant, prefix string }
+	type tenantHour struct {
+		tenant string
+		hour   time.Time
+	}
+	estimates := map[group]*Estimate{}
+
+	// What each key's own bucket (and quota) lets through, before the
+	// tenant's aggregate cap.
+	allowed := make([]float64, len(aggs))
+	capped := map[tenantHour]float64{}
+	for i, a := range aggs {
+		t := l.Tenants[a.Tenant]
+		burst, rate := l.bucket(t, a.Prefix)
+		g := group{a.Tenant, a.Prefix}
+		if estimates[g] == nil {
+			estimates[g] = &Estimate{Tenant: a.Tenant, Prefix: a.Prefix, Burst: burst, Rate: rate}
+		}
+		estimates[g].Requests += a.Requests
+		if a.Tokens == 0 || (t != nil && t.Suspended) {
+			continue
+		}
+
+		perKey := float64(burst) + rate*time.Hour.Seconds()
+		if t != nil && t.HasQuota() {
+			perKey = min(perKey, float64(t.QuotaLimit)*float64(time.Hour)/float64(max(t.QuotaPeriod, time.Hour)))
+		}
+		allowed[i] = min(a.Tokens, perKey*float64(a.Keys))
+		if t != nil && t.HasCap() {
+			capped[tenantHour{a.Tenant, a.Hour}] += allowed[i]
+		}
+	}
+
+	for i, a := range aggs {
+		if t := l.Tenants[a.Tenant]; t != nil && t.HasCap() {
+			total := capped[tenantHour{a.Tenant, a.Hour}]
+			capacity := float64(t.CapBurst) + t.CapRate*time.Hour.Seconds()
+			if total > capacity {
+				allowed[i] *= capacity / total
+			}
+		}
+		if a.Tokens > 0 {
+			denied := 1 - allowed[i]/a.Tokens
+			estimates[group{a.Tenant, a.Prefix}].Denied += denied * float64(a.Requests)
+		}
+	}
+
+	out := make([]Estimate, 0, len(estimates))
+	for _, e := range estimates {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Tenant != out[j].Tenant {
+			return out[i].Tenant < out[j].Tenant
+		}
+		return out[i].Prefix < out[j].Prefix
+	})
+	return out
+}
+
+// Effect is how a change of limits treats one tenant's keys sharing a
+// prefix.
+type Effect string
+
+const (
+	Unchanged Effect = "unchanged"
+	Tighter   Effect = "tighter"
+	Looser    Effect = "looser"
+	Mixed     Effect = "mixed" // one of burst and rate goes up, the other down
+)
+
+// Change is the estimate for one tenant's keys sharing a prefix, before
+// and after a change of limits.
+type Change struct {
+	Before, After Estimate
+}
+
+// Effect compares the bucket limits before and after the change.
+func (c Change) Effect() Effect {
+	burst := cmp.Compare(c.After.Burst, c.Before.Burst)
+	rate := cmp.Compare(c.After.Rate, c.Before.Rate)
+	switch {
+	case burst == 0 && rate == 0:
+		return Unchanged
+	case burst <= 0 && rate <= 0:
+		return Tighter
+	case burst >= 0 && rate >= 0:
+		return Looser
+	default:
+		return Mixed
+	}
+}
+
+// Compare estimates the denials aggs would see under the current and the
+// candidate limits, and returns the tenants and prefixes whose limits or
+// expected denials differ, sorted like Evaluate.
+func Compare(current, candidate Limits, aggs []Aggregate) []Change {
+	before, after := Evaluate(current, aggs), Evaluate(candidate, aggs)
+	var out []Change
+	for i := range before {
+		c := Change{Before: before[i], After: after[i]}
+		if c.Effect() != Unchanged || math.Abs(c.After.Denied-c.Before.Denied) >= 0.5 {
+			out = append(out, c)
+		}
+	}
+	return out
+}
\ No newline at end of file
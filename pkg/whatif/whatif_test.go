@@ -0,0 +1,120 @@
+package whatif
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SrushtiPatil01/rate-limiter/pkg/rules"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/tenant"
+)
+
+func TestReadAggregates(t *testing.T) {
+	aggs, err := ReadAggregates(strings.NewReader(`tenant,prefix,hour,keys,requests,tokens
+acme,user,2024-06-01T10:00:00Z,10,500,600
+,ip,1717236000,1,20,20
+`))
+	require.NoError(t, err)
+	require.Len(t, aggs, 2)
+	assert.Equal(t, Aggregate{Tenant: "acme", Prefix: "user", Hour: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC), Keys: 10, Requests: 500, Tokens: 600}, aggs[0])
+	assert.Equal(t, aggs[0].Hour, aggs[1].Hour)
+
+	_, err = ReadAggregates(strings.NewReader("acme,user,1717236000,0,5,5\n"))
+	require.NoError(t, err, "a bad first line is a header")
+	_, err = ReadAggregates(strings.NewReader("acme,user,1717236000,1,5,5\nacme,user,1717236000,0,5,5\n"))
+	assert.ErrorContains(t, err, "line 2: tokens without keys")
+}
+
+func TestEvaluate(t *testing.T) {
+	set, err := rules.Parse([]byte(`
+rules:
+  - prefix: user
+    burst: 400
+    rate: 0.1
+`))
+	require.NoError(t, err)
+	hour := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	l := Limits{
+		Rules: set,
+		Tenants: map[string]*tenant.Tenant{
+			"capped": {Name: "capped", CapBurst: 1000, CapRate: 0.001},
+			"banned": {Name: "banned", Suspended: true},
+		},
+		Burst: 100,
+		Rate:  0,
+	}
+
+	got := Evaluate(l, []Aggregate{
+		// Each key gets 400+360 = 760 tokens an hour and asks for 1520
+		{Prefix: "user", Hour: hour, Keys: 2, Requests: 3040, Tokens: 3040},
+		// Under the server default of 100 tokens
+		{Prefix: "ip", Hour: hour, Keys: 5, Requests: 50, Tokens: 500},
+		// Keys fit in their buckets, but the cap of ~1004 binds
+		{Tenant: "capped", Prefix: "ip", Hour: hour, Keys: 30, Requests: 2008, Tokens: 2008},
+		{Tenant: "banned", Prefix: "ip", Hour: hour, Keys: 1, Requests: 7, Tokens: 7},
+	})
+	require.Len(t, got, 4)
+
+	assert.Equal(t, "", got[0].Tenant)
+	assert.Equal(t, "ip", got[0].Prefix)
+	assert.Equal(t, int64(100), got[0].Burst)
+	assert.InDelta(t, 0, got[0].DenialRate(), 1e-9)
+
+	assert.Equal(t, "user", got[1].Prefix)
+	assert.Equal(t, int64(400), got[1].Burst)
+	assert.InDelta(t, 0.5, got[1].DenialRate(), 1e-9)
+
+	assert.Equal(t, "banned", got[2].Tenant)
+	assert.InDelta(t, 1, got[2].DenialRate(), 1e-9)
+
+	assert.Equal(t, "capped", got[3].Tenant)
+	assert.InDelta(t, 0.5, got[3].DenialRate(), 0.01)
+}
+func TestCompare(t *testing.T) {
+	current, err := rules.Parse([]byte(`
+rules:
+  - prefix: user
+    burst: 400
+    rate: 0.1
+  - prefix: ip
+    burst: 50
+    rate: 1
+`))
+	require.NoError(t, err)
+	candidate, err := rules.Parse([]byte(`
+rules:
+  - prefix: user
+    burst: 100
+    rate: 0.1
+  - prefix: ip
+    burst: 50
+    rate: 1
+  - prefix: api
+    burst: 1000
+    rate: 1
+`))
+	require.NoError(t, err)
+	hour := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	aggs := []Aggregate{
+		{Prefix: "user", Hour: hour, Keys: 2, Requests: 3040, Tokens: 3040},
+		{Prefix: "ip", Hour: hour, Keys: 5, Requests: 50, Tokens: 50},
+		{Prefix: "api", Hour: hour, Keys: 1, Requests: 10, Tokens: 10},
+	}
+
+	got := Compare(
+		Limits{Rules: current, Burst: 100, Rate: 0},
+		Limits{Rules: candidate, Burst: 100, Rate: 0},
+		aggs,
+	)
+	require.Len(t, got, 2, "ip is unchanged")
+	assert.Equal(t, "api", got[0].Before.Prefix)
+	assert.Equal(t, Looser, got[0].Effect())
+	assert.Equal(t, "user", got[1].Before.Prefix)
+	assert.Equal(t, Tighter, got[1].Effect())
+	assert.Greater(t, got[1].After.DenialRate(), got[1].Before.DenialRate())
+
+	assert.Equal(t, Mixed, Change{Before: Estimate{Burst: 10, Rate: 1}, After: Estimate{Burst: 20, Rate: 0.5}}.Effect())
+}
\ No newline at end of file
@@ -1,45 +1,468 @@
 // Load test client for the rate limiter service.
 // Usage: go run scripts/loadtest.go -addr localhost:50051 -rps 5000 -duration 30s -keys 100
+//
+// Keys are drawn uniformly by default. Real traffic is skewed, which a
+// uniform keyspace hides: -dist zipf or -dist pareto concentrate requests
+// on a few hot keys, more so the higher -skew.
+// Usage: go run scripts/loadtest.go -keys 100000 -dist zipf -skew 1.2
+//
+// Load profiles (-profile) vary the rate over the run to find the knee of
+// the latency curve; the results then break latency down by target rate.
+// Ramps and steps hold their final rate for the rest of -duration.
+//
+//	ramp:0-10000rps/2m        linear from 0 to 10000 rps over 2m
+//	step:1000-10000rps/10x30s 10 steps of 30s from 1000 to 10000 rps
+//	spike:1000-8000rps/1m/5s  1000 rps with 5s at 8000 rps every minute
+//	sine:1000-5000rps/1m      between 1000 and 5000 rps with a 1m period
+//
+// Usage: go run scripts/loadtest.go -profile ramp:0-10000rps/2m -duration 2m
+//
+// Load is open-loop: pacers schedule every call at its intended start time
+// whether or not the workers keep up, one pacer per 100k rps of peak by
+// default (-pacers). Calls the workers are over 2s behind on are dropped
+// and counted; the results show the intended rate next to the achieved
+// one. Latency is reported twice: from the call's actual start, and
+// corrected for coordinated omission, from its intended start, which is
+// what a client sending at that rate would see once the target falls
+// behind.
+//
+// A workload mix (-mix) spreads the calls over RPCs by weight, the way
+// production traffic does, and breaks the results down by RPC. Batch RPCs
+// take a batch size after a colon, 10 by default; each of their keys is
+// drawn from -dist.
+// Usage: go run scripts/loadtest.go -mix allow=90,peek=8,batch_allow:10=2
+//
+// Keys are PREFIX:N, the prefix being what the server's rules match on.
+// -prefixes spreads the calls over prefixes by weight, each with its own
+// -keys keys, so a run can exercise several rules at once; the results
+// break down by prefix and list the busiest keys, to check each rule
+// limits as configured under load.
+// Usage: go run scripts/loadtest.go -prefixes user=70,api=25,search=5 -top-keys 20
+//
+// Results are printed as text, or written as JSON or CSV with -output for
+// archiving and comparing runs; the log goes to stderr either way.
+// Usage: go run scripts/loadtest.go -output json > run.json
+//
+// -compare checks the run against a saved JSON result: it exits non-zero
+// when throughput, error rate or a latency percentile, overall or of any
+// RPC, regressed past its threshold. Compare runs with the same flags,
+// against the same target setup.
+// Usage: go run scripts/loadtest.go -compare main.json -max-latency-regression 15
+//
+// Latencies go into HDR histograms, which take the same memory however long
+// the run and keep -precision significant digits of every value, so the
+// tail (p99.9, p99.99) is as accurate as the median. -hgrm writes the full
+// percentile distribution, in milliseconds, in HdrHistogram's text format
+// for plotting or comparing runs.
+// Usage: go run scripts/loadtest.go -duration 10m -hgrm run.hgrm
+//
+// One machine runs out of CPU or sockets before a horizontally scaled
+// target does. -coordinate spreads a run over -agents machines: each runs
+// the load tester with -join pointing at the coordinator, which waits for
+// all of them, hands each 1/N of the rate and a contiguous 1/N slice of
+// the keyspace (-dist applies within each slice), starts them together
+// and merges their results into one report. Every other setting comes
+// from the coordinator; -conns, -workers and -pacers are per agent.
+// Usage: go run scripts/loadtest.go -coordinate :7000 -agents 4 -rps 200000 -keys 100000
+// Usage: go run scripts/loadtest.go -join coordinator:7000
+//
+// -tls, -ca and -cert/-key connect with TLS or mTLS, and -api-key, -jwt
+// and -hmac-client/-hmac-secret authenticate every call, to test secured
+// endpoints as production clients reach them. Secrets can be read from a
+// file with @path, to keep them out of the process list. Agents of a
+// distributed run use their own flags for these.
+// Usage: go run scripts/loadtest.go -addr rl.prod:443 -ca ca.pem -cert client.pem -key client-key.pem -jwt @token
+//
+// Soak mode (-soak) is for hours-long runs: every -snapshot it logs the
+// interval's latencies alongside the target's memory, goroutines and GC
+// from its metrics endpoint, and at the end flags trends that look like
+// leaks.
+// Usage: go run scripts/loadtest.go -soak -duration 8h -rps 2000 -metrics http://localhost:9090/metrics
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/client"
+	"github.com/SrushtiPatil01/rate-limiter/pkg/loadtest"
 	pb "github.com/SrushtiPatil01/rate-limiter/proto/ratelimitpb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
-	addr := flag.String("addr", "localhost:50051", "gRPC server address")
-	rps := flag.Int("rps", 5000, "target requests per second")
-	dur := flag.Duration("duration", 30*time.Second, "test duration")
-	numKeys := flag.Int("keys", 100, "number of unique keys")
-	conns := flag.Int("conns", 10, "number of gRPC connections")
-	workers := flag.Int("workers", 50, "number of concurrent workers")
+	var o options
+	flag.StringVar(&o.Addr, "addr", "localhost:50051", "gRPC server address")
+	flag.IntVar(&o.RPS, "rps", 5000, "target requests per second")
+	flag.StringVar(&o.Profile, "profile", "", "load shape instead of a constant -rps: ramp, step, spike or sine (see above)")
+	flag.DurationVar(&o.Duration, "duration", 30*time.Second, "test duration")
+	flag.IntVar(&o.Keys, "keys", 100, "number of unique keys")
+	flag.StringVar(&o.Dist, "dist", "uniform", "key distribution: uniform, zipf or pareto")
+	flag.Float64Var(&o.Skew, "skew", 1.1, "skew of the zipf (exponent, > 1) or pareto (shape, > 0) distribution")
+	flag.IntVar(&o.Conns, "conns", 10, "number of gRPC connections")
+	flag.IntVar(&o.Workers, "workers", 50, "number of concurrent workers")
+	flag.IntVar(&o.Pacers, "pacers", 0, "goroutines scheduling calls; 0 for one per 100k rps of peak")
+	flag.BoolVar(&o.Soak, "soak", false, "soak test: snapshot periodically and check for leaks")
+	flag.DurationVar(&o.Snapshot, "snapshot", time.Minute, "soak snapshot interval")
+	flag.StringVar(&o.Metrics, "metrics", "http://localhost:9090/metrics", "target's metrics endpoint, sampled in soak mode")
+	flag.StringVar(&o.Prefixes, "prefixes", "user", "key prefixes to call, by weight, e.g. user=70,api=30")
+	flag.StringVar(&o.Mix, "mix", "allow=100", "RPCs to call, by weight: allow, peek, batch_allow and batch_peek")
+	flag.IntVar(&o.Precision, "precision", 3, "significant digits of recorded latencies, 1 to 5")
+	topKeys := flag.Int("top-keys", 5, "number of busiest keys to report")
+	output := flag.String("output", "text", "results format: text, json or csv")
+	hgrmPath := flag.String("hgrm", "", "write the latency percentile distribution to this file")
+	comparePath := flag.String("compare", "", "JSON results of a baseline run to check this run against")
+	var limits loadtest.Thresholds
+	flag.Float64Var(&limits.LatencyPct, "max-latency-regression", 10, "with -compare, allowed rise of any latency percentile, in %")
+	flag.Float64Var(&limits.RPSPct, "max-rps-regression", 5, "with -compare, allowed drop in throughput, in %")
+	flag.Float64Var(&limits.ErrorPts, "max-error-regression", 0.1, "with -compare, allowed rise in error rate, in percentage points")
+	coordinateAddr := flag.String("coordinate", "", "coordinate a distributed run: listen on this address and split the load over -agents agents")
+	numAgents := flag.Int("agents", 2, "with -coordinate, the number of agents to wait for")
+	join := flag.String("join", "", "run as an agent of the coordinator at this address, with its settings")
+	var sec security
+	sec.flags()
 	flag.Parse()
 
+	dial, err := sec.dialOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *join != "" {
+		if err := runAgent(*join, dial, &sec); err != nil {
+			log.Fatalf("agent: %v", err)
+		}
+		return
+	}
+	if !slices.Contains([]string{"text", "json", "csv"}, *output) {
+		log.Fatalf("unknown -output %q, want text, json or csv", *output)
+	}
+	p, err := o.plan()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var baseline *report
+	if *comparePath != "" {
+		if baseline, err = readReport(*comparePath); err != nil {
+			log.Fatalf("reading baseline: %v", err)
+		}
+	}
+
+	var res *results
+	if *coordinateAddr != "" {
+		switch {
+		case *numAgents < 1:
+			log.Fatalf("-agents %d, want at least 1", *numAgents)
+		case o.Keys < *numAgents:
+			log.Fatalf("-keys %d can't be split over %d agents", o.Keys, *numAgents)
+		case o.Soak:
+			log.Fatal("-soak can't be distributed")
+		}
+		p.log(o)
+		if res, err = coordinate(*coordinateAddr, *numAgents, o, p); err != nil {
+			log.Fatalf("coordinator: %v", err)
+		}
+	} else {
+		p.log(o)
+		log.Printf("  Security: %s", &sec)
+		res = run(o, p, dial, logProgress)
+	}
+
+	rep := res.report(o, p, *topKeys)
+	if *coordinateAddr != "" {
+		rep.Config.Agents = *numAgents
+	}
+	if baseline != nil {
+		for _, d := range baseline.Config.differences(rep.Config) {
+			log.Printf("WARNING: baseline ran with a different %s", d)
+		}
+		rep.Comparison = loadtest.Compare(baseline.run(), rep.run(), limits)
+		rep.Comparison.Baseline = *comparePath
+	}
+	if err := rep.write(os.Stdout, *output); err != nil {
+		log.Fatalf("writing results: %v", err)
+	}
+	if *hgrmPath != "" {
+		if err := writeHgrm(*hgrmPath, res.Latencies.Histogram); err != nil {
+			log.Fatalf("writing percentiles: %v", err)
+		}
+		log.Printf("Latency percentiles written to %s", *hgrmPath)
+	}
+	if c := rep.Comparison; c != nil && c.Regressions > 0 {
+		log.Printf("%d regressions against %s", c.Regressions, c.Baseline)
+		os.Exit(1)
+	}
+}
+
+// options are a run's settings. Agents get theirs from the coordinator.
+type options struct {
+	Addr      string
+	RPS       int
+	Profile   string
+	Scale     float64 // share of the profile's rate, 0 for all of it
+	Duration  time.Duration
+	Keys      int
+	KeyOffset int // number of the first key
+	Dist      string
+	Skew      float64
+	Conns     int
+	Workers   int
+	Pacers    int
+	Soak      bool
+	Snapshot  time.Duration
+	Metrics   string
+	Prefixes  string
+	Mix       string
+	Precision int
+	StartAt   time.Time // when to start, so agents start together
+}
+
+// plan is a run's parsed options.
+type plan struct {
+	dist     loadtest.KeyDist
+	prof     loadtest.Profile
+	mix      *loadtest.Mix
+	prefixes *keyPrefixes
+}
+
+// plan parses o, filling in the pacers when left to the load tester.
+func (o *options) plan() (*plan, error) {
+	if o.Precision < 1 || o.Precision > 5 {
+		return nil, fmt.Errorf("-precision %d out of range, want 1 to 5", o.Precision)
+	}
+	var (
+		p   plan
+		err error
+	)
+	if p.dist, err = loadtest.NewKeyDist(o.Dist, o.Keys, o.Skew); err != nil {
+		return nil, err
+	}
+	if p.prof, err = loadtest.ParseProfile(o.Profile, float64(o.RPS)); err != nil {
+		return nil, err
+	}
+	if o.Scale > 0 {
+		p.prof = p.prof.Scaled(o.Scale)
+	}
+	if p.mix, err = loadtest.ParseMix(o.Mix, mixable()); err != nil {
+		return nil, err
+	}
+	if p.prefixes, err = parsePrefixes(o.Prefixes); err != nil {
+		return nil, err
+	}
+	if o.Pacers <= 0 {
+		o.Pacers = int(math.Ceil(p.prof.Peak() / 100000))
+	}
+	return &p, nil
+}
+
+func (p *plan) log(o options) {
 	log.Printf("Load Test Configuration:")
-	log.Printf("  Target: %s", *addr)
-	log.Printf("  RPS: %d, Duration: %s, Keys: %d", *rps, *dur, *numKeys)
-	log.Printf("  Connections: %d, Workers: %d", *conns, *workers)
+	log.Printf("  Target: %s", o.Addr)
+	log.Printf("  RPS: %s, Duration: %s, Keys: %d (%s)", p.prof, o.Duration, o.Keys, p.dist)
+	if o.Scale > 0 {
+		log.Printf("  Shard: %.3g of the rate, keys %d to %d", o.Scale, o.KeyOffset, o.KeyOffset+o.Keys-1)
+	}
+	log.Printf("  Connections: %d, Workers: %d, Pacers: %d", o.Conns, o.Workers, o.Pacers)
+	log.Printf("  Mix: %s, Prefixes: %s", p.mix, p.prefixes)
+	if o.Soak {
+		log.Printf("  Soak: snapshot every %s, metrics from %s", o.Snapshot, o.Metrics)
+	}
+}
+
+// security is how the load tester connects and authenticates. It stays
+// with each process: agents use their own flags, so certificates and
+// secrets never go through the coordinator.
+type security struct {
+	tls          bool
+	ca           string
+	cert, key    string
+	serverName   string
+	skipVerify   bool
+	apiKey       string
+	apiKeyHeader string
+	jwt          string
+	hmacClient   string
+	hmacSecret   string
+}
+
+func (s *security) flags() {
+	flag.BoolVar(&s.tls, "tls", false, "connect with TLS; implied by -ca and -cert")
+	flag.StringVar(&s.ca, "ca", "", "PEM CA bundle to verify the server with, instead of the system roots")
+	flag.StringVar(&s.cert, "cert", "", "PEM client certificate for mTLS, with -key")
+	flag.StringVar(&s.key, "key", "", "PEM client key for mTLS")
+	flag.StringVar(&s.serverName, "server-name", "", "name to verify the server's certificate against, if not -addr's host")
+	flag.BoolVar(&s.skipVerify, "insecure-skip-verify", false, "don't verify the server's certificate")
+	flag.StringVar(&s.apiKey, "api-key", "", "API key to send on every call, or @file to read it from")
+	flag.StringVar(&s.apiKeyHeader, "api-key-header", "x-api-key", "metadata key carrying -api-key")
+	flag.StringVar(&s.jwt, "jwt", "", "JWT to send as a bearer token on every call, or @file to read it from")
+	flag.StringVar(&s.hmacClient, "hmac-client", "", "client ID to sign every call as, for servers with HMAC_KEYS_FILE")
+	flag.StringVar(&s.hmacSecret, "hmac-secret", "", "-hmac-client's shared secret, or @file to read it from")
+}
 
+// dialOptions returns the transport credentials and the credentials to
+// attach to every call.
+func (s *security) dialOptions() ([]grpc.DialOption, error) {
+	creds := insecure.NewCredentials()
+	if s.tls || s.ca != "" || s.cert != "" || s.key != "" {
+		cfg := &tls.Config{
+			ServerName:         s.serverName,
+			InsecureSkipVerify: s.skipVerify,
+		}
+		if s.ca != "" {
+			pem, err := os.ReadFile(s.ca)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RootCAs = x509.NewCertPool()
+			if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%s: no certificates", s.ca)
+			}
+		}
+		if (s.cert == "") != (s.key == "") {
+			return nil, fmt.Errorf("-cert and -key go together")
+		}
+		if s.cert != "" {
+			cert, err := tls.LoadX509KeyPair(s.cert, s.key)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		creds = credentials.NewTLS(cfg)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+
+	md := make(headers)
+	if s.apiKey != "" {
+		key, err := secret(s.apiKey)
+		if err != nil {
+			return nil, err
+		}
+		md[strings.ToLower(s.apiKeyHeader)] = key
+	}
+	if s.jwt != "" {
+		jwt, err := secret(s.jwt)
+		if err != nil {
+			return nil, err
+		}
+		md["authorization"] = "Bearer " + jwt
+	}
+	if len(md) > 0 {
+		opts = append(opts, grpc.WithPerRPCCredentials(md))
+	}
+	if (s.hmacClient == "") != (s.hmacSecret == "") {
+		return nil, fmt.Errorf("-hmac-client and -hmac-secret go together")
+	}
+	if s.hmacClient != "" {
+		key, err := secret(s.hmacSecret)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithHMAC(s.hmacClient, []byte(key)))
+	}
+	if creds.Info().SecurityProtocol != "tls" && (len(md) > 0 || s.hmacClient != "") {
+		log.Printf("WARNING: sending credentials without TLS")
+	}
+	return opts, nil
+}
+
+func (s *security) String() string {
+	var parts []string
+	switch {
+	case s.cert != "":
+		parts = append(parts, "mTLS")
+	case s.tls || s.ca != "":
+		parts = append(parts, "TLS")
+	default:
+		parts = append(parts, "plaintext")
+	}
+	if s.skipVerify {
+		parts = append(parts, "unverified")
+	}
+	if s.apiKey != "" {
+		parts = append(parts, "API key in "+s.apiKeyHeader)
+	}
+	if s.jwt != "" {
+		parts = append(parts, "JWT")
+	}
+	if s.hmacClient != "" {
+		parts = append(parts, "HMAC as "+s.hmacClient)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// secret returns v, or the contents of the file @v names, so secrets
+// needn't be on the command line.
+func secret(v string) (string, error) {
+	path, ok := strings.CutPrefix(v, "@")
+	if !ok {
+		return v, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// headers are metadata attached to every call.
+type headers map[string]string
+
+func (h headers) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return h, nil
+}
+
+// RequireTransportSecurity is false so plaintext targets behind a local
+// proxy can be tested; dialOptions warns instead.
+func (h headers) RequireTransportSecurity() bool {
+	return false
+}
+
+// progressUpdate is a running total, logged every 5s.
+type progressUpdate struct {
+	Agent                                      int
+	Requests, Allowed, Denied, Errors, Dropped int64
+}
+
+func (u progressUpdate) String() string {
+	return fmt.Sprintf("total=%d allowed=%d denied=%d errors=%d dropped=%d", u.Requests, u.Allowed, u.Denied, u.Errors, u.Dropped)
+}
+
+func logProgress(u progressUpdate) {
+	log.Printf("[progress] %s", u)
+}
+
+// run runs a load test, dialing with dial, and returns its results.
+func run(o options, p *plan, dial []grpc.DialOption, progress func(progressUpdate)) *results {
 	// Create connection pool
-	clients := make([]pb.RateLimitServiceClient, *conns)
-	for i := 0; i < *conns; i++ {
-		conn, err := grpc.Dial(*addr,
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-			grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),
-		)
+	clients := make([]pb.RateLimitServiceClient, o.Conns)
+	for i := 0; i < o.Conns; i++ {
+		conn, err := grpc.Dial(o.Addr, append(dial, grpc.WithDefaultCallOptions(grpc.WaitForReady(true)))...)
 		if err != nil {
 			log.Fatalf("failed to connect: %v", err)
 		}
@@ -49,79 +472,133 @@ func main() {
 
 	// Stats
 	var (
-		totalReqs  atomic.Int64
-		allowed    atomic.Int64
-		denied     atomic.Int64
-		errors     atomic.Int64
-		latencies  sync.Map // stores []time.Duration per worker
+		totalReqs   atomic.Int64
+		allowed     atomic.Int64
+		denied      atomic.Int64
+		errors      atomic.Int64
+		errCodes    [numCodes]atomic.Int64
+		intended    atomic.Int64
+		dropped     atomic.Int64
+		rpcCounters = make([]callCounters, len(p.mix.Entries))
+		keyHits     = make([]atomic.Int64, o.Keys)
+		keyStats    = make([]keyCounters, len(p.prefixes.entries)*o.Keys) // by prefix, then key
+		// Latencies, merged from the workers'
+		latMu      sync.Mutex
+		latencies  = loadtest.NewLatencies(o.Precision)
+		rpcLats    = newHistograms(len(p.mix.Entries), o.Precision)
+		prefixLats = newHistograms(len(p.prefixes.entries), o.Precision)
 	)
 
-	// Rate control
-	interval := time.Second / time.Duration(*rps)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// Latencies of the current soak snapshot
+	var window *latWindow
+	if o.Soak {
+		window = newLatWindow(o.Precision)
+	}
+
+	// Latency by target rate, when it varies
+	var curve *loadCurve
+	if p.prof.Varies() {
+		curve = newLoadCurve(o.Duration, o.Precision)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), *dur)
+	if !o.StartAt.IsZero() {
+		time.Sleep(time.Until(o.StartAt))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), o.Duration)
 	defer cancel()
+	start := time.Now()
 
-	// Request channel
-	reqCh := make(chan struct{}, *rps*2)
+	// Intended start times of the calls, two seconds' worth at peak
+	reqCh := make(chan time.Time, int(p.prof.Peak()*2)+1)
 
 	// Workers
 	var wg sync.WaitGroup
-	for w := 0; w < *workers; w++ {
+	for w := 0; w < o.Workers; w++ {
 		wg.Add(1)
 		go func(id int) {
 			defer wg.Done()
 			client := clients[id%len(clients)]
-			var lats []time.Duration
+			r := rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+			nextKey := p.dist.Sampler(r)
+			lats := loadtest.NewLatencies(o.Precision)
+			myRPCLats := newHistograms(len(p.mix.Entries), o.Precision)
+			myPrefixLats := newHistograms(len(p.prefixes.entries), o.Precision)
 
 			for {
 				select {
 				case <-ctx.Done():
-					latencies.Store(id, lats)
+					latMu.Lock()
+					latencies.Merge(lats)
+					for i := range rpcLats {
+						rpcLats[i].Merge(myRPCLats[i])
+					}
+					for i := range prefixLats {
+						prefixLats[i].Merge(myPrefixLats[i])
+					}
+					latMu.Unlock()
 					return
-				case <-reqCh:
-					key := fmt.Sprintf("user:%d", rand.Intn(*numKeys))
-					start := time.Now()
+				case due := <-reqCh:
+					i := p.mix.Pick(r)
+					e, calls := p.mix.Entries[i], &rpcCounters[i]
+					// A batch's keys share a prefix, as if from one caller
+					pi := p.prefixes.pick(r)
+					keys, stats := make([]string, e.Size), make([]*keyCounters, e.Size)
+					for j := range keys {
+						k := nextKey()
+						keyHits[k].Add(1)
+						keys[j] = p.prefixes.entries[pi].name + ":" + strconv.Itoa(o.KeyOffset+k)
+						stats[j] = &keyStats[pi*o.Keys+k]
+					}
+					callStart := time.Now()
 
 					callCtx, callCancel := context.WithTimeout(ctx, 2*time.Second)
-					resp, err := client.Allow(callCtx, &pb.AllowRequest{
-						Key:    key,
-						Tokens: 1,
-					})
+					decisions, err := rpcs[e.Index].call(callCtx, client, keys)
 					callCancel()
 
-					lat := time.Since(start)
-					lats = append(lats, lat)
+					lat := lats.Record(due, callStart, time.Now())
+					loadtest.Record(myRPCLats[i], lat)
+					loadtest.Record(myPrefixLats[pi], lat)
+					if window != nil {
+						window.add(lat)
+					}
+					if curve != nil {
+						curve.add(callStart.Sub(start), lat, err != nil)
+					}
 					totalReqs.Add(1)
+					calls.calls.Add(1)
 
 					if err != nil {
 						errors.Add(1)
-					} else if resp.Allowed {
-						allowed.Add(1)
-					} else {
-						denied.Add(1)
+						calls.errors.Add(1)
+						errCodes[codeIndex(err)].Add(1)
+					}
+					for j, ks := range stats {
+						ks.requests.Add(1)
+						switch {
+						case err != nil:
+							ks.errors.Add(1)
+						case decisions[j] == allowedKey:
+							ks.allowed.Add(1)
+							allowed.Add(1)
+							calls.allowed.Add(1)
+						case decisions[j] == deniedKey:
+							ks.denied.Add(1)
+							denied.Add(1)
+							calls.denied.Add(1)
+						case decisions[j] == failedKey:
+							ks.errors.Add(1)
+							calls.itemErrors.Add(1)
+						}
 					}
 				}
 			}
 		}(w)
 	}
 
-	// Ticker goroutine dispatches requests at target RPS
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				select {
-				case reqCh <- struct{}{}:
-				default: // drop if workers can't keep up
-				}
-			}
-		}
-	}()
+	// Schedule calls at the profile's rate
+	for n := 0; n < o.Pacers; n++ {
+		go loadtest.NewPacer(p.prof, start, start.Add(o.Duration), n, o.Pacers).Run(ctx, reqCh, &intended, &dropped)
+	}
 
 	// Progress reporter
 	go func() {
@@ -132,50 +609,1049 @@ func main() {
 			case <-ctx.Done():
 				return
 			case <-t.C:
-				log.Printf("[progress] total=%d allowed=%d denied=%d errors=%d",
-					totalReqs.Load(), allowed.Load(), denied.Load(), errors.Load())
+				progress(progressUpdate{
+					Requests: totalReqs.Load(),
+					Allowed:  allowed.Load(),
+					Denied:   denied.Load(),
+					Errors:   errors.Load(),
+					Dropped:  dropped.Load(),
+				})
 			}
 		}
 	}()
 
+	var snapshots []soakSnapshot
+	soakDone := make(chan struct{})
+	if o.Soak {
+		go func() {
+			snapshots = runSoak(ctx, window, o.Snapshot, o.Metrics, &totalReqs, &errors)
+			close(soakDone)
+		}()
+	} else {
+		close(soakDone)
+	}
+
 	wg.Wait()
+	<-soakDone
+
+	res := &results{Results: loadtest.Results{
+		Started:    start,
+		Requests:   totalReqs.Load(),
+		Intended:   intended.Load(),
+		Dropped:    dropped.Load(),
+		Allowed:    allowed.Load(),
+		Denied:     denied.Load(),
+		Errors:     errors.Load(),
+		ErrorCodes: make([]int64, numCodes),
+		Latencies:  loadtest.Histogram{Histogram: latencies.Actual},
+		Corrected:  loadtest.Histogram{Histogram: latencies.Corrected},
+		RPCs:       make([]loadtest.RPCResults, len(rpcCounters)),
+		Prefixes:   make([]loadtest.Histogram, len(prefixLats)),
+		KeyOffset:  o.KeyOffset,
+		KeyHits:    make([]int64, o.Keys),
+		Keys:       make([][]loadtest.KeyCounts, len(p.prefixes.entries)),
+	}, Soak: snapshots}
+	for c := range errCodes {
+		res.ErrorCodes[c] = errCodes[c].Load()
+	}
+	for i := range rpcCounters {
+		res.RPCs[i] = rpcCounters[i].results(rpcLats[i])
+	}
+	for i, h := range prefixLats {
+		res.Prefixes[i] = loadtest.Histogram{Histogram: h}
+	}
+	for k := range keyHits {
+		res.KeyHits[k] = keyHits[k].Load()
+	}
+	for i := range res.Keys {
+		res.Keys[i] = make([]loadtest.KeyCounts, o.Keys)
+		for k := range res.Keys[i] {
+			res.Keys[i][k] = keyStats[i*o.Keys+k].counts()
+		}
+	}
+	if curve != nil {
+		res.Curve = curve.results()
+	}
+	return res
+}
+
+// results are a run's results, plus its snapshots in soak mode, which
+// isn't distributed.
+type results struct {
+	loadtest.Results
+	Soak []soakSnapshot `json:"-"`
+}
+
+// newResults returns empty results to merge the agents' into.
+func newResults(o options, p *plan) *results {
+	r := &results{Results: loadtest.Results{
+		ErrorCodes: make([]int64, numCodes),
+		Latencies:  loadtest.Histogram{Histogram: loadtest.NewHistogram(o.Precision)},
+		Corrected:  loadtest.Histogram{Histogram: loadtest.NewHistogram(o.Precision)},
+		RPCs:       make([]loadtest.RPCResults, len(p.mix.Entries)),
+		Prefixes:   make([]loadtest.Histogram, len(p.prefixes.entries)),
+		KeyHits:    make([]int64, o.Keys),
+		Keys:       make([][]loadtest.KeyCounts, len(p.prefixes.entries)),
+	}}
+	for i := range r.RPCs {
+		r.RPCs[i].Latencies = loadtest.Histogram{Histogram: loadtest.NewHistogram(o.Precision)}
+	}
+	for i := range r.Prefixes {
+		r.Prefixes[i] = loadtest.Histogram{Histogram: loadtest.NewHistogram(o.Precision)}
+	}
+	for i := range r.Keys {
+		r.Keys[i] = make([]loadtest.KeyCounts, o.Keys)
+	}
+	if p.prof.Varies() {
+		r.Curve = newLoadCurve(o.Duration, o.Precision).results()
+	}
+	return r
+}
+
+// report builds the report of a run with o.
+func (r *results) report(o options, p *plan, topKeys int) *report {
+	rep := &report{
+		Config: runConfig{
+			Addr:      o.Addr,
+			Started:   r.Started,
+			Profile:   p.prof.String(),
+			Duration:  o.Duration.String(),
+			Keys:      o.Keys,
+			Dist:      p.dist.String(),
+			Conns:     o.Conns,
+			Workers:   o.Workers,
+			Pacers:    o.Pacers,
+			Soak:      o.Soak,
+			Precision: o.Precision,
+			Mix:       p.mix.String(),
+			Prefixes:  p.prefixes.String(),
+		},
+		Requests:    r.Requests,
+		IntendedRPS: float64(r.Intended) / o.Duration.Seconds(),
+		RPS:         float64(r.Requests) / o.Duration.Seconds(),
+		Dropped:     r.Dropped,
+		Allowed:     r.Allowed,
+		Denied:      r.Denied,
+		Errors:      r.Errors,
+		Keys:        keySkewOf(r.KeyHits),
+		RPCs:        mixStats(p.mix, r.RPCs),
+		Prefixes:    p.prefixes.stats(r.Keys, r.Prefixes, o.Duration),
+		TopKeys:     busiestKeys(r.Keys, p.prefixes, r.KeyOffset, topKeys),
+	}
+	for c, n := range r.ErrorCodes {
+		if n > 0 {
+			if rep.ErrorCodes == nil {
+				rep.ErrorCodes = make(map[string]int64)
+			}
+			rep.ErrorCodes[codes.Code(c).String()] = n
+		}
+	}
+	if r.Latencies.TotalCount() > 0 {
+		rep.LatencyMs = loadtest.Summarize(r.Latencies.Histogram)
+		rep.CorrectedLatencyMs = loadtest.Summarize(r.Corrected.Histogram)
+	}
+	if r.Curve != nil {
+		rep.Curve = curvePoints(p.prof, o.Duration, r.Curve)
+	}
+	if o.Soak {
+		rep.Soak = r.Soak
+		rep.Leaks = leaks(r.Soak)
+	}
+	return rep
+}
+
+func newHistograms(n, precision int) []*hdrhistogram.Histogram {
+	hs := make([]*hdrhistogram.Histogram, n)
+	for i := range hs {
+		hs[i] = loadtest.NewHistogram(precision)
+	}
+	return hs
+}
+
+// callCounters count the calls of one RPC of the mix.
+type callCounters struct {
+	calls, errors, allowed, denied, itemErrors atomic.Int64
+}
+
+func (c *callCounters) results(lats *hdrhistogram.Histogram) loadtest.RPCResults {
+	return loadtest.RPCResults{
+		Calls:      c.calls.Load(),
+		Errors:     c.errors.Load(),
+		Allowed:    c.allowed.Load(),
+		Denied:     c.denied.Load(),
+		ItemErrors: c.itemErrors.Load(),
+		Latencies:  loadtest.Histogram{Histogram: lats},
+	}
+}
+
+// Distributed runs (-coordinate, -join) go over HTTP with JSON bodies:
+// agents POST /register and wait for their assignment, which the
+// coordinator sends once every agent has joined; they then POST /progress
+// every 5s and /results at the end.
+
+// assignment is an agent's share of a distributed run.
+type assignment struct {
+	Agent   int
+	Options options
+}
+
+// agentResults are the results an agent sends back.
+type agentResults struct {
+	Agent   int
+	Results *results
+}
+
+// shard returns agent i of n's options: 1/n of the rate and a 1/n slice of
+// the keyspace.
+func (o options) shard(i, n int) options {
+	s := o
+	s.Scale = 1 / float64(n)
+	off, keys := loadtest.Shard(o.Keys, i, n)
+	s.KeyOffset, s.Keys = o.KeyOffset+off, keys
+	return s
+}
+
+// coordinate runs a distributed load test: it waits for n agents to join
+// at addr, starts them together on their shards of o, and merges their
+// results.
+func coordinate(addr string, n int, o options, p *plan) (*results, error) {
+	var (
+		mu      sync.Mutex
+		joined  int
+		startAt time.Time
+		ready   = make(chan struct{})
+		reports = make(chan agentResults, n)
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Name string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		if joined == n {
+			mu.Unlock()
+			http.Error(w, "all agents have joined", http.StatusConflict)
+			return
+		}
+		i := joined
+		joined++
+		log.Printf("[coordinator] agent %d joined: %s from %s (%d of %d)", i, req.Name, r.RemoteAddr, joined, n)
+		if joined == n {
+			startAt = time.Now().Add(2 * time.Second)
+			close(ready)
+		}
+		mu.Unlock()
 
-	// Aggregate latencies
-	var allLats []time.Duration
-	latencies.Range(func(_, v interface{}) bool {
-		allLats = append(allLats, v.([]time.Duration)...)
-		return true
+		<-ready
+		a := assignment{Agent: i, Options: o.shard(i, n)}
+		a.Options.StartAt = startAt
+		json.NewEncoder(w).Encode(a)
 	})
-	sort.Slice(allLats, func(i, j int) bool { return allLats[i] < allLats[j] })
+	mux.HandleFunc("/progress", func(w http.ResponseWriter, r *http.Request) {
+		var u progressUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[agent %d] %s", u.Agent, u)
+	})
+	mux.HandleFunc("/results", func(w http.ResponseWriter, r *http.Request) {
+		var a agentResults
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.Results == nil {
+			http.Error(w, fmt.Sprintf("bad results: %v", err), http.StatusBadRequest)
+			return
+		}
+		reports <- a
+	})
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(lis)
+	defer srv.Close()
+	log.Printf("[coordinator] waiting for %d agents on %s", n, lis.Addr())
+
+	<-ready
+	log.Printf("[coordinator] all agents joined, starting")
+	timeout := time.NewTimer(time.Until(startAt) + o.Duration + time.Minute)
+	defer timeout.Stop()
+	merged := newResults(o, p)
+	merged.KeyOffset = o.KeyOffset
+	for done := make([]bool, n); n > 0; n-- {
+		select {
+		case a := <-reports:
+			if a.Agent < 0 || a.Agent >= len(done) || done[a.Agent] {
+				return nil, fmt.Errorf("unexpected results from agent %d", a.Agent)
+			}
+			if err := merged.Merge(&a.Results.Results); err != nil {
+				return nil, fmt.Errorf("agent %d: %w", a.Agent, err)
+			}
+			done[a.Agent] = true
+			log.Printf("[coordinator] agent %d done: %d requests", a.Agent, a.Results.Requests)
+		case <-timeout.C:
+			return nil, fmt.Errorf("%d agents didn't send results", n)
+		}
+	}
+	return merged, nil
+}
+
+// runAgent joins the coordinator at addr, runs its share of the load with
+// its own security settings and sends the results back.
+func runAgent(addr string, dial []grpc.DialOption, sec *security) error {
+	base := "http://" + addr
+	name, _ := os.Hostname()
+	log.Printf("[agent] joining %s", base)
+	var a assignment
+	if err := postJSON(base+"/register", struct{ Name string }{name}, &a); err != nil {
+		return err
+	}
+	o := a.Options
+	p, err := o.plan()
+	if err != nil {
+		return err
+	}
+	log.Printf("[agent %d] starting at %s", a.Agent, o.StartAt.Format(time.TimeOnly))
+	p.log(o)
+	log.Printf("  Security: %s", sec)
+	res := run(o, p, dial, func(u progressUpdate) {
+		logProgress(u)
+		u.Agent = a.Agent
+		if err := postJSON(base+"/progress", u, nil); err != nil {
+			log.Printf("[agent %d] progress: %v", a.Agent, err)
+		}
+	})
+	log.Printf("[agent %d] done: %d requests, sending results", a.Agent, res.Requests)
+	return postJSON(base+"/results", agentResults{Agent: a.Agent, Results: res}, nil)
+}
+
+// postJSON posts body as JSON to url, decoding the reply into reply unless
+// it's nil.
+func postJSON(url string, body, reply any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s: %s", url, resp.Status, bytes.TrimSpace(msg))
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// numCodes is the number of gRPC status codes.
+const numCodes = int(codes.Unauthenticated) + 1
+
+// codeIndex returns err's gRPC code, as an index into per-code counters.
+func codeIndex(err error) int {
+	if c := int(status.Code(err)); c < numCodes {
+		return c
+	}
+	return int(codes.Unknown)
+}
 
-	total := totalReqs.Load()
-	actualDur := *dur
+// report is a run's results, as printed or written with -output.
+type report struct {
+	Config      runConfig                `json:"config"`
+	Requests    int64                    `json:"requests"`
+	IntendedRPS float64                  `json:"intended_rps"`
+	RPS         float64                  `json:"rps"`
+	Dropped     int64                    `json:"dropped"` // scheduled, but the workers were too far behind
+	Allowed     int64                    `json:"allowed"`
+	Denied      int64                    `json:"denied"`
+	Errors      int64                    `json:"errors"`
+	ErrorCodes  map[string]int64         `json:"error_codes,omitempty"` // by gRPC code
+	LatencyMs   *loadtest.LatencySummary `json:"latency_ms,omitempty"`
+	// From intended rather than actual starts
+	CorrectedLatencyMs *loadtest.LatencySummary `json:"corrected_latency_ms,omitempty"`
+	Keys               keySkew                  `json:"keys"`
+	RPCs               []rpcStats               `json:"rpcs"`
+	Prefixes           []prefixStats            `json:"prefixes"`
+	TopKeys            []keyStat                `json:"top_keys,omitempty"`
+	Curve              []curvePoint             `json:"curve,omitempty"`
+	Soak               []soakSnapshot           `json:"soak,omitempty"`
+	Leaks              []string                 `json:"suspected_leaks,omitempty"`
+	Comparison         *loadtest.Comparison     `json:"comparison,omitempty"`
+}
 
-	fmt.Fprintf(os.Stdout, "\n")
-	fmt.Fprintf(os.Stdout, "═══════════════════════════════════════════\n")
-	fmt.Fprintf(os.Stdout, "  LOAD TEST RESULTS\n")
-	fmt.Fprintf(os.Stdout, "═══════════════════════════════════════════\n")
-	fmt.Fprintf(os.Stdout, "  Total Requests : %d\n", total)
-	fmt.Fprintf(os.Stdout, "  Actual RPS     : %.0f\n", float64(total)/actualDur.Seconds())
-	fmt.Fprintf(os.Stdout, "  Allowed        : %d (%.1f%%)\n", allowed.Load(), pct(allowed.Load(), total))
-	fmt.Fprintf(os.Stdout, "  Denied         : %d (%.1f%%)\n", denied.Load(), pct(denied.Load(), total))
-	fmt.Fprintf(os.Stdout, "  Errors         : %d (%.1f%%)\n", errors.Load(), pct(errors.Load(), total))
-	fmt.Fprintf(os.Stdout, "───────────────────────────────────────────\n")
+type runConfig struct {
+	Addr      string    `json:"addr"`
+	Started   time.Time `json:"started"`
+	Profile   string    `json:"profile"`
+	Duration  string    `json:"duration"`
+	Keys      int       `json:"keys"`
+	Dist      string    `json:"dist"`
+	Conns     int       `json:"conns"`
+	Workers   int       `json:"workers"`
+	Pacers    int       `json:"pacers"`
+	Soak      bool      `json:"soak"`
+	Precision int       `json:"precision"` // significant digits of latencies
+	Mix       string    `json:"mix"`
+	Prefixes  string    `json:"prefixes"`
+	Agents    int       `json:"agents,omitempty"` // of a distributed run
+}
+
+func (r *report) write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "csv":
+		return r.writeCSV(w)
+	default:
+		r.print(w)
+		return nil
+	}
+}
 
-	if len(allLats) > 0 {
-		fmt.Fprintf(os.Stdout, "  Latency (ms):\n")
-		fmt.Fprintf(os.Stdout, "    p50  = %.2f\n", pN(allLats, 50).Seconds()*1000)
-		fmt.Fprintf(os.Stdout, "    p90  = %.2f\n", pN(allLats, 90).Seconds()*1000)
-		fmt.Fprintf(os.Stdout, "    p95  = %.2f\n", pN(allLats, 95).Seconds()*1000)
-		fmt.Fprintf(os.Stdout, "    p99  = %.2f\n", pN(allLats, 99).Seconds()*1000)
-		fmt.Fprintf(os.Stdout, "    max  = %.2f\n", allLats[len(allLats)-1].Seconds()*1000)
+// writeCSV writes a header and a single row. The columns don't depend on
+// the run, so rows of many runs can be appended to one file.
+func (r *report) writeCSV(w io.Writer) error {
+	header := []string{
+		"started", "addr", "profile", "duration", "keys", "dist", "conns", "workers", "soak", "precision", "mix",
+		"requests", "intended_rps", "rps", "dropped", "allowed", "denied", "errors",
+		"p50_ms", "p90_ms", "p95_ms", "p99_ms", "p99_9_ms", "p99_99_ms", "max_ms",
+		"corrected_p50_ms", "corrected_p99_ms", "corrected_p99_9_ms", "corrected_max_ms",
+		"keys_used", "hottest_key_pct", "top1_pct", "top10_pct",
+	}
+	c := r.Config
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	row := []string{
+		c.Started.Format(time.RFC3339), c.Addr, c.Profile, c.Duration, strconv.Itoa(c.Keys), c.Dist,
+		strconv.Itoa(c.Conns), strconv.Itoa(c.Workers), strconv.FormatBool(c.Soak), strconv.Itoa(c.Precision), c.Mix,
+		strconv.FormatInt(r.Requests, 10), f(r.IntendedRPS), f(r.RPS), strconv.FormatInt(r.Dropped, 10),
+		strconv.FormatInt(r.Allowed, 10), strconv.FormatInt(r.Denied, 10), strconv.FormatInt(r.Errors, 10),
+	}
+	if l := r.LatencyMs; l != nil {
+		row = append(row, f(l.P50), f(l.P90), f(l.P95), f(l.P99), f(l.P999), f(l.P9999), f(l.Max))
+	} else {
+		row = append(row, "", "", "", "", "", "", "")
+	}
+	if l := r.CorrectedLatencyMs; l != nil {
+		row = append(row, f(l.P50), f(l.P99), f(l.P999), f(l.Max))
+	} else {
+		row = append(row, "", "", "", "")
+	}
+	row = append(row, strconv.Itoa(r.Keys.Used), f(r.Keys.HottestPct), f(r.Keys.Top1Pct), f(r.Keys.Top10Pct))
+	for code := 1; code < numCodes; code++ {
+		name := codes.Code(code).String()
+		header = append(header, "errors_"+name)
+		row = append(row, strconv.FormatInt(r.ErrorCodes[name], 10))
+	}
+	// Every RPC gets columns, called or not
+	for _, rpc := range rpcs {
+		header = append(header, rpc.Name+"_calls", rpc.Name+"_errors", rpc.Name+"_p50_ms", rpc.Name+"_p99_ms")
+		i := slices.IndexFunc(r.RPCs, func(s rpcStats) bool { return s.RPC == rpc.Name })
+		if i < 0 || r.RPCs[i].LatencyMs == nil {
+			row = append(row, "0", "0", "", "")
+			continue
+		}
+		s := r.RPCs[i]
+		row = append(row, strconv.FormatInt(s.Calls, 10), strconv.FormatInt(s.Errors, 10), f(s.LatencyMs.P50), f(s.LatencyMs.P99))
 	}
-	fmt.Fprintf(os.Stdout, "═══════════════════════════════════════════\n")
+
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.Write(row)
+	cw.Flush()
+	return cw.Error()
 }
 
-func pN(sorted []time.Duration, p float64) time.Duration {
-	idx := int(float64(len(sorted)-1) * p / 100)
-	return sorted[idx]
+// print prints the results for a human.
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "\n")
+	fmt.Fprintf(w, "═══════════════════════════════════════════\n")
+	fmt.Fprintf(w, "  LOAD TEST RESULTS\n")
+	fmt.Fprintf(w, "═══════════════════════════════════════════\n")
+	fmt.Fprintf(w, "  Total Requests : %d\n", r.Requests)
+	fmt.Fprintf(w, "  Intended RPS   : %.0f\n", r.IntendedRPS)
+	fmt.Fprintf(w, "  Actual RPS     : %.0f\n", r.RPS)
+	if r.Dropped > 0 {
+		fmt.Fprintf(w, "  Dropped        : %d (workers over 2s behind)\n", r.Dropped)
+	}
+	fmt.Fprintf(w, "  Allowed        : %d (%.1f%%)\n", r.Allowed, pct(r.Allowed, r.Allowed+r.Denied))
+	fmt.Fprintf(w, "  Denied         : %d (%.1f%%)\n", r.Denied, pct(r.Denied, r.Allowed+r.Denied))
+	fmt.Fprintf(w, "  Errors         : %d (%.1f%%)\n", r.Errors, pct(r.Errors, r.Requests))
+	names := make([]string, 0, len(r.ErrorCodes))
+	for name := range r.ErrorCodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "    %-18s : %d\n", name, r.ErrorCodes[name])
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+	r.Keys.print(w)
+
+	if l := r.LatencyMs; l != nil {
+		fmt.Fprintf(w, "  Latency (ms):\n")
+		fmt.Fprintf(w, "    p50    = %.2f\n", l.P50)
+		fmt.Fprintf(w, "    p90    = %.2f\n", l.P90)
+		fmt.Fprintf(w, "    p95    = %.2f\n", l.P95)
+		fmt.Fprintf(w, "    p99    = %.2f\n", l.P99)
+		fmt.Fprintf(w, "    p99.9  = %.2f\n", l.P999)
+		fmt.Fprintf(w, "    p99.99 = %.2f\n", l.P9999)
+		fmt.Fprintf(w, "    max    = %.2f\n", l.Max)
+	}
+	if l := r.CorrectedLatencyMs; l != nil {
+		fmt.Fprintf(w, "  From intended start (ms):\n")
+		fmt.Fprintf(w, "    p50    = %.2f\n", l.P50)
+		fmt.Fprintf(w, "    p99    = %.2f\n", l.P99)
+		fmt.Fprintf(w, "    p99.9  = %.2f\n", l.P999)
+		fmt.Fprintf(w, "    max    = %.2f\n", l.Max)
+	}
+	if len(r.RPCs) > 1 || len(r.RPCs) == 1 && r.RPCs[0].RPC != "allow" {
+		printRPCs(w, r.RPCs)
+	}
+	if len(r.Prefixes) > 1 {
+		printPrefixes(w, r.Prefixes)
+	}
+	if len(r.TopKeys) > 0 {
+		printTopKeys(w, r.TopKeys)
+	}
+	if len(r.Curve) > 0 {
+		printCurve(w, r.Curve)
+	}
+	if r.Config.Soak {
+		printSoak(w, r.Soak, r.Leaks)
+	}
+	if r.Comparison != nil {
+		printComparison(w, r.Comparison)
+	}
+	fmt.Fprintf(w, "═══════════════════════════════════════════\n")
+}
+
+// readReport reads the JSON results of an earlier run.
+func readReport(path string) (*report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r report
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if r.Requests == 0 {
+		return nil, fmt.Errorf("%s: no requests; not the JSON output of a run?", path)
+	}
+	return &r, nil
+}
+
+// run is what -compare checks of r.
+func (r *report) run() loadtest.Run {
+	run := loadtest.Run{
+		RPS:              r.RPS,
+		Requests:         r.Requests,
+		Errors:           r.Errors,
+		Latency:          r.LatencyMs,
+		CorrectedLatency: r.CorrectedLatencyMs,
+	}
+	for _, s := range r.RPCs {
+		run.RPCs = append(run.RPCs, loadtest.RPCLatency{RPC: s.RPC, Latency: s.LatencyMs})
+	}
+	return run
+}
+
+// differences lists the settings c ran with that other didn't, which make
+// a comparison of the two meaningless.
+func (c runConfig) differences(other runConfig) []string {
+	var diffs []string
+	for _, f := range []struct {
+		name        string
+		this, other any
+	}{
+		{"-profile", c.Profile, other.Profile},
+		{"-duration", c.Duration, other.Duration},
+		{"-keys", c.Keys, other.Keys},
+		{"-dist", c.Dist, other.Dist},
+		{"-conns", c.Conns, other.Conns},
+		{"-workers", c.Workers, other.Workers},
+		{"-pacers", c.Pacers, other.Pacers},
+		{"-mix", c.Mix, other.Mix},
+		{"-prefixes", c.Prefixes, other.Prefixes},
+	} {
+		if f.this != f.other {
+			diffs = append(diffs, fmt.Sprintf("%s (%v, now %v)", f.name, f.this, f.other))
+		}
+	}
+	return diffs
+}
+
+func printComparison(w io.Writer, c *loadtest.Comparison) {
+	fmt.Fprintf(w, "  Against %s:\n", c.Baseline)
+	fmt.Fprintf(w, "    %-20s %10s %10s %9s\n", "metric", "baseline", "current", "change")
+	for _, d := range c.Metrics {
+		unit, verdict := "%", ""
+		if strings.HasPrefix(d.Metric, "error rate") {
+			unit = "pt"
+		}
+		if d.Regressed {
+			verdict = fmt.Sprintf("  REGRESSION (limit %g%s)", d.Limit, unit)
+		}
+		fmt.Fprintf(w, "    %-20s %10.2f %10.2f %+8.1f%s%s\n", d.Metric, d.Baseline, d.Current, d.Change, unit, verdict)
+	}
+	if c.Regressions == 0 {
+		fmt.Fprintf(w, "  No regressions\n")
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// rpc is an RPC the load tester can call, with keys it decides on.
+type rpc struct {
+	loadtest.RPC
+	call func(ctx context.Context, c pb.RateLimitServiceClient, keys []string) ([]decision, error)
+}
+
+// decision is what a successful call decided for one of its keys.
+type decision uint8
+
+const (
+	undecided decision = iota // peeked
+	allowedKey
+	deniedKey
+	failedKey // the item failed, in an otherwise successful batch
+)
+
+func decide(allowed bool) decision {
+	if allowed {
+		return allowedKey
+	}
+	return deniedKey
+}
+
+var rpcs = []rpc{
+	{RPC: loadtest.RPC{Name: "allow"}, call: func(ctx context.Context, c pb.RateLimitServiceClient, keys []string) ([]decision, error) {
+		resp, err := c.Allow(ctx, &pb.AllowRequest{Key: keys[0], Tokens: 1})
+		if err != nil {
+			return nil, err
+		}
+		return []decision{decide(resp.Allowed)}, nil
+	}},
+	{RPC: loadtest.RPC{Name: "peek"}, call: func(ctx context.Context, c pb.RateLimitServiceClient, keys []string) ([]decision, error) {
+		_, err := c.Peek(ctx, &pb.PeekRequest{Key: keys[0]})
+		return []decision{undecided}, err
+	}},
+	{RPC: loadtest.RPC{Name: "batch_allow", Batch: true}, call: func(ctx context.Context, c pb.RateLimitServiceClient, keys []string) ([]decision, error) {
+		req := &pb.BatchAllowRequest{Requests: make([]*pb.AllowRequest, len(keys))}
+		for i, key := range keys {
+			req.Requests[i] = &pb.AllowRequest{Key: key, Tokens: 1}
+		}
+		resp, err := c.BatchAllow(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		decisions := make([]decision, len(keys))
+		for i, item := range resp.Results {
+			if item.Error != nil {
+				decisions[i] = failedKey
+			} else {
+				decisions[i] = decide(item.Response.GetAllowed())
+			}
+		}
+		return decisions, nil
+	}},
+	{RPC: loadtest.RPC{Name: "batch_peek", Batch: true}, call: func(ctx context.Context, c pb.RateLimitServiceClient, keys []string) ([]decision, error) {
+		req := &pb.BatchPeekRequest{Requests: make([]*pb.PeekRequest, len(keys))}
+		for i, key := range keys {
+			req.Requests[i] = &pb.PeekRequest{Key: key}
+		}
+		resp, err := c.BatchPeek(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		decisions := make([]decision, len(keys))
+		for i, item := range resp.Results {
+			if item.Error != nil {
+				decisions[i] = failedKey
+			}
+		}
+		return decisions, nil
+	}},
+}
+
+// mixable returns the RPCs a -mix can name.
+func mixable() []loadtest.RPC {
+	rs := make([]loadtest.RPC, len(rpcs))
+	for i, r := range rpcs {
+		rs[i] = r.RPC
+	}
+	return rs
+}
+
+// rpcStats are the results of one RPC of the mix.
+type rpcStats struct {
+	RPC        string                   `json:"rpc"`
+	BatchSize  int                      `json:"batch_size,omitempty"`
+	SharePct   float64                  `json:"share_pct"` // of the mix's weight
+	Calls      int64                    `json:"calls"`
+	Errors     int64                    `json:"errors"`
+	Allowed    int64                    `json:"allowed"`
+	Denied     int64                    `json:"denied"`
+	ItemErrors int64                    `json:"item_errors,omitempty"` // failed items of successful batches
+	LatencyMs  *loadtest.LatencySummary `json:"latency_ms,omitempty"`
+}
+
+// mixStats returns the results of each RPC of m.
+func mixStats(m *loadtest.Mix, res []loadtest.RPCResults) []rpcStats {
+	stats := make([]rpcStats, len(m.Entries))
+	for i, e := range m.Entries {
+		r := res[i]
+		s := rpcStats{
+			RPC:        e.RPC.Name,
+			SharePct:   m.Share(i),
+			Calls:      r.Calls,
+			Errors:     r.Errors,
+			Allowed:    r.Allowed,
+			Denied:     r.Denied,
+			ItemErrors: r.ItemErrors,
+		}
+		if e.RPC.Batch {
+			s.BatchSize = e.Size
+		}
+		if r.Latencies.TotalCount() > 0 {
+			s.LatencyMs = loadtest.Summarize(r.Latencies.Histogram)
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+func printRPCs(w io.Writer, stats []rpcStats) {
+	fmt.Fprintf(w, "  By RPC:\n")
+	fmt.Fprintf(w, "    %-14s %6s %9s %7s %9s %9s %9s\n", "rpc", "share", "calls", "errors", "p50 ms", "p99 ms", "max ms")
+	for _, s := range stats {
+		name := s.RPC
+		if s.BatchSize > 0 {
+			name += ":" + strconv.Itoa(s.BatchSize)
+		}
+		var l loadtest.LatencySummary
+		if s.LatencyMs != nil {
+			l = *s.LatencyMs
+		}
+		fmt.Fprintf(w, "    %-14s %5.1f%% %9d %7d %9.2f %9.2f %9.2f\n", name, s.SharePct, s.Calls, s.Errors, l.P50, l.P99, l.Max)
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// keyPrefixes picks the prefix of each call's keys, by weight.
+type keyPrefixes struct {
+	entries []*prefixEntry
+	total   float64
+}
+
+type prefixEntry struct {
+	name   string
+	weight float64
+}
+
+// keyCounters count the calls of one key. A batch counts once for each of
+// its keys.
+type keyCounters struct {
+	requests, allowed, denied, errors atomic.Int64
+}
+
+func (c *keyCounters) counts() loadtest.KeyCounts {
+	return loadtest.KeyCounts{
+		Requests: c.requests.Load(),
+		Allowed:  c.allowed.Load(),
+		Denied:   c.denied.Load(),
+		Errors:   c.errors.Load(),
+	}
+}
+
+// parsePrefixes parses "PREFIX[=WEIGHT],..." such as "user=70,api=30".
+func parsePrefixes(spec string) (*keyPrefixes, error) {
+	p := &keyPrefixes{}
+	for _, part := range strings.Split(spec, ",") {
+		name, weight, weighted := strings.Cut(strings.TrimSpace(part), "=")
+		w := 1.0
+		if weighted {
+			var err error
+			if w, err = strconv.ParseFloat(weight, 64); err != nil || w <= 0 {
+				return nil, fmt.Errorf("bad -prefixes entry %q, want PREFIX[=WEIGHT]", part)
+			}
+		}
+		if name == "" || strings.Contains(name, ":") {
+			return nil, fmt.Errorf("bad -prefixes entry %q: prefixes are the part of a key before its first ':'", part)
+		}
+		if slices.ContainsFunc(p.entries, func(e *prefixEntry) bool { return e.name == name }) {
+			return nil, fmt.Errorf("bad -prefixes entry %q: %s listed twice", part, name)
+		}
+		p.entries = append(p.entries, &prefixEntry{name: name, weight: w})
+		p.total += w
+	}
+	return p, nil
+}
+
+func (p *keyPrefixes) String() string {
+	if len(p.entries) == 1 {
+		return p.entries[0].name
+	}
+	parts := make([]string, len(p.entries))
+	for i, e := range p.entries {
+		parts[i] = e.name + "=" + strconv.FormatFloat(e.weight, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *keyPrefixes) pick(r *rand.Rand) int {
+	return loadtest.PickWeighted(r, len(p.entries), p.total, func(i int) float64 { return p.entries[i].weight })
+}
+
+// prefixStats are the results of the keys sharing a prefix.
+type prefixStats struct {
+	Prefix    string                   `json:"prefix"`
+	SharePct  float64                  `json:"share_pct"` // of the prefixes' weight
+	Keys      int                      `json:"keys"`      // called at least once
+	Requests  int64                    `json:"requests"`
+	RPS       float64                  `json:"rps"`
+	Allowed   int64                    `json:"allowed"`
+	Denied    int64                    `json:"denied"`
+	Errors    int64                    `json:"errors"`
+	LatencyMs *loadtest.LatencySummary `json:"latency_ms,omitempty"`
+}
+
+func (p *keyPrefixes) stats(keys [][]loadtest.KeyCounts, lats []loadtest.Histogram, dur time.Duration) []prefixStats {
+	stats := make([]prefixStats, len(p.entries))
+	for i, e := range p.entries {
+		s := prefixStats{Prefix: e.name, SharePct: e.weight / p.total * 100}
+		for _, c := range keys[i] {
+			if c.Requests > 0 {
+				s.Keys++
+				s.Requests += c.Requests
+			}
+			s.Allowed += c.Allowed
+			s.Denied += c.Denied
+			s.Errors += c.Errors
+		}
+		s.RPS = float64(s.Requests) / dur.Seconds()
+		if lats[i].TotalCount() > 0 {
+			s.LatencyMs = loadtest.Summarize(lats[i].Histogram)
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+func printPrefixes(w io.Writer, stats []prefixStats) {
+	fmt.Fprintf(w, "  By prefix:\n")
+	fmt.Fprintf(w, "    %-12s %6s %9s %8s %7s %7s %7s %9s %9s\n", "prefix", "share", "requests", "rps", "allowed", "denied", "errors", "p50 ms", "p99 ms")
+	for _, s := range stats {
+		var l loadtest.LatencySummary
+		if s.LatencyMs != nil {
+			l = *s.LatencyMs
+		}
+		decided := s.Allowed + s.Denied
+		fmt.Fprintf(w, "    %-12s %5.1f%% %9d %8.0f %6.1f%% %6.1f%% %7d %9.2f %9.2f\n",
+			s.Prefix, s.SharePct, s.Requests, s.RPS, pct(s.Allowed, decided), pct(s.Denied, decided), s.Errors, l.P50, l.P99)
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// keyStat is the results of one key.
+type keyStat struct {
+	Key      string `json:"key"`
+	Requests int64  `json:"requests"`
+	Allowed  int64  `json:"allowed"`
+	Denied   int64  `json:"denied"`
+	Errors   int64  `json:"errors"`
+}
+
+// busiestKeys returns the n keys with the most requests.
+func busiestKeys(keys [][]loadtest.KeyCounts, p *keyPrefixes, offset, n int) []keyStat {
+	var busiest []keyStat
+	for i := range keys {
+		for k, c := range keys[i] {
+			if c.Requests == 0 {
+				continue
+			}
+			busiest = append(busiest, keyStat{
+				Key:      p.entries[i].name + ":" + strconv.Itoa(offset+k),
+				Requests: c.Requests,
+				Allowed:  c.Allowed,
+				Denied:   c.Denied,
+				Errors:   c.Errors,
+			})
+		}
+	}
+	sort.Slice(busiest, func(i, j int) bool { return busiest[i].Requests > busiest[j].Requests })
+	return busiest[:min(n, len(busiest))]
+}
+
+func printTopKeys(w io.Writer, keys []keyStat) {
+	fmt.Fprintf(w, "  Busiest keys:\n")
+	fmt.Fprintf(w, "    %-20s %9s %9s %9s %7s\n", "key", "requests", "allowed", "denied", "errors")
+	for _, k := range keys {
+		fmt.Fprintf(w, "    %-20s %9d %9d %9d %7d\n", k.Key, k.Requests, k.Allowed, k.Denied, k.Errors)
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// loadCurve breaks a run with a varying rate into intervals, to show how
+// latency responds to the rate.
+type loadCurve struct {
+	every  time.Duration
+	stages []curveStage
+}
+
+type curveStage struct {
+	*latWindow
+	errors atomic.Int64
+}
+
+// curveInterval splits a run of dur into about 20 intervals.
+func curveInterval(dur time.Duration) time.Duration {
+	return max((dur / 20).Round(time.Second), time.Second)
+}
+
+func newLoadCurve(dur time.Duration, precision int) *loadCurve {
+	every := curveInterval(dur)
+	c := &loadCurve{every: every, stages: make([]curveStage, (dur+every-1)/every)}
+	for i := range c.stages {
+		c.stages[i].latWindow = newLatWindow(precision)
+	}
+	return c
+}
+
+// add records a call made at elapsed into the run. Calls made as the run
+// ends are left out.
+func (c *loadCurve) add(elapsed, lat time.Duration, failed bool) {
+	i := int(elapsed / c.every)
+	if i >= len(c.stages) {
+		return
+	}
+	c.stages[i].add(lat)
+	if failed {
+		c.stages[i].errors.Add(1)
+	}
+}
+
+func (c *loadCurve) results() []loadtest.CurveResults {
+	res := make([]loadtest.CurveResults, len(c.stages))
+	for i := range c.stages {
+		res[i] = loadtest.CurveResults{
+			Latencies: loadtest.Histogram{Histogram: c.stages[i].take()},
+			Errors:    c.stages[i].errors.Load(),
+		}
+	}
+	return res
+}
+
+// curvePoint is one interval of a run with a varying rate.
+type curvePoint struct {
+	AtSeconds float64 `json:"at_seconds"`
+	Target    float64 `json:"target_rps"`
+	Actual    float64 `json:"actual_rps"`
+	P50Ms     float64 `json:"p50_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	Errors    int64   `json:"errors"`
+}
+
+// curvePoints returns each interval's target and achieved rates with its
+// latencies.
+func curvePoints(prof loadtest.Profile, dur time.Duration, stages []loadtest.CurveResults) []curvePoint {
+	every := curveInterval(dur)
+	var points []curvePoint
+	for i, stage := range stages {
+		lats := stage.Latencies.Histogram
+		if lats.TotalCount() == 0 {
+			continue
+		}
+		at := time.Duration(i) * every
+		var target float64
+		for j := 0; j < 100; j++ {
+			target += prof.Rate(at+every*time.Duration(j)/100) / 100
+		}
+		points = append(points, curvePoint{
+			AtSeconds: at.Seconds(),
+			Target:    target,
+			Actual:    float64(lats.TotalCount()) / every.Seconds(),
+			P50Ms:     loadtest.Percentile(lats, 50).Seconds() * 1000,
+			P99Ms:     loadtest.Percentile(lats, 99).Seconds() * 1000,
+			Errors:    stage.Errors,
+		})
+	}
+	return points
+}
+
+func printCurve(w io.Writer, points []curvePoint) {
+	fmt.Fprintf(w, "  Load curve:\n")
+	fmt.Fprintf(w, "    %8s %9s %9s %9s %9s %7s\n", "time", "target", "actual", "p50 ms", "p99 ms", "errors")
+	for _, p := range points {
+		fmt.Fprintf(w, "    %8s %9.0f %9.0f %9.2f %9.2f %7d\n",
+			time.Duration(p.AtSeconds*float64(time.Second)), p.Target, p.Actual, p.P50Ms, p.P99Ms, p.Errors)
+	}
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// keySkew is how concentrated the requests were on the hottest keys.
+type keySkew struct {
+	Used       int     `json:"used"`
+	Total      int     `json:"total"`
+	HottestPct float64 `json:"hottest_pct"`
+	Top1Pct    float64 `json:"top1_pct"`
+	Top10Pct   float64 `json:"top10_pct"`
+}
+
+func keySkewOf(hits []int64) keySkew {
+	counts := slices.Clone(hits)
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i] > counts[j] })
+	k := keySkew{Total: len(counts)}
+	for _, c := range counts {
+		if c > 0 {
+			k.Used++
+		}
+	}
+	top := func(share float64) float64 {
+		var sum int64
+		for _, c := range counts[:max(1, int(float64(len(counts))*share))] {
+			sum += c
+		}
+		return pct(sum, total)
+	}
+	k.HottestPct, k.Top1Pct, k.Top10Pct = pct(counts[0], total), top(0.01), top(0.1)
+	return k
+}
+
+func (k keySkew) print(w io.Writer) {
+	if k.Used == 0 {
+		return
+	}
+	fmt.Fprintf(w, "  Keys:\n")
+	fmt.Fprintf(w, "    used      = %d of %d\n", k.Used, k.Total)
+	fmt.Fprintf(w, "    hottest   = %.1f%% of requests\n", k.HottestPct)
+	fmt.Fprintf(w, "    top 1%%    = %.1f%%\n", k.Top1Pct)
+	fmt.Fprintf(w, "    top 10%%   = %.1f%%\n", k.Top10Pct)
+	fmt.Fprintf(w, "───────────────────────────────────────────\n")
+}
+
+// writeHgrm writes h's percentile distribution to path in milliseconds.
+func writeHgrm(path string, h *hdrhistogram.Histogram) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := h.PercentilesPrint(f, 5, 1000); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
 
 func pct(n, total int64) float64 {
@@ -183,4 +1659,249 @@ func pct(n, total int64) float64 {
 		return 0
 	}
 	return float64(n) / float64(total) * 100
+}
+
+// latWindow collects the latencies of one interval, shared by all workers.
+type latWindow struct {
+	mu        sync.Mutex
+	lats      *hdrhistogram.Histogram
+	precision int
+}
+
+func newLatWindow(precision int) *latWindow {
+	return &latWindow{lats: loadtest.NewHistogram(precision), precision: precision}
+}
+
+func (w *latWindow) add(d time.Duration) {
+	w.mu.Lock()
+	loadtest.Record(w.lats, d)
+	w.mu.Unlock()
+}
+
+// take returns the latencies so far and starts a new window.
+func (w *latWindow) take() *hdrhistogram.Histogram {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lats := w.lats
+	w.lats = loadtest.NewHistogram(w.precision)
+	return lats
+}
+
+// soakSnapshot is one interval of a soak run. Target values are NaN when
+// its metrics couldn't be read.
+type soakSnapshot struct {
+	At         time.Duration
+	Requests   int64
+	Errors     int64
+	P50, P99   time.Duration
+	HeapBytes  float64
+	RSSBytes   float64
+	Goroutines float64
+	GCs        float64
+	GCPause    float64 // seconds, cumulative
+}
+
+// MarshalJSON writes durations in seconds and values that couldn't be read
+// as null.
+func (s soakSnapshot) MarshalJSON() ([]byte, error) {
+	num := func(f float64) *float64 {
+		if math.IsNaN(f) {
+			return nil
+		}
+		return &f
+	}
+	return json.Marshal(struct {
+		AtSeconds      float64  `json:"at_seconds"`
+		Requests       int64    `json:"requests"`
+		Errors         int64    `json:"errors"`
+		P50Ms          float64  `json:"p50_ms"`
+		P99Ms          float64  `json:"p99_ms"`
+		HeapBytes      *float64 `json:"heap_bytes"`
+		RSSBytes       *float64 `json:"rss_bytes"`
+		Goroutines     *float64 `json:"goroutines"`
+		GCs            *float64 `json:"gcs"`
+		GCPauseSeconds *float64 `json:"gc_pause_seconds"`
+	}{
+		s.At.Seconds(), s.Requests, s.Errors, s.P50.Seconds() * 1000, s.P99.Seconds() * 1000,
+		num(s.HeapBytes), num(s.RSSBytes), num(s.Goroutines), num(s.GCs), num(s.GCPause),
+	})
+}
+
+// targetMetrics are the target's series sampled in soak mode.
+var targetMetrics = []string{
+	"go_memstats_heap_inuse_bytes",
+	"process_resident_memory_bytes",
+	"go_goroutines",
+	"go_gc_duration_seconds_count",
+	"go_gc_duration_seconds_sum",
+}
+
+// runSoak takes a snapshot every interval until ctx is done.
+func runSoak(ctx context.Context, window *latWindow, interval time.Duration, metricsURL string, total, errs *atomic.Int64) []soakSnapshot {
+	var snaps []soakSnapshot
+	start := time.Now()
+	var lastReqs, lastErrs int64
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return snaps
+		case <-t.C:
+		}
+		s := soakSnapshot{At: time.Since(start).Round(time.Second)}
+		reqs, e := total.Load(), errs.Load()
+		s.Requests, s.Errors = reqs-lastReqs, e-lastErrs
+		lastReqs, lastErrs = reqs, e
+		if lats := window.take(); lats.TotalCount() > 0 {
+			s.P50, s.P99 = loadtest.Percentile(lats, 50), loadtest.Percentile(lats, 99)
+		}
+
+		m, err := scrapeMetrics(ctx, metricsURL)
+		if err != nil {
+			log.Printf("[soak] metrics: %v", err)
+		}
+		s.HeapBytes, s.RSSBytes, s.Goroutines = m["go_memstats_heap_inuse_bytes"], m["process_resident_memory_bytes"], m["go_goroutines"]
+		s.GCs, s.GCPause = m["go_gc_duration_seconds_count"], m["go_gc_duration_seconds_sum"]
+		snaps = append(snaps, s)
+
+		log.Printf("[soak %s] reqs=%d errors=%d p50=%.2fms p99=%.2fms heap=%.1fMB rss=%.1fMB goroutines=%.0f gcs=%.0f",
+			s.At, s.Requests, s.Errors, s.P50.Seconds()*1000, s.P99.Seconds()*1000,
+			s.HeapBytes/1e6, s.RSSBytes/1e6, s.Goroutines, s.GCs)
+	}
+}
+
+// scrapeMetrics reads the unlabelled targetMetrics from a Prometheus text
+// endpoint. Missing series are NaN.
+func scrapeMetrics(ctx context.Context, url string) (map[string]float64, error) {
+	out := make(map[string]float64, len(targetMetrics))
+	for _, name := range targetMetrics {
+		out[name] = math.NaN()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return out, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return out, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if _, ok := out[fields[0]]; !ok {
+			continue
+		}
+		if v, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			out[fields[0]] = v
+		}
+	}
+	return out, sc.Err()
+}
+
+// leaks applies heuristics to a soak run's snapshots, skipping the first
+// tenth as warm-up, and describes each suspicious trend. Steady state
+// should be flat: it compares the mean of the last third of the run with
+// the first.
+func leaks(snaps []soakSnapshot) []string {
+	snaps = snaps[len(snaps)/10:]
+	if len(snaps) < 6 {
+		return nil
+	}
+	series := func(f func(soakSnapshot) float64) (first, last []float64) {
+		third := len(snaps) / 3
+		for _, s := range snaps[:third] {
+			first = append(first, f(s))
+		}
+		for _, s := range snaps[len(snaps)-third:] {
+			last = append(last, f(s))
+		}
+		return first, last
+	}
+
+	var found []string
+	for _, c := range []struct {
+		name  string
+		value func(soakSnapshot) float64
+		limit float64 // growth ratio that counts as a trend
+	}{
+		{"heap in use", func(s soakSnapshot) float64 { return s.HeapBytes }, 1.2},
+		{"resident memory", func(s soakSnapshot) float64 { return s.RSSBytes }, 1.2},
+		{"goroutines", func(s soakSnapshot) float64 { return s.Goroutines }, 1.1},
+		{"p99 latency", func(s soakSnapshot) float64 { return s.P99.Seconds() }, 1.5},
+	} {
+		first, last := series(c.value)
+		a, b := mean(first), mean(last)
+		if math.IsNaN(a) || math.IsNaN(b) || a <= 0 {
+			continue
+		}
+		// Growth must be sustained, not one noisy sample: the whole last
+		// third sits above the whole first third.
+		if b/a > c.limit && minOf(last) > maxOf(first) {
+			found = append(found, fmt.Sprintf("%s grew %.0f%% (%.4g -> %.4g)", c.name, (b/a-1)*100, a, b))
+		}
+	}
+	return found
+}
+
+// printSoak prints the soak run's trend and leak verdict.
+func printSoak(w io.Writer, snaps []soakSnapshot, found []string) {
+	fmt.Fprintf(w, "  Soak (%d snapshots):\n", len(snaps))
+	if len(snaps) == 0 {
+		return
+	}
+	first, last := snaps[0], snaps[len(snaps)-1]
+	fmt.Fprintf(w, "    p99        %8.2fms -> %8.2fms\n", first.P99.Seconds()*1000, last.P99.Seconds()*1000)
+	fmt.Fprintf(w, "    heap       %8.1fMB -> %8.1fMB\n", first.HeapBytes/1e6, last.HeapBytes/1e6)
+	fmt.Fprintf(w, "    rss        %8.1fMB -> %8.1fMB\n", first.RSSBytes/1e6, last.RSSBytes/1e6)
+	fmt.Fprintf(w, "    goroutines %10.0f -> %10.0f\n", first.Goroutines, last.Goroutines)
+	if gcs := last.GCs - first.GCs; gcs > 0 {
+		fmt.Fprintf(w, "    gc         %10.0f cycles, %.2fms mean pause\n", gcs, (last.GCPause-first.GCPause)/gcs*1000)
+	}
+	if len(found) == 0 {
+		fmt.Fprintf(w, "  No leaks suspected\n")
+		return
+	}
+	for _, f := range found {
+		fmt.Fprintf(w, "  SUSPECTED LEAK: %s\n", f)
+	}
+}
+
+func mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+func minOf(xs []float64) float64 {
+	m := math.Inf(1)
+	for _, x := range xs {
+		m = math.Min(m, x)
+	}
+	return m
+}
+
+func maxOf(xs []float64) float64 {
+	m := math.Inf(-1)
+	for _, x := range xs {
+		m = math.Max(m, x)
+	}
+	return m
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+-- Fixed-Window Quota - Atomic Redis Lua Script
+-- KEYS[1] = quota counter key for the current window (e.g. "rlq:user:123:1718841600")
+-- KEYS[2] = quota counter key for the previous window (with rollover)
+-- ARGV[1] = quota limit for the window
+-- ARGV[2] = window end (unix seconds)
+-- ARGV[3] = tokens requested (may be fractional)
+-- ARGV[4] = share of the limit that may roll over from the previous window (optional, 0 = none)
+-- ARGV[5] = window length (seconds, with rollover)
+--
+-- Returns: {allowed(0|1), remaining, limit, reset_at}
+--
+-- The counter only grows when the request fits, so denied requests never
+-- eat into the quota. With rollover, the previous window's unused quota,
+-- capped at that share of the limit, is added to this window's limit.
+-- Carried quota doesn't carry again.
+
+local key       = KEYS[1]
+local prev_key  = KEYS[2]
+local limit     = tonumber(ARGV[1])
+local reset_at  = tonumber(ARGV[2])
+local requested = tonumber(ARGV[3])
+local rollover  = tonumber(ARGV[4]) or 0
+local period    = tonumber(ARGV[5]) or 0
+
+-- Keep the counter a little past the window end for Peek/debugging, and
+-- through the next window when it rolls over into it
+local expire_at = reset_at + 60
+if rollover > 0 then
+  local prev_used = tonumber(redis.call("GET", prev_key) or "0")
+  limit = limit + math.floor(math.min(math.max(0, limit - prev_used), limit * rollover))
+  expire_at = expire_at + period
+end
+
+local used = tonumber(redis.call("GET", key) or "0")
+
+local allowed = 0
+if used + requested <= limit then
+  used = tonumber(redis.call("INCRBYFLOAT", key, requested))
+  redis.call("EXPIREAT", key, expire_at)
+  allowed = 1
+end
+
+return {
+  allowed,
+  math.floor(math.max(0, limit - used)),
+  limit,
+  reset_at
+}
\ No newline at end of file
@@ -0,0 +1,86 @@
+-- Sliding Window Counter - Atomic Redis Lua Script
+-- The window is split into sub-windows, each counting the tokens admitted
+-- during it. A request fits when the sub-windows still inside the window
+-- leave room for it. More sub-windows follow the window more precisely,
+-- at the cost of one hash field each.
+--
+-- KEYS[1] = counter hash of the key (e.g. "rlw:user:123")
+-- ARGV[1] = limit (tokens per window)
+-- ARGV[2] = window length (milliseconds)
+-- ARGV[3] = number of sub-windows
+-- ARGV[4] = tokens requested (may be fractional)
+-- ARGV[5] = optional current time (float seconds), instead of Redis' clock
+--
+-- Returns: {allowed(0|1), remaining, limit, reset_at, retry_after_ms}
+--
+-- Denied requests never count against the window.
+
+redis.replicate_commands()
+
+local key       = KEYS[1]
+local limit     = tonumber(ARGV[1])
+local window    = tonumber(ARGV[2])
+local n         = tonumber(ARGV[3])
+local requested = tonumber(ARGV[4])
+
+local now = tonumber(ARGV[5])
+if now == nil then
+  local time = redis.call("TIME")
+  now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+end
+now = now * 1000
+
+local step    = window / n
+local current = math.floor(now / step)
+local oldest  = current - n + 1
+
+-- Sum the sub-windows still inside the window, dropping the others.
+-- counts[i] is the i-th of them, oldest first.
+local counts, used = {}, 0
+local fields = redis.call("HGETALL", key)
+for i = 1, #fields, 2 do
+  local idx = tonumber(fields[i])
+  if idx < oldest then
+    redis.call("HDEL", key, fields[i])
+  else
+    counts[idx - oldest + 1] = tonumber(fields[i + 1])
+    used = used + tonumber(fields[i + 1])
+  end
+end
+
+local allowed = 0
+local retry_after_ms = 0
+if used + requested <= limit then
+  used = used + requested
+  counts[n] = (counts[n] or 0) + requested
+  redis.call("HINCRBYFLOAT", key, current, requested)
+  redis.call("PEXPIRE", key, math.ceil(window + step))
+  allowed = 1
+elseif requested <= limit then
+  -- How long until enough sub-windows have slid out
+  local freed = 0
+  for i = 1, n do
+    freed = freed + (counts[i] or 0)
+    if used - freed + requested <= limit then
+      retry_after_ms = math.ceil((oldest + i - 1 + n) * step - now)
+      break
+    end
+  end
+end
+
+-- reset_at: time when everything counted has slid out of the window
+local reset_at = now
+for i = n, 1, -1 do
+  if (counts[i] or 0) > 0 then
+    reset_at = (oldest + i - 1 + n) * step
+    break
+  end
+end
+
+return {
+  allowed,
+  math.floor(math.max(0, limit - used)),
+  limit,
+  math.ceil(reset_at / 1000),
+  retry_after_ms
+}
\ No newline at end of file
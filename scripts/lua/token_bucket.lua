@@ -1,67 +1,87 @@
 -- Token Bucket Rate Limiter - Atomic Redis Lua Script
 -- KEYS[1] = rate limit key (e.g. "rl:user:123")
 -- ARGV[1] = bucket capacity (burst)
--- ARGV[2] = refill rate (tokens per second)
--- ARGV[3] = current timestamp (float seconds)
--- ARGV[4] = tokens requested
+-- ARGV[2] = refill rate (tokens per second, 0 = no refill)
+-- ARGV[3] = tokens requested (may be fractional)
+-- ARGV[4] = optional current time (float seconds), instead of Redis' clock
 --
--- Returns: {allowed(0|1), remaining, limit, reset_at, retry_after}
+-- Returns: {allowed(0|1), remaining, limit, reset_at, retry_after_ms,
+--           age_ms, idle_ms}
 --
 -- All state stored in a Redis hash:
---   tokens   = current token count (float)
---   last_ts  = last refill timestamp (float)
+--   tokens      = current token count (float)
+--   last_ts     = last refill timestamp (float seconds)
+--   created_ts  = when the bucket was created (float seconds)
+--   consumed_ts = when tokens were last consumed (float seconds)
+--
+-- The clock is Redis' own, so replicas with skewed clocks agree, unless
+-- the caller passes one (e.g. a test clock).
+
+redis.replicate_commands()
 
 local key       = KEYS[1]
 local capacity  = tonumber(ARGV[1])
 local rate      = tonumber(ARGV[2])
-local now       = tonumber(ARGV[3])
-local requested = tonumber(ARGV[4])
+local requested = tonumber(ARGV[3])
 
--- Fetch existing bucket state
-local bucket = redis.call("HMGET", key, "tokens", "last_ts")
-local tokens  = tonumber(bucket[1])
-local last_ts = tonumber(bucket[2])
+local now = tonumber(ARGV[4])
+if now == nil then
+  local time = redis.call("TIME")
+  now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+end
 
--- Initialize bucket on first request
+-- Fetch existing bucket state, refilling for the time elapsed since
+local bucket = redis.call("HMGET", key, "tokens", "last_ts", "created_ts", "consumed_ts")
+local tokens = tonumber(bucket[1])
+local created = tonumber(bucket[3])
+local consumed = tonumber(bucket[4])
 if tokens == nil then
-  tokens  = capacity
-  last_ts = now
+  tokens = capacity
+  created = now
+  redis.call("HSET", key, "created_ts", now)
+elseif rate > 0 then
+  local elapsed = math.max(0, now - tonumber(bucket[2]))
+  tokens = math.min(capacity, tokens + (elapsed * rate))
 end
 
--- Refill tokens based on elapsed time
-local elapsed = math.max(0, now - last_ts)
-tokens = math.min(capacity, tokens + (elapsed * rate))
-last_ts = now
-
 -- Attempt to consume tokens
 local allowed = 0
-local retry_after = 0.0
+local retry_after_ms = 0
 
 if tokens >= requested then
   tokens = tokens - requested
   allowed = 1
-else
-  -- Calculate how long until enough tokens are available
-  local deficit = requested - tokens
-  retry_after = deficit / rate
+  if requested > 0 then
+    consumed = now
+    redis.call("HSET", key, "consumed_ts", now)
+  end
+elseif rate > 0 then
+  -- How long until enough tokens are available
+  retry_after_ms = math.ceil((requested - tokens) / rate * 1000)
 end
 
--- Compute reset_at: time when bucket would be full again
+-- reset_at: time when the bucket would be full again
 local reset_at = now
-if tokens < capacity then
+if rate > 0 and tokens < capacity then
   reset_at = now + ((capacity - tokens) / rate)
 end
 
--- Persist state with TTL = time to full refill + buffer
-local ttl = math.ceil((capacity / rate) + 60)
-redis.call("HSET", key, "tokens", tostring(tokens), "last_ts", tostring(last_ts))
-redis.call("EXPIRE", key, ttl)
+-- Persist state. Idle buckets expire once they'd have refilled anyway;
+-- buckets that never refill must be kept.
+redis.call("HSET", key, "tokens", tokens, "last_ts", now)
+if rate > 0 then
+  redis.call("PEXPIRE", key, math.ceil((capacity / rate + 60) * 1000))
+end
 
--- Return: allowed, remaining (floor), limit, reset_at (ceil), retry_after
+-- Buckets created before creation times were tracked report an age of 0;
+-- buckets never consumed from have been idle since their creation
+created = created or now
 return {
   allowed,
   math.floor(tokens),
   capacity,
   math.ceil(reset_at),
-  tostring(retry_after)   -- return as string to preserve decimal
-}
\ No newline at end of file
+  retry_after_ms,
+  math.floor((now - created) * 1000),
+  math.floor((now - (consumed or created)) * 1000)
+}
@@ -0,0 +1,71 @@
+-- Batched Token Bucket - Atomic Redis Lua Script
+-- Runs independent token bucket checks for many keys in one EVAL, in order,
+-- with the same semantics as token_bucket.lua for each of them.
+--
+-- KEYS[i]       = rate limit keys (must share a hash slot in cluster mode)
+-- ARGV[3*i - 2] = bucket capacity (burst) of KEYS[i]
+-- ARGV[3*i - 1] = refill rate (tokens per second, 0 = no refill) of KEYS[i]
+-- ARGV[3*i]     = tokens requested from KEYS[i] (may be fractional)
+-- ARGV[3*#KEYS + 1] = optional current time (float seconds), instead of
+--                     Redis' clock
+--
+-- Buckets keep token_bucket.lua's created_ts and consumed_ts, but their
+-- ages aren't returned.
+--
+-- Returns a flat array, five entries per key:
+--   {allowed(0|1), remaining, limit, reset_at, retry_after_ms, ...}
+
+redis.replicate_commands()
+
+local now = tonumber(ARGV[3 * #KEYS + 1])
+if now == nil then
+  local time = redis.call("TIME")
+  now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+end
+
+local out = {}
+for i = 1, #KEYS do
+  local key       = KEYS[i]
+  local capacity  = tonumber(ARGV[3 * i - 2])
+  local rate      = tonumber(ARGV[3 * i - 1])
+  local requested = tonumber(ARGV[3 * i])
+
+  local bucket = redis.call("HMGET", key, "tokens", "last_ts")
+  local tokens = tonumber(bucket[1])
+  if tokens == nil then
+    tokens = capacity
+    redis.call("HSET", key, "created_ts", now)
+  elseif rate > 0 then
+    local elapsed = math.max(0, now - tonumber(bucket[2]))
+    tokens = math.min(capacity, tokens + (elapsed * rate))
+  end
+
+  local allowed = 0
+  local retry_after_ms = 0
+  if tokens >= requested then
+    tokens = tokens - requested
+    allowed = 1
+    redis.call("HSET", key, "consumed_ts", now)
+  elseif rate > 0 then
+    retry_after_ms = math.ceil((requested - tokens) / rate * 1000)
+  end
+
+  local reset_at = now
+  if rate > 0 and tokens < capacity then
+    reset_at = now + ((capacity - tokens) / rate)
+  end
+
+  redis.call("HSET", key, "tokens", tokens, "last_ts", now)
+  if rate > 0 then
+    redis.call("PEXPIRE", key, math.ceil((capacity / rate + 60) * 1000))
+  end
+
+  local base = 5 * (i - 1)
+  out[base + 1] = allowed
+  out[base + 2] = math.floor(tokens)
+  out[base + 3] = capacity
+  out[base + 4] = math.ceil(reset_at)
+  out[base + 5] = retry_after_ms
+end
+
+return out
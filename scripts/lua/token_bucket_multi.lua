@@ -0,0 +1,104 @@
+-- Hierarchical Token Bucket - Atomic Redis Lua Script
+-- Consumes from every bucket or from none, e.g. a user's bucket plus the
+-- tenant-wide cap it rolls up into.
+--
+-- KEYS[i]          = rate limit keys (must share a hash slot in cluster mode)
+-- ARGV[1]          = tokens requested (may be fractional)
+-- ARGV[2*i]        = bucket capacity (burst) of KEYS[i]
+-- ARGV[2*i + 1]    = refill rate (tokens per second, 0 = no refill) of KEYS[i]
+-- ARGV[2*#KEYS + 2] = optional current time (float seconds), instead of
+--                     Redis' clock
+--
+-- Buckets keep token_bucket.lua's created_ts and consumed_ts.
+--
+-- Returns the most restrictive bucket:
+--   {allowed(0|1), remaining, limit, reset_at, retry_after_ms, binding_index}
+
+redis.replicate_commands()
+
+local requested = tonumber(ARGV[1])
+local n         = #KEYS
+
+local now = tonumber(ARGV[2 * n + 2])
+if now == nil then
+  local time = redis.call("TIME")
+  now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+end
+
+local tokens, caps, rates, created = {}, {}, {}, {}
+local allowed = 1
+
+-- Refill every bucket and check whether all of them can pay
+for i = 1, n do
+  local capacity = tonumber(ARGV[2 * i])
+  local rate     = tonumber(ARGV[2 * i + 1])
+
+  local bucket = redis.call("HMGET", KEYS[i], "tokens", "last_ts")
+  local t      = tonumber(bucket[1])
+  if t == nil then
+    t = capacity
+    created[i] = true
+  elseif rate > 0 then
+    local elapsed = math.max(0, now - tonumber(bucket[2]))
+    t = math.min(capacity, t + (elapsed * rate))
+  end
+  tokens[i] = t
+  caps[i]   = capacity
+  rates[i]  = rate
+
+  if t < requested then
+    allowed = 0
+  end
+end
+
+-- Consume (all or nothing) and find the binding bucket: the one with the
+-- least remaining when allowed, the one with the longest wait when denied
+-- (a bucket that never refills waits longest)
+local binding = 1
+local retry_after = 0.0
+for i = 1, n do
+  if allowed == 1 then
+    tokens[i] = tokens[i] - requested
+    if tokens[i] < tokens[binding] then
+      binding = i
+    end
+  elseif tokens[i] < requested then
+    local wait = math.huge
+    if rates[i] > 0 then
+      wait = (requested - tokens[i]) / rates[i]
+    end
+    if wait > retry_after then
+      retry_after = wait
+      binding = i
+    end
+  end
+
+  redis.call("HSET", KEYS[i], "tokens", tokens[i], "last_ts", now)
+  if created[i] then
+    redis.call("HSET", KEYS[i], "created_ts", now)
+  end
+  if allowed == 1 then
+    redis.call("HSET", KEYS[i], "consumed_ts", now)
+  end
+  if rates[i] > 0 then
+    redis.call("PEXPIRE", KEYS[i], math.ceil((caps[i] / rates[i] + 60) * 1000))
+  end
+end
+
+local reset_at = now
+local retry_after_ms = 0
+if rates[binding] > 0 then
+  if tokens[binding] < caps[binding] then
+    reset_at = now + ((caps[binding] - tokens[binding]) / rates[binding])
+  end
+  retry_after_ms = math.ceil(retry_after * 1000)
+end
+
+return {
+  allowed,
+  math.floor(tokens[binding]),
+  caps[binding],
+  math.ceil(reset_at),
+  retry_after_ms,
+  binding - 1
+}
@@ -0,0 +1,61 @@
+-- Token Bucket Peek - Read-only Redis Lua Script
+-- Computes a bucket's state as token_bucket.lua would find it, without
+-- writing anything: missing buckets aren't created, and idle ones keep
+-- their expiry.
+--
+-- KEYS[1] = rate limit key (e.g. "rl:user:123")
+-- ARGV[1] = bucket capacity (burst)
+-- ARGV[2] = refill rate (tokens per second, 0 = no refill)
+-- ARGV[3] = tokens the caller would request (may be fractional)
+-- ARGV[4] = optional current time (float seconds), instead of Redis' clock
+--
+-- Returns token_bucket.lua's response for ARGV[3] tokens, none of them
+-- consumed:
+--   {allowed(0|1), remaining, limit, reset_at, retry_after_ms, age_ms, idle_ms}
+-- A missing bucket is full, aged 0.
+
+local key       = KEYS[1]
+local capacity  = tonumber(ARGV[1])
+local rate      = tonumber(ARGV[2])
+local requested = tonumber(ARGV[3])
+
+local now = tonumber(ARGV[4])
+if now == nil then
+  local time = redis.call("TIME")
+  now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+end
+
+local bucket   = redis.call("HMGET", key, "tokens", "last_ts", "created_ts", "consumed_ts")
+local tokens   = tonumber(bucket[1])
+local created  = tonumber(bucket[3]) or now
+local consumed = tonumber(bucket[4]) or created
+if tokens == nil then
+  tokens = capacity
+  created, consumed = now, now
+elseif rate > 0 then
+  local elapsed = math.max(0, now - tonumber(bucket[2]))
+  tokens = math.min(capacity, tokens + (elapsed * rate))
+end
+
+local allowed = 0
+local retry_after_ms = 0
+if tokens >= requested then
+  allowed = 1
+elseif rate > 0 then
+  retry_after_ms = math.ceil((requested - tokens) / rate * 1000)
+end
+
+local reset_at = now
+if rate > 0 and tokens < capacity then
+  reset_at = now + ((capacity - tokens) / rate)
+end
+
+return {
+  allowed,
+  math.floor(tokens),
+  capacity,
+  math.ceil(reset_at),
+  retry_after_ms,
+  math.floor((now - created) * 1000),
+  math.floor((now - consumed) * 1000)
+}
@@ -0,0 +1,17 @@
+-- Token Bucket Return - Atomic Redis Lua Script
+-- Gives unused leased tokens back to a bucket, never above its capacity.
+-- KEYS[1] = rate limit key (e.g. "rl:user:123")
+-- ARGV[1] = tokens to return (may be fractional)
+-- ARGV[2] = bucket capacity (burst)
+--
+-- Returns: 1 if the tokens were returned, 0 if the bucket had expired
+-- (an expired bucket starts full, so there is nothing to give back)
+
+local tokens = tonumber(redis.call("HGET", KEYS[1], "tokens"))
+if tokens == nil then
+  return 0
+end
+
+tokens = math.min(tonumber(ARGV[2]), tokens + tonumber(ARGV[1]))
+redis.call("HSET", KEYS[1], "tokens", tokens)
+return 1